@@ -0,0 +1,259 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrForbidden is matched by errors.Is for every access denied by an Authorizer.
+var ErrForbidden = errors.New("access denied")
+
+// FileAction is an operation on files checked by an Authorizer.
+type FileAction string
+
+// File actions consulted by the file helpers.
+const (
+	FileUpload   FileAction = "upload"
+	FileDownload FileAction = "download"
+	FileDelete   FileAction = "delete"
+	FileList     FileAction = "list"
+)
+
+// Subject is the user or service performing an operation.
+// Fields:
+// - ID: The subject's identifier, e.g. a user ID. Empty for anonymous requests.
+// - Roles: The subject's roles, e.g. "admin".
+// - Claims: Other attributes, e.g. from a token, available to custom authorizers and tenant resolvers.
+type Subject struct {
+	ID     string
+	Roles  []string
+	Claims map[string]string
+}
+
+// HasRole reports whether the subject has the role.
+func (s Subject) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+type subjectContextKey struct{}
+
+// WithSubject returns a copy of ctx carrying the subject, typically set by authentication middleware.
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, subjectContextKey{}, s)
+}
+
+// SubjectFromContext returns the subject stored with WithSubject, and whether there was one.
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	s, ok := ctx.Value(subjectContextKey{}).(Subject)
+	return s, ok
+}
+
+// AccessError describes a denied operation. It matches ErrForbidden with errors.Is and makes ErrorJSON respond
+// with 403 Forbidden.
+type AccessError struct {
+	Subject string
+	Action  FileAction
+	Object  string
+}
+
+// Error returns a message naming the action, without revealing the object path to clients.
+func (e *AccessError) Error() string {
+	return fmt.Sprintf("access denied: %s not allowed", e.Action)
+}
+
+// ErrorCode returns "access.denied".
+func (e *AccessError) ErrorCode() string {
+	return "access.denied"
+}
+
+// Is reports whether target is ErrForbidden.
+func (e *AccessError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// Authorizer decides whether a subject may perform an action on an object, a file or directory path.
+// File helpers such as UploadFiles, DownloadStaticFile, DeleteFile and ListFiles consult Tools.Authorizer
+// when it is set, with the subject stored in the request context.
+type Authorizer interface {
+	// Authorize returns nil if the action is allowed, or an error matching ErrForbidden if it is not.
+	Authorize(ctx context.Context, subject Subject, action FileAction, object string) error
+}
+
+// ACLRule grants actions on a path prefix to a role.
+// Fields:
+// - Role: The role granted, or "*" for every authenticated subject.
+// - Actions: The actions allowed. Empty means all actions.
+// - Prefix: The directory the rule applies to, including subdirectories. Empty means every path.
+type ACLRule struct {
+	Role    string
+	Actions []FileAction
+	Prefix  string
+}
+
+// RoleAuthorizer is a simple role-based Authorizer. An action is allowed if any rule grants it, or if the
+// object lies in the subject's home directory. Everything else, including any access by anonymous subjects
+// not covered by a rule, is denied.
+// Fields:
+// - Rules: The grants.
+// - HomeDir: If set, every authenticated subject may perform any action under HomeDir/<subject ID>, which gives
+// per-user file isolation without a rule per user.
+type RoleAuthorizer struct {
+	Rules   []ACLRule
+	HomeDir string
+}
+
+// Authorize checks the rules and home directory.
+func (a *RoleAuthorizer) Authorize(_ context.Context, subject Subject, action FileAction, object string) error {
+	if a.HomeDir != "" && subject.ID != "" && isSafeSegment(subject.ID) &&
+		pathWithin(object, filepath.Join(a.HomeDir, subject.ID)) {
+		return nil
+	}
+
+	for _, rule := range a.Rules {
+		if rule.Role == "*" && subject.ID == "" {
+			continue
+		}
+		if rule.Role != "*" && !subject.HasRole(rule.Role) {
+			continue
+		}
+		if rule.Prefix != "" && !pathWithin(object, rule.Prefix) {
+			continue
+		}
+		if len(rule.Actions) > 0 && !containsAction(rule.Actions, action) {
+			continue
+		}
+
+		return nil
+	}
+
+	return &AccessError{Subject: subject.ID, Action: action, Object: object}
+}
+
+// containsAction reports whether actions includes action.
+func containsAction(actions []FileAction, action FileAction) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pathWithin reports whether p is dir or inside it, comparing cleaned paths so "../" cannot escape.
+func pathWithin(p, dir string) bool {
+	p, dir = filepath.Clean(p), filepath.Clean(dir)
+	if p == dir {
+		return true
+	}
+
+	rel, err := filepath.Rel(dir, p)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isSafeSegment reports whether s can be used as a single path segment.
+func isSafeSegment(s string) bool {
+	return s != "." && s != ".." && !strings.ContainsAny(s, `/\`) && !strings.ContainsRune(s, 0)
+}
+
+// authorize consults t.Authorizer, if set, for the subject in ctx.
+func (t *Tools) authorize(ctx context.Context, action FileAction, object string) error {
+	if t.Authorizer == nil {
+		return nil
+	}
+
+	subject, _ := SubjectFromContext(ctx)
+
+	return t.Authorizer.Authorize(ctx, subject, action, object)
+}
+
+// FileInfo describes a file returned by ListFiles.
+type FileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+// DeleteFile removes a file after scoping its path to the tenant and checking the FileDelete permission.
+// Parameters:
+// - ctx: The context carrying the subject, e.g. r.Context().
+// - pathName: The path of the file.
+// Returns an error matching ErrForbidden if the action is denied, or the removal error.
+func (t *Tools) DeleteFile(ctx context.Context, pathName string) error {
+	pathName, err := t.TenantPath(ctx, pathName)
+	if err != nil {
+		return err
+	}
+
+	if err := t.authorize(ctx, FileDelete, pathName); err != nil {
+		return err
+	}
+
+	return os.Remove(pathName)
+}
+
+// ListFiles lists a directory after scoping its path to the tenant and checking the FileList permission.
+// Parameters:
+// - ctx: The context carrying the subject, e.g. r.Context().
+// - dir: The directory.
+// - filter: An optional FileFilter selecting the entries by name. Only the first filter is used if multiple are
+// provided.
+// Returns the entries sorted by name, or an error matching ErrForbidden if the action is denied.
+func (t *Tools) ListFiles(ctx context.Context, dir string, filter ...FileFilter) ([]FileInfo, error) {
+	dir, err := t.TenantPath(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.authorize(ctx, FileList, dir); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var f FileFilter
+	if len(filter) > 0 {
+		f = filter[0]
+	}
+
+	files := make([]FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if !f.Allows(e.Name(), e.IsDir()) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, FileInfo{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime(), IsDir: e.IsDir()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	return files, nil
+}
+
+// writeAccessError responds to a denied file operation.
+func writeAccessError(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+}
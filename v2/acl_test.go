@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var roleAuthorizerTests = []struct {
+	name    string
+	subject Subject
+	action  FileAction
+	object  string
+	allowed bool
+}{
+	{name: "own home", subject: Subject{ID: "ann"}, action: FileDelete, object: "/data/users/ann/a.txt", allowed: true},
+	{name: "other home", subject: Subject{ID: "ann"}, action: FileDownload, object: "/data/users/bob/a.txt"},
+	{name: "escape home", subject: Subject{ID: "ann"}, action: FileDownload, object: "/data/users/ann/../bob/a.txt"},
+	{name: "prefix sibling", subject: Subject{ID: "ann"}, action: FileDownload, object: "/data/users/anna/a.txt"},
+	{name: "admin", subject: Subject{ID: "root", Roles: []string{"admin"}}, action: FileDelete, object: "/data/users/bob/a.txt", allowed: true},
+	{name: "public read", subject: Subject{ID: "ann"}, action: FileDownload, object: "/data/public/logo.png", allowed: true},
+	{name: "public write", subject: Subject{ID: "ann"}, action: FileUpload, object: "/data/public"},
+	{name: "anonymous", subject: Subject{}, action: FileDownload, object: "/data/public/logo.png"},
+}
+
+func TestRoleAuthorizer(t *testing.T) {
+	authorizer := &RoleAuthorizer{
+		HomeDir: "/data/users",
+		Rules: []ACLRule{
+			{Role: "admin"},
+			{Role: "*", Actions: []FileAction{FileDownload, FileList}, Prefix: "/data/public"},
+		},
+	}
+
+	for _, e := range roleAuthorizerTests {
+		err := authorizer.Authorize(context.Background(), e.subject, e.action, e.object)
+
+		if e.allowed && err != nil {
+			t.Errorf("%s: expected access, got %s", e.name, err)
+		}
+
+		if !e.allowed && !errors.Is(err, ErrForbidden) {
+			t.Errorf("%s: expected ErrForbidden, got %v", e.name, err)
+		}
+	}
+}
+
+func TestTools_FileHelpersConsultAuthorizer(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "ann")
+	_ = os.MkdirAll(home, 0o755)
+	_ = os.WriteFile(filepath.Join(home, "a.txt"), []byte("a"), 0o644)
+	_ = os.WriteFile(filepath.Join(root, "secret.txt"), []byte("s"), 0o644)
+
+	testTools := Tools{Authorizer: &RoleAuthorizer{HomeDir: root}}
+	ann := WithSubject(context.Background(), Subject{ID: "ann"})
+
+	files, err := testTools.ListFiles(ann, home)
+	if err != nil || len(files) != 1 || files[0].Name != "a.txt" {
+		t.Errorf("expected own directory listing, got %v, %v", files, err)
+	}
+
+	if _, err := testTools.ListFiles(ann, root); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected listing outside home to be denied, got %v", err)
+	}
+
+	if err := testTools.DeleteFile(ann, filepath.Join(root, "secret.txt")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected delete outside home to be denied, got %v", err)
+	}
+
+	if err := testTools.DeleteFile(ann, filepath.Join(home, "a.txt")); err != nil {
+		t.Errorf("expected delete in home to succeed, got %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ann)
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, req, root, "secret.txt", "secret.txt")
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for download outside home, got %d", rr.Code)
+	}
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, _ := mw.CreateFormFile("file", "x.txt")
+	_, _ = part.Write([]byte("hello"))
+	_ = mw.Close()
+
+	upload := httptest.NewRequest(http.MethodPost, "/", body).WithContext(ann)
+	upload.Header.Set("Content-Type", mw.FormDataContentType())
+	_, err = testTools.UploadFiles(upload, root)
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected upload outside home to be denied, got %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected ErrorJSON to respond 403, got %d", rr.Code)
+	}
+}
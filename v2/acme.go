@@ -0,0 +1,660 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LetsEncryptURL is the directory URL of Let's Encrypt's production ACME server.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// acmeChallengePath is where ACME servers fetch HTTP-01 challenge responses.
+const acmeChallengePath = "/.well-known/acme-challenge/"
+
+// ErrACMEHostNotAllowed is returned by ACMEManager.GetCertificate for host names not in Hosts.
+var ErrACMEHostNotAllowed = errors.New("acme: host not allowed")
+
+// ACMEManager obtains and renews TLS certificates from an ACME certificate authority such as Let's Encrypt, using
+// HTTP-01 challenges. Certificates are obtained on the first TLS handshake for a host, cached in a FileStore so
+// restarts do not request new ones, and renewed in the background before they expire. Use it with Tools.Serve, or
+// set TLSConfig on an http.Server and serve HTTPHandler on port 80.
+// Fields:
+// - Hosts: The host names certificates may be obtained for. Handshakes for other names fail, so clients cannot
+// make the manager request certificates for arbitrary names.
+// - Email: The contact address for the ACME account, used for expiry notices.
+// - DirectoryURL: The ACME server's directory. Defaults to LetsEncryptURL.
+// - Cache: Where the account key and certificates are stored, e.g. a LocalFileStore. Without a cache, everything
+// is kept in memory and requested again on restart, which quickly hits Let's Encrypt's rate limits.
+// - RenewBefore: How long before expiry certificates are renewed. Defaults to 30 days.
+// - Client: The http.Client for requests to the ACME server. Defaults to one with a 30 second timeout.
+type ACMEManager struct {
+	Hosts        []string
+	Email        string
+	DirectoryURL string
+	Cache        FileStore
+	RenewBefore  time.Duration
+	Client       *http.Client
+
+	pollInterval time.Duration
+	flights      FlightGroup
+
+	mu       sync.Mutex
+	certs    map[string]*tls.Certificate
+	tokens   map[string]string
+	renewals map[string]time.Time
+
+	// the ACME session, used by one order at a time
+	orderMu    sync.Mutex
+	dir        *acmeDirectory
+	accountKey *ecdsa.PrivateKey
+	accountURL string
+	nonce      string
+}
+
+// acmeDirectory lists the ACME server's endpoints.
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+// acmeOrder is an ACME order.
+type acmeOrder struct {
+	Status         string   `json:"status"`
+	Authorizations []string `json:"authorizations"`
+	Finalize       string   `json:"finalize"`
+	Certificate    string   `json:"certificate"`
+}
+
+// acmeAuthorization is an ACME authorization of one identifier.
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Challenges []struct {
+		Type  string `json:"type"`
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	} `json:"challenges"`
+}
+
+// acmeProblem is an ACME error document.
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+// TLSConfig returns a TLS configuration serving the managed certificates.
+func (m *ACMEManager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		MinVersion:     tls.VersionTLS12,
+	}
+}
+
+// HTTPHandler returns the handler for port 80: it answers HTTP-01 challenges and passes other requests to
+// fallback.
+// Parameters:
+// - fallback: The handler for other requests. When nil, they are redirected to HTTPS.
+// Returns the handler.
+func (m *ACMEManager) HTTPHandler(fallback http.Handler) http.Handler {
+	if fallback == nil {
+		fallback = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if i := strings.LastIndex(host, ":"); i > 0 && !strings.HasSuffix(host, "]") {
+				host = host[:i]
+			}
+			http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, acmeChallengePath) {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		m.mu.Lock()
+		keyAuth, ok := m.tokens[strings.TrimPrefix(r.URL.Path, acmeChallengePath)]
+		m.mu.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(keyAuth))
+	})
+}
+
+// GetCertificate returns the certificate for the handshake's server name, for use as tls.Config.GetCertificate.
+// It is loaded from memory or the cache, or obtained from the ACME server on first use. Certificates close to
+// expiry are served while a renewal runs in the background.
+func (m *ACMEManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if host == "" && len(m.Hosts) > 0 {
+		host = strings.ToLower(m.Hosts[0])
+	}
+	if !m.allowed(host) {
+		return nil, fmt.Errorf("%w: %q", ErrACMEHostNotAllowed, host)
+	}
+
+	m.mu.Lock()
+	cert := m.certs[host]
+	m.mu.Unlock()
+
+	if cert == nil {
+		cert = m.loadCached(host)
+	}
+
+	if cert != nil {
+		if time.Until(cert.Leaf.NotAfter) < m.renewBefore() && m.startRenewal(host) {
+			go func() {
+				_, _ = m.obtain(host)
+			}()
+		}
+		return cert, nil
+	}
+
+	return m.obtain(host)
+}
+
+// allowed reports whether host is in Hosts.
+func (m *ACMEManager) allowed(host string) bool {
+	for _, h := range m.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startRenewal reports whether a background renewal of host should start: failed renewals are retried hourly, not
+// on every handshake.
+func (m *ACMEManager) startRenewal(host string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if time.Since(m.renewals[host]) < time.Hour {
+		return false
+	}
+	if m.renewals == nil {
+		m.renewals = make(map[string]time.Time)
+	}
+	m.renewals[host] = time.Now()
+
+	return true
+}
+
+// renewBefore returns the configured renewal window or the default.
+func (m *ACMEManager) renewBefore() time.Duration {
+	if m.RenewBefore > 0 {
+		return m.RenewBefore
+	}
+
+	return 30 * 24 * time.Hour
+}
+
+// obtain requests a certificate for host, sharing the request with concurrent callers, and caches it.
+func (m *ACMEManager) obtain(host string) (*tls.Certificate, error) {
+	v, err, _ := m.flights.Do(host, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+
+		data, err := m.order(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		cert, err := parseCertificatePEM(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.Cache != nil {
+			_ = m.Cache.Save(ctx, "acme/"+host+".pem", bytes.NewReader(data))
+		}
+		m.storeCert(host, cert)
+
+		return cert, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*tls.Certificate), nil
+}
+
+// loadCached returns the cached certificate for host, or nil.
+func (m *ACMEManager) loadCached(host string) *tls.Certificate {
+	data, err := m.readCache("acme/" + host + ".pem")
+	if err != nil {
+		return nil
+	}
+
+	cert, err := parseCertificatePEM(data)
+	if err != nil || !time.Now().Before(cert.Leaf.NotAfter) {
+		return nil
+	}
+	m.storeCert(host, cert)
+
+	return cert
+}
+
+// storeCert keeps a certificate in memory.
+func (m *ACMEManager) storeCert(host string, cert *tls.Certificate) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.certs == nil {
+		m.certs = make(map[string]*tls.Certificate)
+	}
+	m.certs[host] = cert
+}
+
+// readCache returns a cached file.
+func (m *ACMEManager) readCache(name string) ([]byte, error) {
+	if m.Cache == nil {
+		return nil, errors.New("acme: no cache")
+	}
+
+	f, err := m.Cache.Open(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// parseCertificatePEM parses a private key followed by a certificate chain.
+func parseCertificatePEM(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &cert, nil
+}
+
+// order runs an ACME order for host, returning the certificate key and chain in PEM.
+func (m *ACMEManager) order(ctx context.Context, host string) ([]byte, error) {
+	m.orderMu.Lock()
+	defer m.orderMu.Unlock()
+
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+
+	var order acmeOrder
+	res, err := m.post(ctx, m.dir.NewOrder, map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": host}},
+	}, &order)
+	if err != nil {
+		return nil, err
+	}
+	orderURL := res.Header.Get("Location")
+
+	for _, authzURL := range order.Authorizations {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: host},
+		DNSNames: []string{host},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := m.post(ctx, order.Finalize, map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csr)}, &order); err != nil {
+		return nil, err
+	}
+
+	for order.Status != "valid" {
+		if order.Status == "invalid" {
+			return nil, fmt.Errorf("acme: order for %s is invalid", host)
+		}
+		if err := m.wait(ctx); err != nil {
+			return nil, err
+		}
+		if _, err := m.post(ctx, orderURL, nil, &order); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err = m.post(ctx, order.Certificate, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	chain, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), chain...), nil
+}
+
+// authorize completes an authorization with the HTTP-01 challenge.
+func (m *ACMEManager) authorize(ctx context.Context, authzURL string) error {
+	var authz acmeAuthorization
+	if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+
+	var challengeURL, token string
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challengeURL, token = c.URL, c.Token
+		}
+	}
+	if challengeURL == "" {
+		return errors.New("acme: the server offers no http-01 challenge")
+	}
+
+	m.mu.Lock()
+	if m.tokens == nil {
+		m.tokens = make(map[string]string)
+	}
+	m.tokens[token] = token + "." + jwkThumbprint(&m.accountKey.PublicKey)
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.tokens, token)
+		m.mu.Unlock()
+	}()
+
+	if _, err := m.post(ctx, challengeURL, struct{}{}, nil); err != nil {
+		return err
+	}
+
+	for {
+		if err := m.wait(ctx); err != nil {
+			return err
+		}
+		if _, err := m.post(ctx, authzURL, nil, &authz); err != nil {
+			return err
+		}
+
+		switch authz.Status {
+		case "valid":
+			return nil
+		case "pending", "processing":
+		default:
+			return fmt.Errorf("acme: authorization %s", authz.Status)
+		}
+	}
+}
+
+// wait pauses between polls of the ACME server.
+func (m *ACMEManager) wait(ctx context.Context) error {
+	interval := m.pollInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(interval):
+		return nil
+	}
+}
+
+// register loads the directory and the account, creating the account key and account if needed.
+func (m *ACMEManager) register(ctx context.Context) error {
+	if m.dir == nil {
+		dirURL := m.DirectoryURL
+		if dirURL == "" {
+			dirURL = LetsEncryptURL
+		}
+
+		var dir acmeDirectory
+		if err := getJSON(ctx, m.client(), dirURL, "", &dir); err != nil {
+			return err
+		}
+		m.dir = &dir
+	}
+
+	if m.accountKey == nil {
+		key, err := m.loadAccountKey(ctx)
+		if err != nil {
+			return err
+		}
+		m.accountKey = key
+	}
+
+	if m.accountURL != "" {
+		return nil
+	}
+
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if m.Email != "" {
+		account["contact"] = []string{"mailto:" + m.Email}
+	}
+
+	res, err := m.post(ctx, m.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	m.accountURL = res.Header.Get("Location")
+	if m.accountURL == "" {
+		return errors.New("acme: the server returned no account URL")
+	}
+
+	return nil
+}
+
+// loadAccountKey returns the cached account key, creating and caching one if there is none.
+func (m *ACMEManager) loadAccountKey(ctx context.Context) (*ecdsa.PrivateKey, error) {
+	if data, err := m.readCache("acme/account.key"); err == nil {
+		if block, _ := pem.Decode(data); block != nil {
+			if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+				return key, nil
+			}
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.Cache != nil {
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Cache.Save(ctx, "acme/account.key", bytes.NewReader(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))); err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// client returns the configured http.Client or the default.
+func (m *ACMEManager) client() *http.Client {
+	if m.Client != nil {
+		return m.Client
+	}
+
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// post sends a JWS-signed request to the ACME server, retrying once if the nonce was rejected. A nil payload
+// sends a POST-as-GET. When out is not nil, the JSON response is decoded into it and the body closed; otherwise
+// the caller must close the body.
+func (m *ACMEManager) post(ctx context.Context, url string, payload interface{}, out interface{}) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := m.postOnce(ctx, url, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode >= 400 {
+			var problem acmeProblem
+			_ = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&problem)
+			res.Body.Close()
+
+			if problem.Type == "urn:ietf:params:acme:error:badNonce" && attempt == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("acme: %s: status %d: %s %s", url, res.StatusCode, problem.Type, problem.Detail)
+		}
+
+		if out != nil {
+			defer res.Body.Close()
+			if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(out); err != nil {
+				return nil, err
+			}
+		}
+
+		return res, nil
+	}
+}
+
+// postOnce signs and sends one request.
+func (m *ACMEManager) postOnce(ctx context.Context, url string, payload interface{}) (*http.Response, error) {
+	nonce, err := m.takeNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	protected := map[string]interface{}{"alg": "ES256", "nonce": nonce, "url": url}
+	if m.accountURL != "" {
+		protected["kid"] = m.accountURL
+	} else {
+		protected["jwk"] = jwk(&m.accountKey.PublicKey)
+	}
+
+	var encodedPayload string
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	header, _ := json.Marshal(protected)
+	encodedHeader := base64.RawURLEncoding.EncodeToString(header)
+
+	digest := sha256.Sum256([]byte(encodedHeader + "." + encodedPayload))
+	r, s, err := ecdsa.Sign(rand.Reader, m.accountKey, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+
+	body, _ := json.Marshal(map[string]string{
+		"protected": encodedHeader,
+		"payload":   encodedPayload,
+		"signature": base64.RawURLEncoding.EncodeToString(sig),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+
+	res, err := m.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	m.nonce = res.Header.Get("Replay-Nonce")
+
+	return res, nil
+}
+
+// takeNonce returns the nonce from the last response, or fetches a new one.
+func (m *ACMEManager) takeNonce(ctx context.Context) (string, error) {
+	if nonce := m.nonce; nonce != "" {
+		m.nonce = ""
+		return nonce, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, m.dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := m.client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+
+	nonce := res.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: the server returned no nonce")
+	}
+
+	return nonce, nil
+}
+
+// jwk returns the JSON Web Key of an ECDSA P-256 public key.
+func jwk(key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+// jwkThumbprint returns the RFC 7638 thumbprint of an ECDSA P-256 public key, used in key authorizations.
+func jwkThumbprint(key *ecdsa.PublicKey) string {
+	k := jwk(key)
+	// the members in lexicographic order, without whitespace
+	data := `{"crv":"P-256","kty":"EC","x":"` + k["x"] + `","y":"` + k["y"] + `"}`
+	sum := sha256.Sum256([]byte(data))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
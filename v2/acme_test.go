@@ -0,0 +1,269 @@
+package toolkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeACMEServer is an ACME server issuing certificates from a test CA after checking the HTTP-01 challenge
+// through the manager's HTTP handler.
+type fakeACMEServer struct {
+	*httptest.Server
+	t       *testing.T
+	ca      *testCA
+	manager *ACMEManager
+	orders  int32
+
+	mu         sync.Mutex
+	nonces     map[string]bool
+	accountKey *ecdsa.PublicKey
+	authzValid bool
+	cert       []byte
+	lifetime   time.Duration
+}
+
+func newFakeACMEServer(t *testing.T) *fakeACMEServer {
+	s := &fakeACMEServer{t: t, ca: newTestCA(t), nonces: make(map[string]bool), lifetime: 90 * 24 * time.Hour}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *fakeACMEServer) newNonce(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce := randomToken()
+	s.nonces[nonce] = true
+	w.Header().Set("Replay-Nonce", nonce)
+}
+
+func (s *fakeACMEServer) serve(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/dir":
+		_ = json.NewEncoder(w).Encode(map[string]string{"newNonce": s.URL + "/nonce", "newAccount": s.URL + "/account", "newOrder": s.URL + "/order"})
+		return
+	case r.URL.Path == "/nonce":
+		s.newNonce(w)
+		return
+	}
+
+	payload, err := s.verify(r)
+	s.newNonce(w)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(acmeProblem{Type: "urn:ietf:params:acme:error:malformed", Detail: err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := func(status string) acmeOrder {
+		return acmeOrder{Status: status, Authorizations: []string{s.URL + "/authz/1"}, Finalize: s.URL + "/finalize/1", Certificate: s.URL + "/cert/1"}
+	}
+
+	switch r.URL.Path {
+	case "/account":
+		w.Header().Set("Location", s.URL+"/acct/1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"status":"valid"}`))
+	case "/order":
+		atomic.AddInt32(&s.orders, 1)
+		s.authzValid, s.cert = false, nil
+		w.Header().Set("Location", s.URL+"/order/1")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(order("pending"))
+	case "/authz/1":
+		status := "pending"
+		if s.authzValid {
+			status = "valid"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "challenges": []map[string]string{
+			{"type": "dns-01", "url": s.URL + "/chall/2", "token": "dns"},
+			{"type": "http-01", "url": s.URL + "/chall/1", "token": "tok1"},
+		}})
+	case "/chall/1":
+		// validate the challenge as Let's Encrypt would, through the HTTP handler
+		rr := httptest.NewRecorder()
+		s.manager.HTTPHandler(nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/tok1", nil))
+		s.authzValid = rr.Body.String() == "tok1."+jwkThumbprint(s.accountKey)
+		_, _ = w.Write([]byte(`{"status":"processing"}`))
+	case "/finalize/1":
+		var in struct{ CSR string }
+		_ = json.Unmarshal(payload, &in)
+		der, _ := base64.RawURLEncoding.DecodeString(in.CSR)
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil || !s.authzValid {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"type":"urn:ietf:params:acme:error:unauthorized"}`))
+			return
+		}
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(s.lifetime),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		cert, _ := x509.CreateCertificate(rand.Reader, template, s.ca.cert, csr.PublicKey, s.ca.key)
+		s.cert = append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.ca.cert.Raw})...)
+		_ = json.NewEncoder(w).Encode(order("processing"))
+	case "/order/1":
+		_ = json.NewEncoder(w).Encode(order("valid"))
+	case "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		_, _ = w.Write(s.cert)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// verify checks a JWS request's nonce, URL and signature and returns its payload.
+func (s *fakeACMEServer) verify(r *http.Request) ([]byte, error) {
+	var jws struct{ Protected, Payload, Signature string }
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		return nil, err
+	}
+
+	header, _ := base64.RawURLEncoding.DecodeString(jws.Protected)
+	var protected struct {
+		Alg, Nonce, URL, Kid string
+		JWK                  map[string]string
+	}
+	if err := json.Unmarshal(header, &protected); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.nonces[protected.Nonce] {
+		return nil, errors.New("bad nonce")
+	}
+	delete(s.nonces, protected.Nonce)
+	if protected.URL != s.URL+r.URL.Path {
+		return nil, errors.New("url mismatch")
+	}
+
+	if protected.JWK != nil {
+		x, _ := base64.RawURLEncoding.DecodeString(protected.JWK["x"])
+		y, _ := base64.RawURLEncoding.DecodeString(protected.JWK["y"])
+		s.accountKey = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	} else if protected.Kid != s.URL+"/acct/1" {
+		return nil, errors.New("unknown account")
+	}
+
+	sig, _ := base64.RawURLEncoding.DecodeString(jws.Signature)
+	digest := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+	if s.accountKey == nil || len(sig) != 64 ||
+		!ecdsa.Verify(s.accountKey, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, errors.New("bad signature")
+	}
+
+	return base64.RawURLEncoding.DecodeString(jws.Payload)
+}
+
+func newTestACMEManager(s *fakeACMEServer, cache FileStore) *ACMEManager {
+	m := &ACMEManager{Hosts: []string{"example.com"}, Email: "ops@example.com", DirectoryURL: s.URL + "/dir", Cache: cache, pollInterval: time.Millisecond}
+	s.manager = m
+
+	return m
+}
+
+func TestACMEManager_GetCertificate(t *testing.T) {
+	server := newFakeACMEServer(t)
+	cache := NewLocalFileStore(t.TempDir())
+	m := newTestACMEManager(server, cache)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Leaf.DNSNames) != 1 || cert.Leaf.DNSNames[0] != "example.com" {
+		t.Errorf("expected a certificate for example.com, got %v", cert.Leaf.DNSNames)
+	}
+
+	if again, _ := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "EXAMPLE.com."}); again != cert {
+		t.Error("expected the certificate to be reused")
+	}
+
+	// a restarted process loads the certificate from the cache
+	restarted := newTestACMEManager(server, cache)
+	if _, err := restarted.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&server.orders); n != 1 {
+		t.Errorf("expected one order, got %d", n)
+	}
+
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example"}); !errors.Is(err, ErrACMEHostNotAllowed) {
+		t.Errorf("expected ErrACMEHostNotAllowed, got %v", err)
+	}
+}
+
+func TestACMEManager_Renewal(t *testing.T) {
+	server := newFakeACMEServer(t)
+	server.lifetime = time.Hour
+	m := newTestACMEManager(server, nil)
+
+	old, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the certificate expires within the renewal window, so it is served while a new one is obtained
+	if cert, _ := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"}); cert != old {
+		t.Error("expected the old certificate during renewal")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&server.orders) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	for time.Now().Before(deadline) {
+		m.mu.Lock()
+		renewed := m.certs["example.com"] != old
+		m.mu.Unlock()
+		if renewed {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("expected the certificate to be renewed")
+}
+
+func TestACMEManager_HTTPHandler(t *testing.T) {
+	m := &ACMEManager{Hosts: []string{"example.com"}}
+	handler := m.HTTPHandler(nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com:80/login?next=/", nil))
+	if rr.Code != http.StatusMovedPermanently || rr.Header().Get("Location") != "https://example.com/login?next=/" {
+		t.Errorf("expected a redirect to HTTPS, got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "http://example.com/.well-known/acme-challenge/unknown", nil))
+	if rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), ".") {
+		t.Errorf("expected 404 for an unknown token, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,353 @@
+package toolkit
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//go:embed admin/dashboard.html
+var adminFS embed.FS
+
+// adminTemplate renders the dashboard of AdminHandler.
+var adminTemplate = template.Must(template.New("dashboard.html").
+	Funcs(template.FuncMap{"formatBytes": formatBytes}).
+	ParseFS(adminFS, "admin/dashboard.html"))
+
+// adminListLimit is the most exports and errors shown on the dashboard.
+const adminListLimit = 50
+
+// RecentErrors is an ErrorReporter keeping the latest reports in memory, for AdminHandler, and passing them on to
+// another reporter. The zero value keeps 100 reports; set it as Tools.ErrorReporter:
+//
+//	recent := &toolkit.RecentErrors{Next: sentry}
+//	tools.ErrorReporter = recent
+//
+// Fields:
+// - Size: The number of reports kept. Defaults to 100.
+// - Next: If set, receives every report too.
+type RecentErrors struct {
+	Size int
+	Next ErrorReporter
+
+	mu      sync.Mutex
+	reports []ErrorReport
+	next    int
+}
+
+// ReportError keeps the report, replacing the oldest once Size are kept, and passes it on to Next.
+func (re *RecentErrors) ReportError(ctx context.Context, report ErrorReport) error {
+	size := re.Size
+	if size <= 0 {
+		size = 100
+	}
+
+	re.mu.Lock()
+	if len(re.reports) < size {
+		re.reports = append(re.reports, report)
+	} else {
+		re.reports[re.next%len(re.reports)] = report
+	}
+	re.next = (re.next + 1) % size
+	re.mu.Unlock()
+
+	if re.Next != nil {
+		return re.Next.ReportError(ctx, report)
+	}
+
+	return nil
+}
+
+// Reports returns the kept reports, newest first.
+func (re *RecentErrors) Reports() []ErrorReport {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	reports := make([]ErrorReport, 0, len(re.reports))
+	for i := 1; i <= len(re.reports); i++ {
+		reports = append(reports, re.reports[(re.next-i+len(re.reports))%len(re.reports)])
+	}
+
+	return reports
+}
+
+// AdminOptions configures AdminHandler. Each section of the dashboard is shown only when its source is set.
+// Fields:
+// - Title: The page title. Defaults to "Admin".
+// - Dir: The directory of uploaded files to list, browse, search, preview and delete. Paths go through
+// TenantPath and Tools.Authorizer as with ListFiles and DeleteFile; previews need the FileDownload permission.
+// - Previewer: Renders previews of files. If nil, files have no preview link.
+// - Exporter: The export jobs to list.
+// - Scheduler: The scheduled jobs to list.
+// - Errors: The recent errors to list, e.g. the RecentErrors set as Tools.ErrorReporter.
+type AdminOptions struct {
+	Title     string
+	Dir       string
+	Previewer *Previewer
+	Exporter  *Exporter
+	Scheduler *Scheduler
+	Errors    *RecentErrors
+}
+
+// AdminHandler returns a small admin dashboard, rendered from embedded templates, over the file and job helpers:
+// it lists and searches the uploaded files, with preview and delete actions, the export and scheduled jobs, and
+// the recent errors. It only links relative to itself, so mount it under a prefix with http.StripPrefix:
+//
+//	mux.Handle("/admin/", http.StripPrefix("/admin", tools.AdminHandler(adminOnly, toolkit.AdminOptions{
+//		Dir:       "./uploads",
+//		Previewer: toolkit.NewPreviewer(),
+//		Exporter:  exporter,
+//		Errors:    recentErrors,
+//	})))
+//
+// Deletes are protected by CSRFMiddleware. Searches match names in the current directory, as a case-insensitive
+// substring or, if the query has a "*", "?" or "[", as a FileMatcher pattern.
+// Parameters:
+// - auth: The middleware guarding every page, e.g. Authorize with an admin policy. If nil, every request is
+// refused with 403 Forbidden.
+// - opts: Optional AdminOptions. Only the first value is used if multiple are provided.
+// Returns the handler.
+func (t *Tools) AdminHandler(auth func(http.Handler) http.Handler, opts ...AdminOptions) http.Handler {
+	var o AdminOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Title == "" {
+		o.Title = "Admin"
+	}
+	if auth == nil {
+		auth = t.denyAll
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		t.adminDashboard(w, r, o)
+	})
+	if o.Dir != "" {
+		mux.HandleFunc("POST /delete", func(w http.ResponseWriter, r *http.Request) {
+			t.adminDelete(w, r, o)
+		})
+	}
+	if o.Dir != "" && o.Previewer != nil {
+		mux.HandleFunc("GET /preview", func(w http.ResponseWriter, r *http.Request) {
+			t.adminPreview(w, r, o)
+		})
+	}
+
+	return auth(t.CSRFMiddleware()(mux))
+}
+
+// adminPage is the data of the dashboard template.
+type adminPage struct {
+	Title       string
+	Notice      string
+	CSRFField   template.HTML
+	Preview     bool
+	Files       *adminFiles
+	ShowExports bool
+	Exports     []ExportJob
+	ShowJobs    bool
+	Jobs        []adminJob
+	ShowErrors  bool
+	Errors      []ErrorReport
+}
+
+// adminFiles is the files section of the dashboard.
+type adminFiles struct {
+	Dir     string
+	Query   string
+	Crumbs  []adminEntry
+	Entries []adminEntry
+	Error   string
+}
+
+// adminEntry is a file or directory, with its path relative to AdminOptions.Dir.
+type adminEntry struct {
+	FileInfo
+	Path string
+}
+
+// adminJob is a scheduled job with its name.
+type adminJob struct {
+	Name  string
+	Stats JobStats
+}
+
+// adminDashboard renders the dashboard.
+func (t *Tools) adminDashboard(w http.ResponseWriter, r *http.Request, o AdminOptions) {
+	page := adminPage{
+		Title:     o.Title,
+		Notice:    adminNotice(r.URL.Query()),
+		CSRFField: CSRFField(r),
+		Preview:   o.Previewer != nil,
+	}
+
+	if o.Dir != "" {
+		page.Files = t.adminFiles(r, o)
+	}
+
+	if o.Exporter != nil {
+		page.ShowExports = true
+		page.Exports = o.Exporter.Jobs("")
+		page.Exports = page.Exports[:min(len(page.Exports), adminListLimit)]
+	}
+
+	if o.Scheduler != nil {
+		page.ShowJobs = true
+		for name, stats := range o.Scheduler.Stats() {
+			page.Jobs = append(page.Jobs, adminJob{Name: name, Stats: stats})
+		}
+		sort.Slice(page.Jobs, func(i, j int) bool { return page.Jobs[i].Name < page.Jobs[j].Name })
+	}
+
+	if o.Errors != nil {
+		page.ShowErrors = true
+		page.Errors = o.Errors.Reports()
+		page.Errors = page.Errors[:min(len(page.Errors), adminListLimit)]
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	if err := adminTemplate.Execute(w, page); err != nil {
+		_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+	}
+}
+
+// adminFiles lists the directory of the request's "dir" parameter, filtered by its "q" parameter.
+func (t *Tools) adminFiles(r *http.Request, o AdminOptions) *adminFiles {
+	q := r.URL.Query()
+	files := &adminFiles{Dir: strings.Trim(path.Clean("/"+q.Get("dir")), "/"), Query: q.Get("q")}
+
+	dir, err := t.SafeJoin(o.Dir, files.Dir)
+	if err != nil {
+		files.Error = err.Error()
+		return files
+	}
+
+	for crumb := files.Dir; crumb != "" && crumb != "."; crumb = path.Dir(crumb) {
+		files.Crumbs = append([]adminEntry{{FileInfo: FileInfo{Name: path.Base(crumb)}, Path: crumb}}, files.Crumbs...)
+	}
+
+	var matcher *FileMatcher
+	if strings.ContainsAny(files.Query, "*?[") {
+		if matcher, err = NewFileMatcher(files.Query); err != nil {
+			files.Error = err.Error()
+			return files
+		}
+	}
+
+	list, err := t.ListFiles(r.Context(), dir)
+	if err != nil {
+		files.Error = "the directory cannot be listed"
+		if errors.Is(err, ErrForbidden) {
+			files.Error = "you may not list this directory"
+		}
+		return files
+	}
+
+	substring := strings.ToLower(files.Query)
+	for _, f := range list {
+		if matcher != nil && !matcher.Match(f.Name, f.IsDir) ||
+			matcher == nil && !strings.Contains(strings.ToLower(f.Name), substring) {
+			continue
+		}
+		files.Entries = append(files.Entries, adminEntry{FileInfo: f, Path: path.Join(files.Dir, f.Name)})
+	}
+
+	return files
+}
+
+// adminDelete deletes the file of the "path" form value, then redirects to its directory with a notice.
+func (t *Tools) adminDelete(w http.ResponseWriter, r *http.Request, o AdminOptions) {
+	rel := strings.Trim(path.Clean("/"+r.FormValue("path")), "/")
+
+	q := url.Values{"deleted": {rel}}
+	name, err := t.SafeJoin(o.Dir, rel)
+	if err == nil {
+		err = t.DeleteFile(r.Context(), name)
+	}
+	switch {
+	case errors.Is(err, ErrForbidden):
+		q.Set("error", "forbidden")
+	case err != nil:
+		q.Set("error", "failed")
+	}
+	if dir := path.Dir(rel); dir != "." {
+		q.Set("dir", dir)
+	}
+
+	// relative, so it resolves under the prefix the handler is mounted at
+	w.Header().Set("Location", "./?"+q.Encode())
+	w.WriteHeader(http.StatusSeeOther)
+}
+
+// adminNotice returns the message about a delete that redirected to the dashboard. Only the file name comes from
+// the URL, so links cannot put arbitrary messages on the page.
+func adminNotice(q url.Values) string {
+	name := q.Get("deleted")
+	if name == "" {
+		return ""
+	}
+
+	switch q.Get("error") {
+	case "":
+		return "Deleted " + name
+	case "forbidden":
+		return "You may not delete " + name
+	}
+
+	return "Could not delete " + name
+}
+
+// adminPreview renders a preview of the file of the "path" parameter.
+func (t *Tools) adminPreview(w http.ResponseWriter, r *http.Request, o AdminOptions) {
+	name, err := t.SafeJoin(o.Dir, r.URL.Query().Get("path"))
+	if err == nil {
+		name, err = t.TenantPath(r.Context(), name)
+	}
+	if err != nil {
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+	if err := t.authorize(r.Context(), FileDownload, name); err != nil {
+		_ = t.ErrorJSON(w, err)
+		return
+	}
+
+	preview, err := o.Previewer.Generate(r.Context(), name, "")
+	if err != nil {
+		_ = t.ErrorJSON(w, errors.New("no preview available"), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", preview.MIMEType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+	_, _ = w.Write(preview.Data)
+}
+
+// formatBytes formats a size in bytes with a binary unit, e.g. "1.5 MB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,224 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecentErrors(t *testing.T) {
+	var forwarded []string
+	re := &RecentErrors{Size: 3, Next: ErrorReporterFunc(func(_ context.Context, r ErrorReport) error {
+		forwarded = append(forwarded, r.ID)
+		return nil
+	})}
+
+	if len(re.Reports()) != 0 {
+		t.Fatal("expected no reports")
+	}
+
+	for i := 1; i <= 5; i++ {
+		_ = re.ReportError(context.Background(), ErrorReport{ID: fmt.Sprint(i)})
+	}
+
+	var ids []string
+	for _, r := range re.Reports() {
+		ids = append(ids, r.ID)
+	}
+	if strings.Join(ids, ",") != "5,4,3" {
+		t.Errorf("expected the newest 3 reports, newest first, got %v", ids)
+	}
+	if len(forwarded) != 5 {
+		t.Errorf("expected every report forwarded, got %v", forwarded)
+	}
+}
+
+// adminClient is a browser-like client of an AdminHandler, keeping its CSRF cookie.
+func adminClient(t *testing.T, h http.Handler) (*httptest.Server, *http.Client) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/", http.StripPrefix("/admin", h))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	jar, _ := cookiejar.New(nil)
+	return srv, &http.Client{Jar: jar}
+}
+
+// adminGet returns the status and body of a page.
+func adminGet(t *testing.T, client *http.Client, u string) (int, string) {
+	t.Helper()
+
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestTools_AdminHandler(t *testing.T) {
+	var testTools Tools
+
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "reports"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "invoice.pdf"), []byte("%PDF-1.4"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("meeting notes"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "reports", "q3.csv"), []byte("a,b\n1,2\n"), 0o644)
+
+	sched := NewScheduler()
+	_ = sched.Register("cleanup", "@hourly", func(context.Context) error { return nil })
+
+	exporter := newTestExporter(t)
+	_, _ = exporter.Start(context.Background(), ExportRequest{Name: "Monthly orders", Filename: "orders.csv", Write: CSVExport(func(context.Context, *csv.Writer) error { return nil })})
+	_ = exporter.Wait(context.Background())
+
+	recent := &RecentErrors{}
+	_ = recent.ReportError(context.Background(), ErrorReport{ID: "x", Message: "database <down>", Status: 500})
+
+	allow := func(next http.Handler) http.Handler { return next }
+	srv, client := adminClient(t, testTools.AdminHandler(allow, AdminOptions{
+		Title:     "Ops",
+		Dir:       dir,
+		Previewer: &Previewer{},
+		Exporter:  exporter,
+		Scheduler: sched,
+		Errors:    recent,
+	}))
+
+	status, page := adminGet(t, client, srv.URL+"/admin/")
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", status, page)
+	}
+	for _, want := range []string{"<title>Ops</title>", "invoice.pdf", "notes.txt", "?dir=reports", "cleanup", "database &lt;down&gt;", "Preview", "Monthly orders"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected the dashboard to contain %q", want)
+		}
+	}
+
+	tests := []struct {
+		name, query string
+		want, skip  []string
+	}{
+		{"substring", "?q=NOTE", []string{"notes.txt"}, []string{"invoice.pdf"}},
+		{"glob", "?q=*.pdf", []string{"invoice.pdf"}, []string{"notes.txt", "reports/"}},
+		{"subdirectory", "?dir=reports", []string{"q3.csv", ">reports</a>"}, []string{"invoice.pdf"}},
+		{"traversal", "?dir=../..", []string{"invoice.pdf"}, nil},
+	}
+
+	for _, e := range tests {
+		_, page := adminGet(t, client, srv.URL+"/admin/"+e.query)
+		for _, want := range e.want {
+			if !strings.Contains(page, want) {
+				t.Errorf("%s: expected %q", e.name, want)
+			}
+		}
+		for _, skip := range e.skip {
+			if strings.Contains(page, skip) {
+				t.Errorf("%s: expected no %q", e.name, skip)
+			}
+		}
+	}
+
+	status, preview := adminGet(t, client, srv.URL+"/admin/preview?path=notes.txt")
+	if status != http.StatusOK || !strings.Contains(preview, "meeting notes") {
+		t.Errorf("expected a text preview, got %d %s", status, preview)
+	}
+	if status, _ := adminGet(t, client, srv.URL+"/admin/preview?path=../secret"); status != http.StatusBadRequest {
+		t.Errorf("expected a path outside the directory refused, got %d", status)
+	}
+
+	resp, err := client.PostForm(srv.URL+"/admin/delete", url.Values{"path": {"notes.txt"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected a delete without a CSRF token refused, got %d", resp.StatusCode)
+	}
+
+	token := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(page)
+	if token == nil {
+		t.Fatal("expected a CSRF token in the delete forms")
+	}
+	resp, err = client.PostForm(srv.URL+"/admin/delete", url.Values{"path": {"reports/q3.csv"}, "csrf_token": {token[1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Request.URL.Path != "/admin/" || resp.Request.URL.Query().Get("dir") != "reports" {
+		t.Errorf("expected a redirect to the file's directory, got %s", resp.Request.URL)
+	}
+	if !strings.Contains(string(body), "Deleted reports/q3.csv") {
+		t.Error("expected a notice of the delete")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "reports", "q3.csv")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected the file to be deleted")
+	}
+}
+
+func TestTools_AdminHandlerAccess(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.AdminHandler(nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a nil auth to refuse, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.AdminHandler(func(next http.Handler) http.Handler { return next }).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "<h2>") {
+		t.Errorf("expected an empty dashboard without sources, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644)
+
+	denyingTools := Tools{Authorizer: &RoleAuthorizer{}}
+	allow := func(next http.Handler) http.Handler { return next }
+	srv, client := adminClient(t, denyingTools.AdminHandler(allow, AdminOptions{Dir: dir, Previewer: &Previewer{}}))
+
+	_, page := adminGet(t, client, srv.URL+"/admin/")
+	if !strings.Contains(page, "you may not list this directory") || strings.Contains(page, "a.txt") {
+		t.Error("expected the Authorizer to hide the files")
+	}
+	if status, _ := adminGet(t, client, srv.URL+"/admin/preview?path=a.txt"); status != http.StatusForbidden {
+		t.Errorf("expected the Authorizer to refuse the preview, got %d", status)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KB"},
+		{5 << 20, "5.0 MB"},
+		{3 << 30, "3.0 GB"},
+	}
+
+	for _, e := range tests {
+		if got := formatBytes(e.n); got != e.want {
+			t.Errorf("%d: expected %s, got %s", e.n, e.want, got)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AnalyticsEvent is an event collected by AnalyticsHandler, such as a page view or a click.
+// Fields:
+// - Name: The event's name, e.g. "page_view" or "signup.completed".
+// - Timestamp: When the event happened on the client. Defaults to ReceivedAt, and is replaced by it when it is
+// too far in the future.
+// - AnonymousID: An identifier of the visitor's browser or device, if any.
+// - UserID: The signed-in user, if any.
+// - URL: The page the event happened on.
+// - Properties: The event's properties, e.g. {"plan": "pro"}.
+// - ReceivedAt: When the server received the event. Set by the server.
+// - IP: The client's IP address with its host part zeroed by MaskIP. Set by the server.
+// - UserAgent: The client's User-Agent header. Set by the server.
+type AnalyticsEvent struct {
+	Name        string                 `json:"name"`
+	Timestamp   time.Time              `json:"timestamp"`
+	AnonymousID string                 `json:"anonymous_id,omitempty"`
+	UserID      string                 `json:"user_id,omitempty"`
+	URL         string                 `json:"url,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+	ReceivedAt  time.Time              `json:"received_at"`
+	IP          string                 `json:"ip,omitempty"`
+	UserAgent   string                 `json:"user_agent,omitempty"`
+}
+
+// AnalyticsSink receives the events accepted by AnalyticsHandler, one batch per request.
+type AnalyticsSink interface {
+	WriteEvents(ctx context.Context, events []AnalyticsEvent) error
+}
+
+// AnalyticsSinkFunc adapts a function to the AnalyticsSink interface.
+type AnalyticsSinkFunc func(ctx context.Context, events []AnalyticsEvent) error
+
+// WriteEvents calls f(ctx, events).
+func (f AnalyticsSinkFunc) WriteEvents(ctx context.Context, events []AnalyticsEvent) error {
+	return f(ctx, events)
+}
+
+// AnalyticsSchema describes an event AnalyticsHandler accepts.
+// Fields:
+// - Required: The properties the event must have.
+// - Properties: The expected type of properties, "string", "number" or "bool". Properties not listed may have any
+// type.
+// - SampleRate: The fraction of these events kept, overriding AnalyticsOptions.SampleRate. Zero uses the default.
+type AnalyticsSchema struct {
+	Required   []string
+	Properties map[string]string
+	SampleRate float64
+}
+
+// AnalyticsOptions configures AnalyticsHandler.
+// Fields:
+// - Schemas: The events accepted, by name. When set, events with other names are rejected.
+// - MaxEvents: The maximum number of events in a batch. Defaults to 100.
+// - MaxProperties: The maximum number of properties of an event. Defaults to 50.
+// - MaxValueLength: The maximum length of a string property, in bytes. Defaults to 1024.
+// - SampleRate: The fraction of events kept, between 0 and 1, e.g. 0.1 to keep one event in ten. Zero keeps
+// every event.
+// - MaxClockSkew: How far in the future a client's timestamp may be before it is replaced by the time the event
+// was received. Defaults to 1 hour.
+// - ErrorLog: Receives errors of the sink. Defaults to slog.Default().
+type AnalyticsOptions struct {
+	Schemas        map[string]AnalyticsSchema
+	MaxEvents      int
+	MaxProperties  int
+	MaxValueLength int
+	SampleRate     float64
+	MaxClockSkew   time.Duration
+	ErrorLog       *slog.Logger
+}
+
+// AnalyticsResult is the body of AnalyticsHandler's response.
+// Fields:
+// - Accepted: The number of events forwarded to the sink.
+// - Sampled: The number of valid events dropped by sampling.
+// - Rejected: The number of invalid events.
+// - Errors: Why events were rejected.
+type AnalyticsResult struct {
+	Accepted int              `json:"accepted"`
+	Sampled  int              `json:"sampled"`
+	Rejected int              `json:"rejected"`
+	Errors   ValidationErrors `json:"errors,omitempty"`
+}
+
+// AnalyticsHandler returns a handler collecting batches of analytics events posted by browsers or apps, e.g. with
+// navigator.sendBeacon, as {"events": [...]}. The body is read with ReadJSON, so Tools.MaxJSONSize limits its
+// size and unknown fields are refused unless Tools.AllowUnknownFields is set. Valid events are enriched with the
+// time they were received, the masked client IP and the User-Agent, sampled, and forwarded to the sink; invalid
+// events are rejected without failing the rest of the batch.
+// Parameters:
+// - sink: Where accepted events are written, e.g. an AnalyticsFileSink, AnalyticsQueueSink or AnalyticsRemoteSink.
+// - opts: Optional AnalyticsOptions. Only the first value is used if multiple are provided.
+// Returns the handler. It answers 202 Accepted with an AnalyticsResult, 422 Unprocessable Entity if every event
+// is invalid, 400 Bad Request if the body cannot be read or the batch is too large, 503 Service Unavailable if the
+// sink fails, and 405 Method Not Allowed to anything but POST.
+func (t *Tools) AnalyticsHandler(sink AnalyticsSink, opts ...AnalyticsOptions) http.HandlerFunc {
+	var o AnalyticsOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxEvents <= 0 {
+		o.MaxEvents = 100
+	}
+	if o.MaxProperties <= 0 {
+		o.MaxProperties = 50
+	}
+	if o.MaxValueLength <= 0 {
+		o.MaxValueLength = 1024
+	}
+	if o.MaxClockSkew <= 0 {
+		o.MaxClockSkew = time.Hour
+	}
+	if o.ErrorLog == nil {
+		o.ErrorLog = slog.Default()
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			_ = t.ErrorJSON(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var batch struct {
+			Events []AnalyticsEvent `json:"events"`
+		}
+		if err := t.ReadJSON(w, r, &batch); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+		if len(batch.Events) > o.MaxEvents {
+			_ = t.ErrorJSON(w, fmt.Errorf("batch must not have more than %d events", o.MaxEvents))
+			return
+		}
+
+		now := time.Now().UTC()
+		ip := MaskIP(remoteIP(r))
+
+		var result AnalyticsResult
+		accepted := make([]AnalyticsEvent, 0, len(batch.Events))
+		for i, e := range batch.Events {
+			if errs := o.check(e, fmt.Sprintf("events[%d]", i)); len(errs) > 0 {
+				result.Rejected++
+				result.Errors = append(result.Errors, errs...)
+				continue
+			}
+			if !o.sample(e.Name) {
+				result.Sampled++
+				continue
+			}
+
+			e.ReceivedAt, e.IP, e.UserAgent = now, ip, r.UserAgent()
+			if e.Timestamp.IsZero() || e.Timestamp.After(now.Add(o.MaxClockSkew)) {
+				e.Timestamp = now
+			}
+			accepted = append(accepted, e)
+		}
+
+		if len(accepted) == 0 && result.Rejected > 0 {
+			_ = t.ErrorJSON(w, result.Errors, http.StatusUnprocessableEntity)
+			return
+		}
+
+		if len(accepted) > 0 {
+			if err := sink.WriteEvents(r.Context(), accepted); err != nil {
+				o.ErrorLog.ErrorContext(r.Context(), "analytics sink failed", slog.Int("events", len(accepted)), slog.String("error", err.Error()))
+				_ = t.ErrorJSON(w, fmt.Errorf("events could not be recorded"), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		result.Accepted = len(accepted)
+
+		_ = t.WriteJSON(w, http.StatusAccepted, JSONResponse{Message: "events received", Data: result})
+	}
+}
+
+// check validates an event against the options, naming fields under prefix.
+func (o *AnalyticsOptions) check(e AnalyticsEvent, prefix string) ValidationErrors {
+	var errs ValidationErrors
+	fail := func(field, rule, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: prefix + field, Rule: rule, Message: prefix + field + " " + fmt.Sprintf(format, args...)})
+	}
+
+	if !validEventName(e.Name) {
+		fail(".name", "name", "must be 1 to 64 letters, digits, '_', '.', ':' or '-'")
+		return errs
+	}
+
+	schema, known := o.Schemas[e.Name]
+	if o.Schemas != nil && !known {
+		fail(".name", "oneof", "is not a known event")
+		return errs
+	}
+
+	if len(e.Properties) > o.MaxProperties {
+		fail(".properties", "max", "must not have more than %d properties", o.MaxProperties)
+		return errs
+	}
+	for _, key := range schema.Required {
+		if _, ok := e.Properties[key]; !ok {
+			fail(".properties."+key, "required", "is required")
+		}
+	}
+	for key, value := range e.Properties {
+		field := ".properties." + sanitizeJSONField(key)
+		if s, ok := value.(string); ok && len(s) > o.MaxValueLength {
+			fail(field, "max", "must not be longer than %d bytes", o.MaxValueLength)
+		}
+		if want, ok := schema.Properties[key]; ok && value != nil && jsonKind(value) != want {
+			fail(field, "type", "must be a %s", want)
+		}
+	}
+
+	return errs
+}
+
+// sample reports whether an event is kept.
+func (o *AnalyticsOptions) sample(name string) bool {
+	rate := o.SampleRate
+	if s, ok := o.Schemas[name]; ok && s.SampleRate > 0 {
+		rate = s.SampleRate
+	}
+
+	return rate <= 0 || rate >= 1 || rand.Float64() < rate
+}
+
+// validEventName reports whether name is a valid event name.
+func validEventName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '_' || c == '.' || c == ':' || c == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// jsonKind returns the schema type of a decoded JSON value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+
+	return "null"
+}
+
+// AnalyticsFileSink is an AnalyticsSink writing events as JSON lines, one event per line, e.g. to a file picked
+// up by a log shipper.
+// Fields:
+// - W: Where events are written. Writes are serialized.
+type AnalyticsFileSink struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// NewAnalyticsFileSink opens a file for appending events, creating it if needed.
+// Returns a pointer to the new AnalyticsFileSink, or an error if the file cannot be opened. Close it when done.
+func NewAnalyticsFileSink(name string) (*AnalyticsFileSink, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AnalyticsFileSink{W: f}, nil
+}
+
+// WriteEvents writes the batch in a single write, so batches from concurrent requests never interleave.
+func (s *AnalyticsFileSink) WriteEvents(_ context.Context, events []AnalyticsEvent) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.W.Write(buf.Bytes())
+
+	return err
+}
+
+// Close closes W if it is an io.Closer.
+func (s *AnalyticsFileSink) Close() error {
+	if c, ok := s.W.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// AnalyticsQueueSink is an AnalyticsSink publishing every event as a JSON message, for consumers loading them into
+// a warehouse.
+// Fields:
+// - Queue: The queue to publish to.
+// - Topic: The topic. Defaults to "analytics".
+type AnalyticsQueueSink struct {
+	Queue Queue
+	Topic string
+}
+
+// WriteEvents publishes the events.
+// Returns an error if publishing any of them fails; the events before it were published.
+func (s *AnalyticsQueueSink) WriteEvents(ctx context.Context, events []AnalyticsEvent) error {
+	topic := s.Topic
+	if topic == "" {
+		topic = "analytics"
+	}
+
+	var t Tools
+	for _, e := range events {
+		if err := t.PublishJSON(ctx, s.Queue, topic, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AnalyticsRemoteSink is an AnalyticsSink posting batches as {"events": [...]} to a remote collector.
+// Fields:
+// - URL: Where batches are posted.
+// - Header: Extra request headers, e.g. an Authorization header.
+// - Client: The HTTP client. Defaults to one with a 10 second timeout.
+type AnalyticsRemoteSink struct {
+	URL    string
+	Header http.Header
+	Client *http.Client
+}
+
+// WriteEvents posts the batch.
+// Returns an error if the request fails or the collector does not answer with a 2xx status.
+func (s *AnalyticsRemoteSink) WriteEvents(ctx context.Context, events []AnalyticsEvent) error {
+	body, err := json.Marshal(map[string]interface{}{"events": events})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("analytics: %s answered %s", s.URL, resp.Status)
+	}
+
+	return nil
+}
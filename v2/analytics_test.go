@@ -0,0 +1,186 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// analyticsRecorder is an AnalyticsSink keeping the events it receives.
+type analyticsRecorder struct {
+	mu     sync.Mutex
+	events []AnalyticsEvent
+	err    error
+}
+
+func (s *analyticsRecorder) WriteEvents(_ context.Context, events []AnalyticsEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+
+	return nil
+}
+
+func TestTools_AnalyticsHandler(t *testing.T) {
+	testTools := Tools{MaxJSONSize: 2048}
+
+	opts := AnalyticsOptions{
+		MaxEvents: 3,
+		Schemas: map[string]AnalyticsSchema{
+			"page_view": {},
+			"signup":    {Required: []string{"plan"}, Properties: map[string]string{"plan": "string", "seats": "number"}},
+			"hover":     {SampleRate: 1e-12},
+		},
+	}
+
+	future := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+
+	var tests = []struct {
+		name     string
+		method   string
+		body     string
+		status   int
+		accepted int
+		rejected int
+		sampled  int
+	}{
+		{"valid batch", "POST", `{"events":[{"name":"page_view","url":"/"},{"name":"signup","properties":{"plan":"pro","seats":3}}]}`, 202, 2, 0, 0},
+		{"partly invalid", "POST", `{"events":[{"name":"page_view"},{"name":"signup","properties":{"seats":"3"}}]}`, 202, 1, 1, 0},
+		{"all invalid", "POST", `{"events":[{"name":"unknown"},{"name":"bad name!"}]}`, 422, 0, 0, 0},
+		{"sampled", "POST", `{"events":[{"name":"hover"}]}`, 202, 0, 0, 1},
+		{"future timestamp", "POST", `{"events":[{"name":"page_view","timestamp":"` + future + `"}]}`, 202, 1, 0, 0},
+		{"too many events", "POST", `{"events":[{"name":"page_view"},{"name":"page_view"},{"name":"page_view"},{"name":"page_view"}]}`, 400, 0, 0, 0},
+		{"unknown field", "POST", `{"events":[],"extra":1}`, 400, 0, 0, 0},
+		{"too large", "POST", `{"events":[{"name":"page_view","url":"` + strings.Repeat("a", 4096) + `"}]}`, 400, 0, 0, 0},
+		{"wrong method", "GET", ``, 405, 0, 0, 0},
+	}
+
+	for _, e := range tests {
+		sink := &analyticsRecorder{}
+		req := httptest.NewRequest(e.method, "/collect", strings.NewReader(e.body))
+		req.RemoteAddr = "203.0.113.54:1234"
+		req.Header.Set("User-Agent", "test-agent")
+		rr := httptest.NewRecorder()
+
+		testTools.AnalyticsHandler(sink, opts).ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if len(sink.events) != e.accepted {
+			t.Errorf("%s: expected %d events in the sink, got %d", e.name, e.accepted, len(sink.events))
+		}
+		if e.status != http.StatusAccepted {
+			continue
+		}
+
+		var resp struct {
+			Data AnalyticsResult `json:"data"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Data.Accepted != e.accepted || resp.Data.Rejected != e.rejected || resp.Data.Sampled != e.sampled {
+			t.Errorf("%s: unexpected result %+v", e.name, resp.Data)
+		}
+		if e.rejected > 0 && (len(resp.Data.Errors) == 0 || resp.Data.Errors[0].Field != "events[1].properties.plan") {
+			t.Errorf("%s: expected the missing property to be reported, got %+v", e.name, resp.Data.Errors)
+		}
+
+		for _, ev := range sink.events {
+			if ev.IP != "203.0.113.0" || ev.UserAgent != "test-agent" || ev.ReceivedAt.IsZero() {
+				t.Errorf("%s: expected the event to be enriched, got %+v", e.name, ev)
+			}
+			if ev.Timestamp.After(time.Now().Add(time.Minute)) {
+				t.Errorf("%s: expected a future timestamp to be replaced, got %s", e.name, ev.Timestamp)
+			}
+		}
+	}
+
+	sink := &analyticsRecorder{err: errors.New("disk full")}
+	rr := httptest.NewRecorder()
+	testTools.AnalyticsHandler(sink, AnalyticsOptions{ErrorLog: slog.New(slog.NewTextHandler(io.Discard, nil))}).ServeHTTP(rr, httptest.NewRequest("POST", "/collect", strings.NewReader(`{"events":[{"name":"x"}]}`)))
+	if rr.Code != http.StatusServiceUnavailable || strings.Contains(rr.Body.String(), "disk full") {
+		t.Errorf("expected a failing sink to answer 503 without details, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAnalyticsSinks(t *testing.T) {
+	events := []AnalyticsEvent{{Name: "a"}, {Name: "b"}}
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	file, err := NewAnalyticsFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := file.WriteEvents(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+	if data, _ := os.ReadFile(path); strings.Count(string(data), "\n") != 2 {
+		t.Errorf("expected the file to hold one line per event, got %q", data)
+	}
+
+	var buf bytes.Buffer
+	lines := &AnalyticsFileSink{W: &buf}
+	_ = lines.WriteEvents(context.Background(), events)
+	if strings.Count(buf.String(), "\n") != 2 || !strings.HasPrefix(buf.String(), `{"name":"a"`) {
+		t.Errorf("expected one JSON line per event, got %q", buf.String())
+	}
+
+	q := NewMemoryQueue()
+	if err := (&AnalyticsQueueSink{Queue: q}).WriteEvents(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var got []string
+	_ = q.Consume(ctx, "analytics", func(_ context.Context, m Message) error {
+		var e AnalyticsEvent
+		_ = json.Unmarshal(m.Body, &e)
+		if got = append(got, e.Name); len(got) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("expected both events to be published, got %v", got)
+	}
+
+	var received struct {
+		Events []AnalyticsEvent `json:"events"`
+	}
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		if len(received.Events) > 1 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	remote := &AnalyticsRemoteSink{URL: srv.URL, Header: http.Header{"Authorization": {"Bearer k"}}}
+	if err := remote.WriteEvents(context.Background(), events); err != nil || auth != "Bearer k" || len(received.Events) != 2 {
+		t.Errorf("expected the batch to be posted, got %v, %q, %d events", err, auth, len(received.Events))
+	}
+	if err := remote.WriteEvents(context.Background(), events[:1]); err == nil {
+		t.Error("expected an error status to fail")
+	}
+}
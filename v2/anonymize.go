@@ -0,0 +1,394 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"path"
+	"reflect"
+	"strings"
+)
+
+// Anonymizer replaces a sensitive string, such as an email address, with a masked or fake one. Empty values are
+// never passed to it.
+type Anonymizer func(s string) string
+
+// AnonymizeRules maps field names to the Anonymizer applied to their values. Names are matched like Redactor
+// fields: ignoring case, '-' and '_', against the JSON name or the Go name of struct fields and the keys of maps
+// and JSON objects, and may be path.Match patterns, e.g. "*email". A rule applies to every string below its field,
+// so "address" anonymizes all the lines of a nested address.
+type AnonymizeRules map[string]Anonymizer
+
+// match returns the rule for a field name, or nil. Exact names win over patterns.
+func (r AnonymizeRules) match(names ...string) Anonymizer {
+	for _, name := range names {
+		name = normalizeFieldName(name)
+		for pattern, fn := range r {
+			if normalizeFieldName(pattern) == name {
+				return fn
+			}
+		}
+	}
+
+	var best string
+	var rule Anonymizer
+	for _, name := range names {
+		name = normalizeFieldName(name)
+		for pattern, fn := range r {
+			// the longest matching pattern wins, so the choice does not depend on map order
+			if ok, _ := path.Match(normalizeFieldName(pattern), name); ok && (rule == nil || len(pattern) > len(best) || len(pattern) == len(best) && pattern < best) {
+				best, rule = pattern, fn
+			}
+		}
+		if rule != nil {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+// DefaultAnonymizeRules returns rules for common personal data, for producing GDPR-safe exports and staging
+// datasets: names, emails and phone numbers are replaced with consistent fakes, IP addresses are truncated, and
+// street addresses, secrets and payment details are redacted.
+// Parameters:
+// - secret: The key deriving the fakes, see FakeName. Keep it private, or fakes can be linked back to real values
+// by trying candidates.
+// Returns the rules, which can be extended or overridden.
+func DefaultAnonymizeRules(secret []byte) AnonymizeRules {
+	redacted := Redacted("[REDACTED]")
+
+	return AnonymizeRules{
+		"name":        FakeName(secret),
+		"firstname":   FakeName(secret),
+		"lastname":    FakeName(secret),
+		"fullname":    FakeName(secret),
+		"displayname": FakeName(secret),
+		"*email":      FakeEmail(secret),
+		"*phone":      MaskKeepLast(2),
+		"mobile":      MaskKeepLast(2),
+		"ip":          MaskIP,
+		"*ipaddress":  MaskIP,
+		"remoteaddr":  MaskIP,
+		"address":     redacted,
+		"street":      redacted,
+		"password":    redacted,
+		"*token":      redacted,
+		"secret":      redacted,
+		"cardnumber":  MaskKeepLast(4),
+		"iban":        MaskKeepLast(4),
+		"ssn":         redacted,
+		"birthdate":   redacted,
+		"dateofbirth": redacted,
+	}
+}
+
+// Anonymize masks or fakes the fields of v matching rules, in place, e.g. before writing an export or copying
+// production data to staging. Exported struct fields, maps, slices, pointers and interfaces are walked at any
+// depth; string values, and json.RawMessage values holding JSON, are anonymized. Numbers, booleans and other types
+// are left alone.
+// Parameters:
+// - v: A pointer to the data, e.g. *[]User or *map[string]interface{}.
+// - rules: The rules, e.g. DefaultAnonymizeRules(secret).
+// Returns an error if v is not a non-nil pointer, or embedded JSON is invalid.
+func (t *Tools) Anonymize(v interface{}, rules AnonymizeRules) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("anonymize: v must be a non-nil pointer")
+	}
+
+	return anonymizeValue(rv.Elem(), rules, nil, 0)
+}
+
+// AnonymizeJSON returns a copy of a JSON document with the values of fields matching rules masked or faked.
+// Key order and formatting of untouched values are kept.
+// Parameters:
+// - data: The JSON document.
+// - rules: The rules, e.g. DefaultAnonymizeRules(secret).
+// Returns the anonymized document, or an error if data is not valid JSON.
+func (t *Tools) AnonymizeJSON(data []byte, rules AnonymizeRules) ([]byte, error) {
+	return anonymizeJSON(data, rules, nil)
+}
+
+// maxAnonymizeDepth stops the walk on cyclic data.
+const maxAnonymizeDepth = 64
+
+// anonymizeValue anonymizes v, which must be settable, applying rule to its strings if it is not nil.
+func anonymizeValue(v reflect.Value, rules AnonymizeRules, rule Anonymizer, depth int) error {
+	if depth > maxAnonymizeDepth {
+		return errors.New("anonymize: data is nested too deeply")
+	}
+
+	if v.Type() == reflect.TypeOf(json.RawMessage(nil)) {
+		if v.Len() == 0 {
+			return nil
+		}
+		out, err := anonymizeJSON(v.Bytes(), rules, rule)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(out)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if rule != nil && v.Len() > 0 && v.CanSet() {
+			v.SetString(rule(v.String()))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return anonymizeValue(v.Elem(), rules, rule, depth+1)
+		}
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		// values in interfaces cannot be set, so a copy is anonymized and stored back
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := anonymizeValue(elem, rules, rule, depth+1); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fieldRule := rule
+			if !sf.Anonymous {
+				if r := rules.match(fieldName(sf), sf.Name); r != nil {
+					fieldRule = r
+				}
+			}
+			if err := anonymizeValue(v.Field(i), rules, fieldRule, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := anonymizeValue(v.Index(i), rules, rule, depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			elemRule := rule
+			if k := iter.Key(); k.Kind() == reflect.String {
+				if r := rules.match(k.String()); r != nil {
+					elemRule = r
+				}
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(iter.Value())
+			if err := anonymizeValue(elem, rules, elemRule, depth+1); err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	}
+
+	return nil
+}
+
+// anonymizeJSON anonymizes one JSON value, keeping key order, applying rule to its strings if it is not nil.
+func anonymizeJSON(raw []byte, rules AnonymizeRules, rule Anonymizer) ([]byte, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch trimmed[0] {
+	case '"':
+		if rule == nil {
+			return trimmed, nil
+		}
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, err
+		}
+		if s == "" {
+			return trimmed, nil
+		}
+		return json.Marshal(rule(s))
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			out, err := anonymizeJSON(item, rules, rule)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(out)
+		}
+		buf.WriteByte(']')
+
+		return buf.Bytes(), nil
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := tok.(string)
+
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+
+			valueRule := rule
+			if r := rules.match(key); r != nil {
+				valueRule = r
+			}
+			out, err := anonymizeJSON(value, rules, valueRule)
+			if err != nil {
+				return nil, err
+			}
+
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(out)
+		}
+		buf.WriteByte('}')
+
+		return buf.Bytes(), nil
+	default:
+		// numbers, booleans and null
+		if !json.Valid(trimmed) {
+			return nil, fmt.Errorf("anonymize: invalid JSON %q", trimmed)
+		}
+		return trimmed, nil
+	}
+}
+
+// Redacted returns an Anonymizer replacing every value with replacement.
+func Redacted(replacement string) Anonymizer {
+	return func(string) string { return replacement }
+}
+
+// MaskKeepLast returns an Anonymizer replacing all but the last n characters with '*', e.g. "*******4242" for a
+// card number. Values of n characters or fewer are masked entirely.
+func MaskKeepLast(n int) Anonymizer {
+	return func(s string) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return strings.Repeat("*", len(r))
+		}
+
+		return strings.Repeat("*", len(r)-n) + string(r[len(r)-n:])
+	}
+}
+
+// MaskEmail masks the local part of an email address but its first character, keeping the domain for statistics,
+// e.g. "j***@example.com". Values that are not addresses are masked entirely.
+func MaskEmail(s string) string {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" {
+		return strings.Repeat("*", len([]rune(s)))
+	}
+
+	r := []rune(local)
+
+	return string(r[0]) + strings.Repeat("*", max(len(r)-1, 3)) + "@" + domain
+}
+
+// MaskIP truncates an IP address to its network, as analytics tools do: the last octet of IPv4 addresses and
+// the last 80 bits of IPv6 addresses are zeroed, e.g. "203.0.113.0". A port is kept. Values that are not
+// addresses become "0.0.0.0".
+func MaskIP(s string) string {
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return netip.AddrPortFrom(maskAddr(ap.Addr()), ap.Port()).String()
+	}
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return maskAddr(addr).String()
+	}
+
+	return "0.0.0.0"
+}
+
+// maskAddr zeroes the host part of an address.
+func maskAddr(addr netip.Addr) netip.Addr {
+	bits := 48
+	if addr.Is4() || addr.Is4In6() {
+		addr, bits = addr.Unmap(), 24
+	}
+
+	prefix, _ := addr.Prefix(bits)
+
+	return prefix.Addr()
+}
+
+// Pseudonym returns an Anonymizer replacing values with a stable token derived from the value with HMAC-SHA256,
+// e.g. "user-3f9a2c1b7d4e", so the same value always becomes the same token and records can still be joined.
+// Parameters:
+// - secret: The HMAC key. Without it, tokens could be linked back to values by trying candidates.
+// - prefix: Prepended to the token.
+func Pseudonym(secret []byte, prefix string) Anonymizer {
+	return func(s string) string {
+		return prefix + hex.EncodeToString(hmacSHA256(secret, []byte(s))[:6])
+	}
+}
+
+// FakeEmail returns an Anonymizer replacing email addresses with stable fake ones on the reserved example.com
+// domain, e.g. "user-3f9a2c1b7d4e@example.com", so the same address always gets the same fake and unique
+// constraints still hold.
+func FakeEmail(secret []byte) Anonymizer {
+	pseudonym := Pseudonym(secret, "user-")
+
+	return func(s string) string {
+		return pseudonym(strings.ToLower(strings.TrimSpace(s))) + "@example.com"
+	}
+}
+
+var (
+	fakeFirstNames = []string{"Alex", "Blair", "Casey", "Dana", "Eden", "Frankie", "Gray", "Harper", "Indy", "Jordan",
+		"Kai", "Logan", "Morgan", "Noel", "Onyx", "Parker", "Quinn", "Riley", "Sage", "Taylor", "Umi", "Val", "Wren", "Yael"}
+	fakeLastNames = []string{"Adams", "Baker", "Clark", "Davis", "Evans", "Fisher", "Garcia", "Hughes", "Ito", "Jones",
+		"King", "Lopez", "Moore", "Nguyen", "Owens", "Patel", "Reed", "Silva", "Turner", "Walker", "Young", "Zimmer"}
+)
+
+// FakeName returns an Anonymizer replacing names with stable fake ones, e.g. "Riley Patel", chosen from the value
+// with HMAC-SHA256. A value of one word becomes a first name, and longer values a first and last name.
+func FakeName(secret []byte) Anonymizer {
+	return func(s string) string {
+		sum := hmacSHA256(secret, []byte(strings.ToLower(strings.TrimSpace(s))))
+		first := fakeFirstNames[binary.BigEndian.Uint32(sum[0:4])%uint32(len(fakeFirstNames))]
+		if len(strings.Fields(s)) < 2 {
+			return first
+		}
+
+		return first + " " + fakeLastNames[binary.BigEndian.Uint32(sum[4:8])%uint32(len(fakeLastNames))]
+	}
+}
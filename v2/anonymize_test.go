@@ -0,0 +1,148 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizers(t *testing.T) {
+	secret := []byte("anonymize-secret")
+
+	var tests = []struct {
+		name     string
+		fn       Anonymizer
+		in       string
+		expected string
+	}{
+		{"mask email", MaskEmail, "jane.doe@example.org", "j*******@example.org"},
+		{"mask short email", MaskEmail, "j@example.org", "j***@example.org"},
+		{"mask non-email", MaskEmail, "jane", "****"},
+		{"mask ipv4", MaskIP, "203.0.113.77", "203.0.113.0"},
+		{"mask ipv4 with port", MaskIP, "203.0.113.77:8080", "203.0.113.0:8080"},
+		{"mask ipv6", MaskIP, "2001:db8:1234:5678:9abc::1", "2001:db8:1234::"},
+		{"mask mapped ipv4", MaskIP, "::ffff:203.0.113.77", "203.0.113.0"},
+		{"mask bad ip", MaskIP, "localhost", "0.0.0.0"},
+		{"keep last", MaskKeepLast(4), "4242424242424242", "************4242"},
+		{"keep last short", MaskKeepLast(4), "123", "***"},
+		{"redacted", Redacted("x"), "secret", "x"},
+	}
+
+	for _, e := range tests {
+		if got := e.fn(e.in); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+
+	email := FakeEmail(secret)
+	if a, b := email("Ann@Example.com"), email(" ann@example.com"); a != b || !strings.HasSuffix(a, "@example.com") || !strings.HasPrefix(a, "user-") {
+		t.Errorf("expected stable fake emails, got %q and %q", a, b)
+	}
+	if email("ann@example.com") == email("bob@example.com") {
+		t.Error("expected different addresses to get different fakes")
+	}
+	if FakeEmail([]byte("other"))("ann@example.com") == email("ann@example.com") {
+		t.Error("expected fakes to depend on the secret")
+	}
+
+	name := FakeName(secret)
+	if full := name("Ann Smith"); len(strings.Fields(full)) != 2 || full != name("ann smith") || full == "Ann Smith" {
+		t.Errorf("unexpected fake name %q", full)
+	}
+	if first := name("Ann"); len(strings.Fields(first)) != 1 {
+		t.Errorf("expected a single fake first name, got %q", first)
+	}
+}
+
+func TestTools_Anonymize(t *testing.T) {
+	var testTools Tools
+
+	type address struct {
+		Street string
+		City   string
+	}
+	type Profile struct {
+		Bio string `json:"bio"`
+	}
+	type user struct {
+		ID        int               `json:"id"`
+		Name      string            `json:"name"`
+		Email     string            `json:"email"`
+		WorkEmail *string           `json:"work_email"`
+		IP        string            `json:"ip"`
+		Address   address           `json:"address"`
+		Tags      []string          `json:"tags"`
+		Extra     map[string]any    `json:"extra"`
+		Raw       json.RawMessage   `json:"raw"`
+		Labels    map[string]string `json:"labels"`
+		Profile
+		secret string
+	}
+
+	work := "ann@corp.example"
+	users := []user{{
+		ID: 1, Name: "Ann Smith", Email: "ann@example.com", WorkEmail: &work, IP: "198.51.100.23",
+		Address: address{Street: "1 Main St", City: "Lisbon"},
+		Tags:    []string{"vip"},
+		Extra:   map[string]any{"phone": "+351 912 345 678", "nested": map[string]any{"email": "x@y.z"}},
+		Raw:     json.RawMessage(`{"email":"ann@example.com","n":1}`),
+		Labels:  map[string]string{"Last_Name": "Smith", "team": "blue"},
+		Profile: Profile{Bio: "hello"},
+		secret:  "kept",
+	}}
+
+	rules := DefaultAnonymizeRules([]byte("s"))
+	rules["bio"] = Redacted("")
+	if err := testTools.Anonymize(&users, rules); err != nil {
+		t.Fatal(err)
+	}
+	u := users[0]
+
+	if u.ID != 1 || u.Name == "Ann Smith" || !strings.HasSuffix(u.Email, "@example.com") || u.Email == "ann@example.com" {
+		t.Errorf("unexpected name or email: %+v", u)
+	}
+	if !strings.HasPrefix(work, "user-") || *u.WorkEmail != work {
+		t.Errorf("expected the pointed-to work email to be faked, got %q", work)
+	}
+	if u.IP != "198.51.100.0" {
+		t.Errorf("expected a truncated IP, got %q", u.IP)
+	}
+	if u.Address.Street != "[REDACTED]" || u.Address.City != "[REDACTED]" {
+		t.Errorf("expected the whole address to be redacted, got %+v", u.Address)
+	}
+	if u.Tags[0] != "vip" || u.Labels["team"] != "blue" || u.Labels["Last_Name"] == "Smith" {
+		t.Errorf("unexpected tags or labels: %v %v", u.Tags, u.Labels)
+	}
+	if u.Extra["phone"] != "**************78" || u.Extra["nested"].(map[string]any)["email"] == "x@y.z" {
+		t.Errorf("unexpected extra: %v", u.Extra)
+	}
+	if strings.Contains(string(u.Raw), "ann@example.com") || !strings.Contains(string(u.Raw), `"n":1`) {
+		t.Errorf("expected embedded JSON to be anonymized, got %s", u.Raw)
+	}
+	if u.Bio != "" || u.secret != "kept" {
+		t.Errorf("unexpected embedded or unexported fields: %q %q", u.Bio, u.secret)
+	}
+
+	if err := testTools.Anonymize(users, rules); err == nil {
+		t.Error("expected a non-pointer to fail")
+	}
+}
+
+func TestTools_AnonymizeJSON(t *testing.T) {
+	var testTools Tools
+
+	in := `{"z":1,"user":{"email":"ann@example.com","name":""},"ips":{"ip":["203.0.113.9","2001:db8::1"]},"ok":true}`
+	out, err := testTools.AnonymizeJSON([]byte(in), AnonymizeRules{"email": MaskEmail, "name": Redacted("x"), "ip": MaskIP})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"z":1,"user":{"email":"a***@example.com","name":""},"ips":{"ip":["203.0.113.0","2001:db8::"]},"ok":true}`
+	if string(out) != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+
+	if _, err := testTools.AnonymizeJSON([]byte(`{"a":`), nil); err == nil {
+		t.Error("expected invalid JSON to fail")
+	}
+}
@@ -0,0 +1,250 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedVersion is returned for requests asking for an API version that is not supported.
+var ErrUnsupportedVersion = errors.New("unsupported API version")
+
+// versionSegmentRegex matches a version path segment such as "v2" or "v1.1".
+var versionSegmentRegex = regexp.MustCompile(`^[vV]\d+(\.\d+)?$`)
+
+// APIVersionOptions configures APIVersionMiddleware.
+// Fields:
+// - Header: The request header carrying the version. Defaults to "API-Version". The version may also be given
+// as a "version" parameter of the Accept header, e.g. "application/json; version=2".
+// - Default: The version used when the request specifies none. If empty, such requests have no version.
+// - Supported: The versions accepted. If empty, any version is accepted.
+type APIVersionOptions struct {
+	Header    string
+	Default   string
+	Supported []string
+}
+
+type apiVersionContextKey struct{}
+
+// WithAPIVersion returns a copy of ctx carrying the API version.
+func WithAPIVersion(ctx context.Context, version string) context.Context {
+	return context.WithValue(ctx, apiVersionContextKey{}, version)
+}
+
+// APIVersionFromContext returns the API version stored by APIVersionMiddleware, or "" if there is none.
+func APIVersionFromContext(ctx context.Context) string {
+	version, _ := ctx.Value(apiVersionContextKey{}).(string)
+	return version
+}
+
+// normalizeVersion drops the "v" of versions such as "v2", so "v2" and "2" are the same version.
+func normalizeVersion(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) > 1 && (v[0] == 'v' || v[0] == 'V') && v[1] >= '0' && v[1] <= '9' {
+		return v[1:]
+	}
+
+	return v
+}
+
+// requestAPIVersion finds the version in the first path segment, the version header or the Accept header.
+func requestAPIVersion(r *http.Request, header string) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if versionSegmentRegex.MatchString(segment) {
+		return normalizeVersion(segment)
+	}
+
+	if v := r.Header.Get(header); v != "" {
+		return normalizeVersion(v)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(accept); err == nil && params["version"] != "" {
+			return normalizeVersion(params["version"])
+		}
+	}
+
+	return ""
+}
+
+// APIVersionMiddleware determines the API version of each request from a path prefix such as /v2/, a header or
+// the Accept header, in that order, and stores it in the request context. Versions are normalized without a
+// leading "v", so /v2/users and "API-Version: 2" both give version "2". The version is echoed in the response's
+// API-Version header, and WriteJSON uses it to select serializers registered in Tools.Serializers.
+// Requests for unsupported versions are rejected with 400 Bad Request.
+// Parameters:
+// - opts: Optional APIVersionOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) APIVersionMiddleware(opts ...APIVersionOptions) func(http.Handler) http.Handler {
+	var o APIVersionOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Header == "" {
+		o.Header = "API-Version"
+	}
+
+	supported := make(map[string]bool, len(o.Supported))
+	for _, v := range o.Supported {
+		supported[normalizeVersion(v)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version := requestAPIVersion(r, o.Header)
+			if version == "" {
+				version = normalizeVersion(o.Default)
+			}
+
+			if version != "" && len(supported) > 0 && !supported[version] {
+				_ = t.ErrorJSON(w, ErrUnsupportedVersion)
+				return
+			}
+
+			if version != "" {
+				w.Header().Set("API-Version", version)
+			}
+
+			next.ServeHTTP(&versionWriter{ResponseWriter: w, version: version}, r.WithContext(WithAPIVersion(r.Context(), version)))
+		})
+	}
+}
+
+// versionWriter carries the request's API version to WriteJSON, which only sees the response writer.
+type versionWriter struct {
+	http.ResponseWriter
+	version string
+}
+
+// APIVersion returns the request's API version.
+func (vw *versionWriter) APIVersion() string {
+	return vw.version
+}
+
+// Flush implements http.Flusher when the wrapped writer supports it.
+func (vw *versionWriter) Flush() {
+	if f, ok := vw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom copies src through the wrapped writer, keeping its sendfile path for files.
+func (vw *versionWriter) ReadFrom(src io.Reader) (int64, error) {
+	return readFrom(vw.ResponseWriter, src)
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (vw *versionWriter) Unwrap() http.ResponseWriter {
+	return vw.ResponseWriter
+}
+
+// writerAPIVersion returns the API version carried by w or a writer it wraps.
+func writerAPIVersion(w http.ResponseWriter) string {
+	for w != nil {
+		if vw, ok := w.(interface{ APIVersion() string }); ok {
+			return vw.APIVersion()
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	return ""
+}
+
+// VersionedSerializers holds per-version conversions of response types, so handlers can keep returning the
+// current types while older API versions get the shapes they expect. Register serializers before serving.
+type VersionedSerializers struct {
+	mu          sync.RWMutex
+	serializers map[reflect.Type]map[string]func(interface{}) interface{}
+}
+
+// Register adds a serializer used for values of sample's type in responses to the given API version.
+// Parameters:
+// - version: The API version, e.g. "1" or "v1".
+// - sample: A value of the type to convert, e.g. User{}.
+// - fn: The conversion, returning the value to marshal instead.
+func (s *VersionedSerializers) Register(version string, sample interface{}, fn func(interface{}) interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.serializers == nil {
+		s.serializers = make(map[reflect.Type]map[string]func(interface{}) interface{})
+	}
+
+	typ := reflect.TypeOf(sample)
+	if s.serializers[typ] == nil {
+		s.serializers[typ] = make(map[string]func(interface{}) interface{})
+	}
+	s.serializers[typ][normalizeVersion(version)] = fn
+}
+
+// RegisterSerializer is a typed form of VersionedSerializers.Register.
+func RegisterSerializer[T any](s *VersionedSerializers, version string, fn func(T) interface{}) {
+	var sample T
+	s.Register(version, sample, func(v interface{}) interface{} { return fn(v.(T)) })
+}
+
+// lookup returns the serializer for typ and version, if any.
+func (s *VersionedSerializers) lookup(typ reflect.Type, version string) func(interface{}) interface{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.serializers[typ][version]
+}
+
+// Serialize converts data for an API version: a registered serializer for its type is applied to data itself, to
+// each element of a slice, or to the Data of a JSONResponse envelope. Other data is returned unchanged.
+func (s *VersionedSerializers) Serialize(version string, data interface{}) interface{} {
+	if s == nil || version == "" || data == nil {
+		return data
+	}
+
+	if fn := s.lookup(reflect.TypeOf(data), version); fn != nil {
+		return fn(data)
+	}
+
+	switch payload := data.(type) {
+	case JSONResponse:
+		payload.Data = s.Serialize(version, payload.Data)
+		return payload
+	case *JSONResponse:
+		if payload == nil {
+			return data
+		}
+		copied := *payload
+		copied.Data = s.Serialize(version, copied.Data)
+		return copied
+	}
+
+	v := reflect.ValueOf(data)
+	if v.Kind() == reflect.Slice {
+		if fn := s.lookup(v.Type().Elem(), version); fn != nil {
+			out := make([]interface{}, v.Len())
+			for i := range out {
+				out[i] = fn(v.Index(i).Interface())
+			}
+			return out
+		}
+	}
+
+	return data
+}
+
+// serializeForVersion applies t.Serializers for the API version carried by w.
+func (t *Tools) serializeForVersion(w http.ResponseWriter, data interface{}) interface{} {
+	if t.Serializers == nil {
+		return data
+	}
+
+	return t.Serializers.Serialize(writerAPIVersion(w), data)
+}
@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type versionTestUser struct {
+	ID        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+var apiVersionTests = []struct {
+	name    string
+	path    string
+	header  string
+	accept  string
+	version string
+	status  int
+}{
+	{name: "path", path: "/v1/users", version: "1", status: http.StatusOK},
+	{name: "header", path: "/users", header: "v2", version: "2", status: http.StatusOK},
+	{name: "accept", path: "/users", accept: "application/json; version=1", version: "1", status: http.StatusOK},
+	{name: "default", path: "/users", version: "2", status: http.StatusOK},
+	{name: "unsupported", path: "/v9/users", status: http.StatusBadRequest},
+}
+
+func TestTools_APIVersionMiddleware(t *testing.T) {
+	var testTools Tools
+
+	var version string
+	handler := testTools.APIVersionMiddleware(APIVersionOptions{Default: "v2", Supported: []string{"1", "2"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version = APIVersionFromContext(r.Context())
+	}))
+
+	for _, e := range apiVersionTests {
+		version = ""
+		req := httptest.NewRequest(http.MethodGet, e.path, nil)
+		if e.header != "" {
+			req.Header.Set("API-Version", e.header)
+		}
+		if e.accept != "" {
+			req.Header.Set("Accept", e.accept)
+		}
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if version != e.version {
+			t.Errorf("%s: expected version %q, got %q", e.name, e.version, version)
+		}
+		if e.version != "" && rr.Header().Get("API-Version") != e.version {
+			t.Errorf("%s: expected API-Version header %s, got %s", e.name, e.version, rr.Header().Get("API-Version"))
+		}
+	}
+}
+
+func TestTools_WriteJSONVersionedSerializers(t *testing.T) {
+	testTools := Tools{Serializers: &VersionedSerializers{}}
+
+	// version 1 returned a single name field
+	RegisterSerializer(testTools.Serializers, "v1", func(u versionTestUser) interface{} {
+		return map[string]interface{}{"id": u.ID, "name": u.FirstName + " " + u.LastName}
+	})
+
+	users := []versionTestUser{{ID: 1, FirstName: "Ann", LastName: "Lee"}}
+
+	handler := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(newStatusWriter(w), http.StatusOK, JSONResponse{Data: users})
+	}))
+
+	expected := map[string]string{
+		"/v1/users": `{"error":false,"message":"","data":[{"id":1,"name":"Ann Lee"}]}`,
+		"/v2/users": `{"error":false,"message":"","data":[{"id":1,"first_name":"Ann","last_name":"Lee"}]}`,
+		"/users":    `{"error":false,"message":"","data":[{"id":1,"first_name":"Ann","last_name":"Lee"}]}`,
+	}
+
+	for path, body := range expected {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rr.Body.String() != body {
+			t.Errorf("%s: expected %s, got %s", path, body, rr.Body.String())
+		}
+	}
+}
+
+func TestVersionedSerializers_SerializeNilEnvelope(t *testing.T) {
+	testTools := Tools{Serializers: &VersionedSerializers{}}
+	RegisterSerializer(testTools.Serializers, "v1", func(u versionTestUser) interface{} { return u.ID })
+
+	handler := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var resp *JSONResponse
+		_ = testTools.WriteJSON(w, http.StatusOK, resp)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "null" {
+		t.Errorf("expected a nil envelope written as null, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// LoadAssetManifest reads a fingerprint manifest from a JSON file mapping logical asset names to their
+// fingerprinted paths, e.g. {"app.css": "/static/app.3f2a1b9c.css"}, as produced by most asset bundlers.
+// Parameters:
+// - pathName: The path of the JSON manifest file.
+// Returns the manifest, suitable for the AssetManifest field of Tools, or an error if the file cannot be read or parsed.
+func LoadAssetManifest(pathName string) (map[string]string, error) {
+	data, err := os.ReadFile(pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := make(map[string]string)
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid asset manifest %s: %w", pathName, err)
+	}
+
+	return manifest, nil
+}
+
+// AssetURL resolves a logical asset name to its fingerprinted URL using the AssetManifest field.
+// Parameters:
+// - name: The logical asset name, e.g. "app.css".
+// Returns the fingerprinted URL, or the name unchanged if it is not in the manifest.
+func (t *Tools) AssetURL(name string) string {
+	if u, ok := t.AssetManifest[name]; ok {
+		return u
+	}
+
+	return name
+}
+
+// Preload describes an asset the browser should start fetching before the page is rendered.
+// Fields:
+// - URL: The logical asset name or URL; it is resolved through the asset manifest.
+// - As: The request destination (style, script, font, image...). It is inferred from the extension if empty.
+// - Type: An optional MIME type hint.
+// - CrossOrigin: Whether the asset must be fetched in CORS mode, required for fonts.
+type Preload struct {
+	URL         string
+	As          string
+	Type        string
+	CrossOrigin bool
+}
+
+// EarlyHints sends a 103 Early Hints informational response with preload Link headers, letting browsers fetch
+// critical assets while the handler is still rendering the page. The Link headers remain set for the final response.
+// Parameters:
+// - w: The http.ResponseWriter to write the hints to.
+// - links: The assets to preload.
+func (t *Tools) EarlyHints(w http.ResponseWriter, links []Preload) {
+	if len(links) == 0 {
+		return
+	}
+
+	for _, l := range links {
+		w.Header().Add("Link", t.linkHeader(l))
+	}
+
+	w.WriteHeader(http.StatusEarlyHints)
+}
+
+// Push initiates HTTP/2 server pushes for the given assets, resolving each through the asset manifest.
+// Parameters:
+// - w: The http.ResponseWriter of the current request.
+// - resources: The logical asset names or absolute paths to push.
+// Returns http.ErrNotSupported if the connection does not support server push, or the first push error encountered.
+func (t *Tools) Push(w http.ResponseWriter, resources []string) error {
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+
+	for _, res := range resources {
+		if err := pusher.Push(t.AssetURL(res), nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkHeader formats a preload Link header value for l.
+func (t *Tools) linkHeader(l Preload) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "<%s>; rel=preload", t.AssetURL(l.URL))
+
+	as := l.As
+	if as == "" {
+		as = preloadDestination(l.URL)
+	}
+	if as != "" {
+		fmt.Fprintf(&b, "; as=%s", as)
+	}
+
+	if l.Type != "" {
+		fmt.Fprintf(&b, "; type=%q", l.Type)
+	}
+
+	if l.CrossOrigin || as == "font" {
+		b.WriteString("; crossorigin")
+	}
+
+	return b.String()
+}
+
+// preloadDestination infers the preload "as" attribute from a file extension.
+func preloadDestination(name string) string {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	case ".woff", ".woff2", ".ttf", ".otf":
+		return "font"
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp", ".avif", ".svg", ".ico":
+		return "image"
+	}
+
+	return ""
+}
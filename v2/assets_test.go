@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTools_LoadAssetManifest(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	_ = os.WriteFile(manifestPath, []byte(`{"app.css": "/static/app.3f2a1b9c.css"}`), 0644)
+
+	manifest, err := LoadAssetManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{AssetManifest: manifest}
+
+	if u := testTools.AssetURL("app.css"); u != "/static/app.3f2a1b9c.css" {
+		t.Errorf("expected fingerprinted URL, got %s", u)
+	}
+
+	if u := testTools.AssetURL("other.js"); u != "other.js" {
+		t.Errorf("expected unknown asset to be returned unchanged, got %s", u)
+	}
+}
+
+func TestTools_EarlyHints(t *testing.T) {
+	testTools := Tools{AssetManifest: map[string]string{"app.css": "/static/app.abc.css"}}
+
+	rr := httptest.NewRecorder()
+	testTools.EarlyHints(rr, []Preload{{URL: "app.css"}, {URL: "/fonts/inter.woff2"}})
+
+	links := rr.Header().Values("Link")
+	if len(links) != 2 {
+		t.Fatalf("expected 2 Link headers, got %d", len(links))
+	}
+
+	if links[0] != "</static/app.abc.css>; rel=preload; as=style" {
+		t.Errorf("unexpected style link: %s", links[0])
+	}
+
+	if links[1] != "</fonts/inter.woff2>; rel=preload; as=font; crossorigin" {
+		t.Errorf("unexpected font link: %s", links[1])
+	}
+
+	if rr.Code != http.StatusEarlyHints {
+		t.Errorf("expected status %d, got %d", http.StatusEarlyHints, rr.Code)
+	}
+}
+
+func TestTools_PushNotSupported(t *testing.T) {
+	var testTools Tools
+
+	err := testTools.Push(httptest.NewRecorder(), []string{"app.css"})
+	if !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("expected http.ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,408 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrAuthFailed is returned when an OAuth login cannot be completed: the state does not match, the user denied
+// access, or the provider rejected the code.
+var ErrAuthFailed = errors.New("authentication failed")
+
+// AuthProvider is an OAuth 2.0 or OpenID Connect identity provider.
+// Fields:
+// - Name: The provider's name, used in cookies and Subject claims, e.g. "google".
+// - ClientID: The OAuth client ID.
+// - ClientSecret: The OAuth client secret.
+// - RedirectURL: The absolute URL of the CompleteAuth handler, as registered with the provider.
+// - AuthURL: The authorization endpoint.
+// - TokenURL: The token endpoint.
+// - UserInfoURL: The endpoint returning the user's profile, used when the provider returns no ID token.
+// - Issuer: For OpenID Connect providers, the issuer. When set, the ID token is required and verified.
+// - JWKSURL: For OpenID Connect providers, the URL of the keys ID tokens are signed with.
+// - Scopes: The scopes requested.
+// - MapClaims: Maps the user's claims to a Subject. By default the ID comes from the "sub" claim, or "id" for
+// OAuth providers such as GitHub, and the other string, number and boolean claims are copied to Claims.
+type AuthProvider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+	Issuer       string
+	JWKSURL      string
+	Scopes       []string
+	MapClaims    func(claims map[string]interface{}) (Subject, error)
+}
+
+// GoogleProvider returns the configuration for signing in with Google, verifying its OpenID Connect ID tokens.
+func GoogleProvider(clientID, clientSecret, redirectURL string) *AuthProvider {
+	return &AuthProvider{
+		Name:         "google",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		UserInfoURL:  "https://openidconnect.googleapis.com/v1/userinfo",
+		Issuer:       "https://accounts.google.com",
+		JWKSURL:      "https://www.googleapis.com/oauth2/v3/certs",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+}
+
+// GitHubProvider returns the configuration for signing in with GitHub, which uses plain OAuth 2.0: the user is
+// read from its API, and the Subject ID is the numeric GitHub user ID.
+func GitHubProvider(clientID, clientSecret, redirectURL string) *AuthProvider {
+	return &AuthProvider{
+		Name:         "github",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://github.com/login/oauth/authorize",
+		TokenURL:     "https://github.com/login/oauth/access_token",
+		UserInfoURL:  "https://api.github.com/user",
+		Scopes:       []string{"read:user", "user:email"},
+	}
+}
+
+// AuthTokens are the tokens returned by a provider.
+type AuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	IDToken      string
+	Expiry       time.Time
+}
+
+// AuthResult is a completed login, passed to AuthFlow.OnLogin.
+// Fields:
+// - Provider: The provider's name.
+// - Subject: The user, as mapped by the provider's MapClaims.
+// - Claims: The raw claims of the ID token or user info.
+// - Tokens: The provider's tokens, e.g. to call its API on the user's behalf.
+// - ReturnTo: The local path the login started from, from BeginAuth's return_to parameter, or "/".
+type AuthResult struct {
+	Provider string
+	Subject  Subject
+	Claims   map[string]interface{}
+	Tokens   AuthTokens
+	ReturnTo string
+}
+
+// AuthFlow runs OAuth 2.0 and OpenID Connect logins with the authorization code flow, PKCE, a state parameter
+// against cross-site request forgery and, for OpenID Connect, a nonce against ID token replay. The state is kept in
+// a short-lived signed cookie, so no server-side storage is needed.
+// Fields:
+// - Providers: The providers, by name.
+// - Secret: The key signing the state cookie, at least 32 random bytes.
+// - Keyring: Signs the state cookie instead of Secret when set, so logins in progress survive key rotation.
+// - OnLogin: Called after a successful login to start the user's session, e.g. with Tools.RememberMe, and
+// respond, usually by redirecting to result.ReturnTo.
+// - Secure: Whether the state cookie is only sent over HTTPS. It always is for requests received over TLS.
+// - Client: The http.Client for requests to providers. Defaults to one with a 10 second timeout.
+type AuthFlow struct {
+	Providers map[string]*AuthProvider
+	Secret    []byte
+	Keyring   *Keyring
+	OnLogin   func(w http.ResponseWriter, r *http.Request, result *AuthResult)
+	Secure    bool
+	Client    *http.Client
+
+	jwks jwksCache
+}
+
+// NewAuthFlow returns a flow for the providers.
+func NewAuthFlow(secret []byte, onLogin func(w http.ResponseWriter, r *http.Request, result *AuthResult), providers ...*AuthProvider) *AuthFlow {
+	f := &AuthFlow{Providers: make(map[string]*AuthProvider), Secret: secret, OnLogin: onLogin}
+	for _, p := range providers {
+		f.Providers[p.Name] = p
+	}
+
+	return f
+}
+
+// authState is kept in the state cookie between BeginAuth and CompleteAuth.
+type authState struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	ReturnTo string `json:"r"`
+}
+
+// client returns the configured http.Client or the default.
+func (f *AuthFlow) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// setStateCookie sets a signed state cookie.
+func (f *AuthFlow) setStateCookie(w http.ResponseWriter, c *http.Cookie) {
+	if f.Keyring != nil {
+		SetSignedCookieWithKeyring(w, c, f.Keyring)
+		return
+	}
+
+	SetSignedCookie(w, c, f.Secret)
+}
+
+// stateCookieValue returns the value of a signed state cookie.
+func (f *AuthFlow) stateCookieValue(r *http.Request, name string) (string, error) {
+	if f.Keyring != nil {
+		return SignedCookieValueWithKeyring(r, name, f.Keyring)
+	}
+
+	return SignedCookieValue(r, name, f.Secret)
+}
+
+// stateCookieName returns the name of the provider's state cookie.
+func stateCookieName(provider string) string {
+	return "auth_state_" + provider
+}
+
+// BeginAuth returns a handler starting a login with the provider: it redirects the user to the provider's
+// consent page. A return_to query parameter holding a local path, e.g. "/settings", is carried through the login
+// to AuthResult.ReturnTo.
+// Parameters:
+// - provider: The provider's name.
+// Returns the handler, which answers 404 Not Found for unknown providers.
+func (f *AuthFlow) BeginAuth(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := f.Providers[provider]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		state := authState{
+			State:    randomToken(),
+			Nonce:    randomToken(),
+			Verifier: randomToken() + randomToken(),
+			ReturnTo: localReturnPath(r.URL.Query().Get("return_to")),
+		}
+		data, _ := json.Marshal(state)
+
+		f.setStateCookie(w, &http.Cookie{
+			Name:     stateCookieName(provider),
+			Value:    string(data),
+			Path:     "/",
+			MaxAge:   600,
+			HttpOnly: true,
+			Secure:   f.Secure || r.TLS != nil,
+			// the provider redirects back with a top-level GET, which Lax cookies are sent with
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		challenge := sha256.Sum256([]byte(state.Verifier))
+		q := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {p.ClientID},
+			"redirect_uri":          {p.RedirectURL},
+			"scope":                 {strings.Join(p.Scopes, " ")},
+			"state":                 {state.State},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		if p.Issuer != "" {
+			q.Set("nonce", state.Nonce)
+		}
+
+		authURL := p.AuthURL
+		if strings.Contains(authURL, "?") {
+			authURL += "&" + q.Encode()
+		} else {
+			authURL += "?" + q.Encode()
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// CompleteAuth returns the handler the provider redirects back to. It checks the state, exchanges the code for
+// tokens, verifies the ID token or fetches the user's profile, maps the claims to a Subject and calls OnLogin.
+// Parameters:
+// - provider: The provider's name.
+// Returns the handler, which answers 401 Unauthorized with an error wrapping ErrAuthFailed if the login fails.
+func (f *AuthFlow) CompleteAuth(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := f.Providers[provider]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		result, err := f.complete(w, r, p)
+		if err != nil {
+			_ = (&Tools{}).ErrorJSON(w, err, http.StatusUnauthorized)
+			return
+		}
+
+		f.OnLogin(w, r, result)
+	}
+}
+
+// complete runs the second half of the flow.
+func (f *AuthFlow) complete(w http.ResponseWriter, r *http.Request, p *AuthProvider) (*AuthResult, error) {
+	raw, err := f.stateCookieValue(r, stateCookieName(p.Name))
+	http.SetCookie(w, &http.Cookie{Name: stateCookieName(p.Name), Path: "/", MaxAge: -1, HttpOnly: true, Secure: f.Secure || r.TLS != nil})
+	if err != nil {
+		return nil, fmt.Errorf("%w: the login expired or was started elsewhere", ErrAuthFailed)
+	}
+
+	var state authState
+	if err := json.Unmarshal([]byte(raw), &state); err != nil {
+		return nil, fmt.Errorf("%w: invalid state", ErrAuthFailed)
+	}
+
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(state.State)) != 1 {
+		return nil, fmt.Errorf("%w: state mismatch", ErrAuthFailed)
+	}
+	if e := q.Get("error"); e != "" {
+		return nil, fmt.Errorf("%w: %s", ErrAuthFailed, e)
+	}
+
+	tokens, err := f.exchange(r.Context(), p, q.Get("code"), state.Verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	switch {
+	case p.Issuer != "":
+		if tokens.IDToken == "" {
+			return nil, fmt.Errorf("%w: no ID token", ErrAuthFailed)
+		}
+		claims, err = f.jwks.verifyIDToken(r.Context(), f.client(), p, tokens.IDToken, state.Nonce)
+	case p.UserInfoURL != "":
+		err = getJSON(r.Context(), f.client(), p.UserInfoURL, tokens.AccessToken, &claims)
+	default:
+		err = fmt.Errorf("provider %q has neither an issuer nor a user info URL", p.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+
+	mapClaims := p.MapClaims
+	if mapClaims == nil {
+		mapClaims = defaultMapClaims
+	}
+	subject, err := mapClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	}
+	if subject.Claims == nil {
+		subject.Claims = make(map[string]string)
+	}
+	subject.Claims["provider"] = p.Name
+
+	return &AuthResult{Provider: p.Name, Subject: subject, Claims: claims, Tokens: tokens, ReturnTo: state.ReturnTo}, nil
+}
+
+// exchange trades an authorization code for tokens.
+func (f *AuthFlow) exchange(ctx context.Context, p *AuthProvider, code, verifier string) (AuthTokens, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := f.client().Do(req)
+	if err != nil {
+		return AuthTokens{}, err
+	}
+	defer res.Body.Close()
+
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type"`
+		IDToken      string `json:"id_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+		Error        string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return AuthTokens{}, fmt.Errorf("%w: unreadable token response", ErrAuthFailed)
+	}
+	// GitHub reports errors with 200 OK
+	if res.StatusCode != http.StatusOK || body.Error != "" || body.AccessToken == "" {
+		return AuthTokens{}, fmt.Errorf("%w: token exchange failed: %s", ErrAuthFailed, body.Error)
+	}
+
+	tokens := AuthTokens{AccessToken: body.AccessToken, RefreshToken: body.RefreshToken, TokenType: body.TokenType, IDToken: body.IDToken}
+	if body.ExpiresIn > 0 {
+		tokens.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+
+	return tokens, nil
+}
+
+// defaultMapClaims takes the ID from "sub" or "id" and copies the other scalar claims.
+func defaultMapClaims(claims map[string]interface{}) (Subject, error) {
+	subject := Subject{Claims: make(map[string]string)}
+
+	for k, v := range claims {
+		switch v := v.(type) {
+		case string:
+			subject.Claims[k] = v
+		case float64:
+			subject.Claims[k] = strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			subject.Claims[k] = strconv.FormatBool(v)
+		}
+	}
+
+	subject.ID = subject.Claims["sub"]
+	if subject.ID == "" {
+		subject.ID = subject.Claims["id"]
+	}
+	if subject.ID == "" {
+		return Subject{}, errors.New("the provider returned no user ID")
+	}
+
+	return subject, nil
+}
+
+// randomToken returns 32 random bytes, base64url encoded.
+func randomToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// localReturnPath returns p if it is a path on this site, or "/", so logins cannot redirect elsewhere.
+func localReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+
+	return p
+}
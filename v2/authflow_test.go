@@ -0,0 +1,234 @@
+package toolkit
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIdentityProvider is an OpenID provider issuing RS256 ID tokens for one user.
+type fakeIdentityProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+}
+
+func newFakeIdentityProvider(t *testing.T) *fakeIdentityProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &fakeIdentityProvider{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/auth",
+			"token_endpoint":         idp.URL + "/token",
+			"userinfo_endpoint":      idp.URL + "/userinfo",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if r.FormValue("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != idp.challenge {
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token": idp.sign(t, map[string]interface{}{
+				"iss": idp.URL, "aud": "client", "sub": "user-1", "email": "ann@example.com",
+				"email_verified": true, "exp": time.Now().Add(time.Hour).Unix(), "nonce": idp.nonce,
+			}),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": 583231, "login": "octocat"})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// sign returns an RS256 JWT with the claims.
+func (idp *fakeIdentityProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// runAuthFlow begins a login, lets the provider redirect back with code and returns the callback's response.
+func runAuthFlow(t *testing.T, flow *AuthFlow, idp *fakeIdentityProvider, provider, code string, tamperState bool) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	flow.BeginAuth(provider)(rr, httptest.NewRequest(http.MethodGet, "/login?return_to=/settings", nil))
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected a redirect, got %d", rr.Code)
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	q := location.Query()
+	idp.challenge, idp.nonce = q.Get("code_challenge"), q.Get("nonce")
+	if q.Get("code_challenge_method") != "S256" || q.Get("state") == "" {
+		t.Fatalf("expected PKCE and state parameters, got %s", location)
+	}
+
+	state := q.Get("state")
+	if tamperState {
+		state = "forged"
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	rr = httptest.NewRecorder()
+	flow.CompleteAuth(provider)(rr, req)
+
+	return rr
+}
+
+func TestAuthFlow_OIDC(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+
+	provider, err := DiscoverOIDCProvider(context.Background(), "test", idp.URL, "client", "secret", "https://app.example.com/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result *AuthResult
+	flow := NewAuthFlow([]byte("a-very-secret-key-for-testing-only"), func(w http.ResponseWriter, r *http.Request, res *AuthResult) {
+		result = res
+		http.Redirect(w, r, res.ReturnTo, http.StatusFound)
+	}, provider)
+
+	rr := runAuthFlow(t, flow, idp, "test", "good-code", false)
+	if rr.Code != http.StatusFound || result == nil {
+		t.Fatalf("expected a completed login, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if result.Subject.ID != "user-1" || result.Subject.Claims["email"] != "ann@example.com" || result.Subject.Claims["provider"] != "test" {
+		t.Errorf("unexpected subject %+v", result.Subject)
+	}
+	if result.ReturnTo != "/settings" || result.Tokens.AccessToken != "access" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+var authFlowFailureTests = []struct {
+	name        string
+	code        string
+	tamperState bool
+}{
+	{name: "state mismatch", code: "good-code", tamperState: true},
+	{name: "bad code", code: "bad-code"},
+}
+
+func TestAuthFlow_Failures(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	provider, _ := DiscoverOIDCProvider(context.Background(), "test", idp.URL, "client", "secret", "https://app.example.com/callback")
+
+	for _, e := range authFlowFailureTests {
+		called := false
+		flow := NewAuthFlow([]byte("a-very-secret-key-for-testing-only"), func(w http.ResponseWriter, r *http.Request, res *AuthResult) {
+			called = true
+		}, provider)
+
+		rr := runAuthFlow(t, flow, idp, "test", e.code, e.tamperState)
+		if rr.Code != http.StatusUnauthorized || called {
+			t.Errorf("%s: expected 401 without a login, got %d", e.name, rr.Code)
+		}
+	}
+}
+
+func TestAuthFlow_OAuthUserInfo(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	provider := GitHubProvider("client", "secret", "https://app.example.com/callback")
+	provider.AuthURL, provider.TokenURL, provider.UserInfoURL = idp.URL+"/auth", idp.URL+"/token", idp.URL+"/userinfo"
+
+	var result *AuthResult
+	flow := NewAuthFlow([]byte("a-very-secret-key-for-testing-only"), func(w http.ResponseWriter, r *http.Request, res *AuthResult) {
+		result = res
+	}, provider)
+
+	rr := runAuthFlow(t, flow, idp, "github", "good-code", false)
+	if result == nil {
+		t.Fatalf("expected a completed login, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if result.Subject.ID != "583231" || result.Subject.Claims["login"] != "octocat" {
+		t.Errorf("unexpected subject %+v", result.Subject)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	provider, _ := DiscoverOIDCProvider(context.Background(), "test", idp.URL, "client", "secret", "https://app.example.com/callback")
+
+	var cache jwksCache
+	claims := map[string]interface{}{"iss": idp.URL, "aud": "client", "sub": "u", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "n"}
+
+	if _, err := cache.verifyIDToken(context.Background(), http.DefaultClient, provider, idp.sign(t, claims), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	claims["aud"] = "another-client"
+	if _, err := cache.verifyIDToken(context.Background(), http.DefaultClient, provider, idp.sign(t, claims), "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken for another audience, got %v", err)
+	}
+
+	claims["aud"] = "client"
+	token := idp.sign(t, claims)
+	parts := strings.Split(token, ".")
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"`+idp.URL+`","aud":"client","sub":"admin","exp":9999999999,"nonce":"n"}`)) + "." + parts[2]
+	if _, err := cache.verifyIDToken(context.Background(), http.DefaultClient, provider, forged, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("expected ErrInvalidIDToken for a forged payload, got %v", err)
+	}
+}
+
+func TestLocalReturnPath(t *testing.T) {
+	for in, want := range map[string]string{"/settings": "/settings", "": "/", "https://evil.example": "/", "//evil.example": "/", `/\evil.example`: "/"} {
+		if got := localReturnPath(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
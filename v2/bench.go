@@ -0,0 +1,155 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// BenchUpload benchmarks UploadFiles with this Tools' configuration, uploading one generated text file of the given
+// size per operation. Call it from a benchmark, e.g.
+//
+//	func BenchmarkUpload(b *testing.B) { tools.BenchUpload(b, 1<<20) }
+//
+// Parameters:
+// - b: The benchmark.
+// - size: The size of the uploaded file, in bytes.
+func (t *Tools) BenchUpload(b *testing.B, size int) {
+	b.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "bench.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	_, _ = part.Write(bytes.Repeat([]byte("toolkit benchmark\n"), size/18+1)[:size])
+	_ = mw.Close()
+
+	dir := b.TempDir()
+	data := body.Bytes()
+	contentType := mw.FormDataContentType()
+
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(data))
+		req.Header.Set("Content-Type", contentType)
+
+		if _, err := t.UploadFiles(req, dir, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchJSON benchmarks WriteJSON encoding data with this Tools' configuration, e.g.
+//
+//	func BenchmarkOrders(b *testing.B) { tools.BenchJSON(b, sampleOrders) }
+//
+// Parameters:
+// - b: The benchmark.
+// - data: The value to encode, ideally a realistic response.
+func (t *Tools) BenchJSON(b *testing.B, data interface{}) {
+	b.Helper()
+
+	w := &benchWriter{header: make(http.Header)}
+	if err := t.WriteJSON(w, http.StatusOK, data); err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(w.written))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		clear(w.header)
+		if err := t.WriteJSON(w, http.StatusOK, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchWriter is an http.ResponseWriter discarding the response, so benchmarks measure the encoding only.
+type benchWriter struct {
+	header  http.Header
+	written int
+}
+
+// Header returns the response headers.
+func (w *benchWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader discards the status code.
+func (w *benchWriter) WriteHeader(int) {}
+
+// Write discards the body.
+func (w *benchWriter) Write(p []byte) (int, error) {
+	w.written += len(p)
+	return len(p), nil
+}
+
+// PerformanceBudget is a limit on the cost of an operation, checked against a benchmark so a regression fails the
+// tests instead of reaching production. Zero fields are not checked.
+// Fields:
+// - MaxTimePerOp: The longest time an operation may take.
+// - MaxAllocsPerOp: The most allocations an operation may make.
+// - MaxBytesPerOp: The most bytes an operation may allocate.
+type PerformanceBudget struct {
+	MaxTimePerOp   time.Duration
+	MaxAllocsPerOp int64
+	MaxBytesPerOp  int64
+}
+
+// Check compares a benchmark result with the budget.
+// Returns nil, or an error listing each limit exceeded.
+func (pb PerformanceBudget) Check(res testing.BenchmarkResult) error {
+	var errs []error
+	if perOp := time.Duration(res.NsPerOp()); pb.MaxTimePerOp > 0 && perOp > pb.MaxTimePerOp {
+		errs = append(errs, fmt.Errorf("%s/op exceeds the budget of %s/op", perOp, pb.MaxTimePerOp))
+	}
+	if allocs := res.AllocsPerOp(); pb.MaxAllocsPerOp > 0 && allocs > pb.MaxAllocsPerOp {
+		errs = append(errs, fmt.Errorf("%d allocs/op exceeds the budget of %d allocs/op", allocs, pb.MaxAllocsPerOp))
+	}
+	if bytesPerOp := res.AllocedBytesPerOp(); pb.MaxBytesPerOp > 0 && bytesPerOp > pb.MaxBytesPerOp {
+		errs = append(errs, fmt.Errorf("%d B/op exceeds the budget of %d B/op", bytesPerOp, pb.MaxBytesPerOp))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Enforce runs a benchmark from a test and fails the test if it exceeds the budget, e.g.
+//
+//	func TestUploadBudget(t *testing.T) {
+//		budget := toolkit.PerformanceBudget{MaxTimePerOp: 5 * time.Millisecond, MaxAllocsPerOp: 200}
+//		budget.Enforce(t, func(b *testing.B) { tools.BenchUpload(b, 1<<20) })
+//	}
+//
+// The benchmark runs for the -test.benchtime duration, one second by default, and is skipped with -short. Timings
+// depend on the machine, so time budgets need headroom on shared CI runners; allocation budgets do not.
+// Parameters:
+// - tb: The test.
+// - bench: The benchmark.
+func (pb PerformanceBudget) Enforce(tb testing.TB, bench func(b *testing.B)) {
+	tb.Helper()
+
+	if testing.Short() {
+		tb.Skip("performance budgets are skipped with -short")
+	}
+
+	res := testing.Benchmark(bench)
+	if res.N == 0 {
+		tb.Fatal("benchmark failed")
+		return
+	}
+	if err := pb.Check(res); err != nil {
+		tb.Errorf("performance budget exceeded (%s):\n%v", res.String(), err)
+	}
+}
@@ -0,0 +1,81 @@
+package toolkit
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// budgetTB records the failures of PerformanceBudget.Enforce.
+type budgetTB struct {
+	testing.TB
+	failures []string
+}
+
+func (tb *budgetTB) Helper() {}
+
+func (tb *budgetTB) Errorf(format string, args ...interface{}) {
+	tb.failures = append(tb.failures, fmt.Sprintf(format, args...))
+}
+
+func (tb *budgetTB) Fatal(args ...interface{}) {
+	tb.failures = append(tb.failures, fmt.Sprint(args...))
+}
+
+func TestPerformanceBudget_Check(t *testing.T) {
+	res := testing.BenchmarkResult{N: 100, T: time.Millisecond, MemAllocs: 1000, MemBytes: 64000}
+
+	var tests = []struct {
+		name     string
+		budget   PerformanceBudget
+		problems []string
+	}{
+		{"no limits", PerformanceBudget{}, nil},
+		{"within budget", PerformanceBudget{MaxTimePerOp: 10 * time.Microsecond, MaxAllocsPerOp: 10, MaxBytesPerOp: 640}, nil},
+		{"too slow", PerformanceBudget{MaxTimePerOp: 5 * time.Microsecond}, []string{"10µs/op exceeds the budget of 5µs/op"}},
+		{"too many allocations", PerformanceBudget{MaxAllocsPerOp: 9, MaxBytesPerOp: 100}, []string{"10 allocs/op", "640 B/op exceeds the budget of 100 B/op"}},
+	}
+
+	for _, e := range tests {
+		err := e.budget.Check(res)
+		if (err != nil) != (len(e.problems) > 0) {
+			t.Errorf("%s: expected problems %v, got %v", e.name, e.problems, err)
+			continue
+		}
+		for _, p := range e.problems {
+			if !strings.Contains(err.Error(), p) {
+				t.Errorf("%s: expected %q in %v", e.name, p, err)
+			}
+		}
+	}
+}
+
+func TestPerformanceBudget_Enforce(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs benchmarks")
+	}
+
+	testTools := Tools{MaxFileSize: 1 << 20}
+	payload := map[string]interface{}{"id": 1, "items": []string{"a", "b", "c"}}
+
+	PerformanceBudget{MaxTimePerOp: time.Second}.Enforce(t, func(b *testing.B) { testTools.BenchJSON(b, payload) })
+	PerformanceBudget{MaxTimePerOp: time.Second}.Enforce(t, func(b *testing.B) { testTools.BenchUpload(b, 4096) })
+
+	tb := &budgetTB{TB: t}
+	PerformanceBudget{MaxBytesPerOp: 1}.Enforce(tb, func(b *testing.B) { testTools.BenchJSON(b, payload) })
+	if len(tb.failures) != 1 || !strings.Contains(tb.failures[0], "B/op exceeds the budget of 1 B/op") {
+		t.Errorf("expected the budget to be exceeded, got %v", tb.failures)
+	}
+
+	tb = &budgetTB{TB: t}
+	PerformanceBudget{}.Enforce(tb, func(b *testing.B) { testTools.BenchJSON(b, make(chan int)) })
+	if len(tb.failures) != 1 || tb.failures[0] != "benchmark failed" {
+		t.Errorf("expected a failing benchmark to fail the test, got %v", tb.failures)
+	}
+}
+
+func BenchmarkTools_UploadFiles(b *testing.B) {
+	var testTools Tools
+	testTools.BenchUpload(b, 1<<20)
+}
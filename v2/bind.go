@@ -0,0 +1,205 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// defaultBindMaxMemory is the most bytes of a multipart form Bind keeps in memory when neither Multipart.MaxMemory
+// nor MaxFileSize is set, as with http.Request.FormFile.
+const defaultBindMaxMemory = 32 << 20
+
+// Bind decodes the request into data, which must be a pointer to a struct.
+// JSON bodies are read with ReadJSON; form submissions and query strings are mapped onto fields using their `form`
+// or `query` struct tags (falling back to the json tag name, then the lower-cased field name). Fields tagged "-"
+// in the first of those tags they have, e.g. `json:"-"` without a form tag, are never set from forms.
+// Multipart forms are read within the limits used by UploadFiles: Multipart.MaxMemory (or MaxFileSize) bytes are kept
+// in memory, and a body larger than MaxUploadSize, if set, returns ErrFileTooLarge.
+// Parameters:
+// - w: The http.ResponseWriter, used to limit the size of JSON bodies.
+// - r: The *http.Request to decode.
+// - data: A pointer to the struct the request will be decoded into.
+// Returns an error if the request cannot be decoded into data.
+func (t *Tools) Bind(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return t.ReadJSON(w, r, data)
+	}
+
+	var err error
+	if mediaType == "multipart/form-data" {
+		if t.MaxUploadSize > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(t.MaxUploadSize))
+		}
+		maxMemory := t.multipartMaxMemory()
+		if maxMemory <= 0 {
+			maxMemory = defaultBindMaxMemory
+		}
+		err = r.ParseMultipartForm(maxMemory)
+		if errors.Is(err, multipart.ErrMessageTooLarge) || isBodyTooLarge(err) {
+			return ErrFileTooLarge
+		}
+	} else {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return fmt.Errorf("request contains an invalid form: %w", err)
+	}
+
+	return decodeValues(r.Form, data)
+}
+
+// BindAndValidate adapts a typed business handler into an http.HandlerFunc.
+// The request is decoded into a value of type T with Bind and checked with Validate before next is called.
+// Decoding failures are answered with a 400 JSON error and validation failures with a 422 JSON error listing
+// every failed field in the data member of the response.
+// Parameters:
+// - t: The Tools instance providing the decoding and error helpers.
+// - next: The business handler, called only with a valid value.
+// Returns an http.HandlerFunc ready to be registered on a router.
+func BindAndValidate[T any](t *Tools, next func(w http.ResponseWriter, r *http.Request, v T)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var v T
+
+		if err := t.Bind(w, r, &v); err != nil {
+			_ = t.ErrorJSON(w, err)
+			return
+		}
+
+		if err := t.Validate(&v); err != nil {
+			var verrs ValidationErrors
+			if !errors.As(err, &verrs) {
+				_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+				return
+			}
+
+			_ = t.WriteJSON(w, http.StatusUnprocessableEntity, JSONResponse{
+				Error:   true,
+				Message: "validation failed",
+				Code:    "validation.failed",
+				Data:    verrs,
+			})
+			return
+		}
+
+		next(w, r, v)
+	}
+}
+
+// decodeValues copies url.Values-style data onto the exported fields of the struct pointed to by data.
+func decodeValues(values map[string][]string, data interface{}) error {
+	rv := reflect.ValueOf(data)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("bind target must be a non-nil pointer to a struct")
+	}
+
+	rv = rv.Elem()
+	rt := rv.Type()
+
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, ok := formFieldName(sf)
+		if !ok {
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			slice := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+			for j, s := range raw {
+				if err := setValue(slice.Index(j), s); err != nil {
+					return fmt.Errorf("request contains an invalid value for the %q field", name)
+				}
+			}
+			fv.Set(slice)
+			continue
+		}
+
+		if err := setValue(fv, raw[0]); err != nil {
+			return fmt.Errorf("request contains an invalid value for the %q field", name)
+		}
+	}
+
+	return nil
+}
+
+// formFieldName returns the form or query key of a struct field, preferring its form, then query, then json tag,
+// or false if the first of those tags it has is "-".
+func formFieldName(sf reflect.StructField) (string, bool) {
+	for _, key := range []string{"form", "query", "json"} {
+		tag, ok := sf.Tag.Lookup(key)
+		if !ok {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			return "", false
+		}
+		if name != "" {
+			return name, true
+		}
+	}
+
+	return strings.ToLower(sf.Name), true
+}
+
+// setValue parses s according to the kind of fv and stores the result.
+func setValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Pointer {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+
+	return nil
+}
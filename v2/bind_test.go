@@ -0,0 +1,109 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindTestPayload struct {
+	Name  string `json:"name" form:"name" validate:"required"`
+	Count int    `json:"count" form:"count" validate:"min=1"`
+}
+
+var bindTests = []struct {
+	name        string
+	method      string
+	target      string
+	contentType string
+	body        string
+	status      int
+}{
+	{name: "valid json", method: http.MethodPost, target: "/", contentType: "application/json", body: `{"name": "foo", "count": 2}`, status: http.StatusOK},
+	{name: "invalid json", method: http.MethodPost, target: "/", contentType: "application/json", body: `{"name": `, status: http.StatusBadRequest},
+	{name: "json failing validation", method: http.MethodPost, target: "/", contentType: "application/json", body: `{"count": 0}`, status: http.StatusUnprocessableEntity},
+	{name: "valid form", method: http.MethodPost, target: "/", contentType: "application/x-www-form-urlencoded", body: "name=foo&count=3", status: http.StatusOK},
+	{name: "form with bad number", method: http.MethodPost, target: "/", contentType: "application/x-www-form-urlencoded", body: "name=foo&count=abc", status: http.StatusBadRequest},
+	{name: "valid query", method: http.MethodGet, target: "/?name=foo&count=1", status: http.StatusOK},
+	{name: "query failing validation", method: http.MethodGet, target: "/?count=1", status: http.StatusUnprocessableEntity},
+}
+
+func TestBindAndValidate(t *testing.T) {
+	var testTools Tools
+
+	handler := BindAndValidate(&testTools, func(w http.ResponseWriter, r *http.Request, v bindTestPayload) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, e := range bindTests {
+		req := httptest.NewRequest(e.method, e.target, strings.NewReader(e.body))
+		if e.contentType != "" {
+			req.Header.Set("Content-Type", e.contentType)
+		}
+		rr := httptest.NewRecorder()
+
+		handler(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d (%s)", e.name, e.status, rr.Code, rr.Body.String())
+		}
+
+		if e.status == http.StatusUnprocessableEntity {
+			var payload struct {
+				Data []FieldError `json:"data"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&payload)
+
+			if len(payload.Data) == 0 {
+				t.Errorf("%s: expected field errors in response", e.name)
+			}
+		}
+	}
+}
+
+func TestTools_BindFormTags(t *testing.T) {
+	var testTools Tools
+
+	type signup struct {
+		UserName string `json:"user_name" form:"username"`
+		Email    string `json:"email"`
+		Page     int    `query:"p"`
+		Nickname string
+		Role     string `json:"-"`
+		Secret   string `json:"secret" form:"-"`
+		Token    string `json:"-" form:"token"`
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/?p=2", strings.NewReader("username=ada&user_name=wrong&email=ada@example.com&nickname=ace&Role=admin&role=admin&secret=x&token=t1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var got signup
+	if err := testTools.Bind(httptest.NewRecorder(), req, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := signup{UserName: "ada", Email: "ada@example.com", Page: 2, Nickname: "ace", Token: "t1"}
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestTools_BindMultipartLimits(t *testing.T) {
+	testTools := Tools{MaxUploadSize: 1024}
+	files := [][3]string{{"photo", "a.png", strings.Repeat("x", 2048)}}
+
+	var got struct {
+		Title string `form:"title"`
+	}
+	if err := testTools.Bind(httptest.NewRecorder(), multipartUpload(t, files), &got); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("expected ErrFileTooLarge for a body over MaxUploadSize, got %v", err)
+	}
+
+	testTools.MaxUploadSize = 0
+	if err := testTools.Bind(httptest.NewRecorder(), multipartUpload(t, files), &got); err != nil || got.Title != "holiday" {
+		t.Errorf("expected the form bound, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,283 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ThrottleError is returned by BruteForceGuard when an attempt must be delayed or the account is locked out.
+// Passing it to ErrorJSON responds with 429 Too Many Requests and a Retry-After header.
+// Fields:
+// - RetryAfter: How long the client must wait before trying again.
+// - Locked: Whether the account is locked out rather than merely delayed.
+type ThrottleError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+// Error returns a human-readable description of the throttling.
+func (e *ThrottleError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed attempts, account locked; retry after %s seconds", e.retryAfterSeconds())
+	}
+
+	return fmt.Sprintf("too many failed attempts; retry after %s seconds", e.retryAfterSeconds())
+}
+
+// ErrorCode returns "auth.locked" for lockouts and "auth.throttled" for delays.
+func (e *ThrottleError) ErrorCode() string {
+	if e.Locked {
+		return "auth.locked"
+	}
+
+	return "auth.throttled"
+}
+
+// retryAfterSeconds returns RetryAfter rounded up to whole seconds, as used by the Retry-After header.
+func (e *ThrottleError) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// GuardState is the failure history of one account and IP pair.
+type GuardState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// GuardFailure describes one failed attempt recorded with GuardStore.AddFailure.
+// Fields:
+// - At: The time of the failure, stored as LastFailure.
+// - TTL: How long the state is kept after this failure.
+// - LockThreshold: The failure count from which the state is locked out. Zero never locks out.
+// - LockedUntil: The end of the lockout, stored once the state reaches LockThreshold failures.
+// - LockTTL: How long a locked out state is kept, replacing TTL.
+type GuardFailure struct {
+	At            time.Time
+	TTL           time.Duration
+	LockThreshold int
+	LockedUntil   time.Time
+	LockTTL       time.Duration
+}
+
+// GuardStore persists GuardState for BruteForceGuard. Implementations must forget entries after their ttl.
+// AddFailure must apply a failure atomically, so concurrent failures for the same key are all counted.
+type GuardStore interface {
+	Get(ctx context.Context, key string) (GuardState, error)
+	Set(ctx context.Context, key string, state GuardState, ttl time.Duration) error
+	AddFailure(ctx context.Context, key string, f GuardFailure) (GuardState, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryGuardStore is an in-process GuardStore, suitable for single-instance deployments and tests.
+type MemoryGuardStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryGuardEntry
+}
+
+type memoryGuardEntry struct {
+	state     GuardState
+	expiresAt time.Time
+}
+
+// Get returns the state stored for key, or a zero state if there is none.
+func (s *MemoryGuardStore) Get(_ context.Context, key string) (GuardState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		delete(s.entries, key)
+		return GuardState{}, nil
+	}
+
+	return e.state, nil
+}
+
+// Set stores the state for key for the duration of ttl.
+func (s *MemoryGuardStore) Set(_ context.Context, key string, state GuardState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]memoryGuardEntry)
+	}
+
+	s.entries[key] = memoryGuardEntry{state: state, expiresAt: time.Now().Add(ttl)}
+
+	return nil
+}
+
+// AddFailure counts a failure for key under the store's lock and returns the new state.
+func (s *MemoryGuardStore) AddFailure(_ context.Context, key string, f GuardFailure) (GuardState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.entries == nil {
+		s.entries = make(map[string]memoryGuardEntry)
+	}
+
+	var state GuardState
+	if e, ok := s.entries[key]; ok && !time.Now().After(e.expiresAt) {
+		state = e.state
+	}
+
+	state.Failures++
+	state.LastFailure = f.At
+
+	ttl := f.TTL
+	if f.LockThreshold > 0 && state.Failures >= f.LockThreshold {
+		state.LockedUntil = f.LockedUntil
+		ttl = f.LockTTL
+	}
+
+	s.entries[key] = memoryGuardEntry{state: state, expiresAt: time.Now().Add(ttl)}
+
+	return state, nil
+}
+
+// Delete removes the state stored for key.
+func (s *MemoryGuardStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	return nil
+}
+
+// BruteForceGuard throttles repeated failed logins per account and IP address.
+// After FreeAttempts failures, each further attempt must wait BaseDelay, doubling with every failure up to MaxDelay;
+// after LockoutThreshold failures the pair is locked out for LockoutDuration. Failure history is forgotten after
+// Window without failures, or on a successful login.
+type BruteForceGuard struct {
+	Store            GuardStore
+	FreeAttempts     int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	Window           time.Duration
+	now              func() time.Time
+}
+
+// NewBruteForceGuard creates a BruteForceGuard with sensible defaults: 3 free attempts, delays from 1 second up
+// to 5 minutes, lockout for 30 minutes after 10 failures, and a one hour memory window.
+// Parameters:
+// - store: The GuardStore keeping failure history. A MemoryGuardStore is used if nil.
+// Returns a pointer to the new BruteForceGuard.
+func NewBruteForceGuard(store GuardStore) *BruteForceGuard {
+	if store == nil {
+		store = &MemoryGuardStore{}
+	}
+
+	return &BruteForceGuard{
+		Store:            store,
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  30 * time.Minute,
+		Window:           time.Hour,
+	}
+}
+
+// Check reports whether a login attempt may proceed. Call it before verifying credentials.
+// Parameters:
+// - ctx: The context passed to the store.
+// - account: The account identifier, e.g. a normalized username or email.
+// - ip: The client IP address.
+// Returns a *ThrottleError if the attempt must wait, an error from the store, or nil if the attempt may proceed.
+func (g *BruteForceGuard) Check(ctx context.Context, account, ip string) error {
+	state, err := g.Store.Get(ctx, guardKey(account, ip))
+	if err != nil {
+		return err
+	}
+
+	return g.throttle(state)
+}
+
+// Fail records a failed login attempt.
+// Parameters:
+// - ctx: The context passed to the store.
+// - account: The account identifier.
+// - ip: The client IP address.
+// Returns a *ThrottleError describing the wait imposed on the next attempt, an error from the store, or nil if no wait applies.
+func (g *BruteForceGuard) Fail(ctx context.Context, account, ip string) error {
+	now := g.clock()
+
+	lockTTL := g.Window
+	if g.LockoutDuration > lockTTL {
+		lockTTL = g.LockoutDuration
+	}
+
+	state, err := g.Store.AddFailure(ctx, guardKey(account, ip), GuardFailure{
+		At:            now,
+		TTL:           g.Window,
+		LockThreshold: g.LockoutThreshold,
+		LockedUntil:   now.Add(g.LockoutDuration),
+		LockTTL:       lockTTL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return g.throttle(state)
+}
+
+// Succeed clears the failure history after a successful login.
+// Parameters:
+// - ctx: The context passed to the store.
+// - account: The account identifier.
+// - ip: The client IP address.
+// Returns an error from the store, if any.
+func (g *BruteForceGuard) Succeed(ctx context.Context, account, ip string) error {
+	return g.Store.Delete(ctx, guardKey(account, ip))
+}
+
+// throttle computes the wait imposed by state, if any.
+func (g *BruteForceGuard) throttle(state GuardState) error {
+	now := g.clock()
+
+	if now.Before(state.LockedUntil) {
+		return &ThrottleError{RetryAfter: state.LockedUntil.Sub(now), Locked: true}
+	}
+
+	excess := state.Failures - g.FreeAttempts
+	if excess <= 0 {
+		return nil
+	}
+
+	// stop doubling before the delay overflows, which would happen after a few dozen failures without a MaxDelay
+	delay := g.BaseDelay
+	for i := 1; i < excess && (g.MaxDelay <= 0 || delay < g.MaxDelay) && delay <= math.MaxInt64/2; i++ {
+		delay *= 2
+	}
+	if g.MaxDelay > 0 && delay > g.MaxDelay {
+		delay = g.MaxDelay
+	}
+
+	if until := state.LastFailure.Add(delay); now.Before(until) {
+		return &ThrottleError{RetryAfter: until.Sub(now)}
+	}
+
+	return nil
+}
+
+// clock returns the current time, overridable in tests.
+func (g *BruteForceGuard) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+
+	return time.Now()
+}
+
+// guardKey combines an account and IP address into a store key.
+func guardKey(account, ip string) string {
+	return "bruteforce:" + strconv.Quote(account) + ":" + ip
+}
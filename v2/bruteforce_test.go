@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBruteForceGuard_Delays(t *testing.T) {
+	now := time.Now()
+	guard := NewBruteForceGuard(nil)
+	guard.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := guard.Fail(ctx, "ann", "10.0.0.1"); err != nil {
+			t.Fatalf("attempt %d: expected free attempt, got %v", i+1, err)
+		}
+	}
+
+	expectedDelays := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	for i, expected := range expectedDelays {
+		err := guard.Fail(ctx, "ann", "10.0.0.1")
+
+		var throttleErr *ThrottleError
+		if !errors.As(err, &throttleErr) {
+			t.Fatalf("failure %d: expected *ThrottleError, got %v", i+4, err)
+		}
+		if throttleErr.RetryAfter != expected {
+			t.Errorf("failure %d: expected delay %s, got %s", i+4, expected, throttleErr.RetryAfter)
+		}
+
+		now = now.Add(expected)
+	}
+
+	if err := guard.Check(ctx, "ann", "10.0.0.1"); err != nil {
+		t.Errorf("expected attempt to be allowed after waiting, got %v", err)
+	}
+
+	if err := guard.Check(ctx, "ann", "10.0.0.2"); err != nil {
+		t.Errorf("expected other IP to be unaffected, got %v", err)
+	}
+
+	_ = guard.Succeed(ctx, "ann", "10.0.0.1")
+	if err := guard.Fail(ctx, "ann", "10.0.0.1"); err != nil {
+		t.Errorf("expected history to be cleared after success, got %v", err)
+	}
+}
+
+func TestBruteForceGuard_Lockout(t *testing.T) {
+	now := time.Now()
+	guard := NewBruteForceGuard(&MemoryGuardStore{})
+	guard.now = func() time.Time { return now }
+	guard.LockoutThreshold = 5
+	ctx := context.Background()
+
+	var err error
+	for i := 0; i < 5; i++ {
+		err = guard.Fail(ctx, "bob", "10.0.0.1")
+	}
+
+	var throttleErr *ThrottleError
+	if !errors.As(err, &throttleErr) || !throttleErr.Locked {
+		t.Fatalf("expected lockout, got %v", err)
+	}
+
+	now = now.Add(29 * time.Minute)
+	if err := guard.Check(ctx, "bob", "10.0.0.1"); !errors.As(err, &throttleErr) || !throttleErr.Locked {
+		t.Errorf("expected account to still be locked, got %v", err)
+	}
+}
+
+func TestBruteForceGuard_ConcurrentFailures(t *testing.T) {
+	guard := NewBruteForceGuard(nil)
+	guard.LockoutThreshold = 0
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = guard.Fail(ctx, "ann", "10.0.0.1")
+		}()
+	}
+	wg.Wait()
+
+	if state, _ := guard.Store.Get(ctx, guardKey("ann", "10.0.0.1")); state.Failures != 50 {
+		t.Errorf("expected every concurrent failure counted, got %d", state.Failures)
+	}
+}
+
+func TestBruteForceGuard_UnboundedDelay(t *testing.T) {
+	now := time.Now()
+	guard := NewBruteForceGuard(nil)
+	guard.now = func() time.Time { return now }
+	guard.MaxDelay = 0
+
+	err := guard.throttle(GuardState{Failures: 200, LastFailure: now})
+
+	var throttleErr *ThrottleError
+	if !errors.As(err, &throttleErr) || throttleErr.RetryAfter <= 0 {
+		t.Errorf("expected a positive delay without MaxDelay, got %v", err)
+	}
+}
+
+func TestTools_ErrorJSONThrottleError(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, &ThrottleError{RetryAfter: 1500 * time.Millisecond})
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+
+	if rr.Header().Get("Retry-After") != "2" {
+		t.Errorf("expected Retry-After 2, got %q", rr.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var canonicalJSONTests = []struct {
+	name     string
+	data     interface{}
+	expected string
+}{
+	{name: "sorted keys", data: map[string]interface{}{"b": 1, "a": []int{3, 2}, "c": nil}, expected: `{"a":[3,2],"b":1,"c":null}`},
+	{name: "struct", data: struct {
+		Zeta  bool   `json:"zeta"`
+		Alpha string `json:"alpha"`
+	}{true, "x"}, expected: `{"alpha":"x","zeta":true}`},
+	{name: "utf-16 key order", data: map[string]int{"\U0001F600": 1, "דּ": 2, "a": 3}, expected: "{\"a\":3,\"\U0001F600\":1,\"דּ\":2}"},
+	{name: "numbers", data: []float64{1.0, -0.0, 1e21, 1e-7, 0.000001, 123.456, 1e20, -1.5e-9}, expected: `[1,0,1e+21,1e-7,0.000001,123.456,100000000000000000000,-1.5e-9]`},
+	{name: "string escapes", data: "<a href=\"x\"> \t\x01é</a>", expected: "\"<a href=\\\"x\\\"> \\t\\u0001é</a>\""},
+	{name: "nested", data: map[string]interface{}{"outer": map[string]interface{}{"y": 2, "x": 1}}, expected: `{"outer":{"x":1,"y":2}}`},
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, e := range canonicalJSONTests {
+		out, err := CanonicalJSON(e.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, out)
+		}
+	}
+}
+
+func TestTools_WriteCanonicalJSON(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	err := testTools.WriteCanonicalJSON(rr, http.StatusCreated, map[string]interface{}{"b": "<", "a": 1}, http.Header{"Etag": {`"1"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"a":1,"b":"<"}` || rr.Header().Get("ETag") != `"1"` {
+		t.Errorf("unexpected response %d %s %v", rr.Code, rr.Body.String(), rr.Header())
+	}
+}
+
+func TestTools_WriteCanonicalJSONVersioned(t *testing.T) {
+	testTools := Tools{Serializers: &VersionedSerializers{}, Codecs: newTestCodec()}
+	RegisterSerializer(testTools.Serializers, "v2", func(u versionTestUser) interface{} {
+		return map[string]interface{}{"name": u.FirstName + " " + u.LastName, "id": u.ID}
+	})
+
+	handler := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteCanonicalJSON(w, http.StatusOK, JSONResponse{Data: versionTestUser{ID: 1, FirstName: "Ann", LastName: "Lee"}})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v2/users", nil))
+	if rr.Body.String() != `{"ok":true,"result":{"id":1,"name":"Ann Lee"},"status":200}` {
+		t.Errorf("expected the versioned shape canonicalized, got %s", rr.Body.String())
+	}
+}
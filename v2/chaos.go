@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChaosOptions configures ChaosMiddleware. Rates are fractions of requests, between 0 and 1, drawn independently
+// for each request.
+// Fields:
+// - EnvVar: The environment variable enabling the middleware, with a value such as "1", "true" or "on". Defaults
+// to "TOOLKIT_CHAOS". It is read when the middleware is created.
+// - LatencyRate: The fraction of requests delayed.
+// - MinLatency: The shortest delay added. Defaults to 100 milliseconds.
+// - MaxLatency: The longest delay added. Defaults to 2 seconds.
+// - ErrorRate: The fraction of requests answered with an error instead of reaching the handler.
+// - ErrorStatuses: The statuses of injected errors, one picked at random. Defaults to 500, 502 and 503.
+// - DropRate: The fraction of requests whose connection is closed without a response.
+// - Skip: If set, requests it returns true for are left alone, e.g. health checks.
+type ChaosOptions struct {
+	EnvVar        string
+	LatencyRate   float64
+	MinLatency    time.Duration
+	MaxLatency    time.Duration
+	ErrorRate     float64
+	ErrorStatuses []int
+	DropRate      float64
+	Skip          func(r *http.Request) bool
+}
+
+// ChaosMiddleware injects faults into a sample of requests, so teams can test how their clients cope with slow
+// responses, server errors and dropped connections. It does nothing unless the environment variable named by
+// EnvVar is set when it is created, so it can stay in the middleware chain and be enabled in staging only.
+// Requests with injected faults carry an "X-Chaos-Injected" response header naming them, when a response is sent.
+// Injected errors are not sent to Tools.ErrorReporter.
+// Parameters:
+// - opts: Optional ChaosOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) ChaosMiddleware(opts ...ChaosOptions) func(http.Handler) http.Handler {
+	var o ChaosOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.EnvVar == "" {
+		o.EnvVar = "TOOLKIT_CHAOS"
+	}
+	if o.MinLatency <= 0 {
+		o.MinLatency = 100 * time.Millisecond
+	}
+	if o.MaxLatency <= 0 {
+		o.MaxLatency = max(2*time.Second, o.MinLatency)
+	}
+	o.MaxLatency = max(o.MaxLatency, o.MinLatency)
+	if len(o.ErrorStatuses) == 0 {
+		o.ErrorStatuses = []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}
+	}
+
+	if !chaosEnabled(os.Getenv(o.EnvVar)) {
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	hit := func(rate float64) bool {
+		return rate > 0 && rand.Float64() < rate
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if o.Skip != nil && o.Skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if hit(o.DropRate) {
+				if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+					_ = conn.Close()
+					return
+				}
+				panic(http.ErrAbortHandler)
+			}
+
+			if hit(o.LatencyRate) {
+				delay := o.MinLatency + time.Duration(rand.Int63n(int64(o.MaxLatency-o.MinLatency)+1))
+				w.Header().Add("X-Chaos-Injected", "latency="+strconv.FormatInt(delay.Milliseconds(), 10)+"ms")
+
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			if hit(o.ErrorRate) {
+				status := o.ErrorStatuses[rand.Intn(len(o.ErrorStatuses))]
+				w.Header().Add("X-Chaos-Injected", "error")
+				_ = t.WriteJSON(w, status, JSONResponse{Error: true, Message: "injected fault: " + strings.ToLower(http.StatusText(status))})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// chaosEnabled reports whether an environment value turns chaos on.
+func chaosEnabled(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+
+	return false
+}
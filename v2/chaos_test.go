@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_ChaosMiddleware(t *testing.T) {
+	var testTools Tools
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	var tests = []struct {
+		name     string
+		env      string
+		opts     ChaosOptions
+		status   int
+		injected string
+		minTime  time.Duration
+	}{
+		{"disabled", "", ChaosOptions{ErrorRate: 1}, 200, "", 0},
+		{"disabled by value", "off", ChaosOptions{ErrorRate: 1}, 200, "", 0},
+		{"errors", "true", ChaosOptions{ErrorRate: 1, ErrorStatuses: []int{502}}, 502, "error", 0},
+		{"latency", "1", ChaosOptions{LatencyRate: 1, MinLatency: 30 * time.Millisecond, MaxLatency: 40 * time.Millisecond}, 200, "latency=", 30 * time.Millisecond},
+		{"zero rates", "on", ChaosOptions{}, 200, "", 0},
+		{"skipped", "on", ChaosOptions{ErrorRate: 1, Skip: func(r *http.Request) bool { return true }}, 200, "", 0},
+		{"custom variable", "yes", ChaosOptions{EnvVar: "APP_CHAOS", ErrorRate: 1, ErrorStatuses: []int{500}}, 500, "error", 0},
+	}
+
+	for _, e := range tests {
+		envVar := e.opts.EnvVar
+		if envVar == "" {
+			envVar = "TOOLKIT_CHAOS"
+		}
+		t.Setenv(envVar, e.env)
+
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		testTools.ChaosMiddleware(e.opts)(ok).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if got := rr.Header().Get("X-Chaos-Injected"); !strings.HasPrefix(got, e.injected) || (e.injected == "") != (got == "") {
+			t.Errorf("%s: expected injected %q, got %q", e.name, e.injected, got)
+		}
+		if elapsed := time.Since(start); elapsed < e.minTime {
+			t.Errorf("%s: expected a delay of at least %s, got %s", e.name, e.minTime, elapsed)
+		}
+	}
+
+	// dropped connections reach the client as errors
+	t.Setenv("TOOLKIT_CHAOS", "1")
+	srv := httptest.NewServer(testTools.ChaosMiddleware(ChaosOptions{DropRate: 1})(ok))
+	defer srv.Close()
+	if _, err := srv.Client().Get(srv.URL); err == nil {
+		t.Error("expected the connection to be dropped")
+	}
+}
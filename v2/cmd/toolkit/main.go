@@ -0,0 +1,411 @@
+// Command toolkit runs common operations of the toolkit library from the command line, with the same code paths
+// as applications, for ops tasks and scripts:
+//
+//	toolkit key [-id ID] [-bytes 32] [-format hex|base64]
+//	toolkit token [-length 32]
+//	toolkit verification-token -purpose PURPOSE -subject SUBJECT [-ttl 24h] [-secret-env TOOLKIT_SECRET]
+//	toolkit hash [-alg sha256,md5] FILE...
+//	toolkit clean-uploads -dir DIR [-older-than 720h] [-match PATTERN]... [-ignore FILE] [-dry-run]
+//	toolkit purge-trash -root DIR
+//	toolkit webhook -url URL [-secret-env TOOLKIT_SECRET]
+//
+// Secrets are read from an environment variable rather than a flag, so they do not show up in process listings.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thiagoadsix/toolkit/v2"
+)
+
+// command is a subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error
+}
+
+// commands are the subcommands, in the order of the usage message.
+var commands = []command{
+	{"key", "generate a random key for a Keyring, Encrypt or signing", runKey},
+	{"token", "generate a random token with Tools.RandomString", runToken},
+	{"verification-token", "issue a signed VerificationTokens token, e.g. a password reset link", runVerificationToken},
+	{"hash", "print the checksums of files", runHash},
+	{"clean-uploads", "delete old uploaded files, selected with glob patterns", runCleanUploads},
+	{"purge-trash", "remove the expired files of a LocalFileStore trash", runPurgeTrash},
+	{"webhook", "send a test ExportWebhook notification", runWebhook},
+}
+
+// errUsage reports invalid arguments, after the usage was printed.
+var errUsage = errors.New("usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the subcommand named by args[0], returning the exit code: 0 on success, 1 on failure, 2 for invalid
+// arguments.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		return 2
+	}
+
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+
+		flags := flag.NewFlagSet("toolkit "+c.name, flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		err := c.run(ctx, flags, args[1:], stdout)
+		switch {
+		case err == nil:
+			return 0
+		case errors.Is(err, flag.ErrHelp), errors.Is(err, errUsage):
+			return 2
+		}
+		fmt.Fprintf(stderr, "toolkit %s: %v\n", c.name, err)
+		return 1
+	}
+
+	fmt.Fprintf(stderr, "toolkit: unknown command %q\n", args[0])
+	usage(stderr)
+	return 2
+}
+
+// usage lists the subcommands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: toolkit <command> [flags]\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-20s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun toolkit <command> -h for the flags of a command.")
+}
+
+// parse parses the flags, printing the usage and returning errUsage for positional arguments unless allowed.
+func parse(flags *flag.FlagSet, args []string, positional bool) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if !positional && flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected argument %q\n", flags.Arg(0))
+		flags.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// required prints the usage and returns errUsage if a flag is empty.
+func required(flags *flag.FlagSet, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if values[name] == "" {
+			fmt.Fprintf(flags.Output(), "flag -%s is required\n", name)
+			flags.Usage()
+			return errUsage
+		}
+	}
+
+	return nil
+}
+
+// secretFromEnv reads a secret from the environment variable name.
+func secretFromEnv(name string) ([]byte, error) {
+	secret := os.Getenv(name)
+	if secret == "" {
+		return nil, fmt.Errorf("the secret must be set in $%s", name)
+	}
+
+	return []byte(secret), nil
+}
+
+// runKey prints a random key with its ID, validated as NewKeyring does.
+func runKey(_ context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	id := flags.String("id", time.Now().UTC().Format("2006-01"), "the key ID, for a Keyring")
+	size := flags.Int("bytes", 32, "the key size: 16, 24 or 32 bytes")
+	format := flags.String("format", "hex", "the output encoding: hex or base64")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+
+	secret := make([]byte, *size)
+	if _, err := rand.Read(secret); err != nil {
+		return err
+	}
+	// validated as the Keyring will, so a key that prints is a key that loads
+	if _, err := toolkit.NewKeyring(toolkit.Key{ID: *id, Secret: secret}); err != nil {
+		return err
+	}
+
+	switch *format {
+	case "hex":
+		fmt.Fprintf(stdout, "%s %s\n", *id, hex.EncodeToString(secret))
+	case "base64":
+		fmt.Fprintf(stdout, "%s %s\n", *id, base64.StdEncoding.EncodeToString(secret))
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	return nil
+}
+
+// runToken prints a random token.
+func runToken(_ context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	length := flags.Int("length", 32, "the token length, in characters")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+	if *length <= 0 {
+		return fmt.Errorf("invalid length %d", *length)
+	}
+
+	var tools toolkit.Tools
+	fmt.Fprintln(stdout, tools.RandomString(*length))
+
+	return nil
+}
+
+// runVerificationToken prints a signed verification token.
+func runVerificationToken(_ context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	purpose := flags.String("purpose", "", "what the token is for, e.g. password-reset")
+	subject := flags.String("subject", "", "who the token is for, e.g. a user ID")
+	ttl := flags.Duration("ttl", 24*time.Hour, "how long the token stays valid")
+	secretEnv := flags.String("secret-env", "TOOLKIT_SECRET", "the environment variable holding the signing secret")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+	if err := required(flags, map[string]string{"purpose": *purpose, "subject": *subject}); err != nil {
+		return err
+	}
+
+	secret, err := secretFromEnv(*secretEnv)
+	if err != nil {
+		return err
+	}
+
+	token, err := toolkit.NewVerificationTokens(secret, nil).Generate(*purpose, *subject, *ttl)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, token)
+
+	return nil
+}
+
+// runHash prints the digests of files, computed with a HashingReader.
+func runHash(_ context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	algs := flags.String("alg", "sha256", "comma-separated algorithms: md5, sha1, sha256, sha512, crc32c")
+	if err := parse(flags, args, true); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(flags.Output(), "no files given")
+		flags.Usage()
+		return errUsage
+	}
+
+	var list []toolkit.HashAlgorithm
+	for _, a := range strings.Split(*algs, ",") {
+		list = append(list, toolkit.HashAlgorithm(strings.TrimSpace(a)))
+	}
+
+	for _, name := range flags.Args() {
+		if err := hashFile(stdout, name, list); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hashFile prints the digests of a file, one line per algorithm, in the format of sha256sum.
+func hashFile(stdout io.Writer, name string, algs []toolkit.HashAlgorithm) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hr, err := toolkit.NewHashingReader(f, algs...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.Discard, hr); err != nil {
+		return err
+	}
+
+	for _, alg := range algs {
+		if len(algs) > 1 {
+			fmt.Fprintf(stdout, "%s ", alg)
+		}
+		fmt.Fprintf(stdout, "%s  %s\n", hr.Hex(alg), name)
+	}
+
+	return nil
+}
+
+// patterns collects a repeatable flag.
+type patterns []string
+
+// String returns the patterns, comma-separated.
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+// Set adds a pattern.
+func (p *patterns) Set(v string) error { *p = append(*p, v); return nil }
+
+// runCleanUploads deletes the files below a directory that were not modified recently and that the patterns
+// select, with Tools.DeleteFile.
+func runCleanUploads(ctx context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	dir := flags.String("dir", "", "the upload directory")
+	olderThan := flags.Duration("older-than", 30*24*time.Hour, "delete files last modified longer ago than this")
+	var match patterns
+	flags.Var(&match, "match", "a glob pattern selecting the files to delete, e.g. '**/*.tmp'; repeatable; default all files")
+	ignore := flags.String("ignore", "", "an ignore file listing the files to keep, in .gitignore syntax")
+	dryRun := flags.Bool("dry-run", false, "list the files without deleting them")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+	if err := required(flags, map[string]string{"dir": *dir}); err != nil {
+		return err
+	}
+
+	var filter toolkit.FileFilter
+	var err error
+	if len(match) > 0 {
+		if filter.Include, err = toolkit.NewFileMatcher(match...); err != nil {
+			return err
+		}
+	}
+	if *ignore != "" {
+		if filter.Exclude, err = toolkit.LoadIgnoreFile(*ignore); err != nil {
+			return err
+		}
+	}
+
+	var tools toolkit.Tools
+	cutoff := time.Now().Add(-*olderThan)
+	deleted, freed := 0, int64(0)
+
+	err = filepath.WalkDir(*dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(*dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !filter.Allows(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			return err
+		}
+
+		if !*dryRun {
+			if err := tools.DeleteFile(ctx, p); err != nil {
+				return err
+			}
+		}
+		deleted++
+		freed += info.Size()
+		fmt.Fprintln(stdout, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	verb := "deleted"
+	if *dryRun {
+		verb = "would delete"
+	}
+	fmt.Fprintf(stdout, "%s %d files, %d bytes\n", verb, deleted, freed)
+
+	return nil
+}
+
+// runPurgeTrash removes the expired files of a LocalFileStore's trash.
+func runPurgeTrash(ctx context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	root := flags.String("root", "", "the root directory of the LocalFileStore")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+	if err := required(flags, map[string]string{"root": *root}); err != nil {
+		return err
+	}
+
+	purged, err := toolkit.NewLocalFileStore(*root).PurgeTrash(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "purged %d files\n", purged)
+
+	return nil
+}
+
+// runWebhook posts a sample finished ExportJob to a webhook, signed as ExportWebhook signs it.
+func runWebhook(ctx context.Context, flags *flag.FlagSet, args []string, stdout io.Writer) error {
+	hookURL := flags.String("url", "", "the webhook URL")
+	secretEnv := flags.String("secret-env", "TOOLKIT_SECRET", "the environment variable holding the signing secret, if any")
+	if err := parse(flags, args, false); err != nil {
+		return err
+	}
+	if err := required(flags, map[string]string{"url": *hookURL}); err != nil {
+		return err
+	}
+
+	hook := &toolkit.ExportWebhook{URL: *hookURL, Secret: []byte(os.Getenv(*secretEnv))}
+	now := time.Now().UTC()
+	job := toolkit.ExportJob{
+		ID:         "test",
+		Name:       "Test notification",
+		Filename:   "test.csv",
+		Status:     toolkit.ExportDone,
+		CreatedAt:  now,
+		StartedAt:  now,
+		FinishedAt: now,
+	}
+
+	if err := hook.NotifyExport(ctx, job); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "delivered to %s\n", *hookURL)
+
+	return nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thiagoadsix/toolkit/v2"
+)
+
+// runCLI runs the command line, returning the exit code and output.
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr)
+
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRun_Usage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"no command", nil, 2, "Commands:"},
+		{"unknown command", []string{"migrate"}, 2, `unknown command "migrate"`},
+		{"help flag", []string{"token", "-h"}, 2, "-length"},
+		{"unexpected argument", []string{"token", "extra"}, 2, `unexpected argument "extra"`},
+		{"missing flag", []string{"purge-trash"}, 2, "flag -root is required"},
+		{"failure", []string{"key", "-bytes", "7"}, 1, "toolkit key: "},
+	}
+
+	for _, e := range tests {
+		code, _, stderr := runCLI(e.args...)
+		if code != e.code || !strings.Contains(stderr, e.want) {
+			t.Errorf("%s: expected %d and %q, got %d and %q", e.name, e.code, e.want, code, stderr)
+		}
+	}
+}
+
+func TestRun_KeyAndToken(t *testing.T) {
+	code, out, _ := runCLI("key", "-id", "2026-10")
+	fields := strings.Fields(out)
+	if code != 0 || len(fields) != 2 || fields[0] != "2026-10" || len(fields[1]) != 64 {
+		t.Errorf("expected an ID and a 32-byte hex key, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI("key", "-bytes", "16", "-format", "base64")
+	if code != 0 || len(strings.Fields(out)[1]) != 24 {
+		t.Errorf("expected a 16-byte base64 key, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI("token", "-length", "20")
+	if code != 0 || len(strings.TrimSpace(out)) != 20 {
+		t.Errorf("expected a 20-character token, got %d %q", code, out)
+	}
+}
+
+func TestRun_VerificationToken(t *testing.T) {
+	t.Setenv("TEST_TOOLKIT_SECRET", "0123456789abcdef0123456789abcdef")
+
+	code, out, stderr := runCLI("verification-token", "-purpose", "password-reset", "-subject", "u1", "-secret-env", "TEST_TOOLKIT_SECRET")
+	if code != 0 {
+		t.Fatalf("expected success, got %d: %s", code, stderr)
+	}
+
+	v := toolkit.NewVerificationTokens([]byte("0123456789abcdef0123456789abcdef"), nil)
+	claims, err := v.Validate(context.Background(), strings.TrimSpace(out), "password-reset")
+	if err != nil || claims.Subject != "u1" {
+		t.Errorf("expected a token the library accepts, got %v %v", claims, err)
+	}
+
+	if code, _, stderr := runCLI("verification-token", "-purpose", "p", "-subject", "s", "-secret-env", "TEST_TOOLKIT_UNSET"); code != 1 || !strings.Contains(stderr, "$TEST_TOOLKIT_UNSET") {
+		t.Errorf("expected a missing secret to fail, got %d %q", code, stderr)
+	}
+}
+
+func TestRun_Hash(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "a.txt")
+	_ = os.WriteFile(name, []byte("hello"), 0o644)
+
+	code, out, _ := runCLI("hash", name)
+	if code != 0 || out != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  "+name+"\n" {
+		t.Errorf("expected the sha256sum line, got %d %q", code, out)
+	}
+
+	code, out, _ = runCLI("hash", "-alg", "md5,crc32c", name)
+	if code != 0 || !strings.Contains(out, "md5 5d41402abc4b2a76b9719d911017c592  ") || !strings.Contains(out, "crc32c ") {
+		t.Errorf("expected a line per algorithm, got %d %q", code, out)
+	}
+
+	if code, _, _ := runCLI("hash", "-alg", "sha3", name); code != 1 {
+		t.Errorf("expected an unknown algorithm to fail, got %d", code)
+	}
+}
+
+func TestRun_CleanUploads(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"a.tmp", "keep/b.tmp", "c.pdf", "new.tmp"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, []byte("data"), 0o644)
+		if name != "new.tmp" {
+			_ = os.Chtimes(p, old, old)
+		}
+	}
+	ignore := filepath.Join(t.TempDir(), ".cleanignore")
+	_ = os.WriteFile(ignore, []byte("keep/\n"), 0o644)
+
+	args := []string{"clean-uploads", "-dir", dir, "-older-than", "24h", "-match", "*.tmp", "-ignore", ignore}
+
+	code, out, stderr := runCLI(append(args, "-dry-run")...)
+	if code != 0 || !strings.Contains(out, "would delete 1 files, 4 bytes") {
+		t.Fatalf("expected a dry run listing one file, got %d %q %q", code, out, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.tmp")); err != nil {
+		t.Fatal("expected a dry run to keep the files")
+	}
+
+	code, out, _ = runCLI(args...)
+	if code != 0 || !strings.Contains(out, filepath.Join(dir, "a.tmp")) {
+		t.Errorf("expected a.tmp deleted, got %d %q", code, out)
+	}
+	for name, exists := range map[string]bool{"a.tmp": false, "keep/b.tmp": true, "c.pdf": true, "new.tmp": true} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); (err == nil) != exists {
+			t.Errorf("%s: expected exists=%v", name, exists)
+		}
+	}
+}
+
+func TestRun_PurgeTrash(t *testing.T) {
+	code, out, stderr := runCLI("purge-trash", "-root", t.TempDir())
+	if code != 0 || out != "purged 0 files\n" {
+		t.Errorf("expected an empty trash purged, got %d %q %q", code, out, stderr)
+	}
+}
+
+func TestRun_Webhook(t *testing.T) {
+	t.Setenv("TEST_TOOLKIT_SECRET", "hook-secret")
+
+	var signature, body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature-256")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer srv.Close()
+
+	code, out, stderr := runCLI("webhook", "-url", srv.URL, "-secret-env", "TEST_TOOLKIT_SECRET")
+	if code != 0 || !strings.Contains(out, "delivered") {
+		t.Fatalf("expected delivery, got %d %q %q", code, out, stderr)
+	}
+	if !strings.HasPrefix(signature, "sha256=") || !strings.Contains(body, `"status":"done"`) {
+		t.Errorf("expected a signed job, got %q %s", signature, body)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	if code, _, _ := runCLI("webhook", "-url", failing.URL); code != 1 {
+		t.Errorf("expected a failed delivery to fail, got %d", code)
+	}
+}
@@ -0,0 +1,194 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// EnvelopeCodec converts a JSONResponse envelope to the value marshaled for one envelope version.
+// Parameters:
+// - resp: The envelope, with its Data already converted by Tools.Serializers.
+// - status: The HTTP status code of the response.
+// Returns the value to marshal instead of resp.
+type EnvelopeCodec func(resp JSONResponse, status int) interface{}
+
+// VersionedCodec holds the shapes of the JSONResponse envelope by version, so the envelope WriteJSON and ErrorJSON
+// send can change while older clients keep receiving the shape they were written against. Register codecs before
+// serving.
+// The version of a response is taken from the request's Header when EnvelopeMiddleware is in use, then from the API
+// version of APIVersionMiddleware if a codec is registered for it, and then from Default.
+// Fields:
+// - Header: The request header selecting the envelope version. Defaults to "Envelope-Version".
+// - Default: The version used when the request selects none. If empty, or if it has no codec, the JSONResponse is
+// sent as is.
+type VersionedCodec struct {
+	Header  string
+	Default string
+
+	mu     sync.RWMutex
+	codecs map[string]EnvelopeCodec
+}
+
+// Register adds the codec of an envelope version.
+// Parameters:
+// - version: The envelope version, e.g. "2" or "v2".
+// - codec: The conversion of the envelope. A nil codec registers a version sending the JSONResponse as is, e.g. the
+// original "1", so EnvelopeMiddleware accepts it.
+func (c *VersionedCodec) Register(version string, codec EnvelopeCodec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.codecs == nil {
+		c.codecs = make(map[string]EnvelopeCodec)
+	}
+	c.codecs[normalizeVersion(version)] = codec
+}
+
+// lookup returns the codec of version and whether the version is registered.
+func (c *VersionedCodec) lookup(version string) (EnvelopeCodec, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	codec, ok := c.codecs[normalizeVersion(version)]
+	return codec, ok
+}
+
+// Encode converts an envelope for a version. Versions without a codec get resp unchanged.
+// Parameters:
+// - version: The envelope version.
+// - resp: The envelope.
+// - status: The HTTP status code of the response.
+// Returns the value to marshal.
+func (c *VersionedCodec) Encode(version string, resp JSONResponse, status int) interface{} {
+	if c == nil {
+		return resp
+	}
+
+	if codec, _ := c.lookup(version); codec != nil {
+		return codec(resp, status)
+	}
+
+	return resp
+}
+
+// header returns the request header selecting the envelope version.
+func (c *VersionedCodec) header() string {
+	if c.Header == "" {
+		return "Envelope-Version"
+	}
+
+	return c.Header
+}
+
+// EnvelopeMiddleware reads the envelope version requested in the Tools.Codecs header and passes it to WriteJSON
+// and ErrorJSON, which encode their JSONResponse envelopes with the version's codec. The version is echoed in the
+// response header. Requests for versions that are neither registered nor the Default are rejected with 400 Bad
+// Request. Without Tools.Codecs the middleware does nothing.
+// Returns the middleware.
+func (t *Tools) EnvelopeMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c := t.Codecs
+			if c == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := c.header()
+			version := normalizeVersion(r.Header.Get(header))
+			if version == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if _, ok := c.lookup(version); !ok && version != normalizeVersion(c.Default) {
+				_ = t.ErrorJSON(w, ErrUnsupportedVersion)
+				return
+			}
+
+			w.Header().Set(header, version)
+			next.ServeHTTP(&envelopeWriter{ResponseWriter: w, version: version}, r)
+		})
+	}
+}
+
+// envelopeWriter carries the request's envelope version to WriteJSON, which only sees the response writer.
+type envelopeWriter struct {
+	http.ResponseWriter
+	version string
+}
+
+// EnvelopeVersion returns the request's envelope version.
+func (ew *envelopeWriter) EnvelopeVersion() string {
+	return ew.version
+}
+
+// Flush implements http.Flusher when the wrapped writer supports it.
+func (ew *envelopeWriter) Flush() {
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom copies src through the wrapped writer, keeping its sendfile path for files.
+func (ew *envelopeWriter) ReadFrom(src io.Reader) (int64, error) {
+	return readFrom(ew.ResponseWriter, src)
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// writerEnvelopeVersion returns the envelope version carried by w or a writer it wraps.
+func writerEnvelopeVersion(w http.ResponseWriter) string {
+	for w != nil {
+		if ew, ok := w.(interface{ EnvelopeVersion() string }); ok {
+			return ew.EnvelopeVersion()
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	return ""
+}
+
+// encodeEnvelope applies t.Codecs to a JSONResponse envelope for the version selected for w. Other data is returned
+// unchanged.
+func (t *Tools) encodeEnvelope(w http.ResponseWriter, status int, data interface{}) interface{} {
+	if t.Codecs == nil {
+		return data
+	}
+
+	var resp JSONResponse
+	switch payload := data.(type) {
+	case JSONResponse:
+		resp = payload
+	case *JSONResponse:
+		if payload == nil {
+			return data
+		}
+		resp = *payload
+	default:
+		return data
+	}
+
+	version := writerEnvelopeVersion(w)
+	if version == "" {
+		if apiVersion := writerAPIVersion(w); apiVersion != "" {
+			if _, ok := t.Codecs.lookup(apiVersion); ok {
+				version = apiVersion
+			}
+		}
+	}
+	if version == "" {
+		version = t.Codecs.Default
+	}
+
+	return t.Codecs.Encode(version, resp, status)
+}
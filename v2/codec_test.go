@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// envelopeV2 is a second shape of the JSONResponse envelope.
+type envelopeV2 struct {
+	OK     bool              `json:"ok"`
+	Status int               `json:"status"`
+	Result interface{}       `json:"result,omitempty"`
+	Error  map[string]string `json:"error,omitempty"`
+}
+
+func newTestCodec() *VersionedCodec {
+	c := &VersionedCodec{}
+	c.Register("1", nil)
+	c.Register("v2", func(resp JSONResponse, status int) interface{} {
+		out := envelopeV2{OK: !resp.Error, Status: status, Result: resp.Data}
+		if resp.Error {
+			out.Error = map[string]string{"code": resp.Code, "message": resp.Message}
+		}
+		return out
+	})
+
+	return c
+}
+
+func TestTools_EnvelopeMiddleware(t *testing.T) {
+	testTools := Tools{Codecs: newTestCodec()}
+	testTools.Codecs.Default = "1"
+
+	h := testTools.EnvelopeMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			_ = testTools.ErrorJSON(w, &JSONError{Code: JSONErrSyntax, Message: "bad"})
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusOK, JSONResponse{Message: "ok", Data: map[string]int{"id": 7}})
+	}))
+
+	tests := []struct {
+		name    string
+		version string
+		target  string
+		status  int
+		want    string
+	}{
+		{"default", "", "/", http.StatusOK, `{"error":false,"message":"ok","data":{"id":7}}`},
+		{"explicit v1", "1", "/", http.StatusOK, `{"error":false,"message":"ok","data":{"id":7}}`},
+		{"v2", "v2", "/", http.StatusOK, `{"ok":true,"status":200,"result":{"id":7}}`},
+		{"v2 error", "2", "/?fail=1", http.StatusBadRequest, `{"ok":false,"status":400,"error":{"code":"json.syntax","message":"bad"}}`},
+		{"unsupported", "3", "/", http.StatusBadRequest, `{"error":true,"message":"unsupported API version"}`},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodGet, e.target, nil)
+		if e.version != "" {
+			req.Header.Set("Envelope-Version", e.version)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if !sameJSON(rr.Body.Bytes(), e.want) {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_WriteJSONEnvelopeSelection(t *testing.T) {
+	codec := newTestCodec()
+	testTools := Tools{Codecs: codec}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, &JSONResponse{Message: "ok"})
+	if !sameJSON(rr.Body.Bytes(), `{"error":false,"message":"ok"}`) {
+		t.Errorf("expected the envelope unchanged without a version, got %s", rr.Body.String())
+	}
+
+	codec.Default = "2"
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusCreated, JSONResponse{Message: "ok"})
+	if !sameJSON(rr.Body.Bytes(), `{"ok":true,"status":201}`) {
+		t.Errorf("expected the default version, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testTools.WriteJSON(rr, http.StatusOK, []int{1, 2})
+	if !sameJSON(rr.Body.Bytes(), `[1,2]`) {
+		t.Errorf("expected data other than an envelope unchanged, got %s", rr.Body.String())
+	}
+
+	codec.Default = ""
+	h := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONFiltered(w, r, http.StatusOK, JSONResponse{Data: map[string]string{"id": "a", "name": "b"}})
+	}))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v2/users?fields=id", nil))
+	if !sameJSON(rr.Body.Bytes(), `{"ok":true,"status":200,"result":{"id":"a"}}`) {
+		t.Errorf("expected the API version to select a registered codec, got %s", rr.Body.String())
+	}
+}
+
+func TestVersionedCodec_Encode(t *testing.T) {
+	var nilCodec *VersionedCodec
+	if got := nilCodec.Encode("2", JSONResponse{Message: "x"}, 200); got.(JSONResponse).Message != "x" {
+		t.Errorf("expected a nil codec to keep the envelope, got %v", got)
+	}
+
+	codec := newTestCodec()
+	if got, ok := codec.Encode("V2", JSONResponse{Error: true, Code: "c"}, 500).(envelopeV2); !ok || got.Error["code"] != "c" || got.Status != 500 {
+		t.Errorf("expected the v2 shape, got %v", got)
+	}
+	if _, ok := codec.Encode("9", JSONResponse{}, 200).(JSONResponse); !ok {
+		t.Error("expected an unknown version to keep the envelope")
+	}
+}
+
+// sameJSON reports whether data holds the same JSON value as want.
+func sameJSON(data []byte, want string) bool {
+	var a, b interface{}
+	if json.Unmarshal(data, &a) != nil || json.Unmarshal([]byte(want), &b) != nil {
+		return false
+	}
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+
+	return string(ab) == string(bb)
+}
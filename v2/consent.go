@@ -0,0 +1,284 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consent categories offered by default. Necessary cookies, such as the session, need no consent and are always
+// granted.
+const (
+	ConsentNecessary   = "necessary"
+	ConsentPreferences = "preferences"
+	ConsentAnalytics   = "analytics"
+	ConsentMarketing   = "marketing"
+)
+
+// Consent is a visitor's cookie consent, read by CookieConsent.Middleware.
+// Fields:
+// - Decided: Whether the visitor has answered the current version of the banner. Until then, only necessary
+// cookies are granted and the banner should be shown.
+// - Categories: The granted categories, sorted, besides "necessary".
+// - Version: The banner version the visitor answered.
+// - At: When the visitor answered.
+type Consent struct {
+	Decided    bool
+	Categories []string
+	Version    int
+	At         time.Time
+}
+
+// Granted reports whether the visitor has consented to a category. "necessary" is always granted.
+func (c Consent) Granted(category string) bool {
+	if category == ConsentNecessary {
+		return true
+	}
+
+	for _, granted := range c.Categories {
+		if granted == category {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CookieConsent records cookie consent in a first-party cookie and makes it available to handlers, templates and
+// middleware, so analytics and marketing code only runs once the visitor has agreed to it.
+// The cookie holds "<version>.<unix time>.<category>+<category>", e.g. "1.1718000000.analytics+preferences".
+// Fields:
+// - Categories: The categories offered, besides "necessary". Defaults to preferences, analytics and marketing.
+// Names may use lowercase letters, digits, '-' and '_'.
+// - Version: The version of the banner. Raising it, e.g. when a new tracker is added, asks every visitor again.
+// - CookieName: The cookie's name. Defaults to "cookie_consent".
+// - MaxAge: How long an answer is kept before asking again. Defaults to 180 days.
+// - Secure: Whether the cookie is only sent over HTTPS.
+// - Domain: The cookie's domain, e.g. to share consent across subdomains.
+// - HonorGPC: Treat "marketing" as refused for requests sending the Global Privacy Control signal (Sec-GPC: 1),
+// whatever the cookie says.
+type CookieConsent struct {
+	Categories []string
+	Version    int
+	CookieName string
+	MaxAge     time.Duration
+	Secure     bool
+	Domain     string
+	HonorGPC   bool
+}
+
+type consentContextKey struct{}
+
+// categories returns the offered categories.
+func (cc *CookieConsent) categories() []string {
+	if len(cc.Categories) > 0 {
+		return cc.Categories
+	}
+
+	return []string{ConsentPreferences, ConsentAnalytics, ConsentMarketing}
+}
+
+// cookieName returns the consent cookie's name.
+func (cc *CookieConsent) cookieName() string {
+	if cc.CookieName != "" {
+		return cc.CookieName
+	}
+
+	return "cookie_consent"
+}
+
+// maxAge returns how long an answer is kept.
+func (cc *CookieConsent) maxAge() time.Duration {
+	if cc.MaxAge > 0 {
+		return cc.MaxAge
+	}
+
+	return 180 * 24 * time.Hour
+}
+
+// Read returns the consent recorded in a request's cookie. Answers to an older banner version, expired answers
+// and unknown categories are ignored.
+func (cc *CookieConsent) Read(r *http.Request) Consent {
+	var consent Consent
+
+	if cookie, err := r.Cookie(cc.cookieName()); err == nil {
+		consent = cc.parse(cookie.Value)
+	}
+
+	if cc.HonorGPC && r.Header.Get("Sec-GPC") == "1" {
+		kept := consent.Categories[:0:0]
+		for _, c := range consent.Categories {
+			if c != ConsentMarketing {
+				kept = append(kept, c)
+			}
+		}
+		consent.Categories = kept
+	}
+
+	return consent
+}
+
+// parse decodes a cookie value, returning an undecided Consent if it is invalid or out of date.
+func (cc *CookieConsent) parse(value string) Consent {
+	parts := strings.SplitN(value, ".", 3)
+	if len(parts) != 3 {
+		return Consent{}
+	}
+
+	version, err1 := strconv.Atoi(parts[0])
+	at, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || version != cc.Version {
+		return Consent{}
+	}
+
+	consent := Consent{Decided: true, Version: version, At: time.Unix(at, 0)}
+	if time.Since(consent.At) > cc.maxAge() {
+		return Consent{}
+	}
+
+	if parts[2] != "" {
+		consent.Categories = cc.filter(strings.Split(parts[2], "+"))
+	}
+
+	return consent
+}
+
+// filter keeps the offered categories among granted, sorted and without duplicates.
+func (cc *CookieConsent) filter(granted []string) []string {
+	var out []string
+
+	for _, offered := range cc.categories() {
+		for _, g := range granted {
+			if g == offered {
+				out = append(out, offered)
+				break
+			}
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Save records the visitor's answer in the consent cookie.
+// Parameters:
+// - w: The http.ResponseWriter to set the cookie on.
+// - granted: The categories granted. Categories that are not offered are ignored, and none means only necessary
+// cookies.
+// Returns the recorded Consent.
+func (cc *CookieConsent) Save(w http.ResponseWriter, granted ...string) Consent {
+	consent := Consent{
+		Decided:    true,
+		Categories: cc.filter(granted),
+		Version:    cc.Version,
+		At:         time.Now().Truncate(time.Second),
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cc.cookieName(),
+		Value:    strconv.Itoa(consent.Version) + "." + strconv.FormatInt(consent.At.Unix(), 10) + "." + strings.Join(consent.Categories, "+"),
+		Path:     "/",
+		Domain:   cc.Domain,
+		MaxAge:   int(cc.maxAge().Seconds()),
+		Secure:   cc.Secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return consent
+}
+
+// Middleware reads the consent cookie and stores the Consent in the request context, where ConsentFromContext,
+// ConsentGranted, RequireConsent and the "consent" view helper read it.
+// Returns the middleware.
+func (cc *CookieConsent) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), consentContextKey{}, cc.Read(r))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Handler receives the banner's form, records the answer and redirects back. The form posts either "accept=all",
+// "reject=all", or the chosen "category" values, e.g. from checkboxes, and may name the page to return to in a
+// "redirect" field, a local path; otherwise the visitor returns to the Referer's path, or "/". Protect it with
+// CSRFMiddleware like any other form.
+// Returns the handler, which answers 405 Method Not Allowed to anything but POST.
+func (cc *CookieConsent) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case r.PostForm.Get("accept") == "all":
+			cc.Save(w, cc.categories()...)
+		case r.PostForm.Get("reject") == "all":
+			cc.Save(w)
+		default:
+			cc.Save(w, r.PostForm["category"]...)
+		}
+
+		http.Redirect(w, r, consentRedirect(r), http.StatusSeeOther)
+	}
+}
+
+// consentRedirect returns the local path to go back to after the banner is answered.
+func consentRedirect(r *http.Request) string {
+	target := r.PostForm.Get("redirect")
+	if target == "" {
+		if ref, err := url.Parse(r.Referer()); err == nil && (ref.Host == "" || ref.Host == r.Host) {
+			target = ref.RequestURI()
+		}
+	}
+
+	// only local paths, so the form cannot be used as an open redirect
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+
+	return target
+}
+
+// RequireConsent returns middleware running mw only for requests whose visitor granted category, e.g. to run
+// analytics middleware after consent. Other requests skip mw and go straight to the next handler. It reads the
+// Consent stored by CookieConsent.Middleware, which must run first.
+// Parameters:
+// - category: The category mw needs, e.g. ConsentAnalytics.
+// - mw: The middleware to gate.
+// Returns the gated middleware.
+func RequireConsent(category string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		gated := mw(next)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ConsentGranted(r.Context(), category) {
+				gated.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ConsentFromContext returns the Consent stored by CookieConsent.Middleware, or an undecided Consent.
+func ConsentFromContext(ctx context.Context) Consent {
+	consent, _ := ctx.Value(consentContextKey{}).(Consent)
+
+	return consent
+}
+
+// ConsentGranted reports whether the visitor of the current request granted a category.
+func ConsentGranted(ctx context.Context, category string) bool {
+	return ConsentFromContext(ctx).Granted(category)
+}
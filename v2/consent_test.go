@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCookieConsent_Read(t *testing.T) {
+	cc := &CookieConsent{Version: 2, HonorGPC: true}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	old := strconv.FormatInt(time.Now().Add(-200*24*time.Hour).Unix(), 10)
+
+	var tests = []struct {
+		name     string
+		cookie   string
+		gpc      bool
+		decided  bool
+		expected string
+	}{
+		{"no cookie", "", false, false, ""},
+		{"granted", "2." + now + ".analytics+marketing", false, true, "analytics,marketing"},
+		{"rejected", "2." + now + ".", false, true, ""},
+		{"unknown categories dropped", "2." + now + ".analytics+spyware+analytics", false, true, "analytics"},
+		{"old banner version", "1." + now + ".analytics", false, false, ""},
+		{"expired", "2." + old + ".analytics", false, false, ""},
+		{"garbage", "yes", false, false, ""},
+		{"global privacy control", "2." + now + ".analytics+marketing", true, true, "analytics"},
+	}
+
+	for _, e := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if e.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "cookie_consent", Value: e.cookie})
+		}
+		if e.gpc {
+			r.Header.Set("Sec-GPC", "1")
+		}
+
+		consent := cc.Read(r)
+		if consent.Decided != e.decided || strings.Join(consent.Categories, ",") != e.expected {
+			t.Errorf("%s: expected decided=%v %q, got %+v", e.name, e.decided, e.expected, consent)
+		}
+		if !consent.Granted(ConsentNecessary) {
+			t.Errorf("%s: expected necessary to always be granted", e.name)
+		}
+	}
+}
+
+func TestCookieConsent_Handler(t *testing.T) {
+	cc := &CookieConsent{Categories: []string{ConsentAnalytics, "support-chat"}}
+
+	var tests = []struct {
+		name     string
+		form     url.Values
+		referer  string
+		expected string
+		location string
+	}{
+		{"accept all", url.Values{"accept": {"all"}}, "http://example.com/pricing?plan=pro", "analytics+support-chat", "/pricing?plan=pro"},
+		{"reject all", url.Values{"reject": {"all"}, "category": {"analytics"}}, "", "", "/"},
+		{"chosen", url.Values{"category": {"support-chat", "marketing"}, "redirect": {"/docs"}}, "", "support-chat", "/docs"},
+		{"open redirect", url.Values{"accept": {"all"}, "redirect": {"//evil.example"}}, "", "analytics+support-chat", "/"},
+		{"foreign referer", url.Values{"accept": {"all"}}, "https://evil.example/x", "analytics+support-chat", "/"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/consent", strings.NewReader(e.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.referer != "" {
+			req.Header.Set("Referer", e.referer)
+		}
+
+		rr := httptest.NewRecorder()
+		cc.Handler().ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.location {
+			t.Errorf("%s: expected a redirect to %s, got %d %s", e.name, e.location, rr.Code, rr.Header().Get("Location"))
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || !strings.HasSuffix(cookies[0].Value, "."+e.expected) || !strings.HasPrefix(cookies[0].Value, "0.") {
+			t.Errorf("%s: unexpected cookie %v", e.name, cookies)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	cc.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/consent", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %d", rr.Code)
+	}
+}
+
+func TestRequireConsent(t *testing.T) {
+	cc := &CookieConsent{}
+
+	tracked := 0
+	analytics := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tracked++
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"page.html": `{{if not consent.Decided}}banner{{end}}{{if consent.Granted "analytics"}}tracker{{end}}`,
+	})
+	testTools := Tools{Templates: NewTemplates(dir)}
+
+	h := cc.Middleware()(RequireConsent(ConsentAnalytics, analytics)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.RenderTemplate(w, r, http.StatusOK, "page.html", nil)
+	})))
+
+	// first visit: no consent, banner shown, analytics skipped
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Body.String() != "banner" || tracked != 0 {
+		t.Errorf("expected the banner without tracking, got %q and %d", rr.Body.String(), tracked)
+	}
+
+	// after accepting analytics
+	saved := httptest.NewRecorder()
+	cc.Save(saved, ConsentAnalytics)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(saved.Result().Cookies()[0])
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Body.String() != "tracker" || tracked != 1 {
+		t.Errorf("expected tracking after consent, got %q and %d", rr.Body.String(), tracked)
+	}
+}
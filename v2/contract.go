@@ -0,0 +1,654 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContractViolation is a mismatch between a request or response and the OpenAPI document.
+// Fields:
+// - Method: The request method.
+// - Path: The request path.
+// - Direction: "request" or "response".
+// - Location: Where the mismatch is, e.g. "query.page" or "body.items[2].name".
+// - Message: What is wrong.
+type ContractViolation struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Direction string `json:"direction"`
+	Location  string `json:"location"`
+	Message   string `json:"message"`
+}
+
+// String describes the violation.
+func (v ContractViolation) String() string {
+	return fmt.Sprintf("%s %s: %s %s: %s", v.Method, v.Path, v.Direction, v.Location, v.Message)
+}
+
+// ContractOptions configures ContractMiddleware.
+// Fields:
+// - Fail: Reject requests that violate the document with 400 Bad Request, and replace responses that violate it
+// with 500 Internal Server Error. By default violations are only reported.
+// - OnViolation: Receives the violations of each request. Defaults to logging them with the log package.
+// - MaxBodySize: The largest request body validated, in bytes. Defaults to 10MB.
+type ContractOptions struct {
+	Fail        bool
+	OnViolation func(r *http.Request, violations []ContractViolation)
+	MaxBodySize int64
+}
+
+// contractDoc is the parsed part of an OpenAPI document needed for validation.
+type contractDoc struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+}
+
+// contractOperation is an OpenAPI operation object.
+type contractOperation struct {
+	Parameters  []contractParameter `json:"parameters"`
+	RequestBody *struct {
+		Required bool                            `json:"required"`
+		Content  map[string]contractMediaContent `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]contractMediaContent `json:"content"`
+	} `json:"responses"`
+}
+
+type contractParameter struct {
+	Name     string                 `json:"name"`
+	In       string                 `json:"in"`
+	Required bool                   `json:"required"`
+	Schema   map[string]interface{} `json:"schema"`
+}
+
+type contractMediaContent struct {
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// contractRoute is an operation with its parsed path template.
+type contractRoute struct {
+	method   string
+	segments []string
+	op       contractOperation
+}
+
+// ContractMiddleware validates requests and responses against an OpenAPI 3 document, to catch drift between the
+// document and the handlers during development and testing. Responses are buffered while they are checked, so it
+// is not meant for production traffic.
+// Requests are checked for their required path, query and header parameters, parameter types and JSON bodies;
+// responses for documented status codes and JSON bodies. Requests for paths not in the document are not checked.
+// Parameters:
+// - spec: The OpenAPI document as JSON, e.g. from a file or json.Marshal(api.Spec()).
+// - opts: Optional ContractOptions. Only the first value is used if multiple are provided.
+// Returns the middleware, or an error if the document cannot be parsed.
+func (t *Tools) ContractMiddleware(spec []byte, opts ...ContractOptions) (func(http.Handler) http.Handler, error) {
+	var o ContractOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = 10 << 20
+	}
+	if o.OnViolation == nil {
+		o.OnViolation = func(_ *http.Request, violations []ContractViolation) {
+			for _, v := range violations {
+				log.Printf("contract violation: %s", v)
+			}
+		}
+	}
+
+	var doc contractDoc
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document: %w", err)
+	}
+
+	var routes []contractRoute
+	for path, item := range doc.Paths {
+		var shared []contractParameter
+		if raw, ok := item["parameters"]; ok {
+			_ = json.Unmarshal(raw, &shared)
+		}
+
+		for method, raw := range item {
+			if method == "parameters" || method == "summary" || method == "description" || method == "servers" {
+				continue
+			}
+
+			var op contractOperation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				return nil, fmt.Errorf("invalid operation %s %s: %w", method, path, err)
+			}
+			op.Parameters = append(append([]contractParameter(nil), shared...), op.Parameters...)
+
+			routes = append(routes, contractRoute{
+				method:   strings.ToUpper(method),
+				segments: strings.Split(strings.Trim(path, "/"), "/"),
+				op:       op,
+			})
+		}
+	}
+
+	// prefer templates with more literal segments, so /users/me wins over /users/{id}
+	sort.SliceStable(routes, func(i, j int) bool { return literalSegments(routes[i]) > literalSegments(routes[j]) })
+
+	v := &schemaValidator{schemas: doc.Components.Schemas}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, ok := matchContractRoute(routes, r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			report := func(direction string, problems []schemaProblem) []ContractViolation {
+				violations := make([]ContractViolation, len(problems))
+				for i, p := range problems {
+					violations[i] = ContractViolation{Method: r.Method, Path: r.URL.Path, Direction: direction, Location: p.location, Message: p.message}
+				}
+				return violations
+			}
+
+			if problems := v.checkRequest(r, route.op, pathParams, o.MaxBodySize); len(problems) > 0 {
+				o.OnViolation(r, report("request", problems))
+				if o.Fail {
+					_ = t.ErrorJSON(w, errors.New("request does not match the API contract"))
+					return
+				}
+			}
+
+			rec := newResponseRecorder(w)
+			next.ServeHTTP(rec, r)
+
+			if problems := v.checkResponse(rec, route.op); len(problems) > 0 {
+				o.OnViolation(r, report("response", problems))
+				if o.Fail {
+					w.Header().Del("Content-Length")
+					_ = t.ErrorJSON(w, errors.New("response does not match the API contract"), http.StatusInternalServerError)
+					return
+				}
+			}
+
+			rec.flush()
+		})
+	}, nil
+}
+
+// literalSegments counts the segments of a route that are not parameters.
+func literalSegments(route contractRoute) int {
+	n := 0
+	for _, s := range route.segments {
+		if !strings.HasPrefix(s, "{") {
+			n++
+		}
+	}
+
+	return n
+}
+
+// matchContractRoute finds the operation for a request, returning its path parameters.
+func matchContractRoute(routes []contractRoute, r *http.Request) (contractRoute, map[string]string, bool) {
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	for _, route := range routes {
+		if route.method != r.Method || len(route.segments) != len(segments) {
+			continue
+		}
+
+		params := map[string]string{}
+		matched := true
+		for i, s := range route.segments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+				value, err := url.PathUnescape(segments[i])
+				if err != nil || value == "" {
+					matched = false
+					break
+				}
+				params[strings.Trim(s, "{}")] = value
+				continue
+			}
+			if s != segments[i] {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return route, params, true
+		}
+	}
+
+	return contractRoute{}, nil, false
+}
+
+// schemaProblem is a validation failure at a location.
+type schemaProblem struct {
+	location string
+	message  string
+}
+
+// schemaValidator validates decoded JSON against OpenAPI schemas.
+type schemaValidator struct {
+	schemas map[string]map[string]interface{}
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// checkRequest validates the parameters and body of a request.
+func (v *schemaValidator) checkRequest(r *http.Request, op contractOperation, pathParams map[string]string, maxBody int64) []schemaProblem {
+	var problems []schemaProblem
+
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+
+		switch p.In {
+		case "path":
+			value, present = pathParams[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+			present = value != ""
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				value, present = c.Value, true
+			}
+		default:
+			continue
+		}
+
+		location := p.In + "." + p.Name
+		if !present {
+			if p.Required {
+				problems = append(problems, schemaProblem{location, "is required"})
+			}
+			continue
+		}
+
+		problems = append(problems, v.validate(location, coerceParam(value, v.resolve(p.Schema)), p.Schema)...)
+	}
+
+	if op.RequestBody == nil {
+		return problems
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil || int64(len(data)) > maxBody {
+		return problems
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if op.RequestBody.Required {
+			problems = append(problems, schemaProblem{"body", "is required"})
+		}
+		return problems
+	}
+
+	schema, ok := jsonSchemaFor(op.RequestBody.Content, r.Header.Get("Content-Type"))
+	if !ok {
+		return problems
+	}
+
+	return append(problems, v.validateJSON("body", data, schema)...)
+}
+
+// checkResponse validates the status and body of a recorded response.
+func (v *schemaValidator) checkResponse(rec *responseRecorder, op contractOperation) []schemaProblem {
+	status := rec.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	code := strconv.Itoa(status)
+	response, ok := op.Responses[code]
+	if !ok {
+		response, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		response, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []schemaProblem{{"status", fmt.Sprintf("status %d is not documented", status)}}
+	}
+
+	if rec.body.Len() == 0 || len(response.Content) == 0 {
+		return nil
+	}
+
+	schema, ok := jsonSchemaFor(response.Content, rec.Header().Get("Content-Type"))
+	if !ok {
+		return nil
+	}
+
+	return v.validateJSON("body", rec.body.Bytes(), schema)
+}
+
+// jsonSchemaFor returns the schema of the JSON media type in content matching contentType.
+func jsonSchemaFor(content map[string]contractMediaContent, contentType string) (map[string]interface{}, bool) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType != "" && mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+		return nil, false
+	}
+
+	if c, ok := content[mediaType]; ok && c.Schema != nil {
+		return c.Schema, true
+	}
+	if c, ok := content["application/json"]; ok && c.Schema != nil {
+		return c.Schema, true
+	}
+
+	return nil, false
+}
+
+// coerceParam converts a parameter string to the JSON type its schema expects.
+func coerceParam(value string, schema map[string]interface{}) interface{} {
+	switch schema["type"] {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return value
+}
+
+// validateJSON decodes data and validates it against schema.
+func (v *schemaValidator) validateJSON(location string, data []byte, schema map[string]interface{}) []schemaProblem {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return []schemaProblem{{location, "is not valid JSON"}}
+	}
+
+	return v.validate(location, value, schema)
+}
+
+// resolve follows a local $ref.
+func (v *schemaValidator) resolve(schema map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema
+		}
+
+		resolved, ok := v.schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		if !ok {
+			return map[string]interface{}{}
+		}
+		schema = resolved
+	}
+
+	return schema
+}
+
+// validate checks a decoded JSON value against a schema.
+func (v *schemaValidator) validate(location string, value interface{}, schema map[string]interface{}) []schemaProblem {
+	schema = v.resolve(schema)
+	if len(schema) == 0 {
+		return nil
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		if _, typed := schema["type"]; typed {
+			return []schemaProblem{{location, "must not be null"}}
+		}
+	}
+
+	var problems []schemaProblem
+	fail := func(format string, args ...interface{}) {
+		problems = append(problems, schemaProblem{location, fmt.Sprintf(format, args...)})
+	}
+
+	for _, sub := range schemaList(schema["allOf"]) {
+		problems = append(problems, v.validate(location, value, sub)...)
+	}
+	for _, key := range []string{"oneOf", "anyOf"} {
+		if alternatives := schemaList(schema[key]); len(alternatives) > 0 {
+			matched := 0
+			for _, sub := range alternatives {
+				if len(v.validate(location, value, sub)) == 0 {
+					matched++
+				}
+			}
+			if matched == 0 || (key == "oneOf" && matched > 1) {
+				fail("must match %s one of the alternatives", map[string]string{"oneOf": "exactly", "anyOf": "at least"}[key])
+			}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok && value != nil && !enumContains(enum, value) {
+		fail("must be one of %v", enum)
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			fail("must be an object")
+			break
+		}
+
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range stringList(schema["required"]) {
+			if _, present := obj[name]; !present {
+				problems = append(problems, schemaProblem{location + "." + name, "is required"})
+			}
+		}
+
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if prop, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, v.validate(location+"."+name, obj[name], prop)...)
+				continue
+			}
+
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !extra {
+					problems = append(problems, schemaProblem{location + "." + name, "is not an allowed property"})
+				}
+			case map[string]interface{}:
+				problems = append(problems, v.validate(location+"."+name, obj[name], extra)...)
+			}
+		}
+
+		checkBounds(fail, float64(len(obj)), schema, "minProperties", "maxProperties", "properties")
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			fail("must be an array")
+			break
+		}
+
+		if itemSchema, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range items {
+				problems = append(problems, v.validate(fmt.Sprintf("%s[%d]", location, i), item, itemSchema)...)
+			}
+		}
+
+		checkBounds(fail, float64(len(items)), schema, "minItems", "maxItems", "items")
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			fail("must be a string")
+			break
+		}
+
+		checkBounds(fail, float64(len([]rune(s))), schema, "minLength", "maxLength", "characters")
+
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := v.pattern(pattern); re != nil && !re.MatchString(s) {
+				fail("must match %s", pattern)
+			}
+		}
+
+		if format, ok := schema["format"].(string); ok && !validFormat(format, s) {
+			fail("must be a valid %s", format)
+		}
+
+	case "integer", "number":
+		kind := "a number"
+		if schema["type"] == "integer" {
+			kind = "an integer"
+		}
+
+		n, ok := value.(json.Number)
+		if !ok {
+			fail("must be %s", kind)
+			break
+		}
+
+		f, err := n.Float64()
+		if err != nil || (schema["type"] == "integer" && f != math.Trunc(f)) {
+			fail("must be %s", kind)
+			break
+		}
+
+		if min, ok := schema["minimum"].(float64); ok && f < min {
+			fail("must be at least %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && f > max {
+			fail("must be at most %v", max)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			fail("must be a boolean")
+		}
+	}
+
+	return problems
+}
+
+// pattern compiles and caches a schema pattern.
+func (v *schemaValidator) pattern(p string) *regexp.Regexp {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.patterns == nil {
+		v.patterns = make(map[string]*regexp.Regexp)
+	}
+
+	re, ok := v.patterns[p]
+	if !ok {
+		// an invalid pattern is cached as nil and not checked
+		re, _ = regexp.Compile(p)
+		v.patterns[p] = re
+	}
+
+	return re
+}
+
+// checkBounds reports sizes outside a schema's minimum and maximum keywords.
+func checkBounds(fail func(string, ...interface{}), size float64, schema map[string]interface{}, minKey, maxKey, unit string) {
+	if min, ok := schema[minKey].(float64); ok && size < min {
+		fail("must have at least %v %s", min, unit)
+	}
+	if max, ok := schema[maxKey].(float64); ok && size > max {
+		fail("must have at most %v %s", max, unit)
+	}
+}
+
+// validFormat checks the string formats that are cheap to verify.
+func validFormat(format, s string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, s)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	case "uri":
+		u, err := url.Parse(s)
+		return err == nil && u.Scheme != ""
+	}
+
+	return true
+}
+
+// enumContains reports whether a decoded JSON value is one of the enum values.
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if n, ok := value.(json.Number); ok {
+			if f, err := n.Float64(); err == nil && f == e {
+				return true
+			}
+			continue
+		}
+		if e == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// schemaList converts a decoded list of schemas.
+func schemaList(v interface{}) []map[string]interface{} {
+	list, _ := v.([]interface{})
+
+	schemas := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(map[string]interface{}); ok {
+			schemas = append(schemas, s)
+		}
+	}
+
+	return schemas
+}
+
+// stringList converts a decoded list of strings.
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
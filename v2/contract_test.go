@@ -0,0 +1,113 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type contractTestItem struct {
+	ID   int    `json:"id"`
+	Name string `json:"name" validate:"required,max=10"`
+}
+
+type contractTestList struct {
+	Limit int `query:"limit" validate:"required,max=100"`
+}
+
+var contractTests = []struct {
+	name       string
+	method     string
+	url        string
+	body       string
+	response   string
+	status     int
+	violations []string
+}{
+	{name: "valid", method: http.MethodPost, url: "/items", body: `{"name":"pen"}`, response: `{"id":1,"name":"pen"}`, status: http.StatusCreated},
+	{name: "missing field", method: http.MethodPost, url: "/items", body: `{"id":2}`, response: `{"id":1,"name":"pen"}`, status: http.StatusCreated, violations: []string{"request body.name: is required"}},
+	{name: "wrong type", method: http.MethodPost, url: "/items", body: `{"name":5}`, response: `{"id":1,"name":"pen"}`, status: http.StatusCreated, violations: []string{"request body.name: must be a string"}},
+	{name: "response drift", method: http.MethodPost, url: "/items", body: `{"name":"pen"}`, response: `{"id":"1","name":"pen"}`, status: http.StatusCreated, violations: []string{"response body.id: must be an integer"}},
+	{name: "undocumented status", method: http.MethodPost, url: "/items", body: `{"name":"pen"}`, response: `{}`, status: http.StatusAccepted, violations: []string{"response status: status 202 is not documented"}},
+	{name: "query parameters", method: http.MethodGet, url: "/items?limit=500", response: `[]`, status: http.StatusOK, violations: []string{"request query.limit: must be at most 100"}},
+	{name: "missing query parameter", method: http.MethodGet, url: "/items", response: `[]`, status: http.StatusOK, violations: []string{"request query.limit: is required"}},
+	{name: "unknown path", method: http.MethodGet, url: "/other", response: `{}`, status: http.StatusTeapot},
+}
+
+func contractTestSpec(t *testing.T) []byte {
+	api := NewOpenAPI("Items", "1")
+	api.Register(Route{Method: http.MethodPost, Path: "/items", Request: contractTestItem{}, Response: contractTestItem{}, Status: http.StatusCreated})
+	api.Register(Route{Method: http.MethodGet, Path: "/items", Request: contractTestList{}, Response: []contractTestItem{}})
+
+	spec, err := json.Marshal(api.Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return spec
+}
+
+func TestTools_ContractMiddleware(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range contractTests {
+		var got []string
+		mw, err := testTools.ContractMiddleware(contractTestSpec(t), ContractOptions{OnViolation: func(r *http.Request, violations []ContractViolation) {
+			for _, v := range violations {
+				got = append(got, v.Direction+" "+v.Location+": "+v.Message)
+			}
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(e.status)
+			_, _ = w.Write([]byte(e.response))
+		}))
+
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(e.method, e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(rr, req)
+
+		if strings.Join(got, "; ") != strings.Join(e.violations, "; ") {
+			t.Errorf("%s: expected violations %v, got %v", e.name, e.violations, got)
+		}
+		if rr.Code != e.status || rr.Body.String() != e.response {
+			t.Errorf("%s: expected the response to pass through, got %d %s", e.name, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_ContractMiddlewareFail(t *testing.T) {
+	var testTools Tools
+
+	mw, err := testTools.ContractMiddleware(contractTestSpec(t), ContractOptions{Fail: true, OnViolation: func(*http.Request, []ContractViolation) {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSON(w, http.StatusCreated, map[string]interface{}{"id": 1})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{}`)))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid request to be rejected, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/items", strings.NewReader(`{"name":"pen"}`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected an invalid response to be replaced, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	if _, err := testTools.ContractMiddleware([]byte("openapi: 3.0.0")); err == nil {
+		t.Error("expected error for a document that is not JSON")
+	}
+}
@@ -0,0 +1,243 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Client classes used by CrawlerLimitMiddleware.
+const (
+	ClientUser    = "user"
+	ClientBot     = "bot"
+	ClientCrawler = "crawler"
+)
+
+// RateLimit allows Requests per Per, with bursts of up to Burst requests. A zero RateLimit is unlimited.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// RateLimitError is returned when a client exceeds its rate limit. Passing it to ErrorJSON responds with 429 Too
+// Many Requests and a Retry-After header.
+// Fields:
+// - Class: The client class whose limit was exceeded, e.g. ClientBot.
+// - RetryAfter: How long the client must wait before its next request is allowed.
+type RateLimitError struct {
+	Class      string
+	RetryAfter time.Duration
+}
+
+// Error returns a human-readable description of the limit.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded; retry after %s seconds", e.retryAfterSeconds())
+}
+
+// ErrorCode returns "rate_limited".
+func (e *RateLimitError) ErrorCode() string {
+	return "rate_limited"
+}
+
+// retryAfterSeconds returns RetryAfter rounded up to whole seconds, as used by the Retry-After header.
+func (e *RateLimitError) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// CrawlerLimitOptions configures CrawlerLimitMiddleware.
+// Fields:
+// - Users: The limit for each browser client. Unlimited by default.
+// - Bots: The limit for each automated client: scrapers, HTTP libraries, headless browsers and unverified crawlers.
+// Defaults to 60 requests per minute with bursts of 10.
+// - Crawlers: The limit for each search engine crawler confirmed by IsVerifiedCrawler. Defaults to 600 requests
+// per minute with bursts of 60.
+// - BotCacheControl: If set, the Cache-Control header given to bots and crawlers before the handler runs, e.g.
+// "public, max-age=3600", so caches and CDNs can answer repeated crawls. Handlers may still override it.
+// - Key: Identifies a client within its class. Defaults to the IP address in r.RemoteAddr.
+type CrawlerLimitOptions struct {
+	Users           RateLimit
+	Bots            RateLimit
+	Crawlers        RateLimit
+	BotCacheControl string
+	Key             func(r *http.Request) string
+}
+
+type clientClassContextKey struct{}
+
+// ClientClassFromContext returns the class set by CrawlerLimitMiddleware: ClientUser, ClientBot or ClientCrawler.
+func ClientClassFromContext(ctx context.Context) (string, bool) {
+	class, ok := ctx.Value(clientClassContextKey{}).(string)
+	return class, ok
+}
+
+// CrawlerLimitMiddleware rate-limits bots separately from users, protecting expensive endpoints such as uploads
+// and downloads from scraping storms without slowing people down. Requests are classified with the User-Agent
+// parser; clients claiming to be a search engine crawler are confirmed with IsVerifiedCrawler, whose result is
+// cached per address for an hour, and are treated as bots if the check fails. The class is stored in the request
+// context for handlers, see ClientClassFromContext.
+// Parameters:
+// - opts: Optional CrawlerLimitOptions. Only the first value is used if multiple are provided.
+// Returns the middleware, which answers 429 Too Many Requests with a *RateLimitError when a client exceeds its limit.
+func (t *Tools) CrawlerLimitMiddleware(opts ...CrawlerLimitOptions) func(http.Handler) http.Handler {
+	var o CrawlerLimitOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Bots == (RateLimit{}) {
+		o.Bots = RateLimit{Requests: 60, Per: time.Minute, Burst: 10}
+	}
+	if o.Crawlers == (RateLimit{}) {
+		o.Crawlers = RateLimit{Requests: 600, Per: time.Minute, Burst: 60}
+	}
+	if o.Key == nil {
+		o.Key = remoteIP
+	}
+
+	limiters := map[string]*rateLimiter{
+		ClientUser:    newRateLimiter(o.Users),
+		ClientBot:     newRateLimiter(o.Bots),
+		ClientCrawler: newRateLimiter(o.Crawlers),
+	}
+	verified := &verificationCache{entries: make(map[string]verificationEntry)}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			class := ClientUser
+
+			ua := parseUserAgent(r.UserAgent())
+			if ua.IsBot {
+				class = ClientBot
+				if ua.BotName != "" && verified.check(remoteIP(r), func() bool { return t.IsVerifiedCrawler(r.Context(), r) }) {
+					class = ClientCrawler
+				}
+			}
+
+			if wait := limiters[class].take(o.Key(r), time.Now()); wait > 0 {
+				_ = t.ErrorJSON(w, &RateLimitError{Class: class, RetryAfter: wait})
+				return
+			}
+
+			if class != ClientUser && o.BotCacheControl != "" {
+				w.Header().Set("Cache-Control", o.BotCacheControl)
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientClassContextKey{}, class)))
+		})
+	}
+}
+
+// remoteIP returns the IP address in r.RemoteAddr.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// rateLimiter is a set of token buckets, one per client.
+type rateLimiter struct {
+	limit   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter for limit, or nil for unlimited.
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// take spends a token for key, returning how long to wait if there is none.
+func (l *rateLimiter) take(key string, now time.Time) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	rate := float64(l.limit.Requests) / float64(l.limit.Per)
+	burst := float64(l.limit.Burst)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// forget clients whose buckets have refilled, keeping memory bounded
+	if len(l.buckets) > 10000 {
+		for k, b := range l.buckets {
+			if b.tokens+float64(now.Sub(b.last))*rate >= burst {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate)
+	}
+	b.tokens--
+
+	return 0
+}
+
+// verificationCache remembers crawler verification results per address.
+type verificationCache struct {
+	mu      sync.Mutex
+	entries map[string]verificationEntry
+}
+
+type verificationEntry struct {
+	verified  bool
+	expiresAt time.Time
+}
+
+// check returns the cached result for ip, or runs verify and caches its result for an hour.
+func (c *verificationCache) check(ip string, verify func() bool) bool {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[ip]
+	c.mu.Unlock()
+	if ok && now.Before(e.expiresAt) {
+		return e.verified
+	}
+
+	verified := verify()
+
+	c.mu.Lock()
+	if len(c.entries) > 10000 {
+		for k, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[ip] = verificationEntry{verified: verified, expiresAt: now.Add(time.Hour)}
+	c.mu.Unlock()
+
+	return verified
+}
@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_CrawlerLimitMiddleware(t *testing.T) {
+	var testTools Tools
+
+	origAddr, origHost := lookupAddr, lookupHost
+	defer func() { lookupAddr, lookupHost = origAddr, origHost }()
+
+	lookups := 0
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		lookups++
+		if addr == "66.249.66.1" {
+			return []string{"crawl-66-249-66-1.googlebot.com."}, nil
+		}
+		return nil, errors.New("no PTR record")
+	}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"66.249.66.1"}, nil
+	}
+
+	var class string
+	h := testTools.CrawlerLimitMiddleware(CrawlerLimitOptions{
+		Bots:            RateLimit{Requests: 2, Per: time.Minute, Burst: 2},
+		Crawlers:        RateLimit{Requests: 3, Per: time.Minute, Burst: 3},
+		BotCacheControl: "public, max-age=600",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class, _ = ClientClassFromContext(r.Context())
+	}))
+
+	send := func(addr, agent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/download", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("User-Agent", agent)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var crawlerLimitTests = []struct {
+		name   string
+		addr   string
+		agent  string
+		count  int
+		status int
+		class  string
+	}{
+		{name: "user", addr: "198.51.100.1:1", agent: "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0", count: 20, status: http.StatusOK, class: ClientUser},
+		{name: "bot within limit", addr: "198.51.100.2:1", agent: "curl/8.4.0", count: 2, status: http.StatusOK, class: ClientBot},
+		{name: "bot over limit", addr: "198.51.100.2:1", agent: "python-requests/2.31", count: 1, status: http.StatusTooManyRequests},
+		{name: "other bot", addr: "198.51.100.3:1", agent: "curl/8.4.0", count: 1, status: http.StatusOK, class: ClientBot},
+		{name: "spoofed crawler", addr: "198.51.100.4:1", agent: "Mozilla/5.0 (compatible; Googlebot/2.1)", count: 2, status: http.StatusOK, class: ClientBot},
+		{name: "spoofed crawler over limit", addr: "198.51.100.4:1", agent: "Mozilla/5.0 (compatible; Googlebot/2.1)", count: 1, status: http.StatusTooManyRequests},
+		{name: "verified crawler", addr: "66.249.66.1:1", agent: "Mozilla/5.0 (compatible; Googlebot/2.1)", count: 3, status: http.StatusOK, class: ClientCrawler},
+		{name: "verified crawler over limit", addr: "66.249.66.1:1", agent: "Mozilla/5.0 (compatible; Googlebot/2.1)", count: 1, status: http.StatusTooManyRequests},
+	}
+
+	for _, e := range crawlerLimitTests {
+		for i := 0; i < e.count; i++ {
+			class = ""
+			rr := send(e.addr, e.agent)
+
+			if rr.Code != e.status {
+				t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+				break
+			}
+			if e.status != http.StatusOK {
+				var payload JSONResponse
+				_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+				if rr.Header().Get("Retry-After") == "" || payload.Code != "rate_limited" {
+					t.Errorf("%s: expected Retry-After and rate_limited code, got %v %+v", e.name, rr.Header(), payload)
+				}
+				continue
+			}
+			if class != e.class {
+				t.Errorf("%s: expected class %s, got %s", e.name, e.class, class)
+			}
+			if cc := rr.Header().Get("Cache-Control"); (e.class == ClientUser) != (cc == "") {
+				t.Errorf("%s: unexpected Cache-Control %q", e.name, cc)
+			}
+		}
+	}
+
+	if lookups != 2 {
+		t.Errorf("expected crawler verification to be cached per address, got %d lookups", lookups)
+	}
+}
+
+func TestRateLimiter_Refill(t *testing.T) {
+	l := newRateLimiter(RateLimit{Requests: 1, Per: time.Second})
+	now := time.Now()
+
+	if wait := l.take("a", now); wait != 0 {
+		t.Errorf("expected the first request to pass, got %s", wait)
+	}
+	if wait := l.take("a", now.Add(250*time.Millisecond)); wait != 750*time.Millisecond {
+		t.Errorf("expected to wait 750ms, got %s", wait)
+	}
+	if wait := l.take("a", now.Add(time.Second)); wait != 0 {
+		t.Errorf("expected a refilled token, got %s", wait)
+	}
+	if newRateLimiter(RateLimit{}).take("a", now) != 0 {
+		t.Error("expected a zero limit to be unlimited")
+	}
+}
@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// ErrCSRF is returned by CSRFMiddleware when an unsafe request carries no valid CSRF token.
+var ErrCSRF = errors.New("invalid CSRF token")
+
+const csrfTokenLength = 32
+
+// CSRFOptions configures CSRFMiddleware.
+// Fields:
+// - CookieName: The cookie holding the secret token. Defaults to "csrf_token".
+// - HeaderName: The request header checked for the token, for scripts. Defaults to "X-CSRF-Token".
+// - FieldName: The form field checked for the token. Defaults to "csrf_token".
+// - Secure: Whether the cookie is only sent over HTTPS.
+// - SameSite: The cookie's SameSite attribute. Defaults to http.SameSiteLaxMode.
+type CSRFOptions struct {
+	CookieName string
+	HeaderName string
+	FieldName  string
+	Secure     bool
+	SameSite   http.SameSite
+}
+
+type csrfContextKey struct{}
+
+// csrfState is the token and form field name for a request.
+type csrfState struct {
+	token []byte
+	field string
+}
+
+// CSRFMiddleware protects forms against cross-site request forgery with the double-submit cookie pattern. A
+// random secret is kept in a cookie, and requests other than GET, HEAD, OPTIONS and TRACE must send it back in
+// the header or form field, where a cross-site page cannot read it from. Tokens given out by CSRFToken and
+// CSRFField are masked with a fresh random pad each time, so they cannot be recovered by compression attacks
+// such as BREACH.
+// Parameters:
+// - opts: Optional CSRFOptions. Only the first value is used if multiple are provided.
+// Returns the middleware, which answers 403 Forbidden with ErrCSRF for requests without a valid token.
+func (t *Tools) CSRFMiddleware(opts ...CSRFOptions) func(http.Handler) http.Handler {
+	var o CSRFOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.CookieName == "" {
+		o.CookieName = "csrf_token"
+	}
+	if o.HeaderName == "" {
+		o.HeaderName = "X-CSRF-Token"
+	}
+	if o.FieldName == "" {
+		o.FieldName = "csrf_token"
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var secret []byte
+			if c, err := r.Cookie(o.CookieName); err == nil {
+				secret, _ = base64.RawURLEncoding.DecodeString(c.Value)
+			}
+
+			if len(secret) != csrfTokenLength {
+				secret = make([]byte, csrfTokenLength)
+				_, _ = rand.Read(secret)
+
+				http.SetCookie(w, &http.Cookie{
+					Name:     o.CookieName,
+					Value:    base64.RawURLEncoding.EncodeToString(secret),
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   o.Secure,
+					SameSite: o.SameSite,
+				})
+			}
+			w.Header().Add("Vary", "Cookie")
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			default:
+				sent := r.Header.Get(o.HeaderName)
+				if sent == "" {
+					sent = r.FormValue(o.FieldName)
+				}
+
+				if !csrfTokenValid(secret, sent) {
+					_ = t.ErrorJSON(w, ErrCSRF, http.StatusForbidden)
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), csrfContextKey{}, csrfState{token: secret, field: o.FieldName})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// csrfTokenValid unmasks a token and compares it with the secret.
+func csrfTokenValid(secret []byte, sent string) bool {
+	masked, err := base64.RawURLEncoding.DecodeString(sent)
+	if err != nil || len(masked) != 2*csrfTokenLength {
+		return false
+	}
+
+	token := make([]byte, csrfTokenLength)
+	for i := range token {
+		token[i] = masked[i] ^ masked[csrfTokenLength+i]
+	}
+
+	return subtle.ConstantTimeCompare(token, secret) == 1
+}
+
+// CSRFToken returns a masked CSRF token for the request, to send in the X-CSRF-Token header or a form field.
+// Parameters:
+// - r: A request that went through CSRFMiddleware.
+// Returns the token, or an empty string if CSRFMiddleware did not run.
+func CSRFToken(r *http.Request) string {
+	state, ok := r.Context().Value(csrfContextKey{}).(csrfState)
+	if !ok {
+		return ""
+	}
+
+	masked := make([]byte, 2*csrfTokenLength)
+	_, _ = rand.Read(masked[:csrfTokenLength])
+	for i := 0; i < csrfTokenLength; i++ {
+		masked[csrfTokenLength+i] = masked[i] ^ state.token[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// CSRFField returns a hidden form input carrying a CSRF token.
+// Parameters:
+// - r: A request that went through CSRFMiddleware.
+// Returns the input, or an empty string if CSRFMiddleware did not run.
+func CSRFField(r *http.Request) template.HTML {
+	state, ok := r.Context().Value(csrfContextKey{}).(csrfState)
+	if !ok {
+		return ""
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(state.field), CSRFToken(r)))
+}
@@ -0,0 +1,75 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestTools_CSRFMiddleware(t *testing.T) {
+	var testTools Tools
+
+	var token string
+	var field string
+	h := testTools.CSRFMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, field = CSRFToken(r), string(CSRFField(r))
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/form", nil))
+	cookies := rr.Result().Cookies()
+	if rr.Code != http.StatusOK || len(cookies) != 1 || !cookies[0].HttpOnly || token == "" {
+		t.Fatalf("expected a token cookie, got %d %v", rr.Code, cookies)
+	}
+	if !strings.HasPrefix(field, `<input type="hidden" name="csrf_token" value="`) {
+		t.Errorf("unexpected field %s", field)
+	}
+
+	first := token
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookies[0])
+	h.ServeHTTP(rr, req)
+	if len(rr.Result().Cookies()) != 0 || token == first {
+		t.Errorf("expected the cookie to be kept and the token masked differently, got %v", rr.Result().Cookies())
+	}
+
+	var csrfTests = []struct {
+		name   string
+		header string
+		form   string
+		cookie bool
+		status int
+	}{
+		{name: "header", header: token, cookie: true, status: http.StatusOK},
+		{name: "form field", form: token, cookie: true, status: http.StatusOK},
+		{name: "earlier token", header: first, cookie: true, status: http.StatusOK},
+		{name: "missing token", cookie: true, status: http.StatusForbidden},
+		{name: "wrong token", header: strings.Repeat("A", len(token)), cookie: true, status: http.StatusForbidden},
+		{name: "missing cookie", header: token, status: http.StatusForbidden},
+	}
+
+	for _, e := range csrfTests {
+		form := url.Values{"csrf_token": {e.form}}
+		req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if e.header != "" {
+			req.Header.Set("X-CSRF-Token", e.header)
+		}
+		if e.cookie {
+			req.AddCookie(cookies[0])
+		}
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+	}
+
+	if CSRFToken(httptest.NewRequest(http.MethodGet, "/", nil)) != "" {
+		t.Error("expected no token without the middleware")
+	}
+}
@@ -0,0 +1,254 @@
+package toolkit
+
+import (
+	"expvar"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processStart is when the process started, for the uptime in /debug/runtime.
+var processStart = time.Now()
+
+// DebugRoutes mounts operational endpoints on mux, all behind auth:
+//   - /debug/pprof/: The profiles of runtime/pprof, for go tool pprof, e.g. /debug/pprof/heap,
+//     /debug/pprof/profile?seconds=30 for a CPU profile and /debug/pprof/trace?seconds=5 for an execution trace.
+//   - /debug/vars: The variables published with expvar, as JSON.
+//   - /debug/runtime: Goroutines, memory statistics and garbage collector figures, as JSON.
+//   - /debug/build: The Go version, module versions and VCS settings the binary was built with, as JSON.
+//   - /debug/config: The Tools configuration, as JSON. Hooks and stores show their type; secrets are redacted.
+//
+// The profiles are served without importing net/http/pprof, which would also register them on
+// http.DefaultServeMux. CPU profiles and traces take as long as requested, so the server's WriteTimeout must allow
+// for it.
+// Parameters:
+// - mux: The mux to mount the routes on.
+// - auth: The middleware guarding every route, e.g. Authorize with an admin policy, or MTLSMiddleware. If nil,
+// every request is refused with 403 Forbidden, so the endpoints are never exposed by mistake.
+func (t *Tools) DebugRoutes(mux *http.ServeMux, auth func(http.Handler) http.Handler) {
+	if auth == nil {
+		auth = t.denyAll
+	}
+
+	mux.Handle("GET /debug/pprof/", auth(http.HandlerFunc(t.debugProfile)))
+	mux.Handle("GET /debug/vars", auth(expvar.Handler()))
+	mux.Handle("GET /debug/runtime", auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = t.WriteJSON(w, http.StatusOK, runtimeStats())
+	})))
+	mux.Handle("GET /debug/build", auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			_ = t.ErrorJSON(w, fmt.Errorf("build info unavailable"), http.StatusNotFound)
+			return
+		}
+		_ = t.WriteJSON(w, http.StatusOK, buildInfo(info))
+	})))
+	mux.Handle("GET /debug/config", auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = t.WriteJSON(w, http.StatusOK, debugValue(reflect.ValueOf(*t), NewRedactor(), ""))
+	})))
+}
+
+// denyAll is the auth middleware of admin endpoints mounted without one, refusing every request with 403 Forbidden.
+func (t *Tools) denyAll(http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = t.ErrorJSON(w, ErrForbidden)
+	})
+}
+
+// debugIndex lists the profiles.
+var debugIndex = template.Must(template.New("pprof").Parse(`<!DOCTYPE html>
+<html><head><title>/debug/pprof/</title></head><body>
+<h1>/debug/pprof/</h1>
+<table>{{range .}}<tr><td>{{.Count}}</td><td><a href="{{.Name}}?debug=1">{{.Name}}</a></td></tr>{{end}}</table>
+<p><a href="profile?seconds=30">profile</a> (CPU, 30s) · <a href="trace?seconds=1">trace</a> (1s) · <a href="cmdline">cmdline</a></p>
+</body></html>
+`))
+
+// debugProfile serves /debug/pprof/ and the profiles below it.
+func (t *Tools) debugProfile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/debug/pprof/")
+	seconds := 30
+	if s, err := strconv.Atoi(r.FormValue("seconds")); err == nil && s > 0 {
+		seconds = s
+	}
+
+	switch name {
+	case "":
+		type entry struct {
+			Name  string
+			Count int
+		}
+		var entries []entry
+		for _, p := range pprof.Profiles() {
+			entries = append(entries, entry{p.Name(), p.Count()})
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = debugIndex.Execute(w, entries)
+
+	case "cmdline":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+
+	case "profile", "trace":
+		if name == "trace" && r.FormValue("seconds") == "" {
+			seconds = 1
+		}
+
+		start, stop := pprof.StartCPUProfile, pprof.StopCPUProfile
+		if name == "trace" {
+			start, stop = trace.Start, trace.Stop
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		if err := start(w); err != nil {
+			w.Header().Del("Content-Disposition")
+			_ = t.ErrorJSON(w, fmt.Errorf("could not start %s: %w", name, err), http.StatusInternalServerError)
+			return
+		}
+
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-r.Context().Done():
+		}
+		stop()
+
+	default:
+		p := pprof.Lookup(name)
+		if p == nil {
+			_ = t.ErrorJSON(w, fmt.Errorf("unknown profile %q", name), http.StatusNotFound)
+			return
+		}
+		if name == "heap" && r.FormValue("gc") != "" {
+			runtime.GC()
+		}
+
+		debugLevel, _ := strconv.Atoi(r.FormValue("debug"))
+		if debugLevel > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		}
+		_ = p.WriteTo(w, debugLevel)
+	}
+}
+
+// runtimeStats returns the figures served by /debug/runtime.
+func runtimeStats() map[string]interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	var lastGC interface{}
+	if m.LastGC > 0 {
+		lastGC = time.Unix(0, int64(m.LastGC)).UTC()
+	}
+
+	return map[string]interface{}{
+		"go_version": runtime.Version(),
+		"goroutines": runtime.NumGoroutine(),
+		"cpus":       runtime.NumCPU(),
+		"gomaxprocs": runtime.GOMAXPROCS(0),
+		"uptime":     time.Since(processStart).Round(time.Second).String(),
+		"memory": map[string]interface{}{
+			"alloc":         m.Alloc,
+			"total_alloc":   m.TotalAlloc,
+			"sys":           m.Sys,
+			"heap_alloc":    m.HeapAlloc,
+			"heap_inuse":    m.HeapInuse,
+			"heap_idle":     m.HeapIdle,
+			"heap_released": m.HeapReleased,
+			"heap_objects":  m.HeapObjects,
+			"stack_inuse":   m.StackInuse,
+			"mallocs":       m.Mallocs,
+			"frees":         m.Frees,
+		},
+		"gc": map[string]interface{}{
+			"count":        m.NumGC,
+			"forced":       m.NumForcedGC,
+			"pause_total":  time.Duration(m.PauseTotalNs).String(),
+			"last_pause":   time.Duration(m.PauseNs[(m.NumGC+255)%256]).String(),
+			"last":         lastGC,
+			"next_target":  m.NextGC,
+			"cpu_fraction": m.GCCPUFraction,
+		},
+	}
+}
+
+// buildInfo returns the figures served by /debug/build.
+func buildInfo(info *debug.BuildInfo) map[string]interface{} {
+	deps := map[string]string{}
+	for _, d := range info.Deps {
+		version := d.Version
+		if d.Replace != nil {
+			version += " => " + d.Replace.Path + " " + d.Replace.Version
+		}
+		deps[d.Path] = version
+	}
+
+	settings := map[string]string{}
+	for _, s := range info.Settings {
+		settings[s.Key] = s.Value
+	}
+
+	return map[string]interface{}{
+		"go_version": info.GoVersion,
+		"path":       info.Path,
+		"main":       map[string]string{"path": info.Main.Path, "version": info.Main.Version, "sum": info.Main.Sum},
+		"deps":       deps,
+		"settings":   settings,
+	}
+}
+
+// debugValue describes a configuration value for /debug/config: plain values as they are, structs field by field,
+// and anything else, such as stores, hooks and maps, by its type, or nil when unset. Strings of sensitive fields
+// are redacted.
+func debugValue(v reflect.Value, rd *Redactor, name string) interface{} {
+	switch v.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return v.Interface()
+	case reflect.String:
+		if rd.IsSensitive(name) && v.Len() > 0 {
+			return rd.replacement()
+		}
+		return v.String()
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String && !rd.IsSensitive(name) {
+			return v.Interface()
+		}
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.IsExported() {
+				out[sf.Name] = debugValue(v.Field(i), rd, sf.Name)
+			}
+		}
+		return out
+	}
+
+	if v.IsZero() {
+		return nil
+	}
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Map || v.Kind() == reflect.Slice {
+		return fmt.Sprintf("%s (%d entries)", v.Type(), v.Len())
+	}
+
+	return v.Type().String()
+}
@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_DebugRoutes(t *testing.T) {
+	testTools := Tools{MaxFileSize: 1024, AllowedFileTypes: []string{"image/png"}, ShareBaseURL: "https://example.com/s/", Locker: &FileLocker{}}
+
+	admin := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Admin") != "yes" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	mux := http.NewServeMux()
+	testTools.DebugRoutes(mux, admin)
+
+	var tests = []struct {
+		name     string
+		path     string
+		admin    bool
+		status   int
+		contains string
+	}{
+		{"unauthorized", "/debug/runtime", false, 403, ""},
+		{"pprof index", "/debug/pprof/", true, 200, "goroutine"},
+		{"profile", "/debug/pprof/goroutine?debug=1", true, 200, "TestTools_DebugRoutes"},
+		{"binary profile", "/debug/pprof/heap", true, 200, ""},
+		{"unknown profile", "/debug/pprof/nope", true, 404, ""},
+		{"cmdline", "/debug/pprof/cmdline", true, 200, ".test"},
+		{"cpu profile", "/debug/pprof/profile?seconds=1", true, 200, ""},
+		{"expvar", "/debug/vars", true, 200, `"memstats"`},
+		{"runtime", "/debug/runtime", true, 200, `"goroutines"`},
+		{"build", "/debug/build", true, 200, `"go_version"`},
+		{"config", "/debug/config", true, 200, `"MaxFileSize":1024`},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", e.path, nil)
+		if e.admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+			continue
+		}
+		if !strings.Contains(rr.Body.String(), e.contains) {
+			t.Errorf("%s: expected the body to contain %q, got %.200s", e.name, e.contains, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/debug/config", nil)
+	req.Header.Set("X-Admin", "yes")
+	mux.ServeHTTP(rr, req)
+
+	var config map[string]interface{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &config)
+	if config["Locker"] != "*toolkit.FileLocker" || config["GeoIP"] != nil || config["AllowedFileTypes"].([]interface{})[0] != "image/png" {
+		t.Errorf("expected set stores to show their type, got %v", config)
+	}
+	if _, ok := config["UploadWrite"].(map[string]interface{}); !ok {
+		t.Errorf("expected nested options to be listed, got %v", config["UploadWrite"])
+	}
+
+	mux = http.NewServeMux()
+	testTools.DebugRoutes(mux, nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a nil auth to refuse requests, got %d", rr.Code)
+	}
+}
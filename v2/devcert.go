@@ -0,0 +1,242 @@
+package toolkit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DevCert is a certificate for local development, signed by a local certificate authority. Trust CA once in the
+// browser or system store, and every certificate it signs is accepted, which makes HTTPS-only features such as
+// Secure cookies and HTTP/2 testable locally. Never use it in production.
+// Fields:
+// - CA: The certificate authority's certificate in PEM.
+// - Cert: The leaf certificate in PEM.
+// - Key: The leaf's private key in PEM.
+// - CAFile, CertFile, KeyFile: The files written by WriteDevCert. Empty for GenerateDevCert.
+type DevCert struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// TLSCertificate returns the leaf certificate and key for tls.Config.Certificates.
+func (c *DevCert) TLSCertificate() (tls.Certificate, error) {
+	return tls.X509KeyPair(c.Cert, c.Key)
+}
+
+// devCA is a loaded certificate authority.
+type devCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// GenerateDevCert creates a local certificate authority and a certificate it signs for the hosts, in memory.
+// Parameters:
+// - hosts: The host names and IP addresses the certificate is valid for, e.g. "localhost", "*.app.test" or
+// "127.0.0.1". Defaults to localhost, 127.0.0.1 and ::1.
+// Returns the certificate, valid for a year, or an error if generating keys fails.
+func (t *Tools) GenerateDevCert(hosts ...string) (*DevCert, error) {
+	ca, err := newDevCA()
+	if err != nil {
+		return nil, err
+	}
+
+	return ca.issue(hosts)
+}
+
+// WriteDevCert is like GenerateDevCert, but writes ca.pem, ca-key.pem, cert.pem and key.pem to dir. The
+// certificate authority in dir is reused if there is one, so it only has to be trusted once.
+// Parameters:
+// - dir: The directory to write to, created if needed. Keep it out of version control.
+// - hosts: The host names and IP addresses the certificate is valid for.
+// Returns the certificate with the paths of the files, or an error if the files cannot be read or written.
+func (t *Tools) WriteDevCert(dir string, hosts ...string) (*DevCert, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+
+	caFile, caKeyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	ca, err := loadDevCA(caFile, caKeyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		if ca, err = newDevCA(); err == nil {
+			err = writeFiles(map[string][]byte{caFile: ca.certPEM}, map[string][]byte{caKeyFile: ca.keyPEM})
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := ca.issue(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	cert.CAFile, cert.CertFile, cert.KeyFile = caFile, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := writeFiles(map[string][]byte{cert.CertFile: cert.Cert}, map[string][]byte{cert.KeyFile: cert.Key}); err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// writeFiles writes public files readable by everyone and private files readable by the owner only.
+func writeFiles(public, private map[string][]byte) error {
+	for name, data := range public {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			return err
+		}
+	}
+	for name, data := range private {
+		if err := os.WriteFile(name, data, 0o600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newDevCA creates a certificate authority valid for ten years.
+func newDevCA() (*devCA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "toolkit development CA", Organization: []string{"toolkit development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &devCA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// loadDevCA reads a certificate authority written by WriteDevCert.
+func loadDevCA(certFile, keyFile string) (*devCA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, errors.New("devcert: invalid CA files")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &devCA{cert: cert, key: key, certPEM: certPEM, keyPEM: keyPEM}, nil
+}
+
+// issue creates a certificate for the hosts, valid for a year.
+func (ca *devCA) issue(hosts []string) (*DevCert, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hosts[0], Organization: []string{"toolkit development"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(1, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DevCert{
+		CA:   ca.certPEM,
+		Cert: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Key:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+// randomSerial returns a random 128-bit certificate serial number.
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestTools_GenerateDevCert(t *testing.T) {
+	var testTools Tools
+
+	cert, err := testTools.GenerateDevCert("app.test", "*.app.test", "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, _ := pem.Decode(cert.Cert)
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leaf.DNSNames) != 2 || len(leaf.IPAddresses) != 1 {
+		t.Errorf("expected 2 DNS names and 1 IP address, got %v %v", leaf.DNSNames, leaf.IPAddresses)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(cert.CA)
+	if _, err := leaf.Verify(x509.VerifyOptions{Roots: pool, DNSName: "api.app.test"}); err != nil {
+		t.Errorf("expected the certificate to chain to the CA, got %v", err)
+	}
+
+	// an HTTPS server with the certificate is trusted by a client trusting the CA
+	tlsCert, err := cert.TLSCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{tlsCert}}
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := io.ReadAll(res.Body); string(body) != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2 over TLS, got %s", body)
+	}
+}
+
+func TestTools_WriteDevCert(t *testing.T) {
+	var testTools Tools
+	dir := t.TempDir()
+
+	first, err := testTools.WriteDevCert(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := testTools.WriteDevCert(dir, "other.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(first.CA, second.CA) {
+		t.Error("expected the CA to be reused")
+	}
+	if bytes.Equal(first.Cert, second.Cert) {
+		t.Error("expected a new leaf certificate")
+	}
+
+	info, err := os.Stat(second.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the key to be private, got %v", info.Mode().Perm())
+	}
+	if _, err := tls.LoadX509KeyPair(second.CertFile, second.KeyFile); err != nil {
+		t.Errorf("expected loadable files, got %v", err)
+	}
+}
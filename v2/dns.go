@@ -0,0 +1,619 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoMailServer is returned by VerifyEmailDomain when an address's domain cannot receive mail.
+var ErrNoMailServer = errors.New("domain does not accept mail")
+
+// DNSResolver looks up DNS records. *net.Resolver implements it, and DNSCache adds caching to any resolver.
+type DNSResolver interface {
+	// LookupTXT returns the TXT records of name, each with its strings joined.
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	// LookupMX returns the MX records of name, sorted by preference.
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	// LookupHost returns the addresses of host.
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSCache is a DNSResolver that caches the results of another resolver. Names that do not exist are cached too,
+// for a shorter time, while other failures are not cached. Concurrent lookups of the same name share one query.
+// The zero value caches net.DefaultResolver. Tools uses a shared DNSCache unless Tools.Resolver is set.
+// Fields:
+// - Resolver: The resolver queried on a miss. Defaults to net.DefaultResolver.
+// - TTL: How long results are cached. Defaults to 5 minutes.
+// - NegativeTTL: How long missing names are cached. Defaults to 1 minute.
+type DNSCache struct {
+	Resolver    DNSResolver
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+	flights FlightGroup
+}
+
+type dnsCacheEntry struct {
+	value     interface{}
+	err       error
+	expiresAt time.Time
+}
+
+// defaultDNSCache is used by Tools when Tools.Resolver is nil.
+var defaultDNSCache = &DNSCache{}
+
+// LookupTXT returns the TXT records of name.
+func (c *DNSCache) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	v, err := c.lookup("txt", name, func(r DNSResolver) (interface{}, error) {
+		return r.LookupTXT(ctx, name)
+	})
+	records, _ := v.([]string)
+
+	return append([]string(nil), records...), err
+}
+
+// LookupMX returns the MX records of name.
+func (c *DNSCache) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	v, err := c.lookup("mx", name, func(r DNSResolver) (interface{}, error) {
+		return r.LookupMX(ctx, name)
+	})
+	records, _ := v.([]*net.MX)
+
+	out := make([]*net.MX, len(records))
+	for i, mx := range records {
+		cp := *mx
+		out[i] = &cp
+	}
+
+	return out, err
+}
+
+// LookupHost returns the addresses of host.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	v, err := c.lookup("host", host, func(r DNSResolver) (interface{}, error) {
+		return r.LookupHost(ctx, host)
+	})
+	addrs, _ := v.([]string)
+
+	return append([]string(nil), addrs...), err
+}
+
+// Flush removes every cached result.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+// lookup returns a cached result, or calls fn and caches its result.
+func (c *DNSCache) lookup(kind, name string, fn func(r DNSResolver) (interface{}, error)) (interface{}, error) {
+	key := kind + " " + strings.TrimSuffix(strings.ToLower(name), ".")
+	now := time.Now()
+
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expiresAt) {
+		c.mu.Unlock()
+		return e.value, e.err
+	}
+	c.mu.Unlock()
+
+	v, err, _ := c.flights.Do(key, func() (interface{}, error) {
+		resolver := c.Resolver
+		if resolver == nil {
+			resolver = net.DefaultResolver
+		}
+
+		v, err := fn(resolver)
+
+		ttl := c.TTL
+		if ttl <= 0 {
+			ttl = 5 * time.Minute
+		}
+		if isDNSNotFound(err) {
+			ttl = c.NegativeTTL
+			if ttl <= 0 {
+				ttl = time.Minute
+			}
+		} else if err != nil {
+			return v, err
+		}
+
+		c.mu.Lock()
+		if c.entries == nil {
+			c.entries = make(map[string]dnsCacheEntry)
+		}
+		c.entries[key] = dnsCacheEntry{value: v, err: err, expiresAt: time.Now().Add(ttl)}
+		c.mu.Unlock()
+
+		return v, err
+	})
+
+	return v, err
+}
+
+// isDNSNotFound reports whether err means the name or record does not exist.
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// resolver returns the resolver used by the DNS checks.
+func (t *Tools) resolver() DNSResolver {
+	if t.Resolver != nil {
+		return t.Resolver
+	}
+
+	return defaultDNSCache
+}
+
+// DNSCheck is the result of checking one part of a domain's email configuration.
+// Fields:
+// - Name: The DNS name that was queried, e.g. "_dmarc.example.com".
+// - Records: The records found.
+// - OK: Whether the configuration works. Warnings do not affect it.
+// - Problems: What is broken and how to fix it.
+// - Warnings: What works but should be improved.
+type DNSCheck struct {
+	Name     string   `json:"name"`
+	Records  []string `json:"records,omitempty"`
+	OK       bool     `json:"ok"`
+	Problems []string `json:"problems,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func (c *DNSCheck) problem(format string, args ...interface{}) {
+	c.Problems = append(c.Problems, fmt.Sprintf(format, args...))
+}
+
+func (c *DNSCheck) warn(format string, args ...interface{}) {
+	c.Warnings = append(c.Warnings, fmt.Sprintf(format, args...))
+}
+
+// finish sets OK and returns the check.
+func (c *DNSCheck) finish() *DNSCheck {
+	c.OK = len(c.Problems) == 0
+	return c
+}
+
+// lookupTXT returns the TXT records of name, treating a missing name as no records.
+func (t *Tools) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, err := t.resolver().LookupTXT(ctx, name)
+	if isDNSNotFound(err) {
+		return nil, nil
+	}
+
+	return records, err
+}
+
+// CheckMX checks that a domain can receive mail: it has MX records whose hosts resolve, or, without MX records, an
+// address that mail is delivered to instead.
+// Parameters:
+// - ctx: The context for the lookups.
+// - domain: The domain, e.g. "example.com".
+// Returns the check, or an error if a lookup failed for a reason other than the record not existing.
+func (t *Tools) CheckMX(ctx context.Context, domain string) (*DNSCheck, error) {
+	check := &DNSCheck{Name: domain}
+
+	records, err := t.resolver().LookupMX(ctx, domain)
+	if err != nil && !isDNSNotFound(err) {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		addrs, err := t.resolver().LookupHost(ctx, domain)
+		if err != nil && !isDNSNotFound(err) {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			check.problem("no MX record for %s: add an MX record pointing at your mail server", domain)
+		} else {
+			check.warn("no MX record for %s, so mail is delivered to its address %s: add an MX record to make this explicit", domain, addrs[0])
+		}
+
+		return check.finish(), nil
+	}
+
+	for _, mx := range records {
+		check.Records = append(check.Records, strconv.Itoa(int(mx.Pref))+" "+mx.Host)
+	}
+
+	if len(records) == 1 && (records[0].Host == "." || records[0].Host == "") {
+		check.problem("%s publishes a null MX record and does not accept mail", domain)
+		return check.finish(), nil
+	}
+
+	resolved := 0
+	for _, mx := range records {
+		addrs, err := t.resolver().LookupHost(ctx, mx.Host)
+		if err != nil && !isDNSNotFound(err) {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			check.warn("MX host %s does not resolve: fix or remove the record", mx.Host)
+			continue
+		}
+		resolved++
+	}
+	if resolved == 0 {
+		check.problem("none of the MX hosts of %s resolve, so mail cannot be delivered", domain)
+	}
+
+	return check.finish(), nil
+}
+
+// spfLookupLimit is the number of DNS lookups an SPF evaluation may cause (RFC 7208, section 4.6.4).
+const spfLookupLimit = 10
+
+// CheckSPF checks a domain's SPF record: that there is exactly one, that it does not allow everyone to send, that it
+// stays within the limit of 10 DNS lookups, and that it authorizes the given senders.
+// Parameters:
+// - ctx: The context for the lookups.
+// - domain: The sending domain, e.g. "example.com".
+// - includes: Domains the record must include, e.g. "_spf.google.com" or "amazonses.com" for the mail provider.
+// Returns the check, or an error if a lookup failed for a reason other than the record not existing.
+func (t *Tools) CheckSPF(ctx context.Context, domain string, includes ...string) (*DNSCheck, error) {
+	check := &DNSCheck{Name: domain}
+
+	records, err := t.spfRecords(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	check.Records = records
+
+	switch {
+	case len(records) == 0:
+		check.problem(`no SPF record for %s: add a TXT record such as "v=spf1 mx ~all"`, domain)
+		return check.finish(), nil
+	case len(records) > 1:
+		check.problem("%s has %d SPF records, which receivers treat as an error: merge them into one", domain, len(records))
+		return check.finish(), nil
+	}
+
+	terms := strings.Fields(records[0])[1:]
+
+	hasAll := false
+	for _, term := range terms {
+		lower := strings.ToLower(term)
+		switch strings.TrimLeft(lower, "+-~?") {
+		case "all":
+			hasAll = true
+			switch lower[0] {
+			case '+', 'a':
+				check.problem("%q allows anyone to send mail as %s: use ~all or -all", term, domain)
+			case '?':
+				check.warn("?all does not protect %s: use ~all or -all", domain)
+			}
+		case "ptr":
+			check.warn("the ptr mechanism is deprecated and slow: replace it with ip4, ip6 or include")
+		}
+		if strings.HasPrefix(lower, "redirect=") {
+			hasAll = true
+		}
+	}
+	if !hasAll {
+		check.warn("the SPF record does not end with an all mechanism: add ~all or -all")
+	}
+
+	for _, include := range includes {
+		found := false
+		for _, term := range terms {
+			if strings.EqualFold(strings.TrimLeft(term, "+"), "include:"+include) {
+				found = true
+			}
+		}
+		if !found {
+			check.problem("the SPF record does not authorize %s: add include:%s before the all mechanism", include, include)
+		}
+	}
+
+	lookups, err := t.spfLookups(ctx, records[0], 0)
+	if err != nil {
+		return nil, err
+	}
+	if lookups > spfLookupLimit {
+		check.problem("the SPF record needs %d DNS lookups, more than the limit of %d: flatten includes into ip4 and ip6 mechanisms", lookups, spfLookupLimit)
+	}
+
+	return check.finish(), nil
+}
+
+// spfRecords returns the SPF records among a domain's TXT records.
+func (t *Tools) spfRecords(ctx context.Context, domain string) ([]string, error) {
+	txt, err := t.lookupTXT(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []string
+	for _, r := range txt {
+		if lower := strings.ToLower(r); lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 ") {
+			records = append(records, r)
+		}
+	}
+
+	return records, nil
+}
+
+// spfLookups counts the DNS lookups evaluating an SPF record causes, following includes and redirects.
+func (t *Tools) spfLookups(ctx context.Context, record string, depth int) (int, error) {
+	count := 0
+	for _, term := range strings.Fields(record)[1:] {
+		term = strings.ToLower(strings.TrimLeft(term, "+-~?"))
+		name, target, _ := strings.Cut(term, ":")
+		if strings.HasPrefix(term, "redirect=") {
+			name, target = "redirect", strings.TrimPrefix(term, "redirect=")
+		}
+		name, _, _ = strings.Cut(name, "/")
+
+		switch name {
+		case "a", "mx", "ptr", "exists":
+			count++
+		case "include", "redirect":
+			count++
+			if depth >= spfLookupLimit {
+				continue
+			}
+			nested, err := t.spfRecords(ctx, target)
+			if err != nil {
+				return 0, err
+			}
+			if len(nested) == 1 {
+				n, err := t.spfLookups(ctx, nested[0], depth+1)
+				if err != nil {
+					return 0, err
+				}
+				count += n
+			}
+		}
+	}
+
+	return count, nil
+}
+
+// CheckDKIM checks the DKIM public key published for a selector: that it exists, is not revoked, parses, and is
+// long enough.
+// Parameters:
+// - ctx: The context for the lookups.
+// - domain: The signing domain, e.g. "example.com".
+// - selector: The selector given by the mail provider, e.g. "google" or "s1".
+// Returns the check, or an error if a lookup failed for a reason other than the record not existing.
+func (t *Tools) CheckDKIM(ctx context.Context, domain, selector string) (*DNSCheck, error) {
+	name := selector + "._domainkey." + domain
+	check := &DNSCheck{Name: name}
+
+	txt, err := t.lookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range txt {
+		if _, ok := parseDNSTags(r)["p"]; ok {
+			check.Records = append(check.Records, r)
+		}
+	}
+
+	switch {
+	case len(check.Records) == 0:
+		check.problem("no DKIM record at %s: publish the public key from your mail provider as a TXT record there", name)
+		return check.finish(), nil
+	case len(check.Records) > 1:
+		check.problem("%s has %d DKIM records: keep only one", name, len(check.Records))
+		return check.finish(), nil
+	}
+
+	tags := parseDNSTags(check.Records[0])
+	if v, ok := tags["v"]; ok && v != "DKIM1" {
+		check.problem("the DKIM record has version %q: it must be DKIM1", v)
+	}
+	if strings.Contains(tags["t"], "y") {
+		check.warn("the DKIM record is in testing mode (t=y): remove the flag once signing works")
+	}
+
+	p := tags["p"]
+	if p == "" {
+		check.problem("the DKIM key at %s is revoked (empty p=): publish the current key from your mail provider", name)
+		return check.finish(), nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p), ""))
+	if err != nil {
+		check.problem("the DKIM key at %s is not valid base64: copy it again from your mail provider", name)
+		return check.finish(), nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		// Ed25519 keys are published as the raw 32-byte key (RFC 8463)
+		if tags["k"] == "ed25519" && len(der) == ed25519.PublicKeySize {
+			return check.finish(), nil
+		}
+		check.problem("the DKIM key at %s cannot be parsed: copy it again from your mail provider", name)
+		return check.finish(), nil
+	}
+
+	if k, ok := key.(*rsa.PublicKey); ok {
+		switch bits := k.N.BitLen(); {
+		case bits < 1024:
+			check.problem("the DKIM key at %s has %d bits, which receivers reject: use a 2048-bit key", name, bits)
+		case bits < 2048:
+			check.warn("the DKIM key at %s has %d bits: rotate to a 2048-bit key", name, bits)
+		}
+	}
+
+	return check.finish(), nil
+}
+
+// CheckDMARC checks a domain's DMARC record: that there is exactly one, that it has a valid policy, and that
+// aggregate reports are sent somewhere.
+// Parameters:
+// - ctx: The context for the lookups.
+// - domain: The sending domain, e.g. "example.com".
+// Returns the check, or an error if a lookup failed for a reason other than the record not existing.
+func (t *Tools) CheckDMARC(ctx context.Context, domain string) (*DNSCheck, error) {
+	name := "_dmarc." + domain
+	check := &DNSCheck{Name: name}
+
+	txt, err := t.lookupTXT(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range txt {
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(r)), "V=DMARC1") {
+			check.Records = append(check.Records, r)
+		}
+	}
+
+	switch {
+	case len(check.Records) == 0:
+		check.problem(`no DMARC record for %s: add a TXT record at %s such as "v=DMARC1; p=none; rua=mailto:dmarc@%s"`, domain, name, domain)
+		return check.finish(), nil
+	case len(check.Records) > 1:
+		check.problem("%s has %d DMARC records, which receivers ignore: merge them into one", name, len(check.Records))
+		return check.finish(), nil
+	}
+
+	tags := parseDNSTags(check.Records[0])
+	switch p := strings.ToLower(tags["p"]); p {
+	case "quarantine", "reject":
+	case "none":
+		check.warn("the DMARC policy p=none only monitors: move to p=quarantine or p=reject once reports show mail passes")
+	case "":
+		check.problem("the DMARC record has no p= tag: add p=none to start monitoring")
+	default:
+		check.problem("the DMARC record has an invalid policy p=%s: use none, quarantine or reject", p)
+	}
+
+	if tags["rua"] == "" {
+		check.warn("the DMARC record has no rua= address, so no aggregate reports are sent: add rua=mailto:dmarc@%s", domain)
+	}
+	if pct, ok := tags["pct"]; ok && pct != "100" {
+		check.warn("the DMARC policy applies to only %s%% of mail: raise pct to 100", pct)
+	}
+
+	return check.finish(), nil
+}
+
+// parseDNSTags parses the "tag=value; tag=value" syntax of DKIM and DMARC records.
+func parseDNSTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		if ok {
+			tags[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+
+	return tags
+}
+
+// EmailDomainOptions configures CheckEmailDomain.
+// Fields:
+// - DKIMSelectors: The DKIM selectors to check. DKIM is not checked without them, because selectors cannot be
+// discovered.
+// - SPFIncludes: Domains the SPF record must include, e.g. "_spf.google.com".
+type EmailDomainOptions struct {
+	DKIMSelectors []string
+	SPFIncludes   []string
+}
+
+// EmailDomainReport is the result of CheckEmailDomain.
+// Fields:
+// - Domain: The domain checked.
+// - MX, SPF, DMARC: The checks of each part.
+// - DKIM: The checks of each selector.
+// - OK: Whether every check passed.
+type EmailDomainReport struct {
+	Domain string      `json:"domain"`
+	MX     *DNSCheck   `json:"mx"`
+	SPF    *DNSCheck   `json:"spf"`
+	DKIM   []*DNSCheck `json:"dkim,omitempty"`
+	DMARC  *DNSCheck   `json:"dmarc"`
+	OK     bool        `json:"ok"`
+}
+
+// Problems returns the problems of every check.
+func (r *EmailDomainReport) Problems() []string {
+	var problems []string
+	for _, c := range append([]*DNSCheck{r.MX, r.SPF, r.DMARC}, r.DKIM...) {
+		problems = append(problems, c.Problems...)
+	}
+
+	return problems
+}
+
+// CheckEmailDomain checks a sending domain's email configuration, so mail sent from it is delivered rather than
+// marked as spam, e.g. at startup or from an admin page.
+// Parameters:
+// - ctx: The context for the lookups.
+// - domain: The sending domain, e.g. "example.com".
+// - opts: Optional EmailDomainOptions. Only the first value is used if multiple are provided.
+// Returns the report, or an error if a lookup failed for a reason other than a record not existing.
+func (t *Tools) CheckEmailDomain(ctx context.Context, domain string, opts ...EmailDomainOptions) (*EmailDomainReport, error) {
+	var o EmailDomainOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	report := &EmailDomainReport{Domain: domain}
+
+	var err error
+	if report.MX, err = t.CheckMX(ctx, domain); err != nil {
+		return nil, err
+	}
+	if report.SPF, err = t.CheckSPF(ctx, domain, o.SPFIncludes...); err != nil {
+		return nil, err
+	}
+	if report.DMARC, err = t.CheckDMARC(ctx, domain); err != nil {
+		return nil, err
+	}
+	for _, selector := range o.DKIMSelectors {
+		check, err := t.CheckDKIM(ctx, domain, selector)
+		if err != nil {
+			return nil, err
+		}
+		report.DKIM = append(report.DKIM, check)
+	}
+
+	report.OK = len(report.Problems()) == 0
+
+	return report, nil
+}
+
+// VerifyEmailDomain checks that an email address's domain accepts mail, catching typos such as "gmial.com" that
+// the email validation rule cannot.
+// Parameters:
+// - ctx: The context for the lookups.
+// - address: The email address.
+// Returns nil if the domain accepts mail, an error wrapping ErrNoMailServer if it does not, or the lookup error.
+func (t *Tools) VerifyEmailDomain(ctx context.Context, address string) error {
+	addr, err := mail.ParseAddress(address)
+	if err != nil {
+		return err
+	}
+
+	domain := addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+
+	check, err := t.CheckMX(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if !check.OK {
+		return fmt.Errorf("%w: %s", ErrNoMailServer, domain)
+	}
+
+	return nil
+}
@@ -0,0 +1,283 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeDNS is a DNSResolver serving fixed records.
+type fakeDNS struct {
+	txt     map[string][]string
+	mx      map[string][]*net.MX
+	hosts   map[string][]string
+	queries atomic.Int32
+}
+
+func notFound(name string) error {
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (f *fakeDNS) LookupTXT(_ context.Context, name string) ([]string, error) {
+	f.queries.Add(1)
+	if r, ok := f.txt[name]; ok {
+		return r, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f *fakeDNS) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	f.queries.Add(1)
+	if r, ok := f.mx[name]; ok {
+		return r, nil
+	}
+	return nil, notFound(name)
+}
+
+func (f *fakeDNS) LookupHost(_ context.Context, name string) ([]string, error) {
+	f.queries.Add(1)
+	if r, ok := f.hosts[name]; ok {
+		return r, nil
+	}
+	return nil, notFound(name)
+}
+
+func dkimKey(t *testing.T, bits int) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func hasMessage(messages []string, substr string) bool {
+	for _, m := range messages {
+		if strings.Contains(m, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTools_CheckMX(t *testing.T) {
+	dns := &fakeDNS{
+		mx: map[string][]*net.MX{
+			"good.test":   {{Host: "mx.good.test.", Pref: 10}},
+			"broken.test": {{Host: "mx.nowhere.test.", Pref: 10}},
+			"null.test":   {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{"mx.good.test.": {"192.0.2.1"}, "implicit.test": {"192.0.2.2"}},
+	}
+	testTools := Tools{Resolver: dns}
+
+	var tests = []struct {
+		name    string
+		domain  string
+		ok      bool
+		message string
+	}{
+		{"mx", "good.test", true, ""},
+		{"implicit mx", "implicit.test", true, "no MX record"},
+		{"missing", "missing.test", false, "add an MX record"},
+		{"null mx", "null.test", false, "null MX"},
+		{"unresolvable", "broken.test", false, "does not resolve"},
+	}
+
+	for _, e := range tests {
+		check, err := testTools.CheckMX(context.Background(), e.domain)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if check.OK != e.ok {
+			t.Errorf("%s: expected ok %v, got %+v", e.name, e.ok, check)
+		}
+		if e.message != "" && !hasMessage(append(check.Problems, check.Warnings...), e.message) {
+			t.Errorf("%s: expected a message containing %q, got %+v", e.name, e.message, check)
+		}
+	}
+}
+
+func TestTools_CheckSPF(t *testing.T) {
+	txt := map[string][]string{
+		"good.test":      {"google-site-verification=abc", "v=spf1 include:_spf.mail.test -all"},
+		"_spf.mail.test": {"v=spf1 ip4:192.0.2.0/24 ~all"},
+		"open.test":      {"v=spf1 +all"},
+		"double.test":    {"v=spf1 mx ~all", "v=spf1 a ~all"},
+		"noall.test":     {"v=spf1 mx"},
+		"deep.test":      {"v=spf1 include:l1.test ~all"},
+	}
+	// a chain of includes each costing lookups
+	for i := 1; i <= 5; i++ {
+		txt["l"+string(rune('0'+i))+".test"] = []string{"v=spf1 a mx include:l" + string(rune('0'+i+1)) + ".test ~all"}
+	}
+	testTools := Tools{Resolver: &fakeDNS{txt: txt}}
+
+	var tests = []struct {
+		name     string
+		domain   string
+		includes []string
+		ok       bool
+		message  string
+	}{
+		{"valid", "good.test", []string{"_spf.mail.test"}, true, ""},
+		{"missing include", "good.test", []string{"amazonses.com"}, false, "include:amazonses.com"},
+		{"missing", "none.test", nil, false, "no SPF record"},
+		{"plus all", "open.test", nil, false, "allows anyone"},
+		{"multiple", "double.test", nil, false, "merge them"},
+		{"no all", "noall.test", nil, true, "does not end with an all"},
+		{"too many lookups", "deep.test", nil, false, "limit of 10"},
+	}
+
+	for _, e := range tests {
+		check, err := testTools.CheckSPF(context.Background(), e.domain, e.includes...)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if check.OK != e.ok {
+			t.Errorf("%s: expected ok %v, got %+v", e.name, e.ok, check)
+		}
+		if e.message != "" && !hasMessage(append(check.Problems, check.Warnings...), e.message) {
+			t.Errorf("%s: expected a message containing %q, got %+v", e.name, e.message, check)
+		}
+	}
+}
+
+func TestTools_CheckDKIM(t *testing.T) {
+	testTools := Tools{Resolver: &fakeDNS{txt: map[string][]string{
+		"s1._domainkey.good.test":    {"v=DKIM1; k=rsa; p=" + dkimKey(t, 2048)},
+		"s1._domainkey.short.test":   {"v=DKIM1; k=rsa; p=" + dkimKey(t, 1024)},
+		"s1._domainkey.revoked.test": {"v=DKIM1; p="},
+		"s1._domainkey.garbage.test": {"v=DKIM1; p=bm90IGEga2V5"},
+	}}}
+
+	var tests = []struct {
+		name    string
+		domain  string
+		ok      bool
+		message string
+	}{
+		{"valid", "good.test", true, ""},
+		{"short key", "short.test", true, "1024 bits"},
+		{"revoked", "revoked.test", false, "revoked"},
+		{"unparseable", "garbage.test", false, "cannot be parsed"},
+		{"missing", "none.test", false, "no DKIM record"},
+	}
+
+	for _, e := range tests {
+		check, err := testTools.CheckDKIM(context.Background(), e.domain, "s1")
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if check.OK != e.ok {
+			t.Errorf("%s: expected ok %v, got %+v", e.name, e.ok, check)
+		}
+		if e.message != "" && !hasMessage(append(check.Problems, check.Warnings...), e.message) {
+			t.Errorf("%s: expected a message containing %q, got %+v", e.name, e.message, check)
+		}
+	}
+}
+
+func TestTools_CheckDMARC(t *testing.T) {
+	testTools := Tools{Resolver: &fakeDNS{txt: map[string][]string{
+		"_dmarc.good.test":    {"v=DMARC1; p=reject; rua=mailto:dmarc@good.test"},
+		"_dmarc.monitor.test": {"v=DMARC1; p=none"},
+		"_dmarc.bad.test":     {"v=DMARC1; p=block"},
+	}}}
+
+	var tests = []struct {
+		name    string
+		domain  string
+		ok      bool
+		message string
+	}{
+		{"valid", "good.test", true, ""},
+		{"monitor only", "monitor.test", true, "p=none"},
+		{"invalid policy", "bad.test", false, "invalid policy"},
+		{"missing", "none.test", false, "_dmarc.none.test"},
+	}
+
+	for _, e := range tests {
+		check, err := testTools.CheckDMARC(context.Background(), e.domain)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if check.OK != e.ok {
+			t.Errorf("%s: expected ok %v, got %+v", e.name, e.ok, check)
+		}
+		if e.message != "" && !hasMessage(append(check.Problems, check.Warnings...), e.message) {
+			t.Errorf("%s: expected a message containing %q, got %+v", e.name, e.message, check)
+		}
+	}
+}
+
+func TestTools_CheckEmailDomain(t *testing.T) {
+	testTools := Tools{Resolver: &fakeDNS{
+		txt: map[string][]string{
+			"example.test":                 {"v=spf1 mx -all"},
+			"_dmarc.example.test":          {"v=DMARC1; p=quarantine; rua=mailto:d@example.test"},
+			"mail._domainkey.example.test": {"p=" + dkimKey(t, 2048)},
+		},
+		mx:    map[string][]*net.MX{"example.test": {{Host: "mx.example.test.", Pref: 10}}},
+		hosts: map[string][]string{"mx.example.test.": {"192.0.2.1"}},
+	}}
+
+	report, err := testTools.CheckEmailDomain(context.Background(), "example.test", EmailDomainOptions{DKIMSelectors: []string{"mail", "old"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || len(report.DKIM) != 2 || !report.DKIM[0].OK || report.DKIM[1].OK {
+		t.Errorf("expected only the old selector to fail, got %+v", report.Problems())
+	}
+}
+
+func TestTools_VerifyEmailDomain(t *testing.T) {
+	testTools := Tools{Resolver: &fakeDNS{
+		mx:    map[string][]*net.MX{"gmail.test": {{Host: "mx.gmail.test.", Pref: 5}}},
+		hosts: map[string][]string{"mx.gmail.test.": {"192.0.2.1"}},
+	}}
+
+	if err := testTools.VerifyEmailDomain(context.Background(), "Ann <ann@gmail.test>"); err != nil {
+		t.Errorf("expected a valid domain, got %v", err)
+	}
+	if err := testTools.VerifyEmailDomain(context.Background(), "ann@gmial.test"); !errors.Is(err, ErrNoMailServer) {
+		t.Errorf("expected ErrNoMailServer, got %v", err)
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	dns := &fakeDNS{txt: map[string][]string{"example.test": {"v=spf1 -all"}}}
+	cache := &DNSCache{Resolver: dns}
+	ctx := context.Background()
+
+	for _, name := range []string{"example.test", "Example.test.", "example.test"} {
+		if r, err := cache.LookupTXT(ctx, name); err != nil || len(r) != 1 {
+			t.Fatalf("expected a record, got %v %v", r, err)
+		}
+		if _, err := cache.LookupTXT(ctx, "missing.test"); !isDNSNotFound(err) {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+	if n := dns.queries.Load(); n != 2 {
+		t.Errorf("expected 2 queries, got %d", n)
+	}
+
+	cache.Flush()
+	_, _ = cache.LookupTXT(ctx, "example.test")
+	if n := dns.queries.Load(); n != 3 {
+		t.Errorf("expected a query after Flush, got %d", n)
+	}
+}
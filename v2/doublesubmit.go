@@ -0,0 +1,202 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DoubleSubmitOptions configures DoubleSubmitMiddleware. Routes needing different settings are wrapped with
+// middlewares of their own.
+// Fields:
+// - Window: How long a response is replayed to identical submissions. Defaults to 10 seconds.
+// - Methods: The methods checked. Defaults to POST.
+// - MaxBody: The largest body fingerprinted, in bytes; larger requests are passed through unchecked. Defaults to
+// 1 MB.
+// - MaxResponse: The largest response kept for replay, in bytes. Defaults to 1 MB.
+// - Key: Identifies the submitter. It defaults to the client IP and the Authorization, Cookie and User-Agent
+// headers, so submissions of different users never match.
+type DoubleSubmitOptions struct {
+	Window      time.Duration
+	Methods     []string
+	MaxBody     int64
+	MaxResponse int
+	Key         func(r *http.Request) string
+}
+
+// doubleSubmitEntry is a response kept for replay.
+type doubleSubmitEntry struct {
+	resp    *recordedResponse
+	expires time.Time
+}
+
+// DoubleSubmitMiddleware detects accidental double submissions, such as a form posted twice by a double click or
+// a reload, and answers them with the response of the first. Requests match when they come from the same
+// submitter with the same method, URL and body within the window; multipart boundaries are ignored, since browsers
+// pick a new one for every submission. A duplicate arriving while the first is still being handled waits for it.
+// Only responses below 400 are replayed, so a submission that failed can be retried at once, and replays carry an
+// "Idempotent-Replayed: true" header. Matched responses are buffered in memory.
+//
+// This is a heuristic for forms, not an idempotency guarantee: two intentional identical submissions within the
+// window are treated as one.
+// Parameters:
+// - opts: Optional DoubleSubmitOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) DoubleSubmitMiddleware(opts ...DoubleSubmitOptions) func(http.Handler) http.Handler {
+	var o DoubleSubmitOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Window <= 0 {
+		o.Window = 10 * time.Second
+	}
+	if len(o.Methods) == 0 {
+		o.Methods = []string{http.MethodPost}
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+	if o.MaxResponse <= 0 {
+		o.MaxResponse = 1 << 20
+	}
+	if o.Key == nil {
+		o.Key = doubleSubmitKey
+	}
+
+	var (
+		group     FlightGroup
+		mu        sync.Mutex
+		entries   = map[string]*doubleSubmitEntry{}
+		nextSweep time.Time
+	)
+
+	lookup := func(key string) *recordedResponse {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		if now.After(nextSweep) {
+			for k, e := range entries {
+				if now.After(e.expires) {
+					delete(entries, k)
+				}
+			}
+			nextSweep = now.Add(o.Window)
+		}
+
+		if e, ok := entries[key]; ok && now.Before(e.expires) {
+			return e.resp
+		}
+		return nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			checked := false
+			for _, m := range o.Methods {
+				checked = checked || strings.EqualFold(m, r.Method)
+			}
+			if !checked {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, ok := doubleSubmitFingerprint(r, o)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if resp := lookup(key); resp != nil {
+				writeDoubleSubmitReplay(w, resp, true)
+				return
+			}
+
+			leader := false
+			v, err, _ := group.Do(key, func() (interface{}, error) {
+				leader = true
+				rec := newResponseRecorder(nil)
+				next.ServeHTTP(rec, r)
+
+				if rec.status == 0 {
+					rec.status = http.StatusOK
+				}
+				resp := &recordedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes()}
+
+				if resp.status < http.StatusBadRequest && len(resp.body) <= o.MaxResponse {
+					mu.Lock()
+					entries[key] = &doubleSubmitEntry{resp: resp, expires: time.Now().Add(o.Window)}
+					mu.Unlock()
+				}
+
+				return resp, nil
+			})
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			writeDoubleSubmitReplay(w, v.(*recordedResponse), !leader)
+		})
+	}
+}
+
+// writeDoubleSubmitReplay writes a recorded response, marked as a replay if it answered another request.
+func writeDoubleSubmitReplay(w http.ResponseWriter, resp *recordedResponse, replayed bool) {
+	for k, vs := range resp.header {
+		w.Header()[k] = append([]string(nil), vs...)
+	}
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// doubleSubmitFingerprint hashes the submitter, method, URL, media type and body of r, restoring the body for the
+// handler. It reports false if the body is larger than MaxBody or cannot be read.
+func doubleSubmitFingerprint(r *http.Request, o DoubleSubmitOptions) (string, bool) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		data, err := io.ReadAll(io.LimitReader(r.Body, o.MaxBody+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+		if err != nil || int64(len(data)) > o.MaxBody {
+			return "", false
+		}
+		body = data
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if boundary := params["boundary"]; boundary != "" {
+		body = bytes.ReplaceAll(body, []byte(boundary), nil)
+	}
+
+	h := sha256.New()
+	for _, s := range []string{o.Key(r), r.Method, r.URL.String(), mediaType} {
+		_, _ = io.WriteString(h, s)
+		_, _ = h.Write([]byte{0})
+	}
+	_, _ = h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// doubleSubmitKey identifies the submitter of r by its client IP and the Authorization, Cookie and User-Agent
+// headers.
+func doubleSubmitKey(r *http.Request) string {
+	parts := []string{remoteIP(r)}
+	for _, h := range []string{"Authorization", "Cookie", "User-Agent"} {
+		parts = append(parts, strings.Join(r.Header.Values(h), ","))
+	}
+
+	return strings.Join(parts, "\n")
+}
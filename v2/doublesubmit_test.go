@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_DoubleSubmitMiddleware(t *testing.T) {
+	var testTools Tools
+	var calls atomic.Int32
+
+	handler := testTools.DoubleSubmitMiddleware(DoubleSubmitOptions{Window: 100 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		_ = r.ParseForm()
+		if r.FormValue("fail") != "" {
+			http.Error(w, "invalid", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/orders/%d", n))
+		w.WriteHeader(http.StatusSeeOther)
+	}))
+
+	post := func(body, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Cookie", cookie)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var tests = []struct {
+		name     string
+		body     string
+		cookie   string
+		wait     time.Duration
+		location string
+		replayed bool
+	}{
+		{"first submission", "item=1", "s=a", 0, "/orders/1", false},
+		{"double submission", "item=1", "s=a", 0, "/orders/1", true},
+		{"different body", "item=2", "s=a", 0, "/orders/2", false},
+		{"different user", "item=1", "s=b", 0, "/orders/3", false},
+		{"after the window", "item=1", "s=a", 150 * time.Millisecond, "/orders/4", false},
+		{"failed submission", "item=1&fail=1", "s=a", 0, "", false},
+		{"failed submission retried", "item=1&fail=1", "s=a", 0, "", false},
+	}
+
+	for _, e := range tests {
+		time.Sleep(e.wait)
+		rr := post(e.body, e.cookie)
+
+		if rr.Header().Get("Location") != e.location {
+			t.Errorf("%s: expected location %q, got %q", e.name, e.location, rr.Header().Get("Location"))
+		}
+		if replayed := rr.Header().Get("Idempotent-Replayed") == "true"; replayed != e.replayed {
+			t.Errorf("%s: expected replayed %v, got %v", e.name, e.replayed, replayed)
+		}
+	}
+	if calls.Load() != 6 {
+		t.Errorf("expected the handler to run 6 times, got %d", calls.Load())
+	}
+
+	// the body is still readable by the handler, and GET is not checked
+	if rr := post("item=9", "s=c"); rr.Code != http.StatusSeeOther {
+		t.Errorf("expected the handler to read the body, got %d", rr.Code)
+	}
+	req := httptest.NewRequest("GET", "/orders", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if calls.Load() != 9 {
+		t.Errorf("expected GET requests to be passed through, got %d calls", calls.Load())
+	}
+}
+
+func TestTools_DoubleSubmitMiddlewareConcurrent(t *testing.T) {
+	var testTools Tools
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	handler := testTools.DoubleSubmitMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	// browsers choose a new multipart boundary for each submission
+	submit := func() *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		_ = mw.WriteField("title", "hello")
+		_ = mw.Close()
+
+		req := httptest.NewRequest("POST", "/posts", &buf)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = submit()
+		}(i)
+	}
+
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	replays := 0
+	for _, rr := range results {
+		if rr.Body.String() != "created" {
+			t.Errorf("expected every submission to get the response, got %q", rr.Body.String())
+		}
+		if rr.Header().Get("Idempotent-Replayed") == "true" {
+			replays++
+		}
+	}
+	if calls.Load() != 1 || replays != 2 {
+		t.Errorf("expected one call and two replays, got %d and %d", calls.Load(), replays)
+	}
+}
@@ -0,0 +1,285 @@
+package toolkit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDecrypt is returned when a ciphertext cannot be decrypted: it was tampered with, truncated or encrypted with
+// another key.
+var ErrDecrypt = errors.New("decryption failed")
+
+// ErrNoEncryptionKey is returned by encrypted field types when neither SetEncryptionKey nor SetEncryptionKeyring
+// was called.
+var ErrNoEncryptionKey = errors.New("no encryption key set")
+
+// Encrypt encrypts and authenticates plaintext with AES-GCM.
+// Parameters:
+// - key: The key, 16, 24 or 32 random bytes for AES-128, AES-192 or AES-256.
+// - plaintext: The data to encrypt.
+// Returns the random nonce followed by the ciphertext, or an error if the key has an invalid length.
+func Encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt.
+// Parameters:
+// - key: The key the data was encrypted with.
+// - ciphertext: The nonce and ciphertext returned by Encrypt.
+// Returns the plaintext, or an error wrapping ErrDecrypt.
+func Decrypt(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+
+	plaintext, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+
+	return plaintext, nil
+}
+
+// newGCM returns an AES-GCM cipher for key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+var (
+	fieldKeyMu   sync.RWMutex
+	fieldKeyring *Keyring
+)
+
+// SetEncryptionKey sets the key used by EncryptedString and EncryptedJSON. Their methods are called by
+// encoding/json and database/sql, which cannot pass a key, so it is set once for the process at startup. To rotate
+// keys, use SetEncryptionKeyring instead.
+// Parameters:
+// - key: The AES key, 16, 24 or 32 random bytes.
+// Returns an error if the key has an invalid length.
+func SetEncryptionKey(key []byte) error {
+	kr, err := NewKeyring(Key{ID: "default", Secret: key})
+	if err != nil {
+		return err
+	}
+
+	SetEncryptionKeyring(kr)
+
+	return nil
+}
+
+// SetEncryptionKeyring sets the keyring used by EncryptedString and EncryptedJSON. New values are encrypted with
+// its active key, and values encrypted with any of its keys, or with a key passed to SetEncryptionKey, are
+// decrypted.
+func SetEncryptionKeyring(kr *Keyring) {
+	fieldKeyMu.Lock()
+	fieldKeyring = kr
+	fieldKeyMu.Unlock()
+}
+
+// encryptionKeyring returns the keyring set for encrypted fields.
+func encryptionKeyring() (*Keyring, error) {
+	fieldKeyMu.RLock()
+	defer fieldKeyMu.RUnlock()
+
+	if fieldKeyring == nil {
+		return nil, ErrNoEncryptionKey
+	}
+
+	return fieldKeyring, nil
+}
+
+// encryptField encrypts a field value to base64 text.
+func encryptField(plaintext []byte) (string, error) {
+	kr, err := encryptionKeyring()
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := kr.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptField decrypts base64 text produced by encryptField.
+func decryptField(text string) ([]byte, error) {
+	kr, err := encryptionKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := base64.RawStdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid encoding", ErrDecrypt)
+	}
+
+	return kr.Decrypt(ciphertext)
+}
+
+// scanText returns the text of a database value.
+func scanText(src interface{}) (string, bool, error) {
+	switch v := src.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case []byte:
+		return string(v), true, nil
+	default:
+		return "", false, fmt.Errorf("cannot scan %T into an encrypted field", src)
+	}
+}
+
+// EncryptedString is a string stored encrypted, e.g. a national ID or phone number. It is encrypted with the key
+// set by SetEncryptionKey or SetEncryptionKeyring when marshaled to JSON or written to a database, and decrypted
+// when unmarshaled or scanned, so the plaintext only exists in memory. Each encryption uses a random nonce, so
+// equal values have different ciphertexts and the column cannot be searched or indexed.
+type EncryptedString string
+
+// MarshalJSON encrypts the string to a JSON string.
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	text, err := encryptField([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(text)
+}
+
+// UnmarshalJSON decrypts a JSON string produced by MarshalJSON.
+func (s *EncryptedString) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	plaintext, err := decryptField(text)
+	if err != nil {
+		return err
+	}
+
+	*s = EncryptedString(plaintext)
+
+	return nil
+}
+
+// Value encrypts the string for a text column.
+func (s EncryptedString) Value() (driver.Value, error) {
+	return encryptField([]byte(s))
+}
+
+// Scan decrypts a value written by Value. NULL scans as the empty string.
+func (s *EncryptedString) Scan(src interface{}) error {
+	text, ok, err := scanText(src)
+	if err != nil || !ok {
+		*s = ""
+		return err
+	}
+
+	plaintext, err := decryptField(text)
+	if err != nil {
+		return err
+	}
+
+	*s = EncryptedString(plaintext)
+
+	return nil
+}
+
+// EncryptedJSON holds a value stored encrypted as JSON, e.g. an address or a medical record. Like EncryptedString,
+// V is encrypted when marshaled or written to a database and decrypted when unmarshaled or scanned.
+type EncryptedJSON[T any] struct {
+	V T
+}
+
+// MarshalJSON encrypts the JSON encoding of V to a JSON string.
+func (e EncryptedJSON[T]) MarshalJSON() ([]byte, error) {
+	text, err := e.encrypt()
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(text)
+}
+
+// UnmarshalJSON decrypts a JSON string produced by MarshalJSON into V.
+func (e *EncryptedJSON[T]) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+
+	return e.decrypt(text)
+}
+
+// Value encrypts the JSON encoding of V for a text column.
+func (e EncryptedJSON[T]) Value() (driver.Value, error) {
+	return e.encrypt()
+}
+
+// Scan decrypts a value written by Value into V. NULL scans as the zero value.
+func (e *EncryptedJSON[T]) Scan(src interface{}) error {
+	text, ok, err := scanText(src)
+	if err != nil || !ok {
+		var zero T
+		e.V = zero
+		return err
+	}
+
+	return e.decrypt(text)
+}
+
+// encrypt returns the encrypted JSON encoding of V.
+func (e EncryptedJSON[T]) encrypt() (string, error) {
+	data, err := json.Marshal(e.V)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptField(data)
+}
+
+// decrypt sets V from encrypted text.
+func (e *EncryptedJSON[T]) decrypt(text string) error {
+	plaintext, err := decryptField(text)
+	if err != nil {
+		return err
+	}
+
+	var v T
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return err
+	}
+	e.V = v
+
+	return nil
+}
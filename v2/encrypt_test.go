@@ -0,0 +1,94 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+
+	ciphertext, err := Encrypt(key, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("secret")) {
+		t.Error("expected the plaintext to be hidden")
+	}
+
+	plaintext, err := Decrypt(key, ciphertext)
+	if err != nil || string(plaintext) != "secret" {
+		t.Errorf("expected secret, got %q, %v", plaintext, err)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := Decrypt(key, ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for tampered data, got %v", err)
+	}
+	if _, err := Decrypt(bytes.Repeat([]byte{2}, 32), ciphertext); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for another key, got %v", err)
+	}
+	if _, err := Encrypt([]byte("short"), nil); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+type patient struct {
+	Name    string                 `json:"name"`
+	SSN     EncryptedString        `json:"ssn"`
+	Address EncryptedJSON[address] `json:"address"`
+}
+
+type address struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+func TestEncryptedFields(t *testing.T) {
+	if err := SetEncryptionKey(bytes.Repeat([]byte{7}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	in := patient{Name: "Ann", SSN: "123-45-6789", Address: EncryptedJSON[address]{V: address{Street: "1 Main St", City: "Springfield"}}}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "6789") || strings.Contains(string(data), "Springfield") {
+		t.Errorf("expected encrypted fields, got %s", data)
+	}
+
+	var out patient
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out != in {
+		t.Errorf("expected %+v, got %+v", in, out)
+	}
+
+	value, err := in.SSN.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scanned EncryptedString
+	if err := scanned.Scan([]byte(value.(string))); err != nil || scanned != in.SSN {
+		t.Errorf("expected the scanned value to round-trip, got %q, %v", scanned, err)
+	}
+	if err := scanned.Scan(nil); err != nil || scanned != "" {
+		t.Errorf("expected NULL to scan as empty, got %q, %v", scanned, err)
+	}
+
+	addrValue, _ := in.Address.Value()
+	var addr EncryptedJSON[address]
+	if err := addr.Scan(addrValue); err != nil || addr.V != in.Address.V {
+		t.Errorf("expected the scanned address to round-trip, got %+v, %v", addr.V, err)
+	}
+
+	if err := scanned.Scan("bm90IGVuY3J5cHRlZA"); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt for a plaintext column, got %v", err)
+	}
+}
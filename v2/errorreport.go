@@ -0,0 +1,448 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// ErrorReporter sends server errors to an error tracking service. Set it as Tools.ErrorReporter to receive the
+// panics recovered by RecoverMiddleware and the 5xx errors written by ErrorJSON.
+type ErrorReporter interface {
+	ReportError(ctx context.Context, report ErrorReport) error
+}
+
+// ErrorReporterFunc adapts a function to the ErrorReporter interface.
+type ErrorReporterFunc func(ctx context.Context, report ErrorReport) error
+
+// ReportError calls f(ctx, report).
+func (f ErrorReporterFunc) ReportError(ctx context.Context, report ErrorReport) error {
+	return f(ctx, report)
+}
+
+// StackFrame is a function call in an ErrorReport's stack trace.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// ErrorRequest describes the request during which an error happened. Sensitive headers and query parameters are
+// redacted with the default Redactor.
+// Fields:
+// - Method: The request's method.
+// - URL: The request's absolute URL.
+// - Header: The request's headers.
+// - RemoteAddr: The client's address.
+type ErrorRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Header     http.Header `json:"header,omitempty"`
+	RemoteAddr string      `json:"remote_addr,omitempty"`
+}
+
+// ErrorReport describes a server error.
+// Fields:
+// - ID: A random identifier of the report, 32 hex characters.
+// - Time: When the error happened.
+// - Message: The error's message, or the panic's value.
+// - Type: The Go type of the innermost wrapped error, or of the panic's value, e.g. "*net.OpError".
+// - Panic: Whether the error is a recovered panic.
+// - Status: The HTTP status answered.
+// - Stack: Where the panic happened, or where ErrorJSON was called, innermost call first.
+// - Request: The request being served, when known.
+// - User: The ID of the request's Subject, if any.
+type ErrorReport struct {
+	ID      string        `json:"id"`
+	Time    time.Time     `json:"time"`
+	Message string        `json:"message"`
+	Type    string        `json:"type"`
+	Panic   bool          `json:"panic"`
+	Status  int           `json:"status"`
+	Stack   []StackFrame  `json:"stack,omitempty"`
+	Request *ErrorRequest `json:"request,omitempty"`
+	User    string        `json:"user,omitempty"`
+}
+
+// newErrorReport builds a report for a request, which may be nil, capturing the stack above skip frames.
+func newErrorReport(r *http.Request, message, typ string, status, skip int) ErrorReport {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	report := ErrorReport{
+		ID:      hex.EncodeToString(id),
+		Time:    time.Now().UTC(),
+		Message: message,
+		Type:    typ,
+		Status:  status,
+		Stack:   captureStack(skip + 1),
+	}
+
+	if r != nil {
+		rd := NewRedactor()
+		u := *r.URL
+		u.RawQuery = rd.RedactValues(u.Query()).Encode()
+		if u.Host == "" {
+			u.Scheme, u.Host = "http", r.Host
+			if r.TLS != nil {
+				u.Scheme = "https"
+			}
+		}
+
+		report.Request = &ErrorRequest{
+			Method:     r.Method,
+			URL:        u.String(),
+			Header:     rd.RedactHeader(r.Header),
+			RemoteAddr: r.RemoteAddr,
+		}
+		if s, ok := SubjectFromContext(r.Context()); ok {
+			report.User = s.ID
+		}
+	}
+
+	return report
+}
+
+// captureStack returns the calls above skip frames, leaving out the runtime's own frames, such as the panic.
+func captureStack(skip int) []StackFrame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var stack []StackFrame
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			stack = append(stack, StackFrame{Function: f.Function, File: f.File, Line: f.Line})
+		}
+		if !more {
+			break
+		}
+	}
+
+	return stack
+}
+
+// errorType returns the type of the innermost error wrapped by err.
+func errorType(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = inner
+	}
+}
+
+// reportError sends a report to Tools.ErrorReporter in the background, so a slow service does not delay the
+// response.
+func (t *Tools) reportError(ctx context.Context, report ErrorReport) {
+	reporter := t.ErrorReporter
+	if reporter == nil {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+
+		if err := reporter.ReportError(ctx, report); err != nil {
+			slog.Default().WarnContext(ctx, "error report failed", slog.String("report", report.ID), slog.String("error", err.Error()))
+		}
+	}()
+}
+
+// RecoverMiddleware recovers from panics in handlers, answering 500 Internal Server Error as JSON instead of
+// dropping the connection. Panics are logged with slog.Default() and sent to Tools.ErrorReporter with their stack
+// and request. If the handler had already started its response, the response is aborted instead, as it cannot be
+// replaced. It also lets ErrorJSON include the request in the reports of 5xx errors, so it should be the outermost
+// middleware.
+// Returns the middleware.
+func (t *Tools) RecoverMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := &requestWriter{statusWriter: newStatusWriter(w), r: r}
+
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+
+				message := fmt.Sprint(p)
+				if err, ok := p.(error); ok {
+					message = err.Error()
+				}
+
+				report := newErrorReport(r, message, fmt.Sprintf("%T", p), http.StatusInternalServerError, 1)
+				report.Panic = true
+				slog.Default().ErrorContext(r.Context(), "panic serving request",
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("panic", message),
+					slog.String("report", report.ID),
+					slog.String("stack", string(debug.Stack())),
+				)
+				t.reportError(r.Context(), report)
+
+				if rw.status != 0 {
+					panic(http.ErrAbortHandler)
+				}
+				_ = t.WriteJSON(rw, http.StatusInternalServerError, JSONResponse{Error: true, Message: http.StatusText(http.StatusInternalServerError)})
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// requestWriter carries the request to ErrorJSON, which only sees the response writer.
+type requestWriter struct {
+	*statusWriter
+	r *http.Request
+}
+
+// Request returns the request being served.
+func (rw *requestWriter) Request() *http.Request {
+	return rw.r
+}
+
+// writerRequest returns the request carried by w or a writer it wraps.
+func writerRequest(w http.ResponseWriter) *http.Request {
+	for w != nil {
+		if rw, ok := w.(interface{ Request() *http.Request }); ok {
+			return rw.Request()
+		}
+
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	return nil
+}
+
+// buildRelease returns the main module's version, or its VCS revision for development builds.
+func buildRelease() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+
+	return ""
+}
+
+// HTTPErrorReporter is an ErrorReporter posting reports as JSON to a URL: the ErrorReport's fields, with
+// "release", "environment" and "tags" added. When a secret is set, the body's HMAC-SHA256 is sent in the
+// X-Signature-256 header as "sha256=<hex>".
+// Fields:
+// - URL: Where reports are posted.
+// - Secret: If set, the HMAC key signing the body.
+// - Release: The application's version. Defaults to the version or VCS revision in the binary's build info.
+// - Environment: The deployment, e.g. "production".
+// - Tags: Extra tags, e.g. {"region": "eu-west-1"}.
+// - Client: The HTTP client. Defaults to one with a 10 second timeout.
+type HTTPErrorReporter struct {
+	URL         string
+	Secret      []byte
+	Release     string
+	Environment string
+	Tags        map[string]string
+	Client      *http.Client
+}
+
+// ReportError posts the report.
+// Returns an error if the request fails or the receiver does not answer with a 2xx status.
+func (h *HTTPErrorReporter) ReportError(ctx context.Context, report ErrorReport) error {
+	release := h.Release
+	if release == "" {
+		release = buildRelease()
+	}
+
+	body, err := json.Marshal(struct {
+		ErrorReport
+		Release     string            `json:"release,omitempty"`
+		Environment string            `json:"environment,omitempty"`
+		Tags        map[string]string `json:"tags,omitempty"`
+	}{report, release, h.Environment, h.Tags})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	if len(h.Secret) > 0 {
+		header.Set("X-Signature-256", "sha256="+hex.EncodeToString(hmacSHA256(h.Secret, body)))
+	}
+
+	return postReport(ctx, h.Client, h.URL, header, body)
+}
+
+// postReport posts a report body and checks the answer.
+func postReport(ctx context.Context, client *http.Client, uri string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error report: %s answered %s", req.URL.Redacted(), resp.Status)
+	}
+
+	return nil
+}
+
+// SentryReporter is an ErrorReporter sending reports to Sentry, or a service speaking its protocol, as events in
+// an envelope.
+// Fields:
+// - Release: The application's version. Defaults to the version or VCS revision in the binary's build info.
+// - Environment: The deployment, e.g. "production".
+// - Tags: Extra tags, e.g. {"region": "eu-west-1"}. The HTTP status is added as "status".
+// - Client: The HTTP client. Defaults to one with a 10 second timeout.
+type SentryReporter struct {
+	Release     string
+	Environment string
+	Tags        map[string]string
+	Client      *http.Client
+
+	dsn      string
+	endpoint string
+	key      string
+}
+
+// NewSentryReporter creates a SentryReporter for a project's DSN.
+// Parameters:
+// - dsn: The project's DSN, e.g. "https://<key>@o0.ingest.sentry.io/<project>".
+// Returns a pointer to the new SentryReporter, or an error if the DSN is invalid.
+func NewSentryReporter(dsn string) (*SentryReporter, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry DSN: %w", err)
+	}
+
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil || u.User.Username() == "" || project == "" {
+		return nil, errors.New("invalid sentry DSN: expected scheme://key@host/project")
+	}
+
+	return &SentryReporter{
+		dsn:      dsn,
+		endpoint: u.Scheme + "://" + u.Host + u.Path[:i] + "/api/" + project + "/envelope/",
+		key:      u.User.Username(),
+	}, nil
+}
+
+// ReportError sends the report as a Sentry event.
+// Returns an error if the request fails or Sentry does not answer with a 2xx status.
+func (s *SentryReporter) ReportError(ctx context.Context, report ErrorReport) error {
+	release := s.Release
+	if release == "" {
+		release = buildRelease()
+	}
+
+	tags := map[string]string{}
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if report.Status != 0 {
+		tags["status"] = fmt.Sprint(report.Status)
+	}
+
+	// Sentry lists frames outermost first
+	frames := make([]map[string]interface{}, 0, len(report.Stack))
+	for i := len(report.Stack) - 1; i >= 0; i-- {
+		f := report.Stack[i]
+		frames = append(frames, map[string]interface{}{"function": f.Function, "abs_path": f.File, "lineno": f.Line})
+	}
+
+	level, mechanism := "error", "generic"
+	if report.Panic {
+		level, mechanism = "fatal", "panic"
+	}
+
+	event := map[string]interface{}{
+		"event_id":    report.ID,
+		"timestamp":   report.Time.Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       level,
+		"release":     release,
+		"environment": s.Environment,
+		"tags":        tags,
+		"exception": map[string]interface{}{"values": []interface{}{map[string]interface{}{
+			"type":       report.Type,
+			"value":      report.Message,
+			"mechanism":  map[string]interface{}{"type": mechanism, "handled": !report.Panic},
+			"stacktrace": map[string]interface{}{"frames": frames},
+		}}},
+	}
+	if report.Request != nil {
+		headers := map[string]string{}
+		for k := range report.Request.Header {
+			headers[k] = report.Request.Header.Get(k)
+		}
+		event["request"] = map[string]interface{}{"method": report.Request.Method, "url": report.Request.URL, "headers": headers}
+	}
+	if report.User != "" {
+		event["user"] = map[string]string{"id": report.User}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	envelope, _ := json.Marshal(map[string]string{"event_id": report.ID, "dsn": s.dsn, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	item, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+	body.Write(envelope)
+	body.WriteByte('\n')
+	body.Write(item)
+	body.WriteByte('\n')
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	header := http.Header{
+		"Content-Type":  {"application/x-sentry-envelope"},
+		"X-Sentry-Auth": {"Sentry sentry_version=7, sentry_client=toolkit-go/2, sentry_key=" + s.key},
+	}
+
+	return postReport(ctx, s.Client, s.endpoint, header, body.Bytes())
+}
@@ -0,0 +1,200 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reportChannel returns an ErrorReporter delivering reports to a channel.
+func reportChannel() (ErrorReporter, chan ErrorReport) {
+	ch := make(chan ErrorReport, 1)
+
+	return ErrorReporterFunc(func(_ context.Context, report ErrorReport) error {
+		ch <- report
+		return nil
+	}), ch
+}
+
+// awaitReport waits for a report, or fails the test.
+func awaitReport(t *testing.T, ch chan ErrorReport) ErrorReport {
+	t.Helper()
+
+	select {
+	case report := <-ch:
+		return report
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an error report")
+		return ErrorReport{}
+	}
+}
+
+func TestTools_RecoverMiddleware(t *testing.T) {
+	reporter, reports := reportChannel()
+	testTools := Tools{ErrorReporter: reporter}
+
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	handler := testTools.RecoverMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic(fmt.Errorf("boom: %w", errors.New("nil map")))
+		case "/partial":
+			w.WriteHeader(http.StatusOK)
+			panic("too late")
+		case "/fail":
+			_ = testTools.ErrorJSON(w, errors.New("database unavailable"), http.StatusServiceUnavailable)
+		default:
+			_ = testTools.ErrorJSON(w, errors.New("bad input"))
+		}
+	}))
+
+	req := httptest.NewRequest("GET", "/panic?token=secret&page=2", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError || strings.Contains(rr.Body.String(), "boom") {
+		t.Errorf("expected a generic 500 response, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	report := awaitReport(t, reports)
+	if !report.Panic || report.Message != "boom: nil map" || report.Type != "*fmt.wrapError" || report.Status != 500 || len(report.ID) != 32 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if report.Request == nil || report.Request.URL != "http://example.com/panic?page=2&token=%5BREDACTED%5D" || report.Request.Header.Get("Authorization") != "[REDACTED]" {
+		t.Errorf("expected the redacted request in the report, got %+v", report.Request)
+	}
+	if len(report.Stack) == 0 || !strings.Contains(report.Stack[0].Function, "TestTools_RecoverMiddleware") {
+		t.Errorf("expected the stack to start at the panic, got %+v", report.Stack)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/fail", nil))
+	report = awaitReport(t, reports)
+	if rr.Code != http.StatusServiceUnavailable || report.Panic || report.Type != "*errors.errorString" || report.Request == nil || report.Status != 503 {
+		t.Errorf("expected ErrorJSON to report 5xx errors with the request, got %d, %+v", rr.Code, report)
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/bad", nil))
+	select {
+	case report := <-reports:
+		t.Errorf("expected 4xx errors not to be reported, got %+v", report)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Errorf("expected a panic after the response started to abort it, got %v", p)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/partial", nil))
+	}()
+	awaitReport(t, reports)
+}
+
+func TestHTTPErrorReporter(t *testing.T) {
+	var body map[string]interface{}
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature-256")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer srv.Close()
+
+	reporter := &HTTPErrorReporter{URL: srv.URL, Secret: []byte("k"), Release: "1.2.3", Environment: "production", Tags: map[string]string{"region": "eu"}}
+	report := newErrorReport(nil, "boom", "*errors.errorString", 500, 0)
+	if err := reporter.ReportError(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+
+	if body["message"] != "boom" || body["release"] != "1.2.3" || body["environment"] != "production" || body["tags"].(map[string]interface{})["region"] != "eu" {
+		t.Errorf("unexpected envelope %v", body)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("expected a signature, got %q", signature)
+	}
+}
+
+func TestSentryReporter(t *testing.T) {
+	var auth, path string
+	var lines []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, path = r.Header.Get("X-Sentry-Auth"), r.URL.Path
+		data, _ := io.ReadAll(r.Body)
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1<<20)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}))
+	defer srv.Close()
+
+	for _, dsn := range []string{"", "ftp://key@host/1", "https://host/1", "https://key@host/"} {
+		if _, err := NewSentryReporter(dsn); err == nil {
+			t.Errorf("%q: expected an invalid DSN to fail", dsn)
+		}
+	}
+
+	reporter, err := NewSentryReporter(strings.Replace(srv.URL, "http://", "http://public@", 1) + "/sentry/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter.Release = "1.2.3"
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req = req.WithContext(WithSubject(req.Context(), Subject{ID: "u1"}))
+	report := newErrorReport(req, "boom", "string", 500, 0)
+	report.Panic = true
+	if err := reporter.ReportError(context.Background(), report); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/sentry/api/42/envelope/" || !strings.Contains(auth, "sentry_key=public") {
+		t.Errorf("unexpected endpoint %q or auth %q", path, auth)
+	}
+	if len(lines) != 3 || !strings.Contains(lines[1], `"type":"event"`) {
+		t.Fatalf("expected an envelope with one event, got %q", lines)
+	}
+
+	var event struct {
+		EventID   string            `json:"event_id"`
+		Level     string            `json:"level"`
+		Release   string            `json:"release"`
+		Tags      map[string]string `json:"tags"`
+		User      map[string]string `json:"user"`
+		Exception struct {
+			Values []struct {
+				Value      string `json:"value"`
+				Stacktrace struct {
+					Frames []map[string]interface{} `json:"frames"`
+				} `json:"stacktrace"`
+			} `json:"values"`
+		} `json:"exception"`
+		Request map[string]interface{} `json:"request"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.EventID != report.ID || event.Level != "fatal" || event.Release != "1.2.3" || event.Tags["status"] != "500" || event.User["id"] != "u1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+	if len(event.Exception.Values) != 1 || event.Exception.Values[0].Value != "boom" || len(event.Exception.Values[0].Stacktrace.Frames) == 0 {
+		t.Errorf("unexpected exception %+v", event.Exception)
+	}
+	if event.Request["url"] != "http://example.com/orders" {
+		t.Errorf("unexpected request %v", event.Request)
+	}
+}
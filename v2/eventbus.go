@@ -0,0 +1,213 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBusClosed is returned when publishing to a closed EventBus.
+var ErrBusClosed = errors.New("event bus is closed")
+
+// Event is a message delivered by the EventBus.
+type Event struct {
+	Topic   string
+	Payload interface{}
+	Time    time.Time
+}
+
+// EventHandler processes events delivered to a subscription.
+type EventHandler func(ctx context.Context, e Event) error
+
+// EventBus is an in-process publish/subscribe bus. Topics are dot-separated, e.g. "upload.completed", and
+// subscription patterns may use "*" to match exactly one segment and a trailing ">" to match one or more segments,
+// e.g. "upload.*" or "user.>". Each subscription has its own buffered queue and goroutine, so a slow subscriber
+// does not delay the others, and events are delivered to it in publication order.
+// Fields:
+// - BufferSize: The queue length of each subscription. Defaults to 64. Publish blocks while a matching queue is full.
+// - ErrorLog: An optional callback receiving handler errors and recovered panics.
+type EventBus struct {
+	BufferSize int
+	ErrorLog   func(topic string, err error)
+
+	mu     sync.RWMutex
+	subs   map[*subscription]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+type subscription struct {
+	pattern []string
+	handler EventHandler
+	queue   chan Event
+}
+
+// NewEventBus creates an EventBus.
+// Parameters:
+// - bufferSize: The queue length of each subscription; 0 uses the default of 64.
+// Returns a pointer to the new EventBus.
+func NewEventBus(bufferSize int) *EventBus {
+	return &EventBus{BufferSize: bufferSize, subs: make(map[*subscription]struct{})}
+}
+
+// Subscribe registers handler for every event whose topic matches pattern.
+// Parameters:
+// - pattern: The topic pattern, e.g. "upload.completed", "upload.*" or "user.>".
+// - handler: The function processing events.
+// Returns a function removing the subscription; events already queued are still delivered.
+func (b *EventBus) Subscribe(pattern string, handler EventHandler) (unsubscribe func()) {
+	size := b.BufferSize
+	if size <= 0 {
+		size = 64
+	}
+
+	sub := &subscription{
+		pattern: strings.Split(pattern, "."),
+		handler: handler,
+		queue:   make(chan Event, size),
+	}
+
+	b.mu.Lock()
+	if b.subs == nil {
+		b.subs = make(map[*subscription]struct{})
+	}
+	if b.closed {
+		b.mu.Unlock()
+		return func() {}
+	}
+	b.subs[sub] = struct{}{}
+	b.wg.Add(1)
+	b.mu.Unlock()
+
+	go b.deliver(sub)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub.queue)
+		}
+	}
+}
+
+// SubscribeTyped registers a handler receiving payloads of type T only. Events with other payload types on
+// matching topics are ignored by this subscription.
+// Parameters:
+// - b: The EventBus to subscribe to.
+// - pattern: The topic pattern.
+// - handler: The function processing typed payloads.
+// Returns a function removing the subscription.
+func SubscribeTyped[T any](b *EventBus, pattern string, handler func(ctx context.Context, topic string, payload T) error) (unsubscribe func()) {
+	return b.Subscribe(pattern, func(ctx context.Context, e Event) error {
+		payload, ok := e.Payload.(T)
+		if !ok {
+			return nil
+		}
+
+		return handler(ctx, e.Topic, payload)
+	})
+}
+
+// Publish queues an event for every subscription matching topic.
+// Parameters:
+// - ctx: The context bounding the wait when a subscription queue is full.
+// - topic: The event topic, e.g. "upload.completed". It must not contain wildcards.
+// - payload: The event payload.
+// Returns ErrBusClosed if the bus is closed, or ctx.Err() if it ends while waiting for queue space.
+func (b *EventBus) Publish(ctx context.Context, topic string, payload interface{}) error {
+	if strings.ContainsAny(topic, "*>") {
+		return fmt.Errorf("invalid topic %q: wildcards are only allowed in subscriptions", topic)
+	}
+
+	e := Event{Topic: topic, Payload: payload, Time: time.Now()}
+	segments := strings.Split(topic, ".")
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return ErrBusClosed
+	}
+
+	for sub := range b.subs {
+		if !topicMatches(sub.pattern, segments) {
+			continue
+		}
+
+		select {
+		case sub.queue <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// Close stops accepting events and waits until queued events have been delivered.
+// Parameters:
+// - ctx: The context bounding the wait.
+// Returns ctx.Err() if delivery did not finish in time.
+func (b *EventBus) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		for sub := range b.subs {
+			close(sub.queue)
+		}
+		b.subs = nil
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliver runs a subscription's handler for each queued event until the queue is closed.
+func (b *EventBus) deliver(sub *subscription) {
+	defer b.wg.Done()
+
+	for e := range sub.queue {
+		func() {
+			defer func() {
+				if p := recover(); p != nil && b.ErrorLog != nil {
+					b.ErrorLog(e.Topic, fmt.Errorf("panic: %v", p))
+				}
+			}()
+
+			if err := sub.handler(context.Background(), e); err != nil && b.ErrorLog != nil {
+				b.ErrorLog(e.Topic, err)
+			}
+		}()
+	}
+}
+
+// topicMatches reports whether topic segments match a subscription pattern.
+func topicMatches(pattern, topic []string) bool {
+	for i, p := range pattern {
+		if p == ">" {
+			return len(topic) > i
+		}
+
+		if i >= len(topic) || (p != "*" && p != topic[i]) {
+			return false
+		}
+	}
+
+	return len(pattern) == len(topic)
+}
@@ -0,0 +1,115 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var topicMatchTests = []struct {
+	pattern string
+	topic   string
+	matches bool
+}{
+	{pattern: "upload.completed", topic: "upload.completed", matches: true},
+	{pattern: "upload.completed", topic: "upload.failed", matches: false},
+	{pattern: "upload.*", topic: "upload.completed", matches: true},
+	{pattern: "upload.*", topic: "upload.completed.thumbnail", matches: false},
+	{pattern: "upload.>", topic: "upload.completed.thumbnail", matches: true},
+	{pattern: "upload.>", topic: "upload", matches: false},
+	{pattern: "*.created", topic: "user.created", matches: true},
+	{pattern: ">", topic: "anything.at.all", matches: true},
+}
+
+func TestTopicMatches(t *testing.T) {
+	for _, e := range topicMatchTests {
+		if got := topicMatches(strings.Split(e.pattern, "."), strings.Split(e.topic, ".")); got != e.matches {
+			t.Errorf("%s vs %s: expected %v, got %v", e.pattern, e.topic, e.matches, got)
+		}
+	}
+}
+
+func TestEventBus_PublishSubscribe(t *testing.T) {
+	bus := NewEventBus(8)
+	ctx := context.Background()
+
+	type uploadCompleted struct{ File string }
+
+	var mu sync.Mutex
+	var all []string
+	var typed []string
+
+	bus.Subscribe("upload.>", func(ctx context.Context, e Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		all = append(all, e.Topic)
+		return nil
+	})
+
+	SubscribeTyped(bus, "upload.*", func(ctx context.Context, topic string, payload uploadCompleted) error {
+		mu.Lock()
+		defer mu.Unlock()
+		typed = append(typed, payload.File)
+		return nil
+	})
+
+	_ = bus.Publish(ctx, "upload.completed", uploadCompleted{File: "a.png"})
+	_ = bus.Publish(ctx, "upload.failed", "not the typed payload")
+	_ = bus.Publish(ctx, "user.created", uploadCompleted{File: "ignored"})
+
+	if err := bus.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(all) != 2 || all[0] != "upload.completed" || all[1] != "upload.failed" {
+		t.Errorf("unexpected events for wildcard subscription: %v", all)
+	}
+
+	if len(typed) != 1 || typed[0] != "a.png" {
+		t.Errorf("unexpected typed payloads: %v", typed)
+	}
+
+	if err := bus.Publish(ctx, "upload.completed", nil); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("expected ErrBusClosed, got %v", err)
+	}
+}
+
+func TestEventBus_ErrorsAndUnsubscribe(t *testing.T) {
+	bus := NewEventBus(0)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var logged []string
+	bus.ErrorLog = func(topic string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		logged = append(logged, err.Error())
+	}
+
+	bus.Subscribe("job.failed", func(ctx context.Context, e Event) error { return errors.New("handler failed") })
+	bus.Subscribe("job.failed", func(ctx context.Context, e Event) error { panic("boom") })
+
+	calls := 0
+	unsubscribe := bus.Subscribe("job.failed", func(ctx context.Context, e Event) error {
+		calls++
+		return nil
+	})
+	unsubscribe()
+
+	_ = bus.Publish(ctx, "job.failed", nil)
+	_ = bus.Close(ctx)
+
+	if len(logged) != 2 {
+		t.Errorf("expected 2 logged errors, got %v", logged)
+	}
+
+	if calls != 0 {
+		t.Errorf("expected unsubscribed handler not to be called, got %d calls", calls)
+	}
+
+	if err := bus.Publish(ctx, "job.*", nil); err == nil {
+		t.Error("expected error publishing to a wildcard topic")
+	}
+}
@@ -0,0 +1,139 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Variant is one arm of an experiment.
+// Fields:
+// - Name: The variant name, e.g. "control".
+// - Weight: The relative share of subjects assigned to the variant. Variants with a zero weight receive no
+// new subjects but are still honoured when read back from a sticky cookie.
+type Variant struct {
+	Name   string
+	Weight int
+}
+
+// Exposure records that a subject was shown a variant.
+type Exposure struct {
+	Experiment string
+	Variant    string
+	SubjectID  string
+	Time       time.Time
+}
+
+// Experiment defines an A/B test.
+// Fields:
+// - Name: The experiment name. It salts the hash, so subjects are bucketed independently per experiment.
+// - Variants: The variants and their weights.
+// - OnExposure: An optional hook called each time a variant is assigned through Tools.Bucket or
+// Tools.BucketRequest, e.g. to log exposures for analysis.
+type Experiment struct {
+	Name       string
+	Variants   []Variant
+	OnExposure func(ctx context.Context, e Exposure)
+}
+
+// variant returns the variant named name, if the experiment has one.
+func (e Experiment) variant(name string) (Variant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+
+	return Variant{}, false
+}
+
+// assign picks a variant for subjectID by consistent hashing, so the same subject always gets the same variant
+// as long as the weights do not change.
+func (e Experiment) assign(subjectID string) string {
+	total := 0
+	for _, v := range e.Variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+
+	if total == 0 {
+		return ""
+	}
+
+	point := int(hash32(e.Name+":"+subjectID) % uint32(total))
+	for _, v := range e.Variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		if point < v.Weight {
+			return v.Name
+		}
+		point -= v.Weight
+	}
+
+	return ""
+}
+
+// expose calls the experiment's exposure hook, if any.
+func (e Experiment) expose(ctx context.Context, subjectID, variant string) {
+	if e.OnExposure != nil && variant != "" {
+		e.OnExposure(ctx, Exposure{Experiment: e.Name, Variant: variant, SubjectID: subjectID, Time: time.Now()})
+	}
+}
+
+// Bucket assigns a subject to one of the experiment's variants using consistent hashing.
+// Parameters:
+// - experiment: The experiment.
+// - subjectID: A stable identifier of the subject, e.g. a user ID.
+// Returns the variant name, or an empty string if the experiment has no variant with a positive weight.
+func (t *Tools) Bucket(experiment Experiment, subjectID string) string {
+	variant := experiment.assign(subjectID)
+	experiment.expose(context.Background(), subjectID, variant)
+
+	return variant
+}
+
+// BucketRequest assigns the subject of a request to a variant, keeping the assignment sticky through a cookie
+// named "exp_<experiment name>". A cookie naming a known variant wins over hashing, so assignments survive
+// weight changes and anonymous visitors keep their variant.
+// Parameters:
+// - w: The http.ResponseWriter the cookie is set on.
+// - r: The http.Request.
+// - experiment: The experiment.
+// - subjectID: A stable identifier of the subject. When empty, a random one is generated and the cookie
+// carries the assignment.
+// Returns the variant name.
+func (t *Tools) BucketRequest(w http.ResponseWriter, r *http.Request, experiment Experiment, subjectID string) string {
+	cookieName := "exp_" + experiment.Name
+
+	if c, err := r.Cookie(cookieName); err == nil {
+		if _, ok := experiment.variant(c.Value); ok {
+			experiment.expose(r.Context(), subjectID, c.Value)
+			return c.Value
+		}
+	}
+
+	if subjectID == "" {
+		subjectID = t.RandomString(16)
+	}
+
+	variant := experiment.assign(subjectID)
+	if variant == "" {
+		return ""
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    variant,
+		Path:     "/",
+		MaxAge:   90 * 24 * 60 * 60,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	experiment.expose(r.Context(), subjectID, variant)
+
+	return variant
+}
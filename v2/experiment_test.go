@@ -0,0 +1,70 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTools_Bucket(t *testing.T) {
+	var testTools Tools
+
+	exp := Experiment{Name: "checkout", Variants: []Variant{{"control", 1}, {"treatment", 3}}}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		v := testTools.Bucket(exp, subject)
+		if v != testTools.Bucket(exp, subject) {
+			t.Fatal("expected sticky assignment for the same subject")
+		}
+		counts[v]++
+	}
+
+	if counts["treatment"] < 2800 || counts["treatment"] > 3200 {
+		t.Errorf("expected roughly 75%% treatment, got %v", counts)
+	}
+
+	if v := testTools.Bucket(Experiment{Name: "empty"}, "user-1"); v != "" {
+		t.Errorf("expected no variant for an experiment without weights, got %q", v)
+	}
+}
+
+func TestTools_BucketRequest(t *testing.T) {
+	var testTools Tools
+
+	var exposures []Exposure
+	exp := Experiment{
+		Name:     "banner",
+		Variants: []Variant{{"a", 1}, {"b", 1}},
+		OnExposure: func(ctx context.Context, e Exposure) {
+			exposures = append(exposures, e)
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	variant := testTools.BucketRequest(rr, httptest.NewRequest(http.MethodGet, "/", nil), exp, "")
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "exp_banner" || cookies[0].Value != variant {
+		t.Fatalf("expected sticky cookie for variant %q, got %v", variant, cookies)
+	}
+
+	// a cookie naming a known variant wins over hashing
+	other := "a"
+	if variant == "a" {
+		other = "b"
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "exp_banner", Value: other})
+
+	if v := testTools.BucketRequest(httptest.NewRecorder(), req, exp, "user-1"); v != other {
+		t.Errorf("expected cookie variant %q, got %q", other, v)
+	}
+
+	if len(exposures) != 2 || exposures[1].Variant != other || exposures[1].SubjectID != "user-1" {
+		t.Errorf("unexpected exposures: %+v", exposures)
+	}
+}
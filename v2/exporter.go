@@ -0,0 +1,802 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrExportNotFound is returned for unknown or purged export jobs.
+	ErrExportNotFound = errors.New("export not found")
+	// ErrExportNotReady is returned when asking for the download of an export that has not finished.
+	ErrExportNotReady = errors.New("export is not ready")
+)
+
+// ExportStatus is the state of an export job.
+type ExportStatus string
+
+const (
+	// ExportPending is a job waiting for a free worker.
+	ExportPending ExportStatus = "pending"
+	// ExportRunning is a job being generated.
+	ExportRunning ExportStatus = "running"
+	// ExportDone is a job whose file is ready to download.
+	ExportDone ExportStatus = "done"
+	// ExportFailed is a job that ended with an error.
+	ExportFailed ExportStatus = "failed"
+)
+
+// Finished reports whether the job has ended, successfully or not.
+func (s ExportStatus) Finished() bool {
+	return s == ExportDone || s == ExportFailed
+}
+
+// ExportFunc writes the contents of an export. It should stop early when ctx is done.
+type ExportFunc func(ctx context.Context, w io.Writer) error
+
+// ExportRequest describes an export to run with Exporter.Start.
+// Fields:
+// - Name: A human-readable name, used in notifications, e.g. "Orders for March".
+// - Filename: The name the file is stored and downloaded under, e.g. "orders.xlsx". It may not contain slashes.
+// - Owner: Who asked for the export, e.g. a user ID, so their jobs can be listed with Jobs.
+// - Email: If set, the address ExportEmail notifies.
+// - Write: Generates the file, e.g. CSVExport, Tools.XLSXExport or ZipExport.
+type ExportRequest struct {
+	Name     string
+	Filename string
+	Owner    string
+	Email    string
+	Write    ExportFunc
+}
+
+// ExportJob is the state of an export, as reported to pollers, notifiers and EventsHandler.
+// Fields:
+// - ID: The job's identifier, 32 random hex characters.
+// - Name, Filename, Owner, Email: As given in the ExportRequest.
+// - Status: Where the job is.
+// - Error: Why the job failed.
+// - Size: The size of the finished file in bytes.
+// - CreatedAt, StartedAt, FinishedAt: When the job was queued, started and ended.
+// - ExpiresAt: When the download link stops working and Purge may remove the file.
+// - URL: The signed download link, once the job is done.
+type ExportJob struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Filename   string       `json:"filename"`
+	Owner      string       `json:"owner,omitempty"`
+	Email      string       `json:"email,omitempty"`
+	Status     ExportStatus `json:"status"`
+	Error      string       `json:"error,omitempty"`
+	Size       int64        `json:"size,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	StartedAt  time.Time    `json:"started_at,omitempty"`
+	FinishedAt time.Time    `json:"finished_at,omitempty"`
+	ExpiresAt  time.Time    `json:"expires_at,omitempty"`
+	URL        string       `json:"url,omitempty"`
+}
+
+// ExportNotifier is told when an export job finishes, successfully or not.
+type ExportNotifier interface {
+	NotifyExport(ctx context.Context, job ExportJob) error
+}
+
+// ExportNotifierFunc adapts a function to an ExportNotifier.
+type ExportNotifierFunc func(ctx context.Context, job ExportJob) error
+
+// NotifyExport calls f.
+func (f ExportNotifierFunc) NotifyExport(ctx context.Context, job ExportJob) error {
+	return f(ctx, job)
+}
+
+// Exporter runs large exports, such as CSV or XLSX reports and zip archives, as background jobs, so the request
+// asking for one returns at once. Finished files are saved to a FileStore and downloaded through expiring signed
+// links served by DownloadHandler; notifiers and EventsHandler tell the user when a file is ready.
+// Job states are kept in memory, but download links are checked by signature alone, so any instance sharing the
+// FileStore and the secret can serve them.
+// Fields:
+// - Store: Where finished files are saved, under Prefix/<job ID>/<filename>.
+// - Secret: The HMAC key signing download links. It must be kept private and should be at least 32 bytes long.
+// - Keyring: Signs links instead of Secret when set, so keys can be rotated without breaking links already sent.
+// - Tools: Used to serve downloads, e.g. its ContentTypes. A zero Tools is used if nil.
+// - Prefix: The directory of exports within Store. Defaults to "exports".
+// - BaseURL: The path DownloadHandler is mounted at, used to build links. Defaults to "/exports/".
+// - TTL: How long download links work, from the end of the job. Defaults to 24 hours.
+// - Concurrency: How many exports run at once; others wait for a free slot. Defaults to 2.
+// - Timeout: If set, the longest an export may run.
+// - Notifiers: Told about every finished job, e.g. an ExportWebhook or ExportEmail.
+// - ErrorLog: An optional callback receiving notifier errors.
+type Exporter struct {
+	Store       FileStore
+	Secret      []byte
+	Keyring     *Keyring
+	Tools       *Tools
+	Prefix      string
+	BaseURL     string
+	TTL         time.Duration
+	Concurrency int
+	Timeout     time.Duration
+	Notifiers   []ExportNotifier
+	ErrorLog    func(id string, err error)
+
+	mu       sync.Mutex
+	jobs     map[string]*ExportJob
+	watchers map[string][]chan ExportJob
+	sem      chan struct{}
+	running  sync.WaitGroup
+	now      func() time.Time
+}
+
+// NewExporter creates an Exporter saving files to store and signing links with secret.
+// Returns a pointer to the new Exporter.
+func NewExporter(store FileStore, secret []byte) *Exporter {
+	return &Exporter{Store: store, Secret: secret}
+}
+
+// Start queues an export and returns at once. The job runs with a copy of ctx that is not canceled with it, so
+// it outlives the request, while keeping its values, such as the tenant.
+// Parameters:
+// - ctx: The context of the request.
+// - req: The export to run.
+// Returns a snapshot of the queued job, or an error if the request is incomplete or the exporter has no store or
+// secret.
+func (e *Exporter) Start(ctx context.Context, req ExportRequest) (*ExportJob, error) {
+	switch {
+	case e.Store == nil:
+		return nil, errors.New("exporter has no store")
+	case len(e.Secret) == 0 && e.Keyring == nil:
+		return nil, errors.New("exporter requires a secret")
+	case req.Write == nil:
+		return nil, errors.New("export has no Write function")
+	case req.Filename == "" || strings.ContainsAny(req.Filename, `/\`) || req.Filename == "." || req.Filename == "..":
+		return nil, fmt.Errorf("invalid export filename %q", req.Filename)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	job := &ExportJob{
+		ID:        hex.EncodeToString(id),
+		Name:      req.Name,
+		Filename:  req.Filename,
+		Owner:     req.Owner,
+		Email:     req.Email,
+		Status:    ExportPending,
+		CreatedAt: e.clock(),
+	}
+	if job.Name == "" {
+		job.Name = job.Filename
+	}
+
+	e.mu.Lock()
+	if e.jobs == nil {
+		e.jobs = make(map[string]*ExportJob)
+	}
+	if e.sem == nil {
+		n := e.Concurrency
+		if n <= 0 {
+			n = 2
+		}
+		e.sem = make(chan struct{}, n)
+	}
+	e.jobs[job.ID] = job
+	snapshot := *job
+	e.mu.Unlock()
+
+	e.running.Add(1)
+	go e.run(context.WithoutCancel(ctx), job.ID, req.Write)
+
+	return &snapshot, nil
+}
+
+// run generates a job's file, records the outcome and notifies.
+func (e *Exporter) run(ctx context.Context, id string, fn ExportFunc) {
+	defer e.running.Done()
+
+	e.sem <- struct{}{}
+	defer func() { <-e.sem }()
+
+	job := e.update(id, func(j *ExportJob) {
+		j.Status = ExportRunning
+		j.StartedAt = e.clock()
+	})
+
+	runCtx := ctx
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+
+	size, err := storeExport(runCtx, e.Store, e.storeName(job.ID, job.Filename), fn)
+
+	job = e.update(id, func(j *ExportJob) {
+		j.FinishedAt = e.clock()
+		j.ExpiresAt = j.FinishedAt.Add(e.ttl())
+		if err != nil {
+			j.Status = ExportFailed
+			j.Error = err.Error()
+			return
+		}
+		j.Status = ExportDone
+		j.Size = size
+		j.URL = e.downloadURL(j.ID, j.Filename, j.ExpiresAt)
+	})
+
+	for _, n := range e.Notifiers {
+		if err := n.NotifyExport(ctx, job); err != nil && e.ErrorLog != nil {
+			e.ErrorLog(id, err)
+		}
+	}
+}
+
+// storeExport streams fn's output into store under name, returning the number of bytes written. A panic in fn
+// fails the export instead of the process.
+func storeExport(ctx context.Context, store FileStore, name string, fn ExportFunc) (int64, error) {
+	pr, pw := io.Pipe()
+	cw := &countingWriter{w: pw}
+
+	written := make(chan error, 1)
+	go func() {
+		err := func() (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = fmt.Errorf("export panicked: %v", p)
+				}
+			}()
+			return fn(ctx, cw)
+		}()
+		_ = pw.CloseWithError(err)
+		written <- err
+	}()
+
+	saveErr := store.Save(ctx, name, pr)
+	// unblock the writer if the store gave up early
+	_ = pr.CloseWithError(errExportStoreClosed)
+
+	writeErr := <-written
+	switch {
+	case writeErr != nil && !errors.Is(writeErr, errExportStoreClosed):
+		return 0, writeErr
+	case saveErr != nil:
+		return 0, saveErr
+	case writeErr != nil:
+		return 0, writeErr
+	}
+
+	return cw.n, nil
+}
+
+// errExportStoreClosed is seen by an ExportFunc writing after the store stopped reading.
+var errExportStoreClosed = errors.New("export store closed")
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// update applies fn to a job, publishes the result to watchers and returns it.
+func (e *Exporter) update(id string, fn func(j *ExportJob)) ExportJob {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	j := e.jobs[id]
+	fn(j)
+	snapshot := *j
+
+	for _, ch := range e.watchers[id] {
+		// only the latest state matters, so a slow watcher's stale update is replaced
+		select {
+		case ch <- snapshot:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			ch <- snapshot
+		}
+	}
+
+	return snapshot
+}
+
+// Job returns a snapshot of a job.
+// Returns the job, or ErrExportNotFound.
+func (e *Exporter) Job(id string) (*ExportJob, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	j, ok := e.jobs[id]
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+	snapshot := *j
+
+	return &snapshot, nil
+}
+
+// Jobs lists the jobs of an owner, or every job if owner is empty, newest first.
+func (e *Exporter) Jobs(owner string) []ExportJob {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var jobs []ExportJob
+	for _, j := range e.jobs {
+		if owner == "" || j.Owner == owner {
+			jobs = append(jobs, *j)
+		}
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].CreatedAt.After(jobs[b].CreatedAt) })
+
+	return jobs
+}
+
+// Wait blocks until every started job has finished and been notified, e.g. during shutdown.
+// Returns ctx.Err() if ctx is done first.
+func (e *Exporter) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Purge deletes the files of expired jobs from the store and forgets them. It is meant to run periodically, e.g.
+// from a Scheduler.
+// Returns the number of jobs purged, and the first error deleting a file; jobs whose file could not be deleted are
+// kept to be retried.
+func (e *Exporter) Purge(ctx context.Context) (int, error) {
+	now := e.clock()
+
+	e.mu.Lock()
+	var expired []ExportJob
+	for _, j := range e.jobs {
+		if j.Status.Finished() && now.After(j.ExpiresAt) {
+			expired = append(expired, *j)
+		}
+	}
+	e.mu.Unlock()
+
+	var firstErr error
+	n := 0
+	for _, j := range expired {
+		if j.Status == ExportDone {
+			if err := e.Store.Delete(ctx, e.storeName(j.ID, j.Filename)); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+		}
+
+		e.mu.Lock()
+		delete(e.jobs, j.ID)
+		e.mu.Unlock()
+		n++
+	}
+
+	return n, firstErr
+}
+
+// DownloadURL returns a job's signed download link.
+// Returns the link, ErrExportNotFound, or ErrExportNotReady if the job has not finished successfully.
+func (e *Exporter) DownloadURL(id string) (string, error) {
+	j, err := e.Job(id)
+	if err != nil {
+		return "", err
+	}
+	if j.Status != ExportDone {
+		return "", ErrExportNotReady
+	}
+
+	return j.URL, nil
+}
+
+// DownloadHandler serves finished exports from links produced by the Exporter, which end in
+// <job ID>/<filename>, so it can be mounted at BaseURL, e.g. mux.Handle("/exports/", exporter.DownloadHandler()).
+// Links with a bad signature get 404 Not Found, and expired ones get 410 Gone. Holding the link is enough to
+// download the file: the link is the authorization.
+// Returns the handler.
+func (e *Exporter) DownloadHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dir, filename := path.Split(r.URL.Path)
+		id := path.Base(dir)
+
+		expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+		sig, sigErr := hex.DecodeString(r.URL.Query().Get("sig"))
+		if err != nil || sigErr != nil || !e.verify(downloadSigningInput(id, filename, expires), sig) {
+			http.NotFound(w, r)
+			return
+		}
+		if e.clock().After(time.Unix(expires, 0)) {
+			http.Error(w, "download link has expired", http.StatusGone)
+			return
+		}
+
+		rc, err := e.Store.Open(r.Context(), e.storeName(id, filename))
+		if err != nil {
+			writeFileError(w, r, err)
+			return
+		}
+		defer rc.Close()
+
+		t := e.Tools
+		if t == nil {
+			t = &Tools{}
+		}
+
+		meta := ContentMeta{
+			Name:         filename,
+			ContentType:  t.downloadContentType(filename),
+			CacheControl: "private, no-store",
+			DownloadName: filename,
+		}
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		if rs, ok := rc.(io.ReadSeeker); ok {
+			t.ServeContentFrom(w, r, rs, meta)
+			return
+		}
+
+		// stores without seeking, such as remote ones, are streamed without range support
+		if meta.ContentType != "" {
+			w.Header().Set("Content-Type", meta.ContentType)
+		}
+		w.Header().Set("Cache-Control", meta.CacheControl)
+		w.Header().Set("Content-Disposition", ContentDisposition("attachment", filename))
+		_, _ = io.Copy(w, rc)
+	}
+}
+
+// EventsHandler streams a job's progress as server-sent events, so a page can show when an export is ready.
+// The job ID is taken from the "id" query parameter, e.g. mux.Handle("/exports/events", exporter.EventsHandler()).
+// Each state is sent as an "export" event whose data is the ExportJob as JSON, starting with the current one; the
+// stream ends once the job has finished. Job IDs are unguessable, so knowing one is the authorization.
+// Returns the handler.
+func (e *Exporter) EventsHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		job, updates, stop, err := e.watch(r.URL.Query().Get("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer stop()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		send := func(j ExportJob) {
+			data, _ := json.Marshal(j)
+			_, _ = fmt.Fprintf(w, "event: export\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+
+		send(job)
+		if job.Status.Finished() {
+			return
+		}
+
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case j := <-updates:
+				send(j)
+				if j.Status.Finished() {
+					return
+				}
+			case <-keepalive.C:
+				_, _ = io.WriteString(w, ": keepalive\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// watch returns a job's current state and a channel receiving its later states, registered atomically so no
+// update is missed.
+func (e *Exporter) watch(id string) (ExportJob, <-chan ExportJob, func(), error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	j, ok := e.jobs[id]
+	if !ok {
+		return ExportJob{}, nil, nil, ErrExportNotFound
+	}
+
+	ch := make(chan ExportJob, 1)
+	if e.watchers == nil {
+		e.watchers = make(map[string][]chan ExportJob)
+	}
+	e.watchers[id] = append(e.watchers[id], ch)
+
+	stop := func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		list := e.watchers[id]
+		for i, c := range list {
+			if c == ch {
+				list = append(list[:i], list[i+1:]...)
+				break
+			}
+		}
+		if len(list) == 0 {
+			delete(e.watchers, id)
+		} else {
+			e.watchers[id] = list
+		}
+	}
+
+	return *j, ch, stop, nil
+}
+
+// storeName returns the name of a job's file within the store.
+func (e *Exporter) storeName(id, filename string) string {
+	prefix := e.Prefix
+	if prefix == "" {
+		prefix = "exports"
+	}
+
+	return path.Join(prefix, id, filename)
+}
+
+// downloadURL builds the signed link to a job's file.
+func (e *Exporter) downloadURL(id, filename string, expires time.Time) string {
+	base := e.BaseURL
+	if base == "" {
+		base = "/exports/"
+	}
+
+	sig := e.sign(downloadSigningInput(id, filename, expires.Unix()))
+
+	return base + id + "/" + url.PathEscape(filename) + "?expires=" + strconv.FormatInt(expires.Unix(), 10) + "&sig=" + hex.EncodeToString(sig)
+}
+
+// downloadSigningInput returns the data signed in a download link.
+func downloadSigningInput(id, filename string, expires int64) []byte {
+	return []byte("export\n" + id + "\n" + filename + "\n" + strconv.FormatInt(expires, 10))
+}
+
+// sign signs data with the keyring, or else the secret.
+func (e *Exporter) sign(data []byte) []byte {
+	if e.Keyring != nil {
+		return e.Keyring.Sign(data)
+	}
+
+	return hmacSHA256(e.Secret, data)
+}
+
+// verify checks a signature made by sign.
+func (e *Exporter) verify(data, sig []byte) bool {
+	if e.Keyring != nil {
+		return e.Keyring.Verify(data, sig)
+	}
+
+	return len(e.Secret) > 0 && hmac.Equal(sig, hmacSHA256(e.Secret, data))
+}
+
+// ttl returns how long download links work.
+func (e *Exporter) ttl() time.Duration {
+	if e.TTL > 0 {
+		return e.TTL
+	}
+
+	return 24 * time.Hour
+}
+
+// clock returns the current time, overridable in tests.
+func (e *Exporter) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+
+	return time.Now()
+}
+
+// CSVExport returns an ExportFunc writing CSV. The output starts with a UTF-8 byte order mark, so Excel reads
+// non-ASCII text correctly.
+// Parameters:
+// - fn: Writes the records, e.g. a header then one record per database row. Flushing is handled.
+// Returns the ExportFunc.
+func CSVExport(fn func(ctx context.Context, w *csv.Writer) error) ExportFunc {
+	return func(ctx context.Context, w io.Writer) error {
+		if _, err := io.WriteString(w, "\xef\xbb\xbf"); err != nil {
+			return err
+		}
+
+		cw := csv.NewWriter(w)
+		if err := fn(ctx, cw); err != nil {
+			return err
+		}
+		cw.Flush()
+
+		return cw.Error()
+	}
+}
+
+// XLSXExport returns an ExportFunc writing a workbook with WriteXLSX.
+// Parameters:
+// - sheets: The sheets, see WriteXLSX. Use an XLSXRowFunc to stream rows.
+// Returns the ExportFunc.
+func (t *Tools) XLSXExport(sheets []XLSXSheet) ExportFunc {
+	return func(_ context.Context, w io.Writer) error {
+		return t.WriteXLSX(w, sheets)
+	}
+}
+
+// ExportFile is an entry of a ZipExport.
+// Fields:
+// - Name: The slash-separated path of the entry in the archive.
+// - Write: Generates the entry's contents.
+type ExportFile struct {
+	Name  string
+	Write ExportFunc
+}
+
+// ZipExport returns an ExportFunc writing a zip archive of several generated files, e.g. one CSV per table.
+// Parameters:
+// - files: The entries, written in order.
+// Returns the ExportFunc.
+func ZipExport(files ...ExportFile) ExportFunc {
+	return func(ctx context.Context, w io.Writer) error {
+		zw := zip.NewWriter(w)
+
+		for _, f := range files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: time.Now()})
+			if err != nil {
+				return err
+			}
+			if err := f.Write(ctx, fw); err != nil {
+				return fmt.Errorf("%s: %w", f.Name, err)
+			}
+		}
+
+		return zw.Close()
+	}
+}
+
+// ExportWebhook is an ExportNotifier posting finished jobs as JSON to a URL. When a secret is set, the body's
+// HMAC-SHA256 is sent in the X-Signature-256 header as "sha256=<hex>", so the receiver can check the sender.
+// Fields:
+// - URL: Where the job is posted.
+// - Secret: If set, the HMAC key signing the body.
+// - Client: The HTTP client. Defaults to one with a 10 second timeout.
+type ExportWebhook struct {
+	URL    string
+	Secret []byte
+	Client *http.Client
+}
+
+// NotifyExport posts the job.
+// Returns an error if the request fails or the receiver does not answer with a 2xx status.
+func (h *ExportWebhook) NotifyExport(ctx context.Context, job ExportJob) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.Secret) > 0 {
+		req.Header.Set("X-Signature-256", "sha256="+hex.EncodeToString(hmacSHA256(h.Secret, body)))
+	}
+
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("export webhook: %s answered %s", h.URL, resp.Status)
+	}
+
+	return nil
+}
+
+// ExportEmail is an ExportNotifier emailing the job's Email address, if it has one, with the download link or the
+// reason the export failed.
+// Fields:
+// - Addr: The SMTP server, e.g. "smtp.example.com:587".
+// - Auth: The SMTP authentication, if any.
+// - From: The sender address.
+// - Send: Sends the message. Defaults to smtp.SendMail; replace it to use another transport.
+type ExportEmail struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	Send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NotifyExport sends the email.
+// Returns an error if sending fails.
+func (m *ExportEmail) NotifyExport(_ context.Context, job ExportJob) error {
+	if job.Email == "" {
+		return nil
+	}
+	if strings.ContainsAny(job.Email, "\r\n") {
+		return fmt.Errorf("%w: invalid export email address", ErrInvalidEmail)
+	}
+
+	subject := fmt.Sprintf("Your export %q is ready", job.Name)
+	body := fmt.Sprintf("Your export %q is ready to download:\r\n\r\n%s\r\n\r\nThe link expires on %s.\r\n",
+		job.Name, job.URL, job.ExpiresAt.UTC().Format("2 January 2006 at 15:04 UTC"))
+	if job.Status == ExportFailed {
+		subject = fmt.Sprintf("Your export %q failed", job.Name)
+		body = fmt.Sprintf("Your export %q could not be generated: %s\r\n", job.Name, job.Error)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", job.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	send := m.Send
+	if send == nil {
+		send = smtp.SendMail
+	}
+
+	return send(m.Addr, m.Auth, m.From, []string{job.Email}, msg.Bytes())
+}
@@ -0,0 +1,303 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestExporter(t *testing.T) *Exporter {
+	t.Helper()
+
+	return NewExporter(NewLocalFileStore(t.TempDir()), []byte("0123456789abcdef0123456789abcdef"))
+}
+
+func TestExporter_Download(t *testing.T) {
+	e := newTestExporter(t)
+
+	job, err := e.Start(context.Background(), ExportRequest{
+		Name:     "Orders",
+		Filename: "orders é.csv",
+		Owner:    "ann",
+		Write: CSVExport(func(_ context.Context, w *csv.Writer) error {
+			_ = w.Write([]string{"id", "total"})
+			return w.Write([]string{"1", "9.50"})
+		}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != ExportPending {
+		t.Errorf("expected a pending job, got %s", job.Status)
+	}
+	if _, err := e.DownloadURL(job.ID); err != nil && !errors.Is(err, ErrExportNotReady) {
+		t.Errorf("expected ErrExportNotReady or a link, got %v", err)
+	}
+
+	if err := e.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = e.Job(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != ExportDone || job.Size == 0 || !strings.HasPrefix(job.URL, "/exports/"+job.ID+"/") {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+	if jobs := e.Jobs("ann"); len(jobs) != 1 || len(e.Jobs("bob")) != 0 {
+		t.Errorf("expected one job for ann, got %+v", jobs)
+	}
+
+	rr := httptest.NewRecorder()
+	e.DownloadHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, job.URL, nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "\xef\xbb\xbfid,total\n1,9.50\n" {
+		t.Errorf("unexpected download: %d %q", rr.Code, rr.Body.String())
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.Contains(cd, "filename*=UTF-8''orders%20%C3%A9.csv") {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	var tests = []struct {
+		name     string
+		url      string
+		later    time.Duration
+		expected int
+	}{
+		{"tampered id", strings.Replace(job.URL, job.ID, strings.Repeat("0", 32), 1), 0, http.StatusNotFound},
+		{"tampered expiry", strings.Replace(job.URL, "expires=", "expires=9", 1), 0, http.StatusNotFound},
+		{"missing signature", strings.Split(job.URL, "&sig=")[0], 0, http.StatusNotFound},
+		{"expired", job.URL, 25 * time.Hour, http.StatusGone},
+	}
+
+	for _, e2 := range tests {
+		e.now = func() time.Time { return time.Now().Add(e2.later) }
+
+		rr := httptest.NewRecorder()
+		e.DownloadHandler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, e2.url, nil))
+		if rr.Code != e2.expected {
+			t.Errorf("%s: expected %d, got %d", e2.name, e2.expected, rr.Code)
+		}
+	}
+
+	// once expired, Purge removes the file and forgets the job
+	n, err := e.Purge(context.Background())
+	if err != nil || n != 1 {
+		t.Errorf("expected one job purged, got %d, %v", n, err)
+	}
+	if _, err := e.Job(job.ID); !errors.Is(err, ErrExportNotFound) {
+		t.Errorf("expected ErrExportNotFound, got %v", err)
+	}
+}
+
+func TestExporter_Failures(t *testing.T) {
+	var mu sync.Mutex
+	notified := make(map[string]ExportJob)
+
+	e := newTestExporter(t)
+	e.Timeout = 50 * time.Millisecond
+	e.Notifiers = []ExportNotifier{ExportNotifierFunc(func(_ context.Context, job ExportJob) error {
+		mu.Lock()
+		defer mu.Unlock()
+		notified[job.Name] = job
+		return nil
+	})}
+
+	var tests = []struct {
+		name  string
+		write ExportFunc
+		err   string
+	}{
+		{"error", func(_ context.Context, w io.Writer) error {
+			_, _ = io.WriteString(w, "partial")
+			return errors.New("database is down")
+		}, "database is down"},
+		{"panic", func(context.Context, io.Writer) error { panic("boom") }, "export panicked: boom"},
+		{"timeout", func(ctx context.Context, _ io.Writer) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}, "context deadline exceeded"},
+	}
+
+	for _, e2 := range tests {
+		if _, err := e.Start(context.Background(), ExportRequest{Name: e2.name, Filename: "out.txt", Write: e2.write}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e2 := range tests {
+		job := notified[e2.name]
+		if job.Status != ExportFailed || job.Error != e2.err || job.URL != "" {
+			t.Errorf("%s: expected a failed job with %q, got %+v", e2.name, e2.err, job)
+		}
+	}
+
+	if _, err := e.Start(context.Background(), ExportRequest{Filename: "../x.csv", Write: func(context.Context, io.Writer) error { return nil }}); err == nil {
+		t.Error("expected an unsafe filename to be rejected")
+	}
+}
+
+func TestExporter_EventsHandler(t *testing.T) {
+	e := newTestExporter(t)
+
+	release := make(chan struct{})
+	job, err := e.Start(context.Background(), ExportRequest{Filename: "slow.txt", Write: func(_ context.Context, w io.Writer) error {
+		<-release
+		_, err := io.WriteString(w, "done")
+		return err
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(e.EventsHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?id=" + job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	var statuses []ExportStatus
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var j ExportJob
+		if err := json.Unmarshal([]byte(data), &j); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, j.Status)
+		if len(statuses) == 1 {
+			close(release)
+		}
+	}
+
+	if len(statuses) < 2 || statuses[len(statuses)-1] != ExportDone {
+		t.Errorf("expected the stream to end with done, got %v", statuses)
+	}
+
+	resp, err = http.Get(srv.URL + "?id=unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", resp.StatusCode)
+	}
+}
+
+func TestExportWebhook_NotifyExport(t *testing.T) {
+	secret := []byte("hook-secret")
+
+	var got ExportJob
+	var signature string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signature = r.Header.Get("X-Signature-256")
+		if signature != "sha256="+hex.EncodeToString(hmacSHA256(secret, body)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.Unmarshal(body, &got)
+	}))
+	defer srv.Close()
+
+	hook := &ExportWebhook{URL: srv.URL, Secret: secret}
+	if err := hook.NotifyExport(context.Background(), ExportJob{ID: "abc", Status: ExportDone}); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "abc" || got.Status != ExportDone {
+		t.Errorf("unexpected payload %+v", got)
+	}
+
+	hook.Secret = []byte("wrong")
+	if err := hook.NotifyExport(context.Background(), ExportJob{ID: "abc"}); err == nil {
+		t.Error("expected a rejected webhook to fail")
+	}
+}
+
+func TestExportEmail_NotifyExport(t *testing.T) {
+	var to []string
+	var msg []byte
+	mailer := &ExportEmail{Addr: "smtp.example.com:587", From: "reports@example.com", Send: func(_ string, _ smtp.Auth, _ string, rcpt []string, m []byte) error {
+		to, msg = rcpt, m
+		return nil
+	}}
+
+	job := ExportJob{Name: "Orders", Email: "ann@example.com", Status: ExportDone, URL: "https://example.com/exports/x/orders.csv?sig=1", ExpiresAt: time.Now()}
+	if err := mailer.NotifyExport(context.Background(), job); err != nil {
+		t.Fatal(err)
+	}
+	if len(to) != 1 || to[0] != "ann@example.com" || !bytes.Contains(msg, []byte(job.URL)) || !bytes.Contains(msg, []byte("is ready")) {
+		t.Errorf("unexpected email to %v:\n%s", to, msg)
+	}
+
+	job.Status, job.Error = ExportFailed, "database is down"
+	_ = mailer.NotifyExport(context.Background(), job)
+	if !bytes.Contains(msg, []byte("database is down")) {
+		t.Errorf("expected the failure reason, got\n%s", msg)
+	}
+
+	job.Email = "ann@example.com\r\nBcc: all@example.com"
+	if err := mailer.NotifyExport(context.Background(), job); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected header injection to be refused, got %v", err)
+	}
+
+	msg = nil
+	if err := mailer.NotifyExport(context.Background(), ExportJob{Status: ExportDone}); err != nil || msg != nil {
+		t.Errorf("expected jobs without an email to be skipped, got %v", err)
+	}
+}
+
+func TestZipExport(t *testing.T) {
+	var testTools Tools
+
+	write := ZipExport(
+		ExportFile{Name: "orders.csv", Write: CSVExport(func(_ context.Context, w *csv.Writer) error {
+			return w.Write([]string{"id"})
+		})},
+		ExportFile{Name: "orders.xlsx", Write: testTools.XLSXExport([]XLSXSheet{{Headers: []string{"id"}, Rows: [][]interface{}{{1}}}})},
+	)
+
+	var buf bytes.Buffer
+	if err := write(context.Background(), &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "orders.csv" || zr.File[1].Name != "orders.xlsx" {
+		t.Fatalf("unexpected entries %v", zr.File)
+	}
+
+	f, _ := zr.File[1].Open()
+	xlsx, _ := io.ReadAll(f)
+	if _, err := zip.NewReader(bytes.NewReader(xlsx), int64(len(xlsx))); err != nil {
+		t.Errorf("expected a valid workbook inside the archive: %v", err)
+	}
+}
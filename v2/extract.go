@@ -0,0 +1,532 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnsupportedType is returned by ExtractText for content types it cannot extract text from.
+var ErrUnsupportedType = errors.New("unsupported content type")
+
+// ExtractOptions configures ExtractText.
+// Fields:
+// - MaxBytes: The maximum size of the input document. Larger documents are rejected. Defaults to 20MB.
+// - MaxTextBytes: The maximum size of the extracted text; longer text is truncated. Defaults to 1MB.
+// - Timeout: The time limit of the extraction. Defaults to 10 seconds.
+type ExtractOptions struct {
+	MaxBytes     int64
+	MaxTextBytes int
+	Timeout      time.Duration
+}
+
+const docxMIME = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+var (
+	htmlScriptRegex  = regexp.MustCompile(`(?is)<(script|style|noscript)\b.*?</(script|style|noscript)>`)
+	htmlBlockRegex   = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/h[1-6]|/tr|/title)\b[^>]*>`)
+	htmlAnyTagRegex  = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankLinesRegex  = regexp.MustCompile(`\n\s*\n\s*\n+`)
+	pdfStreamText    = []byte("stream")
+	pdfEndStreamText = []byte("endstream")
+)
+
+// ExtractText pulls plain text out of a document, e.g. to feed a SearchIndex or show a preview. Plain text,
+// Markdown, CSV, JSON, HTML, DOCX and PDF are supported. PDF extraction reads the text operators of the page
+// content streams, so it works for documents using standard fonts but may return little or garbled text for
+// scanned documents or fonts with custom encodings.
+// Parameters:
+// - ctx: The context of the extraction.
+// - r: The document.
+// - mimeType: The document's MIME type, e.g. from the upload's detected type. Parameters such as charset are ignored.
+// - opts: Optional ExtractOptions. Only the first value is used if multiple are provided.
+// Returns the text, ErrUnsupportedType for other types, or an error if the document is too large, malformed,
+// or takes longer than the timeout.
+func (t *Tools) ExtractText(ctx context.Context, r io.Reader, mimeType string, opts ...ExtractOptions) (string, error) {
+	var o ExtractOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 20 << 20
+	}
+	if o.MaxTextBytes <= 0 {
+		o.MaxTextBytes = 1 << 20
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	data, err := io.ReadAll(io.LimitReader(r, o.MaxBytes+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > o.MaxBytes {
+		return "", fmt.Errorf("document exceeds %d bytes", o.MaxBytes)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+
+	var text string
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		text = htmlToText(string(data))
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || mediaType == "application/xml":
+		if !utf8.Valid(data) {
+			data = bytes.ToValidUTF8(data, []byte("�"))
+		}
+		text = string(data)
+	case mediaType == docxMIME:
+		text, err = docxText(ctx, data, o.MaxTextBytes)
+	case mediaType == "application/pdf":
+		text, err = pdfText(ctx, data, o.MaxTextBytes)
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedType, mediaType)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return truncateUTF8(strings.TrimSpace(text), o.MaxTextBytes), nil
+}
+
+// ExtractTextFromFile extracts text from the file at pathName, detecting its type from the content, or the
+// extension when the content is ambiguous.
+func (t *Tools) ExtractTextFromFile(ctx context.Context, pathName string, opts ...ExtractOptions) (string, error) {
+	f, err := os.Open(pathName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	mimeType := http.DetectContentType(head[:n])
+
+	// DOCX files sniff as zip, and Markdown or CSV as text/plain
+	if byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(pathName))); byExt != "" &&
+		(mimeType == "application/zip" || strings.HasPrefix(mimeType, "text/plain")) {
+		mimeType = byExt
+	}
+	if strings.EqualFold(filepath.Ext(pathName), ".docx") {
+		mimeType = docxMIME
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return t.ExtractText(ctx, f, mimeType, opts...)
+}
+
+// htmlToText strips markup from an HTML document, keeping block boundaries as line breaks.
+func htmlToText(doc string) string {
+	doc = htmlCommentRegex.ReplaceAllString(doc, "")
+	doc = htmlScriptRegex.ReplaceAllString(doc, "")
+	doc = htmlBlockRegex.ReplaceAllString(doc, "\n")
+	doc = htmlAnyTagRegex.ReplaceAllString(doc, "")
+	doc = html.UnescapeString(doc)
+
+	lines := strings.Split(doc, "\n")
+	for i, l := range lines {
+		lines[i] = strings.Join(strings.Fields(l), " ")
+	}
+
+	return blankLinesRegex.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+// docxText extracts the paragraphs of word/document.xml from a DOCX archive.
+func docxText(ctx context.Context, data []byte, maxText int) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid DOCX: %w", err)
+	}
+
+	var doc *zip.File
+	for _, f := range zr.File {
+		if f.Name == "word/document.xml" {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return "", errors.New("invalid DOCX: word/document.xml not found")
+	}
+
+	rc, err := doc.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	// guard against zip bombs: XML markup is verbose, so allow a generous multiple of the text limit
+	dec := xml.NewDecoder(io.LimitReader(rc, int64(maxText)*20))
+
+	var sb strings.Builder
+	inText := false
+
+	for sb.Len() < maxText {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// a truncated document still yields the text read so far
+			break
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteByte('\t')
+			case "br", "cr":
+				sb.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				sb.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(el)
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// pdfText extracts the text shown by the content streams of a PDF.
+func pdfText(ctx context.Context, data []byte, maxText int) (string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", errors.New("invalid PDF: missing header")
+	}
+
+	var sb strings.Builder
+
+	for pos := 0; sb.Len() < maxText; {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		i := bytes.Index(data[pos:], pdfStreamText)
+		if i < 0 {
+			break
+		}
+		i += pos
+		pos = i + len(pdfStreamText)
+
+		if i >= 3 && string(data[i-3:i]) == "end" {
+			continue
+		}
+
+		start := pos
+		if start < len(data) && data[start] == '\r' {
+			start++
+		}
+		if start < len(data) && data[start] == '\n' {
+			start++
+		}
+
+		end := bytes.Index(data[start:], pdfEndStreamText)
+		if end < 0 {
+			break
+		}
+		raw := data[start : start+end]
+		pos = start + end + len(pdfEndStreamText)
+
+		// the stream dictionary sits between the object header and the stream keyword
+		dict := data[:i]
+		if obj := bytes.LastIndex(dict, []byte("obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+
+		// skip images, fonts and other binary streams
+		if bytes.Contains(dict, []byte("/Subtype")) || bytes.Contains(dict, []byte("/Length1")) ||
+			bytes.Contains(dict, []byte("/Type /XRef")) || bytes.Contains(dict, []byte("/Type/XRef")) {
+			continue
+		}
+
+		content := raw
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(raw))
+			if err != nil {
+				continue
+			}
+			content, _ = io.ReadAll(io.LimitReader(zr, int64(maxText)*50))
+			zr.Close()
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+
+		sb.WriteString(pdfContentText(content))
+	}
+
+	return blankLinesRegex.ReplaceAllString(sb.String(), "\n\n"), nil
+}
+
+// pdfContentText interprets the text operators of a PDF content stream.
+func pdfContentText(content []byte) string {
+	var sb strings.Builder
+	var operands []string
+	inText := false
+
+	for i := 0; i < len(content); {
+		c := content[i]
+
+		switch {
+		case c == '(':
+			s, n := pdfLiteralString(content[i:])
+			operands = append(operands, s)
+			i += n
+
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return sb.String()
+			}
+			operands = append(operands, pdfHexString(content[i+1:i+end]))
+			i += end + 1
+
+		case c == '[':
+			operands = append(operands, "[")
+			i++
+
+		case c == ']':
+			// fold the array into a single operand, adding spaces for large kerning gaps
+			var parts []string
+			for len(operands) > 0 && operands[len(operands)-1] != "[" {
+				parts = append([]string{operands[len(operands)-1]}, parts...)
+				operands = operands[:len(operands)-1]
+			}
+			if len(operands) > 0 {
+				operands = operands[:len(operands)-1]
+			}
+			operands = append(operands, strings.Join(parts, ""))
+			i++
+
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+
+		case isPDFSpace(c):
+			i++
+
+		default:
+			j := i
+			for j < len(content) && !isPDFSpace(content[j]) && !strings.ContainsRune("()<>[]/%", rune(content[j])) {
+				j++
+			}
+			if j == i {
+				// a name: read it as an operand
+				j = i + 1
+				for j < len(content) && !isPDFSpace(content[j]) && !strings.ContainsRune("()<>[]/%", rune(content[j])) {
+					j++
+				}
+				operands = append(operands, "")
+				i = j
+				continue
+			}
+
+			token := string(content[i:j])
+			i = j
+
+			if token[0] == '-' || token[0] == '.' || (token[0] >= '0' && token[0] <= '9') {
+				// numbers inside TJ arrays are kerning adjustments; large negative ones stand for spaces
+				if len(operands) > 0 && containsString(operands, "[") && strings.HasPrefix(token, "-") && len(token) >= 4 {
+					operands = append(operands, " ")
+				} else {
+					operands = append(operands, "")
+				}
+				continue
+			}
+
+			switch token {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				sb.WriteByte('\n')
+			case "Tj", "TJ":
+				if inText && len(operands) > 0 {
+					sb.WriteString(operands[len(operands)-1])
+				}
+			case "'", "\"":
+				if inText && len(operands) > 0 {
+					sb.WriteByte('\n')
+					sb.WriteString(operands[len(operands)-1])
+				}
+			case "T*":
+				sb.WriteByte('\n')
+			case "Td", "TD":
+				if inText {
+					sb.WriteByte('\n')
+				}
+			}
+
+			operands = operands[:0]
+		}
+	}
+
+	return sb.String()
+}
+
+// pdfLiteralString decodes a (literal) string at the start of b, returning it and the number of bytes consumed.
+func pdfLiteralString(b []byte) (string, int) {
+	var out []byte
+	depth := 0
+
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case '(':
+			if depth > 0 {
+				out = append(out, c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return pdfDecodeText(out), i + 1
+			}
+			out = append(out, c)
+		case '\\':
+			i++
+			if i >= len(b) {
+				break
+			}
+			switch e := b[i]; e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for k := 0; k < 3 && i < len(b) && b[i] >= '0' && b[i] <= '7'; k++ {
+						v = v*8 + int(b[i]-'0')
+						i++
+					}
+					i--
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+
+	return pdfDecodeText(out), len(b)
+}
+
+// pdfHexString decodes a <hex> string body.
+func pdfHexString(b []byte) string {
+	digits := make([]byte, 0, len(b))
+	for _, c := range b {
+		if !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	out, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return ""
+	}
+
+	return pdfDecodeText(out)
+}
+
+// pdfDecodeText converts PDF string bytes to UTF-8, treating them as UTF-16BE when they carry a byte order mark
+// and as Latin-1 otherwise.
+func pdfDecodeText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+
+	return string(runes)
+}
+
+// isPDFSpace reports whether c is PDF whitespace.
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+// containsString reports whether list contains s.
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncateUTF8 shortens s to at most max bytes without splitting a character.
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+
+	return s[:max]
+}
@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPDF builds a minimal PDF whose page content is compressed with FlateDecode.
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+
+	content := "BT /F1 12 Tf 72 720 Td (Hello \\(PDF\\) world) Tj 0 -14 Td [(Kern)-300(ed)] TJ ET\n" +
+		"BT <FEFF00E9007400E9> Tj ET"
+
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write([]byte(content))
+	_ = zw.Close()
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	b.WriteString("1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n")
+	b.WriteString("2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n")
+	b.WriteString("3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj\n")
+	fmt.Fprintf(&b, "4 0 obj << /Length %d /Filter /FlateDecode >>\nstream\n", z.Len())
+	b.Write(z.Bytes())
+	b.WriteString("\nendstream\nendobj\n")
+	b.WriteString("5 0 obj << /Type /XObject /Subtype /Image /Length 9 >>\nstream\n(ignored) Tj\nendstream\nendobj\n%%EOF\n")
+
+	return b.Bytes()
+}
+
+// testDOCX builds a minimal DOCX archive.
+func testDOCX(t *testing.T) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	w, _ := zw.Create("word/document.xml")
+	_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>` +
+		`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		`<w:p><w:r><w:t>First</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve"> paragraph</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>Second &amp; last</w:t></w:r></w:p></w:body></w:document>`))
+	_ = zw.Close()
+
+	return b.Bytes()
+}
+
+func TestTools_ExtractText(t *testing.T) {
+	var testTools Tools
+
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		expected []string
+	}{
+		{"plain", []byte("just text\n"), "text/plain; charset=utf-8", []string{"just text"}},
+		{"html", []byte("<html><head><style>p{}</style></head><body><p>Hi &amp; bye</p><script>x()</script></body></html>"), "text/html", []string{"Hi & bye"}},
+		{"docx", testDOCX(t), docxMIME, []string{"First\t paragraph\nSecond & last"}},
+		{"pdf", testPDF(t), "application/pdf", []string{"Hello (PDF) world", "Kern ed", "été"}},
+	}
+
+	for _, e := range tests {
+		text, err := testTools.ExtractText(context.Background(), bytes.NewReader(e.data), e.mimeType)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		for _, want := range e.expected {
+			if !strings.Contains(text, want) {
+				t.Errorf("%s: expected %q in %q", e.name, want, text)
+			}
+		}
+
+		if strings.Contains(text, "ignored") {
+			t.Errorf("%s: expected image streams to be skipped, got %q", e.name, text)
+		}
+	}
+
+	if _, err := testTools.ExtractText(context.Background(), strings.NewReader("x"), "image/png"); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("expected ErrUnsupportedType, got %v", err)
+	}
+
+	if _, err := testTools.ExtractText(context.Background(), strings.NewReader("too long"), "text/plain", ExtractOptions{MaxBytes: 3}); err == nil {
+		t.Error("expected error for oversized document")
+	}
+
+	text, _ := testTools.ExtractText(context.Background(), strings.NewReader("ééé"), "text/plain", ExtractOptions{MaxTextBytes: 3})
+	if text != "é" {
+		t.Errorf("expected text truncated on a character boundary, got %q", text)
+	}
+}
+
+func TestTools_ExtractTextFromFile(t *testing.T) {
+	var testTools Tools
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "doc.docx"), testDOCX(t), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "doc.pdf"), testPDF(t), 0o644)
+
+	for _, name := range []string{"doc.docx", "doc.pdf"} {
+		text, err := testTools.ExtractTextFromFile(context.Background(), filepath.Join(dir, name))
+		if err != nil || text == "" {
+			t.Errorf("%s: expected text, got %q, %v", name, text, err)
+		}
+	}
+}
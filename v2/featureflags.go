@@ -0,0 +1,297 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Flag is the definition of a feature flag.
+// Fields:
+// - Name: The flag name.
+// - Enabled: The master switch. A disabled flag is off for everyone.
+// - Rollout: The percentage (1-99) of subjects the flag is on for, chosen by consistent hashing so each subject
+// keeps its answer. 100 means everyone, as does 0 unless Users is set.
+// - Users: Subjects the flag is always on for, regardless of the rollout. A flag with users and no rollout is
+// on for those users only.
+// - Exclude: Subjects the flag is always off for.
+type Flag struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Rollout int      `json:"rollout,omitempty"`
+	Users   []string `json:"users,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// On evaluates the flag for a subject, e.g. a user ID. An empty subject only gets fully rolled out flags.
+func (f Flag) On(subject string) bool {
+	if !f.Enabled {
+		return false
+	}
+
+	for _, s := range f.Exclude {
+		if s == subject {
+			return false
+		}
+	}
+
+	for _, s := range f.Users {
+		if s == subject {
+			return true
+		}
+	}
+
+	if f.Rollout >= 100 || (f.Rollout <= 0 && len(f.Users) == 0) {
+		return true
+	}
+
+	if f.Rollout <= 0 {
+		return false
+	}
+
+	if subject == "" {
+		return false
+	}
+
+	return bucketOf(f.Name+":"+subject) < f.Rollout
+}
+
+// bucketOf maps a key to a stable bucket between 0 and 99.
+func bucketOf(key string) int {
+	return int(hash32(key) % 100)
+}
+
+// hash32 returns the 32-bit FNV-1a hash of key.
+func hash32(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+
+	return h.Sum32()
+}
+
+// FeatureFlags holds a set of flags that can be reloaded atomically while being evaluated concurrently.
+type FeatureFlags struct {
+	mu    sync.RWMutex
+	flags map[string]Flag
+}
+
+// NewFeatureFlags creates a FeatureFlags holding the given flags.
+func NewFeatureFlags(flags ...Flag) *FeatureFlags {
+	ff := &FeatureFlags{}
+	ff.Set(flags...)
+
+	return ff
+}
+
+// Set replaces all flags.
+func (ff *FeatureFlags) Set(flags ...Flag) {
+	m := make(map[string]Flag, len(flags))
+	for _, f := range flags {
+		m[f.Name] = f
+	}
+
+	ff.mu.Lock()
+	ff.flags = m
+	ff.mu.Unlock()
+}
+
+// LoadJSON replaces all flags with those decoded from r, either a JSON array of flags or an object mapping names
+// to flags.
+func (ff *FeatureFlags) LoadJSON(r io.Reader) error {
+	list, err := decodeFlags(r)
+	if err != nil {
+		return err
+	}
+
+	ff.Set(list...)
+
+	return nil
+}
+
+// decodeFlags decodes flags from a JSON array of flags or an object mapping names to flags.
+func decodeFlags(r io.Reader) ([]Flag, error) {
+	data, err := io.ReadAll(io.LimitReader(r, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Flag
+	if err := json.Unmarshal(data, &list); err != nil {
+		var byName map[string]Flag
+		if err := json.Unmarshal(data, &byName); err != nil {
+			return nil, fmt.Errorf("invalid feature flags: %w", err)
+		}
+
+		for name, f := range byName {
+			f.Name = name
+			list = append(list, f)
+		}
+	}
+
+	return list, nil
+}
+
+// LoadFile replaces all flags with those of a JSON file.
+func (ff *FeatureFlags) LoadFile(pathName string) error {
+	f, err := os.Open(pathName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return ff.LoadJSON(f)
+}
+
+// LoadURL replaces all flags with the JSON document served at rawURL.
+// Parameters:
+// - ctx: The context of the request.
+// - rawURL: The URL of the flags document.
+// - client: An optional http.Client. Only the first client is used if multiple are provided.
+// Returns an error if the document cannot be fetched or decoded; the current flags are kept in that case.
+func (ff *FeatureFlags) LoadURL(ctx context.Context, rawURL string, client ...*http.Client) error {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if len(client) > 0 {
+		httpClient = client[0]
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching feature flags", res.StatusCode)
+	}
+
+	return ff.LoadJSON(res.Body)
+}
+
+// PollURL reloads the flags from rawURL every interval until ctx is done. Failed reloads keep the current flags.
+// Parameters:
+// - ctx: The context stopping the polling.
+// - rawURL: The URL of the flags document.
+// - interval: The time between reloads.
+// - onError: An optional callback receiving reload errors.
+func (ff *FeatureFlags) PollURL(ctx context.Context, rawURL string, interval time.Duration, onError ...func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ff.LoadURL(ctx, rawURL); err != nil && len(onError) > 0 {
+				onError[0](err)
+			}
+		}
+	}
+}
+
+// LoadEnv adds or overrides flags from environment variables starting with prefix. FEATURE_NEW_UI=true enables
+// the "new_ui" flag for everyone, =false disables it, and =25 rolls it out to 25% of subjects.
+// Parameters:
+// - prefix: The variable name prefix, e.g. "FEATURE_".
+// Returns an error naming the first variable with an invalid value.
+func (ff *FeatureFlags) LoadEnv(prefix string) error {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+
+	if ff.flags == nil {
+		ff.flags = make(map[string]Flag)
+	}
+
+	for _, kv := range os.Environ() {
+		key, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(key, prefix) || len(key) == len(prefix) {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimPrefix(key, prefix))
+		f := ff.flags[name]
+		f.Name = name
+
+		if b, err := strconv.ParseBool(value); err == nil {
+			f.Enabled, f.Rollout = b, 0
+		} else if pct, err := strconv.Atoi(strings.TrimSuffix(value, "%")); err == nil && pct >= 0 && pct <= 100 {
+			f.Enabled, f.Rollout = pct > 0, pct
+		} else {
+			return fmt.Errorf("invalid value %q for %s: expected a boolean or a percentage", value, key)
+		}
+
+		ff.flags[name] = f
+	}
+
+	return nil
+}
+
+// Enabled reports whether the named flag is on for subject. Unknown flags are off.
+func (ff *FeatureFlags) Enabled(name, subject string) bool {
+	ff.mu.RLock()
+	f, ok := ff.flags[name]
+	ff.mu.RUnlock()
+
+	return ok && f.On(subject)
+}
+
+// Evaluate returns the value of every flag for subject.
+func (ff *FeatureFlags) Evaluate(subject string) map[string]bool {
+	ff.mu.RLock()
+	defer ff.mu.RUnlock()
+
+	values := make(map[string]bool, len(ff.flags))
+	for name, f := range ff.flags {
+		values[name] = f.On(subject)
+	}
+
+	return values
+}
+
+type featureFlagsContextKey struct{}
+
+// Middleware evaluates every flag once per request and stores the result in the request context, where
+// FeatureEnabled and FlagsFromContext read it. The map returned by FlagsFromContext can be passed to templates.
+// Parameters:
+// - subject: A function returning the subject of a request, e.g. the authenticated user ID. It may be nil.
+// Returns the middleware.
+func (ff *FeatureFlags) Middleware(subject func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s string
+			if subject != nil {
+				s = subject(r)
+			}
+
+			ctx := context.WithValue(r.Context(), featureFlagsContextKey{}, ff.Evaluate(s))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// FlagsFromContext returns the flags evaluated by FeatureFlags.Middleware, or an empty map.
+func FlagsFromContext(ctx context.Context) map[string]bool {
+	if flags, ok := ctx.Value(featureFlagsContextKey{}).(map[string]bool); ok {
+		return flags
+	}
+
+	return map[string]bool{}
+}
+
+// FeatureEnabled reports whether the named flag was evaluated as on for the current request.
+func FeatureEnabled(ctx context.Context, name string) bool {
+	return FlagsFromContext(ctx)[name]
+}
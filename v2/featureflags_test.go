@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlag_On(t *testing.T) {
+	f := Flag{Name: "new_ui", Enabled: true, Rollout: 30, Users: []string{"vip"}, Exclude: []string{"blocked"}}
+
+	on := 0
+	for i := 0; i < 1000; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		if f.On(subject) != f.On(subject) {
+			t.Fatal("expected evaluation to be stable")
+		}
+		if f.On(subject) {
+			on++
+		}
+	}
+
+	if on < 250 || on > 350 {
+		t.Errorf("expected roughly 30%% of subjects, got %d/1000", on)
+	}
+
+	if !f.On("vip") || f.On("blocked") {
+		t.Error("expected targeting to override the rollout")
+	}
+
+	f.Enabled = false
+	if f.On("vip") {
+		t.Error("expected disabled flag to be off for everyone")
+	}
+}
+
+func TestFeatureFlags_Loaders(t *testing.T) {
+	ff := NewFeatureFlags()
+
+	if err := ff.LoadJSON(strings.NewReader(`{"search": {"enabled": true}, "beta": {"enabled": true, "users": ["ann"]}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ff.Enabled("search", "") || !ff.Enabled("beta", "ann") || ff.Enabled("beta", "bob") || ff.Enabled("missing", "ann") {
+		t.Errorf("unexpected evaluation: %v", ff.Evaluate("ann"))
+	}
+
+	t.Setenv("TESTFEATURE_SEARCH", "false")
+	t.Setenv("TESTFEATURE_DARK_MODE", "100")
+	if err := ff.LoadEnv("TESTFEATURE_"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ff.Enabled("search", "") || !ff.Enabled("dark_mode", "") {
+		t.Errorf("expected environment to override flags, got %v", ff.Evaluate(""))
+	}
+
+	t.Setenv("TESTFEATURE_BROKEN", "maybe")
+	if err := ff.LoadEnv("TESTFEATURE_"); err == nil {
+		t.Error("expected error for invalid value")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"name": "remote", "enabled": true}]`))
+	}))
+	defer srv.Close()
+
+	if err := ff.LoadURL(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ff.Enabled("remote", "") || ff.Enabled("dark_mode", "") {
+		t.Errorf("expected remote document to replace flags, got %v", ff.Evaluate(""))
+	}
+}
+
+func TestFeatureFlags_Middleware(t *testing.T) {
+	ff := NewFeatureFlags(Flag{Name: "beta", Enabled: true, Users: []string{"ann"}})
+
+	handler := ff.Middleware(func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, FeatureEnabled(r.Context(), "beta"))
+	}))
+
+	for user, expected := range map[string]string{"ann": "true", "bob": "false"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", user)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Body.String() != expected {
+			t.Errorf("%s: expected %s, got %s", user, expected, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package toolkit
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FileNamer chooses the name a renamed upload is stored under, given its multipart header. Set Tools.FileNamer
+// to use one of the built-in namers or your own; names must not contain path separators.
+type FileNamer func(hdr *multipart.FileHeader) string
+
+// uploadExtRegex matches the characters kept in the extensions added by the built-in namers.
+var uploadExtRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// uploadExt returns the lower-cased extension of an uploaded file, with anything but letters and digits removed.
+func uploadExt(hdr *multipart.FileHeader) string {
+	ext := uploadExtRegex.ReplaceAllString(strings.ToLower(filepath.Ext(hdr.Filename)), "")
+	if ext == "" {
+		return ""
+	}
+
+	return "." + ext
+}
+
+// UUIDNamer names uploads with a random UUID, e.g. "3f2b8c1e-9d4a-4c7e-8b1f-2a6d5e9c0b7a.png".
+func UUIDNamer(hdr *multipart.FileHeader) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]) + uploadExt(hdr)
+}
+
+// crockfordBase32 is the alphabet of ULIDs.
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDNamer names uploads with a ULID, e.g. "01HQ3K4Z8X2N5V7B9C1D3F5G7J.png", which sorts by upload time.
+func ULIDNamer(hdr *multipart.FileHeader) string {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(id[6:])
+
+	// encode the 128 bits as 26 base32 characters, the first holding the top 3 bits
+	var out [26]byte
+	hi, lo := binary.BigEndian.Uint64(id[:8]), binary.BigEndian.Uint64(id[8:])
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+
+	return string(out[:]) + uploadExt(hdr)
+}
+
+// ContentHashNamer names uploads with the SHA-256 of their content, e.g. "9f86d0….png", so identical files share
+// a name and are stored once. If the file cannot be read, it falls back to UUIDNamer.
+func ContentHashNamer(hdr *multipart.FileHeader) string {
+	f, err := hdr.Open()
+	if err != nil {
+		return UUIDNamer(hdr)
+	}
+	defer f.Close()
+
+	hw, _ := NewHashingWriter(nil, HashSHA256)
+	if _, err := io.Copy(hw, f); err != nil {
+		return UUIDNamer(hdr)
+	}
+
+	return hw.Hex(HashSHA256) + uploadExt(hdr)
+}
+
+// DatePrefixedNamer names uploads with the current UTC date and time and a random suffix, e.g.
+// "20240102-150405-9f3a1c2b.png", so they sort chronologically.
+func DatePrefixedNamer(hdr *multipart.FileHeader) string {
+	return time.Now().UTC().Format("20060102-150405") + "-" + randomHex(4) + uploadExt(hdr)
+}
+
+// SlugNamer names uploads after their original name, slugified, with a random suffix so uploads of the same name
+// do not overwrite each other, e.g. "Holiday Photo.JPG" becomes "holiday-photo-9f3a1c.jpg". Names with nothing
+// left to slugify become "file-9f3a1c.jpg".
+func SlugNamer(hdr *multipart.FileHeader) string {
+	base := strings.TrimSuffix(filepath.Base(hdr.Filename), filepath.Ext(hdr.Filename))
+
+	slug, err := (&Tools{}).Slugify(base)
+	if err != nil {
+		slug = "file"
+	}
+	if len(slug) > 100 {
+		slug = strings.TrimRight(slug[:100], "-")
+	}
+
+	return slug + "-" + randomHex(3) + uploadExt(hdr)
+}
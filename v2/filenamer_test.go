@@ -0,0 +1,90 @@
+package toolkit
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// testFileHeader returns the header of an uploaded file with the given name and content.
+func testFileHeader(t *testing.T, name, content string) *multipart.FileHeader {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+
+	return req.MultipartForm.File["file"][0]
+}
+
+var fileNamerTests = []struct {
+	name     string
+	namer    FileNamer
+	filename string
+	pattern  string
+}{
+	{name: "uuid", namer: UUIDNamer, filename: "Photo.PNG", pattern: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.png$`},
+	{name: "ulid", namer: ULIDNamer, filename: "photo.png", pattern: `^[0-9A-HJKMNP-TV-Z]{26}\.png$`},
+	{name: "content hash", namer: ContentHashNamer, filename: "hello.txt", pattern: `^2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824\.txt$`},
+	{name: "date prefixed", namer: DatePrefixedNamer, filename: "a.tar.gz", pattern: `^\d{8}-\d{6}-[0-9a-f]{8}\.gz$`},
+	{name: "slug", namer: SlugNamer, filename: "My Holiday Photo.JPG", pattern: `^my-holiday-photo-[0-9a-f]{6}\.jpg$`},
+	{name: "slug without letters", namer: SlugNamer, filename: "???.pdf", pattern: `^file-[0-9a-f]{6}\.pdf$`},
+	{name: "unsafe extension", namer: UUIDNamer, filename: "x.P H!P", pattern: `^[0-9a-f-]{36}\.php$`},
+}
+
+func TestFileNamers(t *testing.T) {
+	for _, e := range fileNamerTests {
+		got := e.namer(testFileHeader(t, e.filename, "hello"))
+		if !regexp.MustCompile(e.pattern).MatchString(got) {
+			t.Errorf("%s: %q does not match %s", e.name, got, e.pattern)
+		}
+	}
+}
+
+func TestULIDNamer_Sortable(t *testing.T) {
+	hdr := testFileHeader(t, "a.txt", "a")
+
+	first := ULIDNamer(hdr)
+	time.Sleep(2 * time.Millisecond)
+	second := ULIDNamer(hdr)
+
+	if first >= second {
+		t.Errorf("expected %s to sort before %s", first, second)
+	}
+}
+
+func TestTools_UploadFilesFileNamer(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "Quarterly Report.txt")
+	_, _ = part.Write([]byte("numbers"))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{FileNamer: SlugNamer}
+	dir := t.TempDir()
+
+	files, err := testTools.UploadFiles(req, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^quarterly-report-[0-9a-f]{6}\.txt$`).MatchString(files[0].NewFileName) {
+		t.Errorf("expected a slugified name, got %s", files[0].NewFileName)
+	}
+	if _, err := os.Stat(filepath.Join(dir, files[0].NewFileName)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,377 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTrashNotFound is returned for unknown or purged trash entries.
+	ErrTrashNotFound = errors.New("trashed file not found")
+	// ErrFileExists is returned when restoring a file whose original path is taken.
+	ErrFileExists = errors.New("file already exists")
+)
+
+// TrashedFile describes a soft-deleted file, as listed for recovery UIs.
+// Fields:
+// - ID: The identifier used to restore or purge the file.
+// - Name: The file's original name within the store.
+// - Size: The size of the file in bytes.
+// - DeletedAt: When the file was deleted.
+// - ExpiresAt: When PurgeTrash may remove the file for good.
+type TrashedFile struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// FileStore stores managed files by name. Delete is a soft delete: files go to a trash area, from which they can
+// be restored until their retention period ends.
+type FileStore interface {
+	// Open returns the contents of the named file.
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+	// Save writes the named file, replacing any existing one.
+	Save(ctx context.Context, name string, r io.Reader) error
+	// Delete moves the named file to the trash.
+	Delete(ctx context.Context, name string) error
+	// Restore moves a trashed file back to its original name, returning that name.
+	Restore(ctx context.Context, id string) (string, error)
+	// Trash lists the trashed files, most recently deleted first.
+	Trash(ctx context.Context) ([]TrashedFile, error)
+	// PurgeTrash permanently removes the given trashed files, or every expired one if no IDs are given, returning
+	// the number removed.
+	PurgeTrash(ctx context.Context, ids ...string) (int, error)
+}
+
+// LocalFileStore is a FileStore on the local disk. Names are slash-separated paths relative to Root; when the
+// context carries a tenant (see TenantMiddleware), they are relative to Root/<tenant> instead, each tenant with
+// its own trash.
+// Fields:
+// - Root: The directory holding the files.
+// - Retention: How long deleted files are kept in the trash. Defaults to 30 days.
+// - Authorizer: If set, consulted for each operation with the subject in the context, like Tools.Authorizer.
+type LocalFileStore struct {
+	Root       string
+	Retention  time.Duration
+	Authorizer Authorizer
+}
+
+// trashDirName is the directory, inside Root or the tenant's directory, holding trashed files.
+const trashDirName = ".trash"
+
+// NewLocalFileStore returns a LocalFileStore rooted at root with the default retention.
+func NewLocalFileStore(root string) *LocalFileStore {
+	return &LocalFileStore{Root: root}
+}
+
+// base returns the directory for the tenant in ctx, or Root.
+func (s *LocalFileStore) base(ctx context.Context) (string, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return s.Root, nil
+	}
+	if !tenantIDRegex.MatchString(tenant) {
+		return "", ErrNoTenant
+	}
+
+	return filepath.Join(s.Root, tenant), nil
+}
+
+// resolve maps a file name to its path, rejecting names outside the store or inside the trash.
+func (s *LocalFileStore) resolve(ctx context.Context, name string) (string, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	full := filepath.Join(base, filepath.FromSlash(name))
+	if full == filepath.Clean(base) || !pathWithin(full, base) || pathWithin(full, filepath.Join(base, trashDirName)) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	return full, nil
+}
+
+// authorize consults s.Authorizer, if set, for the subject in ctx.
+func (s *LocalFileStore) authorize(ctx context.Context, action FileAction, object string) error {
+	t := Tools{Authorizer: s.Authorizer}
+	return t.authorize(ctx, action, object)
+}
+
+// retention returns s.Retention or the default.
+func (s *LocalFileStore) retention() time.Duration {
+	if s.Retention > 0 {
+		return s.Retention
+	}
+
+	return 30 * 24 * time.Hour
+}
+
+// Open returns the contents of the named file, after checking the FileDownload permission.
+func (s *LocalFileStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	p, err := s.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, FileDownload, p); err != nil {
+		return nil, err
+	}
+
+	return os.Open(p)
+}
+
+// Save writes the named file atomically, through a temporary file in the same directory, after checking the
+// FileUpload permission.
+func (s *LocalFileStore) Save(ctx context.Context, name string, r io.Reader) error {
+	p, err := s.resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, FileUpload, p); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := copyBuffered(tmp, r); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
+}
+
+// Delete moves the named file to the trash, after checking the FileDelete permission. It is kept for Retention.
+func (s *LocalFileStore) Delete(ctx context.Context, name string) error {
+	p, err := s.resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, FileDelete, p); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("cannot delete a directory")
+	}
+
+	base, _ := s.base(ctx)
+	trash := filepath.Join(base, trashDirName)
+	if err := os.MkdirAll(trash, 0700); err != nil {
+		return err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	entry := TrashedFile{
+		ID:        hex.EncodeToString(b),
+		Name:      filepath.ToSlash(mustRel(base, p)),
+		Size:      info.Size(),
+		DeletedAt: now,
+		ExpiresAt: now.Add(s.retention()),
+	}
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(trash, entry.ID+".json"), meta, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(p, filepath.Join(trash, entry.ID)); err != nil {
+		_ = os.Remove(filepath.Join(trash, entry.ID+".json"))
+		return err
+	}
+
+	return nil
+}
+
+// mustRel returns p relative to base; p is known to be inside base.
+func mustRel(base, p string) string {
+	rel, err := filepath.Rel(base, p)
+	if err != nil {
+		return p
+	}
+
+	return rel
+}
+
+// trashEntry loads the metadata of a trashed file.
+func (s *LocalFileStore) trashEntry(ctx context.Context, id string) (string, *TrashedFile, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", nil, ErrTrashNotFound
+	}
+
+	trash := filepath.Join(base, trashDirName)
+
+	meta, err := os.ReadFile(filepath.Join(trash, id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, ErrTrashNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	var entry TrashedFile
+	if err := json.Unmarshal(meta, &entry); err != nil {
+		return "", nil, err
+	}
+
+	return trash, &entry, nil
+}
+
+// Restore moves a trashed file back to its original name, after checking the FileUpload permission for it.
+// Returns the original name, ErrTrashNotFound for unknown IDs, or ErrFileExists if the name has been reused.
+func (s *LocalFileStore) Restore(ctx context.Context, id string) (string, error) {
+	trash, entry, err := s.trashEntry(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	p, err := s.resolve(ctx, entry.Name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.authorize(ctx, FileUpload, p); err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(p); err == nil {
+		return "", ErrFileExists
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+	if err := os.Rename(filepath.Join(trash, id), p); err != nil {
+		return "", err
+	}
+
+	_ = os.Remove(filepath.Join(trash, id+".json"))
+
+	return entry.Name, nil
+}
+
+// Trash lists the trashed files, most recently deleted first, after checking the FileList permission on the
+// trash directory.
+func (s *LocalFileStore) Trash(ctx context.Context) ([]TrashedFile, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	trash := filepath.Join(base, trashDirName)
+	if err := s.authorize(ctx, FileList, trash); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(trash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TrashedFile{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]TrashedFile, 0, len(entries)/2)
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+
+		if _, entry, err := s.trashEntry(ctx, id); err == nil {
+			files = append(files, *entry)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].DeletedAt.After(files[j].DeletedAt) })
+
+	return files, nil
+}
+
+// PurgeTrash permanently removes trashed files, after checking the FileDelete permission on the trash directory.
+// With no IDs it removes every file past its retention, so it can be run periodically, e.g. with a Scheduler.
+// Returns the number of files removed, or ErrTrashNotFound if a given ID is unknown.
+func (s *LocalFileStore) PurgeTrash(ctx context.Context, ids ...string) (int, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	trash := filepath.Join(base, trashDirName)
+	if err := s.authorize(ctx, FileDelete, trash); err != nil {
+		return 0, err
+	}
+
+	expiredOnly := len(ids) == 0
+	if expiredOnly {
+		files, err := s.Trash(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now()
+		for _, f := range files {
+			if now.After(f.ExpiresAt) {
+				ids = append(ids, f.ID)
+			}
+		}
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if _, _, err := s.trashEntry(ctx, id); err != nil {
+			if expiredOnly {
+				continue
+			}
+			return purged, err
+		}
+
+		if err := os.Remove(filepath.Join(trash, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return purged, err
+		}
+		_ = os.Remove(filepath.Join(trash, id+".json"))
+		purged++
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,127 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalFileStore_TrashAndRestore(t *testing.T) {
+	root := t.TempDir()
+	store := NewLocalFileStore(root)
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "docs/plan.txt", strings.NewReader("the plan")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Delete(ctx, "docs/plan.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "docs", "plan.txt")); !os.IsNotExist(err) {
+		t.Error("expected the file to be gone from its original path")
+	}
+
+	trash, err := store.Trash(ctx)
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("expected one trashed file, got %v, %v", trash, err)
+	}
+	if trash[0].Name != "docs/plan.txt" || trash[0].Size != 8 || !trash[0].ExpiresAt.After(time.Now().Add(29*24*time.Hour)) {
+		t.Errorf("unexpected trash entry %+v", trash[0])
+	}
+
+	if _, err := store.Open(ctx, ".trash/"+trash[0].ID); err == nil {
+		t.Error("expected trash to be unreachable through Open")
+	}
+
+	name, err := store.Restore(ctx, trash[0].ID)
+	if err != nil || name != "docs/plan.txt" {
+		t.Fatalf("expected restore of docs/plan.txt, got %q, %v", name, err)
+	}
+
+	f, err := store.Open(ctx, "docs/plan.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(b) != "the plan" {
+		t.Errorf("expected restored content, got %q", b)
+	}
+
+	if _, err := store.Restore(ctx, trash[0].ID); !errors.Is(err, ErrTrashNotFound) {
+		t.Errorf("expected ErrTrashNotFound restoring twice, got %v", err)
+	}
+
+	// restoring over a reused name fails
+	_ = store.Delete(ctx, "docs/plan.txt")
+	_ = store.Save(ctx, "docs/plan.txt", strings.NewReader("new plan"))
+	trash, _ = store.Trash(ctx)
+	if _, err := store.Restore(ctx, trash[0].ID); !errors.Is(err, ErrFileExists) {
+		t.Errorf("expected ErrFileExists, got %v", err)
+	}
+}
+
+func TestLocalFileStore_PurgeTrash(t *testing.T) {
+	store := &LocalFileStore{Root: t.TempDir(), Retention: time.Millisecond}
+	ctx := context.Background()
+
+	for _, name := range []string{"a.txt", "b.txt"} {
+		_ = store.Save(ctx, name, strings.NewReader(name))
+		_ = store.Delete(ctx, name)
+	}
+
+	if n, err := store.PurgeTrash(ctx, "0123"); !errors.Is(err, ErrTrashNotFound) || n != 0 {
+		t.Errorf("expected ErrTrashNotFound for an unknown ID, got %d, %v", n, err)
+	}
+
+	trash, _ := store.Trash(ctx)
+	if n, err := store.PurgeTrash(ctx, trash[0].ID); err != nil || n != 1 {
+		t.Errorf("expected one file purged by ID, got %d, %v", n, err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if n, err := store.PurgeTrash(ctx); err != nil || n != 1 {
+		t.Errorf("expected the expired file purged, got %d, %v", n, err)
+	}
+
+	if trash, _ := store.Trash(ctx); len(trash) != 0 {
+		t.Errorf("expected empty trash, got %v", trash)
+	}
+}
+
+func TestLocalFileStore_Scoping(t *testing.T) {
+	root := t.TempDir()
+	store := &LocalFileStore{Root: root, Authorizer: &RoleAuthorizer{Rules: []ACLRule{
+		{Role: "*", Actions: []FileAction{FileUpload, FileDownload}},
+	}}}
+
+	acme := WithSubject(WithTenant(context.Background(), "acme"), Subject{ID: "ann"})
+	globex := WithSubject(WithTenant(context.Background(), "globex"), Subject{ID: "bob"})
+
+	if err := store.Save(acme, "x.txt", strings.NewReader("x")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "acme", "x.txt")); err != nil {
+		t.Errorf("expected the file in the tenant directory: %s", err)
+	}
+
+	if _, err := store.Open(globex, "x.txt"); err == nil {
+		t.Error("expected another tenant not to see the file")
+	}
+
+	if err := store.Save(acme, "../globex/x.txt", strings.NewReader("x")); err == nil {
+		t.Error("expected error for a name escaping the tenant directory")
+	}
+
+	if err := store.Delete(acme, "x.txt"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden without the delete permission, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package toolkit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	flashCookieName = "flash"
+	// flashMaxSize keeps the cookie well below the 4 KB browsers accept
+	flashMaxSize = 3000
+)
+
+// Flash is a one-time message shown on the next page, e.g. after a redirect.
+// Fields:
+// - Kind: The kind of message, e.g. "success" or "error", typically used as a CSS class.
+// - Message: The text.
+type Flash struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+// AddFlash queues a message for the next page the client loads. Messages are kept in a cookie, so they survive a
+// redirect without server-side sessions; the oldest are dropped if they outgrow the cookie.
+// Parameters:
+// - w: The http.ResponseWriter, before the header is written.
+// - r: The current request, whose pending messages are kept.
+// - kind: The kind of message, e.g. "success".
+// - message: The text.
+func (t *Tools) AddFlash(w http.ResponseWriter, r *http.Request, kind, message string) {
+	flashes := pendingFlashes(w)
+	if flashes == nil {
+		flashes = requestFlashes(r)
+	}
+	flashes = append(flashes, Flash{Kind: kind, Message: message})
+
+	var value string
+	for len(flashes) > 0 {
+		data, _ := json.Marshal(flashes)
+		value = base64.RawURLEncoding.EncodeToString(data)
+		if len(value) <= flashMaxSize {
+			break
+		}
+		flashes = flashes[1:]
+	}
+
+	setFlashCookie(w, &http.Cookie{Name: flashCookieName, Value: value, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+}
+
+// Flashes returns the queued messages and clears them, so each is shown once.
+// Parameters:
+// - w: The http.ResponseWriter, before the header is written.
+// - r: The current request.
+// Returns the messages, oldest first.
+func (t *Tools) Flashes(w http.ResponseWriter, r *http.Request) []Flash {
+	flashes := pendingFlashes(w)
+	if flashes == nil {
+		flashes = requestFlashes(r)
+	}
+
+	if len(flashes) > 0 {
+		setFlashCookie(w, &http.Cookie{Name: flashCookieName, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	}
+
+	return flashes
+}
+
+// requestFlashes decodes the messages in the request's cookie.
+func requestFlashes(r *http.Request) []Flash {
+	c, err := r.Cookie(flashCookieName)
+	if err != nil {
+		return nil
+	}
+
+	return decodeFlashes(c.Value)
+}
+
+// pendingFlashes decodes the messages already set on the response, or returns nil if there are none.
+func pendingFlashes(w http.ResponseWriter) []Flash {
+	for _, line := range w.Header()["Set-Cookie"] {
+		if value, ok := strings.CutPrefix(line, flashCookieName+"="); ok {
+			value, _, _ = strings.Cut(value, ";")
+			if flashes := decodeFlashes(value); flashes != nil {
+				return flashes
+			}
+			return []Flash{}
+		}
+	}
+
+	return nil
+}
+
+// decodeFlashes decodes a cookie value.
+func decodeFlashes(value string) []Flash {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil
+	}
+
+	var flashes []Flash
+	if json.Unmarshal(data, &flashes) != nil {
+		return nil
+	}
+
+	return flashes
+}
+
+// setFlashCookie replaces any flash cookie already set on the response.
+func setFlashCookie(w http.ResponseWriter, c *http.Cookie) {
+	lines := w.Header()["Set-Cookie"]
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(line, flashCookieName+"=") {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == 0 {
+		w.Header().Del("Set-Cookie")
+	} else {
+		w.Header()["Set-Cookie"] = kept
+	}
+
+	http.SetCookie(w, c)
+}
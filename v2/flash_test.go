@@ -0,0 +1,46 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTools_Flashes(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/save", nil)
+	testTools.AddFlash(rr, req, "success", "Saved")
+	testTools.AddFlash(rr, req, "info", "Check your email")
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one flash cookie, got %v", cookies)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookies[0])
+
+	expected := []Flash{{Kind: "success", Message: "Saved"}, {Kind: "info", Message: "Check your email"}}
+	if flashes := testTools.Flashes(rr, req); !reflect.DeepEqual(flashes, expected) {
+		t.Errorf("expected %v, got %v", expected, flashes)
+	}
+	if c := rr.Result().Cookies(); len(c) != 1 || c[0].MaxAge != -1 {
+		t.Errorf("expected the flash cookie to be cleared, got %v", c)
+	}
+	if flashes := testTools.Flashes(rr, req); len(flashes) != 0 {
+		t.Errorf("expected flashes to be read once, got %v", flashes)
+	}
+
+	rr = httptest.NewRecorder()
+	for i := 0; i < 100; i++ {
+		testTools.AddFlash(rr, req, "info", strings.Repeat("x", 50))
+	}
+	if c := rr.Result().Cookies(); len(c) != 1 || len(c[0].Value) > flashMaxSize {
+		t.Errorf("expected the oldest flashes to be dropped, got %d cookies", len(c))
+	}
+}
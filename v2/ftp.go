@@ -0,0 +1,462 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/textproto"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FTPError is a negative reply from an FTP server.
+type FTPError struct {
+	Code    int
+	Message string
+}
+
+// Error returns the reply code and message.
+func (e *FTPError) Error() string {
+	return fmt.Sprintf("ftp: %d %s", e.Code, e.Message)
+}
+
+// Temporary reports whether the reply is a transient 4xx failure, such as 421 Service not available.
+func (e *FTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// Is makes 550 replies, file unavailable, match fs.ErrNotExist.
+func (e *FTPError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.Code == 550
+}
+
+// FTPOptions configures DialFTP.
+// Fields:
+// - User: The user name. Defaults to "anonymous".
+// - Password: The password.
+// - TLS: If set, the session is upgraded with AUTH TLS (explicit FTPS) and data connections are encrypted too.
+// - Timeout: The timeout for connecting and for each reply. Defaults to 30 seconds.
+type FTPOptions struct {
+	User     string
+	Password string
+	TLS      *tls.Config
+	Timeout  time.Duration
+}
+
+// ftpConn is an FTP session implementing RemoteFS. Listings use MLSD and MLST (RFC 3659), which all current
+// servers support.
+type ftpConn struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string
+	tls     *tls.Config
+	timeout time.Duration
+}
+
+// DialFTP opens an FTP session in binary, passive mode.
+// Parameters:
+// - ctx: The context for connecting.
+// - addr: The server address, e.g. "files.example.com:21".
+// - opts: Optional FTPOptions. Only the first value is used if multiple are provided.
+// Returns the session, or an error if connecting or logging in fails.
+func DialFTP(ctx context.Context, addr string, opts ...FTPOptions) (RemoteFS, error) {
+	var o FTPOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.User == "" {
+		o.User = "anonymous"
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Second
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	d := net.Dialer{Timeout: o.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn), host: host, timeout: o.Timeout}
+
+	if _, _, err := c.reply(220); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	if o.TLS != nil {
+		if _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+
+		config := o.TLS.Clone()
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		config.ClientSessionCache = tls.NewLRUClientSessionCache(4)
+
+		tlsConn := tls.Client(conn, config)
+		c.conn, c.text, c.tls = tlsConn, textproto.NewConn(tlsConn), config
+
+		if _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		if _, err := c.cmd(200, "PROT P"); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+	}
+
+	if err := c.login(o.User, o.Password); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	if _, err := c.cmd(200, "TYPE I"); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewFTPStore returns a RemoteStore on an FTP server.
+// Parameters:
+// - addr: The server address, e.g. "files.example.com:21".
+// - root: The remote directory holding the files.
+// - opts: Optional FTPOptions, such as credentials. Only the first value is used if multiple are provided.
+// Returns the store.
+func NewFTPStore(addr, root string, opts ...FTPOptions) *RemoteStore {
+	return &RemoteStore{
+		Dial: func(ctx context.Context) (RemoteFS, error) {
+			return DialFTP(ctx, addr, opts...)
+		},
+		Root: root,
+	}
+}
+
+// login authenticates the session.
+func (c *ftpConn) login(user, password string) error {
+	code, msg, err := c.send("USER %s", user)
+	if err != nil {
+		return err
+	}
+
+	switch code {
+	case 230:
+		return nil
+	case 331:
+		_, err := c.cmd(230, "PASS %s", password)
+		return err
+	}
+
+	return &FTPError{Code: code, Message: msg}
+}
+
+// send writes a command and reads the reply, whatever its code.
+func (c *ftpConn) send(format string, args ...interface{}) (int, string, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+
+	return c.reply(0)
+}
+
+// reply reads a reply, checking its code against expected unless expected is 0.
+func (c *ftpConn) reply(expected int) (int, string, error) {
+	_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		var protoErr *textproto.Error
+		if !errors.As(err, &protoErr) {
+			return 0, "", err
+		}
+		code, msg = protoErr.Code, protoErr.Msg
+	}
+
+	if expected != 0 && code != expected {
+		return code, msg, &FTPError{Code: code, Message: msg}
+	}
+
+	return code, msg, nil
+}
+
+// cmd sends a command that must get the expected reply code.
+func (c *ftpConn) cmd(expected int, format string, args ...interface{}) (string, error) {
+	code, msg, err := c.send(format, args...)
+	if err != nil {
+		return "", err
+	}
+	if code != expected {
+		return "", &FTPError{Code: code, Message: msg}
+	}
+
+	return msg, nil
+}
+
+// dataConn opens a passive data connection, preferring EPSV.
+func (c *ftpConn) dataConn() (net.Conn, error) {
+	var port int
+
+	code, msg, err := c.send("EPSV")
+	if err != nil {
+		return nil, err
+	}
+
+	if code == 229 {
+		// 229 Entering Extended Passive Mode (|||6446|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+		}
+		if port, err = strconv.Atoi(msg[start+4 : end]); err != nil {
+			return nil, fmt.Errorf("ftp: invalid EPSV reply %q", msg)
+		}
+	} else {
+		msg, err := c.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+
+		// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2); the address is ignored in favour of the control
+		// connection's host, which also works behind NAT
+		start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+		}
+		parts := strings.Split(msg[start+1:end], ",")
+		if len(parts) != 6 {
+			return nil, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+		}
+		p1, err1 := strconv.Atoi(strings.TrimSpace(parts[4]))
+		p2, err2 := strconv.Atoi(strings.TrimSpace(parts[5]))
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("ftp: invalid PASV reply %q", msg)
+		}
+		port = p1<<8 | p2
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(c.host, strconv.Itoa(port)), c.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.tls != nil {
+		return tls.Client(conn, c.tls), nil
+	}
+
+	return conn, nil
+}
+
+// transfer opens a data connection and starts a transfer command.
+func (c *ftpConn) transfer(format string, args ...interface{}) (net.Conn, error) {
+	data, err := c.dataConn()
+	if err != nil {
+		return nil, err
+	}
+
+	code, msg, err := c.send(format, args...)
+	if err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+	if code != 125 && code != 150 {
+		_ = data.Close()
+		return nil, &FTPError{Code: code, Message: msg}
+	}
+
+	return data, nil
+}
+
+// ftpTransfer is a data connection that reads the transfer's final reply when it is closed.
+type ftpTransfer struct {
+	net.Conn
+	c *ftpConn
+}
+
+// Close closes the data connection and checks that the transfer completed.
+func (t *ftpTransfer) Close() error {
+	err := t.Conn.Close()
+	if _, _, replyErr := t.c.reply(226); replyErr != nil {
+		return replyErr
+	}
+
+	return err
+}
+
+// Open starts downloading a file.
+func (c *ftpConn) Open(name string) (io.ReadCloser, error) {
+	data, err := c.transfer("RETR %s", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ftpTransfer{Conn: data, c: c}, nil
+}
+
+// Create starts uploading a file.
+func (c *ftpConn) Create(name string) (io.WriteCloser, error) {
+	data, err := c.transfer("STOR %s", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ftpTransfer{Conn: data, c: c}, nil
+}
+
+// Rename moves a file.
+func (c *ftpConn) Rename(oldName, newName string) error {
+	if _, err := c.cmd(350, "RNFR %s", oldName); err != nil {
+		return err
+	}
+
+	_, err := c.cmd(250, "RNTO %s", newName)
+	return err
+}
+
+// Remove deletes a file.
+func (c *ftpConn) Remove(name string) error {
+	_, err := c.cmd(250, "DELE %s", name)
+	return err
+}
+
+// MkdirAll creates a directory and its parents, ignoring those that exist.
+func (c *ftpConn) MkdirAll(dir string) error {
+	dir = path.Clean(dir)
+	if dir == "." || dir == "/" {
+		return nil
+	}
+
+	if info, err := c.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("ftp: %s is not a directory", dir)
+		}
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := c.MkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	_, err := c.cmd(257, "MKD %s", dir)
+	return err
+}
+
+// ReadDir lists a directory with MLSD.
+func (c *ftpConn) ReadDir(dir string) ([]fs.FileInfo, error) {
+	data, err := c.transfer("MLSD %s", dir)
+	if err != nil {
+		return nil, err
+	}
+
+	transfer := &ftpTransfer{Conn: data, c: c}
+	listing, err := io.ReadAll(transfer)
+	if closeErr := transfer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []fs.FileInfo
+	for _, line := range strings.Split(string(listing), "\n") {
+		info, ok := parseMLSXEntry(strings.TrimRight(line, "\r"))
+		if !ok || info.name == "." || info.name == ".." || info.kind == "cdir" || info.kind == "pdir" {
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// Stat describes a file with MLST.
+func (c *ftpConn) Stat(name string) (fs.FileInfo, error) {
+	msg, err := c.cmd(250, "MLST %s", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// the facts are on the indented line of the multi-line reply
+	for _, line := range strings.Split(msg, "\n") {
+		if info, ok := parseMLSXEntry(strings.TrimSpace(line)); ok {
+			info.name = path.Base(info.name)
+			return info, nil
+		}
+	}
+
+	return nil, fmt.Errorf("ftp: invalid MLST reply %q", msg)
+}
+
+// Close ends the session.
+func (c *ftpConn) Close() error {
+	_, _, _ = c.send("QUIT")
+	return c.conn.Close()
+}
+
+// ftpFileInfo is a file described by MLSD or MLST.
+type ftpFileInfo struct {
+	name    string
+	kind    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *ftpFileInfo) Name() string       { return i.name }
+func (i *ftpFileInfo) Size() int64        { return i.size }
+func (i *ftpFileInfo) ModTime() time.Time { return i.modTime }
+func (i *ftpFileInfo) IsDir() bool        { return i.kind == "dir" || i.kind == "cdir" || i.kind == "pdir" }
+func (i *ftpFileInfo) Sys() interface{}   { return nil }
+
+// Mode returns a mode with the directory bit set for directories.
+func (i *ftpFileInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0755
+	}
+
+	return 0644
+}
+
+// parseMLSXEntry parses a line such as "type=file;size=12;modify=20240101120000; name.txt".
+func parseMLSXEntry(line string) (*ftpFileInfo, bool) {
+	facts, name, ok := strings.Cut(line, " ")
+	if !ok || name == "" || !strings.Contains(facts, "=") {
+		return nil, false
+	}
+
+	info := &ftpFileInfo{name: name}
+	for _, fact := range strings.Split(facts, ";") {
+		key, value, _ := strings.Cut(fact, "=")
+
+		switch strings.ToLower(key) {
+		case "type":
+			info.kind = strings.ToLower(value)
+		case "size":
+			info.size, _ = strconv.ParseInt(value, 10, 64)
+		case "modify":
+			if len(value) >= 14 {
+				info.modTime, _ = time.Parse("20060102150405", value[:14])
+			}
+		}
+	}
+
+	return info, true
+}
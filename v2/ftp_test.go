@@ -0,0 +1,259 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeFTPServer serves an in-memory file system over the subset of FTP used by DialFTP.
+type fakeFTPServer struct {
+	ln    net.Listener
+	mu    sync.Mutex
+	files map[string]string
+	dirs  map[string]bool
+}
+
+func newFakeFTPServer(t *testing.T) *fakeFTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &fakeFTPServer{ln: ln, files: map[string]string{}, dirs: map[string]bool{"/": true}}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	var data net.Listener
+	var renameFrom string
+	accept := func() net.Conn {
+		if data == nil {
+			return nil
+		}
+		c, err := data.Accept()
+		_ = data.Close()
+		data = nil
+		if err != nil {
+			return nil
+		}
+		return c
+	}
+
+	reply("220 ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+
+		s.mu.Lock()
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			reply("331 password please")
+		case "PASS":
+			if arg == "secret" {
+				reply("230 logged in")
+			} else {
+				reply("530 login incorrect")
+			}
+		case "TYPE":
+			reply("200 binary")
+		case "EPSV":
+			data, _ = net.Listen("tcp", "127.0.0.1:0")
+			reply("229 Entering Extended Passive Mode (|||%d|)", data.Addr().(*net.TCPAddr).Port)
+		case "RETR":
+			content, ok := s.files[arg]
+			if !ok {
+				_ = accept()
+				reply("550 not found")
+				break
+			}
+			reply("150 sending")
+			c := accept()
+			_, _ = io.WriteString(c, content)
+			_ = c.Close()
+			reply("226 done")
+		case "STOR":
+			reply("150 receiving")
+			c := accept()
+			s.mu.Unlock()
+			b, _ := io.ReadAll(c)
+			s.mu.Lock()
+			s.files[arg] = string(b)
+			reply("226 done")
+		case "MLSD":
+			reply("150 listing")
+			c := accept()
+			fmt.Fprintf(c, "type=cdir; %s\r\n", arg)
+			for name, content := range s.files {
+				if path.Dir(name) == arg {
+					fmt.Fprintf(c, "type=file;size=%d;modify=20240102030405; %s\r\n", len(content), path.Base(name))
+				}
+			}
+			_ = c.Close()
+			reply("226 done")
+		case "MLST":
+			if s.dirs[arg] {
+				reply("250-facts\r\n type=dir; %s\r\n250 end", arg)
+			} else if content, ok := s.files[arg]; ok {
+				reply("250-facts\r\n type=file;size=%d;modify=20240102030405; %s\r\n250 end", len(content), arg)
+			} else {
+				reply("550 not found")
+			}
+		case "MKD":
+			s.dirs[arg] = true
+			reply("257 created")
+		case "DELE":
+			if _, ok := s.files[arg]; !ok {
+				reply("550 not found")
+				break
+			}
+			delete(s.files, arg)
+			reply("250 deleted")
+		case "RNFR":
+			renameFrom = arg
+			reply("350 ready")
+		case "RNTO":
+			s.files[arg] = s.files[renameFrom]
+			delete(s.files, renameFrom)
+			reply("250 renamed")
+		case "QUIT":
+			reply("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			reply("502 not implemented")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestDialFTP(t *testing.T) {
+	server := newFakeFTPServer(t)
+	ctx := context.Background()
+
+	if _, err := DialFTP(ctx, server.ln.Addr().String(), FTPOptions{User: "ann", Password: "wrong"}); err == nil || err.Error() != "ftp: 530 login incorrect" {
+		t.Errorf("expected a login error, got %v", err)
+	}
+
+	conn, err := DialFTP(ctx, server.ln.Addr().String(), FTPOptions{User: "ann", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.MkdirAll("/srv/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if !server.dirs["/srv"] || !server.dirs["/srv/docs"] {
+		t.Errorf("expected the directories to be created, got %v", server.dirs)
+	}
+
+	w, err := conn.Create("/srv/docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, "hello")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := conn.Rename("/srv/docs/a.txt", "/srv/docs/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := conn.Stat("/srv/docs/b.txt")
+	if err != nil || info.Name() != "b.txt" || info.Size() != 5 || info.IsDir() || info.ModTime().Year() != 2024 {
+		t.Errorf("unexpected stat %+v, %v", info, err)
+	}
+	if _, err := conn.Stat("/srv/docs/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	entries, err := conn.ReadDir("/srv/docs")
+	if err != nil || len(entries) != 1 || entries[0].Name() != "b.txt" {
+		t.Errorf("unexpected listing %v, %v", entries, err)
+	}
+
+	r, err := conn.Open("/srv/docs/b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	if err := r.Close(); err != nil || string(b) != "hello" {
+		t.Errorf("expected hello, got %q, %v", b, err)
+	}
+
+	if _, err := conn.Open("/srv/docs/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if err := conn.Remove("/srv/docs/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.files) != 0 {
+		t.Errorf("expected the file to be removed, got %v", server.files)
+	}
+}
+
+func TestNewFTPStore(t *testing.T) {
+	server := newFakeFTPServer(t)
+	store := NewFTPStore(server.ln.Addr().String(), "/srv", FTPOptions{User: "ann", Password: "secret"})
+	defer store.Close()
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "docs/plan.txt", strings.NewReader("the plan")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, "docs/plan.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := store.Trash(ctx)
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("expected one trashed file, got %v, %v", trash, err)
+	}
+
+	if name, err := store.Restore(ctx, trash[0].ID); err != nil || name != "docs/plan.txt" {
+		t.Fatalf("expected restore of docs/plan.txt, got %q, %v", name, err)
+	}
+
+	f, err := store.Open(ctx, "docs/plan.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(b) != "the plan" {
+		t.Errorf("expected the plan, got %q", b)
+	}
+}
@@ -0,0 +1,517 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrGeoNotFound is returned by Tools.GeoLookup when no database has an entry for the address.
+var ErrGeoNotFound = errors.New("address not found in GeoIP database")
+
+// GeoInfo is the location and network information known about an IP address.
+// Fields:
+// - CountryCode: The ISO 3166-1 alpha-2 country code, e.g. "BR".
+// - Country: The English country name.
+// - City: The English city name.
+// - Region: The English name of the first subdivision, e.g. a state.
+// - PostalCode: The postal code.
+// - Latitude, Longitude: The approximate coordinates.
+// - TimeZone: The IANA time zone, e.g. "America/Sao_Paulo".
+// - ASN: The autonomous system number.
+// - ASOrganization: The organization owning the autonomous system.
+type GeoInfo struct {
+	CountryCode    string  `json:"country_code,omitempty"`
+	Country        string  `json:"country,omitempty"`
+	City           string  `json:"city,omitempty"`
+	Region         string  `json:"region,omitempty"`
+	PostalCode     string  `json:"postal_code,omitempty"`
+	Latitude       float64 `json:"latitude,omitempty"`
+	Longitude      float64 `json:"longitude,omitempty"`
+	TimeZone       string  `json:"time_zone,omitempty"`
+	ASN            uint    `json:"asn,omitempty"`
+	ASOrganization string  `json:"as_organization,omitempty"`
+}
+
+// GeoDB looks addresses up in one or more MaxMind-format (MMDB) databases, such as GeoLite2 Country, City and
+// ASN, merging their answers. Databases are reloaded when their files change if Watch is running.
+type GeoDB struct {
+	paths []string
+
+	mu      sync.RWMutex
+	readers []*mmdbReader
+	mtimes  []time.Time
+}
+
+// OpenGeoDB opens the MMDB files at paths.
+// Returns the database, or an error if a file cannot be read or is not a valid MMDB file.
+func OpenGeoDB(paths ...string) (*GeoDB, error) {
+	db := &GeoDB{paths: paths}
+	if err := db.Reload(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Reload reads every database file again. The previous databases stay in use if any file fails to load.
+func (db *GeoDB) Reload() error {
+	readers := make([]*mmdbReader, len(db.paths))
+	mtimes := make([]time.Time, len(db.paths))
+
+	for i, p := range db.paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		if readers[i], err = newMMDBReader(data); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		mtimes[i] = info.ModTime()
+	}
+
+	db.mu.Lock()
+	db.readers, db.mtimes = readers, mtimes
+	db.mu.Unlock()
+
+	return nil
+}
+
+// Watch checks the database files every interval and reloads them when one has been modified, until ctx is done.
+// Parameters:
+// - ctx: The context stopping the watch.
+// - interval: The time between checks.
+// - onError: An optional callback receiving reload errors.
+func (db *GeoDB) Watch(ctx context.Context, interval time.Duration, onError ...func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		db.mu.RLock()
+		changed := false
+		for i, p := range db.paths {
+			if info, err := os.Stat(p); err == nil && !info.ModTime().Equal(db.mtimes[i]) {
+				changed = true
+			}
+		}
+		db.mu.RUnlock()
+
+		if changed {
+			if err := db.Reload(); err != nil && len(onError) > 0 {
+				onError[0](err)
+			}
+		}
+	}
+}
+
+// Lookup returns what the databases know about addr.
+func (db *GeoDB) Lookup(addr netip.Addr) (*GeoInfo, error) {
+	db.mu.RLock()
+	readers := db.readers
+	db.mu.RUnlock()
+
+	info := &GeoInfo{}
+	found := false
+
+	for _, rd := range readers {
+		record, err := rd.lookup(addr)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil {
+			continue
+		}
+
+		found = true
+		fillGeoInfo(info, record)
+	}
+
+	if !found {
+		return nil, ErrGeoNotFound
+	}
+
+	return info, nil
+}
+
+// fillGeoInfo copies the fields of a GeoIP2/GeoLite2 record into info, keeping values already set.
+func fillGeoInfo(info *GeoInfo, record interface{}) {
+	str := func(dst *string, path ...string) {
+		if v, ok := mmdbPath(record, path...).(string); ok && *dst == "" {
+			*dst = v
+		}
+	}
+
+	str(&info.CountryCode, "country", "iso_code")
+	str(&info.Country, "country", "names", "en")
+	str(&info.City, "city", "names", "en")
+	str(&info.PostalCode, "postal", "code")
+	str(&info.TimeZone, "location", "time_zone")
+	str(&info.ASOrganization, "autonomous_system_organization")
+	str(&info.Region, "subdivisions", "0", "names", "en")
+
+	if v, ok := mmdbPath(record, "location", "latitude").(float64); ok && info.Latitude == 0 {
+		info.Latitude = v
+	}
+	if v, ok := mmdbPath(record, "location", "longitude").(float64); ok && info.Longitude == 0 {
+		info.Longitude = v
+	}
+	if v, ok := mmdbPath(record, "autonomous_system_number").(uint64); ok && info.ASN == 0 {
+		info.ASN = uint(v)
+	}
+}
+
+// mmdbPath walks decoded MMDB data by map keys, or array indexes given as a single digit.
+func mmdbPath(v interface{}, path ...string) interface{} {
+	for _, key := range path {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			if len(key) != 1 || key[0] < '0' || int(key[0]-'0') >= len(node) {
+				return nil
+			}
+			v = node[key[0]-'0']
+		default:
+			return nil
+		}
+	}
+
+	return v
+}
+
+// GeoLookup looks an IP address up in t.GeoIP.
+// Parameters:
+// - ip: The IP address, e.g. "203.0.113.7".
+// Returns the location information, ErrGeoNotFound if the databases have no entry, or an error if the address
+// is invalid or no database is configured.
+func (t *Tools) GeoLookup(ip string) (*GeoInfo, error) {
+	if t.GeoIP == nil {
+		return nil, errors.New("no GeoIP database configured")
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GeoIP.Lookup(addr.Unmap())
+}
+
+type geoContextKey struct{}
+
+// GeoMiddleware looks up the remote address of each request and stores the result in the request context, so
+// later middlewares and handlers can filter, rate limit or log by country or network with GeoFromContext.
+// The remote address is taken from r.RemoteAddr, so place the middleware after any trusted proxy handling.
+// Returns the middleware.
+func (t *Tools) GeoMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+
+			if info, err := t.GeoLookup(host); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), geoContextKey{}, info))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GeoFromContext returns the GeoInfo stored by Tools.GeoMiddleware, or nil if the address was not found.
+func GeoFromContext(ctx context.Context) *GeoInfo {
+	info, _ := ctx.Value(geoContextKey{}).(*GeoInfo)
+	return info
+}
+
+// mmdbMetadataMarker precedes the metadata section at the end of an MMDB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbReader reads the MaxMind DB format described at https://maxmind.github.io/MaxMind-DB/.
+type mmdbReader struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// newMMDBReader parses the metadata and layout of an MMDB file held in memory.
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata marker not found")
+	}
+
+	meta, _, err := (&mmdbReader{data: buf[i+len(mmdbMetadataMarker):]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MaxMind DB metadata: %w", err)
+	}
+
+	uintField := func(name string) uint {
+		v, _ := mmdbPath(meta, name).(uint64)
+		return uint(v)
+	}
+
+	rd := &mmdbReader{
+		nodeCount:  uintField("node_count"),
+		recordSize: uintField("record_size"),
+		ipVersion:  uintField("ip_version"),
+	}
+
+	if rd.recordSize != 24 && rd.recordSize != 28 && rd.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported MaxMind DB record size %d", rd.recordSize)
+	}
+
+	treeSize := rd.nodeCount * rd.recordSize / 4
+	if treeSize+16 > uint(i) {
+		return nil, errors.New("invalid MaxMind DB: search tree exceeds file")
+	}
+
+	rd.tree = buf[:treeSize]
+	rd.data = buf[treeSize+16 : i]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases; find that node once
+	if rd.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < rd.nodeCount; j++ {
+			node = rd.record(node, 0)
+		}
+		rd.ipv4Start = node
+	}
+
+	return rd, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a search tree node.
+func (rd *mmdbReader) record(node, bit uint) uint {
+	b := rd.tree[node*rd.recordSize/4:]
+
+	switch rd.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// lookup returns the decoded record for addr, or nil if the database has none.
+func (rd *mmdbReader) lookup(addr netip.Addr) (interface{}, error) {
+	var ip []byte
+	node := uint(0)
+
+	switch {
+	case addr.Is4() && rd.ipVersion == 6:
+		ip = addr.AsSlice()
+		node = rd.ipv4Start
+	case addr.Is4() || rd.ipVersion == 6:
+		ip = addr.AsSlice()
+	default:
+		// IPv6 addresses cannot be found in an IPv4-only database
+		return nil, nil
+	}
+
+	for i := 0; i < len(ip)*8 && node < rd.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-uint(i%8))) & 1
+		node = rd.record(node, bit)
+	}
+
+	if node == rd.nodeCount {
+		return nil, nil
+	}
+	if node < rd.nodeCount {
+		return nil, errors.New("invalid MaxMind DB: search tree too deep")
+	}
+
+	offset := node - rd.nodeCount - 16
+	if offset >= uint(len(rd.data)) {
+		return nil, errors.New("invalid MaxMind DB: record pointer out of range")
+	}
+
+	v, _, err := rd.decode(offset, 0)
+
+	return v, err
+}
+
+// decode decodes the data section value at offset.
+// Returns the value and the offset just past it.
+func (rd *mmdbReader) decode(offset uint, depth int) (interface{}, uint, error) {
+	if depth > 32 {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+
+	next := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(rd.data)) {
+			return nil, errors.New("unexpected end of data")
+		}
+		b := rd.data[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	b, err := next(1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 {
+		ss, vvv := uint(ctrl>>3)&3, uint(ctrl&7)
+		b, err := next(ss + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		var ptr uint
+		switch ss {
+		case 0:
+			ptr = vvv<<8 | uint(b[0])
+		case 1:
+			ptr = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			ptr = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			ptr = uint(binary.BigEndian.Uint32(b))
+		}
+
+		v, _, err := rd.decode(ptr, depth+1)
+		return v, offset, err
+	}
+
+	if typ == 0 {
+		b, err := next(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		b, err := next(n)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		extra := uint(0)
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		size = []uint{29, 285, 65821}[n-1] + extra
+	}
+
+	switch typ {
+	case 2, 4:
+		b, err := next(size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if typ == 2 {
+			return string(b), offset, nil
+		}
+		return append([]byte(nil), b...), offset, nil
+
+	case 3, 15:
+		b, err := next(size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if size == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+		}
+		if size == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+		}
+		return nil, 0, fmt.Errorf("invalid float size %d", size)
+
+	case 5, 6, 8, 9, 10:
+		b, err := next(size)
+		if err != nil {
+			return nil, 0, err
+		}
+		if size > 8 {
+			// uint128 values do not occur in GeoIP data; keep the raw bytes
+			return append([]byte(nil), b...), offset, nil
+		}
+
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		if typ == 8 {
+			return int64(int32(uint32(v))), offset, nil
+		}
+		return v, offset, nil
+
+	case 7:
+		m := make(map[string]interface{})
+		for i := uint(0); i < size; i++ {
+			key, o, err := rd.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+
+			v, o, err := rd.decode(o, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			m[k], offset = v, o
+		}
+		return m, offset, nil
+
+	case 11:
+		var a []interface{}
+		for i := uint(0); i < size; i++ {
+			v, o, err := rd.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a, offset = append(a, v), o
+		}
+		return a, offset, nil
+
+	case 14:
+		return size != 0, offset, nil
+
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
@@ -0,0 +1,260 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mmdbEncode encodes v in the MaxMind DB data format. Only the types used by the tests are supported.
+func mmdbEncode(v interface{}) []byte {
+	header := func(typ, size int) []byte {
+		var ext []byte
+		if size >= 29 {
+			ext = []byte{byte(size - 29)}
+			size = 29
+		}
+
+		out := []byte{byte(size)}
+		if typ <= 7 {
+			out[0] |= byte(typ << 5)
+		} else {
+			out = append(out, byte(typ-7))
+		}
+		return append(out, ext...)
+	}
+
+	switch v := v.(type) {
+	case string:
+		return append(header(2, len(v)), v...)
+	case float64:
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, math.Float64bits(v))
+		return append(header(3, 8), b...)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return append(header(6, 4), b...)
+	case mmdbPointer:
+		return []byte{byte(1<<5 | (v >> 8 & 7)), byte(v)}
+	case []interface{}:
+		out := header(11, len(v))
+		for _, e := range v {
+			out = append(out, mmdbEncode(e)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		out := header(7, len(v))
+		for _, k := range keys {
+			out = append(out, mmdbEncode(k)...)
+			out = append(out, mmdbEncode(v[k])...)
+		}
+		return out
+	}
+
+	panic("unsupported type")
+}
+
+type mmdbPointer int
+
+type mmdbNetwork struct {
+	prefix netip.Prefix
+	data   interface{}
+}
+
+// writeTestMMDB builds an MMDB file with 24-bit records holding the given networks.
+func writeTestMMDB(t *testing.T, ipVersion int, networks []mmdbNetwork, extra ...interface{}) string {
+	t.Helper()
+
+	const empty, data = -1, -2
+
+	type record struct{ kind, value int }
+	nodes := [][2]record{{{kind: empty}, {kind: empty}}}
+
+	var section []byte
+	for _, e := range extra {
+		section = append(section, mmdbEncode(e)...)
+	}
+
+	for _, n := range networks {
+		offset := len(section)
+		section = append(section, mmdbEncode(n.data)...)
+
+		ip := n.prefix.Addr().AsSlice()
+		bits := n.prefix.Bits()
+		if ipVersion == 6 && n.prefix.Addr().Is4() {
+			ip = netip.AddrFrom16(n.prefix.Addr().As16()).AsSlice()
+			ip[10], ip[11] = 0, 0
+			bits += 96
+		}
+
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = record{kind: data, value: offset}
+				break
+			}
+			if nodes[node][bit].kind == empty {
+				nodes = append(nodes, [2]record{{kind: empty}, {kind: empty}})
+				nodes[node][bit] = record{kind: 0, value: len(nodes) - 1}
+			}
+			node = nodes[node][bit].value
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, r := range n {
+			v := len(nodes)
+			switch r.kind {
+			case data:
+				v = len(nodes) + 16 + r.value
+			case 0:
+				v = r.value
+			}
+			buf.Write([]byte{byte(v >> 16), byte(v >> 8), byte(v)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(section)
+	buf.Write(mmdbMetadataMarker)
+	buf.Write(mmdbEncode(map[string]interface{}{
+		"node_count":    uint32(len(nodes)),
+		"record_size":   uint32(24),
+		"ip_version":    uint32(ipVersion),
+		"database_type": "Test",
+	}))
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestTools_GeoLookup(t *testing.T) {
+	brazil := map[string]interface{}{"iso_code": "BR", "names": map[string]interface{}{"en": "Brazil"}}
+
+	city := writeTestMMDB(t, 6, []mmdbNetwork{
+		{netip.MustParsePrefix("1.2.3.0/24"), map[string]interface{}{
+			"country":      mmdbPointer(0),
+			"city":         map[string]interface{}{"names": map[string]interface{}{"en": "Sao Paulo"}},
+			"subdivisions": []interface{}{map[string]interface{}{"names": map[string]interface{}{"en": "SP"}}},
+			"location":     map[string]interface{}{"latitude": -23.5, "longitude": -46.6, "time_zone": "America/Sao_Paulo"},
+		}},
+		{netip.MustParsePrefix("2001:db8::/32"), map[string]interface{}{"country": brazil}},
+	}, brazil)
+
+	asn := writeTestMMDB(t, 4, []mmdbNetwork{
+		{netip.MustParsePrefix("1.2.0.0/16"), map[string]interface{}{
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Example Net",
+		}},
+	})
+
+	db, err := OpenGeoDB(city, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{GeoIP: db}
+
+	info, err := testTools.GeoLookup("1.2.3.4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := GeoInfo{CountryCode: "BR", Country: "Brazil", City: "Sao Paulo", Region: "SP", Latitude: -23.5,
+		Longitude: -46.6, TimeZone: "America/Sao_Paulo", ASN: 64500, ASOrganization: "Example Net"}
+	if *info != expected {
+		t.Errorf("expected %+v, got %+v", expected, *info)
+	}
+
+	if info, err := testTools.GeoLookup("2001:db8::1"); err != nil || info.CountryCode != "BR" || info.ASN != 0 {
+		t.Errorf("unexpected IPv6 result %+v, %v", info, err)
+	}
+
+	if _, err := testTools.GeoLookup("9.9.9.9"); !errors.Is(err, ErrGeoNotFound) {
+		t.Errorf("expected ErrGeoNotFound, got %v", err)
+	}
+
+	if _, err := testTools.GeoLookup("not an ip"); err == nil {
+		t.Error("expected error for invalid address")
+	}
+
+	// hot reload picks up a replaced file
+	replacement := writeTestMMDB(t, 4, []mmdbNetwork{{netip.MustParsePrefix("9.9.9.0/24"), map[string]interface{}{"autonomous_system_number": uint32(1)}}})
+	data, _ := os.ReadFile(replacement)
+	if err := os.WriteFile(asn, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(asn, time.Now(), time.Now().Add(time.Minute))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go db.Watch(ctx, 10*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if info, err := testTools.GeoLookup("9.9.9.9"); err == nil && info.ASN == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected database to be reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTools_GeoMiddleware(t *testing.T) {
+	db, err := OpenGeoDB(writeTestMMDB(t, 4, []mmdbNetwork{
+		{netip.MustParsePrefix("192.0.2.0/24"), map[string]interface{}{"country": map[string]interface{}{"iso_code": "PT"}}},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{GeoIP: db}
+
+	var country string
+	handler := testTools.GeoMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info := GeoFromContext(r.Context()); info != nil {
+			country = info.CountryCode
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.10:5555"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if country != "PT" {
+		t.Errorf("expected country PT in context, got %q", country)
+	}
+}
+
+func TestGeoDB_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.mmdb")
+	_ = os.WriteFile(path, []byte("not a database"), 0o644)
+
+	if _, err := OpenGeoDB(path); err == nil {
+		t.Error("expected error for invalid database")
+	}
+}
@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// GraphQLLocation is a position in a GraphQL query.
+type GraphQLLocation struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// GraphQLError is an entry of the errors array of a GraphQL response.
+// Fields:
+// - Message: The error message.
+// - Path: The path of the response field that failed, e.g. ["user", "friends", 1, "name"].
+// - Locations: The positions in the query the error refers to.
+// - Extensions: Server-specific details, commonly including a "code".
+type GraphQLError struct {
+	Message    string                 `json:"message"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Locations  []GraphQLLocation      `json:"locations,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Error returns the message, prefixed with the path when there is one.
+func (e GraphQLError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+
+	parts := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		parts[i] = fmt.Sprint(p)
+	}
+
+	return strings.Join(parts, ".") + ": " + e.Message
+}
+
+// ErrorCode returns extensions.code, e.g. "UNAUTHENTICATED", or "" if there is none.
+func (e GraphQLError) ErrorCode() string {
+	code, _ := e.Extensions["code"].(string)
+	return code
+}
+
+// GraphQLErrors is the error returned by PushGraphQL when the response has errors.
+type GraphQLErrors []GraphQLError
+
+// Error joins the messages of the errors.
+func (errs GraphQLErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+
+	return "graphql: " + strings.Join(messages, "; ")
+}
+
+// ErrorCode returns the code of the first error that has one, so ErrorJSON includes it.
+func (errs GraphQLErrors) ErrorCode() string {
+	for _, e := range errs {
+		if code := e.ErrorCode(); code != "" {
+			return code
+		}
+	}
+
+	return ""
+}
+
+// PushGraphQL sends a GraphQL query or mutation to a specified URI and decodes the data of the response.
+// This function allows for an optional http.Client to be specified for the request; if none is provided, a default client is used.
+// Parameters:
+// - uri: The URI of the GraphQL endpoint.
+// - query: The GraphQL document.
+// - variables: The variables of the query, or nil.
+// - target: A pointer that the data member of the response is decoded into, or nil to discard it.
+// - client: An optional variadic parameter that allows specifying a custom http.Client for the request. Only the first client is used if multiple are provided.
+// Returns the HTTP response, the response status code, and an error if the request fails. When the response has an
+// errors array, the data that is present is still decoded into target and the error is GraphQLErrors.
+func (t *Tools) PushGraphQL(uri, query string, variables map[string]interface{}, target interface{}, client ...*http.Client) (*http.Response, int, error) {
+	payload, err := json.Marshal(struct {
+		Query     string                 `json:"query"`
+		Variables map[string]interface{} `json:"variables,omitempty"`
+	}{query, variables})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	httpClient := &http.Client{}
+	if len(client) > 0 {
+		httpClient = client[0]
+	}
+
+	request, err := http.NewRequest(http.MethodPost, uri, bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/graphql-response+json, application/json")
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphQLErrors   `json:"errors"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		if response.StatusCode >= http.StatusBadRequest {
+			return response, response.StatusCode, fmt.Errorf("graphql: unexpected status %d", response.StatusCode)
+		}
+		return response, response.StatusCode, fmt.Errorf("graphql: invalid response: %w", err)
+	}
+
+	if target != nil && len(body.Data) > 0 && string(body.Data) != "null" {
+		if err := json.Unmarshal(body.Data, target); err != nil {
+			return response, response.StatusCode, fmt.Errorf("graphql: cannot decode data: %w", err)
+		}
+	}
+
+	if len(body.Errors) > 0 {
+		return response, response.StatusCode, body.Errors
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return response, response.StatusCode, fmt.Errorf("graphql: unexpected status %d", response.StatusCode)
+	}
+
+	return response, response.StatusCode, nil
+}
@@ -0,0 +1,78 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+var pushGraphQLTests = []struct {
+	name      string
+	status    int
+	response  string
+	userName  string
+	errorCode string
+	errorText string
+}{
+	{name: "data", status: http.StatusOK, response: `{"data":{"user":{"name":"Ann"}}}`, userName: "Ann"},
+	{name: "partial", status: http.StatusOK, response: `{"data":{"user":{"name":"Ann"}},"errors":[{"message":"forbidden","path":["user","email"],"extensions":{"code":"FORBIDDEN"}}]}`, userName: "Ann", errorCode: "FORBIDDEN", errorText: "graphql: user.email: forbidden"},
+	{name: "no data", status: http.StatusOK, response: `{"data":null,"errors":[{"message":"syntax error","locations":[{"line":1,"column":3}]}]}`, errorText: "graphql: syntax error"},
+	{name: "http error", status: http.StatusBadGateway, response: `<html>bad gateway</html>`, errorText: "graphql: unexpected status 502"},
+}
+
+func TestTools_PushGraphQL(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range pushGraphQLTests {
+		var sent struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+
+		client := NewTestClient(func(req *http.Request) *http.Response {
+			_ = json.NewDecoder(req.Body).Decode(&sent)
+			return &http.Response{
+				StatusCode: e.status,
+				Body:       io.NopCloser(bytes.NewBufferString(e.response)),
+				Header:     make(http.Header),
+			}
+		})
+
+		var target struct {
+			User struct {
+				Name string `json:"name"`
+			} `json:"user"`
+		}
+
+		_, status, err := testTools.PushGraphQL("http://example.com/graphql", "query($id: ID!) { user(id: $id) { name } }", map[string]interface{}{"id": "1"}, &target, client)
+
+		if sent.Variables["id"] != "1" || sent.Query == "" {
+			t.Errorf("%s: unexpected request %+v", e.name, sent)
+		}
+		if status != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, status)
+		}
+		if target.User.Name != e.userName {
+			t.Errorf("%s: expected user %q, got %q", e.name, e.userName, target.User.Name)
+		}
+
+		if e.errorText == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", e.name, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != e.errorText {
+			t.Errorf("%s: expected error %q, got %v", e.name, e.errorText, err)
+		}
+
+		var gqlErrs GraphQLErrors
+		if e.errorCode != "" && (!errors.As(err, &gqlErrs) || errorCode(err) != e.errorCode) {
+			t.Errorf("%s: expected GraphQLErrors with code %s, got %v", e.name, e.errorCode, err)
+		}
+	}
+}
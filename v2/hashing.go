@@ -0,0 +1,177 @@
+package toolkit
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// ErrUnsupportedHash is returned when a HashAlgorithm is not known.
+var ErrUnsupportedHash = errors.New("unsupported hash algorithm")
+
+// HashAlgorithm names a hash computed by HashingReader and HashingWriter.
+type HashAlgorithm string
+
+// The supported hash algorithms. MD5 and SHA-1 are for checksums required by other systems, such as
+// Content-MD5 or ETags, not for security.
+const (
+	HashMD5    HashAlgorithm = "md5"
+	HashSHA1   HashAlgorithm = "sha1"
+	HashSHA256 HashAlgorithm = "sha256"
+	HashSHA512 HashAlgorithm = "sha512"
+	HashCRC32C HashAlgorithm = "crc32c"
+)
+
+// newHash returns a new hash for alg.
+func newHash(alg HashAlgorithm) (hash.Hash, error) {
+	switch alg {
+	case HashMD5:
+		return md5.New(), nil
+	case HashSHA1:
+		return sha1.New(), nil
+	case HashSHA256:
+		return sha256.New(), nil
+	case HashSHA512:
+		return sha512.New(), nil
+	case HashCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedHash, alg)
+}
+
+// hashSet computes several hashes of the same bytes at once.
+type hashSet struct {
+	hashes map[HashAlgorithm]hash.Hash
+	size   int64
+}
+
+// newHashSet creates a hashSet for algs, or for SHA-256 if none are given.
+func newHashSet(algs []HashAlgorithm) (hashSet, error) {
+	if len(algs) == 0 {
+		algs = []HashAlgorithm{HashSHA256}
+	}
+
+	hs := hashSet{hashes: make(map[HashAlgorithm]hash.Hash, len(algs))}
+	for _, alg := range algs {
+		h, err := newHash(alg)
+		if err != nil {
+			return hashSet{}, err
+		}
+		hs.hashes[alg] = h
+	}
+
+	return hs, nil
+}
+
+// write adds p to every hash.
+func (hs *hashSet) write(p []byte) {
+	for _, h := range hs.hashes {
+		_, _ = h.Write(p)
+	}
+	hs.size += int64(len(p))
+}
+
+// Sum returns the digest of the bytes so far for alg, or nil if alg is not computed.
+func (hs *hashSet) Sum(alg HashAlgorithm) []byte {
+	h, ok := hs.hashes[alg]
+	if !ok {
+		return nil
+	}
+
+	return h.Sum(nil)
+}
+
+// Hex returns the digest of the bytes so far for alg, hex-encoded, or "" if alg is not computed.
+func (hs *hashSet) Hex(alg HashAlgorithm) string {
+	sum := hs.Sum(alg)
+	if sum == nil {
+		return ""
+	}
+
+	return hex.EncodeToString(sum)
+}
+
+// Sums returns the hex-encoded digests of the bytes so far, by algorithm.
+func (hs *hashSet) Sums() map[HashAlgorithm]string {
+	sums := make(map[HashAlgorithm]string, len(hs.hashes))
+	for alg := range hs.hashes {
+		sums[alg] = hs.Hex(alg)
+	}
+
+	return sums
+}
+
+// Size returns the number of bytes hashed so far.
+func (hs *hashSet) Size() int64 {
+	return hs.size
+}
+
+// HashingReader hashes what is read through it with one or more algorithms at once, e.g. to checksum an upload
+// while it is saved, without reading it twice. Digests cover the bytes read so far, so read to io.EOF before
+// taking them.
+type HashingReader struct {
+	hashSet
+	r io.Reader
+}
+
+// NewHashingReader wraps r.
+// Parameters:
+// - r: The reader to hash.
+// - algs: The algorithms to compute. Defaults to SHA-256.
+// Returns the reader, or an error wrapping ErrUnsupportedHash for an unknown algorithm.
+func NewHashingReader(r io.Reader, algs ...HashAlgorithm) (*HashingReader, error) {
+	hs, err := newHashSet(algs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HashingReader{hashSet: hs, r: r}, nil
+}
+
+// Read reads from the wrapped reader, hashing the bytes read.
+func (hr *HashingReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.write(p[:n])
+
+	return n, err
+}
+
+// HashingWriter hashes what is written through it with one or more algorithms at once, e.g. to checksum a download
+// while it is sent. Only the bytes the wrapped writer accepted are hashed.
+type HashingWriter struct {
+	hashSet
+	w io.Writer
+}
+
+// NewHashingWriter wraps w.
+// Parameters:
+// - w: The writer to pass the bytes on to, or nil to only hash them.
+// - algs: The algorithms to compute. Defaults to SHA-256.
+// Returns the writer, or an error wrapping ErrUnsupportedHash for an unknown algorithm.
+func NewHashingWriter(w io.Writer, algs ...HashAlgorithm) (*HashingWriter, error) {
+	hs, err := newHashSet(algs)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		w = io.Discard
+	}
+
+	return &HashingWriter{hashSet: hs, w: w}, nil
+}
+
+// Write writes to the wrapped writer, hashing the bytes written.
+func (hw *HashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.write(p[:n])
+
+	return n, err
+}
@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHashingReader(t *testing.T) {
+	var tests = []struct {
+		name string
+		alg  HashAlgorithm
+		want string
+	}{
+		{"md5", HashMD5, "5d41402abc4b2a76b9719d911017c592"},
+		{"sha1", HashSHA1, "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"},
+		{"sha256", HashSHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"},
+		{"sha512", HashSHA512, "9b71d224bd62f3785d96d46ad3ea3d73319bfbc2890caadae2dff72519673ca72323c3d99ba5c11d7c7acc6e14b8c5da0c4663475c2e5c3adef46f73bcdec043"},
+		{"crc32c", HashCRC32C, "9a71bb4c"},
+	}
+
+	hr, err := NewHashingReader(strings.NewReader("hello"), HashMD5, HashSHA1, HashSHA256, HashSHA512, HashCRC32C)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(hr)
+	if string(data) != "hello" || hr.Size() != 5 {
+		t.Errorf("expected the data to pass through, got %q and size %d", data, hr.Size())
+	}
+
+	sums := hr.Sums()
+	for _, e := range tests {
+		if got := hr.Hex(e.alg); got != e.want || sums[e.alg] != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, got)
+		}
+	}
+
+	if hr.Sum("sha3") != nil || hr.Hex("sha3") != "" {
+		t.Error("expected no digest for an algorithm not computed")
+	}
+	if _, err := NewHashingReader(strings.NewReader(""), "sha3"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Errorf("expected ErrUnsupportedHash, got %v", err)
+	}
+}
+
+// shortWriter accepts at most n bytes.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		n := w.n
+		w.n = 0
+		return n, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestHashingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	hw, err := NewHashingWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(hw, strings.NewReader("hello"))
+	if buf.String() != "hello" || hw.Hex(HashSHA256) != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("expected SHA-256 by default, got %q and %v", buf.String(), hw.Sums())
+	}
+
+	// only the bytes accepted are hashed
+	hw, _ = NewHashingWriter(&shortWriter{n: 3}, HashMD5)
+	if _, err := hw.Write([]byte("hello")); !errors.Is(err, io.ErrShortWrite) || hw.Size() != 3 {
+		t.Errorf("expected a short write of 3 bytes, got %v and %d", err, hw.Size())
+	}
+
+	hw, _ = NewHashingWriter(nil, HashMD5)
+	_, _ = hw.Write([]byte("hello"))
+	if hw.Hex(HashMD5) != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("expected a nil writer to only hash, got %s", hw.Hex(HashMD5))
+	}
+}
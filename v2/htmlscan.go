@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// htmlTag is a start tag found by scanHTMLTags, with lower-cased name and attribute keys.
+type htmlTag struct {
+	Name  string
+	Attrs map[string]string
+}
+
+var (
+	htmlTagRegex     = regexp.MustCompile(`(?is)<([a-z][a-z0-9]*)\b((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	htmlAttrRegex    = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+)))?`)
+	htmlTitleRegex   = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlSpaceRegex   = regexp.MustCompile(`\s+`)
+)
+
+// scanHTMLTags returns the start tags in doc whose names are in names, or every start tag if names is empty.
+// It is a lenient scanner meant for extracting metadata and links, not a conforming HTML parser.
+func scanHTMLTags(doc string, names ...string) []htmlTag {
+	doc = htmlCommentRegex.ReplaceAllString(doc, "")
+
+	var tags []htmlTag
+	for _, m := range htmlTagRegex.FindAllStringSubmatch(doc, -1) {
+		name := strings.ToLower(m[1])
+
+		if len(names) > 0 {
+			wanted := false
+			for _, n := range names {
+				if n == name {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				continue
+			}
+		}
+
+		attrs := make(map[string]string)
+		for _, a := range htmlAttrRegex.FindAllStringSubmatch(m[2], -1) {
+			key := strings.ToLower(a[1])
+			if _, seen := attrs[key]; seen {
+				continue
+			}
+			attrs[key] = html.UnescapeString(a[2] + a[3] + a[4])
+		}
+
+		tags = append(tags, htmlTag{Name: name, Attrs: attrs})
+	}
+
+	return tags
+}
+
+// scanHTMLTitle returns the text of the first <title> element in doc, with whitespace collapsed.
+func scanHTMLTitle(doc string) string {
+	m := htmlTitleRegex.FindStringSubmatch(doc)
+	if m == nil {
+		return ""
+	}
+
+	return strings.TrimSpace(htmlSpaceRegex.ReplaceAllString(html.UnescapeString(m[1]), " "))
+}
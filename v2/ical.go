@@ -0,0 +1,1028 @@
+package toolkit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidICal is returned by ParseICal when a calendar cannot be parsed.
+var ErrInvalidICal = errors.New("invalid iCalendar data")
+
+// ErrTooManyOccurrences is returned by ExpandICal when a recurring event has more occurrences in the range than
+// allowed.
+var ErrTooManyOccurrences = errors.New("too many occurrences")
+
+// ICalEvent is an event of an iCalendar (.ics) file.
+// Fields:
+// - UID: The event's globally unique ID, e.g. "booking-42@example.com". Updates to an invite must keep it.
+// - Summary, Description, Location, URL: The event's title, details, place and link.
+// - Start, End: When the event starts and ends. Their time.Location is kept: times in UTC or time.Local are written
+// in UTC, and times in a named location, e.g. one from time.LoadLocation("Europe/Lisbon"), are written with its
+// TZID, so recurring events keep their wall clock time across daylight saving changes.
+// - AllDay: Whether the event lasts whole days. End is exclusive: a one-day event ends at midnight of the next day.
+// - Status: CONFIRMED, TENTATIVE or CANCELLED.
+// - Sequence: The revision number. Increase it when updating an invite.
+// - Organizer: The organizer's email address, e.g. "Ann <ann@example.com>".
+// - Attendees: The attendees' email addresses.
+// - RRule: The recurrence rule, e.g. "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10".
+// - ExDates: Occurrences of a recurring event that are cancelled.
+// - RecurrenceID: For a modified occurrence of a recurring event, the start of the occurrence it replaces.
+type ICalEvent struct {
+	UID          string      `json:"uid"`
+	Summary      string      `json:"summary"`
+	Description  string      `json:"description,omitempty"`
+	Location     string      `json:"location,omitempty"`
+	URL          string      `json:"url,omitempty"`
+	Start        time.Time   `json:"start"`
+	End          time.Time   `json:"end"`
+	AllDay       bool        `json:"all_day,omitempty"`
+	Status       string      `json:"status,omitempty"`
+	Sequence     int         `json:"sequence,omitempty"`
+	Organizer    string      `json:"organizer,omitempty"`
+	Attendees    []string    `json:"attendees,omitempty"`
+	RRule        string      `json:"rrule,omitempty"`
+	ExDates      []time.Time `json:"exdates,omitempty"`
+	RecurrenceID time.Time   `json:"recurrence_id,omitempty"`
+}
+
+// ICalOptions configures WriteICal.
+// Fields:
+// - Name: The calendar's display name, shown by clients that subscribe to it.
+// - Method: The iTIP method. "PUBLISH" by default; use "REQUEST" for invites sent by email and "CANCEL" to cancel them.
+// - ProdID: The product identifier. Defaults to "-//toolkit//toolkit//EN".
+// - Filename: If set and w is an http.ResponseWriter, the calendar is sent as an attachment with this name.
+type ICalOptions struct {
+	Name     string
+	Method   string
+	ProdID   string
+	Filename string
+}
+
+// WriteICal writes events as an iCalendar (.ics) file, as used by calendar subscriptions and email invites. If w is
+// an http.ResponseWriter, the Content-Type header is set.
+// Parameters:
+// - w: The writer, e.g. an http.ResponseWriter.
+// - events: The events to write.
+// - opts: Optional ICalOptions. Only the first value is used if multiple are provided.
+// Returns an error if an event has no start, or if writing fails.
+func (t *Tools) WriteICal(w io.Writer, events []ICalEvent, opts ...ICalOptions) error {
+	var o ICalOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Method == "" {
+		o.Method = "PUBLISH"
+	}
+	if o.ProdID == "" {
+		o.ProdID = "-//toolkit//toolkit//EN"
+	}
+
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "text/calendar; charset=utf-8; method="+o.Method)
+		if o.Filename != "" {
+			rw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": o.Filename}))
+		}
+	}
+
+	iw := &icalWriter{w: bufio.NewWriter(w)}
+	iw.line("BEGIN:VCALENDAR")
+	iw.line("VERSION:2.0")
+	iw.line("PRODID:" + o.ProdID)
+	iw.line("CALSCALE:GREGORIAN")
+	iw.line("METHOD:" + strings.ToUpper(o.Method))
+	if o.Name != "" {
+		iw.line("X-WR-CALNAME:" + icalEscape(o.Name))
+	}
+
+	// each named location used gets a VTIMEZONE covering the years of its events
+	type span struct{ from, to int }
+	zones := make(map[string]span)
+	var zoneOrder []*time.Location
+	for _, e := range events {
+		if e.Start.IsZero() {
+			return fmt.Errorf("ical: event %q has no start", e.UID)
+		}
+		if e.AllDay || !namedLocation(e.Start.Location()) {
+			continue
+		}
+		to := max(e.End.Year(), e.Start.Year())
+		if e.RRule != "" {
+			to = e.Start.Year() + 5
+		}
+		name := e.Start.Location().String()
+		s, ok := zones[name]
+		if !ok {
+			zoneOrder = append(zoneOrder, e.Start.Location())
+			s = span{from: e.Start.Year(), to: to}
+		}
+		zones[name] = span{from: min(s.from, e.Start.Year()), to: max(s.to, to)}
+	}
+	for _, loc := range zoneOrder {
+		s := zones[loc.String()]
+		writeVTimezone(iw, loc, s.from, s.to)
+	}
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, e := range events {
+		iw.line("BEGIN:VEVENT")
+		iw.line("UID:" + icalEscape(e.UID))
+		iw.line("DTSTAMP:" + stamp)
+		iw.line(icalTimeProperty("DTSTART", e.Start, e.AllDay))
+		end := e.End
+		if end.IsZero() && e.AllDay {
+			end = e.Start.AddDate(0, 0, 1)
+		}
+		if !end.IsZero() {
+			iw.line(icalTimeProperty("DTEND", end, e.AllDay))
+		}
+		if !e.RecurrenceID.IsZero() {
+			iw.line(icalTimeProperty("RECURRENCE-ID", e.RecurrenceID, e.AllDay))
+		}
+		iw.text("SUMMARY", e.Summary)
+		iw.text("DESCRIPTION", e.Description)
+		iw.text("LOCATION", e.Location)
+		if e.URL != "" {
+			iw.line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			iw.line("STATUS:" + strings.ToUpper(e.Status))
+		}
+		if e.Sequence > 0 {
+			iw.line("SEQUENCE:" + strconv.Itoa(e.Sequence))
+		}
+		if e.Organizer != "" {
+			iw.line(icalAddress("ORGANIZER", e.Organizer, ""))
+		}
+		for _, a := range e.Attendees {
+			params := ""
+			if strings.EqualFold(o.Method, "REQUEST") {
+				params = ";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION;RSVP=TRUE"
+			}
+			iw.line(icalAddress("ATTENDEE", a, params))
+		}
+		if e.RRule != "" {
+			iw.line("RRULE:" + strings.TrimPrefix(e.RRule, "RRULE:"))
+		}
+		for _, ex := range e.ExDates {
+			iw.line(icalTimeProperty("EXDATE", ex.In(e.Start.Location()), e.AllDay))
+		}
+		iw.line("END:VEVENT")
+	}
+
+	iw.line("END:VCALENDAR")
+	if iw.err != nil {
+		return iw.err
+	}
+
+	return iw.w.Flush()
+}
+
+// icalWriter writes content lines, folding them at 75 octets as RFC 5545 requires.
+type icalWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (iw *icalWriter) line(s string) {
+	if iw.err != nil {
+		return
+	}
+
+	for len(s) > 75 {
+		cut := 75
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, iw.err = iw.w.WriteString(s[:cut] + "\r\n"); iw.err != nil {
+			return
+		}
+		s = " " + s[cut:]
+	}
+
+	_, iw.err = iw.w.WriteString(s + "\r\n")
+}
+
+// text writes a text property if value is not empty.
+func (iw *icalWriter) text(name, value string) {
+	if value != "" {
+		iw.line(name + ":" + icalEscape(value))
+	}
+}
+
+// icalEscape escapes a TEXT value.
+func icalEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icalUnescape reverses icalEscape.
+func icalUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// namedLocation reports whether times in loc are written with a TZID rather than in UTC.
+func namedLocation(loc *time.Location) bool {
+	return loc != time.UTC && loc != time.Local && loc.String() != "UTC" && loc.String() != "Local" && loc.String() != ""
+}
+
+// icalTimeProperty formats a DATE or DATE-TIME property.
+func icalTimeProperty(name string, t time.Time, allDay bool) string {
+	switch {
+	case allDay:
+		return name + ";VALUE=DATE:" + t.Format("20060102")
+	case namedLocation(t.Location()):
+		return name + ";TZID=" + t.Location().String() + ":" + t.Format("20060102T150405")
+	default:
+		return name + ":" + t.UTC().Format("20060102T150405Z")
+	}
+}
+
+// icalAddress formats an ORGANIZER or ATTENDEE property.
+func icalAddress(name, address, params string) string {
+	if addr, err := mail.ParseAddress(address); err == nil {
+		if addr.Name != "" {
+			params = `;CN="` + strings.ReplaceAll(addr.Name, `"`, "'") + `"` + params
+		}
+		address = addr.Address
+	}
+
+	return name + params + ":mailto:" + address
+}
+
+// writeVTimezone writes a VTIMEZONE with an observance for each offset change of loc between the years, found by
+// probing the location, since time.Location does not expose its rules.
+func writeVTimezone(iw *icalWriter, loc *time.Location, fromYear, toYear int) {
+	offsetAt := func(t time.Time) (string, int, bool) {
+		t = t.In(loc)
+		name, offset := t.Zone()
+		return name, offset, t.IsDST()
+	}
+
+	iw.line("BEGIN:VTIMEZONE")
+	iw.line("TZID:" + loc.String())
+
+	observance := func(at time.Time, from, to int, name string, dst bool) {
+		kind := "STANDARD"
+		if dst {
+			kind = "DAYLIGHT"
+		}
+		iw.line("BEGIN:" + kind)
+		iw.line("DTSTART:" + at.UTC().Add(time.Duration(from)*time.Second).Format("20060102T150405"))
+		iw.line("TZOFFSETFROM:" + icalOffset(from))
+		iw.line("TZOFFSETTO:" + icalOffset(to))
+		iw.line("TZNAME:" + name)
+		iw.line("END:" + kind)
+	}
+
+	// the offset in effect at the start of the range, then each change
+	t := time.Date(fromYear, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(toYear+1, 1, 1, 0, 0, 0, 0, time.UTC)
+	name, offset, dst := offsetAt(t)
+	observance(t.Add(-time.Duration(offset)*time.Second), offset, offset, name, dst)
+
+	for t.Before(end) {
+		next := t.Add(24 * time.Hour)
+		if _, o, _ := offsetAt(next); o != offset {
+			// narrow the change down to the second
+			lo, hi := t, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, o, _ := offsetAt(mid); o == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			newName, newOffset, newDST := offsetAt(hi)
+			observance(hi, offset, newOffset, newName, newDST)
+			offset = newOffset
+		}
+		t = next
+	}
+
+	iw.line("END:VTIMEZONE")
+}
+
+// icalOffset formats a UTC offset in seconds as ±HHMM.
+func icalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// ICalParseOptions configures ParseICal.
+// Fields:
+// - Location: The location of floating times, which have neither a TZID nor a UTC marker. Defaults to UTC.
+type ICalParseOptions struct {
+	Location *time.Location
+}
+
+// icalProperty is a parsed content line.
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// ParseICal reads the events of an iCalendar (.ics) file, e.g. an invite or a calendar feed. Times with a TZID are
+// read in that IANA location; for other TZIDs, such as Windows zone names, the file's VTIMEZONE standard offset is
+// used. Recurring events are returned once, with their RRule; use ExpandICal for their occurrences.
+// Parameters:
+// - r: The calendar.
+// - opts: Optional ICalParseOptions. Only the first value is used if multiple are provided.
+// Returns the events, or an error wrapping ErrInvalidICal.
+func (t *Tools) ParseICal(r io.Reader, opts ...ICalParseOptions) ([]ICalEvent, error) {
+	var o ICalParseOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Location == nil {
+		o.Location = time.UTC
+	}
+
+	props, err := readICalProperties(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// VTIMEZONE standard offsets, for TZIDs that are not IANA names
+	zones := make(map[string]*time.Location)
+	var stack []string
+	var tzid string
+	for _, p := range props {
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+		case "END":
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case "TZID":
+			tzid = p.value
+		case "TZOFFSETTO":
+			if len(stack) > 0 && stack[len(stack)-1] == "STANDARD" {
+				if offset, ok := parseICalOffset(p.value); ok {
+					zones[tzid] = time.FixedZone(tzid, offset)
+				}
+			}
+		}
+	}
+
+	location := func(p icalProperty) *time.Location {
+		id := p.params["TZID"]
+		if id == "" {
+			return o.Location
+		}
+		if loc, err := time.LoadLocation(strings.Trim(id, "/")); err == nil {
+			return loc
+		}
+		if loc, ok := zones[id]; ok {
+			return loc
+		}
+		return o.Location
+	}
+
+	var events []ICalEvent
+	var e *ICalEvent
+	var duration string
+	depth := 0
+	for _, p := range props {
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VEVENT"):
+			e, duration, depth = &ICalEvent{}, "", 0
+			continue
+		case e == nil:
+			continue
+		case p.name == "BEGIN":
+			// nested components such as VALARM
+			depth++
+			continue
+		case p.name == "END" && depth > 0:
+			depth--
+			continue
+		case depth > 0:
+			continue
+		case p.name == "END" && strings.EqualFold(p.value, "VEVENT"):
+			if e.Start.IsZero() {
+				return nil, fmt.Errorf("%w: event %q has no DTSTART", ErrInvalidICal, e.UID)
+			}
+			if e.End.IsZero() {
+				switch {
+				case duration != "":
+					d, err := parseICalDuration(duration)
+					if err != nil {
+						return nil, err
+					}
+					e.End = e.Start.Add(d)
+				case e.AllDay:
+					e.End = e.Start.AddDate(0, 0, 1)
+				default:
+					e.End = e.Start
+				}
+			}
+			events = append(events, *e)
+			e = nil
+			continue
+		}
+
+		switch p.name {
+		case "UID":
+			e.UID = p.value
+		case "SUMMARY":
+			e.Summary = icalUnescape(p.value)
+		case "DESCRIPTION":
+			e.Description = icalUnescape(p.value)
+		case "LOCATION":
+			e.Location = icalUnescape(p.value)
+		case "URL":
+			e.URL = p.value
+		case "STATUS":
+			e.Status = strings.ToUpper(p.value)
+		case "SEQUENCE":
+			e.Sequence, _ = strconv.Atoi(p.value)
+		case "ORGANIZER":
+			e.Organizer = icalAddressValue(p)
+		case "ATTENDEE":
+			e.Attendees = append(e.Attendees, icalAddressValue(p))
+		case "RRULE":
+			e.RRule = p.value
+		case "DURATION":
+			duration = p.value
+		case "DTSTART", "DTEND", "RECURRENCE-ID", "EXDATE":
+			for _, v := range strings.Split(p.value, ",") {
+				tm, allDay, err := parseICalTime(v, p.params["VALUE"], location(p))
+				if err != nil {
+					return nil, err
+				}
+				switch p.name {
+				case "DTSTART":
+					e.Start, e.AllDay = tm, allDay
+				case "DTEND":
+					e.End = tm
+				case "RECURRENCE-ID":
+					e.RecurrenceID = tm
+				case "EXDATE":
+					e.ExDates = append(e.ExDates, tm)
+				}
+			}
+		}
+	}
+
+	if e != nil {
+		return nil, fmt.Errorf("%w: unterminated VEVENT", ErrInvalidICal)
+	}
+
+	return events, nil
+}
+
+// readICalProperties unfolds and splits the content lines of a calendar.
+func readICalProperties(r io.Reader) ([]icalProperty, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidICal, err)
+	}
+	if len(lines) == 0 || !strings.EqualFold(lines[0], "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("%w: missing BEGIN:VCALENDAR", ErrInvalidICal)
+	}
+
+	props := make([]icalProperty, 0, len(lines))
+	for _, line := range lines {
+		p, err := parseICalLine(line)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, p)
+	}
+
+	return props, nil
+}
+
+// parseICalLine splits a content line into its name, parameters and value. Colons and semicolons inside quoted
+// parameter values are not separators.
+func parseICalLine(line string) (icalProperty, error) {
+	p := icalProperty{params: make(map[string]string)}
+
+	quoted := false
+	start := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == ';' || c == ':':
+			part := line[start:i]
+			if p.name == "" {
+				p.name = strings.ToUpper(part)
+			} else if k, v, ok := strings.Cut(part, "="); ok {
+				p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+			}
+			start = i + 1
+			if c == ':' {
+				p.value = line[i+1:]
+				return p, nil
+			}
+		}
+	}
+
+	return p, fmt.Errorf("%w: malformed line %q", ErrInvalidICal, line)
+}
+
+// icalAddressValue returns the address of an ORGANIZER or ATTENDEE property, with its CN as display name.
+func icalAddressValue(p icalProperty) string {
+	addr := p.value
+	if len(addr) > 7 && strings.EqualFold(addr[:7], "mailto:") {
+		addr = addr[7:]
+	}
+	if cn := p.params["CN"]; cn != "" {
+		return (&mail.Address{Name: cn, Address: addr}).String()
+	}
+
+	return addr
+}
+
+// parseICalTime parses a DATE or DATE-TIME value.
+func parseICalTime(v, valueType string, loc *time.Location) (time.Time, bool, error) {
+	v = strings.TrimSpace(v)
+
+	if strings.EqualFold(valueType, "DATE") || len(v) == 8 {
+		t, err := time.ParseInLocation("20060102", v, loc)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%w: invalid date %q", ErrInvalidICal, v)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("%w: invalid time %q", ErrInvalidICal, v)
+		}
+		return t, false, nil
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", v, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: invalid time %q", ErrInvalidICal, v)
+	}
+
+	return t, false, nil
+}
+
+// parseICalOffset parses a ±HHMM[SS] UTC offset to seconds.
+func parseICalOffset(v string) (int, bool) {
+	if (len(v) != 5 && len(v) != 7) || (v[0] != '+' && v[0] != '-') {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(v[1:])
+	if err != nil {
+		return 0, false
+	}
+	if len(v) == 5 {
+		n *= 100
+	}
+
+	seconds := n/10000*3600 + n/100%100*60 + n%100
+	if v[0] == '-' {
+		seconds = -seconds
+	}
+
+	return seconds, true
+}
+
+// parseICalDuration parses a DURATION value such as "PT1H30M" or "P1D".
+func parseICalDuration(v string) (time.Duration, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign, s = -1, s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("%w: invalid duration %q", ErrInvalidICal, v)
+	}
+
+	units := map[byte]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+
+	var d time.Duration
+	num := ""
+	inTime := false
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == 'T':
+			inTime = true
+		case c >= '0' && c <= '9':
+			num += string(c)
+		default:
+			unit, ok := units[c]
+			if !ok || num == "" || (c == 'M' || c == 'H' || c == 'S') != inTime {
+				return 0, fmt.Errorf("%w: invalid duration %q", ErrInvalidICal, v)
+			}
+			n, _ := strconv.Atoi(num)
+			d += time.Duration(n) * unit
+			num = ""
+		}
+	}
+
+	return sign * d, nil
+}
+
+// ICalExpandOptions configures ExpandICal.
+// Fields:
+// - MaxOccurrences: The most occurrences a recurring event may have in the range. Defaults to 1000.
+type ICalExpandOptions struct {
+	MaxOccurrences int
+}
+
+// ExpandICal returns the occurrences of events that overlap a time range, sorted by start. Recurring events are
+// expanded by their RRule in their own location, so occurrences keep their wall clock time across daylight saving
+// changes; ExDates are skipped and occurrences are replaced by the events that modify them (same UID with a
+// RecurrenceID). Occurrences have RRule cleared and RecurrenceID set. FREQ=DAILY, WEEKLY, MONTHLY and YEARLY are
+// supported with INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY and BYMONTH.
+// Parameters:
+// - events: The events, e.g. from ParseICal.
+// - from, to: The range.
+// - opts: Optional ICalExpandOptions. Only the first value is used if multiple are provided.
+// Returns the occurrences, or an error if a rule is invalid or unsupported, or wrapping ErrTooManyOccurrences.
+func (t *Tools) ExpandICal(events []ICalEvent, from, to time.Time, opts ...ICalExpandOptions) ([]ICalEvent, error) {
+	var o ICalExpandOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxOccurrences <= 0 {
+		o.MaxOccurrences = 1000
+	}
+
+	overrides := make(map[string]ICalEvent)
+	for _, e := range events {
+		if !e.RecurrenceID.IsZero() {
+			overrides[e.UID+" "+e.RecurrenceID.UTC().Format(time.RFC3339)] = e
+		}
+	}
+
+	overlaps := func(e ICalEvent) bool {
+		end := e.End
+		if !end.After(e.Start) {
+			end = e.Start.Add(time.Nanosecond)
+		}
+		return e.Start.Before(to) && end.After(from)
+	}
+
+	var out []ICalEvent
+	for _, e := range events {
+		if !e.RecurrenceID.IsZero() {
+			continue
+		}
+		if e.RRule == "" {
+			if overlaps(e) {
+				out = append(out, e)
+			}
+			continue
+		}
+
+		rule, err := parseRRule(e.RRule, e.Start.Location())
+		if err != nil {
+			return nil, err
+		}
+
+		excluded := make(map[int64]bool, len(e.ExDates))
+		for _, ex := range e.ExDates {
+			excluded[ex.Unix()] = true
+		}
+
+		days := 0
+		if e.AllDay {
+			days = int(e.End.Sub(e.Start).Hours()/24 + 0.5)
+		}
+		length := e.End.Sub(e.Start)
+
+		found := 0
+		err = rule.each(e.Start, to, func(start time.Time) bool {
+			if excluded[start.Unix()] {
+				return true
+			}
+
+			occurrence := e
+			if override, ok := overrides[e.UID+" "+start.UTC().Format(time.RFC3339)]; ok {
+				occurrence = override
+			} else {
+				occurrence.Start, occurrence.End = start, start.Add(length)
+				if e.AllDay {
+					occurrence.End = start.AddDate(0, 0, days)
+				}
+				occurrence.RecurrenceID = start
+			}
+			occurrence.RRule, occurrence.ExDates = "", nil
+
+			if overlaps(occurrence) {
+				if found++; found > o.MaxOccurrences {
+					return false
+				}
+				out = append(out, occurrence)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found > o.MaxOccurrences {
+			return nil, fmt.Errorf("%w: event %q has more than %d occurrences in the range", ErrTooManyOccurrences, e.UID, o.MaxOccurrences)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+
+	return out, nil
+}
+
+// rrule is a parsed recurrence rule.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []rruleDay
+	byMonthDay []int
+	byMonth    map[time.Month]bool
+}
+
+// rruleDay is a BYDAY value such as "MO" or "-1FR".
+type rruleDay struct {
+	n       int
+	weekday time.Weekday
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// maxRRulePeriods bounds how many periods (days, weeks, months or years) are scanned for occurrences, so rules
+// matching rarely or never cannot loop for long.
+const maxRRulePeriods = 100000
+
+// parseRRule parses an RRULE value.
+func parseRRule(s string, loc *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+
+	for _, part := range strings.Split(strings.TrimPrefix(s, "RRULE:"), ";") {
+		k, v, _ := strings.Cut(part, "=")
+		invalid := fmt.Errorf("%w: invalid RRULE part %q", ErrInvalidICal, part)
+
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			r.freq = strings.ToUpper(v)
+			if r.freq != "DAILY" && r.freq != "WEEKLY" && r.freq != "MONTHLY" && r.freq != "YEARLY" {
+				return nil, fmt.Errorf("%w: unsupported frequency %s", ErrInvalidICal, v)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, invalid
+			}
+			r.interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, invalid
+			}
+			r.count = n
+		case "UNTIL":
+			t, _, err := parseICalTime(v, "", loc)
+			if err != nil {
+				return nil, invalid
+			}
+			if len(v) == 8 {
+				t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			}
+			r.until = t
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				d = strings.ToUpper(d)
+				if len(d) < 2 {
+					return nil, invalid
+				}
+				wd, ok := rruleWeekdays[d[len(d)-2:]]
+				if !ok {
+					return nil, invalid
+				}
+				n := 0
+				if len(d) > 2 {
+					var err error
+					if n, err = strconv.Atoi(d[:len(d)-2]); err != nil || n == 0 {
+						return nil, invalid
+					}
+				}
+				r.byDay = append(r.byDay, rruleDay{n: n, weekday: wd})
+			}
+		case "BYMONTHDAY":
+			for _, d := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(d)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, invalid
+				}
+				r.byMonthDay = append(r.byMonthDay, n)
+			}
+		case "BYMONTH":
+			r.byMonth = make(map[time.Month]bool)
+			for _, m := range strings.Split(v, ",") {
+				n, err := strconv.Atoi(m)
+				if err != nil || n < 1 || n > 12 {
+					return nil, invalid
+				}
+				r.byMonth[time.Month(n)] = true
+			}
+		case "WKST":
+			// weeks start on Monday
+		default:
+			return nil, fmt.Errorf("%w: unsupported RRULE part %s", ErrInvalidICal, k)
+		}
+	}
+
+	if r.freq == "" {
+		return nil, fmt.Errorf("%w: RRULE without FREQ", ErrInvalidICal)
+	}
+	if r.freq == "YEARLY" && len(r.byDay) > 0 && len(r.byMonth) == 0 {
+		return nil, fmt.Errorf("%w: unsupported RRULE: yearly BYDAY without BYMONTH", ErrInvalidICal)
+	}
+
+	return r, nil
+}
+
+// each calls fn with the start of each occurrence, from start until fn returns false, the rule ends or an
+// occurrence starts at or after end.
+func (r *rrule) each(start, end time.Time, fn func(time.Time) bool) error {
+	h, mi, s := start.Clock()
+	loc := start.Location()
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, h, mi, s, start.Nanosecond(), loc)
+	}
+
+	count := 0
+	for period := 0; period < maxRRulePeriods; period++ {
+		var candidates []time.Time
+		n := period * r.interval
+
+		switch r.freq {
+		case "DAILY":
+			d := at(start.Year(), start.Month(), start.Day()+n)
+			if r.matchesDay(d) {
+				candidates = append(candidates, d)
+			}
+		case "WEEKLY":
+			monday := start.Day() - (int(start.Weekday())+6)%7 + 7*n
+			days := r.byDay
+			if len(days) == 0 {
+				days = []rruleDay{{weekday: start.Weekday()}}
+			}
+			for _, bd := range days {
+				d := at(start.Year(), start.Month(), monday+(int(bd.weekday)+6)%7)
+				if r.byMonth == nil || r.byMonth[d.Month()] {
+					candidates = append(candidates, d)
+				}
+			}
+		case "MONTHLY":
+			first := at(start.Year(), start.Month()+time.Month(n), 1)
+			if r.byMonth == nil || r.byMonth[first.Month()] {
+				candidates = r.monthCandidates(first, start.Day())
+			}
+		case "YEARLY":
+			year := start.Year() + n
+			months := []time.Month{start.Month()}
+			if r.byMonth != nil {
+				months = months[:0]
+				for m := time.January; m <= time.December; m++ {
+					if r.byMonth[m] {
+						months = append(months, m)
+					}
+				}
+			}
+			for _, m := range months {
+				candidates = append(candidates, r.monthCandidates(at(year, m, 1), start.Day())...)
+			}
+		}
+
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+
+		for _, c := range candidates {
+			if c.Before(start) {
+				continue
+			}
+			if (!r.until.IsZero() && c.After(r.until)) || !c.Before(end) {
+				return nil
+			}
+			if count++; r.count > 0 && count > r.count {
+				return nil
+			}
+			if !fn(c) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchesDay reports whether a daily occurrence passes the BYDAY, BYMONTHDAY and BYMONTH filters.
+func (r *rrule) matchesDay(d time.Time) bool {
+	if r.byMonth != nil && !r.byMonth[d.Month()] {
+		return false
+	}
+	if len(r.byDay) > 0 && !r.hasWeekday(d.Weekday()) {
+		return false
+	}
+	if len(r.byMonthDay) > 0 {
+		last := time.Date(d.Year(), d.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		for _, md := range r.byMonthDay {
+			if md == d.Day() || (md < 0 && last+md+1 == d.Day()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// hasWeekday reports whether BYDAY includes wd.
+func (r *rrule) hasWeekday(wd time.Weekday) bool {
+	for _, bd := range r.byDay {
+		if bd.weekday == wd {
+			return true
+		}
+	}
+
+	return false
+}
+
+// monthCandidates returns the occurrences in the month of first, which is the first day of the month at the
+// occurrence time. Without BYMONTHDAY or BYDAY, the occurrence is on day, and months without that day are skipped.
+func (r *rrule) monthCandidates(first time.Time, day int) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	at := func(d int) time.Time { return first.AddDate(0, 0, d-1) }
+
+	var out []time.Time
+	switch {
+	case len(r.byMonthDay) > 0:
+		for _, md := range r.byMonthDay {
+			d := md
+			if md < 0 {
+				d = last + md + 1
+			}
+			if d < 1 || d > last {
+				continue
+			}
+			if c := at(d); len(r.byDay) == 0 || r.hasWeekday(c.Weekday()) {
+				out = append(out, c)
+			}
+		}
+	case len(r.byDay) > 0:
+		for _, bd := range r.byDay {
+			var days []int
+			for d := 1 + (int(bd.weekday)-int(first.Weekday())+7)%7; d <= last; d += 7 {
+				days = append(days, d)
+			}
+			switch {
+			case bd.n == 0:
+				for _, d := range days {
+					out = append(out, at(d))
+				}
+			case bd.n > 0 && bd.n <= len(days):
+				out = append(out, at(days[bd.n-1]))
+			case bd.n < 0 && -bd.n <= len(days):
+				out = append(out, at(days[len(days)+bd.n]))
+			}
+		}
+	case day <= last:
+		out = append(out, at(day))
+	}
+
+	return out
+}
@@ -0,0 +1,253 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_WriteICal(t *testing.T) {
+	var testTools Tools
+
+	lisbon, err := time.LoadLocation("Europe/Lisbon")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	events := []ICalEvent{
+		{
+			UID:         "class-1@app.test",
+			Summary:     "Yoga, beginners; room 2",
+			Description: strings.Repeat("Bring a mat and water. ", 10) + "\nSee you there ✔",
+			Start:       time.Date(2026, 3, 23, 18, 0, 0, 0, lisbon),
+			End:         time.Date(2026, 3, 23, 19, 0, 0, 0, lisbon),
+			Organizer:   "Studio <studio@app.test>",
+			Attendees:   []string{"Ann <ann@app.test>", "bob@app.test"},
+			RRule:       "FREQ=WEEKLY;COUNT=4",
+			ExDates:     []time.Time{time.Date(2026, 4, 6, 18, 0, 0, 0, lisbon)},
+		},
+		{UID: "holiday@app.test", Summary: "Closed", Start: time.Date(2026, 4, 25, 0, 0, 0, 0, time.UTC), AllDay: true},
+	}
+
+	rec := httptest.NewRecorder()
+	if err := testTools.WriteICal(rec, events, ICalOptions{Method: "REQUEST", Filename: "class.ics"}); err != nil {
+		t.Fatal(err)
+	}
+	out := rec.Body.String()
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/calendar") {
+		t.Errorf("expected a calendar content type, got %q", ct)
+	}
+	for _, want := range []string{
+		"METHOD:REQUEST",
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Lisbon",
+		"BEGIN:DAYLIGHT",
+		"TZOFFSETFROM:+0000\r\nTZOFFSETTO:+0100",
+		"DTSTART;TZID=Europe/Lisbon:20260323T180000",
+		"EXDATE;TZID=Europe/Lisbon:20260406T180000",
+		`SUMMARY:Yoga\, beginners\; room 2`,
+		`ORGANIZER;CN="Studio":mailto:studio@app.test`,
+		"RSVP=TRUE:mailto:bob@app.test",
+		"DTSTART;VALUE=DATE:20260425\r\nDTEND;VALUE=DATE:20260426",
+	} {
+		if !strings.Contains(strings.ReplaceAll(out, "\r\n ", ""), want) {
+			t.Errorf("expected output to contain %q", want)
+		}
+	}
+	for _, line := range strings.Split(out, "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("expected lines folded at 75 octets, got %d: %q", len(line), line)
+		}
+	}
+
+	// the written calendar parses back to the same events
+	parsed, err := testTools.ParseICal(strings.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(parsed))
+	}
+	if parsed[0].Summary != events[0].Summary || parsed[0].Description != events[0].Description {
+		t.Errorf("expected text to round-trip, got %q %q", parsed[0].Summary, parsed[0].Description)
+	}
+	if !parsed[0].Start.Equal(events[0].Start) || parsed[0].Start.Location().String() != "Europe/Lisbon" {
+		t.Errorf("expected the start in Lisbon, got %v", parsed[0].Start)
+	}
+	if parsed[0].Organizer != `"Studio" <studio@app.test>` || len(parsed[0].Attendees) != 2 || len(parsed[0].ExDates) != 1 {
+		t.Errorf("unexpected people or exdates: %+v", parsed[0])
+	}
+	if !parsed[1].AllDay || !parsed[1].End.Equal(time.Date(2026, 4, 26, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected all-day event: %+v", parsed[1])
+	}
+}
+
+// outlookICal is an invite as Outlook sends it, with a Windows time zone name.
+const outlookICal = "BEGIN:VCALENDAR\r\n" +
+	"METHOD:REQUEST\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Pacific Standard Time\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T020000\r\n" +
+	"TZOFFSETFROM:-0700\r\n" +
+	"TZOFFSETTO:-0800\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:040000008200E00074C5B7101A82E0080000000\r\n" +
+	"SUMMARY;LANGUAGE=en-US:Quarterly review\r\n" +
+	"DESCRIPTION:Agenda:\\n1. Numbers\\n2. Plans for the next quarter\\, which a\r\n" +
+	" re long\r\n" +
+	"DTSTART;TZID=Pacific Standard Time:20260115T100000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"ORGANIZER;CN=\"Lee, Kim\":mailto:kim@corp.test\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"DESCRIPTION:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestTools_ParseICal(t *testing.T) {
+	var testTools Tools
+
+	events, err := testTools.ParseICal(strings.NewReader(outlookICal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+
+	e := events[0]
+	if e.Summary != "Quarterly review" || e.Description != "Agenda:\n1. Numbers\n2. Plans for the next quarter, which are long" {
+		t.Errorf("unexpected text: %q %q", e.Summary, e.Description)
+	}
+	if want := time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC); !e.Start.Equal(want) {
+		t.Errorf("expected the VTIMEZONE offset to apply, got %v", e.Start)
+	}
+	if e.End.Sub(e.Start) != 90*time.Minute {
+		t.Errorf("expected DURATION to set the end, got %v", e.End.Sub(e.Start))
+	}
+	if e.Organizer != `"Lee, Kim" <kim@corp.test>` {
+		t.Errorf("unexpected organizer %q", e.Organizer)
+	}
+
+	var tests = []struct {
+		name  string
+		input string
+	}{
+		{"not a calendar", "hello"},
+		{"no start", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:x\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"bad time", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:2026-01-01\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"},
+		{"unterminated", "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20260101T000000Z\r\n"},
+	}
+
+	for _, e := range tests {
+		if _, err := testTools.ParseICal(strings.NewReader(e.input)); !errors.Is(err, ErrInvalidICal) {
+			t.Errorf("%s: expected ErrInvalidICal, got %v", e.name, err)
+		}
+	}
+}
+
+func TestTools_ExpandICal(t *testing.T) {
+	var testTools Tools
+
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	at := func(y int, m time.Month, d, h int) time.Time { return time.Date(y, m, d, h, 0, 0, 0, newYork) }
+	from, to := at(2026, 1, 1, 0), at(2027, 1, 1, 0)
+
+	var tests = []struct {
+		name  string
+		event ICalEvent
+		want  []time.Time
+	}{
+		{
+			"weekly across daylight saving keeps the wall clock",
+			ICalEvent{Start: at(2026, 3, 2, 9), End: at(2026, 3, 2, 10), RRule: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4"},
+			[]time.Time{at(2026, 3, 2, 9), at(2026, 3, 4, 9), at(2026, 3, 9, 9), at(2026, 3, 11, 9)},
+		},
+		{
+			"last friday of the month",
+			ICalEvent{Start: at(2026, 1, 30, 17), RRule: "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20260401T000000Z"},
+			[]time.Time{at(2026, 1, 30, 17), at(2026, 2, 27, 17), at(2026, 3, 27, 17)},
+		},
+		{
+			"day 31 skips short months",
+			ICalEvent{Start: at(2026, 1, 31, 8), RRule: "FREQ=MONTHLY;COUNT=3"},
+			[]time.Time{at(2026, 1, 31, 8), at(2026, 3, 31, 8), at(2026, 5, 31, 8)},
+		},
+		{
+			"every other day with an exdate",
+			ICalEvent{Start: at(2026, 6, 1, 7), RRule: "FREQ=DAILY;INTERVAL=2;COUNT=4", ExDates: []time.Time{at(2026, 6, 3, 7)}},
+			[]time.Time{at(2026, 6, 1, 7), at(2026, 6, 5, 7), at(2026, 6, 7, 7)},
+		},
+		{
+			"yearly in two months",
+			ICalEvent{Start: at(2025, 6, 15, 12), RRule: "FREQ=YEARLY;BYMONTH=6,12"},
+			[]time.Time{at(2026, 6, 15, 12), at(2026, 12, 15, 12)},
+		},
+		{
+			"single event in range",
+			ICalEvent{Start: at(2026, 5, 5, 5)},
+			[]time.Time{at(2026, 5, 5, 5)},
+		},
+	}
+
+	for _, e := range tests {
+		e.event.UID = e.name
+		if e.event.End.IsZero() {
+			e.event.End = e.event.Start.Add(time.Hour)
+		}
+
+		got, err := testTools.ExpandICal([]ICalEvent{e.event}, from, to)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if len(got) != len(e.want) {
+			t.Errorf("%s: expected %d occurrences, got %d", e.name, len(e.want), len(got))
+			continue
+		}
+		for i, occ := range got {
+			if !occ.Start.Equal(e.want[i]) || occ.End.Sub(occ.Start) != e.event.End.Sub(e.event.Start) || occ.RRule != "" {
+				t.Errorf("%s: expected occurrence %d at %v, got %+v", e.name, i, e.want[i], occ)
+			}
+		}
+	}
+
+	// a modified occurrence replaces the one it overrides
+	series := ICalEvent{UID: "s", Summary: "Standup", Start: at(2026, 2, 2, 9), End: at(2026, 2, 2, 10), RRule: "FREQ=DAILY;COUNT=3"}
+	moved := ICalEvent{UID: "s", Summary: "Standup (moved)", Start: at(2026, 2, 3, 11), End: at(2026, 2, 3, 12), RecurrenceID: at(2026, 2, 3, 9)}
+	got, err := testTools.ExpandICal([]ICalEvent{series, moved}, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[1].Summary != "Standup (moved)" || !got[1].Start.Equal(at(2026, 2, 3, 11)) {
+		t.Errorf("expected the moved occurrence, got %+v", got)
+	}
+
+	// unbounded rules are cut off by the limit
+	daily := ICalEvent{UID: "d", Start: at(2026, 1, 1, 9), End: at(2026, 1, 1, 10), RRule: "FREQ=DAILY"}
+	if _, err := testTools.ExpandICal([]ICalEvent{daily}, from, to, ICalExpandOptions{MaxOccurrences: 100}); !errors.Is(err, ErrTooManyOccurrences) {
+		t.Errorf("expected ErrTooManyOccurrences, got %v", err)
+	}
+
+	hourly := ICalEvent{UID: "h", Start: at(2026, 1, 1, 9), RRule: "FREQ=HOURLY"}
+	if _, err := testTools.ExpandICal([]ICalEvent{hourly}, from, to); !errors.Is(err, ErrInvalidICal) {
+		t.Errorf("expected an unsupported frequency to fail, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := testTools.WriteICal(&buf, []ICalEvent{{UID: "x"}}); err == nil {
+		t.Error("expected an event without a start to fail")
+	}
+}
@@ -0,0 +1,591 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrImportTooLarge is returned when an import has more rows or bytes than allowed.
+var ErrImportTooLarge = errors.New("import too large")
+
+// ErrImportMapping is returned when the columns of an import cannot be mapped to the target struct.
+var ErrImportMapping = errors.New("invalid import mapping")
+
+// ImportFormat is the format of an imported file.
+type ImportFormat string
+
+const (
+	ImportCSV  ImportFormat = "csv"
+	ImportXLSX ImportFormat = "xlsx"
+	ImportJSON ImportFormat = "json"
+)
+
+// ImportFormatOf returns the format of a file from its name, e.g. an upload's filename, or "" if it is not supported.
+func ImportFormatOf(filename string) ImportFormat {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".txt":
+		return ImportCSV
+	case ".xlsx":
+		return ImportXLSX
+	case ".json":
+		return ImportJSON
+	}
+
+	return ""
+}
+
+// Importer reads CSV, XLSX and JSON files into a slice of T, as when users upload a spreadsheet of contacts or
+// products. Columns are matched to T's fields by name, or by Mapping, which a UI can let users edit after showing
+// Preview. Each row is converted and validated with Validate, and the problems of every row are reported rather
+// than stopping at the first.
+// Fields:
+// - Tools: The Tools whose Validate checks each row's `validate` tags. Defaults to a zero Tools.
+// - Mapping: Column headers mapped to field names, as Go names or json, form or query tag names. Columns without an
+// entry are matched to fields by name, ignoring case, spaces and punctuation; map a column to "" or "-" to ignore
+// it.
+// - Sheet: The worksheet of XLSX files to read. Defaults to the first one.
+// - MaxRows: The most data rows accepted. Defaults to 10000.
+// - MaxBytes: The largest file accepted. Defaults to 32 MB.
+// - Check: An optional check of each converted and validated row, e.g. for duplicates. It may return
+// ValidationErrors to report problems with specific fields.
+type Importer[T any] struct {
+	Tools    *Tools
+	Mapping  map[string]string
+	Sheet    string
+	MaxRows  int
+	MaxBytes int64
+	Check    func(row *T) error
+}
+
+// ImportPreview describes a file before it is imported, for a UI where users confirm how columns map to fields.
+// Fields:
+// - Columns: The file's column headers.
+// - Sample: Up to five data rows.
+// - Mapping: The suggested mapping of columns to fields, using the fields' client-facing names.
+// - Fields: The fields rows can be mapped to.
+// - Required: The fields with a required validation rule.
+// - Unmapped: The columns no field matches.
+type ImportPreview struct {
+	Columns  []string          `json:"columns"`
+	Sample   [][]string        `json:"sample"`
+	Mapping  map[string]string `json:"mapping"`
+	Fields   []string          `json:"fields"`
+	Required []string          `json:"required,omitempty"`
+	Unmapped []string          `json:"unmapped,omitempty"`
+}
+
+// ImportRowError is a problem with one row of an import.
+// Fields:
+// - Row: The row's number as the user sees it: the spreadsheet row, counting the header, or the position in a JSON
+// array starting at 1.
+// - Column: The column of the problem, or "" for the whole row.
+// - Field: The field of the problem, or "" for the whole row.
+// - Message: What is wrong.
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportReport is the result of an import.
+// Fields:
+// - Rows: The valid rows.
+// - RowNumbers: The row number of each valid row.
+// - Errors: The problems of the invalid rows.
+// - Total, Valid, Invalid: The number of data rows, valid rows and invalid rows. Empty rows are not counted.
+// - Unmapped: The columns that were ignored.
+type ImportReport[T any] struct {
+	Rows       []T              `json:"-"`
+	RowNumbers []int            `json:"-"`
+	Errors     []ImportRowError `json:"errors"`
+	Total      int              `json:"total"`
+	Valid      int              `json:"valid"`
+	Invalid    int              `json:"invalid"`
+	Unmapped   []string         `json:"unmapped,omitempty"`
+}
+
+// importField is a field rows can be mapped to.
+type importField struct {
+	index    int
+	name     string
+	goName   string
+	required bool
+}
+
+// fields returns the fields of T.
+func (im *Importer[T]) fields() ([]importField, error) {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %s is not a struct", ErrImportMapping, rt)
+	}
+
+	var fields []importField
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() || sf.Anonymous {
+			continue
+		}
+		required := false
+		for _, rule := range strings.Split(sf.Tag.Get("validate"), ",") {
+			required = required || strings.TrimSpace(rule) == "required"
+		}
+		fields = append(fields, importField{index: i, name: fieldName(sf), goName: sf.Name, required: required})
+	}
+
+	return fields, nil
+}
+
+// normalizeImportName lower-cases a name and removes everything but letters and digits, so "E-mail Address",
+// "email_address" and "EmailAddress" match.
+func normalizeImportName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
+
+// mapColumns returns the field of each column, or nil for ignored columns, and the ignored columns' headers.
+func (im *Importer[T]) mapColumns(columns []string, fields []importField) ([]*importField, []string, error) {
+	byName := make(map[string]*importField)
+	for i := range fields {
+		f := &fields[i]
+		byName[normalizeImportName(f.goName)] = f
+		byName[normalizeImportName(f.name)] = f
+	}
+
+	mapped := make([]*importField, len(columns))
+	taken := make(map[*importField]string)
+
+	// explicit mappings first, so a column matching a field by name does not take it from the one mapped to it
+	for i, col := range columns {
+		target, ok := im.Mapping[col]
+		if !ok || target == "" || target == "-" {
+			continue
+		}
+		f, ok := byName[normalizeImportName(target)]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: column %q is mapped to unknown field %q", ErrImportMapping, col, target)
+		}
+		if other, dup := taken[f]; dup {
+			return nil, nil, fmt.Errorf("%w: columns %q and %q both map to %s", ErrImportMapping, other, col, f.name)
+		}
+		taken[f] = col
+		mapped[i] = f
+	}
+
+	var unmapped []string
+	for i, col := range columns {
+		if mapped[i] != nil || col == "" {
+			continue
+		}
+		if _, explicit := im.Mapping[col]; !explicit {
+			if f, ok := byName[normalizeImportName(col)]; ok && taken[f] == "" {
+				taken[f] = col
+				mapped[i] = f
+				continue
+			}
+		}
+		unmapped = append(unmapped, col)
+	}
+
+	return mapped, unmapped, nil
+}
+
+// Preview reads the header and first rows of a file and suggests how its columns map to T's fields.
+// Parameters:
+// - r: The file.
+// - format: The file's format, e.g. from ImportFormatOf.
+// Returns the preview, or an error if the file cannot be read.
+func (im *Importer[T]) Preview(r io.Reader, format ImportFormat) (*ImportPreview, error) {
+	fields, err := im.fields()
+	if err != nil {
+		return nil, err
+	}
+
+	columns, rows, _, err := im.read(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped, unmapped, err := im.mapColumns(columns, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ImportPreview{Columns: columns, Mapping: make(map[string]string), Unmapped: unmapped}
+	for i, f := range mapped {
+		if f != nil {
+			preview.Mapping[columns[i]] = f.name
+		}
+	}
+	for _, f := range fields {
+		preview.Fields = append(preview.Fields, f.name)
+		if f.required {
+			preview.Required = append(preview.Required, f.name)
+		}
+	}
+	for _, row := range rows {
+		if len(preview.Sample) == 5 {
+			break
+		}
+		preview.Sample = append(preview.Sample, row)
+	}
+
+	return preview, nil
+}
+
+// Import reads a file into T values. Every row is converted and validated, and rows with problems are left out of
+// the report's Rows and described in its Errors, so users can fix the file and upload it again.
+// Parameters:
+// - r: The file.
+// - format: The file's format, e.g. from ImportFormatOf.
+// Returns the report, or an error if the file cannot be read, has too many rows, or a required field has no column
+// (wrapping ErrImportMapping).
+func (im *Importer[T]) Import(r io.Reader, format ImportFormat) (*ImportReport[T], error) {
+	fields, err := im.fields()
+	if err != nil {
+		return nil, err
+	}
+
+	columns, rows, numbers, err := im.read(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped, unmapped, err := im.mapColumns(columns, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	columnOf := make(map[string]string)
+	for i, f := range mapped {
+		if f != nil {
+			columnOf[f.name] = columns[i]
+		}
+	}
+	var missing []string
+	for _, f := range fields {
+		if _, ok := columnOf[f.name]; f.required && !ok {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: no column for required fields %s", ErrImportMapping, strings.Join(missing, ", "))
+	}
+
+	tools := im.Tools
+	if tools == nil {
+		tools = &Tools{}
+	}
+
+	report := &ImportReport[T]{Unmapped: unmapped, Errors: []ImportRowError{}}
+	for i, row := range rows {
+		if isEmptyImportRow(row) {
+			continue
+		}
+		report.Total++
+
+		var v T
+		rv := reflect.ValueOf(&v).Elem()
+		var rowErrors []ImportRowError
+
+		for col, f := range mapped {
+			if f == nil || col >= len(row) {
+				continue
+			}
+			if err := setImportValue(rv.Field(f.index), strings.TrimSpace(row[col])); err != nil {
+				rowErrors = append(rowErrors, ImportRowError{Row: numbers[i], Column: columns[col], Field: f.name, Message: err.Error()})
+			}
+		}
+
+		// validation problems of fields that failed to convert would only repeat them
+		if len(rowErrors) == 0 {
+			err := tools.Validate(&v)
+			if err == nil && im.Check != nil {
+				err = im.Check(&v)
+			}
+
+			var verrs ValidationErrors
+			switch {
+			case errors.As(err, &verrs):
+				for _, fe := range verrs {
+					rowErrors = append(rowErrors, ImportRowError{Row: numbers[i], Column: columnOf[fe.Field], Field: fe.Field, Message: fe.Message})
+				}
+			case err != nil:
+				rowErrors = append(rowErrors, ImportRowError{Row: numbers[i], Message: err.Error()})
+			}
+		}
+
+		if len(rowErrors) > 0 {
+			report.Invalid++
+			report.Errors = append(report.Errors, rowErrors...)
+			continue
+		}
+
+		report.Valid++
+		report.Rows = append(report.Rows, v)
+		report.RowNumbers = append(report.RowNumbers, numbers[i])
+	}
+
+	return report, nil
+}
+
+// read returns the header and data rows of a file, with each data row's number.
+func (im *Importer[T]) read(r io.Reader, format ImportFormat) ([]string, [][]string, []int, error) {
+	maxBytes := im.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = 32 << 20
+	}
+	maxRows := im.MaxRows
+	if maxRows <= 0 {
+		maxRows = 10000
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, nil, nil, fmt.Errorf("%w: more than %d bytes", ErrImportTooLarge, maxBytes)
+	}
+
+	var rows [][]string
+	var numbers []int
+	switch format {
+	case ImportCSV:
+		rows, numbers, err = readImportCSV(data)
+	case ImportXLSX:
+		rows, numbers, err = readXLSXRows(data, im.Sheet)
+	case ImportJSON:
+		rows, numbers, err = readImportJSON(data)
+	default:
+		return nil, nil, nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// the first non-empty row is the header
+	for len(rows) > 0 && isEmptyImportRow(rows[0]) {
+		rows, numbers = rows[1:], numbers[1:]
+	}
+	if len(rows) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: the file has no header row", ErrImportMapping)
+	}
+
+	columns := make([]string, len(rows[0]))
+	for i, c := range rows[0] {
+		columns[i] = strings.TrimSpace(c)
+	}
+	rows, numbers = rows[1:], numbers[1:]
+
+	if len(rows) > maxRows {
+		return nil, nil, nil, fmt.Errorf("%w: more than %d rows", ErrImportTooLarge, maxRows)
+	}
+
+	return columns, rows, numbers, nil
+}
+
+// readImportCSV reads CSV data, detecting whether fields are separated by commas, semicolons or tabs.
+func readImportCSV(data []byte) ([][]string, []int, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	comma := ','
+	best := bytes.Count(firstLine, []byte(","))
+	for _, sep := range []rune{';', '\t'} {
+		if n := bytes.Count(firstLine, []byte(string(sep))); n > best {
+			comma, best = sep, n
+		}
+	}
+
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.Comma = comma
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	var rows [][]string
+	var numbers []int
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		rows = append(rows, record)
+		numbers = append(numbers, line)
+	}
+
+	return rows, numbers, nil
+}
+
+// readImportJSON reads a JSON array of objects. The header is the objects' keys in the order they first appear.
+func readImportJSON(data []byte) ([][]string, []int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, nil, errors.New("json import must be an array of objects")
+	}
+
+	var header []string
+	index := make(map[string]int)
+	var records []map[int]string
+	for dec.More() {
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			return nil, nil, fmt.Errorf("json import: element %d is not an object", len(records)+1)
+		}
+
+		record := make(map[int]string)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			key, _ := tok.(string)
+
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return nil, nil, err
+			}
+
+			col, ok := index[key]
+			if !ok {
+				col = len(header)
+				index[key] = col
+				header = append(header, key)
+			}
+
+			// strings are unquoted, null is blank, and numbers, booleans and nested values are kept as JSON
+			var value interface{}
+			_ = json.Unmarshal(raw, &value)
+			switch v := value.(type) {
+			case nil:
+			case string:
+				record[col] = v
+			default:
+				record[col] = string(raw)
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
+	}
+
+	rows := [][]string{header}
+	numbers := []int{0}
+	for i, record := range records {
+		row := make([]string, len(header))
+		for col, v := range record {
+			row[col] = v
+		}
+		rows = append(rows, row)
+		numbers = append(numbers, i+1)
+	}
+
+	return rows, numbers, nil
+}
+
+// isEmptyImportRow reports whether every cell of a row is blank.
+func isEmptyImportRow(row []string) bool {
+	for _, c := range row {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// importTimeLayouts are the time formats accepted for time.Time fields.
+var importTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// setImportValue converts a cell to a field's type. Blank cells leave the field's zero value, so a required rule
+// reports them.
+func setImportValue(fv reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	if fv.Kind() == reflect.Pointer {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setImportValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+
+	if _, ok := fv.Interface().(time.Time); ok {
+		for _, layout := range importTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				fv.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("must be a date, e.g. 2006-01-02")
+	}
+
+	if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("is not valid: %v", err)
+		}
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(s) {
+		case "yes", "y", "x", "on":
+			s = "true"
+		case "no", "n", "off":
+			s = "false"
+		}
+		if _, err := strconv.ParseBool(s); err != nil {
+			return errors.New("must be true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// spreadsheets store whole numbers as floats
+		s = strings.TrimSuffix(s, ".0")
+		if err := setValue(fv, s); err != nil {
+			return errors.New("must be a whole number")
+		}
+		return nil
+	case reflect.Float32, reflect.Float64:
+		if err := setValue(fv, s); err != nil {
+			return errors.New("must be a number")
+		}
+		return nil
+	}
+
+	if err := setValue(fv, s); err != nil {
+		return fmt.Errorf("cannot be imported: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,221 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type importContact struct {
+	Name       string    `json:"name" validate:"required"`
+	Email      string    `json:"email" validate:"required,email"`
+	Age        int       `json:"age" validate:"min=0"`
+	Subscribed bool      `json:"subscribed"`
+	Joined     time.Time `json:"joined"`
+	Score      *float64  `json:"score"`
+}
+
+func TestImporter_ImportCSV(t *testing.T) {
+	csvData := "\xef\xbb\xbfFull Name;E-mail;Age;Subscribed;Joined;Notes\n" +
+		"Ann Smith;ann@example.com;34;yes;2024-03-01;vip\n" +
+		"Bob;not-an-email;41;no;;\n" +
+		";;;;;\n" +
+		"Carl;carl@example.com;abc;maybe;yesterday;\n" +
+		"\"Dee; Jr\";dee@example.com;-1;;2024-03-01 10:30;\n"
+
+	im := &Importer[importContact]{Mapping: map[string]string{"Full Name": "name"}}
+	report, err := im.Import(strings.NewReader(csvData), ImportCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Total != 4 || report.Valid != 1 || report.Invalid != 3 {
+		t.Errorf("expected 4 rows with 1 valid, got %+v", report)
+	}
+	if len(report.Rows) != 1 || report.Rows[0].Name != "Ann Smith" || report.Rows[0].Age != 34 || !report.Rows[0].Subscribed {
+		t.Errorf("unexpected valid rows: %+v", report.Rows)
+	}
+	if !report.Rows[0].Joined.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || report.RowNumbers[0] != 2 {
+		t.Errorf("unexpected date or row number: %+v %v", report.Rows[0].Joined, report.RowNumbers)
+	}
+	if len(report.Unmapped) != 1 || report.Unmapped[0] != "Notes" {
+		t.Errorf("expected Notes to be unmapped, got %v", report.Unmapped)
+	}
+
+	var tests = []struct {
+		row    int
+		column string
+	}{
+		{3, "E-mail"},
+		{5, "Age"},
+		{5, "Subscribed"},
+		{5, "Joined"},
+		{6, "Age"},
+	}
+
+	for _, e := range tests {
+		found := false
+		for _, re := range report.Errors {
+			if re.Row == e.row && re.Column == e.column && re.Message != "" {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected an error in row %d, column %s, got %+v", e.row, e.column, report.Errors)
+		}
+	}
+}
+
+func TestImporter_ImportJSON(t *testing.T) {
+	data := `[
+		{"name": "Ann", "email": "ann@example.com", "age": 34, "score": 9.5, "extra": {"a": 1}},
+		{"email": "bob@example.com", "age": null, "subscribed": true}
+	]`
+
+	im := &Importer[importContact]{}
+	report, err := im.Import(strings.NewReader(data), ImportJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Valid != 1 || report.Rows[0].Score == nil || *report.Rows[0].Score != 9.5 {
+		t.Errorf("unexpected rows: %+v", report.Rows)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Row != 2 || report.Errors[0].Field != "name" {
+		t.Errorf("expected a missing name in record 2, got %+v", report.Errors)
+	}
+
+	if _, err := im.Import(strings.NewReader(`{"name": "x"}`), ImportJSON); err == nil {
+		t.Error("expected an object to be rejected")
+	}
+}
+
+func TestImporter_ImportXLSX(t *testing.T) {
+	var testTools Tools
+
+	// a workbook written by WriteXLSX, with inline strings and date cells
+	var buf bytes.Buffer
+	err := testTools.WriteXLSX(&buf, []XLSXSheet{{
+		Headers: []string{"Name", "Email", "Age", "Joined"},
+		Rows: [][]interface{}{
+			{"Ann", "ann@example.com", 34, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+			{"Bob", "bob@example.com", 41.0, time.Date(2024, 3, 2, 8, 15, 0, 0, time.UTC)},
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	im := &Importer[importContact]{}
+	report, err := im.Import(&buf, ImportXLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 2 || report.Rows[1].Age != 41 || !report.Rows[1].Joined.Equal(time.Date(2024, 3, 2, 8, 15, 0, 0, time.UTC)) {
+		t.Errorf("unexpected rows: %+v %+v", report.Rows, report.Errors)
+	}
+
+	// a workbook as Excel writes it, with shared strings and a sparse row
+	sharedXLSX := func() []byte {
+		var b bytes.Buffer
+		zw := zip.NewWriter(&b)
+		files := map[string]string{
+			"xl/workbook.xml":            `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Data" sheetId="1" r:id="rId1"/></sheets></workbook>`,
+			"xl/_rels/workbook.xml.rels": `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`,
+			"xl/sharedStrings.xml":       `<sst><si><t>name</t></si><si><t>email</t></si><si><r><t>Ca</t></r><r><t>rl</t></r></si><si><t>carl@example.com</t></si></sst>`,
+			"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+				`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>` +
+				`<row r="4"><c r="A4" t="s"><v>2</v></c><c r="B4" t="s"><v>3</v></c></row>` +
+				`</sheetData></worksheet>`,
+		}
+		for name, body := range files {
+			w, _ := zw.Create(name)
+			_, _ = w.Write([]byte(body))
+		}
+		_ = zw.Close()
+		return b.Bytes()
+	}()
+
+	report, err = (&Importer[importContact]{Sheet: "data"}).Import(bytes.NewReader(sharedXLSX), ImportXLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 1 || report.Rows[0].Name != "Carl" || report.RowNumbers[0] != 4 {
+		t.Errorf("unexpected rows: %+v %v", report.Rows, report.RowNumbers)
+	}
+
+	if _, err := (&Importer[importContact]{Sheet: "missing"}).Import(bytes.NewReader(sharedXLSX), ImportXLSX); err == nil {
+		t.Error("expected a missing sheet to fail")
+	}
+}
+
+func TestImporter_Preview(t *testing.T) {
+	csvData := "Name,Mail,Customer Since,Comments\nAnn,ann@example.com,2024-01-01,hi\n"
+
+	im := &Importer[importContact]{}
+	preview, err := im.Preview(strings.NewReader(csvData), ImportCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Mapping["Name"] != "name" || len(preview.Unmapped) != 3 || len(preview.Sample) != 1 {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+	if strings.Join(preview.Required, ",") != "name,email" {
+		t.Errorf("expected the required fields, got %v", preview.Required)
+	}
+
+	// without a column for a required field the import is refused
+	if _, err := im.Import(strings.NewReader(csvData), ImportCSV); !errors.Is(err, ErrImportMapping) {
+		t.Errorf("expected ErrImportMapping, got %v", err)
+	}
+
+	// the user's mapping fills the gaps
+	im.Mapping = map[string]string{"Mail": "email", "Customer Since": "Joined", "Comments": "-"}
+	report, err := im.Import(strings.NewReader(csvData), ImportCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 1 || report.Rows[0].Joined.IsZero() || len(report.Unmapped) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	im.Mapping = map[string]string{"Mail": "phone"}
+	if _, err := im.Import(strings.NewReader(csvData), ImportCSV); !errors.Is(err, ErrImportMapping) {
+		t.Errorf("expected an unknown field to fail, got %v", err)
+	}
+}
+
+func TestImporter_Limits(t *testing.T) {
+	csvData := "name,email\n" + strings.Repeat("Ann,ann@example.com\n", 5)
+
+	im := &Importer[importContact]{MaxRows: 4}
+	if _, err := im.Import(strings.NewReader(csvData), ImportCSV); !errors.Is(err, ErrImportTooLarge) {
+		t.Errorf("expected ErrImportTooLarge for rows, got %v", err)
+	}
+
+	im = &Importer[importContact]{MaxBytes: 10}
+	if _, err := im.Import(strings.NewReader(csvData), ImportCSV); !errors.Is(err, ErrImportTooLarge) {
+		t.Errorf("expected ErrImportTooLarge for bytes, got %v", err)
+	}
+
+	// Check reports duplicates as field errors
+	seen := make(map[string]bool)
+	im = &Importer[importContact]{Check: func(c *importContact) error {
+		if seen[c.Email] {
+			return ValidationErrors{{Field: "email", Rule: "unique", Message: "email is a duplicate"}}
+		}
+		seen[c.Email] = true
+		return nil
+	}}
+	report, err := im.Import(strings.NewReader(csvData), ImportCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid != 1 || report.Invalid != 4 || report.Errors[0].Column != "email" || report.Errors[0].Row != 3 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
@@ -0,0 +1,526 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidEmail is returned when an inbound email cannot be parsed.
+var ErrInvalidEmail = errors.New("invalid email")
+
+// InboundEmail is an email received through an inbound webhook or as a raw message.
+// Fields:
+// - MessageID: The Message-ID header, without angle brackets.
+// - From: The sender's address, with its display name if any.
+// - To, Cc: The recipients' addresses.
+// - ReplyTo: The Reply-To address, if any.
+// - Subject: The decoded subject.
+// - Date: The Date header, or the zero time.
+// - Headers: The top-level headers, when the provider sends them.
+// - Text: The plain text body.
+// - HTML: The HTML body.
+// - Attachments: The attached files, including inline images.
+type InboundEmail struct {
+	MessageID   string               `json:"message_id,omitempty"`
+	From        string               `json:"from"`
+	To          []string             `json:"to,omitempty"`
+	Cc          []string             `json:"cc,omitempty"`
+	ReplyTo     string               `json:"reply_to,omitempty"`
+	Subject     string               `json:"subject"`
+	Date        time.Time            `json:"date,omitempty"`
+	Headers     textproto.MIMEHeader `json:"-"`
+	Text        string               `json:"text,omitempty"`
+	HTML        string               `json:"html,omitempty"`
+	Attachments []*EmailAttachment   `json:"attachments,omitempty"`
+}
+
+// EmailAttachment is a file attached to an InboundEmail.
+// Fields:
+// - Filename: The file name given by the sender, decoded. It may be empty and must not be trusted as a path.
+// - ContentType: The declared media type, e.g. "application/pdf".
+// - ContentID: The Content-ID without angle brackets, which HTML bodies reference as "cid:..." for inline images.
+// - Inline: Whether the file is shown in the body rather than offered as a download.
+// - Content: The decoded contents.
+// - File: The stored file, set by SaveEmailAttachments.
+type EmailAttachment struct {
+	Filename    string        `json:"filename"`
+	ContentType string        `json:"content_type"`
+	ContentID   string        `json:"content_id,omitempty"`
+	Inline      bool          `json:"inline,omitempty"`
+	Content     []byte        `json:"-"`
+	File        *UploadedFile `json:"file,omitempty"`
+}
+
+// maxEmailDepth limits how deeply multipart messages may nest.
+const maxEmailDepth = 10
+
+// ParseInboundEmail reads an email posted by an inbound email webhook. It accepts:
+//
+//   - Mailgun's parsed (body-plain, body-html, attachment-N) and raw (body-mime) forms
+//   - SendGrid's Inbound Parse, parsed (text, html, attachmentN) or raw (email)
+//   - Amazon SES notifications delivered by SNS with the message content included
+//   - a raw message posted with Content-Type message/rfc822
+//
+// Providers sign their webhooks, so verify the signature, or protect the endpoint with a secret URL, before
+// trusting the email. The body is limited to MaxFileSize, 1 GB by default.
+// Parameters:
+// - r: The webhook request.
+// Returns the email, or an error wrapping ErrInvalidEmail if the request is not an email.
+func (t *Tools) ParseInboundEmail(r *http.Request) (*InboundEmail, error) {
+	maxSize := int64(t.MaxFileSize)
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024 * 1024
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxSize); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+		}
+		return t.parseEmailForm(r.MultipartForm)
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(nil, r.Body, maxSize)
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+		}
+		return t.parseEmailForm(&multipart.Form{Value: r.PostForm})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return nil, fmt.Errorf("%w: message too big", ErrInvalidEmail)
+	}
+
+	if mediaType == "application/json" || (mediaType == "text/plain" && bytes.HasPrefix(bytes.TrimSpace(body), []byte("{"))) {
+		return t.parseSESNotification(body)
+	}
+
+	return t.ParseRawEmail(body)
+}
+
+// parseEmailForm reads the form fields of Mailgun and SendGrid inbound webhooks.
+func (t *Tools) parseEmailForm(form *multipart.Form) (*InboundEmail, error) {
+	value := func(names ...string) string {
+		for _, name := range names {
+			if v := form.Value[name]; len(v) > 0 && v[0] != "" {
+				return v[0]
+			}
+		}
+		return ""
+	}
+
+	// raw messages
+	if raw := value("body-mime", "email"); raw != "" {
+		return t.ParseRawEmail([]byte(raw))
+	}
+
+	email := &InboundEmail{
+		MessageID: strings.Trim(value("Message-Id", "message-id"), "<>"),
+		From:      value("from", "From", "sender"),
+		Subject:   value("subject", "Subject"),
+		Text:      value("body-plain", "text"),
+		HTML:      value("body-html", "html"),
+		To:        splitAddresses(value("To", "to", "recipient")),
+		Cc:        splitAddresses(value("Cc", "cc")),
+	}
+
+	if raw := value("headers"); raw != "" {
+		if h, err := textproto.NewReader(bufio.NewReader(strings.NewReader(raw + "\r\n\r\n"))).ReadMIMEHeader(); err == nil {
+			email.Headers = h
+		}
+	} else if raw := value("message-headers"); raw != "" {
+		var pairs [][2]string
+		if json.Unmarshal([]byte(raw), &pairs) == nil {
+			email.Headers = make(textproto.MIMEHeader)
+			for _, p := range pairs {
+				email.Headers.Add(p[0], p[1])
+			}
+		}
+	}
+	if email.Headers != nil {
+		if email.MessageID == "" {
+			email.MessageID = strings.Trim(email.Headers.Get("Message-Id"), "<>")
+		}
+		email.ReplyTo = email.Headers.Get("Reply-To")
+		email.Date, _ = mail.ParseDate(email.Headers.Get("Date"))
+	}
+
+	// content IDs of inline attachments: SendGrid sends attachment-info, Mailgun content-id-map
+	contentIDs := make(map[string]string)
+	var info map[string]struct {
+		ContentID string `json:"content-id"`
+	}
+	if json.Unmarshal([]byte(value("attachment-info")), &info) == nil {
+		for field, a := range info {
+			contentIDs[field] = a.ContentID
+		}
+	}
+	var cidMap map[string]string
+	if json.Unmarshal([]byte(value("content-id-map")), &cidMap) == nil {
+		for cid, field := range cidMap {
+			contentIDs[field] = strings.Trim(cid, "<>")
+		}
+	}
+
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		for _, hdr := range form.File[field] {
+			content, err := readFileHeader(hdr)
+			if err != nil {
+				return nil, err
+			}
+
+			email.Attachments = append(email.Attachments, &EmailAttachment{
+				Filename:    hdr.Filename,
+				ContentType: hdr.Header.Get("Content-Type"),
+				ContentID:   contentIDs[field],
+				Inline:      contentIDs[field] != "",
+				Content:     content,
+			})
+		}
+	}
+
+	return email, nil
+}
+
+// parseSESNotification reads an Amazon SES receipt notification, delivered by SNS or posted directly, whose
+// content field holds the raw message.
+func (t *Tools) parseSESNotification(body []byte) (*InboundEmail, error) {
+	var envelope struct {
+		Type    string `json:"Type"`
+		Message string `json:"Message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+	if envelope.Type == "SubscriptionConfirmation" {
+		return nil, fmt.Errorf("%w: SNS subscription confirmation, visit its SubscribeURL to confirm", ErrInvalidEmail)
+	}
+
+	notification := body
+	if envelope.Message != "" {
+		notification = []byte(envelope.Message)
+	}
+
+	var ses struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(notification, &ses); err != nil || ses.Content == "" {
+		return nil, fmt.Errorf("%w: SES notification without content; set the SNS action's encoding and include the message", ErrInvalidEmail)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(ses.Content)
+	if err != nil {
+		// UTF-8 encoded content is the message itself
+		raw = []byte(ses.Content)
+	}
+
+	return t.ParseRawEmail(raw)
+}
+
+// ParseRawEmail parses a raw RFC 5322 message, e.g. one fetched from S3 after SES stored it. Bodies and attachments
+// are decoded from base64 and quoted-printable, and ISO-8859-1 text is converted to UTF-8. The first plain text and
+// HTML parts are the bodies; every other part, and any part with a file name, is an attachment.
+// Parameters:
+// - raw: The message.
+// Returns the email, or an error wrapping ErrInvalidEmail.
+func (t *Tools) ParseRawEmail(raw []byte) (*InboundEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+
+	dec := new(mime.WordDecoder)
+	decode := func(s string) string {
+		if d, err := dec.DecodeHeader(s); err == nil {
+			return d
+		}
+		return s
+	}
+
+	header := textproto.MIMEHeader(msg.Header)
+	email := &InboundEmail{
+		MessageID: strings.Trim(header.Get("Message-Id"), "<> "),
+		From:      decode(header.Get("From")),
+		ReplyTo:   decode(header.Get("Reply-To")),
+		Subject:   decode(header.Get("Subject")),
+		To:        splitAddresses(header.Get("To")),
+		Cc:        splitAddresses(header.Get("Cc")),
+		Headers:   header,
+	}
+	email.Date, _ = msg.Header.Date()
+	if from, err := mail.ParseAddress(header.Get("From")); err == nil {
+		email.From = from.String()
+	}
+
+	if err := email.addPart(header, msg.Body, 0); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEmail, err)
+	}
+
+	return email, nil
+}
+
+// addPart adds a MIME part to the email, recursing into multipart parts.
+func (e *InboundEmail) addPart(header textproto.MIMEHeader, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxEmailDepth {
+			return errors.New("multipart nesting too deep")
+		}
+
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := e.addPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return err
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if d, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = d
+	}
+
+	if disposition != "attachment" && filename == "" {
+		switch {
+		case mediaType == "text/plain" && e.Text == "":
+			e.Text = decodeCharset(content, params["charset"])
+			return nil
+		case mediaType == "text/html" && e.HTML == "":
+			e.HTML = decodeCharset(content, params["charset"])
+			return nil
+		}
+	}
+
+	if mediaType == "message/rfc822" && filename == "" {
+		filename = "message.eml"
+	}
+
+	contentID := strings.Trim(header.Get("Content-Id"), "<> ")
+	e.Attachments = append(e.Attachments, &EmailAttachment{
+		Filename:    filename,
+		ContentType: mediaType,
+		ContentID:   contentID,
+		Inline:      disposition == "inline" || disposition == "" && contentID != "",
+		Content:     content,
+	})
+
+	return nil
+}
+
+// decodeTransferEncoding decodes a part's body.
+func decodeTransferEncoding(encoding string, body io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		// line breaks and other whitespace are not part of the data
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		data = bytes.Map(func(r rune) rune {
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+				return -1
+			}
+			return r
+		}, data)
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(string(data), "="))
+	case "quoted-printable":
+		return io.ReadAll(quotedprintable.NewReader(body))
+	default:
+		return io.ReadAll(body)
+	}
+}
+
+// decodeCharset converts text in charset to UTF-8. ISO-8859-1 is converted; other charsets are returned as they
+// are, with invalid UTF-8 replaced.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "latin-1":
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+
+	if utf8.Valid(data) {
+		return string(data)
+	}
+
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+// splitAddresses splits an address list header into its addresses, keeping display names.
+func splitAddresses(list string) []string {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+
+	addrs, err := mail.ParseAddressList(list)
+	if err != nil {
+		var out []string
+		for _, a := range strings.Split(list, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				out = append(out, a)
+			}
+		}
+		return out
+	}
+
+	out := make([]string, len(addrs))
+	for i, a := range addrs {
+		out[i] = a.String()
+	}
+
+	return out
+}
+
+// readFileHeader reads an uploaded form file.
+func readFileHeader(hdr *multipart.FileHeader) ([]byte, error) {
+	f, err := hdr.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// SaveEmailAttachments stores an email's attachments as UploadFiles stores uploaded files, so they pass the same
+// checks: AllowedFileTypes, MaxFileSize, FileNamer, BeforeSave and AfterSave, TenantRoot and the Authorizer. Each
+// attachment's File is set to the stored file. Attachments without a name are named attachment-N, and empty ones
+// are skipped.
+// Parameters:
+// - ctx: The context of the request, used for tenants, authorization and the hooks.
+// - email: The email.
+// - uploadDir: The directory to store the files in.
+// - rename: An optional boolean slice indicating whether the files should be renamed (true by default if not specified).
+// Returns the stored files, or the first error. Files already stored are kept unless UploadWrite.AllOrNothing is set.
+func (t *Tools) SaveEmailAttachments(ctx context.Context, email *InboundEmail, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
+	renameFile := true
+	if len(rename) > 0 {
+		renameFile = rename[0]
+	}
+
+	uploadDir, err := t.TenantPath(ctx, uploadDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.authorize(ctx, FileUpload, uploadDir); err != nil {
+		return nil, err
+	}
+	if err := t.CreateDirIfNotExist(uploadDir); err != nil {
+		return nil, err
+	}
+
+	maxSize := int64(t.MaxFileSize)
+	if maxSize <= 0 {
+		maxSize = 1024 * 1024 * 1024
+	}
+
+	// encode the attachments as a multipart form, so they are stored by the same code as uploaded files
+	var attachments []*EmailAttachment
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for i, a := range email.Attachments {
+		if len(a.Content) == 0 {
+			continue
+		}
+		if int64(len(a.Content)) > maxSize {
+			return nil, errors.New("the uploaded file is too big")
+		}
+
+		name := a.Filename
+		if name == "" {
+			name = fmt.Sprintf("attachment-%d%s", i+1, uploadedFileExtension("", a.ContentType))
+		}
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "attachment", "filename": name}))
+		h.Set("Content-Type", a.ContentType)
+		pw, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write(a.Content); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	form, err := multipart.NewReader(&buf, mw.Boundary()).ReadForm(maxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer form.RemoveAll()
+
+	var files []*UploadedFile
+	for i, hdr := range form.File["attachment"] {
+		file, err := t.saveUploadedFile(ctx, headerPart(hdr), uploadDir, renameFile, "")
+		if err != nil {
+			if t.UploadWrite.AllOrNothing {
+				for _, f := range files {
+					_ = os.Remove(f.StoredPath)
+				}
+			}
+			return nil, err
+		}
+		attachments[i].File = file
+		files = append(files, file)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,211 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+var emailPDF = []byte("%PDF-1.4\n1 0 obj << >> endobj\n%%EOF\n")
+
+var emailPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// testRawEmail is a message with alternative bodies, a PDF attachment and an inline image.
+var testRawEmail = strings.ReplaceAll(`From: =?UTF-8?Q?Jos=C3=A9?= <jose@example.com>
+To: support@app.test, "Ann" <ann@app.test>
+Subject: =?UTF-8?B?T2zDoSwgaW52b2ljZQ==?=
+Message-ID: <abc123@example.com>
+Date: Mon, 02 Jan 2006 15:04:05 -0700
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/related; boundary="related"
+
+--related
+Content-Type: multipart/alternative; boundary="alt"
+
+--alt
+Content-Type: text/plain; charset=iso-8859-1
+Content-Transfer-Encoding: quoted-printable
+
+Caf=E9 invoice attached.
+--alt
+Content-Type: text/html; charset=utf-8
+Content-Transfer-Encoding: base64
+
+`+base64.StdEncoding.EncodeToString([]byte(`<p>Invoice <img src="cid:logo@x"></p>`))+`
+--alt--
+--related
+Content-Type: image/png
+Content-ID: <logo@x>
+Content-Transfer-Encoding: base64
+
+`+base64.StdEncoding.EncodeToString(emailPNG)+`
+--related--
+--outer
+Content-Type: application/pdf
+Content-Disposition: attachment; filename*=UTF-8''fatura%20n%C2%BA1.pdf
+Content-Transfer-Encoding: base64
+
+`+base64.StdEncoding.EncodeToString(emailPDF)+`
+--outer--
+`, "\n", "\r\n")
+
+func TestTools_ParseRawEmail(t *testing.T) {
+	var testTools Tools
+
+	email, err := testTools.ParseRawEmail([]byte(testRawEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if email.Subject != "Olá, invoice" || email.MessageID != "abc123@example.com" || email.Date.IsZero() {
+		t.Errorf("unexpected headers: %+v", email)
+	}
+	if !strings.Contains(email.From, "jose@example.com") || len(email.To) != 2 {
+		t.Errorf("unexpected addresses: %q %q", email.From, email.To)
+	}
+	if strings.TrimSpace(email.Text) != "Café invoice attached." {
+		t.Errorf("expected a decoded text body, got %q", email.Text)
+	}
+	if !strings.Contains(email.HTML, "cid:logo@x") {
+		t.Errorf("expected a decoded HTML body, got %q", email.HTML)
+	}
+
+	if len(email.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(email.Attachments))
+	}
+	logo, pdf := email.Attachments[0], email.Attachments[1]
+	if !logo.Inline || logo.ContentID != "logo@x" || !bytes.Equal(logo.Content, emailPNG) {
+		t.Errorf("unexpected inline image: %+v", logo)
+	}
+	if pdf.Inline || pdf.Filename != "fatura nº1.pdf" || pdf.ContentType != "application/pdf" || !bytes.Equal(pdf.Content, emailPDF) {
+		t.Errorf("unexpected attachment: %+v", pdf)
+	}
+
+	if _, err := testTools.ParseRawEmail([]byte("not an email")); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail, got %v", err)
+	}
+}
+
+func TestTools_ParseInboundEmail(t *testing.T) {
+	var testTools Tools
+
+	form := func(fields map[string]string, files map[string][]byte) *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for k, v := range fields {
+			_ = mw.WriteField(k, v)
+		}
+		for k, v := range files {
+			fw, _ := mw.CreateFormFile(k, k+".pdf")
+			_, _ = fw.Write(v)
+		}
+		_ = mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/inbound", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	sesMessage, _ := json.Marshal(map[string]string{"notificationType": "Received", "content": base64.StdEncoding.EncodeToString([]byte(testRawEmail))})
+	sns, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": string(sesMessage)})
+
+	rawReq := httptest.NewRequest(http.MethodPost, "/inbound", strings.NewReader(testRawEmail))
+	rawReq.Header.Set("Content-Type", "message/rfc822")
+
+	snsReq := httptest.NewRequest(http.MethodPost, "/inbound", bytes.NewReader(sns))
+	snsReq.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+
+	var tests = []struct {
+		name        string
+		req         *http.Request
+		subject     string
+		text        string
+		attachments int
+		contentID   string
+	}{
+		{"raw message", rawReq, "Olá, invoice", "Café", 2, "logo@x"},
+		{"ses via sns", snsReq, "Olá, invoice", "Café", 2, "logo@x"},
+		{"sendgrid raw", form(map[string]string{"email": testRawEmail}, nil), "Olá, invoice", "Café", 2, "logo@x"},
+		{"mailgun raw", form(map[string]string{"body-mime": testRawEmail}, nil), "Olá, invoice", "Café", 2, "logo@x"},
+		{"mailgun parsed", form(map[string]string{
+			"sender": "jose@example.com", "recipient": "support@app.test", "subject": "Hello", "body-plain": "Hi there",
+			"content-id-map": `{"<img1@x>": "attachment-1"}`,
+		}, map[string][]byte{"attachment-1": emailPDF}), "Hello", "Hi there", 1, "img1@x"},
+		{"sendgrid parsed", form(map[string]string{
+			"from": "jose@example.com", "to": "support@app.test", "subject": "Hello", "text": "Hi there",
+			"attachment-info": `{"attachment1": {"filename": "a.pdf", "content-id": "ii_1"}}`,
+		}, map[string][]byte{"attachment1": emailPDF}), "Hello", "Hi there", 1, "ii_1"},
+	}
+
+	for _, e := range tests {
+		email, err := testTools.ParseInboundEmail(e.req)
+		if err != nil {
+			t.Errorf("%s: %v", e.name, err)
+			continue
+		}
+		if email.Subject != e.subject || !strings.Contains(email.Text, e.text) {
+			t.Errorf("%s: unexpected email %+v", e.name, email)
+		}
+		if len(email.Attachments) != e.attachments || email.Attachments[0].ContentID != e.contentID {
+			t.Errorf("%s: unexpected attachments %+v", e.name, email.Attachments)
+		}
+	}
+
+	confirm, _ := json.Marshal(map[string]string{"Type": "SubscriptionConfirmation", "SubscribeURL": "https://sns.test/confirm"})
+	req := httptest.NewRequest(http.MethodPost, "/inbound", bytes.NewReader(confirm))
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := testTools.ParseInboundEmail(req); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail for a subscription confirmation, got %v", err)
+	}
+}
+
+func TestTools_SaveEmailAttachments(t *testing.T) {
+	email := &InboundEmail{Attachments: []*EmailAttachment{
+		{Filename: "../../invoice.pdf", ContentType: "application/pdf", Content: emailPDF},
+		{ContentType: "image/png", Content: emailPNG, Inline: true},
+		{Filename: "empty.txt", ContentType: "text/plain"},
+	}}
+
+	var hooked []string
+	testTools := Tools{
+		AllowedFileTypes: []string{"application/pdf", "image/png"},
+		AfterSave: func(_ context.Context, file *UploadedFile, _ *multipart.FileHeader) error {
+			hooked = append(hooked, file.OriginalFileName)
+			return nil
+		},
+	}
+	dir := t.TempDir()
+
+	files, err := testTools.SaveEmailAttachments(context.Background(), email, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || email.Attachments[0].File != files[0] || email.Attachments[2].File != nil {
+		t.Fatalf("expected 2 stored files, got %+v", files)
+	}
+	if files[0].NewFileName != "invoice.pdf" || files[1].NewFileName != "attachment-2.png" {
+		t.Errorf("unexpected names %q and %q", files[0].NewFileName, files[1].NewFileName)
+	}
+	if data, err := os.ReadFile(files[0].StoredPath); err != nil || !bytes.Equal(data, emailPDF) {
+		t.Errorf("expected the stored PDF, got %v", err)
+	}
+	if len(hooked) != 2 {
+		t.Errorf("expected AfterSave for each file, got %v", hooked)
+	}
+
+	testTools.AllowedFileTypes = []string{"image/png"}
+	if _, err := testTools.SaveEmailAttachments(context.Background(), email, dir); err == nil {
+		t.Error("expected a disallowed type to fail")
+	}
+}
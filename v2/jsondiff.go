@@ -0,0 +1,615 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrJSONPatch is returned when a JSON patch cannot be applied.
+var ErrJSONPatch = errors.New("json patch failed")
+
+// JSONPatchOp is one operation of an RFC 6902 JSON patch.
+// Fields:
+// - Op: "add", "remove", "replace", "move", "copy" or "test".
+// - Path: The JSON pointer (RFC 6901) of the target, e.g. "/address/city" or "/tags/0".
+// - From: The source pointer of "move" and "copy".
+// - Value: The value of "add", "replace" and "test".
+// - Old: The value replaced or removed, as found by DiffJSON. It is not part of the patch and is not marshaled.
+type JSONPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+	Old   json.RawMessage `json:"-"`
+}
+
+// JSONPatch is an RFC 6902 JSON patch. It marshals to the standard format, with the
+// application/json-patch+json media type.
+type JSONPatch []JSONPatchOp
+
+// JSONDiffOptions holds options for DiffJSON.
+// Fields:
+// - Ignore: JSON pointers whose changes are left out, e.g. "/updated_at". A pointer also ignores everything
+// below it.
+// - Redactor: If set, values of sensitive fields, such as passwords, are replaced in the patch and the summary,
+// so the change is recorded without the secret.
+type JSONDiffOptions struct {
+	Ignore   []string
+	Redactor *Redactor
+}
+
+// DiffJSON compares two JSON documents, e.g. a resource before and after an update read with ReadJSON, for an
+// audit log. Object members are compared by name, and arrays by index.
+// Parameters:
+// - a: The original document: a []byte or json.RawMessage holding JSON, or any value, which is marshaled.
+// - b: The new document, likewise.
+// - opts: Optional JSONDiffOptions. Only the first value is used if multiple are provided.
+// Returns the patch turning a into b, empty if they are equal, or an error if a document is not valid JSON.
+func (t *Tools) DiffJSON(a, b interface{}, opts ...JSONDiffOptions) (JSONPatch, error) {
+	var o JSONDiffOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	av, err := decodeJSONDocument(a)
+	if err != nil {
+		return nil, err
+	}
+	bv, err := decodeJSONDocument(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := jsonDiffer{opts: o, patch: JSONPatch{}}
+	d.diff("", "", av, bv)
+
+	return d.patch, nil
+}
+
+// decodeJSONDocument decodes a JSON document, keeping numbers exact.
+func decodeJSONDocument(v interface{}) (interface{}, error) {
+	var data []byte
+	switch v := v.(type) {
+	case []byte:
+		data = v
+	case json.RawMessage:
+		data = v
+	default:
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var out interface{}
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("body must only contain a single JSON value")
+	}
+
+	return out, nil
+}
+
+// jsonDiffer accumulates the operations of a diff.
+type jsonDiffer struct {
+	opts  JSONDiffOptions
+	patch JSONPatch
+}
+
+// diff compares a and b at ptr. key is the member name or index at ptr, used to spot sensitive fields.
+func (d *jsonDiffer) diff(ptr, key string, a, b interface{}) {
+	if d.ignored(ptr) {
+		return
+	}
+
+	// sensitive members are compared whole, so nothing inside them is shown
+	sensitive := d.opts.Redactor != nil && key != "" && d.opts.Redactor.IsSensitive(key)
+
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok && !sensitive {
+			d.diffObjects(ptr, av, bv)
+			return
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok && !sensitive {
+			d.diffArrays(ptr, av, bv)
+			return
+		}
+	}
+
+	if !jsonEqual(a, b) {
+		d.patch = append(d.patch, JSONPatchOp{Op: "replace", Path: ptr, Value: d.value(key, b), Old: d.value(key, a)})
+	}
+}
+
+// diffObjects compares two objects member by member, in name order.
+func (d *jsonDiffer) diffObjects(ptr string, a, b map[string]interface{}) {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		child := ptr + "/" + escapeJSONPointer(k)
+		av, inA := a[k]
+		bv, inB := b[k]
+
+		switch {
+		case inA && inB:
+			d.diff(child, k, av, bv)
+		case inB:
+			if !d.ignored(child) {
+				d.patch = append(d.patch, JSONPatchOp{Op: "add", Path: child, Value: d.value(k, bv)})
+			}
+		default:
+			if !d.ignored(child) {
+				d.patch = append(d.patch, JSONPatchOp{Op: "remove", Path: child, Old: d.value(k, av)})
+			}
+		}
+	}
+}
+
+// diffArrays compares two arrays index by index. Extra elements are removed from the end first, so the indexes
+// of the patch stay valid as it is applied.
+func (d *jsonDiffer) diffArrays(ptr string, a, b []interface{}) {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		d.diff(ptr+"/"+strconv.Itoa(i), "", a[i], b[i])
+	}
+
+	for i := len(a) - 1; i >= n; i-- {
+		if child := ptr + "/" + strconv.Itoa(i); !d.ignored(child) {
+			d.patch = append(d.patch, JSONPatchOp{Op: "remove", Path: child, Old: d.value("", a[i])})
+		}
+	}
+	for i := n; i < len(b); i++ {
+		if child := ptr + "/" + strconv.Itoa(i); !d.ignored(child) {
+			d.patch = append(d.patch, JSONPatchOp{Op: "add", Path: child, Value: d.value("", b[i])})
+		}
+	}
+}
+
+// ignored reports whether ptr is one of the ignored pointers or below one.
+func (d *jsonDiffer) ignored(ptr string) bool {
+	for _, ignored := range d.opts.Ignore {
+		if ptr == ignored || strings.HasPrefix(ptr, ignored+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// value marshals a value for the patch, redacting it if the member named key is sensitive.
+func (d *jsonDiffer) value(key string, v interface{}) json.RawMessage {
+	rd := d.opts.Redactor
+	if rd != nil && key != "" && rd.IsSensitive(key) {
+		data, _ := json.Marshal(rd.replacement())
+		return data
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	if rd != nil {
+		return rd.RedactJSON(data)
+	}
+
+	return data
+}
+
+// jsonEqual reports whether two decoded JSON values are equal, comparing numbers by value, so 1 equals 1.0.
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		if !strings.ContainsAny(string(av)+string(bv), ".eE") {
+			// distinct integers, which may be too large for a float64 to tell apart
+			return false
+		}
+		af, err1 := av.Float64()
+		bf, err2 := bv.Float64()
+		return err1 == nil && err2 == nil && af == bf
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			w, ok := bv[k]
+			if !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+// escapeJSONPointer escapes a member name for use in a JSON pointer.
+func escapeJSONPointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// splitJSONPointer splits a JSON pointer into its unescaped tokens.
+func splitJSONPointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("%w: invalid JSON pointer %q", ErrJSONPatch, ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, tok := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+	}
+
+	return tokens, nil
+}
+
+// Summary describes the patch for people, one line per operation, e.g. for an audit log:
+//
+//	changed name from "Ann" to "Anne"
+//	added tags[2]: "vip"
+//	removed address.zip (was "12345")
+//
+// Returns the lines.
+func (p JSONPatch) Summary() []string {
+	lines := make([]string, 0, len(p))
+
+	for _, op := range p {
+		field := jsonPointerLabel(op.Path)
+
+		switch op.Op {
+		case "add":
+			lines = append(lines, fmt.Sprintf("added %s: %s", field, summaryValue(op.Value)))
+		case "remove":
+			if len(op.Old) > 0 {
+				lines = append(lines, fmt.Sprintf("removed %s (was %s)", field, summaryValue(op.Old)))
+			} else {
+				lines = append(lines, "removed "+field)
+			}
+		case "replace":
+			if len(op.Old) > 0 {
+				lines = append(lines, fmt.Sprintf("changed %s from %s to %s", field, summaryValue(op.Old), summaryValue(op.Value)))
+			} else {
+				lines = append(lines, fmt.Sprintf("changed %s to %s", field, summaryValue(op.Value)))
+			}
+		case "move":
+			lines = append(lines, fmt.Sprintf("moved %s to %s", jsonPointerLabel(op.From), field))
+		case "copy":
+			lines = append(lines, fmt.Sprintf("copied %s to %s", jsonPointerLabel(op.From), field))
+		case "test":
+			lines = append(lines, fmt.Sprintf("checked %s is %s", field, summaryValue(op.Value)))
+		}
+	}
+
+	return lines
+}
+
+// String returns the Summary, one operation per line.
+func (p JSONPatch) String() string {
+	return strings.Join(p.Summary(), "\n")
+}
+
+// jsonPointerLabel turns a JSON pointer into a readable field path, e.g. "/items/0/name" into "items[0].name".
+func jsonPointerLabel(ptr string) string {
+	tokens, err := splitJSONPointer(ptr)
+	if err != nil {
+		return ptr
+	}
+	if len(tokens) == 0 {
+		return "the document"
+	}
+
+	var b strings.Builder
+	for _, tok := range tokens {
+		if _, err := strconv.Atoi(tok); err == nil || tok == "-" {
+			b.WriteString("[" + tok + "]")
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(tok)
+	}
+
+	return b.String()
+}
+
+// summaryValue returns a value's compact JSON, shortened for a summary line.
+func summaryValue(raw json.RawMessage) string {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return string(raw)
+	}
+
+	s := b.String()
+	if r := []rune(s); len(r) > 60 {
+		s = string(r[:57]) + "..."
+	}
+
+	return s
+}
+
+// ApplyJSONPatch applies an RFC 6902 patch to a JSON document, e.g. the body of a PATCH request with the
+// application/json-patch+json media type. Operations are applied in order, and the patch is applied entirely or
+// not at all.
+// Parameters:
+// - doc: The JSON document.
+// - patch: The operations.
+// Returns the patched document, or an error wrapping ErrJSONPatch naming the failed operation, for example a
+// "test" that did not match or a path that does not exist.
+func (t *Tools) ApplyJSONPatch(doc []byte, patch JSONPatch) ([]byte, error) {
+	v, err := decodeJSONDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range patch {
+		if v, err = applyJSONPatchOp(v, op); err != nil {
+			return nil, fmt.Errorf("%w: operation %d (%s %s): %v", ErrJSONPatch, i, op.Op, op.Path, unwrapJSONPatch(err))
+		}
+	}
+
+	return json.Marshal(v)
+}
+
+// unwrapJSONPatch drops the ErrJSONPatch prefix from err, which ApplyJSONPatch adds once.
+func unwrapJSONPatch(err error) string {
+	return strings.TrimPrefix(err.Error(), ErrJSONPatch.Error()+": ")
+}
+
+// applyJSONPatchOp applies one operation to doc, returning the new document.
+func applyJSONPatchOp(doc interface{}, op JSONPatchOp) (interface{}, error) {
+	path, err := splitJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := func() (interface{}, error) {
+		if len(op.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+		return decodeJSONDocument([]byte(op.Value))
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+	case "remove":
+		_, doc, err = jsonPointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return v, nil
+		}
+		if _, doc, err = jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+	case "move":
+		from, err := splitJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Path != op.From && strings.HasPrefix(op.Path+"/", op.From+"/") {
+			return nil, errors.New("cannot move a value into itself")
+		}
+		v, doc, err := jsonPointerRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+	case "copy":
+		from, err := splitJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := jsonPointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		// copies must not share maps and slices with the original
+		data, _ := json.Marshal(v)
+		if v, err = decodeJSONDocument(data); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, v)
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(got, want) {
+			return nil, errors.New("value does not match")
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// jsonArrayIndex parses an array index token, allowing "-" (one past the end) if allowEnd is set.
+func jsonArrayIndex(tok string, n int, allowEnd bool) (int, error) {
+	if tok == "-" && allowEnd {
+		return n, nil
+	}
+
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || (tok != "0" && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	if i > n || (i == n && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+
+	return i, nil
+}
+
+// jsonPointerGet returns the value at path.
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[tok]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", tok)
+			}
+			doc = v
+		case []interface{}:
+			i, err := jsonArrayIndex(tok, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("cannot descend into %q", tok)
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonPointerUpdate calls fn with the container holding the last token of path, and stores the container fn
+// returns back into its parent, since arrays may be reallocated. Returns the new document.
+func jsonPointerUpdate(doc interface{}, path []string, fn func(container interface{}, tok string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	tok := path[0]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[tok]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", tok)
+		}
+		child, err := jsonPointerUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[tok] = child
+		return node, nil
+	case []interface{}:
+		i, err := jsonArrayIndex(tok, len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := jsonPointerUpdate(node[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot descend into %q", tok)
+	}
+}
+
+// jsonPointerAdd adds v at path, inserting into arrays. Returns the new document.
+func jsonPointerAdd(doc interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+
+	return jsonPointerUpdate(doc, path, func(container interface{}, tok string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[tok] = v
+			return node, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(tok, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = v
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar", tok)
+		}
+	})
+}
+
+// jsonPointerRemove removes the value at path. Returns the removed value and the new document.
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	var removed interface{}
+	doc, err := jsonPointerUpdate(doc, path, func(container interface{}, tok string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			v, ok := node[tok]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found", tok)
+			}
+			removed = v
+			delete(node, tok)
+			return node, nil
+		case []interface{}:
+			i, err := jsonArrayIndex(tok, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i:i], node[i+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar", tok)
+		}
+	})
+
+	return removed, doc, err
+}
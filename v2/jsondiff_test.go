@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTools_DiffJSON(t *testing.T) {
+	var testTools Tools
+
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip,omitempty"`
+	}
+	type user struct {
+		Name     string   `json:"name"`
+		Age      int      `json:"age"`
+		Tags     []string `json:"tags"`
+		Address  *address `json:"address,omitempty"`
+		Password string   `json:"password"`
+	}
+
+	before := user{Name: "Ann", Age: 30, Tags: []string{"a", "b", "c"}, Address: &address{City: "Lisbon", Zip: "1000"}, Password: "old"}
+	after := user{Name: "Anne", Age: 30, Tags: []string{"a", "x"}, Address: &address{City: "Porto"}, Password: "new"}
+
+	patch, err := testTools.DiffJSON(before, after, JSONDiffOptions{Redactor: NewRedactor()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		`changed address.city from "Lisbon" to "Porto"`,
+		`removed address.zip (was "1000")`,
+		`changed name from "Ann" to "Anne"`,
+		`changed password from "[REDACTED]" to "[REDACTED]"`,
+		`changed tags[1] from "b" to "x"`,
+		`removed tags[2] (was "c")`,
+	}
+	if got := patch.Summary(); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected summary:\n%s", strings.Join(got, "\n"))
+	}
+
+	data, _ := json.Marshal(patch[:2])
+	if string(data) != `[{"op":"replace","path":"/address/city","value":"Porto"},{"op":"remove","path":"/address/zip"}]` {
+		t.Errorf("unexpected patch JSON %s", data)
+	}
+
+	// applying the patch to the original yields the new document, except the redacted password
+	beforeJSON, _ := json.Marshal(before)
+	patched, err := testTools.ApplyJSONPatch(beforeJSON, patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after.Password = "[REDACTED]"
+	if rest, _ := testTools.DiffJSON(patched, after); len(rest) != 0 {
+		t.Errorf("expected the patch to turn a into b, left %v", rest.Summary())
+	}
+
+	var tests = []struct {
+		name     string
+		a, b     string
+		opts     JSONDiffOptions
+		expected string
+	}{
+		{"equal", `{"a":1,"b":[1,2]}`, `{"b":[1,2],"a":1.0}`, JSONDiffOptions{}, ``},
+		{"added member", `{"a":1}`, `{"a":1,"b/c":{"d":true}}`, JSONDiffOptions{}, `added b/c: {"d":true}`},
+		{"appended elements", `[1]`, `[1,2,3]`, JSONDiffOptions{}, "added [1]: 2\nadded [2]: 3"},
+		{"type change", `{"a":[1]}`, `{"a":{"0":1}}`, JSONDiffOptions{}, `changed a from [1] to {"0":1}`},
+		{"document", `1`, `"x"`, JSONDiffOptions{}, `changed the document from 1 to "x"`},
+		{"ignored", `{"a":1,"meta":{"at":1}}`, `{"a":2,"meta":{"at":2}}`, JSONDiffOptions{Ignore: []string{"/meta"}}, `changed a from 1 to 2`},
+		{"big numbers", `{"id":12345678901234567890}`, `{"id":12345678901234567891}`, JSONDiffOptions{}, `changed id from 12345678901234567890 to 12345678901234567891`},
+	}
+
+	for _, e := range tests {
+		patch, err := testTools.DiffJSON([]byte(e.a), json.RawMessage(e.b), e.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if patch.String() != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, patch.String())
+		}
+
+		if len(e.opts.Ignore) > 0 {
+			continue
+		}
+		patched, err := testTools.ApplyJSONPatch([]byte(e.a), patch)
+		if err != nil {
+			t.Errorf("%s: unexpected error applying the patch %v", e.name, err)
+			continue
+		}
+		if rest, _ := testTools.DiffJSON(patched, []byte(e.b)); len(rest) != 0 {
+			t.Errorf("%s: expected the patch to turn a into b, got %s", e.name, patched)
+		}
+	}
+
+	if _, err := testTools.DiffJSON([]byte(`{`), []byte(`{}`)); err == nil {
+		t.Error("expected invalid JSON to fail")
+	}
+}
+
+func TestTools_ApplyJSONPatch(t *testing.T) {
+	var testTools Tools
+
+	doc := `{"a":{"b":[1,2,3]},"c":"x"}`
+
+	var tests = []struct {
+		name     string
+		patch    string
+		expected string
+		errMsg   string
+	}{
+		{"add to array", `[{"op":"add","path":"/a/b/1","value":9}]`, `{"a":{"b":[1,9,2,3]},"c":"x"}`, ""},
+		{"append", `[{"op":"add","path":"/a/b/-","value":4}]`, `{"a":{"b":[1,2,3,4]},"c":"x"}`, ""},
+		{"remove", `[{"op":"remove","path":"/a/b/0"}]`, `{"a":{"b":[2,3]},"c":"x"}`, ""},
+		{"replace", `[{"op":"replace","path":"/c","value":null}]`, `{"a":{"b":[1,2,3]},"c":null}`, ""},
+		{"move", `[{"op":"move","from":"/c","path":"/a/d"}]`, `{"a":{"b":[1,2,3],"d":"x"}}`, ""},
+		{"copy", `[{"op":"copy","from":"/a/b","path":"/e"},{"op":"remove","path":"/e/0"}]`, `{"a":{"b":[1,2,3]},"c":"x","e":[2,3]}`, ""},
+		{"test", `[{"op":"test","path":"/a/b/2","value":3.0},{"op":"remove","path":"/c"}]`, `{"a":{"b":[1,2,3]}}`, ""},
+		{"failed test", `[{"op":"remove","path":"/c"},{"op":"test","path":"/a/b/0","value":2}]`, "", "operation 1 (test /a/b/0): value does not match"},
+		{"missing member", `[{"op":"replace","path":"/z","value":1}]`, "", `member "z" not found`},
+		{"index out of range", `[{"op":"add","path":"/a/b/5","value":1}]`, "", "out of range"},
+		{"leading zero", `[{"op":"remove","path":"/a/b/01"}]`, "", "invalid array index"},
+		{"move into itself", `[{"op":"move","from":"/a","path":"/a/b/x"}]`, "", "into itself"},
+		{"unknown op", `[{"op":"merge","path":"/a"}]`, "", "unknown operation"},
+		{"missing value", `[{"op":"add","path":"/x"}]`, "", "missing value"},
+	}
+
+	for _, e := range tests {
+		var patch JSONPatch
+		if err := json.Unmarshal([]byte(e.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := testTools.ApplyJSONPatch([]byte(doc), patch)
+		if e.errMsg != "" {
+			if !errors.Is(err, ErrJSONPatch) || !strings.Contains(err.Error(), e.errMsg) {
+				t.Errorf("%s: expected an ErrJSONPatch containing %q, got %v", e.name, e.errMsg, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, out)
+		}
+	}
+}
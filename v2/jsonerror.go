@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// JSONErrorCode is a stable, machine-readable identifier for a JSON decoding failure.
+// Unlike the human-readable message, codes never change between releases, so clients and tests can rely on them.
+type JSONErrorCode string
+
+const (
+	JSONErrSyntax         JSONErrorCode = "json.syntax"
+	JSONErrUnexpectedEOF  JSONErrorCode = "json.unexpected_eof"
+	JSONErrInvalidType    JSONErrorCode = "json.invalid_type"
+	JSONErrEmptyBody      JSONErrorCode = "json.empty_body"
+	JSONErrUnknownField   JSONErrorCode = "json.unknown_field"
+	JSONErrTooLarge       JSONErrorCode = "json.too_large"
+	JSONErrInvalidTarget  JSONErrorCode = "json.invalid_target"
+	JSONErrMultipleValues JSONErrorCode = "json.multiple_values"
+	JSONErrUnknown        JSONErrorCode = "json.unknown"
+)
+
+// maxJSONErrorFieldBytes is the longest field name quoted in a JSONError message.
+const maxJSONErrorFieldBytes = 64
+
+// JSONError is the error type returned by ReadJSON.
+// Fields:
+// - Code: The stable error code identifying the kind of failure.
+// - Message: A human-readable description, safe to return to clients.
+// - Field: The offending JSON field, when known.
+// - Offset: The byte offset in the input where the error occurred, when known.
+// - Err: The underlying error reported by the decoder.
+type JSONError struct {
+	Code    JSONErrorCode
+	Message string
+	Field   string
+	Offset  int64
+	Err     error
+}
+
+// Error returns the human-readable message of the error.
+func (e *JSONError) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the error code as a string, letting ErrorJSON include it in responses.
+func (e *JSONError) ErrorCode() string {
+	return string(e.Code)
+}
+
+// Unwrap returns the underlying decoder error so errors.Is and errors.As keep working.
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// JSONErrorCodeOf extracts the JSONErrorCode from an error chain.
+// Parameters:
+// - err: The error to inspect.
+// Returns the code of the first *JSONError found in the chain, or an empty code if there is none.
+func JSONErrorCodeOf(err error) JSONErrorCode {
+	var jsonErr *JSONError
+	if errors.As(err, &jsonErr) {
+		return jsonErr.Code
+	}
+
+	return ""
+}
+
+// errorCode returns the machine-readable code carried by any error in the chain implementing ErrorCode() string.
+func errorCode(err error) string {
+	var coded interface{ ErrorCode() string }
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+
+	return ""
+}
+
+// sanitizeJSONField makes a client-supplied field name safe to embed in an error message,
+// dropping invalid UTF-8 and truncating overly long names.
+func sanitizeJSONField(field string) string {
+	field = strings.ToValidUTF8(field, "")
+
+	if len(field) > maxJSONErrorFieldBytes {
+		cut := maxJSONErrorFieldBytes
+		for cut > 0 && !utf8.RuneStart(field[cut]) {
+			cut--
+		}
+		field = field[:cut] + "..."
+	}
+
+	return field
+}
@@ -0,0 +1,125 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var jsonErrorCodeTests = []struct {
+	name    string
+	json    string
+	maxSize int
+	code    JSONErrorCode
+}{
+	{name: "syntax", json: `{"foo": "bar",}`, maxSize: 1024, code: JSONErrSyntax},
+	{name: "unexpected eof", json: `{"foo": "bar"`, maxSize: 1024, code: JSONErrUnexpectedEOF},
+	{name: "invalid type", json: `{"foo": 1}`, maxSize: 1024, code: JSONErrInvalidType},
+	{name: "empty body", json: ``, maxSize: 1024, code: JSONErrEmptyBody},
+	{name: "unknown field", json: `{"baz": "qux"}`, maxSize: 1024, code: JSONErrUnknownField},
+	{name: "too large", json: `{"foo": "bar"}`, maxSize: 4, code: JSONErrTooLarge},
+	{name: "multiple values", json: `{"foo": "bar"}{"foo": "bar"}`, maxSize: 1024, code: JSONErrMultipleValues},
+}
+
+func TestTools_ReadJSONErrorCodes(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range jsonErrorCodeTests {
+		testTools.MaxJSONSize = e.maxSize
+
+		var decodedJSON struct {
+			Foo string `json:"foo"`
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(e.json)))
+		rr := httptest.NewRecorder()
+
+		err := testTools.ReadJSON(rr, req, &decodedJSON)
+
+		var jsonErr *JSONError
+		if !errors.As(err, &jsonErr) {
+			t.Errorf("%s: expected *JSONError, got %T", e.name, err)
+			continue
+		}
+
+		if jsonErr.Code != e.code {
+			t.Errorf("%s: wrong code; expected %s, got %s", e.name, e.code, jsonErr.Code)
+		}
+	}
+}
+
+func TestTools_ErrorJSONIncludesCode(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	err := testTools.ErrorJSON(rr, &JSONError{Code: JSONErrTooLarge, Message: "too large"})
+	if err != nil {
+		t.Errorf("failed to write error json: %v", err)
+	}
+
+	var payload JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&payload)
+
+	if payload.Code != string(JSONErrTooLarge) {
+		t.Errorf("expected code %s, got %q", JSONErrTooLarge, payload.Code)
+	}
+}
+
+func TestSanitizeJSONField(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"name", "name"},
+		{"na\xffme\xc3", "name"},
+		{"caf\xc3\xa9", "café"},
+		{strings.Repeat("a", 63) + "é", strings.Repeat("a", 63) + "..."},
+		{strings.Repeat("b", 70), strings.Repeat("b", 64) + "..."},
+	}
+
+	for _, e := range tests {
+		if got := sanitizeJSONField(e.field); got != e.want {
+			t.Errorf("%q: expected %q, got %q", e.field, e.want, got)
+		}
+	}
+}
+
+func FuzzTools_ReadJSON(f *testing.F) {
+	for _, e := range readJsonTests {
+		f.Add(e.json)
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		var testTools Tools
+
+		var decodedJSON struct {
+			Foo string `json:"foo"`
+		}
+
+		req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+		rr := httptest.NewRecorder()
+
+		err := testTools.ReadJSON(rr, req, &decodedJSON)
+		if err == nil {
+			return
+		}
+
+		var jsonErr *JSONError
+		if !errors.As(err, &jsonErr) {
+			t.Fatalf("expected *JSONError, got %T", err)
+		}
+
+		if jsonErr.Code == "" {
+			t.Errorf("expected a non-empty error code")
+		}
+
+		if !utf8.ValidString(jsonErr.Message) {
+			t.Errorf("error message is not valid UTF-8: %q", jsonErr.Message)
+		}
+	})
+}
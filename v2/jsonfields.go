@@ -0,0 +1,202 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// fieldTree is a parsed sparse fieldset. A nil subtree keeps the whole value.
+type fieldTree map[string]fieldTree
+
+// parseFields parses a fields list such as "id,name,author.name" into a fieldTree. Selecting a field keeps all of
+// it, even if some of its subfields are also listed.
+func parseFields(fields []string) fieldTree {
+	tree := fieldTree{}
+
+	for _, f := range fields {
+		node := tree
+		parts := strings.Split(strings.TrimSpace(f), ".")
+
+		for i, part := range parts {
+			if part == "" {
+				break
+			}
+
+			child, seen := node[part]
+			if seen && child == nil {
+				// the whole field is already selected
+				break
+			}
+
+			if i == len(parts)-1 {
+				node[part] = nil
+				break
+			}
+
+			if child == nil {
+				child = fieldTree{}
+				node[part] = child
+			}
+			node = child
+		}
+	}
+
+	return tree
+}
+
+// FilterJSONFields marshals data keeping only the selected fields of each object, applied to every element of
+// arrays, so {"id":1,"name":"a","bio":"..."} with fields "id,name" becomes {"id":1,"name":"a"}. Nested fields
+// are selected with dots, e.g. "author.name". Unknown fields are ignored, and field order is preserved.
+// Parameters:
+// - data: The data to marshal.
+// - fields: The fields to keep. If empty, data is marshaled whole.
+// Returns the filtered JSON, or an error if data cannot be marshaled.
+func FilterJSONFields(data interface{}, fields []string) ([]byte, error) {
+	out, err := json.Marshal(data)
+	if err != nil || len(fields) == 0 {
+		return out, err
+	}
+
+	tree := parseFields(fields)
+	if len(tree) == 0 {
+		return out, nil
+	}
+
+	return pruneJSON(out, tree)
+}
+
+// pruneJSON keeps only the fields in tree from the objects in raw.
+func pruneJSON(raw json.RawMessage, tree fieldTree) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if tree == nil || len(trimmed) == 0 || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return raw, nil
+	}
+
+	var buf bytes.Buffer
+
+	if trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+
+		buf.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			pruned, err := pruneJSON(item, tree)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(pruned)
+		}
+		buf.WriteByte(']')
+
+		return buf.Bytes(), nil
+	}
+
+	// decode the object token by token to keep its key order
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('{')
+	first := true
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		subtree, ok := tree[key]
+		if !ok {
+			continue
+		}
+
+		pruned, err := pruneJSON(value, subtree)
+		if err != nil {
+			return nil, err
+		}
+
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(pruned)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// WriteJSONFiltered sends a JSON response like WriteJSON, keeping only the fields listed in the request's "fields"
+// query parameter, e.g. ?fields=id,name,author.name, to reduce payloads for clients that need a few fields.
+// Without the parameter the whole response is sent. For a JSONResponse, the fields select from its Data, so the
+// envelope is kept. Fields name the shape produced by Serializers, and Codecs encode the filtered envelope.
+// Parameters:
+// - w: The http.ResponseWriter to write the response to.
+// - r: The *http.Request carrying the fields parameter.
+// - status: The HTTP status code for the response.
+// - data: The data to be marshaled.
+// - headers: Optional custom headers. Only the first value is used if multiple are provided.
+// Returns an error if marshaling the data or writing the response fails.
+func (t *Tools) WriteJSONFiltered(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) error {
+	var fields []string
+	if q := r.URL.Query().Get("fields"); q != "" {
+		fields = strings.Split(q, ",")
+	}
+	if len(fields) == 0 {
+		return t.WriteJSON(w, status, data, headers...)
+	}
+
+	var err error
+
+	// the serializers run before filtering so fields name the versioned shape, and the codec after it so the
+	// envelope is kept
+	switch payload := t.serializeForVersion(w, data).(type) {
+	case JSONResponse:
+		data, err = filterResponseData(payload, fields)
+	case *JSONResponse:
+		data, err = filterResponseData(*payload, fields)
+	default:
+		var out []byte
+		out, err = FilterJSONFields(payload, fields)
+		data = json.RawMessage(out)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeJSONValue(w, status, t.encodeEnvelope(w, status, data), headers...)
+}
+
+// filterResponseData filters the Data of a JSONResponse, keeping the envelope for Tools.Codecs.
+func filterResponseData(payload JSONResponse, fields []string) (JSONResponse, error) {
+	if payload.Data == nil {
+		return payload, nil
+	}
+
+	filtered, err := FilterJSONFields(payload.Data, fields)
+	if err != nil {
+		return payload, err
+	}
+
+	payload.Data = json.RawMessage(filtered)
+
+	return payload, nil
+}
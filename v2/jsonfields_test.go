@@ -0,0 +1,94 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fieldsTestAuthor struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type fieldsTestPost struct {
+	ID        int              `json:"id"`
+	Title     string           `json:"title"`
+	Body      string           `json:"body"`
+	Author    fieldsTestAuthor `json:"author"`
+	CreatedAt string           `json:"created_at"`
+}
+
+var filterJSONFieldsTests = []struct {
+	name     string
+	fields   []string
+	expected string
+}{
+	{name: "no fields", fields: nil, expected: `{"id":1,"title":"Hi","body":"long","author":{"name":"Ann","email":"a@x"},"created_at":"2024"}`},
+	{name: "top level keeps order", fields: []string{"created_at", "id"}, expected: `{"id":1,"created_at":"2024"}`},
+	{name: "nested", fields: []string{"id", "author.name"}, expected: `{"id":1,"author":{"name":"Ann"}}`},
+	{name: "whole field wins", fields: []string{"author.name", "author"}, expected: `{"author":{"name":"Ann","email":"a@x"}}`},
+	{name: "unknown ignored", fields: []string{"title", "nope"}, expected: `{"title":"Hi"}`},
+}
+
+func TestFilterJSONFields(t *testing.T) {
+	post := fieldsTestPost{ID: 1, Title: "Hi", Body: "long", Author: fieldsTestAuthor{"Ann", "a@x"}, CreatedAt: "2024"}
+
+	for _, e := range filterJSONFieldsTests {
+		out, err := FilterJSONFields(post, e.fields)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		if string(out) != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, out)
+		}
+	}
+}
+
+func TestTools_WriteJSONFiltered(t *testing.T) {
+	var testTools Tools
+
+	posts := []fieldsTestPost{{ID: 1, Title: "a"}, {ID: 2, Title: "b"}}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/posts?fields=id", nil)
+	if err := testTools.WriteJSONFiltered(rr, req, http.StatusOK, posts); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != `[{"id":1},{"id":2}]` {
+		t.Errorf("expected filtered array, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/posts?fields=title", nil)
+	if err := testTools.WriteJSONFiltered(rr, req, http.StatusOK, JSONResponse{Message: "ok", Data: posts}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != `{"error":false,"message":"ok","data":[{"title":"a"},{"title":"b"}]}` {
+		t.Errorf("expected filtered envelope data, got %s", rr.Body.String())
+	}
+}
+
+func TestTools_WriteJSONFilteredVersioned(t *testing.T) {
+	testTools := Tools{Serializers: &VersionedSerializers{}, Codecs: newTestCodec()}
+	calls := 0
+	RegisterSerializer(testTools.Serializers, "v2", func(u versionTestUser) interface{} {
+		calls++
+		return map[string]interface{}{"id": u.ID, "name": u.FirstName + " " + u.LastName}
+	})
+
+	handler := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONFiltered(w, r, http.StatusOK, JSONResponse{Data: versionTestUser{ID: 1, FirstName: "Ann", LastName: "Lee"}})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v2/users?fields=name", nil))
+	if !sameJSON(rr.Body.Bytes(), `{"ok":true,"status":200,"result":{"name":"Ann Lee"}}`) {
+		t.Errorf("expected the serialized fields in the versioned envelope, got %s", rr.Body.String())
+	}
+	if calls != 1 {
+		t.Errorf("expected the serializer applied once, got %d", calls)
+	}
+}
@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+)
+
+// ErrInvalidCallback is returned when a JSONP callback name is not a safe JavaScript identifier path.
+var ErrInvalidCallback = errors.New("invalid JSONP callback name")
+
+// jsonpCallbackRegex matches callback names such as "cb" or "jQuery.handlers.load_1".
+var jsonpCallbackRegex = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+const maxJSONPCallbackLength = 128
+
+// WriteJSONOptions holds per-call options for WriteJSONWithOptions.
+// Fields:
+// - Indent: If set, the output is pretty-printed with this indent, e.g. "  ".
+// - JSONPParam: If set and the request has this query parameter, e.g. "callback", the response is wrapped in a call
+// to the named function and served as JavaScript, for legacy embed clients.
+// - DisableHTMLEscape: Write <, > and & as-is instead of as \u003c, \u003e and \u0026. Only use it for responses
+// that are never embedded in HTML.
+// - Headers: Custom headers to set on the response.
+// - Redactor: If set, sensitive fields are redacted from the output.
+type WriteJSONOptions struct {
+	Indent            string
+	JSONPParam        string
+	DisableHTMLEscape bool
+	Headers           http.Header
+	Redactor          *Redactor
+}
+
+// WriteJSONWithOptions sends a JSON response like WriteJSON, with formatting and JSONP options.
+// Serializers and Codecs are applied as in WriteJSON, before the Redactor.
+// Parameters:
+// - w: The http.ResponseWriter to write the response to.
+// - r: The *http.Request being answered, used to read the JSONP callback. It may be nil if JSONPParam is not set.
+// - status: The HTTP status code for the response.
+// - data: The data to be marshaled into JSON.
+// - opts: Optional WriteJSONOptions. Only the first value is used if multiple are provided.
+// Returns ErrInvalidCallback if the callback name is unsafe, in which case a 400 Bad Request JSON error is sent
+// instead, or an error if marshaling or writing fails.
+func (t *Tools) WriteJSONWithOptions(w http.ResponseWriter, r *http.Request, status int, data interface{}, opts ...WriteJSONOptions) error {
+	var o WriteJSONOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	callback := ""
+	if o.JSONPParam != "" && r != nil {
+		callback = r.URL.Query().Get(o.JSONPParam)
+		if callback != "" && (len(callback) > maxJSONPCallbackLength || !jsonpCallbackRegex.MatchString(callback)) {
+			_ = t.ErrorJSON(w, ErrInvalidCallback)
+			return ErrInvalidCallback
+		}
+	}
+
+	data = t.encodeEnvelope(w, status, t.serializeForVersion(w, data))
+
+	if o.Redactor != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		data = json.RawMessage(o.Redactor.RedactJSON(raw))
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	out, err := encodeJSON(buf, data, o.Indent, !o.DisableHTMLEscape)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range o.Headers {
+		w.Header()[key] = value
+	}
+
+	if callback != "" {
+		// the leading comment stops the response being read as a Flash file, and nosniff stops it
+		// being read as anything but script
+		w.Header().Set("Content-Type", "application/javascript")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+
+		_, err = w.Write([]byte("/**/" + callback + "(" + string(out) + ");"))
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_, err = w.Write(out)
+	return err
+}
+
+// encodeJSON marshals data like json.Marshal, optionally indented and without HTML escaping. U+2028 and U+2029
+// are always escaped, so the output is also valid JavaScript.
+// The result is held in buf.
+func encodeJSON(buf *bytes.Buffer, data interface{}, indent string, escapeHTML bool) ([]byte, error) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(escapeHTML)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+
+	if err := enc.Encode(data); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
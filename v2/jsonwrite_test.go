@@ -0,0 +1,73 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var writeJSONOptionsTests = []struct {
+	name        string
+	url         string
+	opts        WriteJSONOptions
+	status      int
+	contentType string
+	body        string
+}{
+	{name: "default", url: "/", status: http.StatusOK, contentType: "application/json", body: `{"html":"\u003cb\u003e","n":1}`},
+	{name: "indent", url: "/", opts: WriteJSONOptions{Indent: "  "}, status: http.StatusOK, contentType: "application/json", body: "{\n  \"html\": \"\\u003cb\\u003e\",\n  \"n\": 1\n}"},
+	{name: "no html escape", url: "/", opts: WriteJSONOptions{DisableHTMLEscape: true}, status: http.StatusOK, contentType: "application/json", body: `{"html":"<b>","n":1}`},
+	{name: "jsonp", url: "/?callback=app.load_1", opts: WriteJSONOptions{JSONPParam: "callback"}, status: http.StatusOK, contentType: "application/javascript", body: `/**/app.load_1({"html":"\u003cb\u003e","n":1});`},
+	{name: "jsonp without callback", url: "/", opts: WriteJSONOptions{JSONPParam: "callback"}, status: http.StatusOK, contentType: "application/json", body: `{"html":"\u003cb\u003e","n":1}`},
+	{name: "jsonp param not enabled", url: "/?callback=cb", status: http.StatusOK, contentType: "application/json", body: `{"html":"\u003cb\u003e","n":1}`},
+	{name: "invalid callback", url: "/?callback=alert(1)//", opts: WriteJSONOptions{JSONPParam: "callback"}, status: http.StatusBadRequest, contentType: "application/json"},
+}
+
+func TestTools_WriteJSONWithOptions(t *testing.T) {
+	var testTools Tools
+
+	data := map[string]interface{}{"html": "<b>", "n": 1}
+
+	for _, e := range writeJSONOptionsTests {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, e.url, nil)
+
+		err := testTools.WriteJSONWithOptions(rr, req, http.StatusOK, data, e.opts)
+
+		if e.status == http.StatusBadRequest {
+			if !errors.Is(err, ErrInvalidCallback) {
+				t.Errorf("%s: expected ErrInvalidCallback, got %v", e.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+		}
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, rr.Code)
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != e.contentType {
+			t.Errorf("%s: expected content type %s, got %s", e.name, e.contentType, ct)
+		}
+		if e.body != "" && rr.Body.String() != e.body {
+			t.Errorf("%s: expected body %s, got %s", e.name, e.body, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_WriteJSONWithOptionsVersioned(t *testing.T) {
+	testTools := Tools{Serializers: &VersionedSerializers{}, Codecs: newTestCodec()}
+	RegisterSerializer(testTools.Serializers, "v2", func(u versionTestUser) interface{} {
+		return map[string]interface{}{"id": u.ID, "name": u.FirstName + " " + u.LastName}
+	})
+
+	handler := testTools.APIVersionMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = testTools.WriteJSONWithOptions(w, r, http.StatusOK, JSONResponse{Data: versionTestUser{ID: 1, FirstName: "Ann", LastName: "Lee"}})
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v2/users", nil))
+	if !sameJSON(rr.Body.Bytes(), `{"ok":true,"status":200,"result":{"id":1,"name":"Ann Lee"}}`) {
+		t.Errorf("expected the serializer and codec applied, got %s", rr.Body.String())
+	}
+}
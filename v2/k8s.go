@@ -0,0 +1,369 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// serviceAccountNamespaceFile holds the pod's namespace in pods with a service account token mounted.
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// PodInfo describes the Kubernetes pod the process runs in, as exposed by the downward API. It is empty outside
+// Kubernetes.
+// Fields:
+// - Name: The pod's name, from POD_NAME, else HOSTNAME, which Kubernetes sets to the pod's name.
+// - Namespace: The pod's namespace, from POD_NAMESPACE, else the service account's namespace file.
+// - Node: The node's name, from NODE_NAME.
+// - IP: The pod's IP address, from POD_IP.
+// - ServiceAccount: The pod's service account, from POD_SERVICE_ACCOUNT.
+// - Labels: The pod's labels, from the "labels" file of a downward API volume.
+// - Annotations: The pod's annotations, from the "annotations" file of a downward API volume.
+type PodInfo struct {
+	Name           string
+	Namespace      string
+	Node           string
+	IP             string
+	ServiceAccount string
+	Labels         map[string]string
+	Annotations    map[string]string
+}
+
+// InKubernetes reports whether the process runs in a Kubernetes pod, from the KUBERNETES_SERVICE_HOST variable
+// Kubernetes sets in every container.
+func InKubernetes() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// LoadPodInfo reads the pod's metadata from the environment variables and files the downward API provides. Expose
+// them in the pod spec, for example:
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//	volumes:
+//	- name: podinfo
+//	  downwardAPI:
+//	    items:
+//	    - {path: labels, fieldRef: {fieldPath: metadata.labels}}
+//	    - {path: annotations, fieldRef: {fieldPath: metadata.annotations}}
+//
+// Outside Kubernetes, the result is empty. Missing variables and files leave their fields empty.
+// Parameters:
+// - dir: Optional directory the downward API volume is mounted at. Defaults to "/etc/podinfo". Only the first
+// value is used if multiple are provided.
+// Returns the pod's metadata.
+func LoadPodInfo(dir ...string) PodInfo {
+	if !InKubernetes() {
+		return PodInfo{}
+	}
+
+	volume := "/etc/podinfo"
+	if len(dir) > 0 && dir[0] != "" {
+		volume = dir[0]
+	}
+
+	p := PodInfo{
+		Name:           os.Getenv("POD_NAME"),
+		Namespace:      os.Getenv("POD_NAMESPACE"),
+		Node:           os.Getenv("NODE_NAME"),
+		IP:             os.Getenv("POD_IP"),
+		ServiceAccount: os.Getenv("POD_SERVICE_ACCOUNT"),
+		Labels:         readDownwardMap(filepath.Join(volume, "labels")),
+		Annotations:    readDownwardMap(filepath.Join(volume, "annotations")),
+	}
+	if p.Name == "" {
+		p.Name = os.Getenv("HOSTNAME")
+	}
+	if p.Namespace == "" {
+		if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			p.Namespace = strings.TrimSpace(string(data))
+		}
+	}
+
+	return p
+}
+
+// readDownwardMap reads a downward API file of labels or annotations, one key="value" per line, with the value
+// quoted as in Go. It returns nil if the file is missing, and skips lines it cannot parse.
+func readDownwardMap(name string) map[string]string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil
+	}
+
+	m := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		key, quoted, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			continue
+		}
+		m[key] = value
+	}
+
+	return m
+}
+
+// Tags returns the pod's identity as tags named after the OpenTelemetry conventions, e.g. "k8s.pod.name", for
+// error reports such as HTTPErrorReporter.Tags and trace resources. Empty fields are left out.
+func (p PodInfo) Tags() map[string]string {
+	tags := make(map[string]string)
+	for key, value := range map[string]string{
+		"k8s.pod.name":       p.Name,
+		"k8s.namespace.name": p.Namespace,
+		"k8s.node.name":      p.Node,
+		"k8s.pod.ip":         p.IP,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+
+	return tags
+}
+
+// LogHandler returns h with the pod's Tags added to every record, so logs collected from many pods can be told
+// apart:
+//
+//	pod := toolkit.LoadPodInfo()
+//	slog.SetDefault(slog.New(pod.LogHandler(slog.NewJSONHandler(os.Stdout, nil))))
+func (p PodInfo) LogHandler(h slog.Handler) slog.Handler {
+	tags := p.Tags()
+	if len(tags) == 0 {
+		return h
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.String(key, tags[key]))
+	}
+
+	return h.WithAttrs(attrs)
+}
+
+// ShutdownContext returns a copy of ctx that is cancelled when the process receives SIGTERM, which Kubernetes
+// sends to stop a pod, or an interrupt, for Serve:
+//
+//	ctx, stop := toolkit.ShutdownContext(context.Background())
+//	defer stop()
+//	err := tools.Serve(ctx, mux, toolkit.ServeOptions{Probes: probes})
+//
+// Call stop to release the signal handler; a second signal then ends the process immediately.
+func ShutdownContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
+// HealthCheck checks a dependency or internal state, returning an error if it is unhealthy.
+type HealthCheck func(ctx context.Context) error
+
+// ErrDraining is reported by readiness probes once Probes.Drain has been called.
+var ErrDraining = errors.New("draining")
+
+// Probes serves the liveness and readiness probes of Kubernetes from health checks. Liveness checks should only
+// fail when restarting the container would help, e.g. a deadlock; readiness checks cover dependencies such as the
+// database, so a pod that cannot reach them stops receiving traffic without being restarted. Once Drain is called,
+// e.g. by Serve when shutting down or by PreStopHandler, readiness fails so the pod is removed from its Services.
+// Create it with NewProbes.
+// Fields:
+// - Timeout: How long each check may take. Defaults to 5 seconds.
+type Probes struct {
+	Timeout time.Duration
+
+	mu        sync.RWMutex
+	liveness  map[string]HealthCheck
+	readiness map[string]HealthCheck
+	draining  atomic.Bool
+}
+
+// NewProbes creates a Probes without checks, whose probes succeed until checks are added.
+func NewProbes() *Probes {
+	return &Probes{
+		liveness:  make(map[string]HealthCheck),
+		readiness: make(map[string]HealthCheck),
+	}
+}
+
+// AddLivenessCheck adds a check to the liveness probe, replacing any check of the same name.
+func (p *Probes) AddLivenessCheck(name string, check HealthCheck) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.liveness[name] = check
+}
+
+// AddReadinessCheck adds a check to the readiness probe, replacing any check of the same name.
+func (p *Probes) AddReadinessCheck(name string, check HealthCheck) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.readiness[name] = check
+}
+
+// Drain makes the readiness probe fail from now on, so Kubernetes stops routing requests to the pod.
+func (p *Probes) Drain() {
+	p.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called.
+func (p *Probes) Draining() bool {
+	return p.draining.Load()
+}
+
+// ProbeResult is the answer of a probe.
+// Fields:
+// - Status: "ok", "failing" or "draining".
+// - Checks: The result of each check: "ok" or its error's message.
+type ProbeResult struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// run runs checks concurrently, each within the timeout.
+func (p *Probes) run(ctx context.Context, checks map[string]HealthCheck) ProbeResult {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	p.mu.RLock()
+	names := make([]string, 0, len(checks))
+	fns := make([]HealthCheck, 0, len(checks))
+	for name, check := range checks {
+		names = append(names, name)
+		fns = append(fns, check)
+	}
+	p.mu.RUnlock()
+
+	errs := make([]error, len(fns))
+	var wg sync.WaitGroup
+	for i, check := range fns {
+		wg.Add(1)
+		go func(i int, check HealthCheck) {
+			defer wg.Done()
+			defer func() {
+				if v := recover(); v != nil {
+					errs[i] = errors.New("check panicked")
+				}
+			}()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			errs[i] = check(checkCtx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	result := ProbeResult{Status: "ok"}
+	if len(names) > 0 {
+		result.Checks = make(map[string]string, len(names))
+	}
+	for i, name := range names {
+		result.Checks[name] = "ok"
+		if errs[i] != nil {
+			result.Checks[name] = errs[i].Error()
+			result.Status = "failing"
+		}
+	}
+
+	return result
+}
+
+// Live runs the liveness checks.
+func (p *Probes) Live(ctx context.Context) ProbeResult {
+	return p.run(ctx, p.liveness)
+}
+
+// Ready runs the readiness checks. It reports "draining" without running them once Drain has been called.
+func (p *Probes) Ready(ctx context.Context) ProbeResult {
+	if p.Draining() {
+		return ProbeResult{Status: "draining"}
+	}
+
+	return p.run(ctx, p.readiness)
+}
+
+// LivenessHandler serves the liveness probe, e.g. mux.Handle("/livez", probes.LivenessHandler()). It answers
+// 200 OK while every liveness check passes, and 503 Service Unavailable otherwise, with the ProbeResult as JSON.
+// Returns the handler.
+func (p *Probes) LivenessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeProbeResult(w, p.Live(r.Context()))
+	}
+}
+
+// ReadinessHandler serves the readiness probe, e.g. mux.Handle("/readyz", probes.ReadinessHandler()). It answers
+// 200 OK while every readiness check passes, and 503 Service Unavailable otherwise or once draining, with the
+// ProbeResult as JSON.
+// Returns the handler.
+func (p *Probes) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeProbeResult(w, p.Ready(r.Context()))
+	}
+}
+
+// PreStopHandler serves a preStop hook: it calls Drain, then waits for delay before answering, so Kubernetes has
+// removed the pod from its Services by the time it sends SIGTERM. Use it with an httpGet preStop hook, within the
+// pod's terminationGracePeriodSeconds:
+//
+//	lifecycle:
+//	  preStop:
+//	    httpGet: {path: /prestop, port: 8080}
+//
+// Parameters:
+// - delay: How long to wait, e.g. 5 seconds.
+// Returns the handler.
+func (p *Probes) PreStopHandler(delay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.Drain()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// writeProbeResult writes a probe's result, with 503 Service Unavailable unless it is ok.
+func writeProbeResult(w http.ResponseWriter, result ProbeResult) {
+	status := http.StatusOK
+	if result.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+
+	var t Tools
+	w.Header().Set("Cache-Control", "no-store")
+	_ = t.WriteJSON(w, status, result)
+}
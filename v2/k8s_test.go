@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLoadPodInfo(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if p := LoadPodInfo(); p.Name != "" || p.Labels != nil {
+		t.Errorf("expected no pod outside Kubernetes, got %+v", p)
+	}
+
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"api\"\ntier=\"web \\\"blue\\\"\"\nbroken\n"), 0o644)
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.96.0.1")
+	t.Setenv("POD_NAME", "")
+	t.Setenv("HOSTNAME", "api-7d9f-x2x")
+	t.Setenv("POD_NAMESPACE", "shop")
+	t.Setenv("NODE_NAME", "node-3")
+	t.Setenv("POD_IP", "10.1.2.3")
+
+	p := LoadPodInfo(dir)
+	if p.Name != "api-7d9f-x2x" || p.Namespace != "shop" || p.Node != "node-3" || p.IP != "10.1.2.3" {
+		t.Errorf("expected the pod from the environment, got %+v", p)
+	}
+	if len(p.Labels) != 2 || p.Labels["app"] != "api" || p.Labels["tier"] != `web "blue"` {
+		t.Errorf("expected the labels from the downward API volume, got %v", p.Labels)
+	}
+	if p.Annotations != nil {
+		t.Errorf("expected no annotations without their file, got %v", p.Annotations)
+	}
+}
+
+func TestPodInfo_LogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	p := PodInfo{Name: "api-1", Namespace: "shop"}
+	slog.New(p.LogHandler(slog.NewJSONHandler(&buf, nil))).Info("hello")
+
+	var entry map[string]interface{}
+	_ = json.Unmarshal(buf.Bytes(), &entry)
+	if entry["k8s.pod.name"] != "api-1" || entry["k8s.namespace.name"] != "shop" || entry["k8s.node.name"] != nil {
+		t.Errorf("expected the pod's tags in the log, got %s", buf.String())
+	}
+
+	h := slog.NewTextHandler(&buf, nil)
+	if (PodInfo{}).LogHandler(h) != h {
+		t.Error("expected an empty pod to leave the handler unchanged")
+	}
+}
+
+func TestProbes(t *testing.T) {
+	probes := NewProbes()
+	probes.Timeout = 50 * time.Millisecond
+
+	var dbErr error
+	probes.AddLivenessCheck("loop", func(context.Context) error { return nil })
+	probes.AddReadinessCheck("db", func(context.Context) error { return dbErr })
+	probes.AddReadinessCheck("slow", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	probe := func(h http.Handler) (int, ProbeResult) {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		var result ProbeResult
+		_ = json.Unmarshal(rr.Body.Bytes(), &result)
+		return rr.Code, result
+	}
+
+	if code, result := probe(probes.LivenessHandler()); code != http.StatusOK || result.Checks["loop"] != "ok" {
+		t.Errorf("expected a live pod, got %d %+v", code, result)
+	}
+
+	code, result := probe(probes.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || result.Status != "failing" || result.Checks["db"] != "ok" || result.Checks["slow"] != context.DeadlineExceeded.Error() {
+		t.Errorf("expected a timed out check to fail readiness, got %d %+v", code, result)
+	}
+
+	probes.AddReadinessCheck("slow", func(context.Context) error { return nil })
+	dbErr = errors.New("connection refused")
+	if _, result := probe(probes.ReadinessHandler()); result.Checks["db"] != "connection refused" {
+		t.Errorf("expected the failing check's error, got %+v", result)
+	}
+
+	dbErr = nil
+	if code, _ := probe(probes.ReadinessHandler()); code != http.StatusOK {
+		t.Errorf("expected a ready pod, got %d", code)
+	}
+
+	probes.Drain()
+	if code, result := probe(probes.ReadinessHandler()); code != http.StatusServiceUnavailable || result.Status != "draining" {
+		t.Errorf("expected a draining pod not ready, got %d %+v", code, result)
+	}
+	if code, _ := probe(probes.LivenessHandler()); code != http.StatusOK {
+		t.Errorf("expected a draining pod still live, got %d", code)
+	}
+}
+
+func TestProbes_PreStopHandler(t *testing.T) {
+	probes := NewProbes()
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	probes.PreStopHandler(30*time.Millisecond).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+
+	if rr.Code != http.StatusOK || time.Since(start) < 30*time.Millisecond || !probes.Draining() {
+		t.Errorf("expected the hook to drain and wait, got %d after %v", rr.Code, time.Since(start))
+	}
+}
+
+func TestTools_ServeDrainsProbes(t *testing.T) {
+	var testTools Tools
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "127.0.0.1:" + strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	probes := NewProbes()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- testTools.Serve(ctx, probes.ReadinessHandler(), ServeOptions{Addr: addr, Probes: probes, DrainDelay: 300 * time.Millisecond})
+	}()
+
+	ready := func() int {
+		resp, err := http.Get("http://" + addr)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ready() != http.StatusOK && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected the server to keep serving a failing readiness probe while draining, got %d", code)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected a graceful shutdown, got %v", err)
+	}
+}
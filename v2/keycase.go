@@ -0,0 +1,419 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// KeyCase is a convention for the casing of JSON keys.
+type KeyCase string
+
+// The key casings supported by ConvertKeyCase and KeyCasingMiddleware.
+const (
+	KeyCaseSnake  KeyCase = "snake"  // user_id
+	KeyCaseCamel  KeyCase = "camel"  // userId
+	KeyCasePascal KeyCase = "pascal" // UserId
+	KeyCaseKebab  KeyCase = "kebab"  // user-id
+)
+
+// valid reports whether c is a supported casing.
+func (c KeyCase) valid() bool {
+	switch c {
+	case KeyCaseSnake, KeyCaseCamel, KeyCasePascal, KeyCaseKebab:
+		return true
+	}
+
+	return false
+}
+
+// ConvertKeyCase converts a key to another casing. Words are split at underscores, hyphens and changes of case,
+// keeping acronyms together, so "userID", "user_id" and "UserId" all give "user_id" in snake case. Leading
+// underscores are kept, and keys with characters other than ASCII letters, digits, underscores and hyphens, such
+// as "$ref" or "@type", are returned unchanged.
+// Parameters:
+// - key: The key, e.g. "createdAt".
+// - to: The casing to convert to.
+// Returns the converted key, e.g. "created_at".
+func ConvertKeyCase(key string, to KeyCase) string {
+	rest := strings.TrimLeft(key, "_")
+	prefix := key[:len(key)-len(rest)]
+
+	words := keyWords(rest)
+	if words == nil {
+		return key
+	}
+
+	for i, w := range words {
+		switch {
+		case to == KeyCasePascal || to == KeyCaseCamel && i > 0:
+			words[i] = strings.ToUpper(w[:1]) + strings.ToLower(w[1:])
+		default:
+			words[i] = strings.ToLower(w)
+		}
+	}
+
+	switch to {
+	case KeyCaseSnake:
+		return prefix + strings.Join(words, "_")
+	case KeyCaseKebab:
+		return prefix + strings.Join(words, "-")
+	case KeyCaseCamel, KeyCasePascal:
+		return prefix + strings.Join(words, "")
+	}
+
+	return key
+}
+
+// keyWords splits a key into words, or returns nil if it has characters that are not part of a casing convention.
+func keyWords(key string) []string {
+	var words []string
+	runes := []rune(key)
+	start := 0
+
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case r > unicode.MaxASCII || !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			return nil
+		case i > start && unicode.IsUpper(r):
+			prev := runes[i-1]
+			acronymEnd := unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || acronymEnd {
+				words = append(words, string(runes[start:i]))
+				start = i
+			}
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+
+	return words
+}
+
+// rewriteJSONKeys converts the object keys of a JSON document, keeping its values and the order of its keys.
+// The values of keys in preserve, in either casing, are copied unchanged.
+func rewriteJSONKeys(data []byte, to KeyCase, preserve map[string]bool) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var out, scratch bytes.Buffer
+	enc := json.NewEncoder(&scratch)
+	enc.SetEscapeHTML(false)
+	writeString := func(s string) {
+		scratch.Reset()
+		_ = enc.Encode(s)
+		out.Write(bytes.TrimSuffix(scratch.Bytes(), []byte("\n")))
+	}
+
+	// each open object or array, with the number of its members written and, for objects, whether a key is next
+	type container struct {
+		object  bool
+		members int
+		key     bool
+	}
+	var stack []*container
+	documents := 0
+
+	beforeValue := func() {
+		if len(stack) == 0 {
+			if documents > 0 {
+				out.WriteByte('\n')
+			}
+			return
+		}
+		if top := stack[len(stack)-1]; !top.object && top.members > 0 {
+			out.WriteByte(',')
+		}
+	}
+	afterValue := func() {
+		if len(stack) == 0 {
+			documents++
+			return
+		}
+		top := stack[len(stack)-1]
+		top.members++
+		top.key = top.object
+	}
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && len(stack) == 0 {
+			break
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// an object key: convert it, and copy the value of preserved keys as it is
+		if key, ok := tok.(string); ok && len(stack) > 0 && stack[len(stack)-1].key {
+			top := stack[len(stack)-1]
+			if top.members > 0 {
+				out.WriteByte(',')
+			}
+
+			converted := ConvertKeyCase(key, to)
+			writeString(converted)
+			out.WriteByte(':')
+			top.key = false
+
+			if preserve[key] || preserve[converted] {
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return nil, err
+				}
+				if err := json.Compact(&out, raw); err != nil {
+					return nil, err
+				}
+				afterValue()
+			}
+			continue
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			switch v {
+			case '{', '[':
+				beforeValue()
+				out.WriteByte(byte(v))
+				stack = append(stack, &container{object: v == '{', key: v == '{'})
+			default:
+				out.WriteByte(byte(v))
+				stack = stack[:len(stack)-1]
+				afterValue()
+			}
+		case string:
+			beforeValue()
+			writeString(v)
+			afterValue()
+		case json.Number:
+			beforeValue()
+			out.WriteString(v.String())
+			afterValue()
+		case bool:
+			beforeValue()
+			out.WriteString(strconv.FormatBool(v))
+			afterValue()
+		case nil:
+			beforeValue()
+			out.WriteString("null")
+			afterValue()
+		}
+	}
+
+	return out.Bytes(), nil
+}
+
+// isJSONMediaType reports whether a Content-Type is JSON, e.g. "application/json" or "application/problem+json".
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// KeyCasingOptions configures KeyCasingMiddleware.
+// Fields:
+// - Server: The casing of the keys handlers read and write, that is of the Go struct tags. Defaults to
+// KeyCaseSnake.
+// - Client: The casing clients use. Defaults to KeyCaseCamel.
+// - Header: If set, a request header with which clients choose their casing, e.g. "Key-Case: snake" for legacy
+// clients. Unknown values are ignored.
+// - Preserve: Keys whose values are copied unchanged, in either casing, e.g. "metadata" holding keys chosen by
+// users rather than by the API.
+type KeyCasingOptions struct {
+	Server   KeyCase
+	Client   KeyCase
+	Header   string
+	Preserve []string
+}
+
+// KeyCasingMiddleware converts the keys of JSON bodies between the client's casing and the server's, so handlers
+// written against one convention serve clients using another: request bodies are converted to the server's
+// casing before the handler reads them, and JSON responses to the client's casing. Only keys are converted, never
+// values. Apply it per route to give routes different conventions:
+//
+//	camel := tools.KeyCasingMiddleware(toolkit.KeyCasingOptions{Client: toolkit.KeyCaseCamel, Header: "Key-Case"})
+//	mux.Handle("/v2/users", camel(usersHandler))
+//
+// Responses are buffered to be converted. Request bodies larger than Tools.MaxJSONSize (1 MB by default) and
+// bodies that are not valid JSON are passed on unchanged, for ReadJSON to reject.
+// Parameters:
+// - opts: Optional KeyCasingOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) KeyCasingMiddleware(opts ...KeyCasingOptions) func(http.Handler) http.Handler {
+	var o KeyCasingOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if !o.Server.valid() {
+		o.Server = KeyCaseSnake
+	}
+	if !o.Client.valid() {
+		o.Client = KeyCaseCamel
+	}
+
+	preserve := make(map[string]bool, len(o.Preserve))
+	for _, key := range o.Preserve {
+		preserve[key] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := o.Client
+			if o.Header != "" {
+				w.Header().Add("Vary", o.Header)
+				if c := KeyCase(strings.ToLower(strings.TrimSpace(r.Header.Get(o.Header)))); c.valid() {
+					client = c
+				}
+			}
+
+			if client == o.Server {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody && isJSONMediaType(r.Header.Get("Content-Type")) {
+				r = t.convertRequestKeys(r, o.Server, preserve)
+			}
+
+			cw := &casingWriter{ResponseWriter: w, to: client, preserve: preserve}
+			next.ServeHTTP(cw, r)
+			cw.finish()
+		})
+	}
+}
+
+// convertRequestKeys returns r with its JSON body's keys converted, or unchanged if the body is too large or not
+// valid JSON.
+func (t *Tools) convertRequestKeys(r *http.Request, to KeyCase, preserve map[string]bool) *http.Request {
+	maxBytes := 1024 * 1024
+	if t.MaxJSONSize != 0 {
+		maxBytes = t.MaxJSONSize
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, int64(maxBytes)+1))
+	if err != nil || len(body) > maxBytes {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return r
+	}
+
+	converted, err := rewriteJSONKeys(body, to, preserve)
+	if err != nil {
+		converted = body
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.Body = io.NopCloser(bytes.NewReader(converted))
+	r2.ContentLength = int64(len(converted))
+	r2.Header.Set("Content-Length", strconv.Itoa(len(converted)))
+
+	return r2
+}
+
+// readCloser reads from one reader and closes another.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// casingWriter buffers JSON responses to convert their keys, and passes other responses through.
+type casingWriter struct {
+	http.ResponseWriter
+	to       KeyCase
+	preserve map[string]bool
+
+	status      int
+	wroteHeader bool
+	buffering   bool
+	body        bytes.Buffer
+}
+
+// WriteHeader decides from the Content-Type whether the response is buffered.
+func (cw *casingWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	// informational responses, such as 103 Early Hints, go out as they are
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	cw.wroteHeader = true
+	cw.status = status
+	cw.buffering = isJSONMediaType(cw.Header().Get("Content-Type"))
+	if !cw.buffering {
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write buffers JSON bodies and writes others.
+func (cw *casingWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.buffering {
+		return cw.body.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// ReadFrom copies src, keeping the wrapped writer's sendfile path for responses that are not buffered.
+func (cw *casingWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.buffering {
+		return cw.body.ReadFrom(src)
+	}
+
+	return readFrom(cw.ResponseWriter, src)
+}
+
+// Flush implements http.Flusher for responses that are not buffered.
+func (cw *casingWriter) Flush() {
+	if cw.buffering {
+		return
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (cw *casingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// finish converts and sends a buffered response. Bodies that are not valid JSON are sent unchanged.
+func (cw *casingWriter) finish() {
+	if !cw.buffering {
+		return
+	}
+
+	body := cw.body.Bytes()
+	if converted, err := rewriteJSONKeys(body, cw.to, cw.preserve); err == nil {
+		body = converted
+	}
+
+	cw.Header().Del("Content-Length")
+	cw.ResponseWriter.WriteHeader(cw.status)
+	_, _ = cw.ResponseWriter.Write(body)
+}
@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConvertKeyCase(t *testing.T) {
+	tests := []struct {
+		key  string
+		to   KeyCase
+		want string
+	}{
+		{"user_id", KeyCaseCamel, "userId"},
+		{"userID", KeyCaseSnake, "user_id"},
+		{"HTTPServerURL", KeyCaseSnake, "http_server_url"},
+		{"HTTPServer", KeyCaseCamel, "httpServer"},
+		{"created_at", KeyCasePascal, "CreatedAt"},
+		{"createdAt", KeyCaseKebab, "created-at"},
+		{"address2", KeyCaseCamel, "address2"},
+		{"line2Text", KeyCaseSnake, "line2_text"},
+		{"_links", KeyCaseCamel, "_links"},
+		{"_self_url", KeyCaseCamel, "_selfUrl"},
+		{"$ref", KeyCaseSnake, "$ref"},
+		{"a.b", KeyCaseCamel, "a.b"},
+		{"café_au_lait", KeyCaseCamel, "café_au_lait"},
+		{"", KeyCaseCamel, ""},
+		{"user_id", KeyCase("shouting"), "user_id"},
+	}
+
+	for _, e := range tests {
+		if got := ConvertKeyCase(e.key, e.to); got != e.want {
+			t.Errorf("%q to %s: expected %q, got %q", e.key, e.to, e.want, got)
+		}
+	}
+}
+
+func TestRewriteJSONKeys(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+		preserve       map[string]bool
+	}{
+		{"nested", `{"user_id": 1, "home_address": {"zip_code": "<12>"}, "tags": ["a_b", {"is_new": true}], "deleted_at": null}`,
+			`{"userId":1,"homeAddress":{"zipCode":"<12>"},"tags":["a_b",{"isNew":true}],"deletedAt":null}`, nil},
+		{"order and numbers kept", `{"z_last": 12345678901234567890, "a_first": 1.50}`, `{"zLast":12345678901234567890,"aFirst":1.50}`, nil},
+		{"preserved", `{"meta_data": {"user_key": [1, 2]}, "other_key": {"inner_key": 1}}`, `{"metaData":{"user_key":[1,2]},"otherKey":{"innerKey":1}}`, map[string]bool{"metaData": true}},
+		{"top-level array", `[{"a_b": 1}, {"c_d": 2}]`, `[{"aB":1},{"cD":2}]`, nil},
+		{"scalar", `"snake_value"`, `"snake_value"`, nil},
+		{"empty containers", `{"empty_object": {}, "empty_array": []}`, `{"emptyObject":{},"emptyArray":[]}`, nil},
+	}
+
+	for _, e := range tests {
+		got, err := rewriteJSONKeys([]byte(e.in), KeyCaseCamel, e.preserve)
+		if err != nil || string(got) != e.want {
+			t.Errorf("%s: expected %s, got %s (%v)", e.name, e.want, got, err)
+		}
+	}
+
+	if _, err := rewriteJSONKeys([]byte(`{"a": `), KeyCaseCamel, nil); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestTools_KeyCasingMiddleware(t *testing.T) {
+	var testTools Tools
+
+	type profile struct {
+		UserID    int    `json:"user_id"`
+		FirstName string `json:"first_name"`
+	}
+
+	h := testTools.KeyCasingMiddleware(KeyCasingOptions{Header: "Key-Case", Preserve: []string{"extra_fields"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(`{"user_id": 1}`))
+			return
+		}
+
+		var p profile
+		if err := testTools.ReadJSON(w, r, &p); err != nil {
+			_ = testTools.ErrorJSON(w, err)
+			return
+		}
+		_ = testTools.WriteJSON(w, http.StatusCreated, map[string]interface{}{"profile": p, "extra_fields": map[string]int{"some_key": 1}})
+	}))
+
+	tests := []struct {
+		name, target, keyCase, body string
+		status                      int
+		want                        string
+	}{
+		{"camel client", "/", "", `{"userId": 7, "firstName": "Ada"}`, http.StatusCreated, `{"extraFields":{"some_key":1},"profile":{"userId":7,"firstName":"Ada"}}`},
+		{"legacy snake client", "/", "snake", `{"user_id": 7, "first_name": "Ada"}`, http.StatusCreated, `{"extra_fields":{"some_key":1},"profile":{"user_id":7,"first_name":"Ada"}}`},
+		{"pascal client", "/", "Pascal", `{"UserId": 7, "FirstName": "Ada"}`, http.StatusCreated, `{"ExtraFields":{"some_key":1},"Profile":{"UserId":7,"FirstName":"Ada"}}`},
+		{"unknown casing", "/", "yelling", `{"userId": 7}`, http.StatusCreated, `{"extraFields":{"some_key":1},"profile":{"userId":7,"firstName":""}}`},
+		{"invalid body", "/", "", `{"userId": `, http.StatusBadRequest, `{"error":true,"message":"request body contains badly-formed JSON"`},
+		{"not JSON", "/text", "", `{}`, http.StatusOK, `{"user_id": 1}`},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodPost, e.target, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		if e.keyCase != "" {
+			req.Header.Set("Key-Case", e.keyCase)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if rr.Code != e.status || !strings.HasPrefix(rr.Body.String(), e.want) {
+			t.Errorf("%s: expected %d %s, got %d %s", e.name, e.status, e.want, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Vary") != "Key-Case" {
+			t.Errorf("%s: expected Vary: Key-Case, got %q", e.name, rr.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestTools_KeyCasingMiddlewareLargeBody(t *testing.T) {
+	testTools := Tools{MaxJSONSize: 16}
+
+	var got []byte
+	h := testTools.KeyCasingMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = io.ReadAll(r.Body)
+	}))
+
+	body := `{"userId": "0123456789abcdef"}`
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if string(got) != body {
+		t.Errorf("expected a body over MaxJSONSize passed on unchanged, got %s", got)
+	}
+}
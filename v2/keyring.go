@@ -0,0 +1,221 @@
+package toolkit
+
+import (
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownKey is returned by Keyring operations naming a key that is not on the keyring.
+var ErrUnknownKey = errors.New("unknown key")
+
+// Key is a secret on a Keyring.
+// Fields:
+// - ID: Identifies the key in ciphertexts and signatures, e.g. "2024-06". Up to 64 letters, digits, '-' or '_'.
+// - Secret: The key, 16, 24 or 32 random bytes. It is used for both AES-GCM and HMAC-SHA256.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// Keyring holds an active key, which encrypts and signs, and older keys, which only decrypt and verify, so keys
+// can be rotated without breaking existing data, cookies or tokens. The key ID is embedded in every ciphertext and
+// signature, so the right key is found without trying them all. Data without a key ID, produced by Encrypt or
+// signed with a plain secret before the keyring was adopted, is still accepted by trying each key.
+type Keyring struct {
+	mu     sync.RWMutex
+	active string
+	keys   map[string][]byte
+}
+
+// NewKeyring returns a keyring.
+// Parameters:
+// - active: The key encrypting and signing new data.
+// - old: Retired keys, kept to decrypt and verify existing data.
+// Returns the keyring, or an error if a key is invalid or an ID is used twice.
+func NewKeyring(active Key, old ...Key) (*Keyring, error) {
+	kr := &Keyring{keys: make(map[string][]byte)}
+
+	for _, k := range append([]Key{active}, old...) {
+		if err := kr.add(k); err != nil {
+			return nil, err
+		}
+	}
+	kr.active = active.ID
+
+	return kr, nil
+}
+
+// add validates a key and adds it.
+func (kr *Keyring) add(k Key) error {
+	if len(k.ID) == 0 || len(k.ID) > 64 {
+		return fmt.Errorf("keyring: key ID %q must be 1 to 64 characters", k.ID)
+	}
+	for _, c := range k.ID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("keyring: invalid key ID %q", k.ID)
+		}
+	}
+	if _, err := aes.NewCipher(k.Secret); err != nil {
+		return fmt.Errorf("keyring: key %q: %w", k.ID, err)
+	}
+	if _, ok := kr.keys[k.ID]; ok {
+		return fmt.Errorf("keyring: duplicate key ID %q", k.ID)
+	}
+
+	kr.keys[k.ID] = append([]byte(nil), k.Secret...)
+
+	return nil
+}
+
+// ActiveID returns the ID of the active key.
+func (kr *Keyring) ActiveID() string {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.active
+}
+
+// Rotate makes a new key active. The previous active key is kept to decrypt and verify existing data.
+// Parameters:
+// - k: The new key.
+// Returns an error if the key is invalid or its ID is already on the keyring.
+func (kr *Keyring) Rotate(k Key) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if err := kr.add(k); err != nil {
+		return err
+	}
+	kr.active = k.ID
+
+	return nil
+}
+
+// Retire removes an old key once no data depends on it any more, e.g. after re-encrypting it.
+// Parameters:
+// - id: The key's ID.
+// Returns an error wrapping ErrUnknownKey if the key is not on the keyring, or an error for the active key.
+func (kr *Keyring) Retire(id string) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	if _, ok := kr.keys[id]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	if id == kr.active {
+		return fmt.Errorf("keyring: cannot retire the active key %q", id)
+	}
+	delete(kr.keys, id)
+
+	return nil
+}
+
+// Encrypt encrypts plaintext with the active key using AES-GCM.
+// Parameters:
+// - plaintext: The data to encrypt.
+// Returns the key ID followed by the ciphertext.
+func (kr *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	id, key := kr.activeKey()
+
+	ciphertext, err := Encrypt(key, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keyHeader(id), ciphertext...), nil
+}
+
+// Decrypt decrypts a ciphertext produced by Encrypt with any key on the keyring, or by the package-level Encrypt
+// with one of the keys.
+// Parameters:
+// - ciphertext: The data to decrypt.
+// Returns the plaintext, or an error wrapping ErrDecrypt.
+func (kr *Keyring) Decrypt(ciphertext []byte) ([]byte, error) {
+	if key, body, ok := kr.lookup(ciphertext); ok {
+		if plaintext, err := Decrypt(key, body); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	for _, key := range kr.allKeys() {
+		if plaintext, err := Decrypt(key, ciphertext); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: no key on the keyring decrypts the data", ErrDecrypt)
+}
+
+// Sign returns the HMAC-SHA256 of data with the active key, prefixed with the key ID.
+func (kr *Keyring) Sign(data []byte) []byte {
+	id, key := kr.activeKey()
+
+	return append(keyHeader(id), hmacSHA256(key, data)...)
+}
+
+// Verify reports whether sig is a signature of data by Sign with any key on the keyring, or a plain HMAC-SHA256
+// with one of the keys.
+func (kr *Keyring) Verify(data, sig []byte) bool {
+	if key, mac, ok := kr.lookup(sig); ok && hmac.Equal(mac, hmacSHA256(key, data)) {
+		return true
+	}
+
+	for _, key := range kr.allKeys() {
+		if hmac.Equal(sig, hmacSHA256(key, data)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// activeKey returns the active key and its ID.
+func (kr *Keyring) activeKey() (string, []byte) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	return kr.active, kr.keys[kr.active]
+}
+
+// allKeys returns every key.
+func (kr *Keyring) allKeys() [][]byte {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+
+	keys := make([][]byte, 0, len(kr.keys))
+	for _, k := range kr.keys {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// lookup splits the key ID header off data and returns the key it names.
+func (kr *Keyring) lookup(data []byte) ([]byte, []byte, bool) {
+	if len(data) == 0 || int(data[0]) == 0 || len(data) < 1+int(data[0]) {
+		return nil, nil, false
+	}
+
+	kr.mu.RLock()
+	key, ok := kr.keys[string(data[1:1+int(data[0])])]
+	kr.mu.RUnlock()
+
+	return key, data[1+int(data[0]):], ok
+}
+
+// keyHeader returns the length-prefixed key ID put in front of ciphertexts and signatures.
+func keyHeader(id string) []byte {
+	return append([]byte{byte(len(id))}, id...)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data.
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+
+	return mac.Sum(nil)
+}
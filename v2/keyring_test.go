@@ -0,0 +1,136 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestKeyring(t *testing.T) *Keyring {
+	kr, err := NewKeyring(Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return kr
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	kr := newTestKeyring(t)
+
+	old, _ := kr.Encrypt([]byte("before"))
+	oldSig := kr.Sign([]byte("data"))
+	legacy, _ := Encrypt(bytes.Repeat([]byte{1}, 32), []byte("legacy"))
+
+	if err := kr.Rotate(Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if kr.ActiveID() != "k2" {
+		t.Errorf("expected k2 to be active, got %s", kr.ActiveID())
+	}
+
+	fresh, _ := kr.Encrypt([]byte("after"))
+	if !bytes.HasPrefix(fresh, []byte("\x02k2")) {
+		t.Errorf("expected the key ID in the ciphertext, got %q", fresh[:3])
+	}
+
+	for in, want := range map[string]string{string(old): "before", string(fresh): "after", string(legacy): "legacy"} {
+		got, err := kr.Decrypt([]byte(in))
+		if err != nil || string(got) != want {
+			t.Errorf("expected %q, got %q, %v", want, got, err)
+		}
+	}
+
+	if !kr.Verify([]byte("data"), oldSig) || !kr.Verify([]byte("data"), kr.Sign([]byte("data"))) {
+		t.Error("expected signatures of both keys to verify")
+	}
+	if kr.Verify([]byte("other"), oldSig) {
+		t.Error("expected a signature of other data to fail")
+	}
+
+	if err := kr.Retire("k2"); err == nil {
+		t.Error("expected retiring the active key to fail")
+	}
+	if err := kr.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Decrypt(old); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("expected ErrDecrypt after retiring the key, got %v", err)
+	}
+	if err := kr.Retire("k1"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestNewKeyring_Invalid(t *testing.T) {
+	for _, keys := range [][]Key{
+		{{ID: "", Secret: make([]byte, 32)}},
+		{{ID: "a.b", Secret: make([]byte, 32)}},
+		{{ID: "k", Secret: make([]byte, 7)}},
+		{{ID: "k", Secret: make([]byte, 32)}, {ID: "k", Secret: make([]byte, 16)}},
+	} {
+		if _, err := NewKeyring(keys[0], keys[1:]...); err == nil {
+			t.Errorf("expected an error for %v", keys)
+		}
+	}
+}
+
+func TestSignedCookieWithKeyring(t *testing.T) {
+	kr := newTestKeyring(t)
+
+	rr := httptest.NewRecorder()
+	SetSignedCookie(rr, &http.Cookie{Name: "legacy", Value: "a"}, bytes.Repeat([]byte{1}, 32))
+	SetSignedCookieWithKeyring(rr, &http.Cookie{Name: "prefs", Value: "b"}, kr)
+
+	_ = kr.Rotate(Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range rr.Result().Cookies() {
+		req.AddCookie(c)
+	}
+
+	if v, err := SignedCookieValueWithKeyring(req, "legacy", kr); err != nil || v != "a" {
+		t.Errorf("expected the legacy cookie to verify, got %q, %v", v, err)
+	}
+	if v, err := SignedCookieValueWithKeyring(req, "prefs", kr); err != nil || v != "b" {
+		t.Errorf("expected the cookie to survive rotation, got %q, %v", v, err)
+	}
+}
+
+func TestVerificationTokens_Keyring(t *testing.T) {
+	kr := newTestKeyring(t)
+	tokens := &VerificationTokens{Keyring: kr}
+
+	token, err := tokens.Generate("reset", "ann", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = kr.Rotate(Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)})
+	if _, err := tokens.Validate(context.Background(), token, "reset"); err != nil {
+		t.Errorf("expected the token to survive rotation, got %v", err)
+	}
+
+	_ = kr.Retire("k1")
+	if _, err := tokens.Validate(context.Background(), token, "reset"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid after retiring the key, got %v", err)
+	}
+}
+
+func TestEncryptedFields_Keyring(t *testing.T) {
+	kr := newTestKeyring(t)
+	SetEncryptionKeyring(kr)
+	defer SetEncryptionKeyring(nil)
+
+	value, _ := EncryptedString("123-45-6789").Value()
+	_ = kr.Rotate(Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)})
+
+	var s EncryptedString
+	if err := s.Scan(value); err != nil || s != "123-45-6789" {
+		t.Errorf("expected the value to survive rotation, got %q, %v", s, err)
+	}
+}
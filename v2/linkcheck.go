@@ -0,0 +1,456 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LinkCheckOptions configures CheckLinks.
+// Fields:
+// - MaxPages: The maximum number of internal pages crawled. Defaults to 500.
+// - Concurrency: The number of requests made in parallel. Defaults to 4.
+// - Timeout: The time limit of each request. Defaults to 10 seconds.
+// - UserAgent: The User-Agent header sent, also used to pick the robots.txt group. Defaults to "toolkit-link-checker/1.0".
+// - CheckExternal: Also verifies links to other hosts. They are checked but never crawled.
+// - IgnoreRobots: Crawls paths disallowed by robots.txt instead of skipping them.
+// - AllowPrivateNetworks: Disables SSRF protection, e.g. to check a site running on localhost.
+type LinkCheckOptions struct {
+	MaxPages             int
+	Concurrency          int
+	Timeout              time.Duration
+	UserAgent            string
+	CheckExternal        bool
+	IgnoreRobots         bool
+	AllowPrivateNetworks bool
+}
+
+// BrokenLink is a link that could not be fetched or returned an error status.
+// Fields:
+// - URL: The absolute URL of the link.
+// - Status: The HTTP status code, or 0 if the request failed.
+// - Error: The request error, if any.
+// - Sources: The pages linking to the URL (at most 10), empty for URLs found through the sitemap.
+type BrokenLink struct {
+	URL     string   `json:"url"`
+	Status  int      `json:"status,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Sources []string `json:"sources,omitempty"`
+}
+
+// LinkCheckResult is the report produced by CheckLinks.
+// Fields:
+// - PagesCrawled: The number of internal HTML pages fetched and scanned for links.
+// - LinksChecked: The number of distinct URLs checked, pages included.
+// - Broken: The broken links, sorted by URL.
+// - Skipped: The internal URLs not checked because robots.txt disallows them, sorted.
+type LinkCheckResult struct {
+	PagesCrawled int          `json:"pages_crawled"`
+	LinksChecked int          `json:"links_checked"`
+	Broken       []BrokenLink `json:"broken"`
+	Skipped      []string     `json:"skipped,omitempty"`
+}
+
+// linkAttributes lists, per tag, the attribute holding a URL to check.
+var linkAttributes = map[string]string{
+	"a": "href", "link": "href", "img": "src", "script": "src", "source": "src", "iframe": "src", "video": "src", "audio": "src",
+}
+
+var sitemapLocRegex = regexp.MustCompile(`(?is)<loc>\s*(.*?)\s*</loc>`)
+
+// linkChecker holds the state of one CheckLinks run.
+type linkChecker struct {
+	opts   LinkCheckOptions
+	base   *url.URL
+	client *http.Client
+	robots *robotsRules
+
+	wg      sync.WaitGroup
+	sem     chan struct{}
+	mu      sync.Mutex
+	seen    map[string]bool
+	sources map[string][]string
+	pages   int
+	result  LinkCheckResult
+}
+
+// CheckLinks crawls the internal pages of a site, starting from baseURL and every URL listed in its sitemaps,
+// and verifies each link and asset URL found. robots.txt is respected unless IgnoreRobots is set. Outbound
+// requests use the same SSRF protection as ScrapeMeta.
+// Parameters:
+// - ctx: The context bounding the whole crawl.
+// - baseURL: The site root, e.g. "https://example.com/".
+// - opts: Optional LinkCheckOptions. Only the first value is used if multiple are provided.
+// Returns the report, or an error if baseURL is invalid. Broken links are reported in the result, not as errors.
+func (t *Tools) CheckLinks(ctx context.Context, baseURL string, opts ...LinkCheckOptions) (*LinkCheckResult, error) {
+	var o LinkCheckOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxPages <= 0 {
+		o.MaxPages = 500
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = "toolkit-link-checker/1.0"
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: only absolute http and https URLs are allowed", baseURL)
+	}
+	if base.Path == "" {
+		base.Path = "/"
+	}
+
+	c := &linkChecker{
+		opts:    o,
+		base:    base,
+		client:  newOutboundClient(o.AllowPrivateNetworks),
+		sem:     make(chan struct{}, o.Concurrency),
+		seen:    make(map[string]bool),
+		sources: make(map[string][]string),
+		result:  LinkCheckResult{Broken: []BrokenLink{}},
+	}
+
+	robotsBody, _ := c.fetchText(ctx, base.ResolveReference(&url.URL{Path: "/robots.txt"}).String())
+	if !o.IgnoreRobots {
+		c.robots = parseRobots(robotsBody, o.UserAgent)
+	}
+
+	sitemaps := []string{base.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+	for _, line := range strings.Split(robotsBody, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			sitemaps = append(sitemaps, strings.TrimSpace(value))
+		}
+	}
+
+	c.enqueue(ctx, base.String(), "")
+	for _, loc := range c.sitemapURLs(ctx, sitemaps) {
+		c.enqueue(ctx, loc, "")
+	}
+
+	c.wg.Wait()
+
+	res := c.result
+	for i := range res.Broken {
+		res.Broken[i].Sources = c.sources[res.Broken[i].URL]
+	}
+	sort.Slice(res.Broken, func(i, j int) bool { return res.Broken[i].URL < res.Broken[j].URL })
+	sort.Strings(res.Skipped)
+
+	return &res, nil
+}
+
+// sitemapURLs returns the page URLs listed in the given sitemaps, following sitemap indexes one level deep.
+func (c *linkChecker) sitemapURLs(ctx context.Context, sitemaps []string) []string {
+	var urls []string
+	visited := make(map[string]bool)
+
+	for depth := 0; depth < 2 && len(sitemaps) > 0; depth++ {
+		var nested []string
+
+		for _, sm := range sitemaps {
+			if visited[sm] {
+				continue
+			}
+			visited[sm] = true
+
+			body, err := c.fetchText(ctx, sm)
+			if err != nil {
+				continue
+			}
+
+			isIndex := strings.Contains(body, "<sitemapindex")
+			for _, m := range sitemapLocRegex.FindAllStringSubmatch(body, -1) {
+				if isIndex {
+					nested = append(nested, m[1])
+				} else {
+					urls = append(urls, m[1])
+				}
+			}
+		}
+
+		sitemaps = nested
+	}
+
+	return urls
+}
+
+// enqueue schedules rawURL for checking unless it was already seen, recording source as a referrer.
+func (c *linkChecker) enqueue(ctx context.Context, rawURL, source string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+	u.Fragment = ""
+	key := u.String()
+
+	internal := u.Host == c.base.Host && u.Scheme == c.base.Scheme
+
+	c.mu.Lock()
+	if source != "" && len(c.sources[key]) < 10 {
+		c.sources[key] = append(c.sources[key], source)
+	}
+	if c.seen[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.seen[key] = true
+
+	if !internal && !c.opts.CheckExternal {
+		c.mu.Unlock()
+		return
+	}
+	if internal && c.robots != nil && !c.robots.allowed(u.RequestURI()) {
+		c.result.Skipped = append(c.result.Skipped, key)
+		c.mu.Unlock()
+		return
+	}
+
+	crawl := internal && c.pages < c.opts.MaxPages && strings.HasPrefix(u.Path, c.base.Path)
+	if crawl {
+		c.pages++
+	}
+	c.result.LinksChecked++
+	c.mu.Unlock()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		select {
+		case c.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-c.sem }()
+
+		c.check(ctx, u, crawl)
+	}()
+}
+
+// check fetches u, recording it as broken on failure and, for crawled HTML pages, enqueueing their links.
+func (c *linkChecker) check(ctx context.Context, u *url.URL, crawl bool) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	method := http.MethodGet
+	if !crawl {
+		method = http.MethodHead
+	}
+
+	res, err := c.request(reqCtx, method, u.String())
+	if err == nil && !crawl && (res.StatusCode == http.StatusMethodNotAllowed || res.StatusCode == http.StatusNotImplemented) {
+		res.Body.Close()
+		res, err = c.request(reqCtx, http.MethodGet, u.String())
+	}
+
+	if err != nil {
+		c.broken(BrokenLink{URL: u.String(), Error: err.Error()})
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 400 {
+		c.broken(BrokenLink{URL: u.String(), Status: res.StatusCode})
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if !crawl || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return
+	}
+
+	// redirects may leave the site; only scan pages that are still internal
+	final := res.Request.URL
+	if final.Host != c.base.Host {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 5<<20))
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.result.PagesCrawled++
+	c.mu.Unlock()
+
+	doc := string(body)
+	base := final
+	for _, tag := range scanHTMLTags(doc, "base") {
+		if href := resolveURL(final, tag.Attrs["href"]); href != "" {
+			base, _ = url.Parse(href)
+		}
+	}
+
+	for _, tag := range scanHTMLTags(doc) {
+		attr, ok := linkAttributes[tag.Name]
+		if !ok {
+			continue
+		}
+
+		if tag.Name == "link" && !linkRelChecked(tag.Attrs["rel"]) {
+			continue
+		}
+
+		if ref := resolveURL(base, tag.Attrs[attr]); ref != "" {
+			c.enqueue(ctx, ref, u.String())
+		}
+	}
+}
+
+// linkRelChecked reports whether a <link> with the given rel points at a resource worth checking, leaving out
+// hints such as preconnect and dns-prefetch whose targets are origins rather than resources.
+func linkRelChecked(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		switch r {
+		case "stylesheet", "icon", "apple-touch-icon", "manifest", "canonical", "alternate", "preload":
+			return true
+		}
+	}
+
+	return false
+}
+
+// request performs a request with the checker's client and User-Agent.
+func (c *linkChecker) request(ctx context.Context, method, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+
+	return c.client.Do(req)
+}
+
+// fetchText returns the body of a successful GET request to rawURL.
+func (c *linkChecker) fetchText(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+
+	res, err := c.request(ctx, http.MethodGet, rawURL)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching %s", res.StatusCode, rawURL)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+
+	return string(body), err
+}
+
+// broken records a broken link.
+func (c *linkChecker) broken(link BrokenLink) {
+	c.mu.Lock()
+	c.result.Broken = append(c.result.Broken, link)
+	c.mu.Unlock()
+}
+
+// robotsRule is an Allow or Disallow line of robots.txt.
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// robotsRules are the rules of robots.txt that apply to one user agent.
+type robotsRules struct {
+	rules []robotsRule
+}
+
+// parseRobots extracts the rules of the group matching userAgent from a robots.txt body, falling back to the
+// "*" group, following RFC 9309.
+func parseRobots(body, userAgent string) *robotsRules {
+	token := strings.ToLower(userAgent)
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+
+	groups := make(map[string][]robotsRule)
+	var agents []string
+	inRules := false
+
+	sc := bufio.NewScanner(strings.NewReader(body))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+			for _, a := range agents {
+				if _, ok := groups[a]; !ok {
+					groups[a] = nil
+				}
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+
+			expr := regexp.QuoteMeta(value)
+			expr = strings.ReplaceAll(expr, `\*`, ".*")
+			if strings.HasSuffix(expr, `\$`) {
+				expr = strings.TrimSuffix(expr, `\$`) + "$"
+			}
+
+			rule := robotsRule{allow: key == "allow", length: len(value), pattern: regexp.MustCompile("^" + expr)}
+			for _, a := range agents {
+				groups[a] = append(groups[a], rule)
+			}
+		}
+	}
+
+	if rules, ok := groups[token]; ok {
+		return &robotsRules{rules: rules}
+	}
+
+	return &robotsRules{rules: groups["*"]}
+}
+
+// allowed reports whether path may be crawled: the longest matching rule wins, and Allow wins ties.
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best, allow = rule.length, rule.allow
+		}
+	}
+
+	return allow
+}
@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTools_CheckLinks(t *testing.T) {
+	pages := map[string]string{
+		"/robots.txt":  "User-agent: *\nDisallow: /private/\nAllow: /private/ok\n",
+		"/sitemap.xml": "", // written by the handler, as it needs the server URL
+		"/": `<html><head><link rel="stylesheet" href="/style.css"><link rel="preconnect" href="https://cdn.invalid"></head>
+			<body><a href="/about#team">About</a> <a href="/missing">Missing</a> <a href="/private/secret">Secret</a>
+			<a href="/private/ok">OK</a> <a href="mailto:me@example.com">Mail</a> <img src="img/logo.png"></body></html>`,
+		"/about":      `<a href="/">Home</a> <a href="/missing">Missing again</a> <a href="https://external.invalid/">Out</a>`,
+		"/orphan":     `<a href="/gone">Gone</a>`,
+		"/private/ok": `<p>allowed</p>`,
+		"/style.css":  `body {}`,
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/private/secret" {
+			t.Error("expected disallowed path not to be fetched")
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Path == "/style.css" {
+			w.Header().Set("Content-Type", "text/css")
+		} else if r.URL.Path != "/robots.txt" && r.URL.Path != "/sitemap.xml" {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		if r.URL.Path == "/sitemap.xml" {
+			body = `<?xml version="1.0"?><urlset><url><loc>` + srv.URL + `/orphan</loc></url></urlset>`
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	var testTools Tools
+
+	res, err := testTools.CheckLinks(context.Background(), srv.URL, LinkCheckOptions{AllowPrivateNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var broken []string
+	for _, b := range res.Broken {
+		broken = append(broken, b.URL)
+		if b.Status != http.StatusNotFound {
+			t.Errorf("%s: expected status 404, got %d", b.URL, b.Status)
+		}
+	}
+
+	expected := []string{srv.URL + "/gone", srv.URL + "/img/logo.png", srv.URL + "/missing"}
+	if !reflect.DeepEqual(broken, expected) {
+		t.Errorf("expected broken links %v, got %v", expected, broken)
+	}
+
+	if len(res.Broken) == 3 && len(res.Broken[2].Sources) != 2 {
+		t.Errorf("expected /missing to have two sources, got %v", res.Broken[2].Sources)
+	}
+
+	if !reflect.DeepEqual(res.Skipped, []string{srv.URL + "/private/secret"}) {
+		t.Errorf("expected disallowed path to be skipped, got %v", res.Skipped)
+	}
+
+	// /, /about, /orphan and /private/ok are HTML pages
+	if res.PagesCrawled != 4 {
+		t.Errorf("expected 4 pages crawled, got %d", res.PagesCrawled)
+	}
+
+	if _, err := testTools.CheckLinks(context.Background(), "ftp://example.com"); err == nil {
+		t.Error("expected error for invalid URL")
+	}
+}
+
+func TestTools_CheckLinksBlocksPrivateNetworks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	var testTools Tools
+
+	res, err := testTools.CheckLinks(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Broken) != 1 || res.Broken[0].Error == "" {
+		t.Errorf("expected the loopback site to be refused, got %+v", res.Broken)
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	body := "User-agent: toolkit-link-checker\nDisallow: /tmp\n\nUser-agent: *\nDisallow: /\nAllow: /$\nDisallow: /*.pdf$\n"
+
+	rules := parseRobots(body, "toolkit-link-checker/1.0")
+	if rules.allowed("/tmp/x") || !rules.allowed("/docs") {
+		t.Error("expected the specific group to apply")
+	}
+
+	rules = parseRobots(body, "other")
+	if !rules.allowed("/") || rules.allowed("/docs") {
+		t.Error("expected the wildcard group to apply")
+	}
+}
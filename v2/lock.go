@@ -0,0 +1,389 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrLockHeld is returned when a lock is already held by another owner.
+var ErrLockHeld = errors.New("lock is held by another owner")
+
+// Locker is a backend for distributed locks. Each acquisition is identified by a token, so only the holder
+// can renew or release it.
+type Locker interface {
+	// Acquire tries to take the lock for ttl, returning a token and true on success, or false if it is held.
+	Acquire(ctx context.Context, name string, ttl time.Duration) (string, bool, error)
+	// Renew extends the lock to ttl if it is still held by token, returning false if it was lost.
+	Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error)
+	// Release frees the lock if it is still held by token.
+	Release(ctx context.Context, name, token string) error
+}
+
+// RedisLocker is a Locker backed by Redis, suitable for multi-replica deployments.
+type RedisLocker struct {
+	Client *RedisClient
+	Prefix string
+}
+
+// Acquire tries to take the lock for ttl.
+func (l *RedisLocker) Acquire(ctx context.Context, name string, ttl time.Duration) (string, bool, error) {
+	return l.Client.Lock(ctx, l.Prefix+"lock:"+name, ttl)
+}
+
+// Renew extends the lock to ttl if it is still held by token.
+func (l *RedisLocker) Renew(ctx context.Context, name, token string, ttl time.Duration) (bool, error) {
+	return l.Client.RenewLock(ctx, l.Prefix+"lock:"+name, token, ttl)
+}
+
+// Release frees the lock if it is still held by token.
+func (l *RedisLocker) Release(ctx context.Context, name, token string) error {
+	_, err := l.Client.Unlock(ctx, l.Prefix+"lock:"+name, token)
+	return err
+}
+
+// FileLocker is a Locker using lock files in a directory, suitable for replicas sharing a volume.
+// Expired lock files are taken over, so the clocks of the replicas must be roughly in sync. Each lock file is only
+// read and changed while holding a flock (LockFileEx on Windows) on a ".guard" file next to it, so an expired lock
+// is taken over by a single replica; the volume must support those locks, as local file systems and NFS do. On
+// other platforms, FileLocker only coordinates the goroutines of one process.
+type FileLocker struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+type fileLockContent struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Acquire tries to take the lock for ttl.
+func (l *FileLocker) Acquire(_ context.Context, name string, ttl time.Duration) (string, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return "", false, err
+	}
+
+	token, err := newLockToken()
+	if err != nil {
+		return "", false, err
+	}
+
+	unlock, err := l.guard(name)
+	if err != nil {
+		return "", false, err
+	}
+	defer unlock()
+
+	path := l.path(name)
+	data, _ := json.Marshal(fileLockContent{Token: token, ExpiresAt: time.Now().Add(ttl)})
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return "", false, err
+			}
+			return token, true, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return "", false, err
+		}
+
+		current, err := readFileLock(path)
+		if err == nil && time.Now().Before(current.ExpiresAt) {
+			return "", false, nil
+		}
+
+		// the lock expired, or its file is unreadable garbage left by a crash
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", false, err
+		}
+	}
+
+	return "", false, nil
+}
+
+// Renew extends the lock to ttl if it is still held by token.
+func (l *FileLocker) Renew(_ context.Context, name, token string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := l.guard(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	path := l.path(name)
+
+	current, err := readFileLock(path)
+	if err != nil || current.Token != token {
+		return false, nil
+	}
+
+	data, _ := json.Marshal(fileLockContent{Token: token, ExpiresAt: time.Now().Add(ttl)})
+
+	tmp := path + "." + token + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return false, err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release frees the lock if it is still held by token.
+func (l *FileLocker) Release(_ context.Context, name, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := l.guard(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := l.path(name)
+
+	current, err := readFileLock(path)
+	if err != nil || current.Token != token {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// guard takes the lock serializing the changes to the lock file of name across processes, returning a function
+// freeing it. The guard file is kept: removing it would let another process lock a file no longer in the directory.
+func (l *FileLocker) guard(name string) (func(), error) {
+	f, err := os.OpenFile(l.path(name)+".guard", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// path returns the lock file path for name.
+func (l *FileLocker) path(name string) string {
+	return filepath.Join(l.Dir, lockFileName(name)+".lock")
+}
+
+// lockFileName turns an arbitrary lock name into a safe file name.
+func lockFileName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// readFileLock reads and decodes a lock file.
+func readFileLock(path string) (fileLockContent, error) {
+	var content fileLockContent
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return content, err
+	}
+
+	err = json.Unmarshal(data, &content)
+
+	return content, err
+}
+
+// newLockToken returns a random lock token.
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Lock is a held distributed lock. It is renewed in the background until released.
+type Lock struct {
+	name   string
+	token  string
+	locker Locker
+	cancel context.CancelFunc
+	done   chan struct{}
+	lost   chan struct{}
+	once   sync.Once
+}
+
+// Lost returns a channel closed when the lock could not be renewed, meaning another owner may now hold it.
+// Work protected by the lock should stop when this happens.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops the renewal and frees the lock.
+// Parameters:
+// - ctx: The context passed to the backend.
+// Returns an error from the backend, if any.
+func (l *Lock) Release(ctx context.Context) error {
+	var err error
+
+	l.once.Do(func() {
+		l.cancel()
+		<-l.done
+		err = l.locker.Release(ctx, l.name, l.token)
+	})
+
+	return err
+}
+
+// minLockTTL is the shortest ttl accepted by Lock, the precision of Redis expiries.
+const minLockTTL = time.Millisecond
+
+// Lock acquires the named distributed lock using the Locker field of Tools, renewing it every third of ttl
+// until it is released. Without a configured Locker, a FileLocker in the system temporary directory is used,
+// which only coordinates processes on the same machine.
+// Parameters:
+// - ctx: The context passed to the backend for the acquisition.
+// - name: The lock name, e.g. the name of a scheduled job.
+// - ttl: How long the lock survives without renewal, bounding the outage if the holder crashes. At least 1ms.
+// Returns the held lock, ErrLockHeld if another owner holds it, or an error from the backend or for a shorter ttl.
+func (t *Tools) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	if ttl < minLockTTL {
+		return nil, fmt.Errorf("lock: ttl must be at least %v, got %v", minLockTTL, ttl)
+	}
+
+	locker := t.locker()
+
+	token, ok, err := locker.Acquire(ctx, name, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	renewCtx, cancel := context.WithCancel(context.Background())
+	l := &Lock{name: name, token: token, locker: locker, cancel: cancel, done: make(chan struct{}), lost: make(chan struct{})}
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				ok, err := locker.Renew(renewCtx, name, token, ttl)
+				if renewCtx.Err() != nil {
+					return
+				}
+				if err != nil || !ok {
+					close(l.lost)
+					return
+				}
+			}
+		}
+	}()
+
+	return l, nil
+}
+
+// RunAsLeader runs fn whenever this process holds the named lock, giving leader election among replicas.
+// Followers retry acquiring the lock every ttl; the leader's fn receives a context canceled when the lock is lost
+// or ctx ends. When fn returns, the lock is released and the election starts over.
+// Parameters:
+// - ctx: The context bounding the whole election loop.
+// - name: The lock name identifying the election.
+// - ttl: The lock ttl and the retry interval of followers. At least 1ms.
+// - fn: The work to do while leader.
+// Returns ctx.Err() once ctx is done, or an error for a shorter ttl.
+func (t *Tools) RunAsLeader(ctx context.Context, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	if ttl < minLockTTL {
+		return fmt.Errorf("lock: ttl must be at least %v, got %v", minLockTTL, ttl)
+	}
+
+	for {
+		l, err := t.Lock(ctx, name, ttl)
+		if err == nil {
+			leaderCtx, cancel := context.WithCancel(ctx)
+			go func() {
+				select {
+				case <-l.Lost():
+					cancel()
+				case <-leaderCtx.Done():
+				}
+			}()
+
+			_ = fn(leaderCtx)
+			cancel()
+			_ = l.Release(context.Background())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ttl):
+		}
+	}
+}
+
+var (
+	defaultLockerOnce sync.Once
+	defaultLocker     Locker
+)
+
+// locker returns the configured Locker or the process-wide default FileLocker.
+func (t *Tools) locker() Locker {
+	if t.Locker != nil {
+		return t.Locker
+	}
+
+	defaultLockerOnce.Do(func() {
+		defaultLocker = &FileLocker{Dir: filepath.Join(os.TempDir(), "toolkit-locks")}
+	})
+
+	return defaultLocker
+}
@@ -0,0 +1,24 @@
+//go:build linux || darwin || freebsd
+
+package toolkit
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on f shared by every process of the machine, or of an NFS volume, waiting for
+// it if it is held. The lock is freed by unlockFile, or when the process exits.
+func lockFile(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile frees the lock taken by lockFile.
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,15 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package toolkit
+
+import "os"
+
+// lockFile does nothing on this platform, where FileLocker only coordinates the goroutines of one process.
+func lockFile(*os.File) error {
+	return nil
+}
+
+// unlockFile does nothing on this platform.
+func unlockFile(*os.File) error {
+	return nil
+}
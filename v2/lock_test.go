@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_LockFile(t *testing.T) {
+	testTools := Tools{Locker: &FileLocker{Dir: t.TempDir()}}
+	ctx := context.Background()
+
+	l, err := testTools.Lock(ctx, "nightly-report", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testTools.Lock(ctx, "nightly-report", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected ErrLockHeld, got %v", err)
+	}
+
+	if err := l.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = testTools.Lock(ctx, "nightly-report", time.Minute)
+	if err != nil {
+		t.Errorf("expected lock to be free after release, got %v", err)
+	} else {
+		_ = l.Release(ctx)
+	}
+}
+
+func TestFileLocker_TakesOverExpiredLock(t *testing.T) {
+	dir := t.TempDir()
+	locker := &FileLocker{Dir: dir}
+	ctx := context.Background()
+
+	if _, ok, _ := locker.Acquire(ctx, "job", time.Millisecond); !ok {
+		t.Fatal("expected first acquisition to succeed")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok, err := locker.Acquire(ctx, "job", time.Minute); !ok || err != nil {
+		t.Errorf("expected expired lock to be taken over, got %v (%v)", ok, err)
+	}
+
+	_ = os.WriteFile(filepath.Join(dir, "garbage.lock"), []byte("not json"), 0644)
+	if _, ok, _ := locker.Acquire(ctx, "garbage", time.Minute); !ok {
+		t.Error("expected unreadable lock file to be taken over")
+	}
+}
+
+func TestFileLocker_SingleTakeoverAcrossLockers(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	for round := 0; round < 50; round++ {
+		if _, ok, _ := (&FileLocker{Dir: dir}).Acquire(ctx, "job", -time.Second); !ok {
+			t.Fatal("expected an expired lock to be taken over")
+		}
+
+		// separate lockers share no mutex, as replicas would not
+		var wins int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if _, ok, err := (&FileLocker{Dir: dir}).Acquire(ctx, "job", time.Minute); ok && err == nil {
+					atomic.AddInt32(&wins, 1)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if wins != 1 {
+			t.Fatalf("round %d: expected the expired lock taken over once, got %d", round, wins)
+		}
+		_ = os.Remove(filepath.Join(dir, "job.lock"))
+	}
+}
+
+func TestTools_LockInvalidTTL(t *testing.T) {
+	testTools := Tools{Locker: &FileLocker{Dir: t.TempDir()}}
+
+	for _, ttl := range []time.Duration{0, -time.Second, 2 * time.Nanosecond} {
+		if _, err := testTools.Lock(context.Background(), "job", ttl); err == nil {
+			t.Errorf("expected an error for a ttl of %v", ttl)
+		}
+		if err := testTools.RunAsLeader(context.Background(), "job", ttl, nil); err == nil {
+			t.Errorf("expected RunAsLeader to refuse a ttl of %v", ttl)
+		}
+	}
+}
+
+func TestTools_LockRenewal(t *testing.T) {
+	testTools := Tools{Locker: &RedisLocker{Client: newFakeRedis(t)}}
+	ctx := context.Background()
+
+	l, err := testTools.Lock(ctx, "job", 60*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Release(ctx)
+
+	time.Sleep(150 * time.Millisecond)
+
+	select {
+	case <-l.Lost():
+		t.Fatal("expected lock to be renewed")
+	default:
+	}
+
+	if _, err := testTools.Lock(ctx, "job", time.Minute); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected renewed lock to still be held, got %v", err)
+	}
+}
+
+func TestTools_RunAsLeader(t *testing.T) {
+	testTools := Tools{Locker: &FileLocker{Dir: t.TempDir()}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var leaders, running int32
+	for i := 0; i < 3; i++ {
+		go func() {
+			_ = testTools.RunAsLeader(ctx, "election", time.Second, func(ctx context.Context) error {
+				atomic.AddInt32(&leaders, 1)
+				if atomic.AddInt32(&running, 1) > 1 {
+					t.Error("more than one leader running at once")
+				}
+				<-ctx.Done()
+				atomic.AddInt32(&running, -1)
+				return nil
+			})
+		}()
+	}
+
+	<-ctx.Done()
+	time.Sleep(20 * time.Millisecond)
+
+	if atomic.LoadInt32(&leaders) != 1 {
+		t.Errorf("expected exactly one leader, got %d", leaders)
+	}
+}
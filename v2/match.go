@@ -0,0 +1,280 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// FileMatcher matches slash-separated relative paths against glob patterns with the syntax of .gitignore files:
+//   - "*" matches anything but "/", "?" one character but "/", and "[a-z]" a character class ("[!a-z]" negates it).
+//   - "**" matches any number of directories: "**/logs", "logs/**" and "a/**/b".
+//   - A pattern without a "/", other than a trailing one, matches at any depth: "*.tmp" matches "a/b/c.tmp". A
+//     pattern with one is relative to the root, e.g. "/build" or "docs/*.md".
+//   - A trailing "/" only matches directories, e.g. "node_modules/".
+//   - A leading "!" re-includes what an earlier pattern matched. The last matching pattern wins.
+//   - Blank lines and lines starting with "#" are ignored; "\" escapes a special character.
+//
+// As in git, everything below a matched directory matches too, and cannot be re-included.
+type FileMatcher struct {
+	patterns []filePattern
+}
+
+// filePattern is a compiled pattern.
+type filePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// NewFileMatcher compiles patterns.
+// Returns the matcher, or an error naming the first invalid pattern.
+func NewFileMatcher(patterns ...string) (*FileMatcher, error) {
+	m := &FileMatcher{}
+	for _, p := range patterns {
+		fp, ok, err := compileFilePattern(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		if ok {
+			m.patterns = append(m.patterns, fp)
+		}
+	}
+
+	return m, nil
+}
+
+// LoadIgnoreFile compiles the patterns of an ignore file, such as a .gitignore, one per line. Ignore files in
+// subdirectories are not read.
+// Returns the matcher, or an error if the file cannot be read or has an invalid pattern.
+func LoadIgnoreFile(name string) (*FileMatcher, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		patterns = append(patterns, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewFileMatcher(patterns...)
+}
+
+// compileFilePattern compiles one line of an ignore file, reporting false for blank lines and comments.
+func compileFilePattern(p string) (filePattern, bool, error) {
+	var fp filePattern
+
+	p = strings.TrimSuffix(p, "\r")
+	if !strings.HasSuffix(p, `\ `) {
+		p = strings.TrimRight(p, " \t")
+	}
+	if p == "" || strings.HasPrefix(p, "#") {
+		return fp, false, nil
+	}
+	if strings.HasPrefix(p, "!") {
+		fp.negate, p = true, p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		fp.dirOnly, p = true, strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return fp, false, nil
+	}
+
+	var re strings.Builder
+	if strings.Contains(p, "/") {
+		re.WriteString("^")
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		re.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(p); i++ {
+		switch c := p[i]; {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**") && i+2 == len(p) && (i == 0 || p[i-1] == '/'):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '\\' && i+1 < len(p):
+			i++
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				return fp, false, fmt.Errorf("unterminated character class")
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			re.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+
+	var err error
+	fp.re, err = regexp.Compile(re.String())
+
+	return fp, true, err
+}
+
+// Match reports whether a path matches.
+// Parameters:
+// - name: The path, slash-separated and relative to the root the patterns apply to, e.g. "src/main.go". A
+// leading "./" or "/" is ignored.
+// - isDir: Whether the path is a directory, for patterns ending in "/".
+func (m *FileMatcher) Match(name string, isDir bool) bool {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return false
+	}
+
+	parts := strings.Split(name, "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if m.matchOne(strings.Join(parts[:i+1], "/"), isDir || !last) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchOne applies the patterns to one path, without looking at its parents.
+func (m *FileMatcher) matchOne(name string, isDir bool) bool {
+	matched := false
+	for _, p := range m.patterns {
+		if (!p.dirOnly || isDir) && matched == p.negate && p.re.MatchString(name) {
+			matched = !p.negate
+		}
+	}
+
+	return matched
+}
+
+// Match reports whether a path matches any of the patterns, as described for FileMatcher. Compile the patterns
+// once with NewFileMatcher to match many paths.
+// Parameters:
+// - patterns: The patterns, e.g. []string{"**/*.go", "!vendor/"}.
+// - name: The slash-separated relative path. A trailing "/" marks a directory.
+// Returns whether the path matches, or an error if a pattern is invalid.
+func (t *Tools) Match(patterns []string, name string) (bool, error) {
+	m, err := NewFileMatcher(patterns...)
+	if err != nil {
+		return false, err
+	}
+
+	return m.Match(name, strings.HasSuffix(name, "/")), nil
+}
+
+// FileFilter selects files by path, e.g. for ListFiles and ZipDir.
+// Fields:
+// - Include: If set, only files it matches are selected. Directories are not checked against it, so "**/*.go"
+// finds Go files at any depth.
+// - Exclude: If set, the files and directories it matches are left out, e.g. a matcher from LoadIgnoreFile.
+type FileFilter struct {
+	Include *FileMatcher
+	Exclude *FileMatcher
+}
+
+// Allows reports whether the filter selects a path, relative to the directory being filtered.
+func (f FileFilter) Allows(name string, isDir bool) bool {
+	if f.Exclude != nil && f.Exclude.Match(name, isDir) {
+		return false
+	}
+
+	return isDir || f.Include == nil || f.Include.Match(name, false)
+}
+
+// ZipDir returns an ExportFunc writing a zip archive of the regular files below a directory, with paths relative
+// to it. Symbolic links and other special files are skipped.
+// Parameters:
+// - dir: The directory.
+// - filter: An optional FileFilter selecting the files. Only the first filter is used if multiple are provided.
+// Returns the ExportFunc.
+func ZipDir(dir string, filter ...FileFilter) ExportFunc {
+	var f FileFilter
+	if len(filter) > 0 {
+		f = filter[0]
+	}
+
+	return func(ctx context.Context, w io.Writer) error {
+		zw := zip.NewWriter(w)
+
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(dir, p)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if !f.Allows(rel, d.IsDir()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			hdr, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			hdr.Name, hdr.Method = rel, zip.Deflate
+
+			fw, err := zw.CreateHeader(hdr)
+			if err != nil {
+				return err
+			}
+			src, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+
+			_, err = copyBuffered(fw, src)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return zw.Close()
+	}
+}
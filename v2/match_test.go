@@ -0,0 +1,197 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestFileMatcher_Match(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"basename at any depth", []string{"*.tmp"}, "a/b/c.tmp", false, true},
+		{"basename no match", []string{"*.tmp"}, "a/b/c.txt", false, false},
+		{"star stops at slash", []string{"docs/*.md"}, "docs/api/intro.md", false, false},
+		{"anchored", []string{"/build"}, "build/out.o", false, true},
+		{"anchored not nested", []string{"/build"}, "src/build", false, false},
+		{"middle slash anchors", []string{"docs/*.md"}, "src/docs/a.md", false, false},
+		{"leading doublestar", []string{"**/logs"}, "a/b/logs", true, true},
+		{"trailing doublestar", []string{"logs/**"}, "logs/x/y.log", false, true},
+		{"middle doublestar", []string{"a/**/b"}, "a/x/y/b", false, true},
+		{"middle doublestar zero dirs", []string{"a/**/b"}, "a/b", false, true},
+		{"doublestar extension", []string{"**/*.go"}, "cmd/tool/main.go", false, true},
+		{"question mark", []string{"file?.txt"}, "file1.txt", false, true},
+		{"character class", []string{"file[0-9].txt"}, "file7.txt", false, true},
+		{"negated class", []string{"file[!0-9].txt"}, "file7.txt", false, false},
+		{"dir only matches dir", []string{"node_modules/"}, "node_modules", true, true},
+		{"dir only skips file", []string{"node_modules/"}, "node_modules", false, false},
+		{"dir only matches contents", []string{"node_modules/"}, "web/node_modules/x/index.js", false, true},
+		{"negation", []string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{"last pattern wins", []string{"*.log", "!keep.log", "keep.log"}, "keep.log", false, true},
+		{"excluded parent", []string{"vendor/", "!vendor/keep.go"}, "vendor/keep.go", false, true},
+		{"comments and blanks", []string{"# *.go", "", "  "}, "main.go", false, false},
+		{"escaped bang", []string{`\!important`}, "!important", false, true},
+		{"escaped star", []string{`a\*`}, "ab", false, false},
+		{"dot slash prefix", []string{"/build"}, "./build", true, true},
+	}
+
+	for _, e := range tests {
+		m, err := NewFileMatcher(e.patterns...)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if got := m.Match(e.path, e.isDir); got != e.want {
+			t.Errorf("%s: expected %v for %q, got %v", e.name, e.want, e.path, got)
+		}
+	}
+}
+
+func TestFileMatcher_InvalidPattern(t *testing.T) {
+	if _, err := NewFileMatcher("ok", "file[0-9"); err == nil || !strings.Contains(err.Error(), "file[0-9") {
+		t.Errorf("expected an error naming the invalid pattern, got %v", err)
+	}
+}
+
+func TestTools_Match(t *testing.T) {
+	var testTools Tools
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"main.go", true},
+		{"vendor/", false},
+		{"vendor", true},
+		{"vendor/lib/lib.go", true},
+		{"README.md", false},
+	}
+
+	for _, e := range tests {
+		got, err := testTools.Match([]string{"**/*.go", "vendor", "!vendor/"}, e.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e.want {
+			t.Errorf("%s: expected %v, got %v", e.path, e.want, got)
+		}
+	}
+
+	if _, err := testTools.Match([]string{"[a"}, "a"); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestLoadIgnoreFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), ".gitignore")
+	_ = os.WriteFile(name, []byte("# build output\r\n/dist/\n*.log\n!important.log\n"), 0o644)
+
+	m, err := LoadIgnoreFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Match("dist", true) || !m.Match("server/debug.log", false) || m.Match("important.log", false) {
+		t.Error("expected the ignore file patterns to apply")
+	}
+
+	if _, err := LoadIgnoreFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+// matchTree creates a directory tree for the filter tests.
+func matchTree(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "README.md", "app.log", "cmd/tool/main.go", "vendor/lib/lib.go"} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0o755)
+		_ = os.WriteFile(p, []byte(name), 0o644)
+	}
+
+	return dir
+}
+
+func TestTools_ListFilesFilter(t *testing.T) {
+	var testTools Tools
+	dir := matchTree(t)
+
+	exclude, _ := NewFileMatcher("*.log", "vendor/")
+	include, _ := NewFileMatcher("*.go")
+
+	files, err := testTools.ListFiles(context.Background(), dir, FileFilter{Include: include, Exclude: exclude})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "cmd,main.go" {
+		t.Errorf("expected cmd and main.go, got %v", names)
+	}
+}
+
+func TestZipDir(t *testing.T) {
+	dir := matchTree(t)
+
+	tests := []struct {
+		name   string
+		filter []FileFilter
+		want   string
+	}{
+		{"everything", nil, "README.md,app.log,cmd/tool/main.go,main.go,vendor/lib/lib.go"},
+		{"filtered", []FileFilter{{
+			Include: mustFileMatcher(t, "**/*.go"),
+			Exclude: mustFileMatcher(t, "vendor/"),
+		}}, "cmd/tool/main.go,main.go"},
+	}
+
+	for _, e := range tests {
+		var buf bytes.Buffer
+		if err := ZipDir(dir, e.filter...)(context.Background(), &buf); err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		if got := strings.Join(names, ","); got != e.want {
+			t.Errorf("%s: expected %s, got %s", e.name, e.want, got)
+		}
+	}
+
+	if err := ZipDir(filepath.Join(dir, "missing"))(context.Background(), &bytes.Buffer{}); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
+
+func mustFileMatcher(t *testing.T, patterns ...string) *FileMatcher {
+	t.Helper()
+
+	m, err := NewFileMatcher(patterns...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
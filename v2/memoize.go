@@ -0,0 +1,220 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrCacheMiss is returned by a Cache when a key is not stored or has expired.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Cache stores byte values with an expiry. MemoryCache keeps them in the process, and RedisCache shares them
+// across replicas.
+type Cache interface {
+	// Get returns the value stored for key, or ErrCacheMiss.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value for key for the duration of ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the value stored for key.
+	Delete(ctx context.Context, key string) error
+}
+
+// MemoryCache is a Cache held in memory, suitable for a single instance and tests. The zero value is ready to use.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryCacheEntry
+}
+
+type memoryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// Get returns the value stored for key, or ErrCacheMiss.
+func (c *MemoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !time.Now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, ErrCacheMiss
+	}
+
+	return append([]byte(nil), e.value...), nil
+}
+
+// Set stores value for key for the duration of ttl.
+func (c *MemoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[string]memoryCacheEntry)
+	}
+
+	// drop expired entries, keeping memory bounded
+	if len(c.entries) > 10000 {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+
+	c.entries[key] = memoryCacheEntry{value: append([]byte(nil), value...), expiresAt: now.Add(ttl)}
+
+	return nil
+}
+
+// Delete removes the value stored for key.
+func (c *MemoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+
+	return nil
+}
+
+// RedisCache is a Cache backed by Redis, sharing cached values across replicas.
+type RedisCache struct {
+	Client *RedisClient
+	Prefix string
+}
+
+// Get returns the value stored for key, or ErrCacheMiss.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.Client.Get(ctx, c.Prefix+key)
+	if errors.Is(err, ErrRedisNil) {
+		return nil, ErrCacheMiss
+	}
+
+	return value, err
+}
+
+// Set stores value for key for the duration of ttl.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.Client.Set(ctx, c.Prefix+key, value, ttl)
+}
+
+// Delete removes the value stored for key.
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	_, err := c.Client.Del(ctx, c.Prefix+key)
+	return err
+}
+
+// MemoizeOptions configures Memoize.
+// Fields:
+// - Beta: How eagerly values are refreshed before they expire. Each read of a fresh value recomputes it early
+// with a probability that grows as expiry nears and with how long the loader took, so under load one caller
+// refreshes the value before the others would all miss at once. Defaults to 1; larger values refresh earlier,
+// and a negative value disables early refresh.
+// - StaleWhileRevalidate: How long an expired value may still be served. Callers receive it immediately while it
+// is refreshed in the background. Zero disables stale values.
+type MemoizeOptions struct {
+	Beta                 float64
+	StaleWhileRevalidate time.Duration
+}
+
+// memoEntry is a value stored by Memoize.
+type memoEntry struct {
+	Value   json.RawMessage `json:"v"`
+	Expires int64           `json:"e"`
+	Delta   int64           `json:"d"`
+}
+
+// Memoize returns the JSON encoding of a computed value, loading it at most once per ttl, e.g. for expensive
+// reports served by WriteJSON. Concurrent loads of a key in the process are coalesced with Singleflight, and
+// values are refreshed probabilistically before they expire, so a popular key never has every caller recompute
+// it at the same moment. Cache errors are not fatal: the value is loaded instead.
+// Parameters:
+// - ctx: The context for the cache and the loader. Background refreshes run without its cancellation.
+// - cache: Where values are stored, e.g. a *MemoryCache or *RedisCache.
+// - key: Identifies the value in the cache.
+// - ttl: How long a loaded value is fresh.
+// - loader: Computes the value, which is encoded as JSON.
+// - opts: Optional MemoizeOptions. Only the first value is used if multiple are provided.
+// Returns the JSON value, which can be passed to WriteJSON as is, or the loader's error.
+func (t *Tools) Memoize(ctx context.Context, cache Cache, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), opts ...MemoizeOptions) (json.RawMessage, error) {
+	var o MemoizeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Beta == 0 {
+		o.Beta = 1
+	}
+
+	load := func(ctx context.Context) (json.RawMessage, error) {
+		v, err, _ := t.Singleflight("memoize:"+key, func() (interface{}, error) {
+			start := time.Now()
+
+			v, err := loader(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+
+			now := time.Now()
+			data, err := json.Marshal(memoEntry{Value: value, Expires: now.Add(ttl).UnixNano(), Delta: int64(now.Sub(start))})
+			if err == nil {
+				_ = cache.Set(ctx, key, data, ttl+o.StaleWhileRevalidate)
+			}
+
+			return json.RawMessage(value), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return v.(json.RawMessage), nil
+	}
+
+	var entry memoEntry
+
+	data, err := cache.Get(ctx, key)
+	if err != nil || json.Unmarshal(data, &entry) != nil || entry.Value == nil {
+		return load(ctx)
+	}
+
+	now := time.Now().UnixNano()
+
+	if now < entry.Expires {
+		if o.Beta > 0 && shouldRefreshEarly(now, entry, o.Beta) {
+			return load(ctx)
+		}
+		return entry.Value, nil
+	}
+
+	if now < entry.Expires+int64(o.StaleWhileRevalidate) {
+		go func() {
+			_, _ = load(context.WithoutCancel(ctx))
+		}()
+		return entry.Value, nil
+	}
+
+	return load(ctx)
+}
+
+// shouldRefreshEarly implements probabilistic early expiration (XFetch): it reports true when
+// now - delta * beta * ln(rand) reaches the expiry.
+func shouldRefreshEarly(now int64, entry memoEntry, beta float64) bool {
+	r := rand.Float64()
+	if r == 0 {
+		return true
+	}
+
+	gap := -float64(entry.Delta) * beta * math.Log(r)
+
+	return float64(now)+gap >= float64(entry.Expires)
+}
@@ -0,0 +1,143 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	var cache MemoryCache
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "missing"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expected ErrCacheMiss, got %v", err)
+	}
+
+	_ = cache.Set(ctx, "a", []byte("1"), time.Hour)
+	if v, err := cache.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Errorf("expected 1, got %q, %v", v, err)
+	}
+
+	_ = cache.Set(ctx, "b", []byte("2"), -time.Second)
+	if _, err := cache.Get(ctx, "b"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expected expired value to miss, got %v", err)
+	}
+
+	_ = cache.Delete(ctx, "a")
+	if _, err := cache.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expected deleted value to miss, got %v", err)
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	cache := &RedisCache{Client: newFakeRedis(t), Prefix: "cache:"}
+	ctx := context.Background()
+
+	if _, err := cache.Get(ctx, "a"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expected ErrCacheMiss, got %v", err)
+	}
+
+	_ = cache.Set(ctx, "a", []byte("1"), time.Hour)
+	if v, err := cache.Get(ctx, "a"); err != nil || string(v) != "1" {
+		t.Errorf("expected 1, got %q, %v", v, err)
+	}
+}
+
+func TestTools_Memoize(t *testing.T) {
+	var testTools Tools
+	var cache MemoryCache
+	var calls int32
+	ctx := context.Background()
+
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return map[string]int{"total": 42}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := testTools.Memoize(ctx, &cache, "memoize-test", time.Hour, loader, MemoizeOptions{Beta: -1})
+			if err != nil || string(v) != `{"total":42}` {
+				t.Errorf("unexpected result %s, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := testTools.Memoize(ctx, &cache, "memoize-test", time.Hour, loader, MemoizeOptions{Beta: -1}); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("expected the loader to run once, ran %d times", n)
+	}
+
+	loadErr := errors.New("boom")
+	_, err := testTools.Memoize(ctx, &cache, "memoize-error", time.Hour, func(ctx context.Context) (interface{}, error) {
+		return nil, loadErr
+	})
+	if !errors.Is(err, loadErr) {
+		t.Errorf("expected the loader's error, got %v", err)
+	}
+}
+
+func TestTools_MemoizeEarlyRefresh(t *testing.T) {
+	var testTools Tools
+	var cache MemoryCache
+	var calls int32
+	ctx := context.Background()
+
+	loader := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+
+	_, _ = testTools.Memoize(ctx, &cache, "memoize-early", time.Hour, loader)
+
+	// a huge beta makes the value look about to expire on every read
+	v, _ := testTools.Memoize(ctx, &cache, "memoize-early", time.Hour, loader, MemoizeOptions{Beta: 1e12})
+	if string(v) != "2" {
+		t.Errorf("expected an early refresh, got %s", v)
+	}
+
+	v, _ = testTools.Memoize(ctx, &cache, "memoize-early", time.Hour, loader, MemoizeOptions{Beta: -1})
+	if string(v) != "2" {
+		t.Errorf("expected the cached value, got %s", v)
+	}
+}
+
+func TestTools_MemoizeStaleWhileRevalidate(t *testing.T) {
+	var testTools Tools
+	var cache MemoryCache
+	var calls int32
+	ctx := context.Background()
+
+	loader := func(ctx context.Context) (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	opts := MemoizeOptions{Beta: -1, StaleWhileRevalidate: time.Hour}
+
+	_, _ = testTools.Memoize(ctx, &cache, "memoize-stale", 10*time.Millisecond, loader, opts)
+	time.Sleep(20 * time.Millisecond)
+
+	v, _ := testTools.Memoize(ctx, &cache, "memoize-stale", 10*time.Millisecond, loader, opts)
+	if string(v) != "1" {
+		t.Errorf("expected the stale value, got %s", v)
+	}
+
+	// the refreshed value replaces the stale one once the background load finishes
+	deadline := time.Now().Add(time.Second)
+	for string(v) != "2" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		v, _ = testTools.Memoize(ctx, &cache, "memoize-stale", 10*time.Millisecond, loader, opts)
+	}
+	if string(v) != "2" {
+		t.Errorf("expected the refreshed value, got %s", v)
+	}
+}
@@ -0,0 +1,209 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// MergeNonZero copies the fields of src that are set onto dst, for PATCH handlers applying a partial update read
+// with ReadJSON or Bind to a stored resource. Fields are matched by Go name, and src may be a different type,
+// such as a payload struct with pointer fields:
+//   - A pointer field is applied when it is not nil, so a payload can set a field to its zero value, e.g.
+//     Active *bool set to false, while leaving fields the client omitted untouched.
+//   - Any other field is applied when it is not its type's zero value. Slices and maps are replaced, so an empty,
+//     non-nil slice clears a list.
+//   - Struct fields, and pointers to them, are merged field by field, so nested objects can be updated partially.
+//     Structs with unexported fields, such as time.Time, are copied whole.
+//
+// Fields of src tagged `merge:"-"`, e.g. IDs and timestamps, and fields dst does not have are skipped.
+// Parameters:
+// - dst: A pointer to the struct to update.
+// - src: The partial update, a struct or a pointer to one. A nil pointer changes nothing.
+// Returns the names of the fields whose value changed, as in the payload's JSON (e.g. "address.city"), for audit
+// logs or UPDATE statements, or an error if the arguments are not structs or a field's type does not match, in
+// which case dst may be partly updated.
+func (t *Tools) MergeNonZero(dst, src interface{}) ([]string, error) {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() || dv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("merge: dst must be a non-nil pointer to a struct")
+	}
+
+	sv := reflect.ValueOf(src)
+	if sv.Kind() == reflect.Pointer {
+		if sv.IsNil() {
+			return nil, nil
+		}
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Struct {
+		return nil, errors.New("merge: src must be a struct or a pointer to one")
+	}
+
+	var changed []string
+	if err := mergeStruct(dv.Elem(), sv, "", &changed); err != nil {
+		return nil, err
+	}
+
+	return changed, nil
+}
+
+// mergeStruct merges the set fields of src into dst, recording changed fields under prefix.
+func mergeStruct(dst, src reflect.Value, prefix string, changed *[]string) error {
+	st := src.Type()
+
+	for i := 0; i < st.NumField(); i++ {
+		sf := st.Field(i)
+		if !sf.IsExported() || sf.Tag.Get("merge") == "-" {
+			continue
+		}
+
+		sfv := src.Field(i)
+
+		// embedded structs are merged into the promoted fields
+		if sf.Anonymous && sfv.Kind() == reflect.Struct {
+			if err := mergeStruct(dst, sfv, prefix, changed); err != nil {
+				return err
+			}
+			continue
+		}
+
+		dfv := dst.FieldByName(sf.Name)
+		if !dfv.IsValid() || !dfv.CanSet() {
+			continue
+		}
+
+		name := fieldName(sf)
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if err := mergeField(dfv, sfv, name, changed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeField applies one field of the update.
+func mergeField(dst, src reflect.Value, name string, changed *[]string) error {
+	provided := !src.IsZero()
+	if src.Kind() == reflect.Pointer {
+		if src.IsNil() {
+			return nil
+		}
+		provided = true
+		if dst.Kind() != reflect.Pointer || src.Elem().Kind() == reflect.Struct {
+			src = src.Elem()
+		}
+	}
+	if !provided {
+		return nil
+	}
+
+	if mergeable(src.Type()) {
+		target := dst
+		if target.Kind() == reflect.Pointer && target.Type().Elem().Kind() == reflect.Struct {
+			if target.IsNil() {
+				before := len(*changed)
+				fresh := reflect.New(target.Type().Elem())
+				if err := mergeStruct(fresh.Elem(), src, name, changed); err != nil {
+					return err
+				}
+				if len(*changed) > before {
+					target.Set(fresh)
+				}
+				return nil
+			}
+			target = target.Elem()
+		}
+		if target.Kind() == reflect.Struct {
+			return mergeStruct(target, src, name, changed)
+		}
+	}
+
+	value, err := mergeConvert(src, dst.Type())
+	if err != nil {
+		return fmt.Errorf("merge: field %s: %w", name, err)
+	}
+
+	if !reflect.DeepEqual(dst.Interface(), value.Interface()) {
+		dst.Set(value)
+		*changed = append(*changed, name)
+	}
+
+	return nil
+}
+
+// mergeable reports whether values of a struct type are merged field by field: structs whose fields are all
+// exported. Others, like time.Time, are opaque values.
+func mergeable(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			return false
+		}
+	}
+
+	return t.NumField() > 0
+}
+
+// mergeConvert returns src as a value of type to: assigned, converted between types of the same kind, e.g. a
+// string to a named string type, converted between integer or float sizes when the value fits, or taken through
+// or into a pointer.
+func mergeConvert(src reflect.Value, to reflect.Type) (reflect.Value, error) {
+	switch {
+	case src.Type().AssignableTo(to):
+		return src, nil
+	case src.Kind() == to.Kind() && src.Type().ConvertibleTo(to):
+		return src.Convert(to), nil
+	case numberClass(src.Kind()) != "" && numberClass(src.Kind()) == numberClass(to.Kind()):
+		v := src.Convert(to)
+		// the value fits if it survives the round trip without changing sign
+		if v.Convert(src.Type()).Interface() != src.Interface() || negative(v) != negative(src) {
+			return reflect.Value{}, fmt.Errorf("%v overflows %s", src.Interface(), to)
+		}
+		return v, nil
+	case to.Kind() == reflect.Pointer:
+		elem, err := mergeConvert(src, to.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(to.Elem())
+		p.Elem().Set(elem)
+		return p, nil
+	case src.Kind() == reflect.Pointer:
+		return mergeConvert(src.Elem(), to)
+	}
+
+	return reflect.Value{}, fmt.Errorf("cannot assign %s to %s", src.Type(), to)
+}
+
+// numberClass groups numeric kinds that convert into each other without changing meaning.
+func numberClass(k reflect.Kind) string {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	}
+
+	return ""
+}
+
+// negative reports whether a numeric value is below zero.
+func negative(v reflect.Value) bool {
+	switch numberClass(v.Kind()) {
+	case "int":
+		return v.CanInt() && v.Int() < 0
+	case "float":
+		return v.Float() < 0
+	}
+
+	return false
+}
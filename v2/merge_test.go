@@ -0,0 +1,103 @@
+package toolkit
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mergeAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip"`
+}
+
+type mergeUser struct {
+	ID        int `json:"id"`
+	Name      string
+	Email     string `json:"email"`
+	Active    bool   `json:"active"`
+	Age       int    `json:"age"`
+	Tags      []string
+	Address   mergeAddress  `json:"address"`
+	Billing   *mergeAddress `json:"billing"`
+	Nickname  *string
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func TestTools_MergeNonZero(t *testing.T) {
+	var testTools Tools
+
+	str := func(s string) *string { return &s }
+	base := func() mergeUser {
+		return mergeUser{ID: 7, Name: "Ann", Email: "ann@example.com", Active: true, Age: 30, Tags: []string{"a"},
+			Address: mergeAddress{City: "Lisbon", Zip: "1000"}, Nickname: str("annie")}
+	}
+
+	type patch struct {
+		ID      *int          `json:"id" merge:"-"`
+		Name    *string       `json:"name"`
+		Email   *string       `json:"email"`
+		Active  *bool         `json:"active"`
+		Age     *int64        `json:"age"`
+		Tags    []string      `json:"tags"`
+		Address *mergeAddress `json:"address"`
+		Billing *mergeAddress `json:"billing"`
+	}
+
+	f, zero, id := false, int64(0), 99
+	var tests = []struct {
+		name     string
+		src      interface{}
+		changed  string
+		expected func(u *mergeUser)
+	}{
+		{"same type skips zero values", mergeUser{Name: "Anne", Active: false, Age: 0}, "Name", func(u *mergeUser) { u.Name = "Anne" }},
+		{"pointers set zero values", patch{Active: &f, Age: &zero, Email: str("ann@example.com")}, "active,age", func(u *mergeUser) { u.Active, u.Age = false, 0 }},
+		{"protected fields", &patch{ID: &id, Name: str("Anne")}, "name", func(u *mergeUser) { u.Name = "Anne" }},
+		{"nested partial update", patch{Address: &mergeAddress{City: "Porto"}}, "address.city", func(u *mergeUser) { u.Address.City = "Porto" }},
+		{"nil nested pointer is created", patch{Billing: &mergeAddress{Zip: "4000"}}, "billing.zip", func(u *mergeUser) { u.Billing = &mergeAddress{Zip: "4000"} }},
+		{"empty slice clears", patch{Tags: []string{}}, "tags", func(u *mergeUser) { u.Tags = []string{} }},
+		{"opaque structs and pointer fields", struct {
+			UpdatedAt *time.Time
+			Nickname  string
+			Unknown   string
+		}{UpdatedAt: &time.Time{}, Nickname: "A", Unknown: "x"}, "Nickname", func(u *mergeUser) { u.Nickname = str("A") }},
+		{"nil src", (*patch)(nil), "", func(*mergeUser) {}},
+	}
+
+	for _, e := range tests {
+		u := base()
+		changed, err := testTools.MergeNonZero(&u, e.src)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+
+		want := base()
+		e.expected(&want)
+		if !reflect.DeepEqual(u, want) {
+			t.Errorf("%s: expected %+v, got %+v", e.name, want, u)
+		}
+		if strings.Join(changed, ",") != e.changed {
+			t.Errorf("%s: expected changed fields %q, got %q", e.name, e.changed, changed)
+		}
+	}
+
+	var u mergeUser
+	if _, err := testTools.MergeNonZero(u, patch{}); err == nil {
+		t.Error("expected a non-pointer dst to fail")
+	}
+	if _, err := testTools.MergeNonZero(&u, "name"); err == nil {
+		t.Error("expected a non-struct src to fail")
+	}
+	if _, err := testTools.MergeNonZero(&u, struct{ Age int64 }{1 << 40}); err != nil || u.Age != 1<<40 {
+		t.Errorf("expected a wider integer to be converted, got %d, %v", u.Age, err)
+	}
+	if _, err := testTools.MergeNonZero(&u, struct{ Age uint64 }{1 << 63}); err == nil {
+		t.Error("expected an overflowing integer to fail")
+	}
+	if _, err := testTools.MergeNonZero(&u, struct{ Age string }{"x"}); err == nil || !strings.Contains(err.Error(), "Age") {
+		t.Errorf("expected a type mismatch naming the field, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorOptions configures MirrorMiddleware.
+// Fields:
+// - SampleRate: The fraction of requests mirrored, between 0 and 1, e.g. 0.05 for 5%. Zero mirrors every request.
+// - MaxBody: The largest body mirrored, in bytes; requests with larger bodies are not mirrored. Defaults to 1 MB.
+// - MaxInFlight: The most mirrored requests in progress at once; requests beyond it are not mirrored, so a slow
+// shadow service cannot pile up goroutines. Defaults to 100.
+// - Timeout: How long a mirrored request may take. Defaults to 5 seconds.
+// - Skip: If set, requests it returns true for are not mirrored, e.g. payments.
+// - Client: The client sending the mirrored requests. Defaults to a new http.Client.
+// - ErrorLog: If set, receives failed mirrored requests. They are not logged by default.
+type MirrorOptions struct {
+	SampleRate  float64
+	MaxBody     int64
+	MaxInFlight int
+	Timeout     time.Duration
+	Skip        func(r *http.Request) bool
+	Client      *http.Client
+	ErrorLog    *slog.Logger
+}
+
+// mirrorHopHeaders are the headers describing a connection rather than a request, which are not mirrored.
+var mirrorHopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization", "Te",
+	"Trailer", "Transfer-Encoding", "Upgrade"}
+
+// MirrorMiddleware sends a copy of a sample of requests to a shadow service, e.g. a new version under test, without
+// affecting the response: the copies are sent in the background once the handler has returned, and the shadow's
+// responses are discarded. Copies keep the method, path, query, headers and body of the original, with
+// "X-Shadow-Request: true" and X-Forwarded-For added, so the shadow can tell them apart and avoid side effects
+// such as sending emails or charging cards.
+// Parameters:
+// - shadowURL: The base URL of the shadow service. The request path is appended to its path. If it is not an
+// absolute URL, the error is logged with slog.Default() and nothing is mirrored.
+// - opts: Optional MirrorOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) MirrorMiddleware(shadowURL string, opts ...MirrorOptions) func(http.Handler) http.Handler {
+	var o MirrorOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+	if o.MaxInFlight <= 0 {
+		o.MaxInFlight = 100
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+	if o.Client == nil {
+		o.Client = &http.Client{}
+	}
+
+	base, err := url.Parse(shadowURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		slog.Default().Error("invalid shadow URL; requests are not mirrored", slog.String("url", shadowURL))
+		return func(next http.Handler) http.Handler { return next }
+	}
+
+	var inFlight atomic.Int32
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (o.SampleRate > 0 && o.SampleRate < 1 && rand.Float64() >= o.SampleRate) || (o.Skip != nil && o.Skip(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil && r.Body != http.NoBody {
+				data, err := io.ReadAll(io.LimitReader(r.Body, o.MaxBody+1))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+				if err != nil || int64(len(data)) > o.MaxBody {
+					next.ServeHTTP(w, r)
+					return
+				}
+				body = data
+			}
+
+			// the copy is built before the handler runs, as handlers may change the request
+			mirror := newMirrorRequest(base, r, body)
+
+			next.ServeHTTP(w, r)
+
+			if int(inFlight.Add(1)) > o.MaxInFlight {
+				inFlight.Add(-1)
+				return
+			}
+
+			ctx := context.WithoutCancel(r.Context())
+			go func() {
+				defer inFlight.Add(-1)
+
+				ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+				defer cancel()
+
+				resp, err := o.Client.Do(mirror.WithContext(ctx))
+				if err != nil {
+					if o.ErrorLog != nil {
+						o.ErrorLog.WarnContext(ctx, "mirrored request failed", slog.String("method", mirror.Method), slog.String("url", mirror.URL.String()), slog.String("error", err.Error()))
+					}
+					return
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+			}()
+		})
+	}
+}
+
+// newMirrorRequest returns a copy of r addressed to base.
+func newMirrorRequest(base *url.URL, r *http.Request, body []byte) *http.Request {
+	u := *base
+	u.Path = strings.TrimSuffix(base.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+
+	mirror, _ := http.NewRequest(r.Method, u.String(), bytes.NewReader(body))
+	mirror.Header = r.Header.Clone()
+	for _, h := range strings.Split(r.Header.Get("Connection"), ",") {
+		mirror.Header.Del(strings.TrimSpace(h))
+	}
+	for _, h := range mirrorHopHeaders {
+		mirror.Header.Del(h)
+	}
+
+	forwarded := remoteIP(r)
+	if prior := r.Header.Get("X-Forwarded-For"); prior != "" {
+		forwarded = prior + ", " + forwarded
+	}
+	mirror.Header.Set("X-Forwarded-For", forwarded)
+	mirror.Header.Set("X-Shadow-Request", "true")
+
+	return mirror
+}
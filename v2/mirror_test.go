@@ -0,0 +1,74 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_MirrorMiddleware(t *testing.T) {
+	type mirrored struct {
+		method, uri, body string
+		header            http.Header
+	}
+	received := make(chan mirrored, 10)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- mirrored{r.Method, r.URL.RequestURI(), string(body), r.Header}
+		http.Error(w, "shadow failure", http.StatusInternalServerError)
+	}))
+	defer shadow.Close()
+
+	var testTools Tools
+	handler := testTools.MirrorMiddleware(shadow.URL+"/v2/", MirrorOptions{
+		Skip: func(r *http.Request) bool { return r.URL.Path == "/pay" },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte("primary:" + string(body)))
+	}))
+
+	req := httptest.NewRequest("POST", "/orders?x=1", strings.NewReader(`{"item":1}`))
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("Connection", "close, X-Hop")
+	req.Header.Set("X-Hop", "1")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Body.String() != `primary:{"item":1}` {
+		t.Errorf("expected the primary response, got %q", rr.Body.String())
+	}
+
+	select {
+	case m := <-received:
+		if m.method != "POST" || m.uri != "/v2/orders?x=1" || m.body != `{"item":1}` {
+			t.Errorf("expected the request to be copied, got %s %s %q", m.method, m.uri, m.body)
+		}
+		if m.header.Get("Authorization") != "Bearer abc" || m.header.Get("X-Shadow-Request") != "true" || m.header.Get("X-Forwarded-For") != "192.0.2.1" {
+			t.Errorf("expected the headers to be copied and marked, got %v", m.header)
+		}
+		if m.header.Get("X-Hop") != "" {
+			t.Errorf("expected hop-by-hop headers to be dropped, got %v", m.header)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the request to be mirrored")
+	}
+
+	// skipped requests are not mirrored
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/pay", strings.NewReader("card")))
+	select {
+	case m := <-received:
+		t.Errorf("expected skipped requests not to be mirrored, got %s", m.uri)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// an invalid shadow URL leaves requests alone
+	rr = httptest.NewRecorder()
+	testTools.MirrorMiddleware("not a url")(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the request to be served, got %d", rr.Code)
+	}
+	<-received
+}
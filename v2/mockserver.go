@@ -0,0 +1,332 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sync"
+	"time"
+)
+
+// MockRequest is a request received by a MockServer.
+// Fields:
+// - Method: The request method.
+// - URL: The request URI, i.e. the path and query.
+// - Header: The request headers.
+// - Body: The request body.
+type MockRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// MockServer is an HTTP server for integration tests of code calling other services, e.g. with
+// PushJSONToRemote. Requests are matched against expectations, in the order they were added, and answered with
+// their scripted responses; Verify then reports the expectations that were not met and the requests that matched
+// none.
+//
+//	srv := toolkit.NewMockServer()
+//	defer srv.Close()
+//	srv.Expect("POST", "/orders").WithJSON(order).RespondJSON(http.StatusCreated, created)
+//	// ... code under test calls srv.URL + "/orders"
+//	if err := srv.Verify(); err != nil {
+//		t.Error(err)
+//	}
+type MockServer struct {
+	// URL is the base URL of the server, e.g. "http://127.0.0.1:49152".
+	URL string
+
+	srv          *httptest.Server
+	mu           sync.Mutex
+	expectations []*MockExpectation
+	requests     []MockRequest
+	unexpected   []string
+}
+
+// NewMockServer starts a MockServer. Close it when the test is over.
+func NewMockServer() *MockServer {
+	m := &MockServer{}
+	m.srv = httptest.NewServer(http.HandlerFunc(m.serve))
+	m.URL = m.srv.URL
+
+	return m
+}
+
+// Close shuts the server down, waiting for the requests in progress.
+func (m *MockServer) Close() {
+	m.srv.CloseClientConnections()
+	m.srv.Close()
+}
+
+// Client returns an http.Client for the server.
+func (m *MockServer) Client() *http.Client {
+	return m.srv.Client()
+}
+
+// Expect adds an expectation for requests with the given method and path. By default it must be met at least once
+// and is answered with 200 OK and no body.
+// Parameters:
+// - method: The request method, e.g. "POST".
+// - pathPattern: The request path, or a pattern as accepted by path.Match, e.g. "/users/*". The query is matched
+// with WithQuery.
+// Returns the expectation, to refine with its methods.
+func (m *MockServer) Expect(method, pathPattern string) *MockExpectation {
+	e := &MockExpectation{m: m, method: method, path: pathPattern, header: http.Header{}, query: map[string]string{}}
+
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+
+	return e
+}
+
+// Requests returns the requests received so far, in order.
+func (m *MockServer) Requests() []MockRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]MockRequest(nil), m.requests...)
+}
+
+// Verify checks that every expectation was met and every request matched one. Expectations given a value that
+// cannot be marshaled never match, and are reported here.
+// Returns nil, or an error listing each problem on its own line.
+func (m *MockServer) Verify() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs []error
+	for _, e := range m.expectations {
+		switch {
+		case e.err != nil:
+			errs = append(errs, fmt.Errorf("%s %s: %w", e.method, e.path, e.err))
+		case e.times > 0 && e.calls != e.times:
+			errs = append(errs, fmt.Errorf("%s %s: expected %d calls, got %d", e.method, e.path, e.times, e.calls))
+		case e.times == 0 && e.calls == 0:
+			errs = append(errs, fmt.Errorf("%s %s: expected at least one call, got none", e.method, e.path))
+		}
+	}
+	for _, u := range m.unexpected {
+		errs = append(errs, fmt.Errorf("unexpected request %s", u))
+	}
+
+	return errors.Join(errs...)
+}
+
+// serve answers a request with the first expectation matching it.
+func (m *MockServer) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	m.mu.Lock()
+	m.requests = append(m.requests, MockRequest{Method: r.Method, URL: r.URL.RequestURI(), Header: r.Header.Clone(), Body: body})
+
+	var match *MockExpectation
+	for _, e := range m.expectations {
+		if e.matches(r, body) && (e.times == 0 || e.calls < e.times) {
+			match = e
+			break
+		}
+	}
+	if match == nil {
+		m.unexpected = append(m.unexpected, r.Method+" "+r.URL.RequestURI())
+		m.mu.Unlock()
+
+		var t Tools
+		_ = t.ErrorJSON(w, fmt.Errorf("no expectation matches %s %s", r.Method, r.URL.RequestURI()), http.StatusNotImplemented)
+		return
+	}
+
+	var resp mockResponse
+	if n := len(match.responses); n > 0 {
+		resp = match.responses[min(match.calls, n-1)]
+	}
+	match.calls++
+	delay := match.delay
+	m.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	resp.write(w, r)
+}
+
+// mockResponse is a scripted response.
+type mockResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	handler http.HandlerFunc
+	hangUp  bool
+}
+
+// write sends the response.
+func (resp mockResponse) write(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case resp.hangUp:
+		if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+			_ = conn.Close()
+			return
+		}
+		panic(http.ErrAbortHandler)
+	case resp.handler != nil:
+		resp.handler(w, r)
+		return
+	}
+
+	for k, vs := range resp.header {
+		w.Header()[k] = append([]string(nil), vs...)
+	}
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	w.WriteHeader(resp.status)
+	_, _ = w.Write(resp.body)
+}
+
+// MockExpectation is a request a MockServer expects, and how to answer it. Its methods return the expectation, so
+// calls can be chained. Each Respond method adds a response: calls are answered with them in order, and the last one
+// is repeated.
+type MockExpectation struct {
+	m         *MockServer
+	method    string
+	path      string
+	header    http.Header
+	query     map[string]string
+	json      interface{}
+	hasJSON   bool
+	bodyFunc  func(body []byte) bool
+	times     int
+	delay     time.Duration
+	responses []mockResponse
+	calls     int
+	err       error
+}
+
+// matches reports whether the expectation matches a request. The server's lock must be held.
+func (e *MockExpectation) matches(r *http.Request, body []byte) bool {
+	if e.err != nil || r.Method != e.method {
+		return false
+	}
+	if ok, _ := path.Match(e.path, r.URL.Path); !ok && e.path != r.URL.Path {
+		return false
+	}
+
+	for k, vs := range e.header {
+		for _, v := range vs {
+			found := false
+			for _, got := range r.Header.Values(k) {
+				found = found || got == v
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	q := r.URL.Query()
+	for k, v := range e.query {
+		if q.Get(k) != v {
+			return false
+		}
+	}
+
+	if e.hasJSON {
+		got, err := decodeJSONDocument(body)
+		if err != nil || !jsonEqual(e.json, got) {
+			return false
+		}
+	}
+
+	return e.bodyFunc == nil || e.bodyFunc(body)
+}
+
+// update changes the expectation under the server's lock.
+func (e *MockExpectation) update(fn func()) *MockExpectation {
+	e.m.mu.Lock()
+	defer e.m.mu.Unlock()
+
+	fn()
+
+	return e
+}
+
+// WithHeader requires a request header to have the value.
+func (e *MockExpectation) WithHeader(key, value string) *MockExpectation {
+	return e.update(func() { e.header.Add(key, value) })
+}
+
+// WithQuery requires a query parameter to have the value.
+func (e *MockExpectation) WithQuery(key, value string) *MockExpectation {
+	return e.update(func() { e.query[key] = value })
+}
+
+// WithJSON requires the body to be a JSON document equal to body, compared semantically, so member order and
+// spacing do not matter. body is marshaled, unless it is a []byte or json.RawMessage holding JSON.
+func (e *MockExpectation) WithJSON(body interface{}) *MockExpectation {
+	doc, err := decodeJSONDocument(body)
+
+	return e.update(func() {
+		e.json, e.hasJSON = doc, true
+		if err != nil {
+			e.err = fmt.Errorf("invalid JSON to match: %w", err)
+		}
+	})
+}
+
+// WithBody requires match to accept the body, e.g. to check only some fields of a JSON document.
+func (e *MockExpectation) WithBody(match func(body []byte) bool) *MockExpectation {
+	return e.update(func() { e.bodyFunc = match })
+}
+
+// Times requires exactly n matching calls. Calls beyond n no longer match the expectation.
+func (e *MockExpectation) Times(n int) *MockExpectation {
+	return e.update(func() { e.times = n })
+}
+
+// Delay waits before answering, to test timeouts and slow services.
+func (e *MockExpectation) Delay(d time.Duration) *MockExpectation {
+	return e.update(func() { e.delay = d })
+}
+
+// Respond adds a response with the given status, body and headers.
+func (e *MockExpectation) Respond(status int, body string, headers ...http.Header) *MockExpectation {
+	h := http.Header{}
+	for _, hdr := range headers {
+		for k, vs := range hdr {
+			h[k] = append(h[k], vs...)
+		}
+	}
+
+	return e.update(func() { e.responses = append(e.responses, mockResponse{status: status, header: h, body: []byte(body)}) })
+}
+
+// RespondJSON adds a response with the given status and data as its JSON body.
+func (e *MockExpectation) RespondJSON(status int, data interface{}) *MockExpectation {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return e.update(func() { e.err = fmt.Errorf("invalid JSON response: %w", err) })
+	}
+
+	return e.Respond(status, string(body), http.Header{"Content-Type": {"application/json"}})
+}
+
+// RespondWith adds a response written by a handler, for responses depending on the request.
+func (e *MockExpectation) RespondWith(handler http.HandlerFunc) *MockExpectation {
+	return e.update(func() { e.responses = append(e.responses, mockResponse{handler: handler}) })
+}
+
+// HangUp adds a response closing the connection without answering, so the client sees a network error.
+func (e *MockExpectation) HangUp() *MockExpectation {
+	return e.update(func() { e.responses = append(e.responses, mockResponse{hangUp: true}) })
+}
@@ -0,0 +1,124 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMockServer(t *testing.T) {
+	var testTools Tools
+	srv := NewMockServer()
+	defer srv.Close()
+
+	srv.Expect("POST", "/orders").
+		WithHeader("Content-Type", "application/json").
+		WithJSON(json.RawMessage(`{"item": 1, "qty": 2}`)).
+		RespondJSON(http.StatusServiceUnavailable, map[string]string{"error": "busy"}).
+		RespondJSON(http.StatusCreated, map[string]int{"id": 7}).
+		Times(2)
+	srv.Expect("GET", "/orders/*").WithQuery("expand", "items").Respond(http.StatusOK, "found")
+
+	var tests = []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		resp   string
+	}{
+		{"first call", "POST", "/orders", `{"qty":2,"item":1}`, 503, `{"error":"busy"}`},
+		{"second call", "POST", "/orders", `{"item":1,"qty":2}`, 201, `{"id":7}`},
+		{"beyond times", "POST", "/orders", `{"item":1,"qty":2}`, 501, ""},
+		{"other body", "POST", "/orders", `{"item":2,"qty":2}`, 501, ""},
+		{"pattern", "GET", "/orders/7?expand=items", "", 200, "found"},
+		{"missing query", "GET", "/orders/7", "", 501, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest(e.method, srv.URL+e.path, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != e.status {
+			t.Errorf("%s: expected status %d, got %d", e.name, e.status, resp.StatusCode)
+		}
+		if e.resp != "" && string(body) != e.resp {
+			t.Errorf("%s: expected body %s, got %s", e.name, e.resp, body)
+		}
+	}
+
+	err := srv.Verify()
+	if err == nil || strings.Count(err.Error(), "unexpected request") != 3 {
+		t.Errorf("expected the unmatched requests to be reported, got %v", err)
+	}
+	if n := len(srv.Requests()); n != 6 {
+		t.Errorf("expected 6 requests to be recorded, got %d", n)
+	}
+
+	// PushJSONToRemote consumers
+	srv = NewMockServer()
+	defer srv.Close()
+	srv.Expect("POST", "/hook").WithJSON(map[string]string{"event": "paid"}).Respond(http.StatusAccepted, "")
+	srv.Expect("DELETE", "/never")
+
+	_, status, err := testTools.PushJSONToRemote(srv.URL+"/hook", map[string]string{"event": "paid"})
+	if err != nil || status != http.StatusAccepted {
+		t.Errorf("expected 202, got %d, %v", status, err)
+	}
+	if err := srv.Verify(); err == nil || !strings.Contains(err.Error(), "DELETE /never: expected at least one call") {
+		t.Errorf("expected the unmet expectation to be reported, got %v", err)
+	}
+}
+
+func TestMockServer_Faults(t *testing.T) {
+	srv := NewMockServer()
+	defer srv.Close()
+
+	srv.Expect("GET", "/slow").Delay(200 * time.Millisecond)
+	srv.Expect("GET", "/reset").HangUp()
+	srv.Expect("POST", "/echo").RespondWith(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/slow", nil)
+	if _, err := srv.Client().Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the delay to exceed the timeout, got %v", err)
+	}
+
+	if _, err := srv.Client().Get(srv.URL + "/reset"); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+
+	resp, err := srv.Client().Post(srv.URL+"/echo", "text/plain", bytes.NewReader([]byte("ping")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != "ping" {
+		t.Errorf("expected the handler to answer, got %q", body)
+	}
+
+	if err := srv.Verify(); err != nil {
+		t.Errorf("expected every expectation to be met, got %v", err)
+	}
+
+	srv.Expect("GET", "/bad").RespondJSON(http.StatusOK, make(chan int))
+	if err := srv.Verify(); err == nil || !strings.Contains(err.Error(), "invalid JSON response") {
+		t.Errorf("expected an invalid response to be reported, got %v", err)
+	}
+}
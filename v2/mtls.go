@@ -0,0 +1,188 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrClientCertificate is returned when a request carries no client certificate or one that is not trusted.
+var ErrClientCertificate = errors.New("invalid client certificate")
+
+// MTLSOptions configures MTLSMiddleware.
+// Fields:
+// - ClientCAs: The certificate authorities client certificates must chain to. When nil, the chains verified by
+// the TLS server are used, so the server must be configured with ClientCAs, e.g. by MTLSServerConfig.
+// - AllowedCommonNames: The subject common names allowed, e.g. "billing-service".
+// - AllowedSANs: The DNS names, URIs (such as SPIFFE IDs) and email addresses allowed. A certificate is allowed
+// if its common name or any of its subject alternative names is listed; when both lists are empty, every
+// trusted certificate is allowed.
+// - CheckRevocation: An optional hook returning an error if the certificate is revoked, e.g. after checking a CRL
+// or OCSP responder. It is called with the verified chain, leaf first.
+type MTLSOptions struct {
+	ClientCAs          *x509.CertPool
+	AllowedCommonNames []string
+	AllowedSANs        []string
+	CheckRevocation    func(ctx context.Context, chain []*x509.Certificate) error
+}
+
+// ClientIdentity is the identity of a client authenticated with a certificate.
+// Fields:
+// - CommonName: The certificate's subject common name.
+// - DNSNames: The DNS subject alternative names.
+// - URIs: The URI subject alternative names, e.g. "spiffe://example.org/billing".
+// - EmailAddresses: The email subject alternative names.
+// - SerialNumber: The certificate's serial number in hex.
+// - Fingerprint: The SHA-256 fingerprint of the certificate in hex, suitable for pinning.
+// - Certificate: The certificate.
+type ClientIdentity struct {
+	CommonName     string
+	DNSNames       []string
+	URIs           []string
+	EmailAddresses []string
+	SerialNumber   string
+	Fingerprint    string
+	Certificate    *x509.Certificate
+}
+
+type clientIdentityContextKey struct{}
+
+// ClientIdentityFromContext returns the identity stored by MTLSMiddleware, and whether there was one.
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	id, ok := ctx.Value(clientIdentityContextKey{}).(ClientIdentity)
+	return id, ok
+}
+
+// MTLSServerConfig returns a TLS configuration requesting client certificates signed by clientCAs, to serve
+// internal APIs protected by MTLSMiddleware.
+// Parameters:
+// - clientCAs: The certificate authorities of the clients.
+// Returns the configuration, which also requires TLS 1.2 or later. Certificates and server keys still have to be
+// set on it.
+func MTLSServerConfig(clientCAs *x509.CertPool) *tls.Config {
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+// MTLSMiddleware authenticates service-to-service requests with TLS client certificates. The certificate must
+// chain to a trusted authority, be valid for client authentication, match the allowlists and pass the revocation
+// hook. The client's ClientIdentity is stored in the request context, and a Subject whose ID is the certificate's
+// common name, or its first URI when the common name is empty, is stored as WithSubject does, so Authorizers work
+// with services as they do with users.
+// Parameters:
+// - opts: The certificate requirements.
+// Returns the middleware, which answers 401 Unauthorized with an error wrapping ErrClientCertificate for missing or
+// untrusted certificates and 403 Forbidden for certificates not allowed or revoked.
+func (t *Tools) MTLSMiddleware(opts MTLSOptions) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			chain, err := verifyClientCertificate(r, opts.ClientCAs)
+			if err != nil {
+				_ = t.ErrorJSON(w, err, http.StatusUnauthorized)
+				return
+			}
+
+			id := newClientIdentity(chain[0])
+			if !id.allowed(opts) {
+				_ = t.ErrorJSON(w, fmt.Errorf("%w: %q is not allowed", ErrForbidden, id.CommonName))
+				return
+			}
+			if opts.CheckRevocation != nil {
+				if err := opts.CheckRevocation(r.Context(), chain); err != nil {
+					_ = t.ErrorJSON(w, fmt.Errorf("%w: certificate revoked", ErrForbidden))
+					return
+				}
+			}
+
+			subject := Subject{ID: id.CommonName, Claims: map[string]string{"auth": "mtls", "fingerprint": id.Fingerprint}}
+			if subject.ID == "" && len(id.URIs) > 0 {
+				subject.ID = id.URIs[0]
+			}
+
+			ctx := context.WithValue(WithSubject(r.Context(), subject), clientIdentityContextKey{}, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// verifyClientCertificate returns the verified chain of the request's client certificate, leaf first.
+func verifyClientCertificate(r *http.Request, roots *x509.CertPool) ([]*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("%w: no client certificate", ErrClientCertificate)
+	}
+
+	if roots == nil {
+		if len(r.TLS.VerifiedChains) == 0 {
+			return nil, fmt.Errorf("%w: the certificate was not verified", ErrClientCertificate)
+		}
+		return r.TLS.VerifiedChains[0], nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := r.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrClientCertificate, err)
+	}
+
+	return chains[0], nil
+}
+
+// newClientIdentity describes a client certificate.
+func newClientIdentity(cert *x509.Certificate) ClientIdentity {
+	sum := sha256.Sum256(cert.Raw)
+
+	id := ClientIdentity{
+		CommonName:     cert.Subject.CommonName,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		SerialNumber:   cert.SerialNumber.Text(16),
+		Fingerprint:    hex.EncodeToString(sum[:]),
+		Certificate:    cert,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+
+	return id
+}
+
+// allowed reports whether the identity matches the allowlists.
+func (id ClientIdentity) allowed(opts MTLSOptions) bool {
+	if len(opts.AllowedCommonNames) == 0 && len(opts.AllowedSANs) == 0 {
+		return true
+	}
+
+	for _, cn := range opts.AllowedCommonNames {
+		if id.CommonName != "" && cn == id.CommonName {
+			return true
+		}
+	}
+
+	for _, san := range opts.AllowedSANs {
+		for _, names := range [][]string{id.DNSNames, id.URIs, id.EmailAddresses} {
+			for _, name := range names {
+				if name == san {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority issuing client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a client certificate for the common name and URI.
+func (ca *testCA) issue(t *testing.T, cn, uri string) *x509.Certificate {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if uri != "" {
+		u, _ := url.Parse(uri)
+		template.URIs = []*url.URL{u}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return cert
+}
+
+func TestTools_MTLSMiddleware(t *testing.T) {
+	var testTools Tools
+	ca, otherCA := newTestCA(t), newTestCA(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	billing := ca.issue(t, "billing", "")
+	spiffe := ca.issue(t, "", "spiffe://example.org/reports")
+	unlisted := ca.issue(t, "mallory", "")
+	revoked := ca.issue(t, "revoked", "")
+	foreign := otherCA.issue(t, "billing", "")
+
+	handler := testTools.MTLSMiddleware(MTLSOptions{
+		ClientCAs:          pool,
+		AllowedCommonNames: []string{"billing", "revoked"},
+		AllowedSANs:        []string{"spiffe://example.org/reports"},
+		CheckRevocation: func(ctx context.Context, chain []*x509.Certificate) error {
+			if chain[0].Subject.CommonName == "revoked" {
+				return errors.New("revoked")
+			}
+			return nil
+		},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := ClientIdentityFromContext(r.Context())
+		subject, _ := SubjectFromContext(r.Context())
+		if !ok || id.Fingerprint == "" || subject.Claims["auth"] != "mtls" {
+			t.Errorf("expected the identity in context, got %+v", id)
+		}
+		_, _ = w.Write([]byte(subject.ID))
+	}))
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		expected int
+		subject  string
+	}{
+		{name: "allowed common name", cert: billing, expected: http.StatusOK, subject: "billing"},
+		{name: "allowed SAN", cert: spiffe, expected: http.StatusOK, subject: "spiffe://example.org/reports"},
+		{name: "not allowed", cert: unlisted, expected: http.StatusForbidden},
+		{name: "revoked", cert: revoked, expected: http.StatusForbidden},
+		{name: "untrusted CA", cert: foreign, expected: http.StatusUnauthorized},
+		{name: "no certificate", expected: http.StatusUnauthorized},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/internal", nil)
+		req.TLS = &tls.ConnectionState{}
+		if e.cert != nil {
+			req.TLS.PeerCertificates = []*x509.Certificate{e.cert}
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d: %s", e.name, e.expected, rr.Code, rr.Body.String())
+		}
+		if e.subject != "" && rr.Body.String() != e.subject {
+			t.Errorf("%s: expected subject %q, got %q", e.name, e.subject, rr.Body.String())
+		}
+	}
+}
+
+func TestTools_MTLSMiddlewareServerVerified(t *testing.T) {
+	var testTools Tools
+	ca := newTestCA(t)
+	cert := ca.issue(t, "billing", "")
+
+	handler := testTools.MTLSMiddleware(MTLSOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/internal", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a certificate the server did not verify, got %d", rr.Code)
+	}
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert, ca.cert}}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for a verified certificate, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// maxMultipartValues is the most bytes of non-file form values read with an upload, as with
+// http.Request.ParseMultipartForm.
+const maxMultipartValues = 10 << 20
+
+// MultipartOptions controls how UploadFiles reads multipart forms, trading memory for disk.
+// Fields:
+// - MaxMemory: The most bytes of uploaded files kept in memory, in total; the rest is written to temporary files.
+// Defaults to MaxFileSize, so by default files up to that size stay in memory.
+// - TempDir: The directory of those temporary files, e.g. a volume with room for large uploads. Defaults to
+// os.TempDir().
+// - Stream: Save each file as it is read from the request, without buffering it in memory or in a temporary file,
+// for containers with little memory and no writable temporary directory. Files are then saved one at a time, in
+// the order they were sent rather than by field name, and UploadParallelism does not apply. The
+// *multipart.FileHeader passed to the upload hooks has no content to Open, and its Size is only known once the
+// file was written.
+type MultipartOptions struct {
+	MaxMemory int64
+	TempDir   string
+	Stream    bool
+}
+
+// uploadPart is an uploaded file: its header, and a function opening its content.
+type uploadPart struct {
+	hdr  *multipart.FileHeader
+	open func() (io.ReadCloser, error)
+}
+
+// headerPart returns the uploadPart of a file of a parsed form.
+func headerPart(hdr *multipart.FileHeader) uploadPart {
+	return uploadPart{hdr: hdr, open: func() (io.ReadCloser, error) { return hdr.Open() }}
+}
+
+// multipartMaxMemory returns the most bytes of uploaded files kept in memory, from Multipart.MaxMemory or else
+// MaxFileSize.
+func (t *Tools) multipartMaxMemory() int64 {
+	if t.Multipart.MaxMemory > 0 {
+		return t.Multipart.MaxMemory
+	}
+
+	return int64(t.MaxFileSize)
+}
+
+// readUploadForm reads the multipart form of an upload according to Tools.Multipart, returning its files ordered
+// by field name and then as sent, and a function removing the temporary files it wrote.
+func (t *Tools) readUploadForm(r *http.Request) ([]uploadPart, func(), error) {
+	o := t.Multipart
+
+	if o.TempDir == "" || r.MultipartForm != nil {
+		if err := r.ParseMultipartForm(t.multipartMaxMemory()); err != nil {
+			return nil, nil, err
+		}
+
+		headers := multipartFileHeaders(r.MultipartForm)
+		parts := make([]uploadPart, len(headers))
+		for i, hdr := range headers {
+			parts[i] = headerPart(hdr)
+		}
+		return parts, nil, nil
+	}
+
+	// the standard library always writes to os.TempDir(), so the form is read here instead
+	var temps []string
+	cleanup := func() {
+		for _, name := range temps {
+			_ = os.Remove(name)
+		}
+	}
+
+	maxMemory := t.multipartMaxMemory()
+	open := map[*multipart.FileHeader]func() (io.ReadCloser, error){}
+	err := readMultipartParts(r, func(p *multipart.Part, hdr *multipart.FileHeader) error {
+		var buf bytes.Buffer
+		n, err := io.Copy(&buf, io.LimitReader(p, maxMemory+1))
+		if err != nil {
+			return err
+		}
+
+		if n <= maxMemory {
+			maxMemory -= n
+			data := buf.Bytes()
+			hdr.Size = n
+			open[hdr] = func() (io.ReadCloser, error) { return nopSeekCloser{bytes.NewReader(data)}, nil }
+			return nil
+		}
+
+		f, err := os.CreateTemp(o.TempDir, "multipart-")
+		if err != nil {
+			return err
+		}
+		temps = append(temps, f.Name())
+
+		hdr.Size, err = copyBuffered(f, &maxSizeReader{r: io.MultiReader(&buf, p), n: int64(t.MaxFileSize)})
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		name := f.Name()
+		open[hdr] = func() (io.ReadCloser, error) { return os.Open(name) }
+		return err
+	})
+	if err != nil {
+		return nil, cleanup, err
+	}
+
+	headers := multipartFileHeaders(r.MultipartForm)
+	parts := make([]uploadPart, len(headers))
+	for i, hdr := range headers {
+		parts[i] = uploadPart{hdr: hdr, open: open[hdr]}
+	}
+
+	return parts, cleanup, nil
+}
+
+// streamUploadFiles saves the files of an upload as they are read from the request, for MultipartOptions.Stream.
+// It returns the files saved and their headers, with the first error, after which no more files are read.
+func (t *Tools) streamUploadFiles(ctx context.Context, r *http.Request, uploadDir string, renameFile bool, staging string) ([]*UploadedFile, []*multipart.FileHeader, error) {
+	var files []*UploadedFile
+	var headers []*multipart.FileHeader
+
+	err := readMultipartParts(r, func(p *multipart.Part, hdr *multipart.FileHeader) error {
+		if ctx.Err() != nil {
+			return uploadAbortError(ctx)
+		}
+
+		stagePath := ""
+		if staging != "" {
+			stagePath = filepath.Join(staging, strconv.Itoa(len(files)))
+		}
+
+		part := uploadPart{hdr: hdr, open: func() (io.ReadCloser, error) { return io.NopCloser(p), nil }}
+		file, err := t.saveUploadedFile(ctx, part, uploadDir, renameFile, stagePath)
+		if err != nil {
+			return err
+		}
+
+		hdr.Size = file.FileSize
+		files = append(files, file)
+		headers = append(headers, hdr)
+		return nil
+	})
+
+	return files, headers, err
+}
+
+// readMultipartParts reads the multipart body of r, passing each file to fn as it arrives, and sets
+// r.MultipartForm, r.PostForm and r.Form from what was read, so the form values stay available to handlers. The
+// headers given to fn have no content; fn reads it from the part and may set their Size.
+func readMultipartParts(r *http.Request, fn func(p *multipart.Part, hdr *multipart.FileHeader) error) error {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return err
+	}
+
+	form := &multipart.Form{Value: map[string][]string{}, File: map[string][]*multipart.FileHeader{}}
+	defer func() {
+		r.MultipartForm = form
+		r.PostForm = url.Values(form.Value)
+		r.Form = r.URL.Query()
+		for k, vs := range form.Value {
+			r.Form[k] = append(r.Form[k], vs...)
+		}
+	}()
+
+	valueBytes := int64(maxMultipartValues)
+	for {
+		p, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		if p.FileName() == "" {
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, io.LimitReader(p, valueBytes+1))
+			if err != nil {
+				return err
+			}
+			if valueBytes -= n; valueBytes < 0 {
+				return multipart.ErrMessageTooLarge
+			}
+			form.Value[name] = append(form.Value[name], buf.String())
+			continue
+		}
+
+		hdr := &multipart.FileHeader{Filename: p.FileName(), Header: p.Header}
+		if err := fn(p, hdr); err != nil {
+			return err
+		}
+		form.File[name] = append(form.File[name], hdr)
+	}
+}
+
+// maxSizeReader reads at most n bytes of a file, failing with ErrFileTooLarge if it has more.
+type maxSizeReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the file, allowing one byte over the limit to tell a file of exactly n bytes from a larger one.
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+
+	n, err := m.r.Read(p)
+	if m.n -= int64(n); m.n < 0 {
+		return 0, ErrFileTooLarge
+	}
+
+	return n, err
+}
+
+// nopSeekCloser adds a no-op Close to a bytes.Reader, keeping its Seek.
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+// Close does nothing.
+func (nopSeekCloser) Close() error {
+	return nil
+}
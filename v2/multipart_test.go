@@ -0,0 +1,138 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// multipartUpload builds an upload of the given files, keyed by field name and file name, after a "title" value.
+func multipartUpload(t *testing.T, files [][3]string) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	_ = mw.WriteField("title", "holiday")
+	for _, f := range files {
+		part, err := mw.CreateFormFile(f[0], f[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = part.Write([]byte(f[2]))
+	}
+	_ = mw.Close()
+
+	req := httptest.NewRequest("POST", "/upload?album=1", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestTools_UploadFilesMultipart(t *testing.T) {
+	large := strings.Repeat("b", 4096)
+	files := [][3]string{{"z", "first.txt", "hello"}, {"a", "second.txt", large}}
+
+	var tests = []struct {
+		name  string
+		opts  MultipartOptions
+		order []string
+		spill int
+	}{
+		{"default", MultipartOptions{}, []string{"second.txt", "first.txt"}, 0},
+		{"temp dir", MultipartOptions{MaxMemory: 1024}, []string{"second.txt", "first.txt"}, 1},
+		{"stream", MultipartOptions{Stream: true}, []string{"first.txt", "second.txt"}, 0},
+	}
+
+	for _, e := range tests {
+		dir, tempDir := t.TempDir(), t.TempDir()
+		if e.opts.MaxMemory > 0 {
+			e.opts.TempDir = tempDir
+		}
+
+		spilled := -1
+		testTools := Tools{Multipart: e.opts}
+		testTools.BeforeSave = func(_ context.Context, f *UploadedFile, hdr *multipart.FileHeader) error {
+			entries, _ := os.ReadDir(tempDir)
+			spilled = max(spilled, len(entries))
+			return nil
+		}
+
+		req := multipartUpload(t, files)
+		uploaded, err := testTools.UploadFiles(req, dir, false)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.name, err)
+			continue
+		}
+
+		var names []string
+		for _, f := range uploaded {
+			names = append(names, f.NewFileName)
+		}
+		if strings.Join(names, ",") != strings.Join(e.order, ",") {
+			t.Errorf("%s: expected files %v, got %v", e.name, e.order, names)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "second.txt")); string(data) != large || uploaded[len(uploaded)-1].FileSize <= 0 {
+			t.Errorf("%s: expected the large file to be saved whole, got %d bytes", e.name, len(data))
+		}
+		if req.FormValue("title") != "holiday" || req.FormValue("album") != "1" {
+			t.Errorf("%s: expected the form values to be kept, got %v", e.name, req.Form)
+		}
+		if spilled != e.spill {
+			t.Errorf("%s: expected %d temporary files, got %d", e.name, e.spill, spilled)
+		}
+		if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+			t.Errorf("%s: expected temporary files to be removed, got %d", e.name, len(entries))
+		}
+	}
+}
+
+func TestTools_UploadFilesStreamFailures(t *testing.T) {
+	// AllOrNothing removes the files streamed before a failure
+	dir := t.TempDir()
+	testTools := Tools{Multipart: MultipartOptions{Stream: true}, UploadWrite: UploadWriteOptions{AllOrNothing: true}, AllowedFileTypes: []string{"text/plain; charset=utf-8"}}
+	req := multipartUpload(t, [][3]string{{"a", "ok.txt", "hello"}, {"b", "bad.png", "\x89PNG\r\n\x1a\n"}})
+	if _, err := testTools.UploadFiles(req, dir, false); err == nil || err.Error() != "file type not allowed" {
+		t.Errorf("expected the second file to be refused, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no files to be left, got %d", len(entries))
+	}
+
+	// a body cut short is a disconnected client
+	dir = t.TempDir()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("a", "first.txt")
+	_, _ = part.Write([]byte("complete"))
+	part, _ = mw.CreateFormFile("b", "second.txt")
+	_, _ = part.Write(bytes.Repeat([]byte("a"), 4096))
+	req = httptest.NewRequest("POST", "/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	testTools = Tools{Multipart: MultipartOptions{Stream: true}}
+	if _, err := testTools.UploadFiles(req, dir, false); !errors.Is(err, ErrClientDisconnected) {
+		t.Errorf("expected ErrClientDisconnected, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no files to be left, got %d", len(entries))
+	}
+
+	// streamed headers have no content
+	testTools.BeforeSave = func(_ context.Context, _ *UploadedFile, hdr *multipart.FileHeader) error {
+		if f, err := hdr.Open(); err == nil {
+			_, _ = io.Copy(io.Discard, f)
+			t.Error("expected a streamed header not to open")
+		}
+		return nil
+	}
+	if _, err := testTools.UploadFiles(multipartUpload(t, [][3]string{{"a", "x.txt", "x"}}), t.TempDir(), false); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package toolkit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidIDToken is returned when an OpenID Connect ID token fails verification.
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// oidcDiscovery is the part of an OpenID Provider's configuration document used by DiscoverOIDCProvider.
+type oidcDiscovery struct {
+	Issuer           string   `json:"issuer"`
+	AuthEndpoint     string   `json:"authorization_endpoint"`
+	TokenEndpoint    string   `json:"token_endpoint"`
+	UserInfoEndpoint string   `json:"userinfo_endpoint"`
+	JWKSURI          string   `json:"jwks_uri"`
+	Scopes           []string `json:"scopes_supported"`
+}
+
+// DiscoverOIDCProvider configures a generic OpenID Connect provider from its discovery document, served at
+// <issuer>/.well-known/openid-configuration, e.g. for Keycloak, Auth0, Okta or Microsoft Entra ID.
+// Parameters:
+// - ctx: The context of the request.
+// - name: The provider's name, used in routes and cookies, e.g. "okta".
+// - issuer: The issuer URL, e.g. "https://accounts.example.com".
+// - clientID: The OAuth client ID.
+// - clientSecret: The OAuth client secret.
+// - redirectURL: The absolute URL of the CompleteAuth handler.
+// - client: An optional http.Client. Only the first client is used if multiple are provided.
+// Returns the provider, requesting the openid, email and profile scopes, or an error if the document cannot be
+// fetched or names another issuer.
+func DiscoverOIDCProvider(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string, client ...*http.Client) (*AuthProvider, error) {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if len(client) > 0 {
+		httpClient = client[0]
+	}
+
+	var doc oidcDiscovery
+	if err := getJSON(ctx, httpClient, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", "", &doc); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("oidc: discovery document is for issuer %q, not %q", doc.Issuer, issuer)
+	}
+
+	return &AuthProvider{
+		Name:         name,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      doc.AuthEndpoint,
+		TokenURL:     doc.TokenEndpoint,
+		UserInfoURL:  doc.UserInfoEndpoint,
+		Issuer:       doc.Issuer,
+		JWKSURL:      doc.JWKSURI,
+		Scopes:       []string{"openid", "email", "profile"},
+	}, nil
+}
+
+// getJSON fetches a JSON document, with an optional bearer token.
+func getJSON(ctx context.Context, client *http.Client, rawURL, bearer string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching %s", res.StatusCode, rawURL)
+	}
+
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+// jsonWebKey is a public key of a JWK set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key, which must be RSA or P-256.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// jwksCache holds the signing keys of OpenID providers, refetched when a token names an unknown key.
+type jwksCache struct {
+	mu      sync.Mutex
+	keys    map[string]map[string]crypto.PublicKey
+	fetched map[string]time.Time
+}
+
+// key returns the key with kid from the set at jwksURL.
+func (c *jwksCache) key(ctx context.Context, client *http.Client, jwksURL, kid string) (crypto.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.keys[jwksURL][kid]; ok {
+		return key, nil
+	}
+
+	// providers rotate keys, so an unknown kid triggers a refetch, at most once a minute
+	if time.Since(c.fetched[jwksURL]) < time.Minute {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := getJSON(ctx, client, jwksURL, "", &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	if c.keys == nil {
+		c.keys = make(map[string]map[string]crypto.PublicKey)
+		c.fetched = make(map[string]time.Time)
+	}
+	c.keys[jwksURL], c.fetched[jwksURL] = keys, time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidIDToken, kid)
+	}
+
+	return key, nil
+}
+
+// verifyIDToken checks an ID token's signature against the provider's keys and its issuer, audience, expiry
+// and nonce, returning its claims.
+func (c *jwksCache) verifyIDToken(ctx context.Context, client *http.Client, p *AuthProvider, idToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+
+	key, err := c.key(ctx, client, p.JWKSURL, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+
+	valid := false
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		valid = header.Alg == "RS256" && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	case *ecdsa.PublicKey:
+		valid = header.Alg == "ES256" && len(sig) == 64 &&
+			ecdsa.Verify(k, digest[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]))
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, iss)
+	}
+	if !audienceContains(claims["aud"], p.ClientID) {
+		return nil, fmt.Errorf("%w: issued for another client", ErrInvalidIDToken)
+	}
+	if exp, _ := claims["exp"].(float64); time.Now().After(time.Unix(int64(exp), 0).Add(time.Minute)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// decodeJWTPart decodes a base64url JSON part of a JWT.
+func decodeJWTPart(part string, target interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil || json.Unmarshal(b, target) != nil {
+		return fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	return nil
+}
+
+// audienceContains reports whether an aud claim, a string or a list, contains clientID.
+func audienceContains(aud interface{}, clientID string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == clientID
+	case []interface{}:
+		for _, v := range a {
+			if v == clientID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
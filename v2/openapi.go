@@ -0,0 +1,478 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pathParamRegex matches the wildcards of http.ServeMux patterns, such as {id} and {path...}.
+var pathParamRegex = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Route describes an endpoint for OpenAPI generation.
+// Fields:
+// - Method: The HTTP method, e.g. http.MethodPost.
+// - Path: The path, using http.ServeMux wildcards, e.g. "/users/{id}".
+// - Summary: A short summary of the operation.
+// - Description: A longer description.
+// - Tags: Tags grouping the operation in documentation.
+// - OperationID: A unique ID for the operation. Defaults to one derived from the method and path.
+// - Request: A value of the type the handler binds, e.g. CreateUser{}. For GET, HEAD and DELETE its fields are
+// query parameters; otherwise it is the JSON request body. Its validate tags become schema constraints.
+// - Response: A value of the type of the success response, or nil for none.
+// - Status: The success status code. Defaults to 200.
+// - Handler: The handler, registered on the mux by OpenAPI.Handle.
+type Route struct {
+	Method      string
+	Path        string
+	Summary     string
+	Description string
+	Tags        []string
+	OperationID string
+	Request     interface{}
+	Response    interface{}
+	Status      int
+	Handler     http.Handler
+}
+
+// OpenAPI is a registry of routes from which an OpenAPI 3 document is generated.
+// Fields:
+// - Title: The API title.
+// - Version: The API version.
+// - Description: A description of the API.
+// - Servers: The base URLs of the API, e.g. "https://api.example.com".
+type OpenAPI struct {
+	Title       string
+	Version     string
+	Description string
+	Servers     []string
+
+	mu     sync.RWMutex
+	routes []Route
+}
+
+// NewOpenAPI returns an empty registry for an API.
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{Title: title, Version: version}
+}
+
+// Register adds a route to the document.
+func (api *OpenAPI) Register(route Route) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	api.routes = append(api.routes, route)
+}
+
+// Handle registers the route's handler on mux with a "METHOD /path" pattern and adds the route to the document.
+func (api *OpenAPI) Handle(mux *http.ServeMux, route Route) {
+	mux.Handle(strings.ToUpper(route.Method)+" "+route.Path, route.Handler)
+	api.Register(route)
+}
+
+// Spec generates the OpenAPI 3 document.
+// Returns the document, ready to be marshaled to JSON.
+func (api *OpenAPI) Spec() map[string]interface{} {
+	api.mu.RLock()
+	routes := append([]Route(nil), api.routes...)
+	api.mu.RUnlock()
+
+	gen := &schemaGenerator{components: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+
+	for _, route := range routes {
+		path := pathParamRegex.ReplaceAllString(route.Path, "{$1}")
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+
+		item[strings.ToLower(route.Method)] = gen.operation(route)
+	}
+
+	info := map[string]interface{}{"title": api.Title, "version": api.Version}
+	if api.Description != "" {
+		info["description"] = api.Description
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    info,
+		"paths":   paths,
+	}
+
+	if len(api.Servers) > 0 {
+		servers := make([]map[string]string, len(api.Servers))
+		for i, s := range api.Servers {
+			servers[i] = map[string]string{"url": s}
+		}
+		doc["servers"] = servers
+	}
+
+	if len(gen.components) > 0 {
+		doc["components"] = map[string]interface{}{"schemas": gen.components}
+	}
+
+	return doc
+}
+
+// OpenAPIHandler serves the document generated from api as JSON, e.g. at /openapi.json.
+func (t *Tools) OpenAPIHandler(api *OpenAPI) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = t.WriteJSON(w, http.StatusOK, api.Spec())
+	}
+}
+
+var swaggerUITemplate = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.onload = function () {
+  SwaggerUIBundle({url: {{.SpecURL}}, dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>
+`))
+
+// SwaggerUIHandler serves a Swagger UI page for the document at specURL, loading the UI from the unpkg CDN.
+// Parameters:
+// - specURL: The URL of the document, e.g. "/openapi.json".
+// - title: The page title.
+// Returns the handler.
+func (t *Tools) SwaggerUIHandler(specURL, title string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = swaggerUITemplate.Execute(w, map[string]string{"Title": title, "SpecURL": specURL})
+	}
+}
+
+// schemaGenerator builds JSON schemas, collecting named struct types as components.
+type schemaGenerator struct {
+	components map[string]interface{}
+}
+
+// operation builds the operation object of a route.
+func (gen *schemaGenerator) operation(route Route) map[string]interface{} {
+	op := map[string]interface{}{}
+
+	if route.Summary != "" {
+		op["summary"] = route.Summary
+	}
+	if route.Description != "" {
+		op["description"] = route.Description
+	}
+	if len(route.Tags) > 0 {
+		op["tags"] = route.Tags
+	}
+
+	op["operationId"] = route.OperationID
+	if route.OperationID == "" {
+		op["operationId"] = operationID(route.Method, route.Path)
+	}
+
+	var params []map[string]interface{}
+	pathParams := map[string]bool{}
+	for _, m := range pathParamRegex.FindAllStringSubmatch(route.Path, -1) {
+		pathParams[m[1]] = true
+		params = append(params, map[string]interface{}{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+		})
+	}
+
+	if route.Request != nil {
+		switch strings.ToUpper(route.Method) {
+		case http.MethodGet, http.MethodHead, http.MethodDelete:
+			params = append(params, gen.queryParams(reflect.TypeOf(route.Request), pathParams)...)
+		default:
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": gen.schema(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+	}
+
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(status)}
+	if route.Response != nil {
+		success["content"] = map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": gen.schema(reflect.TypeOf(route.Response))},
+		}
+	}
+
+	responses := map[string]interface{}{strconv.Itoa(status): success}
+
+	if route.Request != nil {
+		// the errors written by BindAndValidate
+		errorContent := map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": gen.schema(reflect.TypeOf(JSONResponse{}))},
+		}
+		responses["400"] = map[string]interface{}{"description": "Invalid request", "content": errorContent}
+		responses["422"] = map[string]interface{}{"description": "Validation failed", "content": errorContent}
+	}
+
+	op["responses"] = responses
+
+	return op
+}
+
+// operationID derives an operation ID such as "getUsersId" from a method and path.
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+
+	return id
+}
+
+// queryParams describes the fields of a request struct as query parameters, skipping path parameters.
+func (gen *schemaGenerator) queryParams(typ reflect.Type, skip map[string]bool) []map[string]interface{} {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []map[string]interface{}
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		// Bind matches query parameters the same way
+		name := fieldName(sf)
+		if name == sf.Name {
+			name = strings.ToLower(sf.Name)
+		}
+		if skip[name] {
+			continue
+		}
+
+		schema := gen.schema(sf.Type)
+		required := applyValidateTag(schema, sf.Tag.Get("validate"), sf.Type)
+
+		params = append(params, map[string]interface{}{
+			"name": name, "in": "query", "required": required, "schema": schema,
+		})
+	}
+
+	return params
+}
+
+// schema returns the JSON schema of typ, referencing named structs as components.
+func (gen *schemaGenerator) schema(typ reflect.Type) map[string]interface{} {
+	nullable := false
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+		nullable = true
+	}
+
+	s := gen.baseSchema(typ)
+	if nullable {
+		if _, isRef := s["$ref"]; isRef {
+			return map[string]interface{}{"allOf": []interface{}{s}, "nullable": true}
+		}
+		s["nullable"] = true
+	}
+
+	return s
+}
+
+// baseSchema returns the schema of a non-pointer type.
+func (gen *schemaGenerator) baseSchema(typ reflect.Type) map[string]interface{} {
+	switch {
+	case typ == reflect.TypeOf(time.Time{}):
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case typ == reflect.TypeOf(json.RawMessage{}):
+		return map[string]interface{}{}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": gen.schema(typ.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": gen.schema(typ.Elem())}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return gen.structSchema(typ)
+		}
+
+		name := typ.Name()
+		if _, ok := gen.components[name]; !ok {
+			// reserve the name first so recursive types terminate
+			gen.components[name] = map[string]interface{}{}
+			gen.components[name] = gen.structSchema(typ)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	// interfaces and anything else accept any value
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct, following encoding/json naming rules.
+func (gen *schemaGenerator) structSchema(typ reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+
+		// embedded structs without a json name are flattened, as encoding/json does
+		if sf.Anonymous && name == "" {
+			embedded := sf.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := gen.structSchema(embedded)
+				for k, v := range inner["properties"].(map[string]interface{}) {
+					properties[k] = v
+				}
+				if r, ok := inner["required"].([]string); ok {
+					required = append(required, r...)
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		schema := gen.schema(sf.Type)
+		if applyValidateTag(schema, sf.Tag.Get("validate"), sf.Type) {
+			required = append(required, name)
+		}
+
+		properties[name] = schema
+	}
+
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+
+	return s
+}
+
+// applyValidateTag adds the constraints of a validate tag to a schema, reporting whether the field is required.
+func applyValidateTag(schema map[string]interface{}, tag string, typ reflect.Type) bool {
+	if tag == "" || tag == "-" {
+		return false
+	}
+	if _, isRef := schema["$ref"]; isRef {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+
+	required := false
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		n, _ := strconv.ParseFloat(param, 64)
+
+		switch name {
+		case "required":
+			required = true
+		case "min", "max", "len":
+			var keys []string
+			switch typ.Kind() {
+			case reflect.String:
+				keys = []string{"minLength", "maxLength"}
+			case reflect.Slice, reflect.Array:
+				keys = []string{"minItems", "maxItems"}
+			case reflect.Map:
+				keys = []string{"minProperties", "maxProperties"}
+			default:
+				keys = []string{"minimum", "maximum"}
+			}
+
+			switch name {
+			case "min":
+				schema[keys[0]] = n
+			case "max":
+				schema[keys[1]] = n
+			case "len":
+				schema[keys[0]], schema[keys[1]] = n, n
+			}
+		case "oneof":
+			var enum []interface{}
+			for _, option := range strings.Fields(param) {
+				if f, err := strconv.ParseFloat(option, 64); err == nil && schema["type"] != "string" {
+					enum = append(enum, f)
+					continue
+				}
+				enum = append(enum, option)
+			}
+			schema["enum"] = enum
+		case "email":
+			schema["format"] = "email"
+		case "url":
+			schema["format"] = "uri"
+		case "alphanum":
+			schema["pattern"] = "^[a-zA-Z0-9]*$"
+		}
+	}
+
+	return required
+}
@@ -0,0 +1,119 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type openAPITestUser struct {
+	ID        int                `json:"id"`
+	Name      string             `json:"name"`
+	Friends   []*openAPITestUser `json:"friends,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+type openAPITestCreateUser struct {
+	Name  string `json:"name" validate:"required,min=2,max=50"`
+	Email string `json:"email" validate:"required,email"`
+	Role  string `json:"role" validate:"oneof=admin member"`
+}
+
+type openAPITestListUsers struct {
+	Page  int    `query:"page" validate:"min=1"`
+	Query string `query:"q"`
+}
+
+func TestOpenAPI_Spec(t *testing.T) {
+	var testTools Tools
+
+	api := NewOpenAPI("Users", "1.0.0")
+	mux := http.NewServeMux()
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	api.Handle(mux, Route{Method: http.MethodPost, Path: "/users", Request: openAPITestCreateUser{}, Response: openAPITestUser{}, Status: http.StatusCreated, Handler: ok})
+	api.Handle(mux, Route{Method: http.MethodGet, Path: "/users", Request: openAPITestListUsers{}, Response: []openAPITestUser{}, Handler: ok})
+	api.Handle(mux, Route{Method: http.MethodGet, Path: "/users/{id}", Summary: "Get a user", Response: openAPITestUser{}, Handler: ok})
+
+	rr := httptest.NewRecorder()
+	testTools.OpenAPIHandler(api).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Paths   map[string]map[string]struct {
+			OperationID string `json:"operationId"`
+			Parameters  []struct {
+				Name     string `json:"name"`
+				In       string `json:"in"`
+				Required bool   `json:"required"`
+			} `json:"parameters"`
+			RequestBody struct {
+				Content map[string]struct {
+					Schema map[string]interface{} `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]interface{} `json:"responses"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.OpenAPI != "3.0.3" || len(doc.Paths) != 2 {
+		t.Fatalf("unexpected document %s", rr.Body.String())
+	}
+
+	create := doc.Paths["/users"]["post"]
+	if create.RequestBody.Content["application/json"].Schema["$ref"] != "#/components/schemas/openAPITestCreateUser" {
+		t.Errorf("expected the request body to reference its schema, got %v", create.RequestBody)
+	}
+	if _, ok := create.Responses["201"]; !ok {
+		t.Errorf("expected a 201 response, got %v", create.Responses)
+	}
+
+	schema, _ := json.Marshal(doc.Components.Schemas["openAPITestCreateUser"])
+	for _, want := range []string{`"required":["email","name"]`, `"minLength":2`, `"maxLength":50`, `"format":"email"`, `"enum":["admin","member"]`} {
+		if !strings.Contains(string(schema), want) {
+			t.Errorf("expected %s in the create schema %s", want, schema)
+		}
+	}
+
+	user, _ := json.Marshal(doc.Components.Schemas["openAPITestUser"])
+	if !strings.Contains(string(user), `"format":"date-time"`) || !strings.Contains(string(user), `"$ref":"#/components/schemas/openAPITestUser"`) {
+		t.Errorf("unexpected user schema %s", user)
+	}
+
+	list := doc.Paths["/users"]["get"]
+	if len(list.Parameters) != 2 || list.Parameters[0].Name != "page" || list.Parameters[0].In != "query" {
+		t.Errorf("expected query parameters, got %+v", list.Parameters)
+	}
+
+	get := doc.Paths["/users/{id}"]["get"]
+	if len(get.Parameters) != 1 || get.Parameters[0].In != "path" || !get.Parameters[0].Required || get.OperationID != "getUsersId" {
+		t.Errorf("unexpected get operation %+v", get)
+	}
+
+	// the routes are registered on the mux too
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/users/1", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected the mux to know the routes, got %d", rr.Code)
+	}
+}
+
+func TestTools_SwaggerUIHandler(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.SwaggerUIHandler("/openapi.json", "Users API").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	if !strings.Contains(rr.Body.String(), `url: "/openapi.json"`) || !strings.Contains(rr.Body.String(), "<title>Users API</title>") {
+		t.Errorf("unexpected page %s", rr.Body.String())
+	}
+}
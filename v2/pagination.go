@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Pagination describes the pages of a listing, with links for templates.
+// Fields:
+// - Page: The current page, starting at 1.
+// - PerPage: The number of items per page.
+// - Total: The total number of items.
+// - TotalPages: The number of pages, at least 1.
+// - Prev: The URL of the previous page, or empty on the first page.
+// - Next: The URL of the next page, or empty on the last page.
+// - Pages: The page links to show: the first and last pages and a window around the current one, with gaps
+// between them.
+type Pagination struct {
+	Page       int
+	PerPage    int
+	Total      int
+	TotalPages int
+	Prev       string
+	Next       string
+	Pages      []PageLink
+}
+
+// PageLink is a link in Pagination.Pages.
+// Fields:
+// - Number: The page number, or 0 for a gap, usually shown as an ellipsis.
+// - URL: The page's URL.
+// - Current: Whether this is the current page.
+type PageLink struct {
+	Number  int
+	URL     string
+	Current bool
+}
+
+// Offset returns the index of the first item of the current page, for SQL OFFSET clauses.
+func (p *Pagination) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// NewPagination computes the pages of a listing. Links are built from u by setting its "page" query parameter,
+// keeping the others, such as filters and sorting.
+// Parameters:
+// - u: The URL of the current page.
+// - page: The current page. It is clamped to the valid range.
+// - perPage: The number of items per page. Values below 1 are treated as 1.
+// - total: The total number of items.
+// Returns the pagination.
+func NewPagination(u *url.URL, page, perPage, total int) *Pagination {
+	if perPage < 1 {
+		perPage = 1
+	}
+
+	p := &Pagination{PerPage: perPage, Total: total, TotalPages: (total + perPage - 1) / perPage}
+	if p.TotalPages < 1 {
+		p.TotalPages = 1
+	}
+	p.Page = min(max(page, 1), p.TotalPages)
+
+	base := URLBuilderFrom(u)
+	link := func(n int) string {
+		return base.Set("page", strconv.Itoa(n)).String()
+	}
+
+	if p.Page > 1 {
+		p.Prev = link(p.Page - 1)
+	}
+	if p.Page < p.TotalPages {
+		p.Next = link(p.Page + 1)
+	}
+
+	// the first and last pages, and two pages on each side of the current one
+	numbers := []int{1}
+	for n := max(p.Page-2, 2); n <= min(p.Page+2, p.TotalPages-1); n++ {
+		numbers = append(numbers, n)
+	}
+	if p.TotalPages > 1 {
+		numbers = append(numbers, p.TotalPages)
+	}
+
+	for i, n := range numbers {
+		if i > 0 && n > numbers[i-1]+1 {
+			p.Pages = append(p.Pages, PageLink{})
+		}
+		p.Pages = append(p.Pages, PageLink{Number: n, URL: link(n), Current: n == p.Page})
+	}
+
+	return p
+}
+
+// LinkHeader formats the first, prev, next and last links as an RFC 8288 Link header value, for paginated APIs.
+// Returns the value, e.g. `<https://api.example.com/users?page=3>; rel="next", ...`.
+func (p *Pagination) LinkHeader() string {
+	links := []struct{ url, rel string }{{p.Pages[0].URL, "first"}, {p.Prev, "prev"}, {p.Next, "next"}, {p.Pages[len(p.Pages)-1].URL, "last"}}
+
+	var parts []string
+	for _, l := range links {
+		if l.url != "" {
+			parts = append(parts, fmt.Sprintf(`<%s>; rel="%s"`, l.url, l.rel))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// RequestPage reads the "page" query parameter of a URL, e.g. r.URL.
+// Returns the page, or 1 if it is missing or invalid.
+func RequestPage(u *url.URL) int {
+	page, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+
+	return page
+}
@@ -0,0 +1,68 @@
+package toolkit
+
+import (
+	"net/url"
+	"testing"
+)
+
+var paginationTests = []struct {
+	name       string
+	page       int
+	total      int
+	totalPages int
+	current    int
+	prev       string
+	next       string
+	pages      []int
+}{
+	{name: "empty", page: 1, total: 0, totalPages: 1, current: 1, pages: []int{1}},
+	{name: "first", page: 1, total: 95, totalPages: 10, current: 1, next: "/users?page=2&sort=name", pages: []int{1, 2, 3, 0, 10}},
+	{name: "middle", page: 5, total: 95, totalPages: 10, current: 5, prev: "/users?page=4&sort=name", next: "/users?page=6&sort=name", pages: []int{1, 0, 3, 4, 5, 6, 7, 0, 10}},
+	{name: "clamped", page: 99, total: 95, totalPages: 10, current: 10, prev: "/users?page=9&sort=name", pages: []int{1, 0, 8, 9, 10}},
+	{name: "few pages", page: 2, total: 30, totalPages: 3, current: 2, prev: "/users?page=1&sort=name", next: "/users?page=3&sort=name", pages: []int{1, 2, 3}},
+}
+
+func TestNewPagination(t *testing.T) {
+	u, _ := url.Parse("/users?sort=name&page=3")
+
+	for _, e := range paginationTests {
+		p := NewPagination(u, e.page, 10, e.total)
+
+		if p.TotalPages != e.totalPages || p.Page != e.current || p.Prev != e.prev || p.Next != e.next {
+			t.Errorf("%s: unexpected pagination %+v", e.name, p)
+		}
+
+		var pages []int
+		for _, l := range p.Pages {
+			pages = append(pages, l.Number)
+			if l.Current != (l.Number == p.Page) {
+				t.Errorf("%s: unexpected current flag on page %d", e.name, l.Number)
+			}
+		}
+		if len(pages) != len(e.pages) {
+			t.Errorf("%s: expected pages %v, got %v", e.name, e.pages, pages)
+			continue
+		}
+		for i := range pages {
+			if pages[i] != e.pages[i] {
+				t.Errorf("%s: expected pages %v, got %v", e.name, e.pages, pages)
+				break
+			}
+		}
+	}
+
+	if p := NewPagination(u, 3, 10, 95); p.Offset() != 20 {
+		t.Errorf("expected offset 20, got %d", p.Offset())
+	}
+
+	if got := NewPagination(u, 5, 10, 95).LinkHeader(); got != `</users?page=1&sort=name>; rel="first", </users?page=4&sort=name>; rel="prev", </users?page=6&sort=name>; rel="next", </users?page=10&sort=name>; rel="last"` {
+		t.Errorf("unexpected Link header %s", got)
+	}
+
+	if RequestPage(u) != 3 {
+		t.Error("expected page 3 from the query")
+	}
+	if bad, _ := url.Parse("/users?page=-2"); RequestPage(bad) != 1 {
+		t.Error("expected page 1 for an invalid page")
+	}
+}
@@ -0,0 +1,269 @@
+package toolkit
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Platform is a hosting platform recognized by DetectPlatform.
+type Platform string
+
+// The platforms recognized by DetectPlatform.
+const (
+	PlatformLocal    Platform = "local"
+	PlatformHeroku   Platform = "heroku"
+	PlatformCloudRun Platform = "cloudrun"
+)
+
+// DetectPlatform returns the platform the process runs on, from the environment variables each platform sets:
+// DYNO on Heroku and K_SERVICE on Cloud Run. Elsewhere it returns PlatformLocal.
+func DetectPlatform() Platform {
+	switch {
+	case os.Getenv("DYNO") != "":
+		return PlatformHeroku
+	case os.Getenv("K_SERVICE") != "":
+		return PlatformCloudRun
+	}
+
+	return PlatformLocal
+}
+
+// PlatformMemory returns the memory available to the process, in bytes: the MEMORY_AVAILABLE variable in
+// megabytes set by Heroku buildpacks, else the container's cgroup limit, else the machine's memory. It returns 0
+// if none is known.
+func PlatformMemory() uint64 {
+	if mb, err := strconv.ParseUint(os.Getenv("MEMORY_AVAILABLE"), 10, 64); err == nil && mb > 0 {
+		return mb << 20
+	}
+
+	mi := readMemoryInfo()
+	if mi.Limit > 0 {
+		return mi.Limit
+	}
+
+	return mi.Total
+}
+
+// ApplyMemoryLimits sizes the request limits left unset to the memory of a dyno or container, so large uploads
+// and bodies cannot exhaust it: uploads keep at most 1/32 of the memory buffered, and JSON bodies are limited to
+// 1/1024 of it, between 64 KB and 1 MB. Limits already set are kept.
+// Parameters:
+// - memory: The memory available, in bytes, e.g. from PlatformMemory. If 0, nothing is changed.
+func (t *Tools) ApplyMemoryLimits(memory uint64) {
+	if memory == 0 {
+		return
+	}
+
+	if t.Multipart.MaxMemory <= 0 {
+		t.Multipart.MaxMemory = int64(memory / 32)
+	}
+	if t.MaxJSONSize <= 0 {
+		t.MaxJSONSize = int(min(max(memory/1024, 64<<10), 1<<20))
+	}
+}
+
+// ProxyOptions configures ProxyHeadersMiddleware.
+// Fields:
+// - Hops: The number of trusted proxies in front of the server, each appending the address it received the
+// request from to X-Forwarded-For. Defaults to 1, the router of Heroku or the front end of Cloud Run.
+// - TrustHost: Use X-Forwarded-Host as the request's Host. Only set it when the proxy sets that header itself.
+type ProxyOptions struct {
+	Hops      int
+	TrustHost bool
+}
+
+// ProxyHeadersMiddleware applies the headers of trusted reverse proxies to requests, for handlers and middleware
+// reading r.RemoteAddr, such as GeoMiddleware and rate limits, and links built from r.URL.Scheme: the client's
+// address is taken from X-Forwarded-For, counting Hops addresses from the right so clients cannot forge it, and
+// the scheme from X-Forwarded-Proto. Requests are not changed when the headers are missing or invalid.
+// Only use it behind proxies that set these headers, or any client can choose its address.
+// Parameters:
+// - opts: Optional ProxyOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) ProxyHeadersMiddleware(opts ...ProxyOptions) func(http.Handler) http.Handler {
+	var o ProxyOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Hops <= 0 {
+		o.Hops = 1
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			r2.URL = &u
+
+			if ip := forwardedClient(r.Header.Values("X-Forwarded-For"), o.Hops); ip != "" {
+				_, port, err := net.SplitHostPort(r.RemoteAddr)
+				if err != nil {
+					port = "0"
+				}
+				r2.RemoteAddr = net.JoinHostPort(ip, port)
+			}
+
+			if proto := strings.ToLower(lastListValue(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+				r2.URL.Scheme = proto
+			}
+
+			if host := lastListValue(r.Header.Get("X-Forwarded-Host")); o.TrustHost && host != "" {
+				r2.Host = host
+			}
+
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// forwardedClient returns the address hops entries from the right of X-Forwarded-For, or "" if there is none.
+func forwardedClient(values []string, hops int) string {
+	var addrs []string
+	for _, v := range values {
+		for _, addr := range strings.Split(v, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, addr)
+			}
+		}
+	}
+	if len(addrs) < hops {
+		return ""
+	}
+
+	ip := net.ParseIP(addrs[len(addrs)-hops])
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// lastListValue returns the last element of a comma-separated header value, the one added by the nearest proxy.
+func lastListValue(v string) string {
+	return strings.TrimSpace(v[strings.LastIndex(v, ",")+1:])
+}
+
+// NewPlatformLogHandler returns a slog.Handler writing in the format a platform's log collector expects: JSON
+// with "severity" and "message" fields on Cloud Run, so Cloud Logging shows levels, and logfmt lines without a
+// timestamp on Heroku, whose log router adds its own. Elsewhere it writes logfmt lines with timestamps.
+// Parameters:
+// - platform: The platform, e.g. from DetectPlatform.
+// - w: Where to write, usually os.Stdout.
+// - opts: The handler options. A ReplaceAttr function runs before the platform's renaming.
+// Returns the handler.
+func NewPlatformLogHandler(platform Platform, w io.Writer, opts *slog.HandlerOptions) slog.Handler {
+	var o slog.HandlerOptions
+	if opts != nil {
+		o = *opts
+	}
+	replace := o.ReplaceAttr
+
+	switch platform {
+	case PlatformCloudRun:
+		o.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if replace != nil {
+				a = replace(groups, a)
+			}
+			if len(groups) > 0 {
+				return a
+			}
+			switch a.Key {
+			case slog.LevelKey:
+				return slog.String("severity", cloudLoggingSeverity(a.Value))
+			case slog.MessageKey:
+				a.Key = "message"
+			}
+			return a
+		}
+		return slog.NewJSONHandler(w, &o)
+	case PlatformHeroku:
+		o.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			if replace != nil {
+				a = replace(groups, a)
+			}
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		}
+	}
+
+	return slog.NewTextHandler(w, &o)
+}
+
+// cloudLoggingSeverity maps a slog level to the nearest Cloud Logging severity.
+func cloudLoggingSeverity(v slog.Value) string {
+	level, ok := v.Any().(slog.Level)
+	if !ok {
+		return v.String()
+	}
+
+	switch {
+	case level >= slog.LevelError:
+		return "ERROR"
+	case level >= slog.LevelWarn:
+		return "WARNING"
+	case level >= slog.LevelInfo:
+		return "INFO"
+	}
+
+	return "DEBUG"
+}
+
+// ServePlatform runs the server configured for the platform it runs on, as a single call for Heroku, Cloud Run
+// and similar hosts: it listens on $PORT, trusts one proxy's headers through ProxyHeadersMiddleware when on a
+// known platform, sizes the request limits left unset with ApplyMemoryLimits and PlatformMemory, and sets the
+// default slog logger to a NewPlatformLogHandler on stdout, before calling Serve. On Cloud Run, ShutdownTimeout
+// defaults to 8 seconds, within the 10 seconds the container is given after SIGTERM.
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//	err := tools.ServePlatform(ctx, mux)
+//
+// Parameters:
+// - ctx: Stops the server when done.
+// - handler: The handler serving requests.
+// - opts: Optional ServeOptions, passed to Serve. Only the first value is used if multiple are provided.
+// Returns the error of Serve.
+func (t *Tools) ServePlatform(ctx context.Context, handler http.Handler, opts ...ServeOptions) error {
+	var o ServeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	platform := DetectPlatform()
+	if platform == PlatformCloudRun && o.ShutdownTimeout <= 0 {
+		// Cloud Run stops the container 10 seconds after SIGTERM
+		o.ShutdownTimeout = 8 * time.Second
+	}
+	slog.SetDefault(slog.New(NewPlatformLogHandler(platform, os.Stdout, nil)))
+
+	t.ApplyMemoryLimits(PlatformMemory())
+	if platform != PlatformLocal {
+		handler = t.ProxyHeadersMiddleware()(handler)
+	}
+
+	slog.Info("starting server", "platform", string(platform), "addr", platformAddr(o.Addr))
+
+	return t.Serve(ctx, handler, o)
+}
+
+// platformAddr returns addr, or the address Serve listens on by default.
+func platformAddr(addr string) string {
+	if addr != "" {
+		return addr
+	}
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
+
+	return ":8080"
+}
@@ -0,0 +1,189 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := []struct {
+		dyno, service string
+		want          Platform
+	}{
+		{"", "", PlatformLocal},
+		{"web.1", "", PlatformHeroku},
+		{"", "api", PlatformCloudRun},
+	}
+
+	for _, e := range tests {
+		t.Setenv("DYNO", e.dyno)
+		t.Setenv("K_SERVICE", e.service)
+		if got := DetectPlatform(); got != e.want {
+			t.Errorf("%q %q: expected %s, got %s", e.dyno, e.service, e.want, got)
+		}
+	}
+}
+
+func TestPlatformMemory(t *testing.T) {
+	t.Setenv("MEMORY_AVAILABLE", "512")
+	if got := PlatformMemory(); got != 512<<20 {
+		t.Errorf("expected the Heroku memory, got %d", got)
+	}
+
+	t.Setenv("MEMORY_AVAILABLE", "")
+	if got := PlatformMemory(); got == 0 && readMemoryInfo().Total != 0 {
+		t.Error("expected the container or machine memory")
+	}
+}
+
+func TestTools_ApplyMemoryLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		tools       Tools
+		memory      uint64
+		maxMemory   int64
+		maxJSONSize int
+	}{
+		{"small dyno", Tools{}, 512 << 20, 16 << 20, 512 << 10},
+		{"tiny container", Tools{}, 32 << 20, 1 << 20, 64 << 10},
+		{"large container", Tools{}, 8 << 30, 256 << 20, 1 << 20},
+		{"limits already set", Tools{MaxJSONSize: 100, Multipart: MultipartOptions{MaxMemory: 200}}, 512 << 20, 200, 100},
+		{"unknown memory", Tools{}, 0, 0, 0},
+	}
+
+	for _, e := range tests {
+		testTools := e.tools
+		testTools.ApplyMemoryLimits(e.memory)
+		if testTools.Multipart.MaxMemory != e.maxMemory || testTools.MaxJSONSize != e.maxJSONSize {
+			t.Errorf("%s: expected %d and %d, got %d and %d", e.name, e.maxMemory, e.maxJSONSize, testTools.Multipart.MaxMemory, testTools.MaxJSONSize)
+		}
+	}
+}
+
+func TestTools_ProxyHeadersMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ProxyOptions
+		headers map[string]string
+		addr    string
+		scheme  string
+		host    string
+	}{
+		{"no headers", ProxyOptions{}, nil, "10.0.0.1:4000", "", "example.com"},
+		{"one hop", ProxyOptions{}, map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Forwarded-Proto": "https"}, "203.0.113.7:4000", "https", "example.com"},
+		{"forged entry", ProxyOptions{}, map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.7"}, "203.0.113.7:4000", "", "example.com"},
+		{"two hops", ProxyOptions{Hops: 2}, map[string]string{"X-Forwarded-For": "1.1.1.1, 203.0.113.7, 10.1.1.1"}, "203.0.113.7:4000", "", "example.com"},
+		{"too few hops", ProxyOptions{Hops: 2}, map[string]string{"X-Forwarded-For": "203.0.113.7"}, "10.0.0.1:4000", "", "example.com"},
+		{"invalid address", ProxyOptions{}, map[string]string{"X-Forwarded-For": "unknown", "X-Forwarded-Proto": "gopher"}, "10.0.0.1:4000", "", "example.com"},
+		{"ipv6", ProxyOptions{}, map[string]string{"X-Forwarded-For": "2001:db8::1"}, "[2001:db8::1]:4000", "", "example.com"},
+		{"host ignored", ProxyOptions{}, map[string]string{"X-Forwarded-Host": "evil.test"}, "10.0.0.1:4000", "", "example.com"},
+		{"host trusted", ProxyOptions{TrustHost: true}, map[string]string{"X-Forwarded-Host": "app.example.com"}, "10.0.0.1:4000", "", "app.example.com"},
+	}
+
+	var testTools Tools
+	for _, e := range tests {
+		var got *http.Request
+		h := testTools.ProxyHeadersMiddleware(e.opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Host = "example.com"
+		req.RemoteAddr = "10.0.0.1:4000"
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		if got.RemoteAddr != e.addr || got.URL.Scheme != e.scheme || got.Host != e.host {
+			t.Errorf("%s: expected %s %q %s, got %s %q %s", e.name, e.addr, e.scheme, e.host, got.RemoteAddr, got.URL.Scheme, got.Host)
+		}
+		if req.RemoteAddr != "10.0.0.1:4000" || req.URL.Scheme != "" {
+			t.Errorf("%s: expected the original request unchanged", e.name)
+		}
+	}
+}
+
+func TestNewPlatformLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(NewPlatformLogHandler(PlatformCloudRun, &buf, nil)).Warn("disk low", "free", 3)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["severity"] != "WARNING" || entry["message"] != "disk low" || entry["free"] != float64(3) || entry["time"] == nil {
+		t.Errorf("expected a Cloud Logging entry, got %s", buf.String())
+	}
+
+	buf.Reset()
+	slog.New(NewPlatformLogHandler(PlatformHeroku, &buf, nil)).Info("started", "port", 5000)
+	if got := buf.String(); got != "level=INFO msg=started port=5000\n" {
+		t.Errorf("expected a logfmt line without a timestamp, got %q", got)
+	}
+
+	buf.Reset()
+	slog.New(NewPlatformLogHandler(PlatformLocal, &buf, &slog.HandlerOptions{Level: slog.LevelWarn})).Info("hidden")
+	if buf.Len() != 0 {
+		t.Errorf("expected the handler options used, got %q", buf.String())
+	}
+}
+
+func TestTools_ServePlatform(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	t.Setenv("PORT", port)
+	t.Setenv("DYNO", "web.1")
+	t.Setenv("K_SERVICE", "")
+	defer slog.SetDefault(slog.Default())
+
+	var testTools Tools
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- testTools.ServePlatform(ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.RemoteAddr))
+		}))
+	}()
+
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1:"+port, nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			continue
+		}
+		var b bytes.Buffer
+		_, _ = b.ReadFrom(resp.Body)
+		resp.Body.Close()
+		body = b.String()
+		break
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected a graceful shutdown, got %v", err)
+	}
+
+	if !strings.HasPrefix(body, "203.0.113.7:") {
+		t.Errorf("expected the server on $PORT (%s) trusting the router, got %q", port, body)
+	}
+	if testTools.Multipart.MaxMemory == 0 {
+		t.Error("expected the memory limits applied")
+	}
+}
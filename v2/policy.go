@@ -0,0 +1,210 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrUnauthenticated is returned by Authorize when a policy denies a request without a subject.
+var ErrUnauthenticated = errors.New("authentication required")
+
+// Policy decides whether the subject may perform a request. It returns nil to allow it, an error matching
+// ErrForbidden to deny it, or any other error if the decision could not be made, e.g. because a database lookup
+// failed. Policies are combined with AllOf, AnyOf and Not:
+//
+//	toolkit.AnyOf(toolkit.RequireRole("admin"), toolkit.AllOf(toolkit.RequireClaim("plan", "pro"), toolkit.RequireOwner(invoiceOwner)))
+type Policy func(r *http.Request, subject Subject) error
+
+// RequireAuthenticated allows every request with a subject ID.
+func RequireAuthenticated() Policy {
+	return func(r *http.Request, subject Subject) error {
+		if subject.ID == "" {
+			return fmt.Errorf("%w: authentication required", ErrForbidden)
+		}
+		return nil
+	}
+}
+
+// RequireRole allows subjects with any of the roles.
+func RequireRole(roles ...string) Policy {
+	return func(r *http.Request, subject Subject) error {
+		for _, role := range roles {
+			if subject.HasRole(role) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: role %s required", ErrForbidden, strings.Join(roles, " or "))
+	}
+}
+
+// RequireClaim allows subjects whose claim has any of the values, or any value when none are given, e.g.
+// RequireClaim("plan", "pro", "enterprise") or RequireClaim("email_verified", "true").
+func RequireClaim(name string, values ...string) Policy {
+	return func(r *http.Request, subject Subject) error {
+		v, ok := subject.Claims[name]
+		if ok && len(values) == 0 {
+			return nil
+		}
+		for _, allowed := range values {
+			if ok && v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: claim %s required", ErrForbidden, name)
+	}
+}
+
+// RequireOwner allows the subject owning the requested resource.
+// Parameters:
+// - owner: Returns the ID of the resource's owner, e.g. by loading the invoice named in the path. Its error is
+// returned by the policy, so a failed lookup is not mistaken for a denial; return an error matching ErrForbidden
+// to deny the request instead.
+// Returns the policy.
+func RequireOwner(owner func(r *http.Request) (string, error)) Policy {
+	return func(r *http.Request, subject Subject) error {
+		id, err := owner(r)
+		if err != nil {
+			return err
+		}
+		if subject.ID == "" || id != subject.ID {
+			return fmt.Errorf("%w: not the owner", ErrForbidden)
+		}
+		return nil
+	}
+}
+
+// AllOf allows a request when every policy allows it, evaluating them in order.
+func AllOf(policies ...Policy) Policy {
+	return func(r *http.Request, subject Subject) error {
+		for _, p := range policies {
+			if err := p(r, subject); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf allows a request when any policy allows it, evaluating them in order. If all deny it, the first denial is
+// returned; an error other than a denial is returned immediately.
+func AnyOf(policies ...Policy) Policy {
+	return func(r *http.Request, subject Subject) error {
+		denial := fmt.Errorf("%w: no policy allows the request", ErrForbidden)
+		for i, p := range policies {
+			err := p(r, subject)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, ErrForbidden) {
+				return err
+			}
+			if i == 0 {
+				denial = err
+			}
+		}
+		return denial
+	}
+}
+
+// Not allows a request when the policy denies it, e.g. Not(RequireRole("suspended")).
+func Not(policy Policy) Policy {
+	return func(r *http.Request, subject Subject) error {
+		err := policy(r, subject)
+		switch {
+		case err == nil:
+			return fmt.Errorf("%w: policy not satisfied", ErrForbidden)
+		case errors.Is(err, ErrForbidden):
+			return nil
+		default:
+			return err
+		}
+	}
+}
+
+// AccessDeniedEvent is an audit record of a request denied by Authorize.
+// Fields:
+// - Time: When the request was denied.
+// - Subject: The subject, with an empty ID for anonymous requests.
+// - Method: The request method.
+// - Path: The request path.
+// - RemoteAddr: The client address.
+// - Reason: Why the policy denied the request.
+type AccessDeniedEvent struct {
+	Time       time.Time
+	Subject    Subject
+	Method     string
+	Path       string
+	RemoteAddr string
+	Reason     string
+}
+
+// AuthorizeOptions configures Authorize.
+// Fields:
+// - Audit: Receives an event for every denied request, e.g. to store it or publish it on an EventBus. Defaults to
+// logging a warning with slog.Default().
+type AuthorizeOptions struct {
+	Audit func(ctx context.Context, e AccessDeniedEvent)
+}
+
+// Authorize returns middleware enforcing a policy against the Subject stored in the request context, e.g. by
+// RememberMeMiddleware or MTLSMiddleware. Requests without a subject are evaluated with the zero Subject.
+// Parameters:
+// - policy: The policy, e.g. RequireRole("admin").
+// - opts: Optional AuthorizeOptions. Only the first value is used if multiple are provided.
+// Returns the middleware. Denied requests are audited and answered with a JSON error: 401 Unauthorized wrapping
+// ErrUnauthenticated for anonymous requests and 403 Forbidden otherwise. Other policy errors are answered with
+// 500 Internal Server Error without exposing them.
+func (t *Tools) Authorize(policy Policy, opts ...AuthorizeOptions) func(http.Handler) http.Handler {
+	var o AuthorizeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Audit == nil {
+		o.Audit = logAccessDenied
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject, _ := SubjectFromContext(r.Context())
+
+			err := policy(r, subject)
+			switch {
+			case err == nil:
+				next.ServeHTTP(w, r)
+			case errors.Is(err, ErrForbidden):
+				o.Audit(r.Context(), AccessDeniedEvent{
+					Time:       time.Now(),
+					Subject:    subject,
+					Method:     r.Method,
+					Path:       r.URL.Path,
+					RemoteAddr: r.RemoteAddr,
+					Reason:     err.Error(),
+				})
+
+				if subject.ID == "" {
+					_ = t.ErrorJSON(w, ErrUnauthenticated, http.StatusUnauthorized)
+					return
+				}
+				_ = t.ErrorJSON(w, err, http.StatusForbidden)
+			default:
+				_ = t.ErrorJSON(w, errors.New(http.StatusText(http.StatusInternalServerError)), http.StatusInternalServerError)
+			}
+		})
+	}
+}
+
+// logAccessDenied is the default audit of Authorize.
+func logAccessDenied(ctx context.Context, e AccessDeniedEvent) {
+	slog.Default().WarnContext(ctx, "access denied",
+		slog.String("subject", e.Subject.ID),
+		slog.String("method", e.Method),
+		slog.String("path", e.Path),
+		slog.String("remote_addr", e.RemoteAddr),
+		slog.String("reason", e.Reason),
+	)
+}
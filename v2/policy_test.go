@@ -0,0 +1,85 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var policyTests = []struct {
+	name     string
+	policy   Policy
+	subject  *Subject
+	path     string
+	expected int
+	audited  bool
+}{
+	{name: "role allowed", policy: RequireRole("admin", "editor"), subject: &Subject{ID: "1", Roles: []string{"editor"}}, expected: http.StatusOK},
+	{name: "role denied", policy: RequireRole("admin"), subject: &Subject{ID: "1", Roles: []string{"editor"}}, expected: http.StatusForbidden, audited: true},
+	{name: "anonymous", policy: RequireAuthenticated(), expected: http.StatusUnauthorized, audited: true},
+	{name: "claim allowed", policy: RequireClaim("plan", "pro"), subject: &Subject{ID: "1", Claims: map[string]string{"plan": "pro"}}, expected: http.StatusOK},
+	{name: "claim denied", policy: RequireClaim("plan", "pro"), subject: &Subject{ID: "1", Claims: map[string]string{"plan": "free"}}, expected: http.StatusForbidden, audited: true},
+	{name: "owner allowed", policy: RequireOwner(invoiceOwner), subject: &Subject{ID: "ann"}, path: "/invoices/1", expected: http.StatusOK},
+	{name: "owner denied", policy: RequireOwner(invoiceOwner), subject: &Subject{ID: "bob"}, path: "/invoices/1", expected: http.StatusForbidden, audited: true},
+	{name: "owner lookup failed", policy: RequireOwner(invoiceOwner), subject: &Subject{ID: "ann"}, path: "/invoices/2", expected: http.StatusInternalServerError},
+	{
+		name:     "any of",
+		policy:   AnyOf(RequireRole("admin"), AllOf(RequireClaim("plan"), RequireOwner(invoiceOwner))),
+		subject:  &Subject{ID: "ann", Claims: map[string]string{"plan": "pro"}},
+		path:     "/invoices/1",
+		expected: http.StatusOK,
+	},
+	{
+		name:     "all of",
+		policy:   AllOf(RequireClaim("plan"), RequireOwner(invoiceOwner)),
+		subject:  &Subject{ID: "ann"},
+		path:     "/invoices/1",
+		expected: http.StatusForbidden,
+		audited:  true,
+	},
+	{name: "not", policy: Not(RequireRole("suspended")), subject: &Subject{ID: "1", Roles: []string{"suspended"}}, expected: http.StatusForbidden, audited: true},
+}
+
+// invoiceOwner owns invoice 1 by ann and fails to look up any other.
+func invoiceOwner(r *http.Request) (string, error) {
+	if strings.HasSuffix(r.URL.Path, "/1") {
+		return "ann", nil
+	}
+	return "", errors.New("database unavailable")
+}
+
+func TestTools_Authorize(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range policyTests {
+		var audited []AccessDeniedEvent
+		handler := testTools.Authorize(e.policy, AuthorizeOptions{Audit: func(ctx context.Context, ev AccessDeniedEvent) {
+			audited = append(audited, ev)
+		}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		path := e.path
+		if path == "" {
+			path = "/"
+		}
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if e.subject != nil {
+			req = req.WithContext(WithSubject(req.Context(), *e.subject))
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expected {
+			t.Errorf("%s: expected %d, got %d: %s", e.name, e.expected, rr.Code, rr.Body.String())
+		}
+		if (len(audited) > 0) != e.audited {
+			t.Errorf("%s: expected audited %v, got %v", e.name, e.audited, audited)
+		}
+		if e.expected == http.StatusInternalServerError && strings.Contains(rr.Body.String(), "database") {
+			t.Errorf("%s: expected the internal error to be hidden, got %s", e.name, rr.Body.String())
+		}
+	}
+}
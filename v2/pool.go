@@ -0,0 +1,56 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// maxPooledBufferSize is the capacity above which buffers are dropped instead of pooled, so one large response
+// does not keep its memory alive for the life of the process.
+const maxPooledBufferSize = 64 << 10
+
+// bufferPool holds the buffers responses are encoded into.
+var bufferPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+
+	return buf
+}
+
+// putBuffer returns buf to the pool. Its contents must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	bufferPool.Put(buf)
+}
+
+// copyBufferPool holds the buffers used to copy uploads and files.
+var copyBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32<<10)
+		return &b
+	},
+}
+
+// copyBuffered copies src to dst like io.Copy, with a buffer from the pool.
+func copyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	if _, ok := src.(*os.File); ok {
+		// copies from files may be done by the kernel without a buffer, e.g. with copy_file_range
+		return io.Copy(dst, src)
+	}
+
+	bp := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(bp)
+
+	// hide dst's ReadFrom, such as *os.File's, which allocates its own buffer for readers the kernel cannot copy
+	return io.CopyBuffer(struct{ io.Writer }{dst}, src, *bp)
+}
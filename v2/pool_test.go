@@ -0,0 +1,70 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCopyBuffered(t *testing.T) {
+	src := strings.Repeat("toolkit", 10000)
+
+	var dst bytes.Buffer
+	n, err := copyBuffered(&dst, io.LimitReader(strings.NewReader(src), int64(len(src))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(src)) || dst.String() != src {
+		t.Errorf("expected %d bytes to be copied, got %d", len(src), n)
+	}
+}
+
+func TestPutBuffer(t *testing.T) {
+	buf := getBuffer()
+	buf.Grow(maxPooledBufferSize + 1)
+	putBuffer(buf)
+
+	if got := getBuffer(); got.Len() != 0 {
+		t.Errorf("expected an empty buffer, got %d bytes", got.Len())
+	}
+}
+
+func BenchmarkTools_WriteJSON(b *testing.B) {
+	var testTools Tools
+	payload := struct {
+		ID    int      `json:"id"`
+		Name  string   `json:"name"`
+		Tags  []string `json:"tags"`
+		Notes string   `json:"notes"`
+	}{ID: 42, Name: "Ann", Tags: []string{"a", "b", "c"}, Notes: strings.Repeat("x", 1024)}
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rr := httptest.NewRecorder()
+			_ = testTools.WriteJSON(rr, 200, payload)
+		}
+	})
+}
+
+func BenchmarkCopyBuffered(b *testing.B) {
+	src := bytes.Repeat([]byte("x"), 1<<20)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		_, _ = copyBuffered(struct{ io.Writer }{io.Discard}, io.LimitReader(bytes.NewReader(src), int64(len(src))))
+	}
+}
+
+func BenchmarkIOCopy(b *testing.B) {
+	src := bytes.Repeat([]byte("x"), 1<<20)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(src)))
+	for i := 0; i < b.N; i++ {
+		_, _ = io.Copy(struct{ io.Writer }{io.Discard}, io.LimitReader(bytes.NewReader(src), int64(len(src))))
+	}
+}
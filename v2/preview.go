@@ -0,0 +1,391 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	_ "image/gif"  // register GIF decoding for image previews
+	_ "image/jpeg" // register JPEG decoding for image previews
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrConverterUnavailable is returned by a PreviewConverter whose external tool is not installed.
+var ErrConverterUnavailable = errors.New("preview converter unavailable")
+
+// Preview is a rendered preview of a document.
+// Fields:
+// - MIMEType: "image/png" for rendered pages and images, or "text/html" for text snippets.
+// - Data: The preview content.
+// - Converter: The name of the converter that produced it, or "snippet" for the text fallback.
+type Preview struct {
+	MIMEType  string
+	Data      []byte
+	Converter string
+}
+
+// PreviewConverter renders previews of some document types.
+type PreviewConverter interface {
+	// Name identifies the converter, e.g. "pdftoppm".
+	Name() string
+	// Accepts reports whether the converter handles the MIME type.
+	Accepts(mimeType string) bool
+	// Convert renders a preview of the file at src. It returns ErrConverterUnavailable if it cannot run.
+	Convert(ctx context.Context, src, mimeType string) (*Preview, error)
+}
+
+// Previewer renders previews of uploaded files for listing UIs. Converters are tried in order, skipping those
+// that are unavailable or fail; when none succeeds, a text snippet extracted with Tools.ExtractText is rendered
+// as HTML instead, so a missing tool degrades the preview rather than breaking the listing.
+// Fields:
+// - Converters: The converters, tried in order. NewPreviewer installs the defaults.
+// - Width: The maximum width of image previews in pixels. Defaults to 400.
+// - SnippetLength: The maximum length of text snippets in bytes. Defaults to 500.
+// - Timeout: The time limit of a single conversion. Defaults to 30 seconds.
+type Previewer struct {
+	Converters    []PreviewConverter
+	Width         int
+	SnippetLength int
+	Timeout       time.Duration
+
+	tools Tools
+}
+
+// NewPreviewer creates a Previewer with the default converters: images are thumbnailed in-process, PDFs are
+// rendered with pdftoppm (poppler-utils), and office documents are converted to PDF with LibreOffice first.
+func NewPreviewer() *Previewer {
+	p := &Previewer{}
+	p.Converters = []PreviewConverter{
+		&ImagePreviewConverter{Previewer: p},
+		&PDFPreviewConverter{Previewer: p},
+		&OfficePreviewConverter{PDF: &PDFPreviewConverter{Previewer: p}},
+	}
+
+	return p
+}
+
+// Generate renders a preview of the file at pathName.
+// Parameters:
+// - ctx: The context of the conversion.
+// - pathName: The path of the file.
+// - mimeType: The file's MIME type. If empty, it is detected from the content.
+// Returns the preview, or an error if no converter succeeded and no text could be extracted.
+func (p *Previewer) Generate(ctx context.Context, pathName, mimeType string) (*Preview, error) {
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	if mimeType == "" {
+		var err error
+		if mimeType, err = detectFileType(pathName); err != nil {
+			return nil, err
+		}
+	}
+
+	var errs []error
+	for _, c := range p.Converters {
+		if !c.Accepts(mimeType) {
+			continue
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, timeout)
+		preview, err := c.Convert(cctx, pathName, mimeType)
+		cancel()
+
+		if err == nil {
+			return preview, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+	}
+
+	preview, err := p.snippet(ctx, pathName, mimeType)
+	if err != nil {
+		return nil, errors.Join(append(errs, err)...)
+	}
+
+	return preview, nil
+}
+
+// snippet renders the beginning of the file's text as an HTML fragment.
+func (p *Previewer) snippet(ctx context.Context, pathName, mimeType string) (*Preview, error) {
+	length := p.SnippetLength
+	if length <= 0 {
+		length = 500
+	}
+
+	f, err := os.Open(pathName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	text, err := p.tools.ExtractText(ctx, f, mimeType, ExtractOptions{MaxTextBytes: length})
+	if err != nil {
+		return nil, err
+	}
+
+	data := `<pre class="preview-snippet">` + html.EscapeString(text) + `</pre>`
+
+	return &Preview{MIMEType: "text/html", Data: []byte(data), Converter: "snippet"}, nil
+}
+
+// width returns the maximum preview width.
+func (p *Previewer) width() int {
+	if p == nil || p.Width <= 0 {
+		return 400
+	}
+
+	return p.Width
+}
+
+// detectFileType sniffs the MIME type of a file, using its extension when the content is ambiguous.
+func detectFileType(pathName string) (string, error) {
+	f, err := os.Open(pathName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	mimeType := http.DetectContentType(head[:n])
+	if mimeType == "application/zip" || mimeType == "application/octet-stream" || strings.HasPrefix(mimeType, "text/plain") {
+		if byExt, ok := officeTypes[strings.ToLower(filepath.Ext(pathName))]; ok {
+			return byExt, nil
+		}
+	}
+
+	return mimeType, nil
+}
+
+// officeTypes maps office document extensions to their MIME types.
+var officeTypes = map[string]string{
+	".docx": docxMIME,
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".doc":  "application/msword",
+	".xls":  "application/vnd.ms-excel",
+	".ppt":  "application/vnd.ms-powerpoint",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	".odp":  "application/vnd.oasis.opendocument.presentation",
+	".rtf":  "application/rtf",
+}
+
+// ImagePreviewConverter renders PNG thumbnails of PNG, JPEG and GIF images without external tools.
+type ImagePreviewConverter struct {
+	// Previewer supplies the maximum width. It may be nil.
+	Previewer *Previewer
+}
+
+// Name returns "image".
+func (c *ImagePreviewConverter) Name() string { return "image" }
+
+// Accepts reports whether mimeType is a decodable image type.
+func (c *ImagePreviewConverter) Accepts(mimeType string) bool {
+	return mimeType == "image/png" || mimeType == "image/jpeg" || mimeType == "image/gif"
+}
+
+// Convert decodes the image and scales it down to the maximum width.
+func (c *ImagePreviewConverter) Convert(ctx context.Context, src, mimeType string) (*Preview, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// refuse decompression bombs before decoding pixels
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Width*cfg.Height > 50_000_000 {
+		return nil, fmt.Errorf("image too large: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, scaleImage(img, c.Previewer.width())); err != nil {
+		return nil, err
+	}
+
+	return &Preview{MIMEType: "image/png", Data: buf.Bytes(), Converter: c.Name()}, nil
+}
+
+// scaleImage shrinks img to at most maxWidth pixels wide, averaging the source pixels covered by each
+// destination pixel. Narrower images are returned unchanged.
+func scaleImage(img image.Image, maxWidth int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxWidth {
+		return img
+	}
+
+	w := maxWidth
+	h := b.Dy() * w / b.Dx()
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			if n == 0 {
+				continue
+			}
+
+			dst.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+
+	return dst
+}
+
+// PDFPreviewConverter renders the first page of a PDF to PNG with pdftoppm from poppler-utils.
+type PDFPreviewConverter struct {
+	// Previewer supplies the maximum width. It may be nil.
+	Previewer *Previewer
+	// Command is the pdftoppm executable. Defaults to "pdftoppm" on the PATH.
+	Command string
+}
+
+// Name returns "pdftoppm".
+func (c *PDFPreviewConverter) Name() string { return "pdftoppm" }
+
+// Accepts reports whether mimeType is application/pdf.
+func (c *PDFPreviewConverter) Accepts(mimeType string) bool {
+	return mimeType == "application/pdf"
+}
+
+// Convert renders the first page of the PDF at src.
+func (c *PDFPreviewConverter) Convert(ctx context.Context, src, mimeType string) (*Preview, error) {
+	command := c.Command
+	if command == "" {
+		command = "pdftoppm"
+	}
+
+	dir, err := os.MkdirTemp("", "toolkit-preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "page")
+	if err := runConverter(ctx, command, "-png", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to-x", fmt.Sprint(c.Previewer.width()), "-scale-to-y", "-1", src, out); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(out + ".png")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Preview{MIMEType: "image/png", Data: data, Converter: c.Name()}, nil
+}
+
+// OfficePreviewConverter converts office documents to PDF with LibreOffice, then renders the first page with
+// the PDF converter.
+type OfficePreviewConverter struct {
+	// PDF renders the converted document.
+	PDF *PDFPreviewConverter
+	// Command is the LibreOffice executable. Defaults to "soffice" on the PATH.
+	Command string
+}
+
+// Name returns "libreoffice".
+func (c *OfficePreviewConverter) Name() string { return "libreoffice" }
+
+// Accepts reports whether mimeType is a known office document type.
+func (c *OfficePreviewConverter) Accepts(mimeType string) bool {
+	for _, t := range officeTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Convert converts the document at src to PDF and renders its first page.
+func (c *OfficePreviewConverter) Convert(ctx context.Context, src, mimeType string) (*Preview, error) {
+	command := c.Command
+	if command == "" {
+		command = "soffice"
+	}
+
+	dir, err := os.MkdirTemp("", "toolkit-preview-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// a private profile directory lets conversions run in parallel with each other and with a desktop session
+	if err := runConverter(ctx, command, "-env:UserInstallation=file://"+filepath.ToSlash(filepath.Join(dir, "profile")),
+		"--headless", "--convert-to", "pdf", "--outdir", dir, src); err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	preview, err := c.PDF.Convert(ctx, filepath.Join(dir, base+".pdf"), "application/pdf")
+	if err != nil {
+		return nil, err
+	}
+	preview.Converter = c.Name()
+
+	return preview, nil
+}
+
+// runConverter runs an external converter, returning ErrConverterUnavailable if it is not installed.
+func runConverter(ctx context.Context, command string, args ...string) error {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return fmt.Errorf("%w: %s not found", ErrConverterUnavailable, command)
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s: %w: %s", command, err, msg)
+		}
+		return fmt.Errorf("%s: %w", command, err)
+	}
+
+	return nil
+}
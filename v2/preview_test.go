@@ -0,0 +1,82 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakePreviewConverter struct {
+	err error
+}
+
+func (c *fakePreviewConverter) Name() string                 { return "fake" }
+func (c *fakePreviewConverter) Accepts(mimeType string) bool { return mimeType == "application/pdf" }
+func (c *fakePreviewConverter) Convert(ctx context.Context, src, mimeType string) (*Preview, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &Preview{MIMEType: "image/png", Data: []byte("png"), Converter: c.Name()}, nil
+}
+
+func TestPreviewer_Generate(t *testing.T) {
+	dir := t.TempDir()
+
+	img := image.NewRGBA(image.Rect(0, 0, 800, 200))
+	for x := 0; x < 800; x++ {
+		for y := 0; y < 200; y++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, img)
+	imagePath := filepath.Join(dir, "photo.png")
+	_ = os.WriteFile(imagePath, buf.Bytes(), 0o644)
+
+	pdfPath := filepath.Join(dir, "doc.pdf")
+	_ = os.WriteFile(pdfPath, testPDF(t), 0o644)
+
+	binPath := filepath.Join(dir, "blob.bin")
+	_ = os.WriteFile(binPath, []byte{0, 1, 2, 3}, 0o644)
+
+	p := NewPreviewer()
+	p.Width = 100
+	p.Converters[1].(*PDFPreviewConverter).Command = "toolkit-missing-pdftoppm"
+
+	preview, err := p.Generate(context.Background(), imagePath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := png.Decode(bytes.NewReader(preview.Data))
+	if err != nil || thumb.Bounds().Dx() != 100 || thumb.Bounds().Dy() != 25 {
+		t.Errorf("expected a 100x25 thumbnail, got %v, %v", thumb.Bounds(), err)
+	}
+
+	// the missing tool degrades to a text snippet
+	preview, err = p.Generate(context.Background(), pdfPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if preview.Converter != "snippet" || preview.MIMEType != "text/html" || !strings.Contains(string(preview.Data), "Hello (PDF) world") {
+		t.Errorf("expected a text snippet, got %s: %s", preview.Converter, preview.Data)
+	}
+
+	// converters are tried in order, skipping failures
+	p.Converters = []PreviewConverter{&fakePreviewConverter{err: errors.New("boom")}, &fakePreviewConverter{}}
+	if preview, err := p.Generate(context.Background(), pdfPath, "application/pdf"); err != nil || string(preview.Data) != "png" {
+		t.Errorf("expected the second converter to be used, got %v", err)
+	}
+
+	if _, err := p.Generate(context.Background(), binPath, ""); err == nil {
+		t.Error("expected error for a file without a converter or text")
+	}
+}
@@ -0,0 +1,277 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// ErrNoPrivacyRegistry is returned by the subject data helpers when Tools.Privacy is not set.
+var ErrNoPrivacyRegistry = errors.New("no privacy registry configured")
+
+// PrivacyExportFunc returns a module's data about a subject, for a data access request. The result is written to
+// the archive as <module>.json, unless it is a []ExportFile, whose files are written under <module>/, e.g. the
+// subject's uploads.
+type PrivacyExportFunc func(ctx context.Context, subjectID string) (interface{}, error)
+
+// PrivacyEraseFunc deletes or anonymizes a module's data about a subject, for an erasure request. It must be safe
+// to run again, as a failed erasure is retried as a whole.
+type PrivacyEraseFunc func(ctx context.Context, subjectID string) error
+
+// PrivacyModule is a part of the application holding personal data, e.g. "orders" or "support".
+// Fields:
+// - Name: A unique name, used in the archive and the audit trail.
+// - Export: Returns the module's data about a subject. Optional.
+// - Erase: Deletes the module's data about a subject. Optional.
+type PrivacyModule struct {
+	Name   string
+	Export PrivacyExportFunc
+	Erase  PrivacyEraseFunc
+}
+
+// PrivacyEvent is an audit record of one module's part in a subject data request.
+// Fields:
+// - Time: When the module finished.
+// - Action: "export" or "erase".
+// - Subject: The subject's ID.
+// - Module: The module's name.
+// - Duration: How long the module took.
+// - Error: Why the module failed, if it did.
+type PrivacyEvent struct {
+	Time     time.Time     `json:"time"`
+	Action   string        `json:"action"`
+	Subject  string        `json:"subject"`
+	Module   string        `json:"module"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// PrivacyRegistry collects the modules holding personal data, so data access and erasure requests, such as those
+// of the GDPR, reach every one of them. Set it as Tools.Privacy and use ExportSubjectData and EraseSubject.
+// Fields:
+// - Store: Where ExportSubjectData saves archives.
+// - Prefix: The directory of archives within Store. Defaults to "privacy".
+// - Audit: Receives an event for every module run, e.g. to store it as proof the request was handled. Defaults to
+// logging with slog.Default().
+type PrivacyRegistry struct {
+	Store  FileStore
+	Prefix string
+	Audit  func(ctx context.Context, e PrivacyEvent)
+
+	mu      sync.Mutex
+	modules []PrivacyModule
+}
+
+// NewPrivacyRegistry creates an empty PrivacyRegistry saving archives to store.
+// Returns a pointer to the new PrivacyRegistry.
+func NewPrivacyRegistry(store FileStore) *PrivacyRegistry {
+	return &PrivacyRegistry{Store: store}
+}
+
+// Register adds a module.
+// Returns an error if the module has no name or the name is taken.
+func (p *PrivacyRegistry) Register(m PrivacyModule) error {
+	if m.Name == "" {
+		return errors.New("privacy module has no name")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, existing := range p.modules {
+		if existing.Name == m.Name {
+			return fmt.Errorf("privacy module %q is already registered", m.Name)
+		}
+	}
+	p.modules = append(p.modules, m)
+
+	return nil
+}
+
+// Modules returns the registered modules, in registration order.
+func (p *PrivacyRegistry) Modules() []PrivacyModule {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]PrivacyModule(nil), p.modules...)
+}
+
+// audit records an event.
+func (p *PrivacyRegistry) audit(ctx context.Context, e PrivacyEvent) {
+	if p.Audit != nil {
+		p.Audit(ctx, e)
+		return
+	}
+
+	level := slog.LevelInfo
+	if e.Error != "" {
+		level = slog.LevelWarn
+	}
+	slog.Default().Log(ctx, level, "privacy request",
+		slog.String("action", e.Action),
+		slog.String("subject", e.Subject),
+		slog.String("module", e.Module),
+		slog.Duration("duration", e.Duration),
+		slog.String("error", e.Error),
+	)
+}
+
+// run calls fn for a module and audits the outcome, returning the audit event.
+func (p *PrivacyRegistry) run(ctx context.Context, action, subjectID, module string, fn func() error) (PrivacyEvent, error) {
+	start := time.Now()
+	err := fn()
+
+	e := PrivacyEvent{
+		Time:     time.Now(),
+		Action:   action,
+		Subject:  subjectID,
+		Module:   module,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	p.audit(ctx, e)
+
+	return e, err
+}
+
+// SubjectExport describes an archive saved by ExportSubjectData.
+// Fields:
+// - Subject: The subject's ID.
+// - Name: The archive's name within the registry's Store.
+// - Size: The archive's size in bytes.
+// - Modules: The modules included.
+// - CreatedAt: When the archive was created.
+type SubjectExport struct {
+	Subject   string    `json:"subject"`
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	Modules   []string  `json:"modules"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ExportSubjectData gathers every module's data about a subject into a zip archive saved to the registry's
+// Store, for a data access or portability request. The archive holds a manifest.json listing the modules, and one
+// entry per module. An incomplete archive is never saved: if any module fails, the export fails.
+// Parameters:
+// - ctx: The context, passed to the modules.
+// - subjectID: The subject, e.g. a user ID.
+// Returns where the archive was saved, or an error naming the modules that failed.
+func (t *Tools) ExportSubjectData(ctx context.Context, subjectID string) (*SubjectExport, error) {
+	p := t.Privacy
+	if p == nil {
+		return nil, ErrNoPrivacyRegistry
+	}
+	if p.Store == nil {
+		return nil, errors.New("privacy registry has no store")
+	}
+	if subjectID == "" || subjectID == "." || subjectID == ".." {
+		return nil, fmt.Errorf("invalid subject ID %q", subjectID)
+	}
+
+	now := time.Now().UTC()
+	export := &SubjectExport{Subject: subjectID, CreatedAt: now}
+
+	var files []ExportFile
+	var errs []error
+	for _, m := range p.Modules() {
+		if m.Export == nil {
+			continue
+		}
+
+		var data interface{}
+		_, err := p.run(ctx, "export", subjectID, m.Name, func() (err error) {
+			data, err = m.Export(ctx, subjectID)
+			return err
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+			continue
+		}
+
+		export.Modules = append(export.Modules, m.Name)
+		if entries, ok := data.([]ExportFile); ok {
+			for _, f := range entries {
+				files = append(files, ExportFile{Name: path.Join(m.Name, f.Name), Write: f.Write})
+			}
+			continue
+		}
+		files = append(files, ExportFile{Name: m.Name + ".json", Write: jsonExport(data)})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("export of subject %q failed: %w", subjectID, errors.Join(errs...))
+	}
+
+	manifest := ExportFile{Name: "manifest.json", Write: jsonExport(map[string]interface{}{
+		"subject":    subjectID,
+		"created_at": now,
+		"modules":    export.Modules,
+	})}
+
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = "privacy"
+	}
+	export.Name = path.Join(prefix, url.PathEscape(subjectID), now.Format("20060102T150405Z")+".zip")
+
+	size, err := storeExport(ctx, p.Store, export.Name, ZipExport(append([]ExportFile{manifest}, files...)...))
+	if err != nil {
+		return nil, err
+	}
+	export.Size = size
+
+	return export, nil
+}
+
+// jsonExport returns an ExportFunc writing v as indented JSON.
+func jsonExport(v interface{}) ExportFunc {
+	return func(_ context.Context, w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(v)
+	}
+}
+
+// EraseSubject runs every module's erasure for a subject, for a right to erasure request. Modules are erased in
+// reverse registration order, so modules registered later, which may refer to earlier ones, go first. A failing
+// module does not stop the others; the request should be retried until it succeeds.
+// Parameters:
+// - ctx: The context, passed to the modules.
+// - subjectID: The subject, e.g. a user ID.
+// Returns the audit trail of the modules run, and an error naming the modules that failed.
+func (t *Tools) EraseSubject(ctx context.Context, subjectID string) ([]PrivacyEvent, error) {
+	p := t.Privacy
+	if p == nil {
+		return nil, ErrNoPrivacyRegistry
+	}
+
+	modules := p.Modules()
+	var trail []PrivacyEvent
+	var errs []error
+	for i := len(modules) - 1; i >= 0; i-- {
+		m := modules[i]
+		if m.Erase == nil {
+			continue
+		}
+
+		e, err := p.run(ctx, "erase", subjectID, m.Name, func() error { return m.Erase(ctx, subjectID) })
+		trail = append(trail, e)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", m.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return trail, fmt.Errorf("erasure of subject %q failed: %w", subjectID, errors.Join(errs...))
+	}
+
+	return trail, nil
+}
@@ -0,0 +1,120 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTools_ExportSubjectData(t *testing.T) {
+	store := NewLocalFileStore(t.TempDir())
+
+	var mu sync.Mutex
+	var events []PrivacyEvent
+	registry := NewPrivacyRegistry(store)
+	registry.Audit = func(_ context.Context, e PrivacyEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+
+	_ = registry.Register(PrivacyModule{Name: "profile", Export: func(_ context.Context, id string) (interface{}, error) {
+		return map[string]string{"id": id, "email": "ann@example.com"}, nil
+	}})
+	_ = registry.Register(PrivacyModule{Name: "uploads", Export: func(context.Context, string) (interface{}, error) {
+		return []ExportFile{{Name: "avatar.png", Write: func(_ context.Context, w io.Writer) error {
+			_, err := io.WriteString(w, "png")
+			return err
+		}}}, nil
+	}})
+	_ = registry.Register(PrivacyModule{Name: "sessions", Erase: func(context.Context, string) error { return nil }})
+	if err := registry.Register(PrivacyModule{Name: "profile"}); err == nil {
+		t.Error("expected a duplicate module to be rejected")
+	}
+
+	testTools := Tools{Privacy: registry}
+	export, err := testTools.ExportSubjectData(context.Background(), "user/42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(export.Name, "privacy/user%2F42/") || strings.Join(export.Modules, ",") != "profile,uploads" {
+		t.Errorf("unexpected export %+v", export)
+	}
+
+	rc, err := store.Open(context.Background(), export.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if int64(len(data)) != export.Size {
+		t.Errorf("expected %d bytes, got %d", export.Size, len(data))
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string]string)
+	for _, f := range zr.File {
+		r, _ := f.Open()
+		b, _ := io.ReadAll(r)
+		contents[f.Name] = string(b)
+	}
+	if !strings.Contains(contents["manifest.json"], `"user/42"`) || !strings.Contains(contents["profile.json"], "ann@example.com") || contents["uploads/avatar.png"] != "png" {
+		t.Errorf("unexpected archive %v", contents)
+	}
+	if len(events) != 2 || events[0].Action != "export" || events[0].Subject != "user/42" {
+		t.Errorf("unexpected audit trail %+v", events)
+	}
+
+	// a failing module fails the whole export
+	_ = registry.Register(PrivacyModule{Name: "billing", Export: func(context.Context, string) (interface{}, error) {
+		return nil, errors.New("billing is down")
+	}})
+	if _, err := testTools.ExportSubjectData(context.Background(), "42"); err == nil || !strings.Contains(err.Error(), "billing: billing is down") {
+		t.Errorf("expected the failing module to be named, got %v", err)
+	}
+	if _, err := testTools.ExportSubjectData(context.Background(), ".."); err == nil {
+		t.Error("expected an unsafe subject ID to be rejected")
+	}
+
+	var empty Tools
+	if _, err := empty.ExportSubjectData(context.Background(), "42"); !errors.Is(err, ErrNoPrivacyRegistry) {
+		t.Errorf("expected ErrNoPrivacyRegistry, got %v", err)
+	}
+}
+
+func TestTools_EraseSubject(t *testing.T) {
+	var order []string
+	erase := func(name string, err error) PrivacyEraseFunc {
+		return func(_ context.Context, id string) error {
+			order = append(order, name+":"+id)
+			return err
+		}
+	}
+
+	registry := NewPrivacyRegistry(nil)
+	registry.Audit = func(context.Context, PrivacyEvent) {}
+	_ = registry.Register(PrivacyModule{Name: "users", Erase: erase("users", nil)})
+	_ = registry.Register(PrivacyModule{Name: "reports", Export: func(context.Context, string) (interface{}, error) { return nil, nil }})
+	_ = registry.Register(PrivacyModule{Name: "orders", Erase: erase("orders", errors.New("locked"))})
+	_ = registry.Register(PrivacyModule{Name: "comments", Erase: erase("comments", nil)})
+
+	testTools := Tools{Privacy: registry}
+	trail, err := testTools.EraseSubject(context.Background(), "42")
+	if err == nil || !strings.Contains(err.Error(), "orders: locked") {
+		t.Errorf("expected the failing module to be named, got %v", err)
+	}
+	if strings.Join(order, ",") != "comments:42,orders:42,users:42" {
+		t.Errorf("expected reverse registration order, got %v", order)
+	}
+	if len(trail) != 3 || trail[1].Module != "orders" || trail[1].Error != "locked" || trail[0].Error != "" {
+		t.Errorf("unexpected audit trail %+v", trail)
+	}
+}
@@ -0,0 +1,147 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// ErrQueueClosed is returned when using a closed Queue.
+var ErrQueueClosed = errors.New("queue is closed")
+
+// Message is a message received from a Queue.
+// Fields:
+// - ID: The message identifier assigned by the broker, when available.
+// - Topic: The subject, routing key, or queue the message was received from.
+// - Body: The message payload.
+// - Attempt: The delivery attempt, starting at 1, when the broker reports it.
+type Message struct {
+	ID      string
+	Topic   string
+	Body    []byte
+	Attempt int
+}
+
+// MessageHandler processes a message. Returning an error asks the broker to redeliver it when the
+// adapter supports redelivery.
+type MessageHandler func(ctx context.Context, m Message) error
+
+// Queue is a message broker able to deliver payloads asynchronously. The meaning of topic depends on the
+// adapter: a subject for NATS, a routing key (publish) or queue name (consume) for AMQP, and a queue URL for SQS.
+type Queue interface {
+	// Publish sends body to topic.
+	Publish(ctx context.Context, topic string, body []byte) error
+	// Consume calls handler for each message received from topic until ctx is done.
+	Consume(ctx context.Context, topic string, handler MessageHandler) error
+	// Close releases the resources held by the queue.
+	Close() error
+}
+
+// PublishJSON marshals data to JSON and publishes it to a queue, the asynchronous sibling of PushJSONToRemote.
+// Parameters:
+// - ctx: The context of the publication.
+// - q: The Queue to publish to.
+// - topic: The destination topic.
+// - data: The data to be marshaled into JSON.
+// Returns an error if marshaling or publishing fails.
+func (t *Tools) PublishJSON(ctx context.Context, q Queue, topic string, data interface{}) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return q.Publish(ctx, topic, body)
+}
+
+// MemoryQueue is an in-process Queue for development and tests. Messages whose handler fails are redelivered
+// until MaxAttempts is reached.
+type MemoryQueue struct {
+	MaxAttempts int
+
+	mu     sync.Mutex
+	topics map[string]chan Message
+	closed bool
+}
+
+// NewMemoryQueue creates a MemoryQueue retrying failed messages up to 3 times.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{MaxAttempts: 3}
+}
+
+// Publish queues body on topic.
+func (q *MemoryQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	ch, err := q.topic(topic)
+	if err != nil {
+		return err
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	select {
+	case ch <- Message{ID: hex.EncodeToString(id), Topic: topic, Body: append([]byte(nil), body...), Attempt: 1}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume delivers messages from topic to handler until ctx is done.
+func (q *MemoryQueue) Consume(ctx context.Context, topic string, handler MessageHandler) error {
+	ch, err := q.topic(topic)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m := <-ch:
+			if err := handler(ctx, m); err != nil && m.Attempt < q.MaxAttempts {
+				m.Attempt++
+				go func() {
+					select {
+					case ch <- m:
+					case <-ctx.Done():
+					}
+				}()
+			}
+		}
+	}
+}
+
+// Close makes further Publish and Consume calls fail.
+func (q *MemoryQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+
+	return nil
+}
+
+// topic returns the channel backing a topic, creating it on first use.
+func (q *MemoryQueue) topic(name string) (chan Message, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+
+	if q.topics == nil {
+		q.topics = make(map[string]chan Message)
+	}
+
+	ch, ok := q.topics[name]
+	if !ok {
+		ch = make(chan Message, 1024)
+		q.topics[name] = ch
+	}
+
+	return ch, nil
+}
@@ -0,0 +1,83 @@
+package toolkit
+
+import (
+	"context"
+)
+
+// AMQPDelivery is a message received from an AMQP 0-9-1 broker such as RabbitMQ.
+type AMQPDelivery struct {
+	MessageID   string
+	RoutingKey  string
+	Body        []byte
+	Redelivered bool
+	Ack         func() error
+	Nack        func(requeue bool) error
+}
+
+// AMQPChannel is the small subset of an AMQP 0-9-1 client channel used by AMQPQueue. The toolkit does not
+// depend on an AMQP client library; wrapping an *amqp091.Channel from github.com/rabbitmq/amqp091-go takes
+// a few lines, forwarding Publish to PublishWithContext and mapping each amqp091.Delivery to an AMQPDelivery.
+type AMQPChannel interface {
+	// Publish sends a persistent message to exchange with the given routing key.
+	Publish(ctx context.Context, exchange, routingKey string, body []byte) error
+	// Consume starts delivering messages from queue with manual acknowledgements.
+	Consume(ctx context.Context, queue string) (<-chan AMQPDelivery, error)
+	// Close closes the channel.
+	Close() error
+}
+
+// AMQPQueue is a Queue on top of an AMQPChannel. Topics are routing keys when publishing and queue names when
+// consuming. Messages are acknowledged when their handler succeeds and requeued once when it fails; a message
+// failing again after redelivery is rejected, leaving it to the queue's dead-letter configuration.
+// Fields:
+// - Channel: The AMQP channel.
+// - Exchange: The exchange messages are published to. The default exchange routes by queue name.
+type AMQPQueue struct {
+	Channel  AMQPChannel
+	Exchange string
+}
+
+// Publish sends body to the exchange with routing key topic.
+func (q *AMQPQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	return q.Channel.Publish(ctx, q.Exchange, topic, body)
+}
+
+// Consume calls handler for each message of the queue named topic until ctx is done.
+func (q *AMQPQueue) Consume(ctx context.Context, topic string, handler MessageHandler) error {
+	deliveries, err := q.Channel.Consume(ctx, topic)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return ErrQueueClosed
+			}
+
+			attempt := 1
+			if d.Redelivered {
+				attempt = 2
+			}
+
+			if err := handler(ctx, Message{ID: d.MessageID, Topic: d.RoutingKey, Body: d.Body, Attempt: attempt}); err != nil {
+				if d.Nack != nil {
+					_ = d.Nack(!d.Redelivered)
+				}
+				continue
+			}
+
+			if d.Ack != nil {
+				_ = d.Ack()
+			}
+		}
+	}
+}
+
+// Close closes the underlying channel.
+func (q *AMQPQueue) Close() error {
+	return q.Channel.Close()
+}
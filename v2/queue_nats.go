@@ -0,0 +1,280 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSQueue is a Queue speaking the core NATS protocol over a single TCP connection, without external dependencies.
+// Core NATS delivers at most once: messages published while no consumer is subscribed are dropped, and handler
+// errors do not cause redelivery. Consumers sharing a QueueGroup split the messages of a subject between them.
+type NATSQueue struct {
+	// QueueGroup is the queue group used by Consume. Set it so that replicas share the load instead of each
+	// receiving every message.
+	QueueGroup string
+
+	conn    net.Conn
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	subs    map[int]chan Message
+	nextSID int
+	pongs   chan struct{}
+	closed  chan struct{}
+	err     error
+}
+
+// DialNATS connects to a NATS server.
+// Parameters:
+// - ctx: The context bounding the connection handshake.
+// - rawURL: The server URL, e.g. "nats://localhost:4222", optionally with user:password or a token as user info.
+// Returns the connected queue, or an error if the connection or handshake fails.
+func DialNATS(ctx context.Context, rawURL string) (*NATSQueue, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &NATSQueue{
+		conn:   conn,
+		subs:   make(map[int]chan Message),
+		pongs:  make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+
+	rd := bufio.NewReader(conn)
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+
+	info, err := rd.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(info))
+	}
+
+	opts := map[string]interface{}{"verbose": false, "pedantic": false, "name": "toolkit", "lang": "go", "protocol": 1}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			opts["user"], opts["pass"] = u.User.Username(), pass
+		} else {
+			opts["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(opts)
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	reply, err := rd.ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(reply, "PONG") {
+		_ = conn.Close()
+		return nil, fmt.Errorf("nats: connection refused: %s", strings.TrimSpace(reply))
+	}
+
+	_ = conn.SetReadDeadline(time.Time{})
+
+	go q.readLoop(rd)
+
+	return q, nil
+}
+
+// Publish sends body to the subject topic.
+func (q *NATSQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	if strings.ContainsAny(topic, " \t\r\n") || topic == "" {
+		return fmt.Errorf("nats: invalid subject %q", topic)
+	}
+
+	return q.write(ctx, []byte("PUB "+topic+" "+strconv.Itoa(len(body))+"\r\n"), body, []byte("\r\n"))
+}
+
+// Flush waits until the server has processed everything sent so far.
+func (q *NATSQueue) Flush(ctx context.Context) error {
+	if err := q.write(ctx, []byte("PING\r\n")); err != nil {
+		return err
+	}
+
+	select {
+	case <-q.pongs:
+		return nil
+	case <-q.closed:
+		return q.closeErr()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume subscribes to the subject topic, which may contain NATS wildcards, and calls handler for each message
+// until ctx is done.
+func (q *NATSQueue) Consume(ctx context.Context, topic string, handler MessageHandler) error {
+	ch := make(chan Message, 256)
+
+	q.mu.Lock()
+	q.nextSID++
+	sid := q.nextSID
+	q.subs[sid] = ch
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.subs, sid)
+		q.mu.Unlock()
+		_ = q.write(context.Background(), []byte("UNSUB "+strconv.Itoa(sid)+"\r\n"))
+	}()
+
+	sub := "SUB " + topic + " "
+	if q.QueueGroup != "" {
+		sub += q.QueueGroup + " "
+	}
+	if err := q.write(ctx, []byte(sub+strconv.Itoa(sid)+"\r\n")); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.closed:
+			return q.closeErr()
+		case m := <-ch:
+			_ = handler(ctx, m)
+		}
+	}
+}
+
+// Close closes the connection.
+func (q *NATSQueue) Close() error {
+	return q.conn.Close()
+}
+
+// write sends the given chunks atomically with respect to other writers.
+func (q *NATSQueue) write(ctx context.Context, chunks ...[]byte) error {
+	select {
+	case <-q.closed:
+		return q.closeErr()
+	default:
+	}
+
+	q.wmu.Lock()
+	defer q.wmu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = q.conn.SetWriteDeadline(deadline)
+		defer q.conn.SetWriteDeadline(time.Time{})
+	}
+
+	for _, c := range chunks {
+		if _, err := q.conn.Write(c); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLoop processes server operations until the connection fails.
+func (q *NATSQueue) readLoop(rd *bufio.Reader) {
+	err := q.read(rd)
+
+	q.mu.Lock()
+	q.err = err
+	q.mu.Unlock()
+
+	close(q.closed)
+}
+
+// read parses server operations, dispatching messages to subscriptions.
+func (q *NATSQueue) read(rd *bufio.Reader) error {
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			if err := q.write(context.Background(), []byte("PONG\r\n")); err != nil {
+				return err
+			}
+
+		case "PONG":
+			select {
+			case q.pongs <- struct{}{}:
+			default:
+			}
+
+		case "-ERR":
+			return fmt.Errorf("nats: %s", strings.Trim(args, "' "))
+
+		case "MSG":
+			fields := strings.Fields(args)
+			if len(fields) < 3 {
+				return fmt.Errorf("nats: malformed MSG %q", line)
+			}
+
+			sid, _ := strconv.Atoi(fields[1])
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				return fmt.Errorf("nats: malformed MSG %q", line)
+			}
+
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, payload); err != nil {
+				return err
+			}
+
+			q.mu.Lock()
+			ch, ok := q.subs[sid]
+			q.mu.Unlock()
+
+			if ok {
+				select {
+				case ch <- Message{Topic: fields[0], Body: payload[:size], Attempt: 1}:
+				default:
+					// slow consumer: drop the message, as NATS servers do
+				}
+			}
+		}
+	}
+}
+
+// closeErr returns the error that closed the connection.
+func (q *NATSQueue) closeErr() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.err == nil || errors.Is(q.err, net.ErrClosed) {
+		return ErrQueueClosed
+	}
+
+	return q.err
+}
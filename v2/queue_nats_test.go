@@ -0,0 +1,157 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS is a minimal NATS server relaying PUB to matching SUB on all connections.
+type fakeNATS struct {
+	mu   sync.Mutex
+	subs map[net.Conn]map[string]string // conn -> sid -> subject
+}
+
+func newFakeNATS(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	srv := &fakeNATS{subs: map[net.Conn]map[string]string{}}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return "nats://user:secret@" + ln.Addr().String()
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+
+	f.mu.Lock()
+	f.subs[conn] = map[string]string{}
+	f.mu.Unlock()
+
+	_, _ = conn.Write([]byte("INFO {\"server_id\":\"fake\"}\r\n"))
+	rd := bufio.NewReader(conn)
+
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			if !strings.Contains(line, `"pass":"secret"`) {
+				_, _ = conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "PING":
+			_, _ = conn.Write([]byte("PONG\r\n"))
+		case "SUB":
+			f.mu.Lock()
+			f.subs[conn][fields[len(fields)-1]] = fields[1]
+			f.mu.Unlock()
+		case "UNSUB":
+			f.mu.Lock()
+			delete(f.subs[conn], fields[1])
+			f.mu.Unlock()
+		case "PUB":
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(rd, payload); err != nil {
+				return
+			}
+
+			f.mu.Lock()
+			for c, sids := range f.subs {
+				for sid, subject := range sids {
+					if subject == fields[1] {
+						_, _ = fmt.Fprintf(c, "MSG %s %s %d\r\n%s", fields[1], sid, size, payload)
+					}
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestNATSQueue(t *testing.T) {
+	addr := newFakeNATS(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	consumer, err := DialNATS(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+
+	publisher, err := DialNATS(ctx, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+
+	received := make(chan Message, 1)
+	go func() {
+		_ = consumer.Consume(ctx, "uploads.completed", func(ctx context.Context, m Message) error {
+			received <- m
+			return nil
+		})
+	}()
+
+	// wait until the subscription has reached the server
+	time.Sleep(20 * time.Millisecond)
+	_ = consumer.Flush(ctx)
+
+	if err := publisher.Publish(ctx, "uploads.completed", []byte("hello\r\nworld")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case m := <-received:
+		if string(m.Body) != "hello\r\nworld" || m.Topic != "uploads.completed" {
+			t.Errorf("unexpected message: %+v", m)
+		}
+	case <-ctx.Done():
+		t.Fatal("message not received")
+	}
+
+	if err := publisher.Publish(ctx, "bad subject", nil); err == nil {
+		t.Error("expected error for subject containing spaces")
+	}
+}
+
+func TestNATSQueue_AuthFailure(t *testing.T) {
+	addr := strings.Replace(newFakeNATS(t), "secret", "wrong", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if _, err := DialNATS(ctx, addr); err == nil {
+		t.Error("expected authentication error")
+	}
+}
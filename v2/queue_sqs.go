@@ -0,0 +1,152 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SQSQueue is a Queue backed by Amazon SQS, using the SQS JSON API signed with Signature Version 4.
+// Topics are queue URLs. Messages are deleted once their handler succeeds; failed messages become visible
+// again after the queue's visibility timeout and are redelivered, so handlers must be idempotent.
+// Message bodies must be valid UTF-8 text, such as JSON.
+// Fields:
+// - Region: The AWS region, e.g. "us-east-1".
+// - Credentials: The credentials used to sign requests.
+// - Endpoint: An optional endpoint override, e.g. for LocalStack. Defaults to https://sqs.<region>.amazonaws.com.
+// - Client: An optional http.Client. Defaults to one with a 30 second timeout.
+// - WaitTime: The long-polling wait of ReceiveMessage, at most 20 seconds. Defaults to 20 seconds.
+// - MaxMessages: The number of messages fetched per poll, at most 10. Defaults to 10.
+type SQSQueue struct {
+	Region      string
+	Credentials AWSCredentials
+	Endpoint    string
+	Client      *http.Client
+	WaitTime    time.Duration
+	MaxMessages int
+}
+
+type sqsMessage struct {
+	MessageID     string            `json:"MessageId"`
+	ReceiptHandle string            `json:"ReceiptHandle"`
+	Body          string            `json:"Body"`
+	Attributes    map[string]string `json:"Attributes"`
+}
+
+// Publish sends body to the queue at the URL topic.
+func (q *SQSQueue) Publish(ctx context.Context, topic string, body []byte) error {
+	return q.call(ctx, "SendMessage", map[string]interface{}{"QueueUrl": topic, "MessageBody": string(body)}, nil)
+}
+
+// Consume long-polls the queue at the URL topic and calls handler for each message until ctx is done.
+func (q *SQSQueue) Consume(ctx context.Context, topic string, handler MessageHandler) error {
+	wait := q.WaitTime
+	if wait <= 0 || wait > 20*time.Second {
+		wait = 20 * time.Second
+	}
+
+	max := q.MaxMessages
+	if max <= 0 || max > 10 {
+		max = 10
+	}
+
+	for {
+		var out struct {
+			Messages []sqsMessage `json:"Messages"`
+		}
+
+		err := q.call(ctx, "ReceiveMessage", map[string]interface{}{
+			"QueueUrl":                    topic,
+			"MaxNumberOfMessages":         max,
+			"WaitTimeSeconds":             int(wait.Seconds()),
+			"MessageSystemAttributeNames": []string{"ApproximateReceiveCount"},
+		}, &out)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// back off briefly on transient failures instead of spinning
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		for _, m := range out.Messages {
+			attempt, _ := strconv.Atoi(m.Attributes["ApproximateReceiveCount"])
+
+			if err := handler(ctx, Message{ID: m.MessageID, Topic: topic, Body: []byte(m.Body), Attempt: attempt}); err != nil {
+				continue
+			}
+
+			_ = q.call(ctx, "DeleteMessage", map[string]interface{}{"QueueUrl": topic, "ReceiptHandle": m.ReceiptHandle}, nil)
+		}
+	}
+}
+
+// Close does nothing; SQSQueue holds no connections of its own.
+func (q *SQSQueue) Close() error {
+	return nil
+}
+
+// call invokes an SQS JSON API action, decoding the response into out if it is not nil.
+func (q *SQSQueue) call(ctx context.Context, action string, in interface{}, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	endpoint := q.Endpoint
+	if endpoint == "" {
+		endpoint = "https://sqs." + q.Region + ".amazonaws.com/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+
+	signAWSRequest(req, body, q.Credentials, q.Region, "sqs", time.Now())
+
+	client := q.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+
+		return fmt.Errorf("sqs %s: status %d: %s %s", action, res.StatusCode, apiErr.Type, apiErr.Message)
+	}
+
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignAWSRequest(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+
+	signAWSRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("unexpected signature:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestSQSQueue(t *testing.T) {
+	var mu sync.Mutex
+	var queue []string
+	var deleted []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var in map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "AmazonSQS.SendMessage":
+			queue = append(queue, in["MessageBody"].(string))
+			_, _ = w.Write([]byte(`{"MessageId":"1"}`))
+		case "AmazonSQS.ReceiveMessage":
+			var msgs []map[string]interface{}
+			for _, body := range queue {
+				msgs = append(msgs, map[string]interface{}{
+					"MessageId": "m", "ReceiptHandle": "rh-" + body, "Body": body,
+					"Attributes": map[string]string{"ApproximateReceiveCount": "1"},
+				})
+			}
+			queue = nil
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"Messages": msgs})
+		case "AmazonSQS.DeleteMessage":
+			deleted = append(deleted, in["ReceiptHandle"].(string))
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"InvalidAction","message":"unknown"}`))
+		}
+	}))
+	defer srv.Close()
+
+	q := &SQSQueue{Region: "us-east-1", Credentials: AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, Endpoint: srv.URL, WaitTime: time.Second}
+	queueURL := srv.URL + "/000000000000/uploads"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_ = q.Publish(ctx, queueURL, []byte(`{"n":1}`))
+	_ = q.Publish(ctx, queueURL, []byte(`{"n":2}`))
+
+	handled := make(chan string, 2)
+	consumeCtx, stop := context.WithCancel(ctx)
+	go func() {
+		_ = q.Consume(consumeCtx, queueURL, func(ctx context.Context, m Message) error {
+			handled <- string(m.Body)
+			if strings.Contains(string(m.Body), "2") {
+				return context.Canceled
+			}
+			return nil
+		})
+	}()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-ctx.Done():
+			t.Fatal("messages not consumed")
+		}
+	}
+	stop()
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 1 || deleted[0] != `rh-{"n":1}` {
+		t.Errorf("expected only the successful message to be deleted, got %v", deleted)
+	}
+}
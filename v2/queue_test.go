@@ -0,0 +1,122 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTools_PublishJSONMemoryQueue(t *testing.T) {
+	var testTools Tools
+	q := NewMemoryQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := testTools.PublishJSON(ctx, q, "webhooks", map[string]string{"event": "upload.completed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var attempts []int
+	received := make(chan string, 1)
+
+	go func() {
+		_ = q.Consume(ctx, "webhooks", func(ctx context.Context, m Message) error {
+			attempts = append(attempts, m.Attempt)
+			if m.Attempt < 2 {
+				return errors.New("temporary failure")
+			}
+			received <- string(m.Body)
+			return nil
+		})
+	}()
+
+	select {
+	case body := <-received:
+		if body != `{"event":"upload.completed"}` {
+			t.Errorf("unexpected body: %s", body)
+		}
+	case <-ctx.Done():
+		t.Fatal("message was not redelivered")
+	}
+
+	if len(attempts) != 2 {
+		t.Errorf("expected 2 attempts, got %v", attempts)
+	}
+
+	_ = q.Close()
+	if err := q.Publish(context.Background(), "webhooks", nil); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+type fakeAMQPChannel struct {
+	mu         sync.Mutex
+	published  []string
+	acks       int
+	nacks      []bool
+	deliveries chan AMQPDelivery
+}
+
+func (c *fakeAMQPChannel) Publish(ctx context.Context, exchange, routingKey string, body []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, exchange+"/"+routingKey+":"+string(body))
+	return nil
+}
+
+func (c *fakeAMQPChannel) Consume(ctx context.Context, queue string) (<-chan AMQPDelivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *fakeAMQPChannel) Close() error { return nil }
+
+func (c *fakeAMQPChannel) delivery(body string, redelivered bool) AMQPDelivery {
+	return AMQPDelivery{
+		Body:        []byte(body),
+		Redelivered: redelivered,
+		Ack: func() error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.acks++
+			return nil
+		},
+		Nack: func(requeue bool) error {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.nacks = append(c.nacks, requeue)
+			return nil
+		},
+	}
+}
+
+func TestAMQPQueue(t *testing.T) {
+	ch := &fakeAMQPChannel{deliveries: make(chan AMQPDelivery, 3)}
+	q := &AMQPQueue{Channel: ch, Exchange: "events"}
+
+	_ = q.Publish(context.Background(), "upload.completed", []byte("{}"))
+	if len(ch.published) != 1 || ch.published[0] != "events/upload.completed:{}" {
+		t.Errorf("unexpected publications: %v", ch.published)
+	}
+
+	ch.deliveries <- ch.delivery("ok", false)
+	ch.deliveries <- ch.delivery("fail", false)
+	ch.deliveries <- ch.delivery("fail", true)
+	close(ch.deliveries)
+
+	err := q.Consume(context.Background(), "uploads", func(ctx context.Context, m Message) error {
+		if string(m.Body) == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("expected ErrQueueClosed when deliveries end, got %v", err)
+	}
+
+	if ch.acks != 1 || len(ch.nacks) != 2 || !ch.nacks[0] || ch.nacks[1] {
+		t.Errorf("expected 1 ack and nacks [true false], got %d and %v", ch.acks, ch.nacks)
+	}
+}
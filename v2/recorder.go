@@ -0,0 +1,60 @@
+package toolkit
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseRecorder buffers a handler's response in memory, for middleware that checks, shares or replays it.
+type responseRecorder struct {
+	w      http.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// newResponseRecorder creates a responseRecorder. With a non-nil w, headers are set on w directly and flush sends
+// the buffered status and body to it; otherwise the headers are kept in a map of their own.
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if w == nil {
+		return &responseRecorder{header: make(http.Header)}
+	}
+
+	return &responseRecorder{w: w, header: w.Header()}
+}
+
+// Header returns the response headers.
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader records the status code.
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+// Write buffers the body.
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	return rec.body.Write(b)
+}
+
+// Unwrap exposes the wrapped writer, if any, to http.ResponseController.
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.w
+}
+
+// flush sends the buffered response to the wrapped writer.
+func (rec *responseRecorder) flush() {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	rec.w.WriteHeader(rec.status)
+	_, _ = rec.w.Write(rec.body.Bytes())
+}
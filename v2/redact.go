@@ -0,0 +1,272 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactedFields are the field names redacted by NewRedactor when none are given.
+var DefaultRedactedFields = []string{
+	"password", "passwd", "secret", "*token", "apikey", "authorization", "cookie", "setcookie",
+	"ssn", "cardnumber", "creditcard", "cvv", "pin",
+}
+
+// Redactor hides sensitive values in request bodies, audit entries, logs and responses.
+// Fields:
+// - Fields: Field names whose values are always replaced. Names are matched ignoring case, '-' and '_', so
+// "apikey" matches "api_key", "API-Key" and "apiKey", and may be path.Match patterns such as "*token".
+// - Patterns: Patterns replaced wherever they appear in string values, e.g. regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)
+// for US social security numbers.
+// - Replacement: The replacement text. Defaults to "[REDACTED]".
+type Redactor struct {
+	Fields      []string
+	Patterns    []*regexp.Regexp
+	Replacement string
+}
+
+// NewRedactor returns a Redactor for the given field names, or for DefaultRedactedFields if none are given.
+func NewRedactor(fields ...string) *Redactor {
+	if len(fields) == 0 {
+		fields = DefaultRedactedFields
+	}
+
+	return &Redactor{Fields: fields}
+}
+
+// replacement returns the replacement text.
+func (rd *Redactor) replacement() string {
+	if rd.Replacement != "" {
+		return rd.Replacement
+	}
+
+	return "[REDACTED]"
+}
+
+// normalizeFieldName lowercases a field name and drops '-' and '_'.
+func normalizeFieldName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// IsSensitive reports whether values of the named field are redacted.
+func (rd *Redactor) IsSensitive(name string) bool {
+	name = normalizeFieldName(name)
+
+	for _, f := range rd.Fields {
+		f = normalizeFieldName(f)
+		if f == name {
+			return true
+		}
+		if ok, _ := path.Match(f, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactString replaces the Patterns in s.
+func (rd *Redactor) RedactString(s string) string {
+	for _, p := range rd.Patterns {
+		s = p.ReplaceAllLiteralString(s, rd.replacement())
+	}
+
+	return s
+}
+
+// RedactJSON returns a copy of a JSON document with the values of sensitive fields replaced, at any depth, and
+// the Patterns replaced in all other strings. Input that is not valid JSON is treated as text.
+func (rd *Redactor) RedactJSON(data []byte) []byte {
+	out, err := rd.redactJSON(data)
+	if err != nil {
+		return []byte(rd.RedactString(string(data)))
+	}
+
+	return out
+}
+
+// redactJSON redacts one JSON value, keeping key order.
+func (rd *Redactor) redactJSON(raw json.RawMessage) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch trimmed[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(trimmed, &s); err != nil {
+			return nil, err
+		}
+		return json.Marshal(rd.RedactString(s))
+	case '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, item := range items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			redacted, err := rd.redactJSON(item)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(redacted)
+		}
+		buf.WriteByte(']')
+
+		return buf.Bytes(), nil
+	case '{':
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('{')
+		for i := 0; dec.More(); i++ {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := tok.(string)
+
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, err
+			}
+
+			if rd.IsSensitive(key) {
+				value, _ = json.Marshal(rd.replacement())
+			} else if value, err = rd.redactJSON(value); err != nil {
+				return nil, err
+			}
+
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			name, _ := json.Marshal(key)
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(value)
+		}
+		buf.WriteByte('}')
+
+		return buf.Bytes(), nil
+	default:
+		// numbers, booleans and null
+		if !json.Valid(trimmed) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return trimmed, nil
+	}
+}
+
+// RedactValue marshals v to JSON and redacts it, e.g. for an audit entry or a structured log attribute.
+// Returns the redacted JSON, or null if v cannot be marshaled.
+func (rd *Redactor) RedactValue(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+
+	return rd.RedactJSON(data)
+}
+
+// RedactValues returns a copy of form or query values with sensitive fields redacted.
+func (rd *Redactor) RedactValues(values url.Values) url.Values {
+	out := make(url.Values, len(values))
+
+	for key, vals := range values {
+		for _, v := range vals {
+			if rd.IsSensitive(key) {
+				v = rd.replacement()
+			} else {
+				v = rd.RedactString(v)
+			}
+			out[key] = append(out[key], v)
+		}
+	}
+
+	return out
+}
+
+// RedactHeader returns a copy of the header with sensitive headers, such as Authorization and Cookie, redacted.
+func (rd *Redactor) RedactHeader(h http.Header) http.Header {
+	return http.Header(rd.RedactValues(url.Values(h)))
+}
+
+// RequestBody reads up to max bytes of a request body for logging, redacted according to its content type, and
+// restores the body so handlers can still read it.
+// Parameters:
+// - r: The request.
+// - max: The maximum number of bytes to log. Longer bodies are truncated before redaction.
+// Returns the redacted body, or an error if it cannot be read.
+func (rd *Redactor) RequestBody(r *http.Request, max int64) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, max))
+	if err != nil {
+		return "", err
+	}
+
+	// put back what was read in front of the rest of the body
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+	contentType := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(contentType, "json"):
+		return string(rd.RedactJSON(data)), nil
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		if values, err := url.ParseQuery(string(data)); err == nil {
+			return rd.RedactValues(values).Encode(), nil
+		}
+	}
+
+	return rd.RedactString(string(data)), nil
+}
+
+// ReplaceAttr redacts log attributes, for use as slog.HandlerOptions.ReplaceAttr:
+//
+//	slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{ReplaceAttr: redactor.ReplaceAttr}))
+//
+// Sensitive keys are replaced, string values have the Patterns replaced, and maps, slices and structs are
+// redacted as JSON.
+func (rd *Redactor) ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	if rd.IsSensitive(a.Key) {
+		return slog.String(a.Key, rd.replacement())
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, rd.RedactString(a.Value.String()))
+	case slog.KindAny:
+		v := a.Value.Any()
+		if _, ok := v.(error); ok {
+			return slog.String(a.Key, rd.RedactString(a.Value.String()))
+		}
+
+		switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+		case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct:
+			return slog.Any(a.Key, rd.RedactValue(v))
+		}
+	}
+
+	return a
+}
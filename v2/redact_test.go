@@ -0,0 +1,91 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var redactJSONTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{name: "flat", input: `{"user":"ann","password":"hunter2"}`, expected: `{"user":"ann","password":"[REDACTED]"}`},
+	{name: "nested and arrays", input: `{"items":[{"api_key":"k1"},{"API-Key":"k2","n":1}]}`, expected: `{"items":[{"api_key":"[REDACTED]"},{"API-Key":"[REDACTED]","n":1}]}`},
+	{name: "glob field", input: `{"refreshToken":{"v":"x"},"tokens":2}`, expected: `{"refreshToken":"[REDACTED]","tokens":2}`},
+	{name: "value pattern", input: `{"note":"ssn 123-45-6789 on file"}`, expected: `{"note":"ssn [REDACTED] on file"}`},
+	{name: "not json", input: `ssn=123-45-6789`, expected: `ssn=[REDACTED]`},
+}
+
+func TestRedactor_RedactJSON(t *testing.T) {
+	rd := NewRedactor()
+	rd.Patterns = []*regexp.Regexp{regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)}
+
+	for _, e := range redactJSONTests {
+		if got := string(rd.RedactJSON([]byte(e.input))); got != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestRedactor_RequestBodyAndHeaders(t *testing.T) {
+	rd := NewRedactor()
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("user=ann&password=hunter2"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer abc")
+
+	logged, err := rd.RequestBody(req, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values, _ := url.ParseQuery(logged); values.Get("password") != "[REDACTED]" || values.Get("user") != "ann" {
+		t.Errorf("unexpected logged body %s", logged)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "user=ann&password=hunter2" {
+		t.Errorf("expected the body to be restored, got %s", body)
+	}
+
+	h := rd.RedactHeader(req.Header)
+	if h.Get("Authorization") != "[REDACTED]" || req.Header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("expected a redacted copy of the headers, got %v", h)
+	}
+}
+
+func TestRedactor_ReplaceAttr(t *testing.T) {
+	rd := NewRedactor()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: rd.ReplaceAttr}))
+
+	logger.Info("login", "password", "hunter2", "audit", map[string]interface{}{"user": "ann", "token": "t"})
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, `"audit":{"token":"[REDACTED]","user":"ann"}`) {
+		t.Errorf("unexpected log line %s", out)
+	}
+}
+
+func TestTools_WriteJSONWithOptionsRedactor(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	data := map[string]string{"name": "ann", "secret": "s"}
+
+	if err := testTools.WriteJSONWithOptions(rr, nil, http.StatusOK, data, WriteJSONOptions{Redactor: NewRedactor()}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rr.Body.String() != `{"name":"ann","secret":"[REDACTED]"}` {
+		t.Errorf("expected redacted output, got %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,539 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRedisNil is returned when a Redis key does not exist.
+var ErrRedisNil = errors.New("redis: nil")
+
+// RedisError is an error reply sent by the Redis server, such as "WRONGTYPE Operation against a key...".
+type RedisError string
+
+// Error returns the error message sent by the server.
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+const (
+	// redisIncrScript increments a counter and sets its expiry only when it is created, atomically.
+	redisIncrScript = `local n = redis.call('INCR', KEYS[1]) if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end return n`
+	// redisUnlockScript deletes a lock only if it is still held by the given token.
+	redisUnlockScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) else return 0 end`
+	// redisRenewScript extends a lock only if it is still held by the given token.
+	redisRenewScript = `if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('PEXPIRE', KEYS[1], ARGV[2]) else return 0 end`
+	// redisGuardFailScript counts a failure in a JSON encoded GuardState, as RedisGuardStore.AddFailure.
+	redisGuardFailScript = `local v = redis.call('GET', KEYS[1]) ` +
+		`local s = {failures = 0, last_failure = '0001-01-01T00:00:00Z', locked_until = '0001-01-01T00:00:00Z'} ` +
+		`if v then s = cjson.decode(v) end ` +
+		`s.failures = s.failures + 1 s.last_failure = ARGV[1] ` +
+		`local ttl = tonumber(ARGV[2]) ` +
+		`if tonumber(ARGV[3]) > 0 and s.failures >= tonumber(ARGV[3]) then s.locked_until = ARGV[4] ttl = tonumber(ARGV[5]) end ` +
+		`v = cjson.encode(s) ` +
+		`if ttl > 0 then redis.call('SET', KEYS[1], v, 'PX', ttl) else redis.call('SET', KEYS[1], v) end ` +
+		`return v`
+)
+
+// RedisClient is a small, dependency-free Redis client speaking RESP over a pool of TCP connections.
+// It is the shared backend of the toolkit's Redis-backed stores.
+// Fields:
+// - Addr: The host:port of the Redis server.
+// - Password: An optional password sent with AUTH.
+// - DB: The database number selected on each connection.
+// - DialTimeout: The timeout for establishing connections. Defaults to 5 seconds.
+// - PoolSize: The maximum number of idle connections kept for reuse. Defaults to 10.
+type RedisClient struct {
+	Addr        string
+	Password    string
+	DB          int
+	DialTimeout time.Duration
+	PoolSize    int
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// NewRedisClient creates a RedisClient for the server at addr. Connections are opened lazily.
+// Parameters:
+// - addr: The host:port of the Redis server.
+// Returns a pointer to the new RedisClient.
+func NewRedisClient(addr string) *RedisClient {
+	return &RedisClient{Addr: addr}
+}
+
+// Do sends a command and returns its reply, which is one of nil, string, int64, []byte or []interface{}.
+// Parameters:
+// - ctx: The context bounding the round trip. Both its deadline and its cancellation interrupt the command.
+// - args: The command name followed by its arguments.
+// Returns the reply, a RedisError for error replies, or a network error.
+func (c *RedisClient) Do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	rc, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := rc.do(ctx, args...)
+
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		_ = rc.conn.Close()
+		return nil, err
+	}
+
+	c.put(rc)
+
+	return reply, err
+}
+
+// Get returns the value stored at key, or ErrRedisNil if the key does not exist.
+func (c *RedisClient) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrRedisNil
+	}
+
+	b, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected reply %T for GET", reply)
+	}
+
+	return b, nil
+}
+
+// Set stores value at key. A ttl of zero stores the key without expiry.
+func (c *RedisClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []interface{}{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", redisMillis(ttl))
+	}
+
+	_, err := c.Do(ctx, args...)
+
+	return err
+}
+
+// SetNX stores value at key only if the key does not exist yet.
+// Returns true if the value was stored.
+func (c *RedisClient) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	args := []interface{}{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", redisMillis(ttl))
+	}
+
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return reply != nil, nil
+}
+
+// Del removes the given keys and returns how many existed.
+func (c *RedisClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	args := make([]interface{}, 0, len(keys)+1)
+	args = append(args, "DEL")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+
+	reply, err := c.Do(ctx, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	n, _ := reply.(int64)
+
+	return n, nil
+}
+
+// GetJSON reads the value at key and decodes it as JSON into dst.
+// Returns ErrRedisNil if the key does not exist.
+func (c *RedisClient) GetJSON(ctx context.Context, key string, dst interface{}) error {
+	b, err := c.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
+
+// SetJSON encodes v as JSON and stores it at key with the given ttl.
+func (c *RedisClient) SetJSON(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return c.Set(ctx, key, b, ttl)
+}
+
+// IncrWithExpiry atomically increments the counter at key, setting its expiry when the counter is created.
+// This is the building block of fixed-window rate limits.
+// Returns the counter value after the increment.
+func (c *RedisClient) IncrWithExpiry(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	reply, err := c.Do(ctx, "EVAL", redisIncrScript, 1, key, redisMillis(ttl))
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected reply %T for INCR", reply)
+	}
+
+	return n, nil
+}
+
+// Lock tries to acquire a lock at key for ttl.
+// Returns a token identifying this holder and true if the lock was acquired, or false if another holder has it.
+func (c *RedisClient) Lock(ctx context.Context, key string, ttl time.Duration) (string, bool, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", false, err
+	}
+	token := hex.EncodeToString(b)
+
+	ok, err := c.SetNX(ctx, key, []byte(token), ttl)
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	return token, true, nil
+}
+
+// Unlock releases the lock at key if it is still held by token.
+// Returns true if the lock was released, or false if it had expired or was taken by another holder.
+func (c *RedisClient) Unlock(ctx context.Context, key, token string) (bool, error) {
+	reply, err := c.Do(ctx, "EVAL", redisUnlockScript, 1, key, token)
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := reply.(int64)
+
+	return n == 1, nil
+}
+
+// RenewLock extends the lock at key to ttl if it is still held by token.
+// Returns true if the lock was extended.
+func (c *RedisClient) RenewLock(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	reply, err := c.Do(ctx, "EVAL", redisRenewScript, 1, key, token, redisMillis(ttl))
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := reply.(int64)
+
+	return n == 1, nil
+}
+
+// Close closes all idle connections.
+func (c *RedisClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rc := range c.idle {
+		_ = rc.conn.Close()
+	}
+	c.idle = nil
+
+	return nil
+}
+
+// get returns an idle connection or dials a new one.
+func (c *RedisClient) get(ctx context.Context) (*redisConn, error) {
+	c.mu.Lock()
+	if n := len(c.idle); n > 0 {
+		rc := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return rc, nil
+	}
+	c.mu.Unlock()
+
+	timeout := c.DialTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	rc := &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+
+	if c.Password != "" {
+		if _, err := rc.do(ctx, "AUTH", c.Password); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	if c.DB != 0 {
+		if _, err := rc.do(ctx, "SELECT", c.DB); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+// put returns a healthy connection to the pool, closing it if the pool is full.
+func (c *RedisClient) put(rc *redisConn) {
+	size := c.PoolSize
+	if size <= 0 {
+		size = 10
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.idle) >= size {
+		_ = rc.conn.Close()
+		return
+	}
+
+	c.idle = append(c.idle, rc)
+}
+
+// do writes one command and reads its reply.
+func (rc *redisConn) do(ctx context.Context, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	if err := rc.conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// a cancelled context interrupts the round trip by moving the deadline into the past
+	stop := context.AfterFunc(ctx, func() { _ = rc.conn.SetDeadline(time.Unix(1, 0)) })
+
+	reply, err := rc.roundTrip(args)
+
+	if !stop() {
+		// the deadline may have been cut, so the connection is reported broken rather than reused
+		return nil, ctx.Err()
+	}
+
+	return reply, err
+}
+
+// roundTrip writes a command and reads its reply.
+func (rc *redisConn) roundTrip(args []interface{}) (interface{}, error) {
+	if _, err := rc.conn.Write(encodeRESPCommand(args)); err != nil {
+		return nil, err
+	}
+
+	return readRESP(rc.rd)
+}
+
+// redisMillis converts a ttl to the milliseconds of a PX or PEXPIRE argument, rounding up so a ttl under a
+// millisecond is not sent as 0, which Redis rejects.
+func redisMillis(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return ttl.Milliseconds()
+	}
+
+	return int64((ttl + time.Millisecond - 1) / time.Millisecond)
+}
+
+// encodeRESPCommand encodes a command as a RESP array of bulk strings.
+func encodeRESPCommand(args []interface{}) []byte {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+
+	for _, a := range args {
+		var s string
+		switch v := a.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			s = fmt.Sprint(v)
+		}
+
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(s)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, s...)
+		buf = append(buf, "\r\n"...)
+	}
+
+	return buf
+}
+
+// readRESP reads a single RESP reply.
+func readRESP(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+
+	case '-':
+		return nil, RedisError(body)
+
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errors.New("redis: malformed bulk length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, b); err != nil {
+			return nil, err
+		}
+
+		return b[:n], nil
+
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, errors.New("redis: malformed array length")
+		}
+		if n < 0 {
+			return nil, nil
+		}
+
+		items := make([]interface{}, n)
+		for i := range items {
+			item, err := readRESP(rd)
+			var redisErr RedisError
+			if err != nil && !errors.As(err, &redisErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = redisErr
+			}
+			items[i] = item
+		}
+
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
+
+// RedisGuardStore is a GuardStore backed by Redis, sharing login throttling state across replicas.
+type RedisGuardStore struct {
+	Client *RedisClient
+	Prefix string
+}
+
+// Get returns the state stored for key, or a zero state if there is none.
+func (s *RedisGuardStore) Get(ctx context.Context, key string) (GuardState, error) {
+	var state GuardState
+
+	err := s.Client.GetJSON(ctx, s.Prefix+key, &state)
+	if errors.Is(err, ErrRedisNil) {
+		return GuardState{}, nil
+	}
+
+	return state, err
+}
+
+// Set stores the state for key for the duration of ttl.
+func (s *RedisGuardStore) Set(ctx context.Context, key string, state GuardState, ttl time.Duration) error {
+	return s.Client.SetJSON(ctx, s.Prefix+key, state, ttl)
+}
+
+// AddFailure counts a failure for key in a single script, so concurrent replicas never lose a failure.
+func (s *RedisGuardStore) AddFailure(ctx context.Context, key string, f GuardFailure) (GuardState, error) {
+	reply, err := s.Client.Do(ctx, "EVAL", redisGuardFailScript, 1, s.Prefix+key,
+		f.At.Format(time.RFC3339Nano), redisMillis(f.TTL), f.LockThreshold,
+		f.LockedUntil.Format(time.RFC3339Nano), redisMillis(f.LockTTL))
+	if err != nil {
+		return GuardState{}, err
+	}
+
+	b, ok := reply.([]byte)
+	if !ok {
+		return GuardState{}, fmt.Errorf("redis: unexpected reply %T for EVAL", reply)
+	}
+
+	var state GuardState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return GuardState{}, err
+	}
+
+	return state, nil
+}
+
+// Delete removes the state stored for key.
+func (s *RedisGuardStore) Delete(ctx context.Context, key string) error {
+	_, err := s.Client.Del(ctx, s.Prefix+key)
+	return err
+}
+
+// RedisTokenStore is a TokenStore backed by Redis, so verification tokens stay single-use across replicas.
+type RedisTokenStore struct {
+	Client *RedisClient
+	Prefix string
+}
+
+// Spend marks id as spent until the given time, returning false if it was already spent.
+func (s *RedisTokenStore) Spend(ctx context.Context, id string, until time.Time) (bool, error) {
+	ttl := time.Until(until)
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+
+	return s.Client.SetNX(ctx, s.Prefix+"token:"+id, []byte("1"), ttl)
+}
+
+// IsSpent reports whether id has been spent.
+func (s *RedisTokenStore) IsSpent(ctx context.Context, id string) (bool, error) {
+	_, err := s.Client.Get(ctx, s.Prefix+"token:"+id)
+	if errors.Is(err, ErrRedisNil) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
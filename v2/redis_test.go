@@ -0,0 +1,322 @@
+package toolkit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-memory server speaking just enough RESP to exercise RedisClient.
+type fakeRedis struct {
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+}
+
+func newFakeRedis(t *testing.T) *RedisClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &fakeRedis{values: map[string]string{}, expires: map[string]time.Time{}}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	client := NewRedisClient(ln.Addr().String())
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = ln.Close()
+	})
+
+	return client
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	for {
+		reply, err := readRESP(rd)
+		if err != nil {
+			return
+		}
+
+		var args []string
+		for _, a := range reply.([]interface{}) {
+			args = append(args, string(a.([]byte)))
+		}
+
+		_, _ = conn.Write([]byte(f.exec(args)))
+	}
+}
+
+func (f *fakeRedis) get(key string) (string, bool) {
+	if exp, ok := f.expires[key]; ok && time.Now().After(exp) {
+		delete(f.values, key)
+		delete(f.expires, key)
+	}
+	v, ok := f.values[key]
+	return v, ok
+}
+
+func (f *fakeRedis) exec(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+	integer := func(n int) string { return fmt.Sprintf(":%d\r\n", n) }
+
+	switch strings.ToUpper(args[0]) {
+	case "AUTH", "SELECT", "PING":
+		return "+OK\r\n"
+
+	case "GET":
+		if v, ok := f.get(args[1]); ok {
+			return bulk(v)
+		}
+		return "$-1\r\n"
+
+	case "SET":
+		key, value := args[1], args[2]
+		nx, px := false, 0
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				nx = true
+			case "PX":
+				px, _ = strconv.Atoi(args[i+1])
+				if px <= 0 {
+					return "-ERR invalid expire time in 'set' command\r\n"
+				}
+				i++
+			}
+		}
+		if _, exists := f.get(key); nx && exists {
+			return "$-1\r\n"
+		}
+		f.values[key] = value
+		delete(f.expires, key)
+		if px > 0 {
+			f.expires[key] = time.Now().Add(time.Duration(px) * time.Millisecond)
+		}
+		return "+OK\r\n"
+
+	case "DEL":
+		n := 0
+		for _, k := range args[1:] {
+			if _, ok := f.get(k); ok {
+				delete(f.values, k)
+				n++
+			}
+		}
+		return integer(n)
+
+	case "EVAL":
+		script, key := args[1], args[3]
+		switch script {
+		case redisIncrScript:
+			v, _ := f.get(key)
+			n, _ := strconv.Atoi(v)
+			n++
+			f.values[key] = strconv.Itoa(n)
+			if n == 1 {
+				ms, _ := strconv.Atoi(args[4])
+				f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			return integer(n)
+		case redisUnlockScript:
+			if v, ok := f.get(key); ok && v == args[4] {
+				delete(f.values, key)
+				return integer(1)
+			}
+			return integer(0)
+		case redisRenewScript:
+			if v, ok := f.get(key); ok && v == args[4] {
+				ms, _ := strconv.Atoi(args[5])
+				f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+				return integer(1)
+			}
+			return integer(0)
+		case redisGuardFailScript:
+			var state GuardState
+			if v, ok := f.get(key); ok {
+				_ = json.Unmarshal([]byte(v), &state)
+			}
+			state.Failures++
+			state.LastFailure, _ = time.Parse(time.RFC3339Nano, args[4])
+			ms, _ := strconv.Atoi(args[5])
+			if threshold, _ := strconv.Atoi(args[6]); threshold > 0 && state.Failures >= threshold {
+				state.LockedUntil, _ = time.Parse(time.RFC3339Nano, args[7])
+				ms, _ = strconv.Atoi(args[8])
+			}
+			b, _ := json.Marshal(state)
+			f.values[key] = string(b)
+			delete(f.expires, key)
+			if ms > 0 {
+				f.expires[key] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+			}
+			return bulk(string(b))
+		}
+	}
+
+	return "-ERR unknown command '" + args[0] + "'\r\n"
+}
+
+func TestRedisClient_GetSetJSON(t *testing.T) {
+	client := newFakeRedis(t)
+	ctx := context.Background()
+
+	type payload struct {
+		Name string `json:"name"`
+	}
+
+	if err := client.SetJSON(ctx, "user:1", payload{Name: "ann"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var got payload
+	if err := client.GetJSON(ctx, "user:1", &got); err != nil || got.Name != "ann" {
+		t.Errorf("expected to read back payload, got %+v (%v)", got, err)
+	}
+
+	if _, err := client.Get(ctx, "missing"); !errors.Is(err, ErrRedisNil) {
+		t.Errorf("expected ErrRedisNil, got %v", err)
+	}
+
+	if _, err := client.Do(ctx, "BOGUS"); !strings.HasPrefix(fmt.Sprint(err), "ERR unknown command") {
+		t.Errorf("expected RedisError, got %v", err)
+	}
+
+	// the connection must still be usable after an error reply
+	if n, err := client.Del(ctx, "user:1"); err != nil || n != 1 {
+		t.Errorf("expected 1 key deleted, got %d (%v)", n, err)
+	}
+}
+
+func TestRedisClient_SubMillisecondTTL(t *testing.T) {
+	client := newFakeRedis(t)
+	ctx := context.Background()
+
+	if err := client.Set(ctx, "short", []byte("1"), 500*time.Microsecond); err != nil {
+		t.Errorf("expected a sub-millisecond ttl rounded up, got %v", err)
+	}
+}
+
+func TestRedisClient_ContextCancel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// a server that accepts commands and never answers
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := NewRedisClient(ln.Addr().String())
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.Get(ctx, "key")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the cancelled command to return")
+	}
+}
+
+func TestRedisClient_IncrWithExpiry(t *testing.T) {
+	client := newFakeRedis(t)
+	ctx := context.Background()
+
+	for i := int64(1); i <= 3; i++ {
+		n, err := client.IncrWithExpiry(ctx, "hits", time.Minute)
+		if err != nil || n != i {
+			t.Errorf("expected %d, got %d (%v)", i, n, err)
+		}
+	}
+}
+
+func TestRedisClient_Lock(t *testing.T) {
+	client := newFakeRedis(t)
+	ctx := context.Background()
+
+	token, ok, err := client.Lock(ctx, "lock:job", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("expected lock to be acquired, got %v (%v)", ok, err)
+	}
+
+	if _, ok, _ := client.Lock(ctx, "lock:job", time.Minute); ok {
+		t.Error("expected second lock attempt to fail")
+	}
+
+	if ok, _ := client.Unlock(ctx, "lock:job", "wrong-token"); ok {
+		t.Error("expected unlock with a foreign token to fail")
+	}
+
+	if ok, _ := client.Unlock(ctx, "lock:job", token); !ok {
+		t.Error("expected unlock with the holder's token to succeed")
+	}
+}
+
+func TestRedisStores(t *testing.T) {
+	client := newFakeRedis(t)
+	ctx := context.Background()
+
+	guard := NewBruteForceGuard(&RedisGuardStore{Client: client, Prefix: "test:"})
+	guard.FreeAttempts = 0
+	guard.LockoutThreshold = 2
+	if err := guard.Fail(ctx, "ann", "10.0.0.1"); err == nil {
+		t.Error("expected throttling to be persisted in redis")
+	}
+	var throttleErr *ThrottleError
+	if err := guard.Fail(ctx, "ann", "10.0.0.1"); !errors.As(err, &throttleErr) || !throttleErr.Locked {
+		t.Errorf("expected the second failure to lock out, got %v", err)
+	}
+	if state, _ := guard.Store.Get(ctx, guardKey("ann", "10.0.0.1")); state.Failures != 2 {
+		t.Errorf("expected 2 failures stored, got %d", state.Failures)
+	}
+
+	tokens := NewVerificationTokens([]byte("a-very-secret-key-for-testing-only"), &RedisTokenStore{Client: client})
+	token, _ := tokens.Generate("verify-email", "ann", time.Hour)
+	if _, err := tokens.Consume(ctx, token, "verify-email"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.Consume(ctx, token, "verify-email"); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("expected ErrTokenUsed, got %v", err)
+	}
+}
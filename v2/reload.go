@@ -0,0 +1,204 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RuntimeConfig is the part of the configuration a ReloadableConfig re-reads without a restart.
+// Fields:
+// - MaxFileSize: Replaces Tools.MaxFileSize.
+// - AllowedFileTypes: Replaces Tools.AllowedFileTypes.
+// - MaxJSONSize: Replaces Tools.MaxJSONSize.
+// - AllowUnknownFields: Replaces Tools.AllowUnknownFields.
+// - Flags: The feature flags, in any form FeatureFlags.LoadJSON accepts. When set, they replace the flags of
+// ReloadableConfig.Flags.
+type RuntimeConfig struct {
+	MaxFileSize        int             `json:"max_file_size"`
+	AllowedFileTypes   []string        `json:"allowed_file_types"`
+	MaxJSONSize        int             `json:"max_json_size"`
+	AllowUnknownFields bool            `json:"allow_unknown_fields"`
+	Flags              json.RawMessage `json:"flags,omitempty"`
+}
+
+// ConfigLoader returns the current RuntimeConfig, e.g. read from a file or a configuration service.
+type ConfigLoader func(ctx context.Context) (RuntimeConfig, error)
+
+// ConfigFile returns a ConfigLoader reading a JSON file. Unknown fields are refused, so a typo is reported
+// instead of silently ignored.
+func ConfigFile(pathName string) ConfigLoader {
+	return func(context.Context) (RuntimeConfig, error) {
+		data, err := os.ReadFile(pathName)
+		if err != nil {
+			return RuntimeConfig{}, err
+		}
+
+		var c RuntimeConfig
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return RuntimeConfig{}, fmt.Errorf("invalid config %s: %w", pathName, err)
+		}
+
+		return c, nil
+	}
+}
+
+// ReloadableConfig holds a Tools whose limits, allowed types and feature flags can be reloaded while it is in use,
+// on SIGHUP or through an admin endpoint. Every reload builds a new Tools from the base and swaps it in
+// atomically, so requests in flight keep the configuration they started with. Handlers call Tools for the
+// current one.
+// Fields:
+// - Flags: If set, receives the feature flags of each configuration.
+// - OnReload: If set, called after each successful reload with the new Tools, e.g. to log the change.
+type ReloadableConfig struct {
+	Flags    *FeatureFlags
+	OnReload func(t *Tools)
+
+	base    Tools
+	load    ConfigLoader
+	current atomic.Pointer[Tools]
+	mu      sync.Mutex
+	loaded  time.Time
+}
+
+// NewReloadableConfig creates a ReloadableConfig and loads the configuration a first time.
+// Parameters:
+// - base: The rest of the configuration, copied into every reloaded Tools.
+// - load: Reads the reloadable configuration.
+// - flags: Optional FeatureFlags receiving the configured flags, set as Flags. Only the first value is used if
+// multiple are provided.
+// Returns a pointer to the new ReloadableConfig, or an error if the first load fails.
+func NewReloadableConfig(base *Tools, load ConfigLoader, flags ...*FeatureFlags) (*ReloadableConfig, error) {
+	rc := &ReloadableConfig{base: *base, load: load}
+	if len(flags) > 0 {
+		rc.Flags = flags[0]
+	}
+	rc.current.Store(&rc.base)
+
+	if err := rc.Reload(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
+
+// Tools returns the current configuration. It must not be modified; it is replaced, not updated, on reload.
+func (rc *ReloadableConfig) Tools() *Tools {
+	return rc.current.Load()
+}
+
+// Reload reads the configuration and swaps it in. An invalid configuration is refused and the current one kept.
+// Returns an error if loading fails or the configuration is invalid.
+func (rc *ReloadableConfig) Reload(ctx context.Context) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	c, err := rc.load(ctx)
+	if err != nil {
+		return err
+	}
+	if c.MaxFileSize < 0 || c.MaxJSONSize < 0 {
+		return fmt.Errorf("invalid config: sizes must not be negative")
+	}
+
+	var flags []Flag
+	if len(c.Flags) > 0 && rc.Flags != nil {
+		if flags, err = decodeFlags(bytes.NewReader(c.Flags)); err != nil {
+			return err
+		}
+	}
+
+	next := rc.base
+	next.MaxFileSize = c.MaxFileSize
+	next.AllowedFileTypes = append([]string(nil), c.AllowedFileTypes...)
+	next.MaxJSONSize = c.MaxJSONSize
+	next.AllowUnknownFields = c.AllowUnknownFields
+
+	rc.current.Store(&next)
+	if flags != nil {
+		rc.Flags.Set(flags...)
+	}
+	rc.loaded = time.Now()
+
+	if rc.OnReload != nil {
+		rc.OnReload(&next)
+	}
+
+	return nil
+}
+
+// WatchSignals reloads the configuration whenever the process receives one of the signals, until ctx is done.
+// Failed reloads are logged with slog.Default() and the current configuration is kept.
+// Parameters:
+// - ctx: Stops watching when done.
+// - signals: The signals to reload on. Defaults to SIGHUP.
+func (rc *ReloadableConfig) WatchSignals(ctx context.Context, signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-ch:
+			if err := rc.Reload(ctx); err != nil {
+				slog.Default().ErrorContext(ctx, "config reload failed", slog.String("signal", sig.String()), slog.String("error", err.Error()))
+				continue
+			}
+			slog.Default().InfoContext(ctx, "config reloaded", slog.String("signal", sig.String()))
+		}
+	}
+}
+
+// Handler returns an admin endpoint reloading the configuration on POST, e.g. mounted as "POST /admin/reload".
+// It answers 200 OK with the time of the reload, 422 Unprocessable Entity with the reason the configuration was
+// refused, and 405 Method Not Allowed to anything but POST.
+// Parameters:
+// - auth: The middleware guarding the endpoint, e.g. Authorize with an admin policy. If nil, every request is
+// refused with 403 Forbidden.
+// Returns the handler.
+func (rc *ReloadableConfig) Handler(auth func(http.Handler) http.Handler) http.Handler {
+	t := &rc.base
+	if auth == nil {
+		auth = func(http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = t.ErrorJSON(w, ErrForbidden)
+			})
+		}
+	}
+
+	return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			_ = t.ErrorJSON(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := rc.Reload(r.Context()); err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusUnprocessableEntity)
+			return
+		}
+
+		rc.mu.Lock()
+		loaded := rc.loaded
+		rc.mu.Unlock()
+
+		_ = t.WriteJSON(w, http.StatusOK, JSONResponse{Message: "configuration reloaded", Data: map[string]interface{}{"reloaded_at": loaded.UTC()}})
+	}))
+}
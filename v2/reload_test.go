@@ -0,0 +1,139 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadableConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(s string) {
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"max_file_size": 1024, "allowed_file_types": ["image/png"], "flags": {"beta": {"enabled": true}}}`)
+
+	flags := NewFeatureFlags()
+	rc, err := NewReloadableConfig(&Tools{TenantRoot: "/srv"}, ConfigFile(path), flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := rc.Tools()
+	if first.MaxFileSize != 1024 || first.AllowedFileTypes[0] != "image/png" || first.TenantRoot != "/srv" || !flags.Enabled("beta", "") {
+		t.Errorf("unexpected first config %+v", first)
+	}
+
+	write(`{"max_file_size": 2048, "max_json_size": 10, "flags": []}`)
+	if err := rc.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := rc.Tools(); got.MaxFileSize != 2048 || got.MaxJSONSize != 10 || len(got.AllowedFileTypes) != 0 || flags.Enabled("beta", "") {
+		t.Errorf("unexpected reloaded config %+v", got)
+	}
+	if first.MaxFileSize != 1024 {
+		t.Error("expected the previous Tools to be left unchanged")
+	}
+
+	for _, bad := range []string{`{"max_file_size": -1}`, `{"max_fle_size": 1}`, `{"flags": 3}`, `{`} {
+		write(bad)
+		if err := rc.Reload(context.Background()); err == nil {
+			t.Errorf("%s: expected an invalid config to fail", bad)
+		}
+		if rc.Tools().MaxFileSize != 2048 {
+			t.Errorf("%s: expected the current config to be kept", bad)
+		}
+	}
+
+	if _, err := NewReloadableConfig(&Tools{}, ConfigFile(filepath.Join(t.TempDir(), "missing.json"))); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+}
+
+func TestReloadableConfig_Handler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	_ = os.WriteFile(path, []byte(`{"max_file_size": 1}`), 0o600)
+
+	rc, err := NewReloadableConfig(&Tools{}, ConfigFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allow := func(next http.Handler) http.Handler { return next }
+
+	var tests = []struct {
+		name   string
+		auth   func(http.Handler) http.Handler
+		method string
+		config string
+		status int
+	}{
+		{"reload", allow, "POST", `{"max_file_size": 2}`, 200},
+		{"invalid config", allow, "POST", `{"max_file_size": "x"}`, 422},
+		{"wrong method", allow, "GET", `{"max_file_size": 3}`, 405},
+		{"no auth", nil, "POST", `{"max_file_size": 4}`, 403},
+	}
+
+	for _, e := range tests {
+		_ = os.WriteFile(path, []byte(e.config), 0o600)
+		rr := httptest.NewRecorder()
+		rc.Handler(e.auth).ServeHTTP(rr, httptest.NewRequest(e.method, "/admin/reload", nil))
+
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.status, rr.Code, rr.Body.String())
+		}
+		if rc.Tools().MaxFileSize != 2 {
+			t.Errorf("%s: expected max file size 2, got %d", e.name, rc.Tools().MaxFileSize)
+		}
+	}
+}
+
+func TestReloadableConfig_WatchSignals(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	_ = os.WriteFile(path, []byte(`{"max_file_size": 1}`), 0o600)
+
+	rc, err := NewReloadableConfig(&Tools{}, ConfigFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan int, 10)
+	rc.OnReload = func(t *Tools) { reloaded <- t.MaxFileSize }
+
+	// keep SIGHUP from terminating the test binary until WatchSignals listens for it
+	guard := make(chan os.Signal, 10)
+	signal.Notify(guard, syscall.SIGHUP)
+	defer signal.Stop(guard)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go rc.WatchSignals(ctx)
+
+	_ = os.WriteFile(path, []byte(`{"max_file_size": 5}`), 0o600)
+	self, _ := os.FindProcess(os.Getpid())
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := self.Signal(syscall.SIGHUP); err != nil {
+			t.Skipf("cannot send SIGHUP: %v", err)
+		}
+		select {
+		case size := <-reloaded:
+			if size != 5 {
+				t.Errorf("expected the new config on SIGHUP, got max file size %d", size)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("expected SIGHUP to reload the config")
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRememberTokenNotFound is returned by a RememberStore for unknown selectors.
+var ErrRememberTokenNotFound = errors.New("remember-me token not found")
+
+// rememberGracePeriod is how long a rotated token is still accepted, so concurrent requests sent with the previous
+// cookie do not log the user out.
+const rememberGracePeriod = 30 * time.Second
+
+// RememberToken is a persistent login as kept by a RememberStore. The cookie holds the selector, which finds the
+// token, and a validator, of which only a hash is stored, so a leaked store cannot be used to log in.
+// Fields:
+// - Selector: The token's public identifier.
+// - ValidatorHash: The SHA-256 of the secret validator.
+// - UserID: The user the token logs in.
+// - ExpiresAt: When the token stops being accepted.
+// - RotatedAt: When the token was replaced by a new one, or zero if it is current.
+type RememberToken struct {
+	Selector      string    `json:"selector"`
+	ValidatorHash []byte    `json:"validator_hash"`
+	UserID        string    `json:"user_id"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	RotatedAt     time.Time `json:"rotated_at,omitempty"`
+}
+
+// RememberStore keeps remember-me tokens server-side, so they can be rotated and revoked.
+type RememberStore interface {
+	// Save stores the token, replacing any token with the same selector.
+	Save(ctx context.Context, token RememberToken) error
+	// Get returns the token with the selector, or ErrRememberTokenNotFound.
+	Get(ctx context.Context, selector string) (RememberToken, error)
+	// Rotate marks the token with the selector as rotated at rotatedAt, to be kept until expiresAt, if it still has
+	// expectedHash and was not rotated yet. It must do so atomically, so only one of concurrent callers rotates.
+	// Returns whether this caller rotated the token, or ErrRememberTokenNotFound if it is gone or was replaced.
+	Rotate(ctx context.Context, selector string, expectedHash []byte, rotatedAt, expiresAt time.Time) (bool, error)
+	// Delete removes the token with the selector.
+	Delete(ctx context.Context, selector string) error
+	// DeleteUser removes every token of the user, logging them out on all devices.
+	DeleteUser(ctx context.Context, userID string) error
+}
+
+// MemoryRememberStore is an in-process RememberStore. It is suitable for single-instance deployments and tests.
+type MemoryRememberStore struct {
+	mu     sync.Mutex
+	tokens map[string]RememberToken
+}
+
+// Save stores the token, dropping expired ones.
+func (s *MemoryRememberStore) Save(_ context.Context, token RememberToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokens == nil {
+		s.tokens = make(map[string]RememberToken)
+	}
+
+	now := time.Now()
+	for k, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, k)
+		}
+	}
+
+	s.tokens[token.Selector] = token
+
+	return nil
+}
+
+// Get returns the token with the selector, or ErrRememberTokenNotFound.
+func (s *MemoryRememberStore) Get(_ context.Context, selector string) (RememberToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[selector]
+	if !ok {
+		return RememberToken{}, ErrRememberTokenNotFound
+	}
+
+	return token, nil
+}
+
+// Rotate marks the token as rotated under the store's lock, if no other caller did.
+func (s *MemoryRememberStore) Rotate(_ context.Context, selector string, expectedHash []byte, rotatedAt, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[selector]
+	if !ok || subtle.ConstantTimeCompare(token.ValidatorHash, expectedHash) != 1 {
+		return false, ErrRememberTokenNotFound
+	}
+	if !token.RotatedAt.IsZero() {
+		return false, nil
+	}
+
+	token.RotatedAt = rotatedAt
+	token.ExpiresAt = expiresAt
+	s.tokens[selector] = token
+
+	return true, nil
+}
+
+// Delete removes the token with the selector.
+func (s *MemoryRememberStore) Delete(_ context.Context, selector string) error {
+	s.mu.Lock()
+	delete(s.tokens, selector)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// DeleteUser removes every token of the user.
+func (s *MemoryRememberStore) DeleteUser(_ context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, t := range s.tokens {
+		if t.UserID == userID {
+			delete(s.tokens, k)
+		}
+	}
+
+	return nil
+}
+
+// RememberMeOptions configures the remember-me cookie.
+// Fields:
+// - CookieName: The cookie's name. Defaults to "remember_me".
+// - Secure: Whether the cookie is only sent over HTTPS. It always is for requests received over TLS; set it when
+// TLS ends at a proxy.
+type RememberMeOptions struct {
+	CookieName string
+	Secure     bool
+}
+
+// cookieName returns the cookie name, or the default.
+func (o RememberMeOptions) cookieName() string {
+	if o.CookieName == "" {
+		return "remember_me"
+	}
+
+	return o.CookieName
+}
+
+type rememberedContextKey struct{}
+
+// RememberedLogin reports whether the request was authenticated by RememberMeMiddleware from a remember-me
+// cookie rather than a fresh login, e.g. to ask for the password again before sensitive changes.
+func RememberedLogin(ctx context.Context) bool {
+	remembered, _ := ctx.Value(rememberedContextKey{}).(bool)
+	return remembered
+}
+
+// RememberMe keeps a user logged in across browser sessions, e.g. after a login form with "remember me" checked.
+// It stores a new token in RememberStore and sets a cookie holding its selector and validator, which
+// RememberMeMiddleware exchanges for the user on later visits.
+// Parameters:
+// - w: The http.ResponseWriter to set the cookie on.
+// - r: The login request.
+// - userID: The user to remember.
+// - ttl: How long the user stays remembered, e.g. 30 days.
+// - opts: Optional RememberMeOptions. Only the first value is used if multiple are provided.
+// Returns an error if RememberStore is not set or saving the token fails.
+func (t *Tools) RememberMe(w http.ResponseWriter, r *http.Request, userID string, ttl time.Duration, opts ...RememberMeOptions) error {
+	var o RememberMeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if t.RememberStore == nil {
+		return errors.New("toolkit: RememberStore is not set")
+	}
+
+	return t.issueRememberToken(w, r, userID, time.Now().Add(ttl), o)
+}
+
+// issueRememberToken saves a new token and sets its cookie.
+func (t *Tools) issueRememberToken(w http.ResponseWriter, r *http.Request, userID string, expiresAt time.Time, o RememberMeOptions) error {
+	selector := make([]byte, 12)
+	validator := make([]byte, 32)
+	_, _ = rand.Read(selector)
+	_, _ = rand.Read(validator)
+
+	hash := sha256.Sum256(validator)
+	token := RememberToken{
+		Selector:      base64.RawURLEncoding.EncodeToString(selector),
+		ValidatorHash: hash[:],
+		UserID:        userID,
+		ExpiresAt:     expiresAt,
+	}
+	if err := t.RememberStore.Save(r.Context(), token); err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    token.Selector + ":" + base64.RawURLEncoding.EncodeToString(validator),
+		Path:     "/",
+		Expires:  expiresAt,
+		MaxAge:   int(time.Until(expiresAt).Seconds()),
+		HttpOnly: true,
+		Secure:   o.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// ForgetMe revokes the request's remember-me token and clears its cookie, e.g. on logout. To log a user out on
+// every device, call RememberStore.DeleteUser.
+// Parameters:
+// - w: The http.ResponseWriter to clear the cookie on.
+// - r: The request carrying the cookie.
+// - opts: Optional RememberMeOptions. Only the first value is used if multiple are provided.
+// Returns an error if revoking the token fails.
+func (t *Tools) ForgetMe(w http.ResponseWriter, r *http.Request, opts ...RememberMeOptions) error {
+	var o RememberMeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	clearRememberCookie(w, r, o)
+
+	selector, _, ok := rememberCookie(r, o)
+	if !ok || t.RememberStore == nil {
+		return nil
+	}
+
+	return t.RememberStore.Delete(r.Context(), selector)
+}
+
+// RememberMeMiddleware logs in users with a remember-me cookie set by RememberMe. For requests without a subject,
+// a valid cookie is exchanged for a new one, rotating the token, and the user's Subject is stored in the request
+// context as WithSubject does. A cookie whose selector is known but whose validator does not match suggests the
+// cookie was stolen and already used, so every token of that user is revoked. Invalid cookies are cleared and the
+// request continues anonymously.
+// Parameters:
+// - load: Returns the Subject of a user, e.g. from the database. If it fails, the request continues anonymously.
+// - opts: Optional RememberMeOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) RememberMeMiddleware(load func(ctx context.Context, userID string) (Subject, error), opts ...RememberMeOptions) func(http.Handler) http.Handler {
+	var o RememberMeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := SubjectFromContext(r.Context()); ok || t.RememberStore == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			selector, validator, ok := rememberCookie(r, o)
+			if !ok {
+				if _, err := r.Cookie(o.cookieName()); err == nil {
+					clearRememberCookie(w, r, o)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			userID, err := t.checkRememberToken(w, r, selector, validator, o)
+			if err != nil {
+				clearRememberCookie(w, r, o)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			subject, err := load(r.Context(), userID)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(WithSubject(r.Context(), subject), rememberedContextKey{}, true)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// checkRememberToken validates a cookie's token and rotates it, returning the user it logs in.
+func (t *Tools) checkRememberToken(w http.ResponseWriter, r *http.Request, selector string, validator []byte, o RememberMeOptions) (string, error) {
+	ctx := r.Context()
+	now := time.Now()
+
+	token, err := t.RememberStore.Get(ctx, selector)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(validator)
+	if subtle.ConstantTimeCompare(hash[:], token.ValidatorHash) != 1 {
+		_ = t.RememberStore.DeleteUser(ctx, token.UserID)
+		return "", ErrRememberTokenNotFound
+	}
+
+	if now.After(token.ExpiresAt) {
+		_ = t.RememberStore.Delete(ctx, selector)
+		return "", ErrRememberTokenNotFound
+	}
+
+	if !token.RotatedAt.IsZero() {
+		// a concurrent request already rotated the token: accept it briefly, without issuing another
+		if now.Sub(token.RotatedAt) > rememberGracePeriod {
+			return "", ErrRememberTokenNotFound
+		}
+		return token.UserID, nil
+	}
+
+	expiresAt := token.ExpiresAt
+
+	rotated, err := t.RememberStore.Rotate(ctx, selector, token.ValidatorHash, now, minTime(expiresAt, now.Add(rememberGracePeriod)))
+	if err != nil {
+		return "", err
+	}
+	if !rotated {
+		// a concurrent request rotated the token since it was read: accept it as within the grace period
+		return token.UserID, nil
+	}
+
+	// the new token keeps the original expiry, so rotation does not extend the login forever
+	if err := t.issueRememberToken(w, r, token.UserID, expiresAt, o); err != nil {
+		return "", err
+	}
+
+	return token.UserID, nil
+}
+
+// minTime returns the earlier of a and b.
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+
+	return b
+}
+
+// rememberCookie parses the remember-me cookie of r.
+func rememberCookie(r *http.Request, o RememberMeOptions) (string, []byte, bool) {
+	c, err := r.Cookie(o.cookieName())
+	if err != nil {
+		return "", nil, false
+	}
+
+	selector, encoded, ok := strings.Cut(c.Value, ":")
+	if !ok || selector == "" {
+		return "", nil, false
+	}
+
+	validator, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(validator) != 32 {
+		return "", nil, false
+	}
+
+	return selector, validator, true
+}
+
+// clearRememberCookie removes the remember-me cookie from the browser.
+func clearRememberCookie(w http.ResponseWriter, r *http.Request, o RememberMeOptions) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.cookieName(),
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   o.Secure || r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// rememberRequest sends a request with cookie through the middleware, returning the subject seen by the handler
+// and the response.
+func rememberRequest(t *testing.T, testTools *Tools, cookie *http.Cookie) (string, *httptest.ResponseRecorder) {
+	load := func(ctx context.Context, userID string) (Subject, error) {
+		return Subject{ID: userID}, nil
+	}
+
+	var seen string
+	handler := testTools.RememberMeMiddleware(load)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s, ok := SubjectFromContext(r.Context()); ok && RememberedLogin(r.Context()) {
+			seen = s.ID
+		}
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	return seen, rr
+}
+
+// responseCookie returns the named cookie set by a response.
+func responseCookie(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func TestTools_RememberMe(t *testing.T) {
+	store := &MemoryRememberStore{}
+	testTools := Tools{RememberStore: store}
+
+	rr := httptest.NewRecorder()
+	if err := testTools.RememberMe(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "ann", 30*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	first := responseCookie(rr, "remember_me")
+	if first == nil || !first.HttpOnly {
+		t.Fatalf("expected an HttpOnly remember_me cookie, got %v", first)
+	}
+
+	user, rr := rememberRequest(t, &testTools, first)
+	if user != "ann" {
+		t.Fatalf("expected ann to be logged in, got %q", user)
+	}
+	second := responseCookie(rr, "remember_me")
+	if second == nil || second.Value == first.Value {
+		t.Fatal("expected the token to be rotated")
+	}
+
+	// the previous cookie still works during the grace period, without another rotation
+	if user, rr := rememberRequest(t, &testTools, first); user != "ann" || responseCookie(rr, "remember_me") != nil {
+		t.Errorf("expected the rotated cookie to be accepted briefly, got %q", user)
+	}
+
+	if user, _ := rememberRequest(t, &testTools, second); user != "ann" {
+		t.Errorf("expected the new cookie to log ann in, got %q", user)
+	}
+
+	if user, _ := rememberRequest(t, &testTools, nil); user != "" {
+		t.Errorf("expected an anonymous request, got %q", user)
+	}
+}
+
+// racingRememberStore rotates every token as it is read, as a concurrent request with the same cookie would.
+type racingRememberStore struct {
+	*MemoryRememberStore
+}
+
+func (s racingRememberStore) Get(ctx context.Context, selector string) (RememberToken, error) {
+	token, err := s.MemoryRememberStore.Get(ctx, selector)
+	if err == nil {
+		_, _ = s.Rotate(ctx, selector, token.ValidatorHash, time.Now(), token.ExpiresAt)
+	}
+
+	return token, err
+}
+
+func TestTools_RememberMeConcurrentRotation(t *testing.T) {
+	testTools := Tools{RememberStore: racingRememberStore{&MemoryRememberStore{}}}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.RememberMe(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "ann", time.Hour)
+	cookie := responseCookie(rr, "remember_me")
+
+	user, rr := rememberRequest(t, &testTools, cookie)
+	if user != "ann" {
+		t.Errorf("expected the request losing the rotation to be logged in, got %q", user)
+	}
+	if c := responseCookie(rr, "remember_me"); c != nil {
+		t.Errorf("expected no second token issued by the losing request, got %v", c)
+	}
+}
+
+func TestTools_RememberMeTheft(t *testing.T) {
+	store := &MemoryRememberStore{}
+	testTools := Tools{RememberStore: store}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.RememberMe(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "ann", time.Hour)
+	cookie := responseCookie(rr, "remember_me")
+
+	rr = httptest.NewRecorder()
+	_ = testTools.RememberMe(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "ann", time.Hour)
+	otherDevice := responseCookie(rr, "remember_me")
+
+	selector := cookie.Value[:16]
+	forged := &http.Cookie{Name: "remember_me", Value: selector + ":AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"}
+
+	user, rr := rememberRequest(t, &testTools, forged)
+	if user != "" {
+		t.Errorf("expected a forged validator to be rejected, got %q", user)
+	}
+	if c := responseCookie(rr, "remember_me"); c == nil || c.MaxAge >= 0 {
+		t.Error("expected the cookie to be cleared")
+	}
+	if user, _ := rememberRequest(t, &testTools, otherDevice); user != "" {
+		t.Error("expected every token of the user to be revoked")
+	}
+}
+
+func TestTools_ForgetMe(t *testing.T) {
+	store := &MemoryRememberStore{}
+	testTools := Tools{RememberStore: store}
+
+	rr := httptest.NewRecorder()
+	_ = testTools.RememberMe(rr, httptest.NewRequest(http.MethodPost, "/login", nil), "ann", time.Hour)
+	cookie := responseCookie(rr, "remember_me")
+
+	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	req.AddCookie(cookie)
+	if err := testTools.ForgetMe(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	if user, _ := rememberRequest(t, &testTools, cookie); user != "" {
+		t.Errorf("expected the token to be revoked, got %q", user)
+	}
+}
@@ -0,0 +1,578 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RemoteFS is a session with a remote file server, used by RemoteStore. Paths are slash-separated. The toolkit
+// includes an FTP implementation, DialFTP, and an SFTP one, NewSFTPSession, which runs on an SSH channel opened by
+// the caller's SSH client.
+type RemoteFS interface {
+	// Open opens a file for reading.
+	Open(name string) (io.ReadCloser, error)
+	// Create creates or truncates a file for writing. The upload is complete once the writer is closed.
+	Create(name string) (io.WriteCloser, error)
+	// Rename moves a file.
+	Rename(oldName, newName string) error
+	// Remove deletes a file.
+	Remove(name string) error
+	// MkdirAll creates a directory and any missing parents.
+	MkdirAll(dir string) error
+	// ReadDir lists a directory.
+	ReadDir(dir string) ([]fs.FileInfo, error)
+	// Stat describes a file. It returns an error matching fs.ErrNotExist for missing files.
+	Stat(name string) (fs.FileInfo, error)
+	// Close ends the session.
+	Close() error
+}
+
+// RemoteStore is a FileStore on a remote file server such as an SFTP or FTP server, for uploads that must land on
+// legacy file servers. Sessions are pooled, and operations failing with a connection error are retried on a new
+// session. Deleted files go to a .trash directory under the root, like with LocalFileStore, and names are scoped
+// to Root/<tenant> when the context carries a tenant.
+// Fields:
+// - Dial: Opens a new session.
+// - Root: The remote directory holding the files.
+// - Retention: How long deleted files are kept in the trash. Defaults to 30 days.
+// - MaxIdle: The number of idle sessions kept for reuse. Defaults to 2.
+// - Retries: The number of times an operation is retried after a connection error. Defaults to 2.
+// - Authorizer: If set, consulted for each operation with the subject in the context, like Tools.Authorizer.
+type RemoteStore struct {
+	Dial       func(ctx context.Context) (RemoteFS, error)
+	Root       string
+	Retention  time.Duration
+	MaxIdle    int
+	Retries    int
+	Authorizer Authorizer
+
+	mu   sync.Mutex
+	idle []RemoteFS
+}
+
+// get returns an idle session or dials a new one.
+func (s *RemoteStore) get(ctx context.Context) (RemoteFS, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		conn := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return conn, nil
+	}
+	s.mu.Unlock()
+
+	return s.Dial(ctx)
+}
+
+// put returns a healthy session to the pool, closing it if the pool is full.
+func (s *RemoteStore) put(conn RemoteFS) {
+	maxIdle := s.MaxIdle
+	if maxIdle <= 0 {
+		maxIdle = 2
+	}
+
+	s.mu.Lock()
+	if len(s.idle) < maxIdle {
+		s.idle = append(s.idle, conn)
+		conn = nil
+	}
+	s.mu.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+}
+
+// Close closes the idle sessions.
+func (s *RemoteStore) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle = nil
+	s.mu.Unlock()
+
+	var errs []error
+	for _, conn := range idle {
+		errs = append(errs, conn.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// isConnectionError reports whether err means the session is broken, so the operation can be retried on a new one.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	var temporary interface{ Temporary() bool }
+
+	switch {
+	case errors.As(err, &temporary) && temporary.Temporary():
+		return true
+	case errors.As(err, &netErr), errors.Is(err, net.ErrClosed), errors.Is(err, io.ErrClosedPipe), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+
+	return false
+}
+
+// retries returns s.Retries or the default.
+func (s *RemoteStore) retries() int {
+	if s.Retries > 0 {
+		return s.Retries
+	}
+
+	return 2
+}
+
+// withConn runs fn with a pooled session, retrying on a new session after connection errors.
+func (s *RemoteStore) withConn(ctx context.Context, fn func(RemoteFS) error) error {
+	var err error
+	for attempt := 0; attempt <= s.retries(); attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		var conn RemoteFS
+		conn, err = s.get(ctx)
+		if err != nil {
+			if isConnectionError(err) {
+				continue
+			}
+			return err
+		}
+
+		err = fn(conn)
+		if err == nil || !isConnectionError(err) {
+			s.put(conn)
+			return err
+		}
+
+		_ = conn.Close()
+	}
+
+	return err
+}
+
+// base returns the directory for the tenant in ctx, or Root.
+func (s *RemoteStore) base(ctx context.Context) (string, error) {
+	root := path.Clean(s.Root)
+
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return root, nil
+	}
+	if !tenantIDRegex.MatchString(tenant) {
+		return "", ErrNoTenant
+	}
+
+	return path.Join(root, tenant), nil
+}
+
+// resolve maps a file name to its base directory, its cleaned name and its remote path, rejecting names outside
+// the store or inside the trash.
+func (s *RemoteStore) resolve(ctx context.Context, name string) (string, string, string, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	rel := strings.TrimPrefix(path.Clean(name), "/")
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") || rel == trashDirName || strings.HasPrefix(rel, trashDirName+"/") {
+		return "", "", "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	return base, rel, path.Join(base, rel), nil
+}
+
+// authorize consults s.Authorizer, if set, for the subject in ctx.
+func (s *RemoteStore) authorize(ctx context.Context, action FileAction, object string) error {
+	t := Tools{Authorizer: s.Authorizer}
+	return t.authorize(ctx, action, object)
+}
+
+// retention returns s.Retention or the default.
+func (s *RemoteStore) retention() time.Duration {
+	if s.Retention > 0 {
+		return s.Retention
+	}
+
+	return 30 * 24 * time.Hour
+}
+
+// remoteReader returns its session to the pool when it is closed.
+type remoteReader struct {
+	io.ReadCloser
+	store *RemoteStore
+	conn  RemoteFS
+}
+
+// Close closes the file and releases the session.
+func (r *remoteReader) Close() error {
+	err := r.ReadCloser.Close()
+	if err != nil && isConnectionError(err) {
+		_ = r.conn.Close()
+		return err
+	}
+
+	r.store.put(r.conn)
+
+	return err
+}
+
+// Open returns the contents of the named file, after checking the FileDownload permission. The session stays in
+// use until the returned reader is closed.
+func (s *RemoteStore) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	_, _, p, err := s.resolve(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.authorize(ctx, FileDownload, p); err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; attempt <= s.retries(); attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+
+		var conn RemoteFS
+		conn, err = s.get(ctx)
+		if err != nil {
+			if isConnectionError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var f io.ReadCloser
+		f, err = conn.Open(p)
+		if err == nil {
+			return &remoteReader{ReadCloser: f, store: s, conn: conn}, nil
+		}
+		if !isConnectionError(err) {
+			s.put(conn)
+			return nil, err
+		}
+
+		_ = conn.Close()
+	}
+
+	return nil, err
+}
+
+// Save uploads the named file, after checking the FileUpload permission. The data is written to a temporary name
+// and renamed, so readers never see partial files. Failed uploads are retried only if r is an io.Seeker.
+func (s *RemoteStore) Save(ctx context.Context, name string, r io.Reader) error {
+	_, _, p, err := s.resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, FileUpload, p); err != nil {
+		return err
+	}
+
+	seeker, canRetry := r.(io.Seeker)
+	attempts := 0
+
+	return s.withConn(ctx, func(conn RemoteFS) error {
+		attempts++
+		if attempts > 1 {
+			if !canRetry {
+				return fmt.Errorf("upload of %q failed and cannot be retried", name)
+			}
+			if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+		if err := conn.MkdirAll(path.Dir(p)); err != nil {
+			return err
+		}
+
+		tmp := path.Join(path.Dir(p), ".upload-"+randomHex(8))
+
+		w, err := conn.Create(tmp)
+		if err != nil {
+			return err
+		}
+		if _, err := copyBuffered(w, r); err != nil {
+			_ = w.Close()
+			_ = conn.Remove(tmp)
+			return err
+		}
+		if err := w.Close(); err != nil {
+			_ = conn.Remove(tmp)
+			return err
+		}
+
+		// some servers refuse to rename over an existing file
+		if _, err := conn.Stat(p); err == nil {
+			if err := conn.Remove(p); err != nil {
+				return err
+			}
+		}
+
+		return conn.Rename(tmp, p)
+	})
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Delete moves the named file to the trash, after checking the FileDelete permission.
+func (s *RemoteStore) Delete(ctx context.Context, name string) error {
+	base, rel, p, err := s.resolve(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(ctx, FileDelete, p); err != nil {
+		return err
+	}
+
+	trash := path.Join(base, trashDirName)
+
+	return s.withConn(ctx, func(conn RemoteFS) error {
+		info, err := conn.Stat(p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return errors.New("cannot delete a directory")
+		}
+
+		if err := conn.MkdirAll(trash); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		entry := TrashedFile{
+			ID:        randomHex(16),
+			Name:      rel,
+			Size:      info.Size(),
+			DeletedAt: now,
+			ExpiresAt: now.Add(s.retention()),
+		}
+
+		if err := writeRemoteJSON(conn, path.Join(trash, entry.ID+".json"), entry); err != nil {
+			return err
+		}
+
+		if err := conn.Rename(p, path.Join(trash, entry.ID)); err != nil {
+			_ = conn.Remove(path.Join(trash, entry.ID+".json"))
+			return err
+		}
+
+		return nil
+	})
+}
+
+// writeRemoteJSON writes v as JSON to a remote file.
+func writeRemoteJSON(conn RemoteFS, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	w, err := conn.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return err
+	}
+
+	return w.Close()
+}
+
+// readTrashEntry reads the metadata of a trashed file.
+func readTrashEntry(conn RemoteFS, trash, id string) (*TrashedFile, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrTrashNotFound
+	}
+
+	f, err := conn.Open(path.Join(trash, id+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrTrashNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, 64<<10))
+	closeErr := f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if closeErr != nil {
+		return nil, closeErr
+	}
+
+	var entry TrashedFile
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Restore moves a trashed file back to its original name, after checking the FileUpload permission for it.
+func (s *RemoteStore) Restore(ctx context.Context, id string) (string, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return "", err
+	}
+	trash := path.Join(base, trashDirName)
+
+	var name string
+	err = s.withConn(ctx, func(conn RemoteFS) error {
+		entry, err := readTrashEntry(conn, trash, id)
+		if err != nil {
+			return err
+		}
+
+		_, _, p, err := s.resolve(ctx, entry.Name)
+		if err != nil {
+			return err
+		}
+		if err := s.authorize(ctx, FileUpload, p); err != nil {
+			return err
+		}
+
+		if _, err := conn.Stat(p); err == nil {
+			return ErrFileExists
+		}
+
+		if err := conn.MkdirAll(path.Dir(p)); err != nil {
+			return err
+		}
+		if err := conn.Rename(path.Join(trash, id), p); err != nil {
+			return err
+		}
+
+		_ = conn.Remove(path.Join(trash, id+".json"))
+		name = entry.Name
+
+		return nil
+	})
+
+	return name, err
+}
+
+// Trash lists the trashed files, most recently deleted first, after checking the FileList permission on the
+// trash directory.
+func (s *RemoteStore) Trash(ctx context.Context) ([]TrashedFile, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	trash := path.Join(base, trashDirName)
+	if err := s.authorize(ctx, FileList, trash); err != nil {
+		return nil, err
+	}
+
+	var files []TrashedFile
+	err = s.withConn(ctx, func(conn RemoteFS) error {
+		files = []TrashedFile{}
+
+		entries, err := conn.ReadDir(trash)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			id, ok := strings.CutSuffix(e.Name(), ".json")
+			if !ok {
+				continue
+			}
+
+			entry, err := readTrashEntry(conn, trash, id)
+			if err != nil {
+				if isConnectionError(err) {
+					return err
+				}
+				continue
+			}
+			files = append(files, *entry)
+		}
+
+		return nil
+	})
+
+	sort.Slice(files, func(i, j int) bool { return files[i].DeletedAt.After(files[j].DeletedAt) })
+
+	return files, err
+}
+
+// PurgeTrash permanently removes trashed files, after checking the FileDelete permission on the trash directory.
+// With no IDs it removes every file past its retention.
+func (s *RemoteStore) PurgeTrash(ctx context.Context, ids ...string) (int, error) {
+	base, err := s.base(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	trash := path.Join(base, trashDirName)
+	if err := s.authorize(ctx, FileDelete, trash); err != nil {
+		return 0, err
+	}
+
+	expiredOnly := len(ids) == 0
+	if expiredOnly {
+		files, err := s.Trash(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now()
+		for _, f := range files {
+			if now.After(f.ExpiresAt) {
+				ids = append(ids, f.ID)
+			}
+		}
+	}
+
+	purged, next := 0, 0
+	err = s.withConn(ctx, func(conn RemoteFS) error {
+		// after a retry, continue where the broken session stopped
+		for ; next < len(ids); next++ {
+			id := ids[next]
+
+			if _, err := readTrashEntry(conn, trash, id); err != nil {
+				if expiredOnly && !isConnectionError(err) {
+					continue
+				}
+				return err
+			}
+
+			if err := conn.Remove(path.Join(trash, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			_ = conn.Remove(path.Join(trash, id+".json"))
+			purged++
+		}
+
+		return nil
+	})
+
+	return purged, err
+}
@@ -0,0 +1,306 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memRemoteServer is an in-memory file server shared by the memRemoteFS sessions dialed to it.
+type memRemoteServer struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+	dials int
+	// failNext makes the next operation of a session fail as if the connection dropped
+	failNext bool
+}
+
+func newMemRemoteServer() *memRemoteServer {
+	return &memRemoteServer{files: map[string][]byte{}, dirs: map[string]bool{"/": true}}
+}
+
+func (s *memRemoteServer) dial(ctx context.Context) (RemoteFS, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dials++
+	return &memRemoteFS{server: s}, nil
+}
+
+type memRemoteFS struct {
+	server *memRemoteServer
+	broken bool
+}
+
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) Mode() fs.FileMode  { return 0644 }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+// check simulates a dropped connection when the server is told to fail.
+func (c *memRemoteFS) check() error {
+	if c.server.failNext {
+		c.server.failNext = false
+		c.broken = true
+	}
+	if c.broken {
+		return net.ErrClosed
+	}
+	return nil
+}
+
+func (c *memRemoteFS) Open(name string) (io.ReadCloser, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	data, ok := c.server.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+type memRemoteWriter struct {
+	bytes.Buffer
+	c    *memRemoteFS
+	name string
+}
+
+func (w *memRemoteWriter) Close() error {
+	w.c.server.mu.Lock()
+	defer w.c.server.mu.Unlock()
+	w.c.server.files[w.name] = w.Bytes()
+	return nil
+}
+
+func (c *memRemoteFS) Create(name string) (io.WriteCloser, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if !c.server.dirs[path.Dir(name)] {
+		return nil, fs.ErrNotExist
+	}
+	return &memRemoteWriter{c: c, name: name}, nil
+}
+
+func (c *memRemoteFS) Rename(oldName, newName string) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	data, ok := c.server.files[oldName]
+	if !ok {
+		return fs.ErrNotExist
+	}
+	delete(c.server.files, oldName)
+	c.server.files[newName] = data
+	return nil
+}
+
+func (c *memRemoteFS) Remove(name string) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	if _, ok := c.server.files[name]; !ok {
+		return fs.ErrNotExist
+	}
+	delete(c.server.files, name)
+	return nil
+}
+
+func (c *memRemoteFS) MkdirAll(dir string) error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return err
+	}
+	for d := path.Clean(dir); d != "/" && d != "."; d = path.Dir(d) {
+		c.server.dirs[d] = true
+	}
+	return nil
+}
+
+func (c *memRemoteFS) ReadDir(dir string) ([]fs.FileInfo, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if !c.server.dirs[dir] {
+		return nil, fs.ErrNotExist
+	}
+	var infos []fs.FileInfo
+	for name, data := range c.server.files {
+		if path.Dir(name) == dir {
+			infos = append(infos, memFileInfo{name: path.Base(name), size: int64(len(data))})
+		}
+	}
+	return infos, nil
+}
+
+func (c *memRemoteFS) Stat(name string) (fs.FileInfo, error) {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	if c.server.dirs[name] {
+		return memFileInfo{name: path.Base(name), dir: true}, nil
+	}
+	data, ok := c.server.files[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return memFileInfo{name: path.Base(name), size: int64(len(data))}, nil
+}
+
+func (c *memRemoteFS) Close() error {
+	return nil
+}
+
+func TestRemoteStore_TrashAndRestore(t *testing.T) {
+	server := newMemRemoteServer()
+	store := &RemoteStore{Dial: server.dial, Root: "/srv/uploads"}
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "docs/plan.txt", strings.NewReader("the plan")); err != nil {
+		t.Fatal(err)
+	}
+	if string(server.files["/srv/uploads/docs/plan.txt"]) != "the plan" {
+		t.Fatalf("expected the file on the server, got %v", server.files)
+	}
+
+	if err := store.Save(ctx, "docs/plan.txt", strings.NewReader("the new plan")); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.files) != 1 {
+		t.Errorf("expected no temporary files to remain, got %v", server.files)
+	}
+
+	if err := store.Delete(ctx, "docs/plan.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	trash, err := store.Trash(ctx)
+	if err != nil || len(trash) != 1 {
+		t.Fatalf("expected one trashed file, got %v, %v", trash, err)
+	}
+	if trash[0].Name != "docs/plan.txt" || trash[0].Size != 12 {
+		t.Errorf("unexpected trash entry %+v", trash[0])
+	}
+
+	if _, err := store.Open(ctx, ".trash/"+trash[0].ID); err == nil {
+		t.Error("expected trash to be unreachable through Open")
+	}
+	if _, err := store.Open(ctx, "../etc/passwd"); err == nil {
+		t.Error("expected names outside the root to be rejected")
+	}
+
+	name, err := store.Restore(ctx, trash[0].ID)
+	if err != nil || name != "docs/plan.txt" {
+		t.Fatalf("expected restore of docs/plan.txt, got %q, %v", name, err)
+	}
+
+	f, err := store.Open(ctx, "docs/plan.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(f)
+	_ = f.Close()
+	if string(b) != "the new plan" {
+		t.Errorf("expected restored content, got %q", b)
+	}
+
+	if _, err := store.Restore(ctx, trash[0].ID); !errors.Is(err, ErrTrashNotFound) {
+		t.Errorf("expected ErrTrashNotFound restoring twice, got %v", err)
+	}
+
+	if err := store.Delete(ctx, "docs/plan.txt"); err != nil {
+		t.Fatal(err)
+	}
+	trash, _ = store.Trash(ctx)
+	if n, err := store.PurgeTrash(ctx, trash[0].ID); n != 1 || err != nil {
+		t.Errorf("expected one purged file, got %d, %v", n, err)
+	}
+	if len(server.files) != 0 {
+		t.Errorf("expected an empty server after purging, got %v", server.files)
+	}
+}
+
+func TestRemoteStore_PoolingAndRetry(t *testing.T) {
+	server := newMemRemoteServer()
+	store := &RemoteStore{Dial: server.dial, Root: "/srv"}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := store.Save(ctx, "a.txt", strings.NewReader("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.dials != 1 {
+		t.Errorf("expected one pooled session, got %d dials", server.dials)
+	}
+
+	server.failNext = true
+	if err := store.Save(ctx, "b.txt", strings.NewReader("b")); err != nil {
+		t.Fatalf("expected the upload to be retried, got %v", err)
+	}
+	if server.dials != 2 || string(server.files["/srv/b.txt"]) != "b" {
+		t.Errorf("expected a retry on a new session, got %d dials and %v", server.dials, server.files)
+	}
+
+	server.failNext = true
+	if err := store.Save(ctx, "c.txt", io.MultiReader(strings.NewReader("c"))); err == nil {
+		t.Error("expected a non-seekable upload not to be retried")
+	}
+
+	if err := store.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRemoteStore_Scoping(t *testing.T) {
+	server := newMemRemoteServer()
+	store := &RemoteStore{Dial: server.dial, Root: "/srv"}
+
+	ctx := WithTenant(context.Background(), "acme")
+	if err := store.Save(ctx, "a.txt", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := server.files["/srv/acme/a.txt"]; !ok {
+		t.Errorf("expected the file under the tenant directory, got %v", server.files)
+	}
+
+	other := WithTenant(context.Background(), "globex")
+	if _, err := store.Open(other, "a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected another tenant not to see the file, got %v", err)
+	}
+
+	store.Authorizer = &RoleAuthorizer{}
+	if err := store.Save(ctx, "b.txt", strings.NewReader("b")); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden without a subject, got %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package toolkit
+
+import (
+	"io"
+	"net/http"
+)
+
+// statusWriter wraps an http.ResponseWriter to record the status code and number of bytes written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+// newStatusWriter wraps w in a statusWriter.
+func newStatusWriter(w http.ResponseWriter) *statusWriter {
+	return &statusWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code before delegating to the wrapped writer.
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 && status >= 200 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records an implicit 200 status and the number of bytes written.
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	n, err := sw.ResponseWriter.Write(b)
+	sw.written += int64(n)
+
+	return n, err
+}
+
+// ReadFrom records the bytes copied from src, keeping the wrapped writer's sendfile path for files.
+func (sw *statusWriter) ReadFrom(src io.Reader) (int64, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	n, err := readFrom(sw.ResponseWriter, src)
+	sw.written += n
+
+	return n, err
+}
+
+// Status returns the status code written so far, or 200 if the handler wrote nothing.
+func (sw *statusWriter) Status() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+
+	return sw.status
+}
+
+// Flush implements http.Flusher when the wrapped writer supports it.
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -0,0 +1,338 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat is the timestamp in the names of rotated files. It sorts in time order.
+const rotateTimeFormat = "20060102T150405.000"
+
+// RotatingWriterOptions configures a RotatingWriter.
+// Fields:
+// - MaxSize: The size in bytes a file may reach before it is rotated. Defaults to 100 MB; negative disables
+// rotation by size.
+// - Interval: If set, the file is also rotated when a write falls in a later interval than the file's last write,
+// with intervals aligned to UTC, e.g. 24 * time.Hour rotates at the first write after midnight UTC. Rotation by
+// time survives restarts, as the last write is taken from the file's modification time.
+// - MaxBackups: The number of rotated files kept; older ones are deleted. Zero keeps them all.
+// - Compress: Compress rotated files with gzip, in the background.
+// - Perm: The permissions of new files. Defaults to 0640.
+type RotatingWriterOptions struct {
+	MaxSize    int64
+	Interval   time.Duration
+	MaxBackups int
+	Compress   bool
+	Perm       os.FileMode
+}
+
+// RotatingWriter is an io.Writer appending to a file that it rotates by size or time, so applications can keep
+// their own logs without an external logrotate, e.g. as the sink of a slog handler, RecordTraffic or an
+// AnalyticsFileSink:
+//
+//	rw, err := toolkit.NewRotatingWriter("/var/log/app/access.log", toolkit.RotatingWriterOptions{MaxBackups: 7, Compress: true})
+//	logger := slog.New(slog.NewJSONHandler(rw, nil))
+//
+// A rotated file is renamed with the time of the rotation, e.g. access-20261016T120000.000.log, then compressed to
+// access-20261016T120000.000.log.gz if Compress is set. Writes are serialized and never split across files. It is
+// safe for concurrent use; Close it when done.
+type RotatingWriter struct {
+	name string
+	o    RotatingWriterOptions
+	now  func() time.Time
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	written time.Time
+	closed  bool
+
+	cleanupMu sync.Mutex
+	cleanups  sync.WaitGroup
+}
+
+// NewRotatingWriter opens a file for appending, creating it and its directory if needed.
+// Parameters:
+// - name: The path of the file.
+// - opts: Optional RotatingWriterOptions. Only the first value is used if multiple are provided.
+// Returns the writer, or an error if the file cannot be opened.
+func NewRotatingWriter(name string, opts ...RotatingWriterOptions) (*RotatingWriter, error) {
+	var o RotatingWriterOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxSize == 0 {
+		o.MaxSize = 100 << 20
+	}
+	if o.Perm == 0 {
+		o.Perm = 0o640
+	}
+
+	w := &RotatingWriter{name: name, o: o, now: time.Now}
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return nil, err
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// open opens the file, taking its size and last write time.
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.o.Perm)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	w.f, w.size, w.written = f, info.Size(), info.ModTime()
+	if w.size == 0 {
+		w.written = w.now()
+	}
+
+	return nil
+}
+
+// Write appends p to the file, rotating it first if p would take it over MaxSize or if the Interval has changed.
+// A p larger than MaxSize is written whole to a fresh file.
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.f == nil {
+		// reopening failed after the last rotation
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	now := w.now()
+	if w.size > 0 && (w.o.MaxSize > 0 && w.size+int64(len(p)) > w.o.MaxSize ||
+		w.o.Interval > 0 && !now.Truncate(w.o.Interval).Equal(w.written.Truncate(w.o.Interval))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	w.written = now
+
+	return n, err
+}
+
+// Rotate rotates the file now, e.g. from a SIGHUP handler. An empty file is not rotated.
+// Returns an error if the file cannot be renamed or reopened.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.f == nil || w.size == 0 {
+		return nil
+	}
+
+	return w.rotate()
+}
+
+// rotate renames the current file and opens a new one, then compresses and prunes the rotated files in the
+// background. The caller holds w.mu.
+func (w *RotatingWriter) rotate() error {
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	w.f = nil
+
+	backup := w.backupName(w.now())
+	if err := os.Rename(w.name, backup); err != nil {
+		// keep writing to the same file rather than losing logs
+		if openErr := w.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	if w.o.Compress || w.o.MaxBackups > 0 {
+		w.cleanups.Add(1)
+		go func() {
+			defer w.cleanups.Done()
+			w.cleanup(backup)
+		}()
+	}
+
+	return nil
+}
+
+// backupName returns an unused name for the file rotated at t.
+func (w *RotatingWriter) backupName(t time.Time) string {
+	ext := filepath.Ext(w.name)
+	base := strings.TrimSuffix(w.name, ext) + "-" + t.UTC().Format(rotateTimeFormat)
+
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(name); errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Lstat(name + ".gz"); errors.Is(err, os.ErrNotExist) {
+				return name
+			}
+		}
+		name = fmt.Sprintf("%s.%d%s", base, i, ext)
+	}
+}
+
+// cleanup compresses a rotated file if Compress is set, and deletes the oldest rotated files beyond MaxBackups.
+// Failures are logged with slog.Default(), since no write is waiting for them.
+func (w *RotatingWriter) cleanup(backup string) {
+	w.cleanupMu.Lock()
+	defer w.cleanupMu.Unlock()
+
+	if w.o.Compress {
+		if err := gzipFile(backup, w.o.Perm); err != nil {
+			slog.Default().Error("log compression failed", slog.String("file", backup), slog.String("error", err.Error()))
+		}
+	}
+
+	if w.o.MaxBackups <= 0 {
+		return
+	}
+
+	backups, err := w.Backups()
+	if err != nil {
+		slog.Default().Error("log retention failed", slog.String("file", w.name), slog.String("error", err.Error()))
+		return
+	}
+	for _, name := range backups[:max(len(backups)-w.o.MaxBackups, 0)] {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Default().Error("log retention failed", slog.String("file", name), slog.String("error", err.Error()))
+		}
+	}
+}
+
+// Backups lists the rotated files, compressed or not, oldest first.
+// Returns the paths, or an error if the directory cannot be read.
+func (w *RotatingWriter) Backups() ([]string, error) {
+	dir := filepath.Dir(w.name)
+	ext := filepath.Ext(w.name)
+	prefix := strings.TrimSuffix(filepath.Base(w.name), ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		if !strings.HasSuffix(name, ext) && !strings.HasSuffix(name, ext+".gz") {
+			continue
+		}
+		stamp := name[len(prefix):]
+		if len(stamp) < len(rotateTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(rotateTimeFormat, stamp[:len(rotateTimeFormat)]); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backupKey(backups[i], ext) < backupKey(backups[j], ext) })
+
+	return backups, nil
+}
+
+// backupKey orders rotated files by time, whether compressed or not, with files rotated in the same millisecond in
+// the order of their counter.
+func backupKey(name, ext string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ext)
+}
+
+// gzipFile compresses name to name.gz and removes name.
+func gzipFile(name string, perm os.FileMode) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := name + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = copyBuffered(zw, src)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	_ = src.Close()
+	return os.Remove(name)
+}
+
+// Close closes the file, after waiting for the compression and pruning of rotated files.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	f := w.f
+	w.f, w.closed = nil, true
+	w.mu.Unlock()
+
+	w.cleanups.Wait()
+	if f == nil {
+		return nil
+	}
+
+	return f.Close()
+}
+
+// Sync commits the file to stable storage.
+func (w *RotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.f == nil {
+		return nil
+	}
+
+	return w.f.Sync()
+}
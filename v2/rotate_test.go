@@ -0,0 +1,166 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriter_Size(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logs", "app.log")
+
+	w, err := NewRotatingWriter(name, RotatingWriterOptions{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	w.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "this line is too long\n"} {
+		if _, err := io.WriteString(w, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(name)
+	if string(data) != "this line is too long\n" {
+		t.Errorf("expected the oversized write in a file of its own, got %q", data)
+	}
+
+	backups, _ := w.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups kept, got %v", backups)
+	}
+
+	var got []string
+	for _, b := range backups {
+		data, _ := os.ReadFile(b)
+		got = append(got, string(data))
+	}
+	if strings.Join(got, "|") != "cccc\ndddd\n|eeee\nffff\n" {
+		t.Errorf("expected the newest backups in order, got %q", got)
+	}
+
+	if _, err := w.Write([]byte("x")); err == nil {
+		t.Error("expected writes after Close to fail")
+	}
+}
+
+func TestRotatingWriter_IntervalAndCompress(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "audit.log")
+	_ = os.WriteFile(name, []byte("from yesterday\n"), 0o640)
+	yesterday := time.Date(2026, 10, 15, 23, 0, 0, 0, time.UTC)
+	_ = os.Chtimes(name, yesterday, yesterday)
+
+	w, err := NewRotatingWriter(name, RotatingWriterOptions{Interval: 24 * time.Hour, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := time.Date(2026, 10, 16, 0, 30, 0, 0, time.UTC)
+	w.now = func() time.Time { return clock }
+
+	_, _ = io.WriteString(w, "today 1\n")
+	_, _ = io.WriteString(w, "today 2\n")
+	_ = w.Close()
+
+	backups, _ := w.Backups()
+	if len(backups) != 1 || !strings.HasSuffix(backups[0], "audit-20261016T003000.000.log.gz") {
+		t.Fatalf("expected one compressed backup, got %v", backups)
+	}
+
+	f, _ := os.Open(backups[0])
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := io.ReadAll(zr)
+	if string(old) != "from yesterday\n" {
+		t.Errorf("expected yesterday's lines in the backup, got %q", old)
+	}
+
+	current, _ := os.ReadFile(name)
+	if string(current) != "today 1\ntoday 2\n" {
+		t.Errorf("expected today's lines in the file, got %q", current)
+	}
+
+	if _, err := os.Stat(strings.TrimSuffix(backups[0], ".gz")); !os.IsNotExist(err) {
+		t.Error("expected the uncompressed backup to be removed")
+	}
+}
+
+func TestRotatingWriter_Rotate(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "app.log")
+
+	w, err := NewRotatingWriter(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if backups, _ := w.Backups(); len(backups) != 0 {
+		t.Errorf("expected an empty file not to be rotated, got %v", backups)
+	}
+
+	_, _ = io.WriteString(w, "one\n")
+	_ = w.Rotate()
+	_, _ = io.WriteString(w, "two\n")
+	_ = w.Rotate()
+
+	_ = os.WriteFile(filepath.Join(dir, "app-notes.log"), nil, 0o640)
+	_ = os.WriteFile(filepath.Join(dir, "other-20261016T120000.000.log"), nil, 0o640)
+
+	backups, _ := w.Backups()
+	if len(backups) != 2 {
+		t.Errorf("expected 2 backups and no unrelated files, got %v", backups)
+	}
+}
+
+func TestRotatingWriter_Concurrent(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "app.log")
+
+	w, err := NewRotatingWriter(name, RotatingWriterOptions{MaxSize: 100, Compress: true, MaxBackups: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = io.WriteString(w, "0123456789\n")
+			}
+		}()
+	}
+	wg.Wait()
+	_ = w.Close()
+
+	backups, _ := w.Backups()
+	if len(backups) != 3 {
+		t.Errorf("expected 3 backups, got %d", len(backups))
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".gz") {
+			t.Errorf("expected %s to be compressed", b)
+		}
+	}
+}
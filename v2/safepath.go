@@ -0,0 +1,88 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafePath is returned by SafeJoin for paths that escape their base or are not valid on every platform.
+var ErrUnsafePath = errors.New("unsafe path")
+
+// Limits enforced by SafeJoin. Most file systems limit names to 255 bytes, and 4096 bytes is PATH_MAX on Linux;
+// Windows accepts longer paths with the \\?\ prefix.
+const (
+	maxPathSegmentLength = 255
+	maxPathLength        = 4096
+)
+
+// windowsReservedNames are the device names Windows reserves in every directory, with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeJoin joins untrusted path parts, such as names sent by clients, to a trusted base directory, rejecting
+// anything that could escape the base or would behave differently across platforms: ".." segments, backslashes,
+// drive letters and other colons, control characters, characters Windows forbids (<>"|?*), names ending in a dot
+// or space, Windows device names such as CON and NUL (also with an extension, e.g. "nul.txt"), names longer than
+// 255 bytes and paths longer than 4096 bytes. Parts may contain slashes to name subdirectories, and a leading
+// slash is ignored.
+// Parameters:
+// - base: The trusted directory.
+// - parts: The untrusted path parts.
+// Returns the joined path, or an error matching ErrUnsafePath naming the offending segment.
+func (t *Tools) SafeJoin(base string, parts ...string) (string, error) {
+	var segments []string
+
+	for _, part := range parts {
+		for _, segment := range strings.Split(part, "/") {
+			if segment == "" || segment == "." {
+				continue
+			}
+			if err := checkPathSegment(segment); err != nil {
+				return "", err
+			}
+			segments = append(segments, segment)
+		}
+	}
+
+	full := filepath.Join(append([]string{base}, segments...)...)
+	if len(full) > maxPathLength {
+		return "", fmt.Errorf("%w: path is longer than %d bytes", ErrUnsafePath, maxPathLength)
+	}
+	if !pathWithin(full, base) {
+		return "", fmt.Errorf("%w: path escapes its base directory", ErrUnsafePath)
+	}
+
+	return full, nil
+}
+
+// checkPathSegment returns an error if segment is not a portable file name.
+func checkPathSegment(segment string) error {
+	if segment == ".." {
+		return fmt.Errorf("%w: %q traverses to the parent directory", ErrUnsafePath, segment)
+	}
+	if len(segment) > maxPathSegmentLength {
+		return fmt.Errorf("%w: %q is longer than %d bytes", ErrUnsafePath, segment[:32]+"...", maxPathSegmentLength)
+	}
+
+	for _, r := range segment {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(`\:<>"|?*`, r) {
+			return fmt.Errorf("%w: %q contains %q", ErrUnsafePath, segment, r)
+		}
+	}
+
+	if strings.HasSuffix(segment, ".") || strings.HasSuffix(segment, " ") {
+		return fmt.Errorf("%w: %q ends with a dot or space", ErrUnsafePath, segment)
+	}
+
+	name, _, _ := strings.Cut(segment, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimRight(name, " "))] {
+		return fmt.Errorf("%w: %q is a reserved device name on Windows", ErrUnsafePath, segment)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var safeJoinTests = []struct {
+	name     string
+	parts    []string
+	expected string
+}{
+	{name: "simple", parts: []string{"a.txt"}, expected: filepath.Join("base", "a.txt")},
+	{name: "subdirectories", parts: []string{"docs", "2024/report.pdf"}, expected: filepath.Join("base", "docs", "2024", "report.pdf")},
+	{name: "leading slash", parts: []string{"/a.txt"}, expected: filepath.Join("base", "a.txt")},
+	{name: "dot segments", parts: []string{"./a/./b.txt"}, expected: filepath.Join("base", "a", "b.txt")},
+	{name: "reserved prefix", parts: []string{"console.txt"}, expected: filepath.Join("base", "console.txt")},
+	{name: "traversal", parts: []string{"../etc/passwd"}},
+	{name: "nested traversal", parts: []string{"a/../../b"}},
+	{name: "backslash", parts: []string{`..\..\windows`}},
+	{name: "drive letter", parts: []string{"C:/windows"}},
+	{name: "alternate data stream", parts: []string{"a.txt:hidden"}},
+	{name: "reserved name", parts: []string{"CON"}},
+	{name: "reserved name with extension", parts: []string{"docs", "nul.txt"}},
+	{name: "reserved port", parts: []string{"com1.log"}},
+	{name: "trailing dot", parts: []string{"a."}},
+	{name: "trailing space", parts: []string{"a "}},
+	{name: "control character", parts: []string{"a\x00b"}},
+	{name: "wildcard", parts: []string{"*.txt"}},
+	{name: "overlong segment", parts: []string{strings.Repeat("a", 256)}},
+	{name: "overlong path", parts: []string{strings.Repeat(strings.Repeat("a", 200)+"/", 25)}},
+}
+
+func TestTools_SafeJoin(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range safeJoinTests {
+		got, err := testTools.SafeJoin("base", e.parts...)
+		if e.expected == "" {
+			if !errors.Is(err, ErrUnsafePath) {
+				t.Errorf("%s: expected ErrUnsafePath, got %q, %v", e.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != e.expected {
+			t.Errorf("%s: expected %s, got %q, %v", e.name, e.expected, got, err)
+		}
+	}
+}
+
+func TestTools_DownloadStaticFileUnsafe(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil), "./testdata", "../tools.go", "tools.go")
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a traversal, got %d", rr.Code)
+	}
+}
+
+func TestTools_UploadFilesUnsafeName(t *testing.T) {
+	var testTools Tools
+
+	if _, err := testTools.UploadFiles(uploadRequest("nul.txt", "text"), t.TempDir(), false); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+}
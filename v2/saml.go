@@ -0,0 +1,358 @@
+package toolkit
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SAML namespaces and identifiers.
+const (
+	nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlStatusOK    = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlPostBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+)
+
+// ErrInvalidSAMLResponse is returned when a SAML response fails validation: it is unsigned, signed by an unknown
+// key, expired, meant for another service provider or already used.
+var ErrInvalidSAMLResponse = errors.New("invalid SAML response")
+
+// SAMLAssertion is the identity asserted by a validated SAML response.
+// Fields:
+// - ID: The assertion's ID.
+// - Issuer: The identity provider's entity ID.
+// - NameID: The user's identifier at the identity provider.
+// - NameIDFormat: The format of NameID, e.g. "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress".
+// - SessionIndex: The identity provider's session, used for logout.
+// - Attributes: The user's attributes, by name.
+// - Subject: The user, with NameID as ID and the first value of each attribute in Claims.
+// - ReturnTo: The local path carried in RelayState, or "/".
+type SAMLAssertion struct {
+	ID           string
+	Issuer       string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	Attributes   map[string][]string
+	Subject      Subject
+	ReturnTo     string
+}
+
+// SAMLServiceProvider is a minimal SAML 2.0 service provider for logins through enterprise identity providers such
+// as ADFS, Okta or Shibboleth. It publishes its metadata and consumes responses posted by the identity provider
+// (the HTTP-POST binding), accepting only assertions signed by the configured certificates, meant for this service
+// provider and within their validity window. Encrypted assertions are not supported. Each assertion is accepted
+// once; the replay cache is held in memory.
+// Fields:
+// - EntityID: The service provider's entity ID, usually the metadata URL. Assertions must name it as audience.
+// - ACSURL: The absolute URL of the ACS handler.
+// - IDPEntityID: The identity provider's entity ID. When set, assertions from other issuers are rejected.
+// - IDPCertificates: The identity provider's signing certificates.
+// - ClockSkew: The clock difference tolerated when checking validity windows. Defaults to 3 minutes.
+// - OnLogin: Called after a successful login to start the user's session and respond, usually by redirecting to
+// assertion.ReturnTo.
+type SAMLServiceProvider struct {
+	EntityID        string
+	ACSURL          string
+	IDPEntityID     string
+	IDPCertificates []*x509.Certificate
+	ClockSkew       time.Duration
+	OnLogin         func(w http.ResponseWriter, r *http.Request, assertion *SAMLAssertion)
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewSAMLServiceProvider returns a service provider trusting an identity provider's certificates.
+func NewSAMLServiceProvider(entityID, acsURL string, idpCertificates []*x509.Certificate, onLogin func(w http.ResponseWriter, r *http.Request, assertion *SAMLAssertion)) *SAMLServiceProvider {
+	return &SAMLServiceProvider{EntityID: entityID, ACSURL: acsURL, IDPCertificates: idpCertificates, OnLogin: onLogin}
+}
+
+// samlMetadata is the metadata document published by Metadata.
+type samlMetadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SP       struct {
+		AuthnRequestsSigned  bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned bool   `xml:"WantAssertionsSigned,attr"`
+		Protocols            string `xml:"protocolSupportEnumeration,attr"`
+		ACS                  struct {
+			Binding   string `xml:"Binding,attr"`
+			Location  string `xml:"Location,attr"`
+			Index     int    `xml:"index,attr"`
+			IsDefault bool   `xml:"isDefault,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata returns a handler serving the service provider's metadata, which identity providers import to
+// register it.
+func (sp *SAMLServiceProvider) Metadata() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var md samlMetadata
+		md.EntityID = sp.EntityID
+		md.SP.WantAssertionsSigned = true
+		md.SP.Protocols = nsSAMLProtocol
+		md.SP.ACS.Binding = samlPostBinding
+		md.SP.ACS.Location = sp.ACSURL
+		md.SP.ACS.IsDefault = true
+
+		out, err := xml.MarshalIndent(md, "", "  ")
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/samlmetadata+xml")
+		_, _ = w.Write([]byte(xml.Header))
+		_, _ = w.Write(out)
+	}
+}
+
+// ACS returns the assertion consumer service handler the identity provider posts responses to. It validates the
+// SAMLResponse form value and calls OnLogin.
+// Returns the handler, which answers 401 Unauthorized with an error wrapping ErrInvalidSAMLResponse if the
+// response is rejected.
+func (sp *SAMLServiceProvider) ACS() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(r.PostFormValue("SAMLResponse")), ""))
+		if err != nil || len(data) == 0 {
+			_ = (&Tools{}).ErrorJSON(w, fmt.Errorf("%w: missing or malformed SAMLResponse", ErrInvalidSAMLResponse), http.StatusUnauthorized)
+			return
+		}
+
+		assertion, err := sp.ParseResponse(data)
+		if err != nil {
+			_ = (&Tools{}).ErrorJSON(w, err, http.StatusUnauthorized)
+			return
+		}
+		assertion.ReturnTo = localReturnPath(r.PostFormValue("RelayState"))
+
+		sp.OnLogin(w, r, assertion)
+	}
+}
+
+// ParseResponse validates a decoded SAML response and returns its assertion. Either the response or the
+// assertion must be signed by one of IDPCertificates. The status must be success, the assertion must be within
+// its validity window, name EntityID as audience and ACSURL as recipient, and not have been accepted before.
+// Parameters:
+// - data: The response XML.
+// Returns the assertion, or an error wrapping ErrInvalidSAMLResponse.
+func (sp *SAMLServiceProvider) ParseResponse(data []byte) (*SAMLAssertion, error) {
+	assertion, expires, err := sp.validate(data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSAMLResponse, err)
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	now := time.Now()
+	if sp.seen == nil {
+		sp.seen = make(map[string]time.Time)
+	}
+	for id, exp := range sp.seen {
+		if now.After(exp) {
+			delete(sp.seen, id)
+		}
+	}
+	if _, ok := sp.seen[assertion.ID]; ok {
+		return nil, fmt.Errorf("%w: assertion %s was already used", ErrInvalidSAMLResponse, assertion.ID)
+	}
+	sp.seen[assertion.ID] = expires.Add(sp.clockSkew())
+
+	return assertion, nil
+}
+
+// clockSkew returns the configured clock skew or the default.
+func (sp *SAMLServiceProvider) clockSkew() time.Duration {
+	if sp.ClockSkew > 0 {
+		return sp.ClockSkew
+	}
+
+	return 3 * time.Minute
+}
+
+// validate checks a response at the time now, returning its assertion and when the assertion expires. Every value
+// is read from the signed element tree, so content outside the signature cannot be substituted.
+func (sp *SAMLServiceProvider) validate(data []byte, now time.Time) (*SAMLAssertion, time.Time, error) {
+	var expires time.Time
+
+	root, err := parseXMLTree(data)
+	if err != nil {
+		return nil, expires, err
+	}
+	if root.space != nsSAMLProtocol || root.local != "Response" {
+		return nil, expires, errors.New("not a SAML response")
+	}
+
+	// duplicate IDs are how signature wrapping attacks point a valid signature at injected content
+	ids := make(map[string]bool)
+	var duplicate bool
+	root.walk(func(n *xmlNode) {
+		if id := n.attr("ID"); id != "" {
+			duplicate = duplicate || ids[id]
+			ids[id] = true
+		}
+	})
+	if duplicate {
+		return nil, expires, errors.New("duplicate element IDs")
+	}
+
+	if d := root.attr("Destination"); d != "" && d != sp.ACSURL {
+		return nil, expires, fmt.Errorf("response is for %q", d)
+	}
+
+	status := root.child(nsSAMLProtocol, "Status")
+	if status == nil {
+		return nil, expires, errors.New("missing status")
+	}
+	if code := status.child(nsSAMLProtocol, "StatusCode"); code == nil || code.attr("Value") != samlStatusOK {
+		return nil, expires, errors.New("the identity provider reported a failure")
+	}
+
+	if root.child(nsSAMLAssertion, "EncryptedAssertion") != nil {
+		return nil, expires, errors.New("encrypted assertions are not supported")
+	}
+	assertions := root.childrenNamed(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, expires, errors.New("expected exactly one assertion")
+	}
+	el := assertions[0]
+
+	responseErr := verifyEnvelopedSignature(root, sp.IDPCertificates)
+	if responseErr != nil && !errors.Is(responseErr, errUnsigned) {
+		return nil, expires, responseErr
+	}
+	if err := verifyEnvelopedSignature(el, sp.IDPCertificates); err != nil {
+		if !errors.Is(err, errUnsigned) {
+			return nil, expires, err
+		}
+		if responseErr != nil {
+			return nil, expires, errors.New("neither the response nor the assertion is signed")
+		}
+	}
+
+	a := &SAMLAssertion{ID: el.attr("ID"), Attributes: make(map[string][]string)}
+	if a.ID == "" {
+		return nil, expires, errors.New("assertion has no ID")
+	}
+	if issuer := el.child(nsSAMLAssertion, "Issuer"); issuer != nil {
+		a.Issuer = issuer.text()
+	}
+	if sp.IDPEntityID != "" && a.Issuer != sp.IDPEntityID {
+		return nil, expires, fmt.Errorf("unexpected issuer %q", a.Issuer)
+	}
+
+	skew := sp.clockSkew()
+	notBefore, notOnOrAfter := func(n *xmlNode) error {
+		if v := n.attr("NotBefore"); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil || now.Add(skew).Before(t) {
+				return errors.New("assertion is not yet valid")
+			}
+		}
+		return nil
+	}, func(n *xmlNode) error {
+		t, err := time.Parse(time.RFC3339Nano, n.attr("NotOnOrAfter"))
+		if err != nil || !now.Add(-skew).Before(t) {
+			return errors.New("assertion has expired")
+		}
+		if expires.IsZero() || t.Before(expires) {
+			expires = t
+		}
+		return nil
+	}
+
+	subject := el.child(nsSAMLAssertion, "Subject")
+	if subject == nil {
+		return nil, expires, errors.New("assertion has no subject")
+	}
+	if nameID := subject.child(nsSAMLAssertion, "NameID"); nameID != nil {
+		a.NameID, a.NameIDFormat = nameID.text(), nameID.attr("Format")
+	}
+	if a.NameID == "" {
+		return nil, expires, errors.New("assertion has no NameID")
+	}
+
+	var confirmed bool
+	for _, c := range subject.childrenNamed(nsSAMLAssertion, "SubjectConfirmation") {
+		data := c.child(nsSAMLAssertion, "SubjectConfirmationData")
+		if c.attr("Method") != samlBearer || data == nil || data.attr("Recipient") != sp.ACSURL {
+			continue
+		}
+		if err := notBefore(data); err != nil {
+			return nil, expires, err
+		}
+		if err := notOnOrAfter(data); err != nil {
+			return nil, expires, err
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, expires, fmt.Errorf("assertion has no bearer confirmation for %q", sp.ACSURL)
+	}
+
+	conditions := el.child(nsSAMLAssertion, "Conditions")
+	if conditions == nil {
+		return nil, expires, errors.New("assertion has no conditions")
+	}
+	if err := notBefore(conditions); err != nil {
+		return nil, expires, err
+	}
+	if conditions.attr("NotOnOrAfter") != "" {
+		if err := notOnOrAfter(conditions); err != nil {
+			return nil, expires, err
+		}
+	}
+
+	restrictions := conditions.childrenNamed(nsSAMLAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return nil, expires, errors.New("assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		var ok bool
+		for _, audience := range restriction.childrenNamed(nsSAMLAssertion, "Audience") {
+			ok = ok || audience.text() == sp.EntityID
+		}
+		if !ok {
+			return nil, expires, fmt.Errorf("assertion is not meant for %q", sp.EntityID)
+		}
+	}
+
+	if authn := el.child(nsSAMLAssertion, "AuthnStatement"); authn != nil {
+		a.SessionIndex = authn.attr("SessionIndex")
+	}
+
+	a.Subject = Subject{ID: a.NameID, Claims: make(map[string]string)}
+	for _, statement := range el.childrenNamed(nsSAMLAssertion, "AttributeStatement") {
+		for _, attr := range statement.childrenNamed(nsSAMLAssertion, "Attribute") {
+			name := attr.attr("Name")
+			for _, v := range attr.childrenNamed(nsSAMLAssertion, "AttributeValue") {
+				a.Attributes[name] = append(a.Attributes[name], v.text())
+			}
+			if vs := a.Attributes[name]; len(vs) > 0 {
+				a.Subject.Claims[name] = vs[0]
+			}
+		}
+	}
+
+	return a, expires, nil
+}
@@ -0,0 +1,236 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	samlTestEntityID = "https://sp.example.com/saml/metadata"
+	samlTestACSURL   = "https://sp.example.com/saml/acs"
+)
+
+// newSAMLTestKey returns an identity provider's signing key and self-signed certificate.
+func newSAMLTestKey(t *testing.T) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, cert
+}
+
+// samlTestAssertion describes the assertion built by samlTestResponse.
+type samlTestAssertion struct {
+	id       string
+	nameID   string
+	audience string
+	expires  time.Time
+	unsigned bool
+}
+
+// samlTestResponse returns a response whose assertion is signed with key the way identity providers sign them.
+func samlTestResponse(t *testing.T, key *rsa.PrivateKey, a samlTestAssertion) string {
+	if a.id == "" {
+		a.id = "_" + randomToken()
+	}
+	if a.nameID == "" {
+		a.nameID = "ann@example.com"
+	}
+	if a.audience == "" {
+		a.audience = samlTestEntityID
+	}
+	if a.expires.IsZero() {
+		a.expires = time.Now().Add(5 * time.Minute)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	expires := a.expires.UTC().Format(time.RFC3339)
+
+	assertion := `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="` + a.id + `" IssueInstant="` + now + `" Version="2.0">` +
+		`<saml:Issuer>https://idp.example.com</saml:Issuer>%s` +
+		`<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">` + a.nameID + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer"><saml:SubjectConfirmationData NotOnOrAfter="` + expires + `" Recipient="` + samlTestACSURL + `"/></saml:SubjectConfirmation></saml:Subject>
+		<saml:Conditions NotBefore="` + now + `" NotOnOrAfter="` + expires + `"><saml:AudienceRestriction><saml:Audience>` + a.audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>
+		<saml:AuthnStatement AuthnInstant="` + now + `" SessionIndex="session-1"/>
+		<saml:AttributeStatement><saml:Attribute Name="groups"><saml:AttributeValue xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="xs:string">admins</saml:AttributeValue><saml:AttributeValue>staff</saml:AttributeValue></saml:Attribute></saml:AttributeStatement>` +
+		`</saml:Assertion>`
+
+	response := `<?xml version="1.0" encoding="UTF-8"?>
+<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" ID="_r` + randomToken() + `" Version="2.0" IssueInstant="` + now + `" Destination="` + samlTestACSURL + `">
+	<samlp:Status><samlp:StatusCode Value="urn:oasis:names:tc:SAML:2.0:status:Success"/></samlp:Status>
+	` + assertion + `
+</samlp:Response>`
+
+	if a.unsigned {
+		return fmt.Sprintf(response, "")
+	}
+
+	tree, err := parseXMLTree([]byte(fmt.Sprintf(response, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tree.child(nsSAMLAssertion, "Assertion").canonicalize(&buf, nil, map[string]bool{"xs": true}, nil)
+	digest := sha256.Sum256(buf.Bytes())
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#"><ds:SignedInfo>` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + a.id + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"><ec:InclusiveNamespaces xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#" PrefixList="xs"/></ds:Transform>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue></ds:Reference>` +
+		`</ds:SignedInfo><ds:SignatureValue>%s</ds:SignatureValue></ds:Signature>`
+
+	tree, err = parseXMLTree([]byte(fmt.Sprintf(response, fmt.Sprintf(signature, ""))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	tree.child(nsSAMLAssertion, "Assertion").child(nsDSig, "Signature").child(nsDSig, "SignedInfo").canonicalize(&buf, nil, nil, nil)
+	hashed := sha256.Sum256(buf.Bytes())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fmt.Sprintf(response, fmt.Sprintf(signature, base64.StdEncoding.EncodeToString(sig)))
+}
+
+func TestSAMLServiceProvider_ParseResponse(t *testing.T) {
+	key, cert := newSAMLTestKey(t)
+	sp := NewSAMLServiceProvider(samlTestEntityID, samlTestACSURL, []*x509.Certificate{cert}, nil)
+	sp.IDPEntityID = "https://idp.example.com"
+
+	a, err := sp.ParseResponse([]byte(samlTestResponse(t, key, samlTestAssertion{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.NameID != "ann@example.com" || a.Issuer != "https://idp.example.com" || a.SessionIndex != "session-1" {
+		t.Errorf("unexpected assertion %+v", a)
+	}
+	if got := a.Attributes["groups"]; len(got) != 2 || got[0] != "admins" || got[1] != "staff" {
+		t.Errorf("expected both group values, got %v", got)
+	}
+	if a.Subject.ID != "ann@example.com" || a.Subject.Claims["groups"] != "admins" {
+		t.Errorf("unexpected subject %+v", a.Subject)
+	}
+}
+
+func TestSAMLServiceProvider_Rejects(t *testing.T) {
+	key, cert := newSAMLTestKey(t)
+	otherKey, _ := newSAMLTestKey(t)
+	sp := NewSAMLServiceProvider(samlTestEntityID, samlTestACSURL, []*x509.Certificate{cert}, nil)
+
+	valid := samlTestResponse(t, key, samlTestAssertion{id: "_replayed"})
+	if _, err := sp.ParseResponse([]byte(valid)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a signature wrapping attempt: a second element claims the signed assertion's ID
+	wrapped := strings.Replace(samlTestResponse(t, key, samlTestAssertion{id: "_wrapped"}), "<samlp:Status>",
+		`<samlp:Extensions><saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_wrapped"/></samlp:Extensions><samlp:Status>`, 1)
+
+	tests := []struct {
+		name     string
+		response string
+	}{
+		{name: "replayed", response: valid},
+		{name: "unsigned", response: samlTestResponse(t, key, samlTestAssertion{unsigned: true})},
+		{name: "untrusted key", response: samlTestResponse(t, otherKey, samlTestAssertion{})},
+		{name: "tampered", response: strings.Replace(samlTestResponse(t, key, samlTestAssertion{}), "ann@example.com", "admin@example.com", 1)},
+		{name: "another audience", response: samlTestResponse(t, key, samlTestAssertion{audience: "https://other.example.com"})},
+		{name: "expired", response: samlTestResponse(t, key, samlTestAssertion{expires: time.Now().Add(-10 * time.Minute)})},
+		{name: "duplicate IDs", response: wrapped},
+		{name: "not xml", response: "SAML"},
+	}
+
+	for _, e := range tests {
+		if _, err := sp.ParseResponse([]byte(e.response)); !errors.Is(err, ErrInvalidSAMLResponse) {
+			t.Errorf("%s: expected ErrInvalidSAMLResponse, got %v", e.name, err)
+		}
+	}
+
+	skewed := samlTestResponse(t, key, samlTestAssertion{expires: time.Now().Add(-time.Minute)})
+	if _, err := sp.ParseResponse([]byte(skewed)); err != nil {
+		t.Errorf("expected an assertion expired within the clock skew to be accepted, got %v", err)
+	}
+}
+
+func TestSAMLServiceProvider_ACS(t *testing.T) {
+	key, cert := newSAMLTestKey(t)
+
+	var got *SAMLAssertion
+	sp := NewSAMLServiceProvider(samlTestEntityID, samlTestACSURL, []*x509.Certificate{cert}, func(w http.ResponseWriter, r *http.Request, a *SAMLAssertion) {
+		got = a
+		http.Redirect(w, r, a.ReturnTo, http.StatusFound)
+	})
+
+	form := url.Values{
+		"SAMLResponse": {base64.StdEncoding.EncodeToString([]byte(samlTestResponse(t, key, samlTestAssertion{})))},
+		"RelayState":   {"/dashboard"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/saml/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+	sp.ACS()(rr, req)
+
+	if rr.Code != http.StatusFound || got == nil || got.ReturnTo != "/dashboard" {
+		t.Fatalf("expected a login redirecting to /dashboard, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/saml/acs", strings.NewReader("SAMLResponse=%21"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+	sp.ACS()(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a malformed response, got %d", rr.Code)
+	}
+}
+
+func TestSAMLServiceProvider_Metadata(t *testing.T) {
+	sp := NewSAMLServiceProvider(samlTestEntityID, samlTestACSURL, nil, nil)
+
+	rr := httptest.NewRecorder()
+	sp.Metadata()(rr, httptest.NewRequest(http.MethodGet, "/saml/metadata", nil))
+
+	body := rr.Body.String()
+	if !strings.Contains(body, `entityID="`+samlTestEntityID+`"`) || !strings.Contains(body, `Location="`+samlTestACSURL+`"`) {
+		t.Errorf("unexpected metadata:\n%s", body)
+	}
+	if _, err := parseXMLTree(rr.Body.Bytes()); err != nil {
+		t.Errorf("expected well-formed metadata, got %v", err)
+	}
+}
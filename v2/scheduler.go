@@ -0,0 +1,523 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schedule computes the activation times of a periodic job.
+type Schedule interface {
+	// Next returns the first activation time strictly after t, or the zero time if there is none.
+	Next(t time.Time) time.Time
+}
+
+// everySchedule activates at a fixed interval.
+type everySchedule time.Duration
+
+// Next returns t plus the interval, truncated to whole seconds.
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e)).Truncate(time.Second)
+}
+
+// cronSchedule is a parsed five-field cron expression. Each field is a bit set of allowed values.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6, "jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	cronDayNames   = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+)
+
+// ParseCronSpec parses a standard five-field cron expression (minute hour day-of-month month day-of-week),
+// supporting lists, ranges, steps, month and weekday names, the @hourly/@daily/@weekly/@monthly/@yearly
+// descriptors, and "@every <duration>". As in cron, when both day fields are restricted a day matching either runs.
+// Parameters:
+// - spec: The cron expression.
+// Returns the Schedule, evaluated in the local time zone, or an error if the expression is invalid.
+func ParseCronSpec(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d < time.Second {
+			return nil, fmt.Errorf("invalid @every interval %q", rest)
+		}
+		return everySchedule(d), nil
+	}
+
+	if expanded, ok := cronDescriptors[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron spec %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &cronSchedule{loc: time.Local}
+
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute field: %w", err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour field: %w", err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day-of-month field: %w", err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid month field: %w", err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("invalid day-of-week field: %w", err)
+	}
+
+	// 7 is an alias for Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+
+	return s, nil
+}
+
+// parseCronField parses one comma-separated cron field into a bit set.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" && rangePart != "?" {
+			loPart, hiPart, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			if lo, err = parseCronValue(loPart, names); err != nil {
+				return 0, err
+			}
+
+			hi = lo
+			if isRange {
+				if hi, err = parseCronValue(hiPart, names); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q", part)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// parseCronValue parses a number or a name.
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	return v, nil
+}
+
+// Next returns the first matching minute strictly after t.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+// dayMatches applies cron's day-of-month/day-of-week semantics.
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// JobFunc is the work performed by a scheduled job.
+type JobFunc func(ctx context.Context) error
+
+// JobOptions configures a scheduled job.
+// Fields:
+// - Jitter: A random delay of up to this duration added before each run, spreading load across replicas.
+// - Timeout: An optional time limit for each run.
+// - Distributed: Take a lock through the scheduler's Locker for each run, so the job runs once across replicas.
+type JobOptions struct {
+	Jitter      time.Duration
+	Timeout     time.Duration
+	Distributed bool
+}
+
+// JobStats holds the metrics of a scheduled job.
+type JobStats struct {
+	Runs         int64         `json:"runs"`
+	Failures     int64         `json:"failures"`
+	Skipped      int64         `json:"skipped"`
+	Running      bool          `json:"running"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+}
+
+type scheduledJob struct {
+	name     string
+	schedule Schedule
+	fn       JobFunc
+	opts     JobOptions
+	stats    JobStats
+}
+
+// Scheduler runs registered jobs periodically inside the application process.
+// A run is skipped if the previous run of the same job is still in progress, and panics are recovered and
+// reported as failures.
+// Fields:
+// - Locker: The Locker used by jobs registered with Distributed set.
+// - ErrorLog: An optional callback receiving every failed run.
+type Scheduler struct {
+	Locker   Locker
+	ErrorLog func(job string, err error)
+
+	mu       sync.Mutex
+	jobs     map[string]*scheduledJob
+	started  bool
+	loopCtx  context.Context
+	stopLoop context.CancelFunc
+	runCtx   context.Context
+	stopRun  context.CancelFunc
+	loops    sync.WaitGroup
+	runs     sync.WaitGroup
+	now      func() time.Time
+}
+
+// NewScheduler creates an empty Scheduler.
+// Returns a pointer to the new Scheduler.
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*scheduledJob)}
+}
+
+// Register adds a job. Jobs may be registered before or after Start.
+// Parameters:
+// - name: A unique job name, used in metrics, logs, and as the lock name of distributed jobs.
+// - spec: The cron expression, see ParseCronSpec.
+// - fn: The work to run.
+// - opts: Optional JobOptions. Only the first value is used if multiple are provided.
+// Returns an error if the name is taken or the spec is invalid.
+func (s *Scheduler) Register(name, spec string, fn JobFunc, opts ...JobOptions) error {
+	schedule, err := ParseCronSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	return s.add(name, schedule, fn, opts...)
+}
+
+// add registers a job with an already parsed schedule.
+func (s *Scheduler) add(name string, schedule Schedule, fn JobFunc, opts ...JobOptions) error {
+	job := &scheduledJob{name: name, schedule: schedule, fn: fn}
+	if len(opts) > 0 {
+		job.opts = opts[0]
+	}
+
+	if job.opts.Distributed && s.Locker == nil {
+		return fmt.Errorf("job %q is distributed but the scheduler has no Locker", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs == nil {
+		s.jobs = make(map[string]*scheduledJob)
+	}
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %q is already registered", name)
+	}
+
+	s.jobs[name] = job
+
+	if s.started {
+		s.startLoop(job)
+	}
+
+	return nil
+}
+
+// Start begins running the registered jobs in the background.
+// Parameters:
+// - ctx: The parent context of the scheduler. Canceling it stops scheduling new runs.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+
+	s.started = true
+	s.loopCtx, s.stopLoop = context.WithCancel(ctx)
+	// runs outlive ctx so that Stop can let them finish gracefully
+	s.runCtx, s.stopRun = context.WithCancel(context.WithoutCancel(ctx))
+
+	for _, job := range s.jobs {
+		s.startLoop(job)
+	}
+}
+
+// Stop stops scheduling new runs and waits for in-progress runs to finish. If ctx ends first, the contexts
+// of the remaining runs are canceled.
+// Parameters:
+// - ctx: The context bounding the wait.
+// Returns ctx.Err() if the running jobs did not finish in time.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.started {
+		s.mu.Unlock()
+		return nil
+	}
+	s.stopLoop()
+	s.mu.Unlock()
+
+	s.loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.stopRun()
+		return nil
+	case <-ctx.Done():
+		s.stopRun()
+		return ctx.Err()
+	}
+}
+
+// Stats returns a snapshot of the metrics of every job, keyed by job name.
+func (s *Scheduler) Stats() map[string]JobStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make(map[string]JobStats, len(s.jobs))
+	for name, job := range s.jobs {
+		stats[name] = job.stats
+	}
+
+	return stats
+}
+
+// RunNow runs a registered job immediately, outside its schedule, honoring overlap prevention.
+// Parameters:
+// - ctx: The context passed to the job.
+// - name: The job name.
+// Returns the job's error, or an error if the job is unknown or already running.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.Lock()
+	job, ok := s.jobs[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("job %q is not registered", name)
+	}
+
+	if !s.begin(job) {
+		return fmt.Errorf("job %q is already running", name)
+	}
+
+	return s.run(ctx, job)
+}
+
+// startLoop launches the goroutine driving one job. The caller must hold s.mu.
+func (s *Scheduler) startLoop(job *scheduledJob) {
+	loopCtx, runCtx := s.loopCtx, s.runCtx
+
+	s.loops.Add(1)
+	go func() {
+		defer s.loops.Done()
+
+		for {
+			next := job.schedule.Next(s.clock())
+			if next.IsZero() {
+				return
+			}
+
+			s.mu.Lock()
+			job.stats.NextRun = next
+			s.mu.Unlock()
+
+			wait := time.Until(next)
+			if job.opts.Jitter > 0 {
+				wait += time.Duration(rand.Int63n(int64(job.opts.Jitter)))
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-loopCtx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if !s.begin(job) {
+				continue
+			}
+
+			s.runs.Add(1)
+			go func() {
+				defer s.runs.Done()
+				_ = s.run(runCtx, job)
+			}()
+		}
+	}()
+}
+
+// begin marks a job as running, returning false (and counting a skip) if it already is.
+func (s *Scheduler) begin(job *scheduledJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.stats.Running {
+		job.stats.Skipped++
+		return false
+	}
+
+	job.stats.Running = true
+
+	return true
+}
+
+// run executes one run of a job that begin marked as running, recording its metrics.
+func (s *Scheduler) run(ctx context.Context, job *scheduledJob) (err error) {
+	start := s.clock()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+
+		s.mu.Lock()
+		job.stats.Running = false
+		if !errors.Is(err, ErrLockHeld) {
+			job.stats.Runs++
+			job.stats.LastRun = start
+			job.stats.LastDuration = s.clock().Sub(start)
+			job.stats.LastError = ""
+			if err != nil {
+				job.stats.Failures++
+				job.stats.LastError = err.Error()
+			}
+		}
+		s.mu.Unlock()
+
+		if err != nil && !errors.Is(err, ErrLockHeld) && s.ErrorLog != nil {
+			s.ErrorLog(job.name, err)
+		}
+	}()
+
+	if job.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.opts.Timeout)
+		defer cancel()
+	}
+
+	if job.opts.Distributed {
+		lockTools := Tools{Locker: s.Locker}
+		ttl := job.opts.Timeout
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+
+		l, err := lockTools.Lock(ctx, "scheduler:"+job.name, ttl)
+		if err != nil {
+			return err
+		}
+		defer l.Release(context.Background())
+	}
+
+	return job.fn(ctx)
+}
+
+// clock returns the current time, overridable in tests.
+func (s *Scheduler) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,173 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var cronTests = []struct {
+	name     string
+	spec     string
+	from     string
+	expected string
+}{
+	{name: "every minute", spec: "* * * * *", from: "2024-03-10 10:15:30", expected: "2024-03-10 10:16:00"},
+	{name: "every 15 minutes", spec: "*/15 * * * *", from: "2024-03-10 10:15:00", expected: "2024-03-10 10:30:00"},
+	{name: "daily", spec: "@daily", from: "2024-03-10 10:15:00", expected: "2024-03-11 00:00:00"},
+	{name: "weekdays at 9", spec: "0 9 * * mon-fri", from: "2024-03-08 09:00:00", expected: "2024-03-11 09:00:00"},
+	{name: "month rollover", spec: "30 2 1 * *", from: "2024-12-15 00:00:00", expected: "2025-01-01 02:30:00"},
+	{name: "leap day", spec: "0 0 29 feb *", from: "2024-03-01 00:00:00", expected: "2028-02-29 00:00:00"},
+	{name: "dom or dow", spec: "0 0 13 * fri", from: "2024-03-10 00:00:00", expected: "2024-03-13 00:00:00"},
+	{name: "sunday as 7", spec: "0 12 * * 7", from: "2024-03-10 13:00:00", expected: "2024-03-17 12:00:00"},
+	{name: "list and range step", spec: "0 1,8-20/6 * * *", from: "2024-03-10 09:00:00", expected: "2024-03-10 14:00:00"},
+}
+
+func TestParseCronSpec(t *testing.T) {
+	const layout = "2006-01-02 15:04:05"
+
+	for _, e := range cronTests {
+		schedule, err := ParseCronSpec(e.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", e.name, err)
+			continue
+		}
+
+		// evaluate in UTC to keep the test independent of the machine's time zone
+		schedule.(*cronSchedule).loc = time.UTC
+
+		from, _ := time.ParseInLocation(layout, e.from, time.UTC)
+		if next := schedule.Next(from).Format(layout); next != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, next)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * * mon-", "*/0 * * * *", "@every 1ms"} {
+		if _, err := ParseCronSpec(spec); err == nil {
+			t.Errorf("%q: expected error but none received", spec)
+		}
+	}
+}
+
+func TestScheduler_Runs(t *testing.T) {
+	s := NewScheduler()
+
+	var runs int32
+	_ = s.add("tick", everySchedule(10*time.Millisecond), func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	s.Start(context.Background())
+	time.Sleep(100 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(&runs); n < 3 {
+		t.Errorf("expected several runs, got %d", n)
+	}
+
+	if stats := s.Stats()["tick"]; stats.Runs != int64(atomic.LoadInt32(&runs)) {
+		t.Errorf("expected stats to count %d runs, got %d", runs, stats.Runs)
+	}
+}
+
+func TestScheduler_OverlapAndPanics(t *testing.T) {
+	s := NewScheduler()
+
+	var failures []string
+	s.ErrorLog = func(job string, err error) { failures = append(failures, job+": "+err.Error()) }
+
+	release := make(chan struct{})
+	_ = s.Register("slow", "@hourly", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	_ = s.Register("broken", "@hourly", func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	go func() { _ = s.RunNow(context.Background(), "slow") }()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := s.RunNow(context.Background(), "slow"); err == nil {
+		t.Error("expected overlapping run to be refused")
+	}
+	close(release)
+
+	if err := s.RunNow(context.Background(), "broken"); err == nil || err.Error() != "panic: boom" {
+		t.Errorf("expected recovered panic, got %v", err)
+	}
+
+	if stats := s.Stats(); stats["slow"].Skipped != 1 || stats["broken"].Failures != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	if len(failures) != 1 {
+		t.Errorf("expected one logged failure, got %v", failures)
+	}
+}
+
+func TestScheduler_StopWaitsForRuns(t *testing.T) {
+	s := NewScheduler()
+
+	var canceled int32
+	_ = s.add("long", everySchedule(5*time.Millisecond), func(ctx context.Context) error {
+		<-ctx.Done()
+		atomic.StoreInt32(&canceled, 1)
+		return ctx.Err()
+	})
+
+	s.Start(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&canceled) != 1 {
+		t.Error("expected running job to be canceled after the stop deadline")
+	}
+}
+
+func TestScheduler_Distributed(t *testing.T) {
+	locker := &FileLocker{Dir: t.TempDir()}
+	a, b := NewScheduler(), NewScheduler()
+	a.Locker, b.Locker = locker, locker
+
+	var runs int32
+	job := func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	_ = a.Register("report", "@daily", job, JobOptions{Distributed: true})
+	_ = b.Register("report", "@daily", job, JobOptions{Distributed: true})
+
+	done := make(chan struct{})
+	go func() {
+		_ = a.RunNow(context.Background(), "report")
+		close(done)
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	if err := b.RunNow(context.Background(), "report"); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("expected ErrLockHeld on second replica, got %v", err)
+	}
+	<-done
+
+	if n := atomic.LoadInt32(&runs); n != 1 {
+		t.Errorf("expected exactly one run, got %d", n)
+	}
+}
@@ -0,0 +1,234 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when an outbound request targets a loopback, private, or otherwise internal address.
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+// ScrapeOptions configures ScrapeMeta.
+// Fields:
+// - MaxBytes: The maximum number of bytes read from the page. Defaults to 1MB.
+// - Timeout: The overall time limit for the request. Defaults to 10 seconds.
+// - AllowPrivateNetworks: Disables SSRF protection, allowing loopback and private addresses. Only use with trusted URLs.
+// - UserAgent: The User-Agent header sent with the request.
+type ScrapeOptions struct {
+	MaxBytes             int64
+	Timeout              time.Duration
+	AllowPrivateNetworks bool
+	UserAgent            string
+}
+
+// PageMeta holds the metadata extracted from a web page for link previews.
+type PageMeta struct {
+	URL          string `json:"url"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Image        string `json:"image,omitempty"`
+	CanonicalURL string `json:"canonical_url,omitempty"`
+	SiteName     string `json:"site_name,omitempty"`
+	Type         string `json:"type,omitempty"`
+	Favicon      string `json:"favicon,omitempty"`
+}
+
+// ScrapeMeta fetches a web page and extracts its title, description, Open Graph and canonical metadata.
+// Only http and https URLs are fetched, and unless AllowPrivateNetworks is set every connection (including redirects)
+// to loopback, private, link-local or otherwise internal addresses is refused, so user-supplied URLs cannot reach internal services.
+// Parameters:
+// - ctx: The context controlling the request.
+// - rawURL: The URL of the page to scrape.
+// - opts: Optional ScrapeOptions. Only the first value is used if multiple are provided.
+// Returns the extracted metadata, with relative URLs resolved, or an error if the page cannot be fetched or is not HTML.
+func (t *Tools) ScrapeMeta(ctx context.Context, rawURL string, opts ...ScrapeOptions) (*PageMeta, error) {
+	var o ScrapeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 1024 * 1024
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.UserAgent == "" {
+		o.UserAgent = "toolkit-link-preview/1.0"
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid URL %q: only absolute http and https URLs are allowed", rawURL)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", o.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	res, err := newOutboundClient(o.AllowPrivateNetworks).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d fetching %s", res.StatusCode, rawURL)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, o.MaxBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	return extractPageMeta(res.Request.URL, string(body)), nil
+}
+
+// extractPageMeta builds a PageMeta from an HTML document fetched from base.
+func extractPageMeta(base *url.URL, doc string) *PageMeta {
+	meta := &PageMeta{URL: base.String(), Title: scanHTMLTitle(doc)}
+
+	var ogTitle, ogDescription, description, twitterImage string
+
+	for _, tag := range scanHTMLTags(doc, "meta", "link") {
+		if tag.Name == "link" {
+			for _, rel := range strings.Fields(strings.ToLower(tag.Attrs["rel"])) {
+				switch rel {
+				case "canonical":
+					meta.CanonicalURL = resolveURL(base, tag.Attrs["href"])
+				case "icon":
+					if meta.Favicon == "" {
+						meta.Favicon = resolveURL(base, tag.Attrs["href"])
+					}
+				}
+			}
+			continue
+		}
+
+		key := strings.ToLower(tag.Attrs["property"])
+		if key == "" {
+			key = strings.ToLower(tag.Attrs["name"])
+		}
+		content := strings.TrimSpace(tag.Attrs["content"])
+
+		switch key {
+		case "og:title":
+			ogTitle = content
+		case "og:description":
+			ogDescription = content
+		case "description":
+			description = content
+		case "og:image", "og:image:url":
+			if meta.Image == "" {
+				meta.Image = resolveURL(base, content)
+			}
+		case "twitter:image":
+			twitterImage = resolveURL(base, content)
+		case "og:site_name":
+			meta.SiteName = content
+		case "og:type":
+			meta.Type = content
+		case "og:url":
+			if meta.CanonicalURL == "" {
+				meta.CanonicalURL = resolveURL(base, content)
+			}
+		}
+	}
+
+	if ogTitle != "" {
+		meta.Title = ogTitle
+	}
+
+	meta.Description = description
+	if ogDescription != "" {
+		meta.Description = ogDescription
+	}
+
+	if meta.Image == "" {
+		meta.Image = twitterImage
+	}
+
+	return meta
+}
+
+// resolveURL resolves ref against base, returning an empty string for empty or invalid references.
+func resolveURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	return base.ResolveReference(r).String()
+}
+
+// newOutboundClient returns an http.Client for requests to untrusted URLs. Unless allowPrivate is set, its dialer
+// refuses connections to internal addresses after DNS resolution, which also covers redirects and DNS rebinding.
+func newOutboundClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// cgnatNetwork is the shared address space used by carrier-grade NAT (RFC 6598).
+var cgnatNetwork = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether ip is a globally routable unicast address.
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || cgnatNetwork.Contains(ip))
+}
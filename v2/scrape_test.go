@@ -0,0 +1,100 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const scrapeTestPage = `<!doctype html>
+<html><head>
+<title>  Fallback
+ Title </title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="Open Graph &amp; Title">
+<meta property="og:image" content="/img/cover.png">
+<meta property="og:site_name" content="Example">
+<link rel="canonical" href="https://example.com/post">
+<link rel="shortcut icon" href="/favicon.ico">
+<!-- <meta property="og:description" content="commented out"> -->
+</head><body></body></html>`
+
+func TestTools_ScrapeMeta(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(scrapeTestPage))
+	}))
+	defer srv.Close()
+
+	var testTools Tools
+
+	meta, err := testTools.ScrapeMeta(context.Background(), srv.URL+"/post", ScrapeOptions{AllowPrivateNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if meta.Title != "Open Graph & Title" {
+		t.Errorf("unexpected title: %q", meta.Title)
+	}
+
+	if meta.Description != "Plain description" {
+		t.Errorf("unexpected description: %q", meta.Description)
+	}
+
+	if meta.Image != srv.URL+"/img/cover.png" {
+		t.Errorf("expected image to be resolved, got %q", meta.Image)
+	}
+
+	if meta.CanonicalURL != "https://example.com/post" {
+		t.Errorf("unexpected canonical URL: %q", meta.CanonicalURL)
+	}
+
+	if meta.Favicon != srv.URL+"/favicon.ico" {
+		t.Errorf("unexpected favicon: %q", meta.Favicon)
+	}
+}
+
+func TestTools_ScrapeMetaBlocksPrivateNetworks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not have reached the server")
+	}))
+	defer srv.Close()
+
+	var testTools Tools
+
+	_, err := testTools.ScrapeMeta(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected ErrBlockedAddress, got %v", err)
+	}
+}
+
+func TestTools_ScrapeMetaRejectsNonHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	var testTools Tools
+
+	for _, rawURL := range []string{srv.URL, "ftp://example.com/file", "/relative"} {
+		if _, err := testTools.ScrapeMeta(context.Background(), rawURL, ScrapeOptions{AllowPrivateNetworks: true}); err == nil {
+			t.Errorf("%s: expected error but none received", rawURL)
+		}
+	}
+}
+
+func TestScanHTMLTags(t *testing.T) {
+	tags := scanHTMLTags(`<A HREF='/a'>x</A><img src=/b.png alt="a > b"><a href="/c?x=1&amp;y=2">`, "a", "img")
+
+	if len(tags) != 3 {
+		t.Fatalf("expected 3 tags, got %d", len(tags))
+	}
+
+	if tags[0].Attrs["href"] != "/a" || tags[1].Attrs["alt"] != "a > b" || !strings.HasSuffix(tags[2].Attrs["href"], "x=1&y=2") {
+		t.Errorf("unexpected attributes: %+v", tags)
+	}
+}
@@ -0,0 +1,290 @@
+package toolkit
+
+import (
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// SearchHit is a document matching a search.
+// Fields:
+// - ID: The document ID.
+// - Score: The BM25 relevance score. Higher is better.
+// - Fields: The fields stored with the document.
+type SearchHit struct {
+	ID     string            `json:"id"`
+	Score  float64           `json:"score"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// indexedDoc is a document as stored in a SearchIndex.
+type indexedDoc struct {
+	Terms  map[string]int
+	Length int
+	Fields map[string]string
+}
+
+// SearchIndex is a small in-memory full-text index with English stemming and BM25 ranking, persisted to a single
+// file. It suits apps with up to tens of thousands of documents; beyond that, use a dedicated search engine.
+// It is safe for concurrent use.
+type SearchIndex struct {
+	mu          sync.RWMutex
+	docs        map[string]*indexedDoc
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+// NewSearchIndex creates an empty index.
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{docs: make(map[string]*indexedDoc), postings: make(map[string]map[string]int)}
+}
+
+// OpenSearchIndex loads an index saved with Save. A missing file yields an empty index.
+// Parameters:
+// - pathName: The path of the index file.
+// Returns the index, or an error if the file exists but cannot be read.
+func OpenSearchIndex(pathName string) (*SearchIndex, error) {
+	ix := NewSearchIndex()
+
+	f, err := os.Open(pathName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var docs map[string]*indexedDoc
+	if err := gob.NewDecoder(f).Decode(&docs); err != nil {
+		return nil, err
+	}
+
+	for id, doc := range docs {
+		ix.insert(id, doc)
+	}
+
+	return ix, nil
+}
+
+// Save writes the index to pathName atomically, through a temporary file in the same directory.
+func (ix *SearchIndex) Save(pathName string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(pathName), ".search-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	ix.mu.RLock()
+	err = gob.NewEncoder(tmp).Encode(ix.docs)
+	ix.mu.RUnlock()
+
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), pathName)
+}
+
+// Add indexes text under id, replacing any document with the same ID.
+// Parameters:
+// - id: The document ID, e.g. a file name or database key.
+// - text: The text to index.
+// - fields: Optional values stored with the document and returned in search hits, e.g. a title. Only the
+// first map is used if multiple are provided.
+func (ix *SearchIndex) Add(id, text string, fields ...map[string]string) {
+	doc := &indexedDoc{Terms: make(map[string]int)}
+	if len(fields) > 0 {
+		doc.Fields = fields[0]
+	}
+
+	for _, term := range tokenize(text) {
+		doc.Terms[term]++
+		doc.Length++
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+	ix.insert(id, doc)
+}
+
+// Remove deletes the document with the given ID, if any.
+func (ix *SearchIndex) Remove(id string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(id)
+}
+
+// Len returns the number of documents in the index.
+func (ix *SearchIndex) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.docs)
+}
+
+// Search ranks the documents matching any term of query with BM25.
+// Parameters:
+// - query: The search text. It is tokenized and stemmed like indexed text.
+// - limit: The maximum number of hits returned. Zero or less means 10.
+// Returns the hits, best first.
+func (ix *SearchIndex) Search(query string, limit int) []SearchHit {
+	if limit <= 0 {
+		limit = 10
+	}
+
+	const k1, b = 1.2, 0.75
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	if len(ix.docs) == 0 {
+		return nil
+	}
+
+	n := float64(len(ix.docs))
+	avgLength := float64(ix.totalLength) / n
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		posting := ix.postings[term]
+		idf := math.Log(1 + (n-float64(len(posting))+0.5)/(float64(len(posting))+0.5))
+
+		for id, tf := range posting {
+			length := float64(ix.docs[id].Length)
+			f := float64(tf)
+			scores[id] += idf * f * (k1 + 1) / (f + k1*(1-b+b*length/avgLength))
+		}
+	}
+
+	hits := make([]SearchHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, SearchHit{ID: id, Score: score, Fields: ix.docs[id].Fields})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+
+	return hits
+}
+
+// insert adds doc to the index. The caller must hold the write lock.
+func (ix *SearchIndex) insert(id string, doc *indexedDoc) {
+	ix.docs[id] = doc
+	ix.totalLength += doc.Length
+
+	for term, tf := range doc.Terms {
+		if ix.postings[term] == nil {
+			ix.postings[term] = make(map[string]int)
+		}
+		ix.postings[term][id] = tf
+	}
+}
+
+// remove deletes the document id from the index. The caller must hold the write lock.
+func (ix *SearchIndex) remove(id string) {
+	doc, ok := ix.docs[id]
+	if !ok {
+		return
+	}
+
+	for term := range doc.Terms {
+		delete(ix.postings[term], id)
+		if len(ix.postings[term]) == 0 {
+			delete(ix.postings, term)
+		}
+	}
+
+	ix.totalLength -= doc.Length
+	delete(ix.docs, id)
+}
+
+// stopWords are common English words left out of the index.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true, "for": true,
+	"from": true, "has": true, "in": true, "is": true, "it": true, "its": true, "of": true, "on": true, "or": true,
+	"that": true, "the": true, "this": true, "to": true, "was": true, "were": true, "will": true, "with": true,
+}
+
+// tokenize splits text into lower-cased, stemmed terms, dropping stop words.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		if stopWords[w] {
+			continue
+		}
+		terms = append(terms, stem(w))
+	}
+
+	return terms
+}
+
+// stem reduces an English word to an approximate stem by stripping common inflectional suffixes. It is a light
+// stemmer: it conflates plurals and verb forms ("uploads", "uploaded", "uploading") without Porter's full rules.
+func stem(w string) string {
+	if len([]rune(w)) <= 3 {
+		return w
+	}
+
+	switch {
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		return w[:len(w)-3] + "y"
+	case strings.HasSuffix(w, "sses"):
+		return w[:len(w)-2]
+	case strings.HasSuffix(w, "ss") || strings.HasSuffix(w, "us") || strings.HasSuffix(w, "is"):
+		// class, status, analysis
+	case strings.HasSuffix(w, "s"):
+		w = w[:len(w)-1]
+	}
+
+	for _, suffix := range []string{"ingly", "edly", "ing", "ed", "ly"} {
+		if strings.HasSuffix(w, suffix) && len(w)-len(suffix) >= 3 {
+			w = w[:len(w)-len(suffix)]
+
+			// "stopped" -> "stopp" -> "stop"
+			if n := len(w); n >= 2 && w[n-1] == w[n-2] && !strings.ContainsRune("lsz", rune(w[n-1])) {
+				w = w[:n-1]
+			}
+			break
+		}
+	}
+
+	return w
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+var stemTests = []struct {
+	word     string
+	expected string
+}{
+	{"uploads", "upload"},
+	{"uploaded", "upload"},
+	{"uploading", "upload"},
+	{"stopped", "stop"},
+	{"libraries", "library"},
+	{"status", "status"},
+	{"classes", "class"},
+	{"go", "go"},
+}
+
+func TestStem(t *testing.T) {
+	for _, e := range stemTests {
+		if got := stem(e.word); got != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.word, e.expected, got)
+		}
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	ix := NewSearchIndex()
+	ix.Add("report.pdf", "Quarterly report on uploaded files and storage usage", map[string]string{"title": "Report"})
+	ix.Add("notes.txt", "Notes about uploading photos. Uploads of photos are slow; photos everywhere.")
+	ix.Add("todo.md", "Buy milk")
+
+	hits := ix.Search("photo uploads", 10)
+	if len(hits) != 2 || hits[0].ID != "notes.txt" || hits[1].ID != "report.pdf" {
+		t.Fatalf("unexpected hits %+v", hits)
+	}
+
+	if hits[1].Fields["title"] != "Report" {
+		t.Errorf("expected stored fields in hits, got %v", hits[1].Fields)
+	}
+
+	if hits := ix.Search("the", 10); len(hits) != 0 {
+		t.Errorf("expected stop words to match nothing, got %+v", hits)
+	}
+
+	ix.Add("notes.txt", "Nothing relevant anymore")
+	if hits := ix.Search("photos", 10); len(hits) != 0 {
+		t.Errorf("expected replaced document to be reindexed, got %+v", hits)
+	}
+
+	path := filepath.Join(t.TempDir(), "index.gob")
+	if err := ix.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := OpenSearchIndex(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Len() != 3 {
+		t.Errorf("expected 3 documents after reload, got %d", loaded.Len())
+	}
+
+	if hits := loaded.Search("milk", 1); len(hits) != 1 || hits[0].ID != "todo.md" {
+		t.Errorf("unexpected hits after reload %+v", hits)
+	}
+
+	loaded.Remove("todo.md")
+	if hits := loaded.Search("milk", 1); len(hits) != 0 {
+		t.Errorf("expected removed document not to match, got %+v", hits)
+	}
+
+	if empty, err := OpenSearchIndex(filepath.Join(t.TempDir(), "missing.gob")); err != nil || empty.Len() != 0 {
+		t.Errorf("expected empty index for a missing file, got %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrSecretNotFound is returned by a SecretProvider when a secret does not exist.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretProvider loads secrets such as database passwords and signing keys, so they need not be kept in plain
+// environment variables. EnvSecrets, FileSecrets, VaultSecrets and AWSSecretsManager are provided, and ChainSecrets
+// combines them.
+type SecretProvider interface {
+	// Secret returns the secret's value, or an error wrapping ErrSecretNotFound.
+	Secret(ctx context.Context, name string) ([]byte, error)
+}
+
+// EnvSecrets reads secrets from environment variables, e.g. for local development.
+// Fields:
+// - Prefix: Prepended to secret names, e.g. "APP_" reads "db_password" from APP_DB_PASSWORD. Names are upper-cased.
+type EnvSecrets struct {
+	Prefix string
+}
+
+// Secret returns the value of the environment variable.
+func (p EnvSecrets) Secret(_ context.Context, name string) ([]byte, error) {
+	key := strings.ToUpper(p.Prefix + name)
+
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, key)
+	}
+
+	return []byte(v), nil
+}
+
+// FileSecrets reads secrets from files, one per secret, as Docker and Kubernetes mount them. A single trailing
+// newline is removed.
+// Fields:
+// - Dir: The directory holding the files. Defaults to /run/secrets, where Docker mounts secrets.
+type FileSecrets struct {
+	Dir string
+}
+
+// Secret returns the contents of the file named name.
+func (p FileSecrets) Secret(_ context.Context, name string) ([]byte, error) {
+	dir := p.Dir
+	if dir == "" {
+		dir = "/run/secrets"
+	}
+
+	path, err := (&Tools{}).SafeJoin(dir, name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+
+	return data, nil
+}
+
+// VaultSecrets reads secrets from a HashiCorp Vault KV version 2 engine. Names have the form "path#key", e.g.
+// "myapp/db#password"; without a key, the "value" key is read.
+// Fields:
+// - Address: The Vault address, e.g. "https://vault.example.com:8200".
+// - Token: The Vault token.
+// - Mount: The KV engine's mount path. Defaults to "secret".
+// - Namespace: The Vault Enterprise namespace, if any.
+// - Client: An optional http.Client. Defaults to one with a 10 second timeout.
+type VaultSecrets struct {
+	Address   string
+	Token     string
+	Mount     string
+	Namespace string
+	Client    *http.Client
+}
+
+// Secret returns a key of the secret at path.
+func (p *VaultSecrets) Secret(ctx context.Context, name string) ([]byte, error) {
+	path, key, _ := strings.Cut(name, "#")
+	if key == "" {
+		key = "value"
+	}
+
+	mount := p.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.Address, "/")+"/v1/"+mount+"/data/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	if p.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.Namespace)
+	}
+
+	var out struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := doSecretRequest(p.Client, req, "vault", &out); err != nil {
+		return nil, err
+	}
+
+	return secretField(out.Data.Data, name, key)
+}
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager. Names are secret IDs or ARNs. A name of the form
+// "id#key" reads a key of a secret stored as a JSON object, as the console creates them.
+// Fields:
+// - Region: The AWS region, e.g. "us-east-1".
+// - Credentials: The credentials used to sign requests.
+// - Endpoint: An optional endpoint override, e.g. for LocalStack. Defaults to
+// https://secretsmanager.<region>.amazonaws.com.
+// - Client: An optional http.Client. Defaults to one with a 10 second timeout.
+type AWSSecretsManager struct {
+	Region      string
+	Credentials AWSCredentials
+	Endpoint    string
+	Client      *http.Client
+}
+
+// Secret returns the secret's value.
+func (p *AWSSecretsManager) Secret(ctx context.Context, name string) ([]byte, error) {
+	id, key, _ := strings.Cut(name, "#")
+
+	body, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + p.Region + ".amazonaws.com/"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+
+	signAWSRequest(req, body, p.Credentials, p.Region, "secretsmanager", time.Now())
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := doSecretRequest(p.Client, req, "secretsmanager", &out); err != nil {
+		return nil, err
+	}
+
+	value := []byte(out.SecretString)
+	if out.SecretString == "" && out.SecretBinary != "" {
+		if value, err = base64.StdEncoding.DecodeString(out.SecretBinary); err != nil {
+			return nil, err
+		}
+	}
+
+	if key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return nil, fmt.Errorf("secretsmanager: secret %s is not a JSON object", id)
+	}
+
+	return secretField(fields, name, key)
+}
+
+// doSecretRequest sends a request to a secret manager's API and decodes the JSON response into out. A 404 status
+// or an AWS ResourceNotFoundException is reported as ErrSecretNotFound.
+func doSecretRequest(client *http.Client, req *http.Request, service string, out interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type   string   `json:"__type"`
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+
+		if res.StatusCode == http.StatusNotFound || strings.HasSuffix(apiErr.Type, "ResourceNotFoundException") {
+			return fmt.Errorf("%w: %s", ErrSecretNotFound, req.URL.Redacted())
+		}
+
+		return fmt.Errorf("%s: status %d: %s%s", service, res.StatusCode, apiErr.Type, strings.Join(apiErr.Errors, "; "))
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// secretField returns a string field of a secret stored as a JSON object.
+func secretField(fields map[string]interface{}, name, key string) ([]byte, error) {
+	v, ok := fields[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+	}
+
+	if s, ok := v.(string); ok {
+		return []byte(s), nil
+	}
+
+	return json.Marshal(v)
+}
+
+// ChainSecrets asks each provider in turn, returning the first secret found, e.g. to read file secrets in
+// production and fall back to environment variables in development.
+type ChainSecrets []SecretProvider
+
+// Secret returns the secret from the first provider that has it.
+func (c ChainSecrets) Secret(ctx context.Context, name string) ([]byte, error) {
+	for _, p := range c {
+		v, err := p.Secret(ctx, name)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return v, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
+
+// LoadSecrets fills the fields of a configuration struct tagged with `secret:"name"` from a provider. Fields must
+// be strings or byte slices. Secrets are required unless the tag has the optional flag, e.g.
+// `secret:"sentry_dsn,optional"`.
+// Parameters:
+// - ctx: The context for the provider.
+// - p: The provider.
+// - dst: A pointer to the struct.
+// Returns an error naming the first secret that could not be loaded.
+func LoadSecrets(ctx context.Context, p SecretProvider, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("secrets: dst must be a pointer to a struct")
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+
+		tag, ok := field.Tag.Lookup("secret")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		name, flag, _ := strings.Cut(tag, ",")
+
+		value, err := p.Secret(ctx, name)
+		if errors.Is(err, ErrSecretNotFound) && flag == "optional" {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("secrets: %s: %w", name, err)
+		}
+
+		f := v.Field(i)
+		switch {
+		case f.Kind() == reflect.String:
+			f.SetString(string(value))
+		case f.Kind() == reflect.Slice && f.Type().Elem().Kind() == reflect.Uint8:
+			f.SetBytes(value)
+		default:
+			return fmt.Errorf("secrets: field %s must be a string or []byte", field.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvSecrets(t *testing.T) {
+	t.Setenv("APP_DB_PASSWORD", "hunter2")
+	p := EnvSecrets{Prefix: "APP_"}
+
+	if v, err := p.Secret(context.Background(), "db_password"); err != nil || string(v) != "hunter2" {
+		t.Errorf("expected hunter2, got %q, %v", v, err)
+	}
+	if _, err := p.Secret(context.Background(), "missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestFileSecrets(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "api_key"), []byte("abc123\n"), 0o600)
+	p := FileSecrets{Dir: dir}
+
+	if v, err := p.Secret(context.Background(), "api_key"); err != nil || string(v) != "abc123" {
+		t.Errorf("expected abc123, got %q, %v", v, err)
+	}
+	if _, err := p.Secret(context.Background(), "missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+	if _, err := p.Secret(context.Background(), "../etc/passwd"); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("expected ErrUnsafePath, got %v", err)
+	}
+}
+
+func TestVaultSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/v1/kv/data/myapp/db" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"data":{"password":"s3cret","port":5432}}}`))
+	}))
+	defer server.Close()
+
+	p := &VaultSecrets{Address: server.URL, Token: "token", Mount: "kv"}
+
+	if v, err := p.Secret(context.Background(), "myapp/db#password"); err != nil || string(v) != "s3cret" {
+		t.Errorf("expected s3cret, got %q, %v", v, err)
+	}
+	if v, _ := p.Secret(context.Background(), "myapp/db#port"); string(v) != "5432" {
+		t.Errorf("expected 5432, got %q", v)
+	}
+	for _, name := range []string{"myapp/db#user", "other#password"} {
+		if _, err := p.Secret(context.Background(), name); !errors.Is(err, ErrSecretNotFound) {
+			t.Errorf("%s: expected ErrSecretNotFound, got %v", name, err)
+		}
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" || !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var in struct{ SecretId string }
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch in.SecretId {
+		case "prod/db":
+			_, _ = w.Write([]byte(`{"SecretString":"{\"password\":\"s3cret\"}"}`))
+		case "prod/key":
+			_, _ = w.Write([]byte(`{"SecretBinary":"AAEC"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	p := &AWSSecretsManager{Region: "us-east-1", Credentials: AWSCredentials{AccessKeyID: "id", SecretAccessKey: "secret"}, Endpoint: server.URL}
+
+	if v, err := p.Secret(context.Background(), "prod/db#password"); err != nil || string(v) != "s3cret" {
+		t.Errorf("expected s3cret, got %q, %v", v, err)
+	}
+	if v, err := p.Secret(context.Background(), "prod/key"); err != nil || string(v) != "\x00\x01\x02" {
+		t.Errorf("expected the binary secret, got %q, %v", v, err)
+	}
+	if _, err := p.Secret(context.Background(), "prod/missing"); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "db_password"), []byte("from-file\n"), 0o600)
+	t.Setenv("SIGNING_KEY", "from-env")
+
+	provider := ChainSecrets{FileSecrets{Dir: dir}, EnvSecrets{}}
+
+	var cfg struct {
+		DBPassword string `secret:"db_password"`
+		SigningKey []byte `secret:"signing_key"`
+		SentryDSN  string `secret:"sentry_dsn,optional"`
+		Port       int
+	}
+	if err := LoadSecrets(context.Background(), provider, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DBPassword != "from-file" || string(cfg.SigningKey) != "from-env" || cfg.SentryDSN != "" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	var required struct {
+		APIKey string `secret:"api_key"`
+	}
+	if err := LoadSecrets(context.Background(), provider, &required); !errors.Is(err, ErrSecretNotFound) {
+		t.Errorf("expected ErrSecretNotFound for a missing required secret, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ServeOptions configures Serve.
+// Fields:
+// - Addr: The address to listen on. Defaults to ":443" with ACME, else to the port in the PORT environment variable
+// set by Heroku, Cloud Run and similar platforms, else to ":8080".
+// - ACME: Serves HTTPS with certificates obtained and renewed automatically. A second server on HTTPAddr answers
+// the ACME challenges and redirects everything else to HTTPS.
+// - HTTPAddr: The address of the plain HTTP server used with ACME. Defaults to ":80", where ACME servers connect.
+// - ShutdownTimeout: How long in-flight requests may take to finish once ctx is done. Defaults to 10 seconds.
+// - Probes: If set, drained once ctx is done, so its readiness probe fails while the server keeps serving for
+// DrainDelay, giving Kubernetes time to stop routing requests to the pod before the server stops.
+// - DrainDelay: How long to keep serving after draining Probes. Defaults to 5 seconds with Probes, unless they were
+// already drained, e.g. by PreStopHandler.
+type ServeOptions struct {
+	Addr            string
+	ACME            *ACMEManager
+	HTTPAddr        string
+	ShutdownTimeout time.Duration
+	Probes          *Probes
+	DrainDelay      time.Duration
+}
+
+// Serve runs an HTTP server until ctx is done, then shuts it down gracefully, e.g. with a context from
+// ShutdownContext. With Probes set, the pod's readiness probe fails for DrainDelay before the server stops. If
+// Tools.UploadDrainer is set, the uploads in progress are drained first, within ShutdownTimeout, while new ones
+// are refused. With ACME set, it serves HTTPS with automatic certificates:
+//
+//	acme := &toolkit.ACMEManager{Hosts: []string{"example.com"}, Email: "ops@example.com", Cache: toolkit.NewLocalFileStore("/var/lib/app")}
+//	err := tools.Serve(ctx, mux, toolkit.ServeOptions{ACME: acme})
+//
+// Parameters:
+// - ctx: Stops the server when done.
+// - handler: The handler serving requests.
+// - opts: Optional ServeOptions. Only the first value is used if multiple are provided.
+// Returns nil after a graceful shutdown, or the error that stopped a server.
+func (t *Tools) Serve(ctx context.Context, handler http.Handler, opts ...ServeOptions) error {
+	var o ServeOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Addr == "" {
+		o.Addr = platformAddr("")
+		if o.ACME != nil {
+			o.Addr = ":443"
+		}
+	}
+	if o.HTTPAddr == "" {
+		o.HTTPAddr = ":80"
+	}
+	if o.ShutdownTimeout <= 0 {
+		o.ShutdownTimeout = 10 * time.Second
+	}
+
+	servers := []*http.Server{{Addr: o.Addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}}
+	if o.ACME != nil {
+		servers[0].TLSConfig = o.ACME.TLSConfig()
+		servers = append(servers, &http.Server{Addr: o.HTTPAddr, Handler: o.ACME.HTTPHandler(nil), ReadHeaderTimeout: 10 * time.Second})
+	}
+
+	errc := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, tls bool) {
+			if tls {
+				errc <- srv.ListenAndServeTLS("", "")
+			} else {
+				errc <- srv.ListenAndServe()
+			}
+		}(srv, i == 0 && o.ACME != nil)
+	}
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+	}
+
+	// keep serving until the pod is out of its Services, or requests still routed to it would be refused
+	if o.Probes != nil && err == nil && !o.Probes.Draining() {
+		o.Probes.Drain()
+		delay := o.DrainDelay
+		if delay <= 0 {
+			delay = 5 * time.Second
+		}
+		time.Sleep(delay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.ShutdownTimeout)
+	defer cancel()
+
+	// keep serving while uploads drain, so new ones get a 503 with Retry-After rather than a refused connection
+	if t.UploadDrainer != nil && err == nil {
+		_ = t.UploadDrainer.Drain(shutdownCtx)
+	}
+
+	for _, srv := range servers {
+		if shutdownErr := srv.Shutdown(shutdownCtx); err == nil {
+			err = shutdownErr
+		}
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,34 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTools_Serve(t *testing.T) {
+	var testTools Tools
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- testTools.Serve(ctx, http.NotFoundHandler(), ServeOptions{Addr: "127.0.0.1:0"})
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected a graceful shutdown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected Serve to return after ctx is done")
+	}
+
+	if err := testTools.Serve(context.Background(), http.NotFoundHandler(), ServeOptions{Addr: "127.0.0.1:-1"}); err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
@@ -0,0 +1,242 @@
+package toolkit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ContentMeta describes content served by ServeContentFrom.
+// Fields:
+// - Name: The content's name, used to detect the Content-Type from its extension when ContentType is empty,
+// e.g. "video.mp4".
+// - ContentType: The Content-Type. If empty, it is detected from Name, or else from the first bytes.
+// - ModTime: The last modification time, sent as Last-Modified and checked against If-Modified-Since. It is
+// omitted if zero.
+// - ETag: An entity tag including its quotes, e.g. `"v42"`, checked against If-None-Match and If-Range.
+// - CacheControl: If set, the Cache-Control header.
+// - DownloadName: If set, the content is served as an attachment, which the browser saves under this name.
+// Any characters are allowed; see ContentDisposition.
+// - Inline: Ask the browser to display the content, e.g. a PDF, rather than save it, keeping DownloadName as the
+// name used if the user saves it.
+type ContentMeta struct {
+	Name         string
+	ContentType  string
+	ModTime      time.Time
+	ETag         string
+	CacheControl string
+	DownloadName string
+	Inline       bool
+}
+
+// ServeContentFrom serves content with support for range requests and conditional requests, e.g. for large media
+// files. When content is an *os.File, the body is sent with sendfile where the platform supports it, so it is
+// never copied through userspace buffers, even through the toolkit's middleware.
+// Parameters:
+// - w: The http.ResponseWriter to write the response to.
+// - r: The request being answered.
+// - content: The content. Its size is found by seeking to the end.
+// - meta: Describes the content.
+func (t *Tools) ServeContentFrom(w http.ResponseWriter, r *http.Request, content io.ReadSeeker, meta ContentMeta) {
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	if meta.ETag != "" {
+		w.Header().Set("ETag", meta.ETag)
+	}
+	if meta.CacheControl != "" {
+		w.Header().Set("Cache-Control", meta.CacheControl)
+	}
+	if meta.DownloadName != "" {
+		disposition := "attachment"
+		if meta.Inline {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Disposition", ContentDisposition(disposition, meta.DownloadName))
+	}
+
+	http.ServeContent(w, r, meta.Name, meta.ModTime, content)
+}
+
+// ContentDisposition builds a Content-Disposition header value as RFC 6266 describes, e.g. for downloads served
+// without ServeContentFrom. The filename parameter holds an ASCII version of the name, with quotes and
+// backslashes escaped and non-ASCII characters replaced by "_", for old clients; names that are not plain ASCII are
+// also sent percent-encoded as UTF-8 in the filename* parameter of RFC 5987, which current browsers prefer.
+// Parameters:
+// - disposition: "attachment" or "inline".
+// - filename: The file name, e.g. "résumé \"final\".pdf". Control characters are removed.
+// Returns the header value, for example:
+//
+//	attachment; filename="r_sum_ \"final\".pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%20%22final%22.pdf
+func ContentDisposition(disposition, filename string) string {
+	filename = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, filename)
+	if filename == "" {
+		return disposition
+	}
+
+	var fallback strings.Builder
+	plain := true
+	for _, r := range filename {
+		switch {
+		case r > unicode.MaxASCII:
+			fallback.WriteByte('_')
+			plain = false
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	value := fmt.Sprintf("%s; filename=\"%s\"", disposition, fallback.String())
+	if plain {
+		return value
+	}
+
+	var encoded strings.Builder
+	for _, b := range []byte(filename) {
+		if isRFC5987AttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+
+	return value + "; filename*=UTF-8''" + encoded.String()
+}
+
+// isRFC5987AttrChar reports whether b may appear unencoded in an RFC 5987 value.
+func isRFC5987AttrChar(b byte) bool {
+	return (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') || (b >= '0' && b <= '9') || strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+// DownloadOptions holds per-call options for DownloadStaticFile.
+// Fields:
+// - Inline: Ask the browser to display the file, e.g. a PDF or an image, rather than save it.
+type DownloadOptions struct {
+	Inline bool
+}
+
+// activeContentTypes are types browsers run scripts in, which must not be served from user uploads.
+var activeContentTypes = map[string]bool{
+	"text/html":                     true,
+	"application/xhtml+xml":         true,
+	"image/svg+xml":                 true,
+	"text/xml":                      true,
+	"application/xml":               true,
+	"text/javascript":               true,
+	"application/javascript":        true,
+	"application/x-shockwave-flash": true,
+}
+
+// downloadContentType returns the Content-Type the download helpers serve a file with: the one set for its
+// extension in ContentTypes, else the system's type for the extension. With StrictContentTypes, unknown and
+// active types become application/octet-stream. An empty result lets the type be sniffed from the content.
+func (t *Tools) downloadContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ct, ok := t.ContentTypes[ext]; ok {
+		return ct
+	}
+
+	ct := mime.TypeByExtension(ext)
+	if t.StrictContentTypes {
+		mediaType, _, _ := mime.ParseMediaType(ct)
+		if ct == "" || activeContentTypes[mediaType] {
+			return "application/octet-stream"
+		}
+	}
+
+	return ct
+}
+
+// serveAttachment serves the file at filePath as a download named displayName, with its Content-Type from
+// downloadContentType.
+func (t *Tools) serveAttachment(w http.ResponseWriter, r *http.Request, filePath, displayName string, o DownloadOptions) {
+	f, info, ok := openServedFile(w, r, filePath)
+	if !ok {
+		return
+	}
+	defer f.Close()
+
+	t.serveOpenAttachment(w, r, f, info, filePath, displayName, o)
+}
+
+// openServedFile opens the regular file at filePath for serving. If it cannot, the failure is answered as
+// http.ServeFile does and false is returned.
+func openServedFile(w http.ResponseWriter, r *http.Request, filePath string) (*os.File, fs.FileInfo, bool) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		writeFileError(w, r, err)
+		return nil, nil, false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		writeFileError(w, r, err)
+		return nil, nil, false
+	}
+	if info.IsDir() {
+		f.Close()
+		http.NotFound(w, r)
+		return nil, nil, false
+	}
+
+	return f, info, true
+}
+
+// serveOpenAttachment serves f, opened from filePath, as serveAttachment does.
+func (t *Tools) serveOpenAttachment(w http.ResponseWriter, r *http.Request, f *os.File, info fs.FileInfo, filePath, displayName string, o DownloadOptions) {
+	meta := ContentMeta{
+		Name:         filepath.Base(filePath),
+		ContentType:  t.downloadContentType(filePath),
+		ModTime:      info.ModTime(),
+		DownloadName: displayName,
+		Inline:       o.Inline,
+	}
+	if meta.ContentType == "application/octet-stream" {
+		// forced binary downloads are never displayed
+		meta.Inline = false
+	}
+	if meta.ContentType != "" {
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+
+	t.ServeContentFrom(w, r, f, meta)
+}
+
+// writeFileError answers a failure to open a file as http.ServeFile does: 404, 403 or 500.
+func writeFileError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// readFrom copies src to w through w's ReadFrom when it has one, which net/http implements with sendfile for
+// files. Response writer wrappers use it so they do not hide that path.
+func readFrom(w io.Writer, src io.Reader) (int64, error) {
+	if rf, ok := w.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+
+	return copyBuffered(w, src)
+}
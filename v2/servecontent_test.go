@@ -0,0 +1,178 @@
+package toolkit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_ServeContentFrom(t *testing.T) {
+	var testTools Tools
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	meta := ContentMeta{Name: "clip.txt", ModTime: modTime, ETag: `"v1"`, CacheControl: "private", DownloadName: "clip.txt"}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/clip", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	testTools.ServeContentFrom(rr, req, strings.NewReader("0123456789"), meta)
+
+	if rr.Code != http.StatusPartialContent || rr.Body.String() != "2345" {
+		t.Errorf("expected 206 with 2345, got %d with %q", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected Content-Type to be detected from the name, got %s", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); cd != `attachment; filename="clip.txt"` {
+		t.Errorf("unexpected Content-Disposition %s", cd)
+	}
+	if cc := rr.Header().Get("Cache-Control"); cc != "private" {
+		t.Errorf("expected Cache-Control private, got %s", cc)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/clip", nil)
+	req.Header.Set("If-None-Match", `"v1"`)
+	testTools.ServeContentFrom(rr, req, strings.NewReader("0123456789"), meta)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rr.Code)
+	}
+}
+
+var contentDispositionTests = []struct {
+	name        string
+	disposition string
+	filename    string
+	expected    string
+}{
+	{name: "ascii", disposition: "attachment", filename: "report.pdf", expected: `attachment; filename="report.pdf"`},
+	{name: "inline", disposition: "inline", filename: "report.pdf", expected: `inline; filename="report.pdf"`},
+	{name: "quotes", disposition: "attachment", filename: `a "b" \c.txt`, expected: `attachment; filename="a \"b\" \\c.txt"`},
+	{name: "utf-8", disposition: "attachment", filename: "résumé.pdf", expected: `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+	{name: "utf-8 with specials", disposition: "attachment", filename: "日本 \"x\";.txt", expected: `attachment; filename="__ \"x\";.txt"; filename*=UTF-8''%E6%97%A5%E6%9C%AC%20%22x%22%3B.txt`},
+	{name: "header injection", disposition: "attachment", filename: "a\r\nSet-Cookie: x.txt", expected: `attachment; filename="aSet-Cookie: x.txt"`},
+	{name: "empty", disposition: "attachment", filename: "", expected: "attachment"},
+}
+
+func TestContentDisposition(t *testing.T) {
+	for _, e := range contentDispositionTests {
+		if got := ContentDisposition(e.disposition, e.filename); got != e.expected {
+			t.Errorf("%s: expected %s, got %s", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_DownloadStaticFileInline(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil), "./testdata", "pic.jpg", "chiot mignon ☺.jpg", DownloadOptions{Inline: true})
+
+	want := `inline; filename="chiot mignon _.jpg"; filename*=UTF-8''chiot%20mignon%20%E2%98%BA.jpg`
+	if got := rr.Header().Get("Content-Disposition"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+var downloadContentTypeTests = []struct {
+	name     string
+	file     string
+	strict   bool
+	expected string
+}{
+	{name: "system type", file: "a.png", expected: "image/png"},
+	{name: "override", file: "README.MD", expected: "text/markdown; charset=utf-8"},
+	{name: "override wins when strict", file: "a.md", strict: true, expected: "text/markdown; charset=utf-8"},
+	{name: "html", file: "a.html", expected: "text/html; charset=utf-8"},
+	{name: "html when strict", file: "a.html", strict: true, expected: "application/octet-stream"},
+	{name: "svg when strict", file: "a.svg", strict: true, expected: "application/octet-stream"},
+	{name: "unknown", file: "a.unknownext", expected: ""},
+	{name: "unknown when strict", file: "a.unknownext", strict: true, expected: "application/octet-stream"},
+}
+
+func TestTools_DownloadContentType(t *testing.T) {
+	for _, e := range downloadContentTypeTests {
+		testTools := Tools{ContentTypes: map[string]string{".md": "text/markdown; charset=utf-8"}, StrictContentTypes: e.strict}
+
+		if got := testTools.downloadContentType(e.file); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_DownloadStaticFileStrict(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "avatar.html"), []byte("<script>alert(1)</script>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	testTools := Tools{StrictContentTypes: true}
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil), dir, "avatar.html", "avatar.html", DownloadOptions{Inline: true})
+
+	if ct := rr.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("expected application/octet-stream, got %s", ct)
+	}
+	if cd := rr.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("expected an attachment, got %s", cd)
+	}
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("expected nosniff")
+	}
+}
+
+func TestTools_DownloadStaticFileDirectory(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil), ".", "testdata", "testdata")
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a directory, got %d", rr.Code)
+	}
+}
+
+// readFromRecorder is a ResponseRecorder that records whether ReadFrom was used.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (rec *readFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	rec.readFrom = true
+	return io.Copy(rec.ResponseRecorder, src)
+}
+
+func TestStatusWriter_ReadFrom(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.bin")
+	content := bytes.Repeat([]byte("x"), 64<<10)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rec := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	sw := newStatusWriter(&versionWriter{ResponseWriter: rec, version: "v1"})
+
+	var testTools Tools
+	testTools.ServeContentFrom(sw, httptest.NewRequest(http.MethodGet, "/", nil), f, ContentMeta{Name: "big.bin"})
+
+	if !rec.readFrom {
+		t.Error("expected the file to reach the underlying writer's ReadFrom")
+	}
+	if sw.written != int64(len(content)) || rec.Body.Len() != len(content) {
+		t.Errorf("expected %d bytes, recorded %d and wrote %d", len(content), sw.written, rec.Body.Len())
+	}
+}
@@ -0,0 +1,571 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+	"time"
+)
+
+// SFTP packet types, from version 3 of the protocol (draft-ietf-secsh-filexfer-02), the one every server speaks.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpStat     = 17
+	sftpRename   = 18
+	sftpExtended = 200
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+)
+
+// SFTP open flags, status codes and attribute flags.
+const (
+	sftpFlagRead  = 0x01
+	sftpFlagWrite = 0x02
+	sftpFlagCreat = 0x08
+	sftpFlagTrunc = 0x10
+
+	sftpStatusOK             = 0
+	sftpStatusEOF            = 1
+	sftpStatusNoSuchFile     = 2
+	sftpStatusNoConnection   = 6
+	sftpStatusConnectionLost = 7
+
+	sftpAttrSize        = 0x01
+	sftpAttrUIDGID      = 0x02
+	sftpAttrPermissions = 0x04
+	sftpAttrACModTime   = 0x08
+	sftpAttrExtended    = 0x80000000
+)
+
+// sftpChunkSize is the most bytes read or written per request, which all servers accept.
+const sftpChunkSize = 32 << 10
+
+// sftpMaxPacket bounds the size of a reply, so a broken server cannot make the client allocate without limit.
+const sftpMaxPacket = 1 << 20
+
+// SFTPError is a status reply from an SFTP server.
+type SFTPError struct {
+	Code    uint32
+	Message string
+}
+
+// Error returns the status code and message.
+func (e *SFTPError) Error() string {
+	return fmt.Sprintf("sftp: %s (status %d)", e.Message, e.Code)
+}
+
+// Temporary reports whether the server lost its connection, so the operation can be retried on a new session.
+func (e *SFTPError) Temporary() bool {
+	return e.Code == sftpStatusNoConnection || e.Code == sftpStatusConnectionLost
+}
+
+// Is makes SSH_FX_NO_SUCH_FILE replies match fs.ErrNotExist.
+func (e *SFTPError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.Code == sftpStatusNoSuchFile
+}
+
+// SFTPDialer opens the channel of an SFTP session: an SSH session running the "sftp" subsystem, whose standard
+// input and output are read and written by the client. Closing the channel ends the SSH session. The toolkit has no
+// SSH client of its own, since SSH needs cryptography outside the standard library; with golang.org/x/crypto/ssh,
+// a dialer connects with ssh.Dial, opens a session, calls RequestSubsystem("sftp") and returns its StdoutPipe and
+// StdinPipe, closing the client with the channel.
+type SFTPDialer func(ctx context.Context) (io.ReadWriteCloser, error)
+
+// sftpConn is an SFTP session implementing RemoteFS. Requests are sent one at a time.
+type sftpConn struct {
+	mu          sync.Mutex
+	ch          io.ReadWriteCloser
+	nextID      uint32
+	posixRename bool
+}
+
+// NewSFTPSession starts an SFTP session on an open channel, negotiating version 3 of the protocol.
+// Parameters:
+// - ctx: The context for the negotiation. The channel is closed if it ends first.
+// - ch: The channel, e.g. from an SFTPDialer.
+// Returns the session, or an error if the server does not answer as an SFTP server.
+func NewSFTPSession(ctx context.Context, ch io.ReadWriteCloser) (RemoteFS, error) {
+	c := &sftpConn{ch: ch}
+
+	stop := context.AfterFunc(ctx, func() { ch.Close() })
+	defer stop()
+
+	var init sftpPacket
+	init.u32(3)
+	if err := c.writePacket(sftpInit, init); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	typ, d, err := c.readPacket()
+	if err == nil && typ != sftpVersion {
+		err = fmt.Errorf("sftp: expected a version reply, got packet type %d", typ)
+	}
+	if err != nil {
+		ch.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	if version := d.u32(); version < 3 {
+		ch.Close()
+		return nil, fmt.Errorf("sftp: unsupported protocol version %d", version)
+	}
+	for d.len() > 0 {
+		name, data := d.str(), d.str()
+		if name == "posix-rename@openssh.com" && data == "1" {
+			c.posixRename = true
+		}
+	}
+
+	return c, nil
+}
+
+// NewSFTPStore returns a RemoteStore on an SFTP server, opening each session on a channel from dial.
+// Parameters:
+// - dial: Opens the channel of a session, typically an SSH session running the "sftp" subsystem.
+// - root: The remote directory holding the files.
+// Returns the store.
+func NewSFTPStore(dial SFTPDialer, root string) *RemoteStore {
+	return &RemoteStore{
+		Dial: func(ctx context.Context) (RemoteFS, error) {
+			ch, err := dial(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return NewSFTPSession(ctx, ch)
+		},
+		Root: root,
+	}
+}
+
+// sftpPacket builds the payload of a packet.
+type sftpPacket []byte
+
+func (p *sftpPacket) u32(v uint32) { *p = binary.BigEndian.AppendUint32(*p, v) }
+func (p *sftpPacket) u64(v uint64) { *p = binary.BigEndian.AppendUint64(*p, v) }
+
+// str appends a length-prefixed string.
+func (p *sftpPacket) str(s string) {
+	p.u32(uint32(len(s)))
+	*p = append(*p, s...)
+}
+
+// sftpDecoder reads the fields of a packet, remembering the first field missing from it.
+type sftpDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *sftpDecoder) len() int { return len(d.b) }
+
+// take returns the next n bytes, or nil once the packet is exhausted.
+func (d *sftpDecoder) take(n int) []byte {
+	if d.err != nil || n < 0 || n > len(d.b) {
+		d.err = errors.New("sftp: truncated packet")
+		d.b = nil
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *sftpDecoder) u32() uint32 {
+	if b := d.take(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *sftpDecoder) u64() uint64 {
+	if b := d.take(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// str reads a length-prefixed string.
+func (d *sftpDecoder) str() string {
+	return string(d.take(int(d.u32())))
+}
+
+// attrs reads file attributes into a file info named name.
+func (d *sftpDecoder) attrs(name string) *sftpFileInfo {
+	info := &sftpFileInfo{name: name}
+
+	flags := d.u32()
+	if flags&sftpAttrSize != 0 {
+		info.size = int64(d.u64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		d.u32()
+		d.u32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		info.perm = d.u32()
+	}
+	if flags&sftpAttrACModTime != 0 {
+		d.u32()
+		info.modTime = time.Unix(int64(d.u32()), 0)
+	}
+	if flags&sftpAttrExtended != 0 {
+		for n := d.u32(); n > 0 && d.err == nil; n-- {
+			d.str()
+			d.str()
+		}
+	}
+
+	return info
+}
+
+// writePacket sends a packet of type typ.
+func (c *sftpConn) writePacket(typ byte, payload sftpPacket) error {
+	buf := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(payload)))
+	buf[4] = typ
+
+	_, err := c.ch.Write(append(buf, payload...))
+	return err
+}
+
+// readPacket reads a packet, returning its type and a decoder of the rest.
+func (c *sftpConn) readPacket() (byte, *sftpDecoder, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.ch, header[:]); err != nil {
+		return 0, nil, err
+	}
+
+	n := binary.BigEndian.Uint32(header[:4])
+	if n < 1 || n > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", n)
+	}
+
+	body := make([]byte, n-1)
+	if _, err := io.ReadFull(c.ch, body); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, err
+	}
+
+	return header[4], &sftpDecoder{b: body}, nil
+}
+
+// call sends a request and reads its reply, returning an *SFTPError for a status other than OK. want is the
+// expected reply type; a request answered by a status alone passes sftpStatus.
+func (c *sftpConn) call(typ byte, want byte, fields sftpPacket) (*sftpDecoder, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+
+	var payload sftpPacket
+	payload.u32(id)
+	payload = append(payload, fields...)
+	if err := c.writePacket(typ, payload); err != nil {
+		return nil, err
+	}
+
+	replyType, d, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+	if replyID := d.u32(); replyID != id {
+		return nil, fmt.Errorf("sftp: reply to request %d, expected %d", replyID, id)
+	}
+
+	if replyType == sftpStatus {
+		code, msg := d.u32(), d.str()
+		if code != sftpStatusOK {
+			return nil, &SFTPError{Code: code, Message: msg}
+		}
+		if want != sftpStatus {
+			return nil, fmt.Errorf("sftp: expected packet type %d, got an OK status", want)
+		}
+		return d, nil
+	}
+	if replyType != want {
+		return nil, fmt.Errorf("sftp: expected packet type %d, got %d", want, replyType)
+	}
+
+	return d, d.err
+}
+
+// open opens a file with the given flags, returning its handle.
+func (c *sftpConn) open(name string, flags uint32) (string, error) {
+	var p sftpPacket
+	p.str(name)
+	p.u32(flags)
+	p.u32(0)
+
+	d, err := c.call(sftpOpen, sftpHandle, p)
+	if err != nil {
+		return "", err
+	}
+
+	return d.str(), d.err
+}
+
+// closeHandle closes a file or directory handle.
+func (c *sftpConn) closeHandle(handle string) error {
+	var p sftpPacket
+	p.str(handle)
+
+	_, err := c.call(sftpClose, sftpStatus, p)
+	return err
+}
+
+// sftpFile is an open remote file, read or written sequentially.
+type sftpFile struct {
+	c      *sftpConn
+	handle string
+	offset uint64
+}
+
+// Read reads the next chunk of the file.
+func (f *sftpFile) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	var p sftpPacket
+	p.str(f.handle)
+	p.u64(f.offset)
+	p.u32(uint32(min(len(b), sftpChunkSize)))
+
+	d, err := f.c.call(sftpRead, sftpData, p)
+	var sftpErr *SFTPError
+	if errors.As(err, &sftpErr) && sftpErr.Code == sftpStatusEOF {
+		return 0, io.EOF
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	data := d.take(int(d.u32()))
+	if d.err != nil {
+		return 0, d.err
+	}
+	n := copy(b, data)
+	f.offset += uint64(n)
+
+	return n, nil
+}
+
+// Write writes b at the end of what was written, in chunks the server accepts.
+func (f *sftpFile) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written:min(len(b), written+sftpChunkSize)]
+
+		var p sftpPacket
+		p.str(f.handle)
+		p.u64(f.offset)
+		p.str(string(chunk))
+
+		if _, err := f.c.call(sftpWrite, sftpStatus, p); err != nil {
+			return written, err
+		}
+		f.offset += uint64(len(chunk))
+		written += len(chunk)
+	}
+
+	return written, nil
+}
+
+// Close closes the file. An upload is complete once it returns.
+func (f *sftpFile) Close() error {
+	return f.c.closeHandle(f.handle)
+}
+
+// Open opens a file for reading.
+func (c *sftpConn) Open(name string) (io.ReadCloser, error) {
+	handle, err := c.open(name, sftpFlagRead)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpFile{c: c, handle: handle}, nil
+}
+
+// Create creates or truncates a file for writing.
+func (c *sftpConn) Create(name string) (io.WriteCloser, error) {
+	handle, err := c.open(name, sftpFlagWrite|sftpFlagCreat|sftpFlagTrunc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpFile{c: c, handle: handle}, nil
+}
+
+// Rename moves a file, replacing the target. Servers without the posix-rename@openssh.com extension refuse to
+// replace a file, so the target is removed first, which is not atomic.
+func (c *sftpConn) Rename(oldName, newName string) error {
+	var p sftpPacket
+	if c.posixRename {
+		p.str("posix-rename@openssh.com")
+		p.str(oldName)
+		p.str(newName)
+		_, err := c.call(sftpExtended, sftpStatus, p)
+		return err
+	}
+
+	p.str(oldName)
+	p.str(newName)
+	_, err := c.call(sftpRename, sftpStatus, p)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := c.Stat(newName); statErr != nil {
+		return err
+	}
+	if err := c.Remove(newName); err != nil {
+		return err
+	}
+
+	_, err = c.call(sftpRename, sftpStatus, p)
+	return err
+}
+
+// Remove deletes a file.
+func (c *sftpConn) Remove(name string) error {
+	var p sftpPacket
+	p.str(name)
+
+	_, err := c.call(sftpRemove, sftpStatus, p)
+	return err
+}
+
+// MkdirAll creates a directory and its parents, ignoring those that exist.
+func (c *sftpConn) MkdirAll(dir string) error {
+	dir = path.Clean(dir)
+	if dir == "." || dir == "/" {
+		return nil
+	}
+
+	if info, err := c.Stat(dir); err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("sftp: %s is not a directory", dir)
+		}
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := c.MkdirAll(path.Dir(dir)); err != nil {
+		return err
+	}
+
+	var p sftpPacket
+	p.str(dir)
+	p.u32(0)
+	_, err := c.call(sftpMkdir, sftpStatus, p)
+	return err
+}
+
+// ReadDir lists a directory.
+func (c *sftpConn) ReadDir(dir string) ([]fs.FileInfo, error) {
+	var p sftpPacket
+	p.str(dir)
+
+	d, err := c.call(sftpOpendir, sftpHandle, p)
+	if err != nil {
+		return nil, err
+	}
+	handle := d.str()
+
+	var infos []fs.FileInfo
+	for {
+		var p sftpPacket
+		p.str(handle)
+
+		d, err := c.call(sftpReaddir, sftpName, p)
+		var sftpErr *SFTPError
+		if errors.As(err, &sftpErr) && sftpErr.Code == sftpStatusEOF {
+			break
+		}
+		if err != nil {
+			_ = c.closeHandle(handle)
+			return nil, err
+		}
+
+		for n := d.u32(); n > 0 && d.err == nil; n-- {
+			name := d.str()
+			d.str() // the ls -l style long name
+			info := d.attrs(name)
+			if name != "." && name != ".." {
+				infos = append(infos, info)
+			}
+		}
+		if d.err != nil {
+			_ = c.closeHandle(handle)
+			return nil, d.err
+		}
+	}
+
+	return infos, c.closeHandle(handle)
+}
+
+// Stat describes a file, following symbolic links.
+func (c *sftpConn) Stat(name string) (fs.FileInfo, error) {
+	var p sftpPacket
+	p.str(name)
+
+	d, err := c.call(sftpStat, sftpAttrs, p)
+	if err != nil {
+		return nil, err
+	}
+
+	info := d.attrs(path.Base(name))
+	return info, d.err
+}
+
+// Close ends the session.
+func (c *sftpConn) Close() error {
+	return c.ch.Close()
+}
+
+// sftpFileInfo is a file described by an SFTP server.
+type sftpFileInfo struct {
+	name    string
+	size    int64
+	perm    uint32
+	modTime time.Time
+}
+
+func (i *sftpFileInfo) Name() string       { return i.name }
+func (i *sftpFileInfo) Size() int64        { return i.size }
+func (i *sftpFileInfo) ModTime() time.Time { return i.modTime }
+func (i *sftpFileInfo) IsDir() bool        { return i.perm&0o170000 == 0o040000 }
+func (i *sftpFileInfo) Sys() interface{}   { return nil }
+
+// Mode returns the permission bits, with the directory bit set for directories.
+func (i *sftpFileInfo) Mode() fs.FileMode {
+	mode := fs.FileMode(i.perm & 0o777)
+	if i.IsDir() {
+		mode |= fs.ModeDir
+	}
+
+	return mode
+}
@@ -0,0 +1,326 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSFTPServer serves version 3 of the SFTP protocol from a local directory, as the "sftp" subsystem of an SSH
+// server would.
+type fakeSFTPServer struct {
+	root        string
+	posixRename bool
+
+	mu    sync.Mutex
+	dials int
+	conns []net.Conn
+}
+
+func newFakeSFTPServer(t *testing.T, posixRename bool) *fakeSFTPServer {
+	s := &fakeSFTPServer{root: t.TempDir(), posixRename: posixRename}
+	t.Cleanup(s.dropConnections)
+	return s
+}
+
+// dial is an SFTPDialer connected to the server through a pipe.
+func (s *fakeSFTPServer) dial(context.Context) (io.ReadWriteCloser, error) {
+	client, server := net.Pipe()
+
+	s.mu.Lock()
+	s.dials++
+	s.conns = append(s.conns, server)
+	s.mu.Unlock()
+
+	go s.serve(server)
+	return client, nil
+}
+
+// dropConnections closes every session, as a dropped network connection would.
+func (s *fakeSFTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeSFTPServer) local(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+name)))
+}
+
+func (s *fakeSFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	c := &sftpConn{ch: conn}
+
+	files := map[string]*os.File{}
+	dirs := map[string][]os.DirEntry{}
+	nextHandle := 0
+
+	for {
+		typ, d, err := c.readPacket()
+		if err != nil {
+			return
+		}
+
+		if typ == sftpInit {
+			var p sftpPacket
+			p.u32(3)
+			if s.posixRename {
+				p.str("posix-rename@openssh.com")
+				p.str("1")
+			}
+			_ = c.writePacket(sftpVersion, p)
+			continue
+		}
+
+		id := d.u32()
+		reply := func(typ byte, fields sftpPacket) {
+			var p sftpPacket
+			p.u32(id)
+			_ = c.writePacket(typ, append(p, fields...))
+		}
+		status := func(err error) {
+			var p sftpPacket
+			switch {
+			case err == nil:
+				p.u32(sftpStatusOK)
+			case errors.Is(err, io.EOF):
+				p.u32(sftpStatusEOF)
+			case errors.Is(err, fs.ErrNotExist):
+				p.u32(sftpStatusNoSuchFile)
+			default:
+				p.u32(4)
+			}
+			msg := "ok"
+			if err != nil {
+				msg = err.Error()
+			}
+			p.str(msg)
+			p.str("en")
+			reply(sftpStatus, p)
+		}
+		attrs := func(info fs.FileInfo) sftpPacket {
+			var p sftpPacket
+			p.u32(sftpAttrSize | sftpAttrPermissions | sftpAttrACModTime)
+			p.u64(uint64(info.Size()))
+			perm := uint32(info.Mode().Perm())
+			if info.IsDir() {
+				perm |= 0o040000
+			} else {
+				perm |= 0o100000
+			}
+			p.u32(perm)
+			p.u32(uint32(info.ModTime().Unix()))
+			p.u32(uint32(info.ModTime().Unix()))
+			return p
+		}
+		newHandle := func() string {
+			nextHandle++
+			return strconv.Itoa(nextHandle)
+		}
+
+		switch typ {
+		case sftpOpen:
+			name, flags := d.str(), d.u32()
+			mode := os.O_RDONLY
+			if flags&sftpFlagWrite != 0 {
+				mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(s.local(name), mode, 0o644)
+			if err != nil {
+				status(err)
+				continue
+			}
+			handle := newHandle()
+			files[handle] = f
+			var p sftpPacket
+			p.str(handle)
+			reply(sftpHandle, p)
+		case sftpClose:
+			handle := d.str()
+			if f, ok := files[handle]; ok {
+				delete(files, handle)
+				status(f.Close())
+			} else {
+				delete(dirs, handle)
+				status(nil)
+			}
+		case sftpRead:
+			f, offset, n := files[d.str()], d.u64(), d.u32()
+			buf := make([]byte, n)
+			read, err := f.ReadAt(buf, int64(offset))
+			if read == 0 {
+				status(err)
+				continue
+			}
+			var p sftpPacket
+			p.str(string(buf[:read]))
+			reply(sftpData, p)
+		case sftpWrite:
+			f, offset, data := files[d.str()], d.u64(), d.str()
+			_, err := f.WriteAt([]byte(data), int64(offset))
+			status(err)
+		case sftpStat:
+			info, err := os.Stat(s.local(d.str()))
+			if err != nil {
+				status(err)
+				continue
+			}
+			reply(sftpAttrs, attrs(info))
+		case sftpOpendir:
+			entries, err := os.ReadDir(s.local(d.str()))
+			if err != nil {
+				status(err)
+				continue
+			}
+			handle := newHandle()
+			dirs[handle] = entries
+			var p sftpPacket
+			p.str(handle)
+			reply(sftpHandle, p)
+		case sftpReaddir:
+			handle := d.str()
+			entries := dirs[handle]
+			if len(entries) == 0 {
+				status(io.EOF)
+				continue
+			}
+			// two entries at a time, to exercise reading a listing in several replies
+			batch := entries[:min(2, len(entries))]
+			dirs[handle] = entries[len(batch):]
+			var p sftpPacket
+			p.u32(uint32(len(batch)))
+			for _, entry := range batch {
+				info, _ := entry.Info()
+				p.str(entry.Name())
+				p.str(entry.Name())
+				p = append(p, attrs(info)...)
+			}
+			reply(sftpName, p)
+		case sftpRemove:
+			status(os.Remove(s.local(d.str())))
+		case sftpMkdir:
+			status(os.Mkdir(s.local(d.str()), 0o755))
+		case sftpRename:
+			oldName, newName := s.local(d.str()), s.local(d.str())
+			if _, err := os.Stat(newName); err == nil {
+				status(errors.New("file already exists"))
+				continue
+			}
+			status(os.Rename(oldName, newName))
+		case sftpExtended:
+			if d.str() != "posix-rename@openssh.com" || !s.posixRename {
+				status(errors.New("unsupported"))
+				continue
+			}
+			status(os.Rename(s.local(d.str()), s.local(d.str())))
+		default:
+			status(errors.New("unsupported"))
+		}
+	}
+}
+
+func TestNewSFTPStore(t *testing.T) {
+	for _, posixRename := range []bool{true, false} {
+		server := newFakeSFTPServer(t, posixRename)
+		store := NewSFTPStore(server.dial, "/srv/uploads")
+		ctx := context.Background()
+
+		large := strings.Repeat("0123456789", 10000)
+		if err := store.Save(ctx, "docs/plan.txt", strings.NewReader(large)); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Save(ctx, "docs/plan.txt", strings.NewReader("the new plan")); err != nil {
+			t.Fatalf("posix-rename %v: expected an existing file replaced, got %v", posixRename, err)
+		}
+		for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+			if err := store.Save(ctx, "docs/"+name, strings.NewReader(name)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		f, err := store.Open(ctx, "docs/plan.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != "the new plan" {
+			t.Errorf("posix-rename %v: expected the new content, got %d bytes", posixRename, len(data))
+		}
+
+		entries, _ := os.ReadDir(filepath.Join(server.root, "srv", "uploads", "docs"))
+		if len(entries) != 4 {
+			t.Errorf("posix-rename %v: expected 4 files and no temporary ones, got %d", posixRename, len(entries))
+		}
+
+		if err := store.Delete(ctx, "docs/plan.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Open(ctx, "docs/plan.txt"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected a deleted file to be missing, got %v", err)
+		}
+
+		trashed, err := store.Trash(ctx)
+		if err != nil || len(trashed) != 1 {
+			t.Fatalf("expected the file listed in the trash, got %v (%v)", trashed, err)
+		}
+		if _, err := store.Restore(ctx, trashed[0].ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if server.dials != 1 {
+			t.Errorf("expected one pooled session, got %d dials", server.dials)
+		}
+		_ = store.Close()
+	}
+}
+
+func TestNewSFTPStore_Reconnects(t *testing.T) {
+	server := newFakeSFTPServer(t, true)
+	store := NewSFTPStore(server.dial, "/srv")
+	ctx := context.Background()
+
+	if err := store.Save(ctx, "a.txt", strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	server.dropConnections()
+	if err := store.Save(ctx, "b.txt", strings.NewReader("b")); err != nil {
+		t.Fatalf("expected the upload retried on a new session, got %v", err)
+	}
+	if server.dials != 2 {
+		t.Errorf("expected a second session, got %d dials", server.dials)
+	}
+	_ = store.Close()
+}
+
+func TestNewSFTPSession(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		// an SSH server without the sftp subsystem answers with something else
+		_, _ = io.ReadFull(server, make([]byte, 9))
+		_, _ = server.Write([]byte("This service allows sftp connections only.\n"))
+		server.Close()
+	}()
+
+	if _, err := NewSFTPSession(context.Background(), client); err == nil {
+		t.Error("expected an error from a server not speaking SFTP")
+	}
+
+	err := error(&SFTPError{Code: sftpStatusNoSuchFile, Message: "No such file"})
+	if !errors.Is(err, fs.ErrNotExist) || !strings.Contains(err.Error(), "No such file") {
+		t.Errorf("expected a missing file to match fs.ErrNotExist, got %v", err)
+	}
+}
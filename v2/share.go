@@ -0,0 +1,266 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrShareNotFound is returned for unknown or revoked share links.
+	ErrShareNotFound = errors.New("share link not found")
+	// ErrShareExpired is returned for share links past their expiry time.
+	ErrShareExpired = errors.New("share link has expired")
+	// ErrShareExhausted is returned for share links whose downloads are used up.
+	ErrShareExhausted = errors.New("share link download limit reached")
+)
+
+// ShareLink is a temporary, token-backed link to a file.
+// Fields:
+// - Token: The unguessable token identifying the link.
+// - URL: The link URL, ShareBaseURL followed by the token.
+// - Path: The path of the shared file.
+// - ExpiresAt: When the link stops working.
+// - MaxDownloads: The number of downloads allowed, or 0 for unlimited.
+// - Downloads: The number of downloads so far.
+type ShareLink struct {
+	Token        string    `json:"token"`
+	URL          string    `json:"url"`
+	Path         string    `json:"path"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxDownloads int       `json:"max_downloads,omitempty"`
+	Downloads    int       `json:"downloads"`
+}
+
+// ShareStore persists share links.
+type ShareStore interface {
+	// Save stores a new link.
+	Save(ctx context.Context, link ShareLink) error
+	// Get returns the link for token, or ErrShareNotFound.
+	Get(ctx context.Context, token string) (*ShareLink, error)
+	// Claim atomically counts a download of the link, returning the updated link, or ErrShareNotFound,
+	// ErrShareExpired or ErrShareExhausted without counting.
+	Claim(ctx context.Context, token string, now time.Time) (*ShareLink, error)
+	// Delete removes the link. Deleting an unknown link is not an error.
+	Delete(ctx context.Context, token string) error
+}
+
+// MemoryShareStore is an in-process ShareStore. It is suitable for single-instance deployments and tests.
+type MemoryShareStore struct {
+	mu    sync.Mutex
+	links map[string]ShareLink
+}
+
+// Save stores a new link, dropping expired ones.
+func (s *MemoryShareStore) Save(_ context.Context, link ShareLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.links == nil {
+		s.links = make(map[string]ShareLink)
+	}
+
+	now := time.Now()
+	for token, l := range s.links {
+		if now.After(l.ExpiresAt) {
+			delete(s.links, token)
+		}
+	}
+
+	s.links[link.Token] = link
+
+	return nil
+}
+
+// Get returns the link for token.
+func (s *MemoryShareStore) Get(_ context.Context, token string) (*ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[token]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+
+	return &link, nil
+}
+
+// Claim counts a download of the link if it is still valid.
+func (s *MemoryShareStore) Claim(_ context.Context, token string, now time.Time) (*ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	link, ok := s.links[token]
+	if !ok {
+		return nil, ErrShareNotFound
+	}
+	if err := link.check(now); err != nil {
+		return nil, err
+	}
+
+	link.Downloads++
+	s.links[token] = link
+
+	return &link, nil
+}
+
+// Delete removes the link.
+func (s *MemoryShareStore) Delete(_ context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.links, token)
+
+	return nil
+}
+
+// check returns why the link cannot be downloaded at now, if it cannot.
+func (l ShareLink) check(now time.Time) error {
+	if now.After(l.ExpiresAt) {
+		return ErrShareExpired
+	}
+	if l.MaxDownloads > 0 && l.Downloads >= l.MaxDownloads {
+		return ErrShareExhausted
+	}
+
+	return nil
+}
+
+var (
+	defaultShareStore     ShareStore
+	defaultShareStoreOnce sync.Once
+)
+
+// shareStore returns t.ShareStore, or a process-wide MemoryShareStore if none is configured.
+func (t *Tools) shareStore() ShareStore {
+	if t.ShareStore != nil {
+		return t.ShareStore
+	}
+
+	defaultShareStoreOnce.Do(func() {
+		defaultShareStore = &MemoryShareStore{}
+	})
+
+	return defaultShareStore
+}
+
+// CreateShareLink creates a temporary link to a file, like a clipboard-style share, served by ShareHandler.
+// Parameters:
+// - ctx: The context of the request.
+// - pathName: The path of the file to share.
+// - ttl: How long the link works.
+// - maxDownloads: The number of downloads allowed, or 0 for unlimited.
+// Returns the link, or an error if the subject may not download the file, the file does not exist, or the link
+// cannot be stored.
+func (t *Tools) CreateShareLink(ctx context.Context, pathName string, ttl time.Duration, maxDownloads int) (*ShareLink, error) {
+	pathName, err := t.TenantPath(ctx, pathName)
+	if err != nil {
+		return nil, err
+	}
+
+	// only subjects allowed to download a file may share it
+	if err := t.authorize(ctx, FileDownload, pathName); err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(pathName)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, errors.New("cannot share a directory")
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	base := t.ShareBaseURL
+	if base == "" {
+		base = "/share/"
+	}
+
+	link := ShareLink{
+		Token:        token,
+		URL:          base + token,
+		Path:         pathName,
+		ExpiresAt:    time.Now().Add(ttl),
+		MaxDownloads: maxDownloads,
+	}
+
+	if err := t.shareStore().Save(ctx, link); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// RevokeShareLink disables a share link immediately.
+func (t *Tools) RevokeShareLink(ctx context.Context, token string) error {
+	return t.shareStore().Delete(ctx, token)
+}
+
+// ShareHandler serves files shared with CreateShareLink, taking the token from the last segment of the request
+// path, so it can be mounted at ShareBaseURL, e.g. mux.Handle("/share/", tools.ShareHandler()).
+// Unknown and revoked links get 404 Not Found, and expired or used up links get 410 Gone. A download is counted
+// once the file is opened and about to be served, so a missing file uses up nothing; HEAD requests are not counted,
+// while range requests for the rest of a file count as further downloads.
+// Holding the link is enough to download the file: Tools.Authorizer is not consulted.
+// Returns the handler.
+func (t *Tools) ShareHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := path.Base(r.URL.Path)
+		store := t.shareStore()
+
+		link, err := store.Get(r.Context(), token)
+		if err == nil {
+			err = link.check(time.Now())
+		}
+		if err != nil {
+			writeShareError(w, r, err)
+			return
+		}
+
+		// the token is the authorization, so the Authorizer is not consulted
+		f, info, ok := openServedFile(w, r, link.Path)
+		if !ok {
+			return
+		}
+		defer f.Close()
+
+		// the download is only counted once the file can be served, and a HEAD request downloads nothing
+		if r.Method != http.MethodHead {
+			if link, err = store.Claim(r.Context(), token, time.Now()); err != nil {
+				writeShareError(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		t.serveOpenAttachment(w, r, f, info, link.Path, filepath.Base(link.Path), DownloadOptions{})
+	}
+}
+
+// writeShareError answers a link that cannot be downloaded: 410 Gone if it expired or was used up, and 404 Not
+// Found if it is unknown or revoked.
+func writeShareError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrShareExpired), errors.Is(err, ErrShareExhausted):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, ErrShareNotFound):
+		http.NotFound(w, r)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,104 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTools_ShareLinks(t *testing.T) {
+	testTools := Tools{ShareStore: &MemoryShareStore{}, ShareBaseURL: "https://example.com/s/"}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	_ = os.WriteFile(path, []byte("shared content"), 0o644)
+
+	link, err := testTools.CreateShareLink(context.Background(), path, time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link.URL != "https://example.com/s/"+link.Token || len(link.Token) < 32 {
+		t.Errorf("unexpected link %+v", link)
+	}
+
+	handler := testTools.ShareHandler()
+	get := func(token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/s/"+token, nil))
+		return rr
+	}
+
+	for i := 0; i < 2; i++ {
+		rr := get(link.Token)
+		if rr.Code != http.StatusOK || rr.Body.String() != "shared content" {
+			t.Fatalf("download %d: expected the file, got %d %s", i+1, rr.Code, rr.Body.String())
+		}
+	}
+
+	if rr := get(link.Token); rr.Code != http.StatusGone {
+		t.Errorf("expected 410 once downloads are used up, got %d", rr.Code)
+	}
+
+	if rr := get("unknown"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown token, got %d", rr.Code)
+	}
+
+	expired, _ := testTools.CreateShareLink(context.Background(), path, -time.Second, 0)
+	if rr := get(expired.Token); rr.Code != http.StatusGone {
+		t.Errorf("expected 410 for expired link, got %d", rr.Code)
+	}
+
+	revoked, _ := testTools.CreateShareLink(context.Background(), path, time.Hour, 0)
+	if err := testTools.RevokeShareLink(context.Background(), revoked.Token); err != nil {
+		t.Fatal(err)
+	}
+	if rr := get(revoked.Token); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for revoked link, got %d", rr.Code)
+	}
+
+	if _, err := testTools.CreateShareLink(context.Background(), filepath.Join(t.TempDir(), "missing"), time.Hour, 0); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestTools_ShareHandlerCounting(t *testing.T) {
+	store := &MemoryShareStore{}
+	testTools := Tools{ShareStore: store}
+
+	path := filepath.Join(t.TempDir(), "report.txt")
+	_ = os.WriteFile(path, []byte("shared content"), 0o644)
+
+	link, err := testTools.CreateShareLink(context.Background(), path, time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := testTools.ShareHandler()
+	serve := func(method string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(method, "/s/"+link.Token, nil))
+		return rr
+	}
+
+	if rr := serve(http.MethodHead); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 for HEAD, got %d", rr.Code)
+	}
+
+	_ = os.Rename(path, path+".moved")
+	if rr := serve(http.MethodGet); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 while the file is missing, got %d", rr.Code)
+	}
+	_ = os.Rename(path+".moved", path)
+
+	if stored, _ := store.Get(context.Background(), link.Token); stored.Downloads != 0 {
+		t.Errorf("expected HEAD and failed opens not counted, got %d downloads", stored.Downloads)
+	}
+
+	if rr := serve(http.MethodGet); rr.Code != http.StatusOK || rr.Body.String() != "shared content" {
+		t.Errorf("expected the only download to be served, got %d %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidCookie is returned by SignedCookieValue for cookies that are missing, malformed or were tampered with.
+var ErrInvalidCookie = errors.New("cookie is missing or invalid")
+
+// SetSignedCookie sets a cookie whose value is signed with HMAC-SHA256, so it can be read back with
+// SignedCookieValue knowing the client did not change it. The value is not encrypted: the client can read it.
+// Parameters:
+// - w: The http.ResponseWriter to set the cookie on.
+// - cookie: The cookie. Its value may contain any characters; it is encoded before signing.
+// - secret: The signing key, at least 32 random bytes, shared by every instance of the application.
+func SetSignedCookie(w http.ResponseWriter, cookie *http.Cookie, secret []byte) {
+	setSignedCookie(w, cookie, func(data []byte) []byte {
+		return hmacSHA256(secret, data)
+	})
+}
+
+// SignedCookieValue returns the value of a cookie set with SetSignedCookie.
+// Parameters:
+// - r: The request carrying the cookie.
+// - name: The cookie's name. It is part of the signature, so a value cannot be moved to another cookie.
+// - secret: The signing key the cookie was set with.
+// Returns the value, or ErrInvalidCookie if the cookie is missing or its signature does not match.
+func SignedCookieValue(r *http.Request, name string, secret []byte) (string, error) {
+	return signedCookieValue(r, name, func(data, sig []byte) bool {
+		return hmac.Equal(sig, hmacSHA256(secret, data))
+	})
+}
+
+// SetSignedCookieWithKeyring sets a cookie like SetSignedCookie, signed with the keyring's active key.
+// Parameters:
+// - w: The http.ResponseWriter to set the cookie on.
+// - cookie: The cookie.
+// - kr: The keyring.
+func SetSignedCookieWithKeyring(w http.ResponseWriter, cookie *http.Cookie, kr *Keyring) {
+	setSignedCookie(w, cookie, kr.Sign)
+}
+
+// SignedCookieValueWithKeyring returns the value of a cookie set with SetSignedCookieWithKeyring and signed with
+// any key on the keyring, or set with SetSignedCookie using one of its keys, so cookies survive key rotation.
+// Parameters:
+// - r: The request carrying the cookie.
+// - name: The cookie's name.
+// - kr: The keyring.
+// Returns the value, or ErrInvalidCookie if the cookie is missing or its signature does not match.
+func SignedCookieValueWithKeyring(r *http.Request, name string, kr *Keyring) (string, error) {
+	return signedCookieValue(r, name, kr.Verify)
+}
+
+// setSignedCookie encodes a cookie's value and appends its signature.
+func setSignedCookie(w http.ResponseWriter, cookie *http.Cookie, sign func(data []byte) []byte) {
+	c := *cookie
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(cookie.Value))
+	c.Value = encoded + "." + base64.RawURLEncoding.EncodeToString(sign(cookieSigningInput(cookie.Name, encoded)))
+
+	http.SetCookie(w, &c)
+}
+
+// signedCookieValue checks a cookie's signature and decodes its value.
+func signedCookieValue(r *http.Request, name string, verify func(data, sig []byte) bool) (string, error) {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	encoded, sig, ok := strings.Cut(c.Value, ".")
+	if !ok {
+		return "", ErrInvalidCookie
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !verify(cookieSigningInput(name, encoded), mac) {
+		return "", ErrInvalidCookie
+	}
+
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidCookie
+	}
+
+	return string(value), nil
+}
+
+// cookieSigningInput returns the data a cookie's signature covers.
+func cookieSigningInput(name, encoded string) []byte {
+	return []byte(name + "=" + encoded)
+}
@@ -0,0 +1,43 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignedCookie(t *testing.T) {
+	secret := []byte("a-very-secret-key-for-testing-only")
+
+	rr := httptest.NewRecorder()
+	SetSignedCookie(rr, &http.Cookie{Name: "prefs", Value: `theme=dark; lang="pt-BR"`}, secret)
+	cookie := rr.Result().Cookies()[0]
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	if v, err := SignedCookieValue(req, "prefs", secret); err != nil || v != `theme=dark; lang="pt-BR"` {
+		t.Errorf("expected the value back, got %q, %v", v, err)
+	}
+
+	if _, err := SignedCookieValue(req, "prefs", []byte("another-secret-key-for-testing!!")); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("expected ErrInvalidCookie for another secret, got %v", err)
+	}
+
+	tampered := httptest.NewRequest(http.MethodGet, "/", nil)
+	tampered.AddCookie(&http.Cookie{Name: "prefs", Value: "eA" + cookie.Value[strings.Index(cookie.Value, "."):]})
+	if _, err := SignedCookieValue(tampered, "prefs", secret); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("expected ErrInvalidCookie for a tampered value, got %v", err)
+	}
+
+	moved := httptest.NewRequest(http.MethodGet, "/", nil)
+	moved.AddCookie(&http.Cookie{Name: "role", Value: cookie.Value})
+	if _, err := SignedCookieValue(moved, "role", secret); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("expected ErrInvalidCookie for a value moved to another cookie, got %v", err)
+	}
+
+	if _, err := SignedCookieValue(httptest.NewRequest(http.MethodGet, "/", nil), "prefs", secret); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("expected ErrInvalidCookie for a missing cookie, got %v", err)
+	}
+}
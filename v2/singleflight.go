@@ -0,0 +1,149 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FlightGroup coalesces concurrent calls with the same key into one execution whose result is shared. The zero
+// value is ready to use.
+type FlightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight is a call in progress.
+type flight struct {
+	done    chan struct{}
+	val     interface{}
+	err     error
+	waiters int
+}
+
+// Do runs fn once for all concurrent callers passing the same key.
+// Parameters:
+// - key: Identifies the work, e.g. "zip:" + folderID.
+// - fn: The work. A panic in fn is returned as an error to every caller.
+// Returns fn's result and whether it was shared with other callers.
+func (g *FlightGroup) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+
+	if f, ok := g.flights[key]; ok {
+		f.waiters++
+		g.mu.Unlock()
+		<-f.done
+		return f.val, f.err, true
+	}
+
+	f := &flight{done: make(chan struct{})}
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	func() {
+		defer func() {
+			if p := recover(); p != nil {
+				f.err = fmt.Errorf("singleflight: panic: %v", p)
+			}
+		}()
+		f.val, f.err = fn()
+	}()
+
+	g.mu.Lock()
+	delete(g.flights, key)
+	shared := f.waiters > 0
+	g.mu.Unlock()
+
+	close(f.done)
+
+	return f.val, f.err, shared
+}
+
+// defaultFlights is the group used by Tools.Singleflight.
+var defaultFlights FlightGroup
+
+// Singleflight runs fn once for all concurrent callers passing the same key, e.g. to generate a zip or thumbnail
+// requested by several clients at once. Keys are shared by every Tools value in the process, so prefix them with
+// what they identify.
+// Parameters:
+// - key: Identifies the work.
+// - fn: The work.
+// Returns fn's result and whether it was shared with other callers.
+func (t *Tools) Singleflight(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	return defaultFlights.Do(key, fn)
+}
+
+// recordedResponse is a response captured for SingleflightMiddleware.
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// SingleflightMiddleware makes concurrent identical GET and HEAD requests share one execution of the handler:
+// the first request runs it while the others wait, and all receive the same status, headers and body. Responses
+// are buffered in memory, and the handler runs with the first request's context.
+// Parameters:
+// - key: An optional function identifying identical requests. Only the first function is used if multiple are
+// provided. It defaults to the method, URL and the Accept, Accept-Encoding, Accept-Language, Authorization and
+// Cookie headers, so responses are never shared between users.
+// Returns the middleware.
+func (t *Tools) SingleflightMiddleware(key ...func(r *http.Request) string) func(http.Handler) http.Handler {
+	keyFunc := singleflightKey
+	if len(key) > 0 {
+		keyFunc = key[0]
+	}
+
+	var group FlightGroup
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			v, err, _ := group.Do(keyFunc(r), func() (interface{}, error) {
+				rec := newResponseRecorder(nil)
+				next.ServeHTTP(rec, r)
+
+				if rec.status == 0 {
+					rec.status = http.StatusOK
+				}
+
+				return &recordedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes()}, nil
+			})
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+
+			resp := v.(*recordedResponse)
+			for k, vs := range resp.header {
+				w.Header()[k] = append([]string(nil), vs...)
+			}
+			w.WriteHeader(resp.status)
+			_, _ = w.Write(resp.body)
+		})
+	}
+}
+
+// singleflightKey identifies a request by its method, URL and the headers that commonly change the response.
+func singleflightKey(r *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.String())
+
+	for _, h := range []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"} {
+		b.WriteByte('\n')
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+
+	return b.String()
+}
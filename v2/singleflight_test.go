@@ -0,0 +1,117 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_Singleflight(t *testing.T) {
+	var testTools Tools
+
+	var calls int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 5)
+	sharedCount := int32(0)
+
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err, shared := testTools.Singleflight("zip:1", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "archive", nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+			results[i] = v
+		}(i)
+	}
+
+	// let the callers join the flight before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 || sharedCount != 5 {
+		t.Errorf("expected one shared execution, got %d calls and %d shared results", calls, sharedCount)
+	}
+	for _, v := range results {
+		if v != "archive" {
+			t.Errorf("expected every caller to get the result, got %v", v)
+		}
+	}
+
+	_, err, shared := testTools.Singleflight("zip:1", func() (interface{}, error) { panic("boom") })
+	if err == nil || shared {
+		t.Errorf("expected a panic to become an error, got %v", err)
+	}
+
+	var g FlightGroup
+	if _, err, _ := g.Do("a", func() (interface{}, error) { return nil, errors.New("failed") }); err == nil || err.Error() != "failed" {
+		t.Errorf("expected the error to be returned, got %v", err)
+	}
+}
+
+func TestTools_SingleflightMiddleware(t *testing.T) {
+	var testTools Tools
+
+	var calls int32
+	release := make(chan struct{})
+	h := testTools.SingleflightMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Method == http.MethodGet {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("zip"))
+	}))
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 4)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(rr *httptest.ResponseRecorder) {
+			defer wg.Done()
+			h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/export.zip", nil))
+		}(recorders[i])
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected one handler execution, got %d", calls)
+	}
+	for _, rr := range recorders {
+		if rr.Code != http.StatusCreated || rr.Body.String() != "zip" || rr.Header().Get("Content-Type") != "application/zip" {
+			t.Errorf("unexpected response %d %v %q", rr.Code, rr.Header(), rr.Body.String())
+		}
+	}
+
+	// requests from different users or with other methods are not coalesced
+	req := httptest.NewRequest(http.MethodGet, "/export.zip", nil)
+	req.Header.Set("Authorization", "Bearer other")
+	if singleflightKey(req) == singleflightKey(httptest.NewRequest(http.MethodGet, "/export.zip", nil)) {
+		t.Error("expected the key to depend on the Authorization header")
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/export.zip", nil))
+	if calls != 2 {
+		t.Errorf("expected POST to bypass coalescing, got %d calls", calls)
+	}
+}
@@ -0,0 +1,165 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const soapEnvelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// SOAPFault is the error returned by PushSOAP when the service answers with a fault. Both SOAP 1.1 and SOAP 1.2
+// faults are read.
+// Fields:
+// - Code: The fault code, e.g. "soap:Server".
+// - String: The human-readable reason.
+// - Actor: The node that caused the fault, if given.
+// - Detail: The raw XML of the fault's detail element, for service-specific information.
+type SOAPFault struct {
+	Code   string
+	String string
+	Actor  string
+	Detail string
+}
+
+// Error returns the fault code and reason.
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault %s: %s", f.Code, f.String)
+}
+
+// ErrorCode returns the fault code, so ErrorJSON includes it.
+func (f *SOAPFault) ErrorCode() string {
+	return f.Code
+}
+
+// soapEnvelope is the SOAP 1.1 envelope sent by PushSOAP.
+type soapEnvelope struct {
+	XMLName xml.Name `xml:"soap:Envelope"`
+	NS      string   `xml:"xmlns:soap,attr"`
+	Body    struct {
+		Content interface{}
+	} `xml:"soap:Body"`
+}
+
+// soapFaultXML matches SOAP 1.1 and 1.2 fault elements.
+type soapFaultXML struct {
+	Code11   string `xml:"faultcode"`
+	String11 string `xml:"faultstring"`
+	Actor11  string `xml:"faultactor"`
+	Detail11 struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"detail"`
+	Code12   string `xml:"Code>Value"`
+	Reason12 string `xml:"Reason>Text"`
+	Detail12 struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"Detail"`
+}
+
+// PushSOAP calls a SOAP 1.1 operation, wrapping the body in an envelope and decoding the response body.
+// This function allows for an optional http.Client to be specified for the request; if none is provided, a default client is used.
+// Parameters:
+// - uri: The service endpoint.
+// - action: The SOAPAction of the operation, e.g. "http://tempuri.org/Add".
+// - body: The operation element, a value marshaled with encoding/xml whose XMLName carries the service's namespace,
+// e.g. `xml:"http://tempuri.org/ Add"`.
+// - target: A pointer that the first element of the response body is decoded into, or nil to discard it.
+// - client: An optional variadic parameter that allows specifying a custom http.Client for the request. Only the first client is used if multiple are provided.
+// Returns the HTTP response, the response status code, and an error if the request fails. Faults are returned as
+// *SOAPFault.
+func (t *Tools) PushSOAP(uri, action string, body, target interface{}, client ...*http.Client) (*http.Response, int, error) {
+	envelope := soapEnvelope{NS: soapEnvelopeNS}
+	envelope.Body.Content = body
+
+	payload, err := xml.Marshal(envelope)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	httpClient := &http.Client{}
+	if len(client) > 0 {
+		httpClient = client[0]
+	}
+
+	request, err := http.NewRequest(http.MethodPost, uri, io.MultiReader(strings.NewReader(xml.Header), bytes.NewReader(payload)))
+	if err != nil {
+		return nil, 0, err
+	}
+	request.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	request.Header.Set("SOAPAction", `"`+action+`"`)
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if err := decodeSOAPBody(response.Body, target); err != nil {
+		var fault *SOAPFault
+		if !errors.As(err, &fault) && response.StatusCode >= http.StatusBadRequest {
+			return response, response.StatusCode, fmt.Errorf("soap: unexpected status %d", response.StatusCode)
+		}
+		return response, response.StatusCode, err
+	}
+
+	if response.StatusCode >= http.StatusBadRequest {
+		return response, response.StatusCode, fmt.Errorf("soap: unexpected status %d", response.StatusCode)
+	}
+
+	return response, response.StatusCode, nil
+}
+
+// decodeSOAPBody finds the Body of an envelope and decodes its first element into target, or returns the fault.
+// Elements are decoded in place, so namespace prefixes declared on the envelope still resolve.
+func decodeSOAPBody(r io.Reader, target interface{}) error {
+	dec := xml.NewDecoder(r)
+	inBody := false
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return errors.New("soap: response has no body")
+		}
+		if err != nil {
+			return fmt.Errorf("soap: invalid response: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			if !inBody {
+				inBody = el.Name.Local == "Body"
+				continue
+			}
+
+			if el.Name.Local == "Fault" {
+				var f soapFaultXML
+				if err := dec.DecodeElement(&f, &el); err != nil {
+					return fmt.Errorf("soap: invalid fault: %w", err)
+				}
+
+				fault := &SOAPFault{Code: f.Code11, String: f.String11, Actor: f.Actor11, Detail: strings.TrimSpace(f.Detail11.Inner)}
+				if fault.Code == "" {
+					fault.Code, fault.String, fault.Detail = f.Code12, f.Reason12, strings.TrimSpace(f.Detail12.Inner)
+				}
+				return fault
+			}
+
+			if target == nil {
+				return nil
+			}
+			if err := dec.DecodeElement(target, &el); err != nil {
+				return fmt.Errorf("soap: cannot decode body: %w", err)
+			}
+			return nil
+		case xml.EndElement:
+			if inBody && el.Name.Local == "Body" {
+				// an empty body
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type soapTestAdd struct {
+	XMLName xml.Name `xml:"http://tempuri.org/ Add"`
+	A       int      `xml:"intA"`
+	B       int      `xml:"intB"`
+}
+
+type soapTestAddResponse struct {
+	XMLName xml.Name `xml:"http://tempuri.org/ AddResponse"`
+	Result  int      `xml:"AddResult"`
+}
+
+var pushSOAPTests = []struct {
+	name      string
+	status    int
+	response  string
+	result    int
+	faultCode string
+	errorText string
+}{
+	{name: "result", status: http.StatusOK, result: 5, response: `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:t="http://tempuri.org/">
+  <soap:Body><t:AddResponse><t:AddResult>5</t:AddResult></t:AddResponse></soap:Body>
+</soap:Envelope>`},
+	{name: "soap 1.1 fault", status: http.StatusInternalServerError, faultCode: "soap:Client", errorText: "soap fault soap:Client: bad input", response: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><soap:Fault><faultcode>soap:Client</faultcode><faultstring>bad input</faultstring><detail><code>42</code></detail></soap:Fault></soap:Body>
+</soap:Envelope>`},
+	{name: "soap 1.2 fault", status: http.StatusInternalServerError, faultCode: "env:Receiver", errorText: "soap fault env:Receiver: overloaded", response: `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body><env:Fault><env:Code><env:Value>env:Receiver</env:Value></env:Code><env:Reason><env:Text xml:lang="en">overloaded</env:Text></env:Reason></env:Fault></env:Body>
+</env:Envelope>`},
+	{name: "not soap", status: http.StatusServiceUnavailable, errorText: "soap: unexpected status 503", response: `Service Unavailable`},
+}
+
+func TestTools_PushSOAP(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range pushSOAPTests {
+		var sent string
+		var action string
+
+		client := NewTestClient(func(req *http.Request) *http.Response {
+			b, _ := io.ReadAll(req.Body)
+			sent, action = string(b), req.Header.Get("SOAPAction")
+			return &http.Response{
+				StatusCode: e.status,
+				Body:       io.NopCloser(bytes.NewBufferString(e.response)),
+				Header:     make(http.Header),
+			}
+		})
+
+		var out soapTestAddResponse
+		_, _, err := testTools.PushSOAP("http://example.com/calc", "http://tempuri.org/Add", soapTestAdd{A: 2, B: 3}, &out, client)
+
+		if action != `"http://tempuri.org/Add"` || !strings.Contains(sent, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Add xmlns="http://tempuri.org/"><intA>2</intA><intB>3</intB></Add></soap:Body></soap:Envelope>`) {
+			t.Errorf("%s: unexpected request %s %s", e.name, action, sent)
+		}
+
+		if out.Result != e.result {
+			t.Errorf("%s: expected result %d, got %d", e.name, e.result, out.Result)
+		}
+
+		if e.errorText == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", e.name, err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != e.errorText {
+			t.Errorf("%s: expected error %q, got %v", e.name, e.errorText, err)
+		}
+
+		var fault *SOAPFault
+		if e.faultCode != "" && (!errors.As(err, &fault) || fault.Code != e.faultCode) {
+			t.Errorf("%s: expected fault %s, got %v", e.name, e.faultCode, err)
+		}
+	}
+}
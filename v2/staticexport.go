@@ -0,0 +1,238 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StaticRoute is a page exported by ExportStatic, rendered either from a template or by a handler.
+// Fields:
+// - Path: The URL path of the page, e.g. "/" or "/about". Paths ending in an extension, such as "/404.html",
+// are written as is; others are written as <path>/index.html.
+// - Template: The template to execute.
+// - Name: The template to execute within Template, for template sets. Empty executes Template itself.
+// - Data: The data passed to the template.
+// - Handler: Used instead of Template to render the page, with a GET request for Path. It must answer 200 OK.
+type StaticRoute struct {
+	Path     string
+	Template *template.Template
+	Name     string
+	Data     interface{}
+	Handler  http.Handler
+}
+
+// ExportOptions configures ExportStatic.
+// Fields:
+// - AssetDir: The local directory holding the assets referenced by the pages. Defaults to "static".
+// - AssetPrefix: The URL prefix of the assets. Defaults to "/static/".
+// - Context: The context of the requests passed to handlers. Defaults to context.Background().
+type ExportOptions struct {
+	AssetDir    string
+	AssetPrefix string
+	Context     context.Context
+}
+
+// staticAssetAttrs are the attributes scanned for asset references, by tag.
+var staticAssetAttrs = map[string][]string{
+	"link":   {"href"},
+	"script": {"src"},
+	"img":    {"src"},
+	"source": {"src"},
+	"video":  {"src", "poster"},
+	"audio":  {"src"},
+}
+
+// ExportStatic renders routes and writes the HTML with the assets it references to outDir, so small apps can
+// publish a static snapshot. Assets under AssetPrefix are copied from AssetDir with a content hash in their
+// names, e.g. /static/app.3f2a1b9c.css, and the pages are rewritten to use them; assets already listed in
+// t.AssetManifest are copied unchanged. The mapping is written to outDir/asset-manifest.json, readable with
+// LoadAssetManifest.
+// Parameters:
+// - routes: The pages to export.
+// - outDir: The directory to write to. It is created if needed.
+// - opts: Optional ExportOptions. Only the first value is used if multiple are provided.
+// Returns the written files relative to outDir, sorted, or an error if a page fails to render or an asset is missing.
+func (t *Tools) ExportStatic(routes []StaticRoute, outDir string, opts ...ExportOptions) ([]string, error) {
+	var o ExportOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.AssetDir == "" {
+		o.AssetDir = "static"
+	}
+	if o.AssetPrefix == "" {
+		o.AssetPrefix = "/static/"
+	}
+	if !strings.HasSuffix(o.AssetPrefix, "/") {
+		o.AssetPrefix += "/"
+	}
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+
+	fingerprinted := make(map[string]bool, len(t.AssetManifest))
+	for _, u := range t.AssetManifest {
+		fingerprinted[u] = true
+	}
+
+	manifest := make(map[string]string)
+	var written []string
+
+	for _, route := range routes {
+		page, err := renderStaticRoute(o.Context, route)
+		if err != nil {
+			return nil, fmt.Errorf("export %s: %w", route.Path, err)
+		}
+
+		for _, tag := range scanHTMLTags(page, "link", "script", "img", "source", "video", "audio") {
+			for _, attr := range staticAssetAttrs[tag.Name] {
+				ref := tag.Attrs[attr]
+
+				u, err := url.Parse(ref)
+				if err != nil || u.Host != "" || !strings.HasPrefix(u.Path, o.AssetPrefix) {
+					continue
+				}
+
+				name := strings.TrimPrefix(u.Path, o.AssetPrefix)
+				exported, ok := manifest[name]
+				if !ok {
+					exported, err = exportAsset(o, outDir, name, fingerprinted[u.Path])
+					if err != nil {
+						return nil, fmt.Errorf("export %s: %w", route.Path, err)
+					}
+					manifest[name] = exported
+					written = append(written, strings.TrimPrefix(exported, "/"))
+				}
+
+				// rewrite the reference wherever it appears quoted, keeping any query or fragment
+				u.Path = exported
+				replacement := template.HTMLEscapeString(u.String())
+				for _, old := range []string{ref, template.HTMLEscapeString(ref)} {
+					page = strings.ReplaceAll(page, `"`+old+`"`, `"`+replacement+`"`)
+					page = strings.ReplaceAll(page, `'`+old+`'`, `'`+replacement+`'`)
+				}
+			}
+		}
+
+		file := staticPageFile(route.Path)
+		if err := writeExportFile(outDir, file, []byte(page)); err != nil {
+			return nil, err
+		}
+		written = append(written, file)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeExportFile(outDir, "asset-manifest.json", data); err != nil {
+		return nil, err
+	}
+	written = append(written, "asset-manifest.json")
+
+	sort.Strings(written)
+
+	return written, nil
+}
+
+// renderStaticRoute renders a route's HTML.
+func renderStaticRoute(ctx context.Context, route StaticRoute) (string, error) {
+	if !strings.HasPrefix(route.Path, "/") {
+		return "", fmt.Errorf("path must start with /")
+	}
+
+	var buf bytes.Buffer
+
+	switch {
+	case route.Handler != nil:
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, route.Path, nil)
+		if err != nil {
+			return "", err
+		}
+
+		rec := newResponseRecorder(nil)
+		route.Handler.ServeHTTP(rec, req)
+
+		if rec.status != 0 && rec.status != http.StatusOK {
+			return "", fmt.Errorf("handler answered %d", rec.status)
+		}
+		buf.Write(rec.body.Bytes())
+	case route.Template != nil && route.Name != "":
+		if err := route.Template.ExecuteTemplate(&buf, route.Name, route.Data); err != nil {
+			return "", err
+		}
+	case route.Template != nil:
+		if err := route.Template.Execute(&buf, route.Data); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("route has neither a template nor a handler")
+	}
+
+	return buf.String(), nil
+}
+
+// staticPageFile maps a URL path to the file serving it from a static host.
+func staticPageFile(urlPath string) string {
+	p := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if p == "" {
+		return "index.html"
+	}
+	if path.Ext(p) != "" {
+		return p
+	}
+
+	return p + "/index.html"
+}
+
+// exportAsset copies an asset to outDir, fingerprinting its name unless it already is, and returns its URL path.
+func exportAsset(o ExportOptions, outDir, name string, alreadyFingerprinted bool) (string, error) {
+	clean := path.Clean("/" + name)[1:]
+	if clean == "" {
+		return "", fmt.Errorf("invalid asset %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(o.AssetDir, filepath.FromSlash(clean)))
+	if err != nil {
+		return "", fmt.Errorf("asset %s: %w", name, err)
+	}
+
+	if !alreadyFingerprinted {
+		sum := sha256.Sum256(data)
+		ext := path.Ext(clean)
+		clean = strings.TrimSuffix(clean, ext) + "." + hex.EncodeToString(sum[:4]) + ext
+	}
+
+	exported := o.AssetPrefix + clean
+	if err := writeExportFile(outDir, strings.TrimPrefix(exported, "/"), data); err != nil {
+		return "", err
+	}
+
+	return exported, nil
+}
+
+// writeExportFile writes a file below outDir, creating its directory.
+func writeExportFile(outDir, name string, data []byte) error {
+	target := filepath.Join(outDir, filepath.FromSlash(name))
+	if !pathWithin(target, outDir) {
+		return fmt.Errorf("invalid export path %q", name)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(target, data, 0644)
+}
@@ -0,0 +1,80 @@
+package toolkit
+
+import (
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTools_ExportStatic(t *testing.T) {
+	testTools := Tools{AssetManifest: map[string]string{"logo.png": "/static/logo.1234abcd.png"}}
+
+	assets := t.TempDir()
+	_ = os.WriteFile(filepath.Join(assets, "app.css"), []byte("body{}"), 0644)
+	_ = os.WriteFile(filepath.Join(assets, "logo.1234abcd.png"), []byte("png"), 0644)
+
+	page := template.Must(template.New("page").Funcs(template.FuncMap{"asset": testTools.AssetURL}).Parse(
+		`<html><head><title>{{.}}</title><link rel="stylesheet" href="/static/app.css?v=1"></head>` +
+			`<body><img src="{{asset "logo.png"}}"><script src="https://cdn.example.com/x.js"></script></body></html>`))
+
+	routes := []StaticRoute{
+		{Path: "/", Template: page, Data: "Home"},
+		{Path: "/about", Template: page, Data: "About"},
+		{Path: "/404.html", Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`<link href='/static/app.css'>`))
+		})},
+	}
+
+	out := t.TempDir()
+	files, err := testTools.ExportStatic(routes, out, ExportOptions{AssetDir: assets})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"404.html", "about/index.html", "asset-manifest.json", "index.html", "static/app.7c98040a.css", "static/logo.1234abcd.png"}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected files %v, got %v", expected, files)
+	}
+
+	b, _ := os.ReadFile(filepath.Join(out, "about", "index.html"))
+	for _, want := range []string{"<title>About</title>", `href="/static/app.7c98040a.css?v=1"`, `src="/static/logo.1234abcd.png"`, `src="https://cdn.example.com/x.js"`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("expected %s in %s", want, b)
+		}
+	}
+
+	b, _ = os.ReadFile(filepath.Join(out, "404.html"))
+	if string(b) != `<link href='/static/app.7c98040a.css'>` {
+		t.Errorf("unexpected handler page %s", b)
+	}
+
+	manifest, err := LoadAssetManifest(filepath.Join(out, "asset-manifest.json"))
+	if err != nil || manifest["app.css"] != "/static/app.7c98040a.css" {
+		t.Errorf("unexpected manifest %v, %v", manifest, err)
+	}
+}
+
+var exportStaticErrorTests = []struct {
+	name  string
+	route StaticRoute
+}{
+	{name: "missing asset", route: StaticRoute{Path: "/", Template: template.Must(template.New("").Parse(`<script src="/static/missing.js"></script>`))}},
+	{name: "template error", route: StaticRoute{Path: "/", Template: template.Must(template.New("").Parse(`{{.Missing}}`)), Data: 1}},
+	{name: "handler error", route: StaticRoute{Path: "/", Handler: http.NotFoundHandler()}},
+	{name: "no renderer", route: StaticRoute{Path: "/"}},
+	{name: "relative path", route: StaticRoute{Path: "about", Handler: http.NotFoundHandler()}},
+}
+
+func TestTools_ExportStatic_Errors(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range exportStaticErrorTests {
+		if _, err := testTools.ExportStatic([]StaticRoute{e.route}, t.TempDir(), ExportOptions{AssetDir: t.TempDir()}); err == nil {
+			t.Errorf("%s: expected an error", e.name)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package toolkit
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits applied by StrictDefaults.
+const (
+	strictMaxFileSize   = 10 << 20
+	strictMaxUploadSize = 32 << 20
+	strictMaxJSONSize   = 64 << 10
+	strictMaxMemory     = 1 << 20
+)
+
+// StrictDefaults tightens the settings of t for new projects, so they start from secure defaults and loosen what
+// they need afterwards:
+//   - uploaded files are limited to 10 MB and upload requests to 32 MB, of which 1 MB is kept in memory, and JSON
+//     bodies to 64 KB, keeping stricter limits already set. Larger uploads fail with ErrFileTooLarge, which
+//     ErrorJSON answers with 413 Request Entity Too Large;
+//   - JSON bodies with unknown fields are refused;
+//   - uploads are renamed with UUIDNamer unless a FileNamer is set, and names kept as uploaded are sanitized;
+//   - downloads of unknown or script-running types are sent as application/octet-stream (StrictContentTypes);
+//   - SecurityHeadersMiddleware sends StrictSecurityHeaders unless SecurityHeaders is set;
+//   - FileServer does not list directories, and DevMode is turned off.
+//
+// Call it before setting your own values, since it overwrites the fields it covers:
+//
+//	var tools toolkit.Tools
+//	tools.StrictDefaults()
+//	tools.AllowedFileTypes = []string{"image/png", "image/jpeg"}
+func (t *Tools) StrictDefaults() {
+	if t.MaxFileSize <= 0 || t.MaxFileSize > strictMaxFileSize {
+		t.MaxFileSize = strictMaxFileSize
+	}
+	if t.MaxUploadSize <= 0 || t.MaxUploadSize > strictMaxUploadSize {
+		t.MaxUploadSize = strictMaxUploadSize
+	}
+	if t.MaxJSONSize <= 0 || t.MaxJSONSize > strictMaxJSONSize {
+		t.MaxJSONSize = strictMaxJSONSize
+	}
+	if t.Multipart.MaxMemory <= 0 || t.Multipart.MaxMemory > strictMaxMemory {
+		t.Multipart.MaxMemory = strictMaxMemory
+	}
+
+	t.AllowUnknownFields = false
+	t.StrictContentTypes = true
+	t.SanitizeFileNames = true
+	t.DirectoryListings = false
+	t.DevMode = false
+
+	if t.FileNamer == nil {
+		t.FileNamer = UUIDNamer
+	}
+	if t.SecurityHeaders == nil {
+		t.SecurityHeaders = StrictSecurityHeaders()
+	}
+}
+
+// DefaultSecurityHeaders returns the headers SecurityHeadersMiddleware sends when Tools.SecurityHeaders is nil.
+// They are safe for any site: no MIME sniffing, no framing by other sites, and no full URLs in cross-origin
+// Referer headers.
+func DefaultSecurityHeaders() http.Header {
+	return http.Header{
+		"X-Content-Type-Options": {"nosniff"},
+		"X-Frame-Options":        {"SAMEORIGIN"},
+		"Referrer-Policy":        {"strict-origin-when-cross-origin"},
+	}
+}
+
+// StrictSecurityHeaders returns the headers set by StrictDefaults. Besides DefaultSecurityHeaders, they ask
+// browsers to use HTTPS only for two years, allow scripts, styles and other resources from the site's own origin
+// only, refuse framing entirely, and isolate the page from cross-origin windows. Pages using a CDN or inline
+// scripts need their own Content-Security-Policy.
+func StrictSecurityHeaders() http.Header {
+	h := DefaultSecurityHeaders()
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+	h.Set("Content-Security-Policy", "default-src 'self'; object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'")
+	h.Set("Cross-Origin-Opener-Policy", "same-origin")
+	h.Set("Cross-Origin-Resource-Policy", "same-origin")
+	h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()")
+
+	return h
+}
+
+// SecurityHeadersMiddleware adds Tools.SecurityHeaders, or DefaultSecurityHeaders if it is nil, to every response.
+// The headers are set before the handler runs, so handlers can still change them, e.g. to relax the
+// Content-Security-Policy of a page.
+// Returns the middleware.
+func (t *Tools) SecurityHeadersMiddleware() func(http.Handler) http.Handler {
+	headers := t.SecurityHeaders
+	if headers == nil {
+		headers = DefaultSecurityHeaders()
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for key, values := range headers {
+				w.Header()[key] = append([]string(nil), values...)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// FileServer serves the files of root like http.FileServer, e.g. for static assets. Directories are served
+// through their index.html; unless Tools.DirectoryListings is set, those without one answer 404 Not Found instead
+// of listing their files.
+// Parameters:
+// - root: The files to serve, e.g. http.Dir("./public") or http.FS(embedded).
+// Returns the handler.
+func (t *Tools) FileServer(root http.FileSystem) http.Handler {
+	if t.DirectoryListings {
+		return http.FileServer(root)
+	}
+
+	return http.FileServer(noListingFS{root})
+}
+
+// noListingFS hides the directories of a file system that have no index.html, so http.FileServer cannot list them.
+type noListingFS struct {
+	http.FileSystem
+}
+
+// Open opens name, refusing directories without an index.html as if they did not exist.
+func (nfs noListingFS) Open(name string) (http.File, error) {
+	f, err := nfs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.IsDir() {
+		return f, nil
+	}
+
+	index, err := nfs.FileSystem.Open(path.Join(name, "index.html"))
+	if err != nil {
+		f.Close()
+		return nil, fs.ErrNotExist
+	}
+	index.Close()
+
+	return f, nil
+}
+
+// SanitizeFileName makes a client-supplied file name safe to store on any common file system. Uploads kept under
+// their own name go through it when Tools.SanitizeFileNames is set.
+// It keeps only the last element of a path, removes control characters and the characters Windows forbids
+// (<>:"/\|?*), trims spaces and dots from both ends, so names cannot be hidden files, prefixes Windows device
+// names such as "CON" with "_", and shortens names longer than 255 bytes, keeping their extension.
+// Parameters:
+// - name: The file name, e.g. "../../etc/passwd" or "report:final?.pdf".
+// Returns the sanitized name, e.g. "passwd" or "reportfinal.pdf", or "file" if nothing is left.
+func SanitizeFileName(name string) string {
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError || strings.ContainsRune(`<>:"|?*`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+
+	base, _, _ := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(strings.TrimSpace(base))] {
+		name = "_" + name
+	}
+
+	if len(name) > maxPathSegmentLength {
+		ext := filepath.Ext(name)
+		if len(ext) > maxPathSegmentLength/2 {
+			ext = ""
+		}
+		stem := name[:maxPathSegmentLength-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+		name = strings.TrimRight(stem, " .") + ext
+	}
+
+	if name == "" {
+		return "file"
+	}
+
+	return name
+}
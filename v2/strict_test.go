@@ -0,0 +1,230 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTools_StrictDefaults(t *testing.T) {
+	testTools := Tools{MaxFileSize: 1 << 30, MaxJSONSize: 1024, AllowUnknownFields: true, DevMode: true, DirectoryListings: true}
+	testTools.StrictDefaults()
+
+	if testTools.MaxFileSize != 10<<20 || testTools.MaxUploadSize != 32<<20 || testTools.Multipart.MaxMemory != 1<<20 {
+		t.Errorf("expected the upload limits lowered, got %d, %d and %d", testTools.MaxFileSize, testTools.MaxUploadSize, testTools.Multipart.MaxMemory)
+	}
+	if testTools.MaxJSONSize != 1024 {
+		t.Errorf("expected a stricter JSON limit kept, got %d", testTools.MaxJSONSize)
+	}
+	if testTools.AllowUnknownFields || testTools.DevMode || testTools.DirectoryListings {
+		t.Error("expected unknown fields, dev mode and directory listings turned off")
+	}
+	if !testTools.StrictContentTypes || !testTools.SanitizeFileNames || testTools.FileNamer == nil {
+		t.Error("expected strict content types and safe upload names")
+	}
+	if testTools.SecurityHeaders.Get("Strict-Transport-Security") == "" {
+		t.Error("expected the strict security headers")
+	}
+
+	custom := http.Header{"X-Frame-Options": {"SAMEORIGIN"}}
+	testTools = Tools{SecurityHeaders: custom}
+	testTools.StrictDefaults()
+	if testTools.SecurityHeaders.Get("Strict-Transport-Security") != "" {
+		t.Error("expected security headers already set to be kept")
+	}
+}
+
+func TestTools_SecurityHeadersMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		tools   Tools
+		header  string
+		want    string
+		handler func(w http.ResponseWriter)
+	}{
+		{"default", Tools{}, "X-Frame-Options", "SAMEORIGIN", nil},
+		{"default without HSTS", Tools{}, "Strict-Transport-Security", "", nil},
+		{"strict", Tools{SecurityHeaders: StrictSecurityHeaders()}, "X-Frame-Options", "DENY", nil},
+		{"overridden by the handler", Tools{SecurityHeaders: StrictSecurityHeaders()}, "Content-Security-Policy", "default-src *", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Security-Policy", "default-src *")
+		}},
+	}
+
+	for _, e := range tests {
+		h := e.tools.SecurityHeadersMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if e.handler != nil {
+				e.handler(w)
+			}
+		}))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if got := rr.Header().Get(e.header); got != e.want {
+			t.Errorf("%s: expected %s %q, got %q", e.name, e.header, e.want, got)
+		}
+	}
+}
+
+func TestTools_FileServer(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "private"), 0o755)
+	_ = os.MkdirAll(filepath.Join(dir, "site"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "private", "secret.txt"), []byte("secret"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<h1>home</h1>"), 0o644)
+
+	tests := []struct {
+		name     string
+		listings bool
+		target   string
+		status   int
+		want     string
+	}{
+		{"file", false, "/private/secret.txt", http.StatusOK, "secret"},
+		{"directory without index", false, "/private/", http.StatusNotFound, ""},
+		{"root without index", false, "/", http.StatusNotFound, ""},
+		{"directory with index", false, "/site/", http.StatusOK, "home"},
+		{"listings allowed", true, "/private/", http.StatusOK, "secret.txt"},
+	}
+
+	for _, e := range tests {
+		testTools := Tools{DirectoryListings: e.listings}
+		rr := httptest.NewRecorder()
+		testTools.FileServer(http.Dir(dir)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, e.target, nil))
+
+		if rr.Code != e.status || !strings.Contains(rr.Body.String(), e.want) {
+			t.Errorf("%s: expected %d with %q, got %d %q", e.name, e.status, e.want, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	long := strings.Repeat("é", 200) + ".pdf"
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\photo.jpg`, "photo.jpg"},
+		{"report:final?.pdf", "reportfinal.pdf"},
+		{".htaccess", "htaccess"},
+		{"name. ", "name"},
+		{"bell\a\x00.txt", "bell.txt"},
+		{"CON.txt", "_CON.txt"},
+		{"con", "_con"},
+		{"console.txt", "console.txt"},
+		{"..", "file"},
+		{"", "file"},
+	}
+
+	for _, e := range tests {
+		if got := SanitizeFileName(e.name); got != e.want {
+			t.Errorf("%q: expected %q, got %q", e.name, e.want, got)
+		}
+	}
+
+	var testTools Tools
+	got := SanitizeFileName(long)
+	if len(got) > 255 || !strings.HasSuffix(got, ".pdf") || !strings.HasPrefix(got, "é") {
+		t.Errorf("expected a long name shortened keeping its extension, got %d bytes %q", len(got), got)
+	}
+	if _, err := testTools.SafeJoin(t.TempDir(), got); err != nil {
+		t.Errorf("expected SafeJoin to accept a sanitized name: %v", err)
+	}
+}
+
+func TestTools_UploadFilesSanitizeFileNames(t *testing.T) {
+	testTools := Tools{SanitizeFileNames: true}
+	dir := t.TempDir()
+
+	req := multipartUpload(t, [][3]string{{"file", "report:v2.txt", "hello"}})
+	files, err := testTools.UploadFiles(req, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if files[0].NewFileName != "reportv2.txt" || files[0].OriginalFileName != "report:v2.txt" {
+		t.Errorf("expected the stored name sanitized, got %q from %q", files[0].NewFileName, files[0].OriginalFileName)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "reportv2.txt")); err != nil {
+		t.Error("expected the file under its sanitized name")
+	}
+}
+
+func TestTools_StrictDefaultsUploadLimits(t *testing.T) {
+	large := strings.Repeat("a", 20<<20)
+
+	tests := []struct {
+		name  string
+		opts  MultipartOptions
+		limit int
+		files [][3]string
+	}{
+		{"oversized file", MultipartOptions{}, 0, [][3]string{{"file", "big.txt", large}}},
+		{"oversized file, spilled", MultipartOptions{TempDir: t.TempDir()}, 0, [][3]string{{"file", "big.txt", large}}},
+		{"oversized file, streamed", MultipartOptions{Stream: true}, 0, [][3]string{{"file", "big.txt", large}}},
+		{"oversized request", MultipartOptions{}, 1 << 20, [][3]string{{"a", "a.txt", large[:600<<10]}, {"b", "b.txt", large[:600<<10]}}},
+	}
+
+	for _, e := range tests {
+		var testTools Tools
+		testTools.StrictDefaults()
+		testTools.Multipart = e.opts
+		if e.limit != 0 {
+			testTools.MaxUploadSize = e.limit
+		}
+		dir := t.TempDir()
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := testTools.UploadFiles(r, dir); err != nil {
+				_ = testTools.ErrorJSON(w, err)
+			}
+		}).ServeHTTP(rr, multipartUpload(t, e.files))
+
+		if rr.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: expected 413, got %d %s", e.name, rr.Code, rr.Body.String())
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected nothing left in the upload directory, got %d files", e.name, len(entries))
+		}
+	}
+
+	var testTools Tools
+	testTools.StrictDefaults()
+	if _, err := testTools.UploadFiles(multipartUpload(t, [][3]string{{"file", "small.txt", large[:1<<20]}}), t.TempDir()); err != nil {
+		t.Errorf("expected a file under the limit saved, got %v", err)
+	}
+}
+
+func TestTools_UploadFilesBadRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"name": "report.pdf"}`},
+		{"malformed multipart", "multipart/form-data; boundary=xyz", "--xyz\r\nno headers end"},
+	}
+
+	for _, e := range tests {
+		for _, tempDir := range []string{"", t.TempDir()} {
+			testTools := Tools{Multipart: MultipartOptions{TempDir: tempDir}}
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(e.body))
+			req.Header.Set("Content-Type", e.contentType)
+			rr := httptest.NewRecorder()
+			if _, err := testTools.UploadFiles(req, t.TempDir()); err != nil {
+				_ = testTools.ErrorJSON(rr, err)
+			}
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s (temp dir %q): expected 400, got %d %s", e.name, tempDir, rr.Code, rr.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiskUsage is the space on the filesystem holding a path, in bytes.
+// Fields:
+// - Path: The path the filesystem was looked up by.
+// - Total: The size of the filesystem.
+// - Free: The free space, including space reserved for the superuser.
+// - Available: The space available to this process, which is what uploads can use.
+// - Used: The space in use.
+// - UsedPercent: Used as a percentage of the space usable by unprivileged users, as df reports it.
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Free        uint64  `json:"free"`
+	Available   uint64  `json:"available"`
+	Used        uint64  `json:"used"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Fits reports whether n more bytes fit on the filesystem while leaving reserve bytes available, e.g. to refuse an
+// upload before the disk fills up.
+func (d DiskUsage) Fits(n, reserve uint64) bool {
+	return d.Available >= reserve && d.Available-reserve >= n
+}
+
+// MemoryInfo is the memory of the machine and process, in bytes. Figures that cannot be read on this platform are
+// zero.
+// Fields:
+// - Total: The physical memory of the machine.
+// - Available: The memory available for new allocations without swapping.
+// - Limit: The memory limit of the process' cgroup, e.g. a container's limit, or zero if there is none.
+// - Process: The memory the Go runtime obtained from the system.
+type MemoryInfo struct {
+	Total     uint64 `json:"total"`
+	Available uint64 `json:"available"`
+	Limit     uint64 `json:"limit,omitempty"`
+	Process   uint64 `json:"process"`
+}
+
+// SystemInfo describes the resources of the machine the process runs on.
+// Fields:
+// - Hostname: The host name.
+// - OS, Arch: The operating system and architecture, as runtime.GOOS and runtime.GOARCH.
+// - CPUs: The number of logical CPUs.
+// - GOMAXPROCS: The number of CPUs Go code may run on at once.
+// - Memory: The memory figures.
+// - Disks: The space on the filesystems of the paths asked for.
+// - StartedAt: When the process started.
+// - UptimeSeconds: How long the process has been running, in seconds.
+type SystemInfo struct {
+	Hostname      string      `json:"hostname"`
+	OS            string      `json:"os"`
+	Arch          string      `json:"arch"`
+	CPUs          int         `json:"cpus"`
+	GOMAXPROCS    int         `json:"gomaxprocs"`
+	Memory        MemoryInfo  `json:"memory"`
+	Disks         []DiskUsage `json:"disks,omitempty"`
+	StartedAt     time.Time   `json:"started_at"`
+	UptimeSeconds int64       `json:"uptime_seconds"`
+}
+
+// DiskUsage returns the space on the filesystem holding a path, e.g. the upload directory.
+// Parameters:
+// - path: The path, which must exist.
+// Returns the usage, or an error if the path cannot be looked up or the platform does not support it, matching
+// errors.ErrUnsupported.
+func (t *Tools) DiskUsage(path string) (DiskUsage, error) {
+	d, err := statDisk(path)
+	if err != nil {
+		return DiskUsage{}, fmt.Errorf("disk usage of %s: %w", path, err)
+	}
+
+	d.Path = path
+	if d.Free <= d.Total {
+		d.Used = d.Total - d.Free
+	}
+	if usable := d.Used + d.Available; usable > 0 {
+		d.UsedPercent = float64(d.Used) / float64(usable) * 100
+	}
+
+	return d, nil
+}
+
+// SystemInfo returns the CPUs, memory, uptime and, for the given paths, the disk space of the machine, e.g. for
+// quota decisions or a health check.
+// Parameters:
+// - paths: The paths whose filesystems are reported, e.g. the upload and temporary directories.
+// Returns the information, or an error if a path cannot be looked up, along with everything else.
+func (t *Tools) SystemInfo(paths ...string) (SystemInfo, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	info := SystemInfo{
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		CPUs:          runtime.NumCPU(),
+		GOMAXPROCS:    runtime.GOMAXPROCS(0),
+		Memory:        readMemoryInfo(),
+		StartedAt:     processStart.UTC(),
+		UptimeSeconds: int64(time.Since(processStart).Seconds()),
+	}
+	info.Memory.Process = m.Sys
+	info.Hostname, _ = os.Hostname()
+
+	var errs []error
+	for _, p := range paths {
+		d, err := t.DiskUsage(p)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		info.Disks = append(info.Disks, d)
+	}
+
+	return info, errors.Join(errs...)
+}
+
+// SystemInfoHandler returns an admin endpoint serving SystemInfo as JSON, e.g. mounted as "GET /admin/system".
+// Parameters:
+// - auth: The middleware guarding the handler. If nil, every request is refused with 403 Forbidden.
+// - paths: The paths whose disk space is reported. Defaults to the working directory.
+// Returns the handler. It answers 500 Internal Server Error if a path cannot be looked up.
+func (t *Tools) SystemInfoHandler(auth func(http.Handler) http.Handler, paths ...string) http.Handler {
+	if auth == nil {
+		auth = t.denyAll
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info, err := t.SystemInfo(paths...)
+		if err != nil {
+			_ = t.ErrorJSON(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		_ = t.WriteJSON(w, http.StatusOK, info)
+	}))
+}
+
+// readMemoryInfo reads the machine's memory from /proc/meminfo and the cgroup limit from /sys/fs/cgroup, where
+// they exist.
+func readMemoryInfo() MemoryInfo {
+	var mi MemoryInfo
+
+	if data, err := os.ReadFile("/proc/meminfo"); err == nil {
+		sc := bufio.NewScanner(bytes.NewReader(data))
+		for sc.Scan() {
+			key, value, ok := strings.Cut(sc.Text(), ":")
+			if !ok {
+				continue
+			}
+			kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "MemTotal":
+				mi.Total = kb << 10
+			case "MemAvailable":
+				mi.Available = kb << 10
+			}
+		}
+	}
+
+	// cgroup v2, then v1, whose "unlimited" is a huge number rather than "max"
+	for _, name := range []string{"/sys/fs/cgroup/memory.max", "/sys/fs/cgroup/memory/memory.limit_in_bytes"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if limit, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64); err == nil && (mi.Total == 0 || limit < mi.Total) {
+			mi.Limit = limit
+		}
+		break
+	}
+
+	return mi
+}
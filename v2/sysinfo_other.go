@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+package toolkit
+
+import "errors"
+
+// statDisk is not supported on this platform.
+func statDisk(string) (DiskUsage, error) {
+	return DiskUsage{}, errors.ErrUnsupported
+}
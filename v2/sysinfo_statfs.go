@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package toolkit
+
+import "syscall"
+
+// statDisk returns the size, free and available space of the filesystem holding path.
+func statDisk(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+
+	bsize := uint64(st.Bsize)
+
+	return DiskUsage{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+	}, nil
+}
@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestTools_DiskUsage(t *testing.T) {
+	var testTools Tools
+
+	d, err := testTools.DiskUsage(t.TempDir())
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skipf("disk usage unsupported on %s: %v", runtime.GOOS, err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Total == 0 || d.Available > d.Total || d.Free > d.Total || d.Used+d.Free != d.Total {
+		t.Errorf("expected consistent figures, got %+v", d)
+	}
+	if d.UsedPercent < 0 || d.UsedPercent > 100 {
+		t.Errorf("expected a percentage, got %v", d.UsedPercent)
+	}
+
+	if _, err := testTools.DiskUsage("/does/not/exist"); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestDiskUsage_Fits(t *testing.T) {
+	d := DiskUsage{Available: 100}
+
+	tests := []struct {
+		n, reserve uint64
+		want       bool
+	}{
+		{50, 0, true},
+		{100, 0, true},
+		{101, 0, false},
+		{50, 50, true},
+		{51, 50, false},
+		{0, 200, false},
+	}
+
+	for _, e := range tests {
+		if got := d.Fits(e.n, e.reserve); got != e.want {
+			t.Errorf("%d with %d reserved: expected %v, got %v", e.n, e.reserve, e.want, got)
+		}
+	}
+}
+
+func TestTools_SystemInfo(t *testing.T) {
+	var testTools Tools
+
+	info, err := testTools.SystemInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.CPUs != runtime.NumCPU() || info.OS != runtime.GOOS || info.Memory.Process == 0 || info.StartedAt.IsZero() {
+		t.Errorf("expected the runtime figures, got %+v", info)
+	}
+	if runtime.GOOS == "linux" && (info.Memory.Total == 0 || info.Memory.Available > info.Memory.Total) {
+		t.Errorf("expected the memory of the machine, got %+v", info.Memory)
+	}
+
+	if _, err := testTools.SystemInfo("/does/not/exist"); err == nil {
+		t.Error("expected an error for a missing path")
+	}
+}
+
+func TestTools_SystemInfoHandler(t *testing.T) {
+	var testTools Tools
+
+	rr := httptest.NewRecorder()
+	testTools.SystemInfoHandler(nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/system", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected a nil auth to refuse, got %d", rr.Code)
+	}
+
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		return
+	}
+
+	allow := func(next http.Handler) http.Handler { return next }
+	rr = httptest.NewRecorder()
+	testTools.SystemInfoHandler(allow, t.TempDir()).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/system", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var info SystemInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil || len(info.Disks) != 1 || info.Disks[0].Total == 0 {
+		t.Errorf("expected the disk in the response, got %s (%v)", rr.Body.String(), err)
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.SystemInfoHandler(allow, "/does/not/exist").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/admin/system", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 for a missing path, got %d", rr.Code)
+	}
+}
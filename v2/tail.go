@@ -0,0 +1,264 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TailOptions configures TailHandler.
+// Fields:
+// - Lines: The number of lines sent from the end of the file when a client connects, as with tail -n. Defaults to
+// 10; negative sends none.
+// - PollInterval: How often the file is checked for new lines and rotation. Defaults to 500 milliseconds.
+// - MaxLineSize: The longest line sent, in bytes; longer lines are split. Defaults to 64 KB.
+type TailOptions struct {
+	Lines        int
+	PollInterval time.Duration
+	MaxLineSize  int
+}
+
+// TailHandler streams the lines appended to a log file as server-sent events, like tail -F, for lightweight admin
+// and troubleshooting pages, e.g.
+//
+//	mux.Handle("GET /admin/logs", tools.TailHandler("/var/log/app.log", adminOnly))
+//
+// Each line is sent as a "line" event, starting with the last TailOptions.Lines lines of the file. The file is
+// polled, so it works on any filesystem. When it is rotated, by renaming it and creating a new one or by
+// truncating it, the rest of the old file is sent, then a "rotate" event, then the new file from its start. A line
+// still being written is held back until it ends. In a browser:
+//
+//	new EventSource("/admin/logs").addEventListener("line", e => append(e.data))
+//
+// Parameters:
+// - path: The log file. It must exist when a client connects; it may be missing for a while during rotation.
+// - auth: The middleware guarding the handler, e.g. Authorize with an admin policy. If nil, every request is
+// refused with 403 Forbidden, so log files are never exposed by mistake.
+// - opts: Optional TailOptions. Only the first value is used if multiple are provided.
+// Returns the handler.
+func (t *Tools) TailHandler(path string, auth func(http.Handler) http.Handler, opts ...TailOptions) http.Handler {
+	var o TailOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Lines == 0 {
+		o.Lines = 10
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 500 * time.Millisecond
+	}
+	if o.MaxLineSize <= 0 {
+		o.MaxLineSize = 64 << 10
+	}
+	if auth == nil {
+		auth = t.denyAll
+	}
+
+	return auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		lt, lines, err := openLogTail(path, max(o.Lines, 0), o.MaxLineSize)
+		if err != nil {
+			_ = t.ErrorJSON(w, errors.New("log file unavailable"), http.StatusNotFound)
+			return
+		}
+		defer lt.close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		send := func(lines []string) {
+			for _, line := range lines {
+				_, _ = io.WriteString(w, "event: line\n")
+				// a lone carriage return would end the data field, so each segment is a field of its own
+				for _, seg := range strings.Split(line, "\r") {
+					_, _ = fmt.Fprintf(w, "data: %s\n", seg)
+				}
+				_, _ = io.WriteString(w, "\n")
+			}
+		}
+
+		send(lines)
+		flusher.Flush()
+
+		poll := time.NewTicker(o.PollInterval)
+		defer poll.Stop()
+		keepalive := time.NewTicker(15 * time.Second)
+		defer keepalive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-poll.C:
+				before, rotated, after, err := lt.poll()
+				if err != nil {
+					_, _ = io.WriteString(w, "event: error\ndata: reading the log file failed\n\n")
+					flusher.Flush()
+					return
+				}
+				send(before)
+				if rotated {
+					_, _ = io.WriteString(w, "event: rotate\ndata: \n\n")
+				}
+				send(after)
+				if len(before) > 0 || rotated || len(after) > 0 {
+					flusher.Flush()
+				}
+			case <-keepalive.C:
+				_, _ = io.WriteString(w, ": keepalive\n\n")
+				flusher.Flush()
+			}
+		}
+	}))
+}
+
+// logTail follows a log file across rotations.
+type logTail struct {
+	path    string
+	f       *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+	maxLine int
+}
+
+// openLogTail opens path, returning the tail and the last n complete lines of the file.
+func openLogTail(path string, n, maxLine int) (*logTail, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	lt := &logTail{path: path, f: f, info: info, maxLine: maxLine}
+	lt.offset, err = lastLinesOffset(f, info.Size(), n)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	lines, err := lt.read()
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, err
+	}
+
+	return lt, lines[max(len(lines)-n, 0):], nil
+}
+
+// lastLinesOffset returns the offset of the start of the last n complete lines of a file of the given size: just
+// after the (n+1)th newline from the end. A final line without a newline, still being written, is kept whole.
+func lastLinesOffset(f *os.File, size int64, n int) (int64, error) {
+	buf := make([]byte, 4096)
+	newlines := 0
+
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		for i := len(chunk) - 1; i >= 0; i-- {
+			if chunk[i] == '\n' {
+				if newlines++; newlines > n {
+					return start + int64(i) + 1, nil
+				}
+			}
+		}
+		end = start
+	}
+
+	return 0, nil
+}
+
+// read returns the complete lines appended to the current file since the last read.
+func (lt *logTail) read() ([]string, error) {
+	var lines []string
+	buf := make([]byte, 32<<10)
+
+	for {
+		n, err := lt.f.ReadAt(buf, lt.offset)
+		lt.offset += int64(n)
+		data := buf[:n]
+
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				lt.partial = append(lt.partial, data...)
+				break
+			}
+			lt.partial = append(lt.partial, data[:i]...)
+			lines = append(lines, string(bytes.TrimSuffix(lt.partial, []byte("\r"))))
+			lt.partial = lt.partial[:0]
+			data = data[i+1:]
+		}
+		for len(lt.partial) >= lt.maxLine {
+			lines = append(lines, string(lt.partial[:lt.maxLine]))
+			lt.partial = append(lt.partial[:0], lt.partial[lt.maxLine:]...)
+		}
+
+		if errors.Is(err, io.EOF) || n == 0 {
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+	}
+}
+
+// poll returns the lines appended since the last poll. If the file was rotated, it also reports so, with the lines
+// that were left in the old file and those already in the new one.
+func (lt *logTail) poll() (before []string, rotated bool, after []string, err error) {
+	before, err = lt.read()
+	if err != nil {
+		return before, false, nil, err
+	}
+
+	info, statErr := os.Stat(lt.path)
+	switch {
+	case statErr != nil:
+		// mid-rotation: the new file is not there yet
+		return before, false, nil, nil
+	case !os.SameFile(info, lt.info):
+		f, err := os.Open(lt.path)
+		if err != nil {
+			return before, false, nil, nil
+		}
+		_ = lt.f.Close()
+		lt.f, lt.info = f, info
+	case info.Size() < lt.offset:
+		lt.info = info
+	default:
+		return before, false, nil, nil
+	}
+
+	if len(lt.partial) > 0 {
+		before = append(before, string(lt.partial))
+	}
+	lt.offset, lt.partial = 0, lt.partial[:0]
+
+	after, err = lt.read()
+	return before, true, after, err
+}
+
+// close closes the current file.
+func (lt *logTail) close() {
+	_ = lt.f.Close()
+}
@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tailEvents reads server-sent events from a TailHandler response, as "event: data" strings.
+func tailEvents(t *testing.T, sc *bufio.Scanner, n int) []string {
+	t.Helper()
+
+	var events []string
+	var event, data string
+	for len(events) < n && sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if data != "" {
+				data += "\n"
+			}
+			data += strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			events = append(events, event+": "+data)
+			event, data = "", ""
+		}
+	}
+
+	return events
+}
+
+func TestTools_TailHandler(t *testing.T) {
+	var testTools Tools
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	_ = os.WriteFile(name, []byte("one\ntwo\nthree\nfour\npart"), 0o644)
+
+	allow := func(next http.Handler) http.Handler { return next }
+	srv := httptest.NewServer(testTools.TailHandler(name, allow, TailOptions{Lines: 2, PollInterval: 10 * time.Millisecond}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", ct)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	expect := func(step string, n int, want ...string) {
+		t.Helper()
+		if got := tailEvents(t, sc, n); strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Fatalf("%s: expected %q, got %q", step, want, got)
+		}
+	}
+
+	expect("initial lines", 2, "line: three", "line: four")
+
+	appendLog := func(s string) {
+		f, _ := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0o644)
+		_, _ = f.WriteString(s)
+		_ = f.Close()
+	}
+
+	appendLog("ial\r\nfive\rsix\n")
+	expect("appended lines", 2, "line: partial", "line: five\nsix")
+
+	appendLog("last of old\n")
+	_ = os.Rename(name, name+".1")
+	_ = os.WriteFile(name, []byte("first of new\n"), 0o644)
+	expect("rotation", 3, "line: last of old", "rotate: ", "line: first of new")
+
+	_ = os.WriteFile(name, []byte("x\n"), 0o644)
+	expect("truncation", 2, "rotate: ", "line: x")
+}
+
+func TestTools_TailHandlerErrors(t *testing.T) {
+	var testTools Tools
+
+	name := filepath.Join(t.TempDir(), "app.log")
+	_ = os.WriteFile(name, []byte("secret\n"), 0o644)
+
+	rr := httptest.NewRecorder()
+	testTools.TailHandler(name, nil).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs", nil))
+	if rr.Code != http.StatusForbidden || strings.Contains(rr.Body.String(), "secret") {
+		t.Errorf("expected a nil auth to refuse, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	allow := func(next http.Handler) http.Handler { return next }
+	rr = httptest.NewRecorder()
+	testTools.TailHandler(name+".missing", allow).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/logs", nil))
+	if rr.Code != http.StatusNotFound || strings.Contains(rr.Body.String(), name) {
+		t.Errorf("expected 404 without the path, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLastLinesOffset(t *testing.T) {
+	tests := []struct {
+		content string
+		n       int
+		want    int64
+	}{
+		{"a\nb\nc\n", 2, 2},
+		{"a\nb\nc", 2, 0},
+		{"a\nb\nc\n", 0, 6},
+		{"a\nb\nc", 0, 4},
+		{"a\nb\nc\n", 10, 0},
+		{"", 3, 0},
+	}
+
+	for _, e := range tests {
+		name := filepath.Join(t.TempDir(), "log")
+		_ = os.WriteFile(name, []byte(e.content), 0o644)
+		f, _ := os.Open(name)
+
+		got, err := lastLinesOffset(f, int64(len(e.content)), e.n)
+		_ = f.Close()
+		if err != nil || got != e.want {
+			t.Errorf("%q, %d: expected %d, got %d (%v)", e.content, e.n, e.want, got, err)
+		}
+	}
+}
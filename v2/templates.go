@@ -0,0 +1,325 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Templates is a set of HTML templates loaded from a directory and rendered with Tools.RenderTemplate.
+// Each page is parsed together with the shared files, so pages can fill the blocks of a common layout, and is
+// named by its path relative to Dir, e.g. "users/show.html". When Tools.DevMode is set, the files are checked
+// for changes on every render and reparsed when one was added, removed or modified.
+// Fields:
+// - Dir: The directory holding the templates.
+// - Extensions: The extensions of template files. Defaults to .html, .gohtml and .tmpl.
+// - SharedDirs: The subdirectories whose files are parsed with every page, such as layouts and partials.
+// Defaults to "layouts" and "partials".
+// - Funcs: Functions available to every template, in addition to the view helpers of Tools.ViewHelpers. They
+// take precedence over view helpers of the same name.
+type Templates struct {
+	Dir        string
+	Extensions []string
+	SharedDirs []string
+	Funcs      template.FuncMap
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+	stamp string
+}
+
+// NewTemplates returns the templates in dir, with optional functions. They are parsed on first use, or by Load.
+func NewTemplates(dir string, funcs ...template.FuncMap) *Templates {
+	ts := &Templates{Dir: dir, Funcs: template.FuncMap{}}
+	for _, f := range funcs {
+		for name, fn := range f {
+			ts.Funcs[name] = fn
+		}
+	}
+
+	return ts
+}
+
+// templateFile is a template file found in Dir.
+type templateFile struct {
+	name   string
+	path   string
+	shared bool
+}
+
+// scan lists the template files and a stamp that changes whenever one is added, removed or modified.
+func (ts *Templates) scan() ([]templateFile, string, error) {
+	extensions := ts.Extensions
+	if len(extensions) == 0 {
+		extensions = []string{".html", ".gohtml", ".tmpl"}
+	}
+	sharedDirs := ts.SharedDirs
+	if len(sharedDirs) == 0 {
+		sharedDirs = []string{"layouts", "partials"}
+	}
+
+	var files []templateFile
+	var stamp strings.Builder
+
+	err := filepath.WalkDir(ts.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		ext := filepath.Ext(p)
+		matched := false
+		for _, e := range extensions {
+			matched = matched || strings.EqualFold(e, ext)
+		}
+		if !matched {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(ts.Dir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		shared := false
+		for _, dir := range sharedDirs {
+			shared = shared || strings.HasPrefix(name, strings.Trim(dir, "/")+"/")
+		}
+
+		files = append(files, templateFile{name: name, path: p, shared: shared})
+		fmt.Fprintf(&stamp, "%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+
+		return nil
+	})
+
+	return files, stamp.String(), err
+}
+
+// Load parses the templates, replacing the current set only if every file parses.
+// Returns the first parse error.
+func (ts *Templates) Load() error {
+	files, stamp, err := ts.scan()
+	if err != nil {
+		return err
+	}
+
+	return ts.parse(files, stamp)
+}
+
+// parse builds a template set per page from the scanned files.
+func (ts *Templates) parse(files []templateFile, stamp string) error {
+	base := template.New("").Funcs(viewHelperStubs).Funcs(ts.Funcs)
+	for _, f := range files {
+		if !f.shared {
+			continue
+		}
+		if err := parseTemplateFile(base, f); err != nil {
+			return err
+		}
+	}
+
+	pages := make(map[string]*template.Template)
+	for _, f := range files {
+		if f.shared {
+			// shared files can be rendered directly too, e.g. partials for HTML fragments
+			pages[f.name] = base
+			continue
+		}
+
+		page, err := base.Clone()
+		if err != nil {
+			return err
+		}
+		if err := parseTemplateFile(page, f); err != nil {
+			return err
+		}
+		pages[f.name] = page
+	}
+
+	ts.mu.Lock()
+	ts.pages, ts.stamp = pages, stamp
+	ts.mu.Unlock()
+
+	return nil
+}
+
+// parseTemplateFile adds a file to set under its name.
+func parseTemplateFile(set *template.Template, f templateFile) error {
+	src, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+
+	_, err = set.New(f.name).Parse(string(src))
+
+	return err
+}
+
+// lookup returns the set holding the named page, parsing the templates first if needed. With reload set, it
+// reparses them if the files changed since they were last parsed.
+func (ts *Templates) lookup(name string, reload bool) (*template.Template, error) {
+	ts.mu.RLock()
+	pages, stamp := ts.pages, ts.stamp
+	ts.mu.RUnlock()
+
+	if pages == nil || reload {
+		files, current, err := ts.scan()
+		if err != nil {
+			return nil, err
+		}
+		if pages == nil || current != stamp {
+			if err := ts.parse(files, current); err != nil {
+				return nil, err
+			}
+			ts.mu.RLock()
+			pages = ts.pages
+			ts.mu.RUnlock()
+		}
+	}
+
+	page, ok := pages[name]
+	if !ok {
+		return nil, fmt.Errorf("template %q not found", name)
+	}
+
+	return page, nil
+}
+
+// RenderTemplate executes a page of Templates and writes the HTML to the client. The page is rendered to a buffer
+// first, so a failing template never sends a partial page, and the view helpers of ViewHelpers are bound to r.
+// When DevMode is set, changed template files are reparsed before rendering, and parse and execution errors are
+// answered with an error page showing the message and the offending source lines, instead of a blank 500.
+// Otherwise nothing is written on error, leaving the response to the caller.
+// Parameters:
+// - w: The http.ResponseWriter to write the page to.
+// - r: The request being answered.
+// - status: The HTTP status code for the response.
+// - name: The page, by its path relative to the templates directory, e.g. "users/show.html".
+// - data: The data passed to the template.
+// - headers: An optional slice of http.Header, allowing for custom headers to be set. Only the first header in the slice is considered if provided.
+// Returns an error if Templates is not set, the page cannot be found, parsed or executed, or writing fails.
+func (t *Tools) RenderTemplate(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}, headers ...http.Header) error {
+	if t.Templates == nil {
+		return errors.New("toolkit: Templates is not set")
+	}
+
+	var buf bytes.Buffer
+
+	// the stored pages are never executed, so each render can clone one and bind the view helpers to the request
+	page, err := t.Templates.lookup(name, t.DevMode)
+	if err == nil {
+		page, err = page.Clone()
+	}
+	if err == nil {
+		err = page.Funcs(t.ViewHelpers(w, r)).Funcs(t.Templates.Funcs).ExecuteTemplate(&buf, name, data)
+	}
+	if err != nil {
+		if t.DevMode {
+			writeTemplateErrorPage(w, t.Templates.Dir, err)
+		}
+		return err
+	}
+
+	if len(headers) > 0 {
+		for key, value := range headers[0] {
+			w.Header()[key] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+
+	_, err = w.Write(buf.Bytes())
+
+	return err
+}
+
+// templateErrorRegex finds the file and line in html/template and text/template error messages.
+var templateErrorRegex = regexp.MustCompile(`template: ([^:\s]+):(\d+)`)
+
+// templateErrorPage is the development error page.
+var templateErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Template error</title>
+<style>
+body { margin: 0; font: 14px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #1e1e2e; color: #cdd6f4; }
+main { max-width: 960px; margin: 40px auto; padding: 0 20px; }
+h1 { color: #f38ba8; font-size: 20px; }
+.message { white-space: pre-wrap; background: #313244; border-left: 4px solid #f38ba8; padding: 12px 16px; font-family: ui-monospace, Menlo, monospace; }
+.file { margin-top: 24px; color: #a6adc8; }
+pre { background: #181825; padding: 12px 0; overflow-x: auto; font-family: ui-monospace, Menlo, monospace; }
+.line { display: block; padding: 0 16px; }
+.line span { display: inline-block; width: 4em; color: #6c7086; user-select: none; }
+.current { background: #45273a; }
+</style>
+</head>
+<body>
+<main>
+<h1>Template error</h1>
+<div class="message">{{.Message}}</div>
+{{if .File}}<div class="file">{{.File}}, line {{.Line}}</div>
+<pre>{{range .Source}}<code class="line{{if .Current}} current{{end}}"><span>{{.Number}}</span>{{.Text}}</code>{{end}}</pre>{{end}}
+</main>
+</body>
+</html>
+`))
+
+// templateSourceLine is a line shown on the error page.
+type templateSourceLine struct {
+	Number  int
+	Text    string
+	Current bool
+}
+
+// writeTemplateErrorPage answers 500 with the error and, when the message names a file and line, the lines
+// around it.
+func writeTemplateErrorPage(w http.ResponseWriter, dir string, renderErr error) {
+	page := struct {
+		Message string
+		File    string
+		Line    int
+		Source  []templateSourceLine
+	}{Message: renderErr.Error()}
+
+	if m := templateErrorRegex.FindStringSubmatch(page.Message); m != nil {
+		page.File = m[1]
+		page.Line, _ = strconv.Atoi(m[2])
+
+		name := path.Clean("/" + m[1])[1:]
+		if f, err := os.Open(filepath.Join(dir, filepath.FromSlash(name))); err == nil {
+			scanner := bufio.NewScanner(f)
+			for n := 1; scanner.Scan(); n++ {
+				if n >= page.Line-5 && n <= page.Line+5 {
+					page.Source = append(page.Source, templateSourceLine{Number: n, Text: scanner.Text(), Current: n == page.Line})
+				}
+			}
+			_ = f.Close()
+		}
+	}
+
+	var buf bytes.Buffer
+	_ = templateErrorPage.Execute(&buf, page)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = w.Write(buf.Bytes())
+}
@@ -0,0 +1,106 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTemplateFiles creates template files below dir.
+func writeTemplateFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		_ = os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTools_RenderTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"layouts/base.html":  `<title>{{block "title" .}}Site{{end}}</title><main>{{block "content" .}}{{end}}</main>`,
+		"partials/user.html": `{{define "user"}}<b>{{upper .}}</b>{{end}}`,
+		"home.html":          `{{define "title"}}Home{{end}}{{define "content"}}Hi {{template "user" .}}{{end}}{{template "layouts/base.html" .}}`,
+		"users/list.html":    `{{define "content"}}Users{{end}}{{template "layouts/base.html" .}}`,
+		"notes.txt":          `not a template`,
+	})
+
+	testTools := Tools{Templates: NewTemplates(dir, map[string]interface{}{"upper": strings.ToUpper})}
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := testTools.RenderTemplate(rr, req, http.StatusOK, "home.html", "<ann>", http.Header{"X-Test": {"1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Body.String() != `<title>Home</title><main>Hi <b>&lt;ANN&gt;</b></main>` {
+		t.Errorf("unexpected page %s", rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "text/html; charset=utf-8" || rr.Header().Get("X-Test") != "1" {
+		t.Errorf("unexpected headers %v", rr.Header())
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testTools.RenderTemplate(rr, req, http.StatusOK, "users/list.html", nil)
+	if rr.Body.String() != `<title>Site</title><main>Users</main>` {
+		t.Errorf("expected pages not to share blocks, got %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	if err := testTools.RenderTemplate(rr, req, http.StatusOK, "missing.html", nil); err == nil || rr.Body.Len() != 0 {
+		t.Errorf("expected an error and no output outside dev mode, got %v, %q", err, rr.Body.String())
+	}
+
+	// outside dev mode, changes are not picked up
+	writeTemplateFiles(t, dir, map[string]string{"users/list.html": `{{define "content"}}Changed{{end}}{{template "layouts/base.html" .}}`})
+	rr = httptest.NewRecorder()
+	_ = testTools.RenderTemplate(rr, req, http.StatusOK, "users/list.html", nil)
+	if !strings.Contains(rr.Body.String(), "Users") {
+		t.Errorf("expected the cached page, got %s", rr.Body.String())
+	}
+}
+
+func TestTools_RenderTemplate_DevMode(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{"page.html": `v1`})
+
+	testTools := Tools{Templates: NewTemplates(dir), DevMode: true}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rr := httptest.NewRecorder()
+	_ = testTools.RenderTemplate(rr, req, http.StatusOK, "page.html", nil)
+	if rr.Body.String() != "v1" {
+		t.Fatalf("unexpected page %s", rr.Body.String())
+	}
+
+	writeTemplateFiles(t, dir, map[string]string{"page.html": "line 1\nline 2\n{{.Missing}\nline 4"})
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(filepath.Join(dir, "page.html"), future, future)
+
+	rr = httptest.NewRecorder()
+	err := testTools.RenderTemplate(rr, req, http.StatusOK, "page.html", nil)
+	if err == nil || rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected a parse error page, got %d, %v", rr.Code, err)
+	}
+	for _, want := range []string{"Template error", "page.html, line 3", `<code class="line current"><span>3</span>{{.Missing}</code>`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %s in the error page, got %s", want, rr.Body.String())
+		}
+	}
+
+	writeTemplateFiles(t, dir, map[string]string{"page.html": `{{.Missing.Field}}`})
+	rr = httptest.NewRecorder()
+	if err := testTools.RenderTemplate(rr, req, http.StatusOK, "page.html", map[string]int{}); err != nil || rr.Code != http.StatusOK {
+		t.Errorf("expected the fixed page to render, got %d, %v", rr.Code, err)
+	}
+
+	rr = httptest.NewRecorder()
+	if err := testTools.RenderTemplate(rr, req, http.StatusOK, "page.html", struct{}{}); err == nil || !strings.Contains(rr.Body.String(), "executing") {
+		t.Errorf("expected an execution error page, got %v, %s", err, rr.Body.String())
+	}
+}
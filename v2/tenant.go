@@ -0,0 +1,153 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ErrNoTenant is returned when a request or context carries no valid tenant.
+var ErrNoTenant = errors.New("tenant could not be resolved")
+
+var tenantIDRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,62}$`)
+
+// TenantResolver identifies the tenant a request belongs to.
+type TenantResolver interface {
+	// ResolveTenant returns the tenant ID, or an error if there is none.
+	ResolveTenant(r *http.Request) (string, error)
+}
+
+// TenantResolverFunc adapts a function to the TenantResolver interface.
+type TenantResolverFunc func(r *http.Request) (string, error)
+
+// ResolveTenant calls f(r).
+func (f TenantResolverFunc) ResolveTenant(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// HeaderTenant resolves the tenant from a request header, e.g. "X-Tenant-ID". Only use it behind a gateway that
+// sets the header, since clients can send any value.
+func HeaderTenant(name string) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		if v := r.Header.Get(name); v != "" {
+			return v, nil
+		}
+		return "", ErrNoTenant
+	})
+}
+
+// SubdomainTenant resolves the tenant from the label of the host directly below baseDomain, so with baseDomain
+// "example.com" a request to acme.example.com belongs to tenant "acme".
+func SubdomainTenant(baseDomain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.ToLower(host)
+
+		if !strings.HasSuffix(host, suffix) {
+			return "", ErrNoTenant
+		}
+
+		labels := strings.Split(strings.TrimSuffix(host, suffix), ".")
+
+		return labels[len(labels)-1], nil
+	})
+}
+
+// ClaimTenant resolves the tenant from a claim of the Subject stored in the request context, e.g. "tenant_id"
+// from a verified token.
+func ClaimTenant(claim string) TenantResolver {
+	return TenantResolverFunc(func(r *http.Request) (string, error) {
+		if s, ok := SubjectFromContext(r.Context()); ok && s.Claims[claim] != "" {
+			return s.Claims[claim], nil
+		}
+		return "", ErrNoTenant
+	})
+}
+
+type tenantContextKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant ID.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant ID stored with WithTenant or TenantMiddleware, and whether there was one.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantContextKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantMiddleware resolves the tenant of each request and stores it in the request context. Requests without a
+// valid tenant are rejected with 400 Bad Request. Tenant IDs must be 1 to 63 letters, digits, '-' or '_',
+// starting with a letter or digit, so they are always safe as directory names and key prefixes.
+// Parameters:
+// - resolver: The TenantResolver, e.g. SubdomainTenant("example.com").
+// Returns the middleware.
+func (t *Tools) TenantMiddleware(resolver TenantResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := resolver.ResolveTenant(r)
+			if err != nil || !tenantIDRegex.MatchString(tenant) {
+				_ = t.ErrorJSON(w, ErrNoTenant)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+		})
+	}
+}
+
+// TenantPath scopes a path to the tenant in ctx. When Tools.TenantRoot is set, every file helper (UploadFiles,
+// DownloadStaticFile, DeleteFile, ListFiles, CreateShareLink) calls it, so paths passed to them are relative to
+// TenantRoot/<tenant> and one tenant's files cannot be reached from another's requests.
+// Parameters:
+// - ctx: The context carrying the tenant.
+// - p: The path within the tenant's directory. Absolute paths are treated as relative to it.
+// Returns the scoped path, p unchanged if TenantRoot is empty, ErrNoTenant if ctx has no valid tenant, or an
+// error if p escapes the tenant's directory.
+func (t *Tools) TenantPath(ctx context.Context, p string) (string, error) {
+	if t.TenantRoot == "" {
+		return p, nil
+	}
+
+	tenant, ok := TenantFromContext(ctx)
+	if !ok || !tenantIDRegex.MatchString(tenant) {
+		return "", ErrNoTenant
+	}
+
+	root := filepath.Join(t.TenantRoot, tenant)
+	full := filepath.Join(root, p)
+
+	if !pathWithin(full, root) {
+		return "", fmt.Errorf("path %q escapes the tenant directory", p)
+	}
+
+	return full, nil
+}
+
+// TenantKey prefixes an object storage key with the tenant in ctx, e.g. "acme/avatars/1.png", for bucket-based
+// stores shared between tenants.
+// Parameters:
+// - ctx: The context carrying the tenant.
+// - key: The object key within the tenant's prefix.
+// Returns the prefixed key, or ErrNoTenant if ctx has no valid tenant.
+func TenantKey(ctx context.Context, key string) (string, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok || !tenantIDRegex.MatchString(tenant) {
+		return "", ErrNoTenant
+	}
+
+	// cleaning the key as an absolute path resolves any ".." segments without leaving the prefix
+	return tenant + path.Clean("/"+key), nil
+}
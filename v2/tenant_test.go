@@ -0,0 +1,132 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTenantResolvers(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://acme.example.com:8080/", nil)
+	req.Header.Set("X-Tenant-ID", "globex")
+	req = req.WithContext(WithSubject(req.Context(), Subject{ID: "ann", Claims: map[string]string{"tenant_id": "initech"}}))
+
+	tests := []struct {
+		name     string
+		resolver TenantResolver
+		expected string
+	}{
+		{"header", HeaderTenant("X-Tenant-ID"), "globex"},
+		{"subdomain", SubdomainTenant("example.com"), "acme"},
+		{"claim", ClaimTenant("tenant_id"), "initech"},
+	}
+
+	for _, e := range tests {
+		if tenant, err := e.resolver.ResolveTenant(req); err != nil || tenant != e.expected {
+			t.Errorf("%s: expected %s, got %q, %v", e.name, e.expected, tenant, err)
+		}
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "http://example.org/", nil)
+	if _, err := SubdomainTenant("example.com").ResolveTenant(other); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant for another domain, got %v", err)
+	}
+}
+
+func TestTools_TenantMiddleware(t *testing.T) {
+	var testTools Tools
+
+	var tenant string
+	handler := testTools.TenantMiddleware(HeaderTenant("X-Tenant-ID"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ = TenantFromContext(r.Context())
+	}))
+
+	for header, expected := range map[string]int{"acme": http.StatusOK, "../etc": http.StatusBadRequest, "": http.StatusBadRequest} {
+		tenant = ""
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Tenant-ID", header)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expected {
+			t.Errorf("%q: expected status %d, got %d", header, expected, rr.Code)
+		}
+		if expected == http.StatusOK && tenant != header {
+			t.Errorf("%q: expected tenant in context, got %q", header, tenant)
+		}
+	}
+}
+
+func TestTools_TenantScopedFiles(t *testing.T) {
+	root := t.TempDir()
+	testTools := Tools{TenantRoot: root}
+
+	acme := WithTenant(context.Background(), "acme")
+	globex := WithTenant(context.Background(), "globex")
+
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	part, _ := mw.CreateFormFile("file", "plan.txt")
+	_, _ = part.Write([]byte("acme plan"))
+	_ = mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", body).WithContext(acme)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	if _, err := testTools.UploadFiles(req, "docs", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "acme", "docs", "plan.txt")); err != nil {
+		t.Errorf("expected upload inside the tenant directory: %s", err)
+	}
+
+	if files, err := testTools.ListFiles(globex, "docs"); err == nil || len(files) != 0 {
+		t.Errorf("expected another tenant not to see the file, got %v, %v", files, err)
+	}
+
+	if _, err := testTools.ListFiles(acme, "../globex"); err == nil {
+		t.Error("expected error for a path escaping the tenant directory")
+	}
+
+	if _, err := testTools.ListFiles(context.Background(), "docs"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant without a tenant, got %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(globex), "docs", "plan.txt", "plan.txt")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another tenant's file, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	testTools.DownloadStaticFile(rr, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(acme), "docs", "plan.txt", "plan.txt")
+	if rr.Code != http.StatusOK || rr.Body.String() != "acme plan" {
+		t.Errorf("expected the tenant's own file, got %d", rr.Code)
+	}
+
+	if err := testTools.DeleteFile(acme, "docs/plan.txt"); err != nil {
+		t.Errorf("expected delete to succeed, got %v", err)
+	}
+}
+
+func TestTenantKey(t *testing.T) {
+	ctx := WithTenant(context.Background(), "acme")
+
+	for key, expected := range map[string]string{"avatars/1.png": "acme/avatars/1.png", "../globex/x": "acme/globex/x", "/a//b": "acme/a/b"} {
+		if got, err := TenantKey(ctx, key); err != nil || got != expected {
+			t.Errorf("%s: expected %s, got %s, %v", key, expected, got, err)
+		}
+	}
+
+	if _, err := TenantKey(context.Background(), "x"); !errors.Is(err, ErrNoTenant) {
+		t.Errorf("expected ErrNoTenant, got %v", err)
+	}
+}
@@ -2,26 +2,65 @@ package toolkit
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+"
 
+// ErrFileTooLarge is returned when an uploaded file is larger than Tools.MaxFileSize, or an upload request larger
+// than Tools.MaxUploadSize.
+var ErrFileTooLarge = errors.New("the uploaded file is too big")
+
 // Tools is the type used to instantiate this module. Any variable of this type will have access to all the methods with the receiver *Tools.
 type Tools struct {
 	MaxFileSize        int
 	AllowedFileTypes   []string
 	MaxJSONSize        int
 	AllowUnknownFields bool
+	AssetManifest      map[string]string
+	Locker             Locker
+	GeoIP              *GeoDB
+	ShareStore         ShareStore
+	ShareBaseURL       string
+	Authorizer         Authorizer
+	TenantRoot         string
+	Serializers        *VersionedSerializers
+	Templates          *Templates
+	DevMode            bool
+	UploadParallelism  int
+	UploadWrite        UploadWriteOptions
+	FileNamer          FileNamer
+	BeforeSave         UploadHook
+	AfterSave          UploadHook
+	ContentTypes       map[string]string
+	StrictContentTypes bool
+	RememberStore      RememberStore
+	Resolver           DNSResolver
+	Privacy            *PrivacyRegistry
+	ErrorReporter      ErrorReporter
+	UploadDrainer      *UploadDrainer
+	Multipart          MultipartOptions
+	Codecs             *VersionedCodec
+	SanitizeFileNames  bool
+	SecurityHeaders    http.Header
+	DirectoryListings  bool
+	MaxUploadSize      int
 }
 
 // RandomString generates a random string of a specified length using a predefined set of characters.
@@ -41,10 +80,21 @@ func (t *Tools) RandomString(n int) string {
 }
 
 // UploadedFile is the type used to store information about a file that has been uploaded.
+// Fields:
+// - NewFileName: The name the file was stored under.
+// - OriginalFileName: The name the client sent.
+// - FileSize: The size in bytes.
+// - ContentType: The MIME type detected from the file's content, e.g. "image/png".
+// - Extension: The lower-cased extension of the original name, e.g. ".png", or the usual extension of ContentType
+// if the name has none.
+// - StoredPath: The path of the stored file, including the upload directory.
 type UploadedFile struct {
-	NewFileName      string
-	OriginalFileName string
-	FileSize         int64
+	NewFileName      string `json:"new_file_name"`
+	OriginalFileName string `json:"original_file_name"`
+	FileSize         int64  `json:"file_size"`
+	ContentType      string `json:"content_type"`
+	Extension        string `json:"extension,omitempty"`
+	StoredPath       string `json:"stored_path"`
 }
 
 // UploadOneFile processes a single file upload from an HTTP request, saving it to a specified directory.
@@ -76,7 +126,24 @@ func (t *Tools) UploadOneFile(r *http.Request, uploadDir string, rename ...bool)
 // - r: The *http.Request containing the files to be uploaded.
 // - uploadDir: The directory path where the files will be uploaded.
 // - rename: An optional boolean slice indicating whether the files should be renamed (true by default if not specified).
+// Renamed files are named by FileNamer, or with 25 random characters and the original extension if it is not set.
+// Stored names are checked with SafeJoin, so a file whose original name is unsafe fails unless it is renamed.
 // Returns a slice of pointers to UploadedFile containing information about the uploaded files, or an error if the upload fails.
+// If TenantRoot is set, uploadDir is scoped to the request's tenant, and if an Authorizer is set, the FileUpload
+// action on uploadDir is checked first.
+// Files are saved concurrently, up to UploadParallelism at a time (4 by default), and returned ordered by form
+// field name and then in the order they were sent. If any file fails, no more are started and the first error
+// in that order is returned; files already saved are kept. UploadWrite controls write buffering, atomic
+// renames and fsync. BeforeSave is called for each file before it is written and may change its StoredPath, and
+// AfterSave after it is written; an error from either aborts the file, removing it if it was already written.
+// With UploadWrite.AllOrNothing, a failure removes every file of the upload. Multipart controls how much of the
+// form is kept in memory, where the rest is buffered, and whether files are streamed to disk as they arrive.
+// If the client disconnects before the upload is complete, the files saved so far, including a partly written
+// one, are removed and ErrClientDisconnected is returned.
+// If an UploadDrainer is set, uploads are refused with a *DrainingError while it drains, and an upload it aborts
+// fails with ErrUploadAborted after removing every file it saved.
+// A file larger than MaxFileSize (1 GB by default), or a request body larger than MaxUploadSize if it is set,
+// fails with ErrFileTooLarge, which ErrorJSON answers with 413 Request Entity Too Large.
 func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) ([]*UploadedFile, error) {
 	renameFile := true
 
@@ -86,101 +153,360 @@ func (t *Tools) UploadFiles(r *http.Request, uploadDir string, rename ...bool) (
 
 	var uploadedFiles []*UploadedFile
 
+	uploadDir, err := t.TenantPath(r.Context(), uploadDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := t.authorize(r.Context(), FileUpload, uploadDir); err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	if t.UploadDrainer != nil {
+		var done func()
+		if ctx, done, err = t.UploadDrainer.begin(ctx); err != nil {
+			return nil, err
+		}
+		defer done()
+		r.Body = newContextReadCloser(ctx, r.Body)
+	}
+
 	if t.MaxFileSize == 0 {
 		t.MaxFileSize = 1024 * 1024 * 1024
 	}
+	if t.MaxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(nil, r.Body, int64(t.MaxUploadSize))
+	}
 
-	err := t.CreateDirIfNotExist(uploadDir)
+	err = t.CreateDirIfNotExist(uploadDir)
 	if err != nil {
 		return nil, err
 	}
 
-	err = r.ParseMultipartForm(int64(t.MaxFileSize))
-
-	if err != nil {
-		return nil, errors.New("the uploaded file is too big")
+	// with AllOrNothing, files are written to a staging directory and only moved into place once all are saved
+	staging := ""
+	if t.UploadWrite.AllOrNothing {
+		if staging, err = os.MkdirTemp(uploadDir, ".staging-"); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(staging)
 	}
 
-	for _, fHeaders := range r.MultipartForm.File {
-		for _, hdr := range fHeaders {
-			uploadedFiles, err = func(uploadedFiles []*UploadedFile) ([]*UploadedFile, error) {
-				var uploadedFile UploadedFile
+	var headers []*multipart.FileHeader
+	var errs []error
 
-				infoFile, err := hdr.Open()
+	// a form already parsed, e.g. by a middleware, is used as it is
+	if t.Multipart.Stream && r.MultipartForm == nil {
+		var files []*UploadedFile
+		files, headers, err = t.streamUploadFiles(ctx, r, uploadDir, renameFile, staging)
+		if isBodyTooLarge(err) {
+			err = ErrFileTooLarge
+		}
+		uploadedFiles, errs = files, []error{err}
 
-				if err != nil {
-					return nil, err
+		// the body ended early: the client went away before the request's context noticed
+		if errors.Is(err, io.ErrUnexpectedEOF) && ctx.Err() == nil {
+			if staging == "" {
+				for _, f := range uploadedFiles {
+					_ = os.Remove(f.StoredPath)
 				}
+			}
+			return nil, ErrClientDisconnected
+		}
+	} else {
+		parts, cleanup, err := t.readUploadForm(r)
+		if cleanup != nil {
+			defer cleanup()
+		}
 
-				defer infoFile.Close()
-
-				buff := make([]byte, 512)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, uploadAbortError(ctx)
+			}
+			// the body ended early: the client went away before the request's context noticed
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil, ErrClientDisconnected
+			}
+			if errors.Is(err, multipart.ErrMessageTooLarge) || isBodyTooLarge(err) {
+				return nil, ErrFileTooLarge
+			}
+			return nil, err
+		}
 
-				_, err = infoFile.Read(buff)
+		headers = make([]*multipart.FileHeader, len(parts))
+		for i, part := range parts {
+			headers[i] = part.hdr
+		}
+		uploadedFiles = make([]*UploadedFile, len(parts))
+		errs = make([]error, len(parts))
 
-				if err != nil {
-					return nil, err
-				}
+		workers := t.UploadParallelism
+		if workers < 1 {
+			workers = 4
+		}
+		workers = min(workers, len(parts))
+
+		// workers take the files in order and stop taking new ones after the first failure, as a serial loop would
+		var next int64
+		var failed atomic.Bool
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					n := int(atomic.AddInt64(&next, 1) - 1)
+					if n >= len(parts) || failed.Load() || ctx.Err() != nil {
+						return
+					}
 
-				allowed := false
-				fileType := http.DetectContentType(buff)
+					stagePath := ""
+					if staging != "" {
+						stagePath = filepath.Join(staging, strconv.Itoa(n))
+					}
 
-				if len(t.AllowedFileTypes) > 0 {
-					for _, x := range t.AllowedFileTypes {
-						if strings.EqualFold(fileType, x) {
-							allowed = true
-						}
+					uploadedFiles[n], errs[n] = t.saveUploadedFile(ctx, parts[n], uploadDir, renameFile, stagePath)
+					if errs[n] != nil {
+						failed.Store(true)
 					}
-				} else {
-					allowed = true
 				}
+			}()
+		}
+		wg.Wait()
+	}
 
-				if !allowed {
-					return nil, errors.New("file type not allowed")
+	if ctx.Err() != nil {
+		if staging == "" {
+			for _, f := range uploadedFiles {
+				if f != nil {
+					_ = os.Remove(f.StoredPath)
 				}
+			}
+		}
+		return nil, uploadAbortError(ctx)
+	}
 
-				_, err = infoFile.Seek(0, 0)
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				if err != nil {
-					return nil, err
-				}
+	if staging != "" {
+		if err := t.commitStagedUploads(ctx, uploadedFiles, headers, staging); err != nil {
+			return nil, err
+		}
+	}
 
-				if renameFile {
-					uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
-				} else {
-					uploadedFile.NewFileName = hdr.Filename
-				}
+	return uploadedFiles, nil
+}
 
-				uploadedFile.OriginalFileName = hdr.Filename
+// commitStagedUploads moves staged files into place and runs AfterSave for each, removing every file of the
+// batch if one fails.
+func (t *Tools) commitStagedUploads(ctx context.Context, files []*UploadedFile, headers []*multipart.FileHeader, staging string) error {
+	rollback := func(moved int) {
+		for _, f := range files[:moved] {
+			_ = os.Remove(f.StoredPath)
+		}
+	}
 
-				var outFile *os.File
+	for i, f := range files {
+		if err := os.Rename(filepath.Join(staging, strconv.Itoa(i)), f.StoredPath); err != nil {
+			rollback(i)
+			return err
+		}
+	}
 
-				defer outFile.Close()
+	if t.AfterSave != nil {
+		for i, f := range files {
+			if err := t.AfterSave(ctx, f, headers[i]); err != nil {
+				rollback(len(files))
+				return err
+			}
+		}
+	}
 
-				if outFile, err = os.Create(filepath.Join(uploadDir, uploadedFile.NewFileName)); err != nil {
-					return nil, err
-				} else {
-					fileSize, err := io.Copy(outFile, infoFile)
+	return nil
+}
 
-					if err != nil {
-						return nil, err
-					}
+// isBodyTooLarge reports whether err is from a request body over the limit of http.MaxBytesReader.
+func isBodyTooLarge(err error) bool {
+	var maxBytesError *http.MaxBytesError
+	return errors.As(err, &maxBytesError)
+}
 
-					uploadedFile.FileSize = fileSize
-				}
+// multipartFileHeaders returns the files of a form, ordered by field name and then as sent.
+func multipartFileHeaders(form *multipart.Form) []*multipart.FileHeader {
+	fields := make([]string, 0, len(form.File))
+	for field := range form.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var headers []*multipart.FileHeader
+	for _, field := range fields {
+		headers = append(headers, form.File[field]...)
+	}
 
-				uploadedFiles = append(uploadedFiles, &uploadedFile)
+	return headers
+}
 
-				return uploadedFiles, nil
-			}(uploadedFiles)
+// saveUploadedFile checks the type of an uploaded file and saves it to uploadDir, running the upload hooks. If
+// stagePath is set, the file is written there instead and AfterSave is left to commitStagedUploads.
+func (t *Tools) saveUploadedFile(ctx context.Context, part uploadPart, uploadDir string, renameFile bool, stagePath string) (*UploadedFile, error) {
+	var uploadedFile UploadedFile
 
-			if err != nil {
-				return uploadedFiles, err
+	hdr := part.hdr
+	maxSize := int64(t.MaxFileSize)
+	if maxSize > 0 && hdr.Size > maxSize {
+		return nil, ErrFileTooLarge
+	}
+
+	infoFile, err := part.open()
+	if err != nil {
+		return nil, err
+	}
+	defer infoFile.Close()
+
+	buff := make([]byte, 512)
+
+	// streamed files arrive in chunks, so read until the buffer is full
+	n, err := io.ReadFull(infoFile, buff)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	// only sniff what was read, or the zero padding of small files makes them look binary
+	fileType := http.DetectContentType(buff[:n])
+
+	if len(t.AllowedFileTypes) > 0 {
+		for _, x := range t.AllowedFileTypes {
+			if strings.EqualFold(fileType, x) {
+				allowed = true
 			}
 		}
+	} else {
+		allowed = true
 	}
 
-	return uploadedFiles, nil
+	if !allowed {
+		return nil, errors.New("file type not allowed")
+	}
+
+	// files of a parsed form are read again from the start, and streamed ones continue after what was sniffed
+	src := io.Reader(infoFile)
+	if seeker, ok := infoFile.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else {
+		src = io.MultiReader(bytes.NewReader(buff[:n]), infoFile)
+		// the size of a streamed file is only known once it is read
+		if maxSize > 0 {
+			src = &maxSizeReader{r: src, n: maxSize}
+		}
+	}
+
+	if renameFile && t.FileNamer != nil {
+		uploadedFile.NewFileName = t.FileNamer(hdr)
+	} else if renameFile {
+		uploadedFile.NewFileName = fmt.Sprintf("%s%s", t.RandomString(25), filepath.Ext(hdr.Filename))
+	} else if t.SanitizeFileNames {
+		uploadedFile.NewFileName = SanitizeFileName(hdr.Filename)
+	} else {
+		uploadedFile.NewFileName = hdr.Filename
+	}
+
+	uploadedFile.OriginalFileName = hdr.Filename
+	uploadedFile.ContentType = fileType
+	uploadedFile.Extension = uploadedFileExtension(hdr.Filename, fileType)
+	if uploadedFile.StoredPath, err = t.SafeJoin(uploadDir, uploadedFile.NewFileName); err != nil {
+		return nil, err
+	}
+	uploadedFile.FileSize = hdr.Size
+
+	if t.BeforeSave != nil {
+		if err := t.BeforeSave(ctx, &uploadedFile, hdr); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(uploadedFile.StoredPath), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	// files on disk keep the kernel's copy, and are checked once copied
+	if _, ok := infoFile.(*os.File); !ok {
+		src = contextReader{ctx, src}
+	}
+
+	if stagePath != "" {
+		if uploadedFile.FileSize, err = writeUploadFile(stagePath, src, t.UploadWrite); err != nil {
+			if ctx.Err() != nil {
+				return nil, uploadAbortError(ctx)
+			}
+			return nil, err
+		}
+		return &uploadedFile, nil
+	}
+
+	fileSize, err := writeUploadFile(uploadedFile.StoredPath, src, t.UploadWrite)
+	if ctx.Err() != nil {
+		if err == nil {
+			_ = os.Remove(uploadedFile.StoredPath)
+		}
+		return nil, uploadAbortError(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	uploadedFile.FileSize = fileSize
+
+	if t.AfterSave != nil {
+		if err := t.AfterSave(ctx, &uploadedFile, hdr); err != nil {
+			_ = os.Remove(uploadedFile.StoredPath)
+			return nil, err
+		}
+	}
+
+	return &uploadedFile, nil
+}
+
+// commonExtensions are the preferred extensions of common MIME types, which have several in the system tables.
+var commonExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+	"text/plain":      ".txt",
+	"text/html":       ".html",
+	"video/mp4":       ".mp4",
+	"audio/mpeg":      ".mp3",
+}
+
+// uploadedFileExtension returns the lower-cased extension of name, or the usual extension of contentType.
+func uploadedFileExtension(name, contentType string) string {
+	if ext := filepath.Ext(name); ext != "" {
+		return strings.ToLower(ext)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	if ext, ok := commonExtensions[mediaType]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+
+	return ""
 }
 
 // CreateDirIfNotExist checks for the existence of a directory and creates it if it does not exist.
@@ -225,25 +551,49 @@ func (t *Tools) Slugify(s string) (string, error) {
 // - r: The *http.Request that represents the client's request.
 // - path: The base directory path where the static file is located.
 // - file: The name of the file to be downloaded.
-// - displayName: The name that will be used for the downloaded file on the client's side.
-// This function constructs the full file path by joining the base path and the file name, sets the Content-Disposition header
-// to make the browser treat the response as a file to be downloaded, and then serves the file using http.ServeFile.
-func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, path, file, displayName string) {
-	filePath := filepath.Join(path, file)
+// - displayName: The name that will be used for the downloaded file on the client's side. Any characters are allowed.
+// - opts: Optional DownloadOptions. Only the first value is used if multiple are provided.
+// The Content-Type comes from ContentTypes, a map of lower-case extensions such as ".md" to types, or else the
+// system's type for the extension. With StrictContentTypes, files of unknown types and types browsers run scripts
+// in, such as HTML and SVG, are served as application/octet-stream attachments, so uploads cannot be used for
+// stored XSS.
+// This function constructs the full file path by joining the base path and the file name with SafeJoin, answering 404 Not Found for unsafe names, sets the Content-Disposition header
+// to make the browser treat the response as a file to be downloaded, and then serves the file with ServeContentFrom, which supports range requests and sends the file with sendfile where possible.
+// If TenantRoot is set, the path is scoped to the request's tenant, and if an Authorizer is set, the FileDownload
+// action is checked first and denied requests get 403 Forbidden.
+func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, path, file, displayName string, opts ...DownloadOptions) {
+	var o DownloadOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	filePath, err := t.SafeJoin(path, file)
+	if err == nil {
+		filePath, err = t.TenantPath(r.Context(), filePath)
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
 
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+	if err := t.authorize(r.Context(), FileDownload, filePath); err != nil {
+		writeAccessError(w)
+		return
+	}
 
-	http.ServeFile(w, r, filePath)
+	t.serveAttachment(w, r, filePath, displayName, o)
 }
 
 // JSONResponse represents the structure of a JSON response.
 // Fields:
 // - Error: A boolean indicating if the response signifies an error.
 // - Message: A string containing a message, typically used for providing feedback to the client.
+// - Code: A stable, machine-readable error code, such as a JSONErrorCode. It's omitted if empty.
 // - Data: An interface{} that can hold any data type, used for sending the actual response data. It's omitted if empty.
 type JSONResponse struct {
 	Error   bool        `json:"error"`
 	Message string      `json:"message"`
+	Code    string      `json:"code,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 }
 
@@ -254,6 +604,7 @@ type JSONResponse struct {
 // - r: The *http.Request containing the JSON to be read.
 // - data: The data structure where the decoded JSON will be stored.
 // Returns an error if the request body exceeds the maximum size, is empty, contains badly-formed JSON, or other decoding issues occur.
+// Errors are always of type *JSONError, carrying a stable JSONErrorCode alongside the message.
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
 	maxBytes := 1024 * 1024
 	if t.MaxJSONSize != 0 {
@@ -273,42 +624,48 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 		var syntaxError *json.SyntaxError
 		var unmarshalTypeError *json.UnmarshalTypeError
 		var invalidUnmarshalError *json.InvalidUnmarshalError
+		var maxBytesError *http.MaxBytesError
 
 		switch {
 		case errors.As(err, &syntaxError):
-			return fmt.Errorf("request body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+			return &JSONError{Code: JSONErrSyntax, Message: fmt.Sprintf("request body contains badly-formed JSON (at character %d)", syntaxError.Offset), Offset: syntaxError.Offset, Err: err}
 
 		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("request body contains badly-formed JSON")
+			return &JSONError{Code: JSONErrUnexpectedEOF, Message: "request body contains badly-formed JSON", Err: err}
 
 		case errors.As(err, &unmarshalTypeError):
 			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("request body contains an invalid value for the %q field", unmarshalTypeError.Field)
+				field := sanitizeJSONField(unmarshalTypeError.Field)
+				return &JSONError{Code: JSONErrInvalidType, Message: fmt.Sprintf("request body contains an invalid value for the %q field", field), Field: field, Offset: unmarshalTypeError.Offset, Err: err}
 			}
 
-			return fmt.Errorf("request body contains an invalid value (at character %d)", unmarshalTypeError.Offset)
+			return &JSONError{Code: JSONErrInvalidType, Message: fmt.Sprintf("request body contains an invalid value (at character %d)", unmarshalTypeError.Offset), Offset: unmarshalTypeError.Offset, Err: err}
 
 		case errors.Is(err, io.EOF):
-			return errors.New("request body must not be empty")
+			return &JSONError{Code: JSONErrEmptyBody, Message: "request body must not be empty", Err: err}
 
 		case strings.HasPrefix(err.Error(), "json: unknown field "):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
-			return fmt.Errorf("request body contains unknown field %s", fieldName)
+			fieldName, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			if unquoteErr != nil {
+				fieldName = strings.TrimPrefix(err.Error(), "json: unknown field ")
+			}
+			field := sanitizeJSONField(fieldName)
+			return &JSONError{Code: JSONErrUnknownField, Message: fmt.Sprintf("request body contains unknown field %q", field), Field: field, Err: err}
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("request body must not be larger than %d bytes", maxBytes)
+		case errors.As(err, &maxBytesError):
+			return &JSONError{Code: JSONErrTooLarge, Message: fmt.Sprintf("request body must not be larger than %d bytes", maxBytes), Err: err}
 
 		case errors.As(err, &invalidUnmarshalError):
-			return fmt.Errorf("error unmarshalling JSON: %s", err.Error())
+			return &JSONError{Code: JSONErrInvalidTarget, Message: fmt.Sprintf("error unmarshalling JSON: %s", err.Error()), Err: err}
 
 		default:
-			return err
+			return &JSONError{Code: JSONErrUnknown, Message: err.Error(), Err: err}
 		}
 	}
 
 	err = dec.Decode(&struct{}{})
 	if err != io.EOF {
-		return errors.New("body must only contain a single JSON object")
+		return &JSONError{Code: JSONErrMultipleValues, Message: "body must only contain a single JSON object", Err: err}
 	}
 
 	return nil
@@ -321,9 +678,19 @@ func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{
 // - status: The HTTP status code for the response.
 // - data: The data to be marshaled into JSON and sent in the response body.
 // - headers: An optional slice of http.Header, allowing for custom headers to be set. Only the first header in the slice is considered if provided.
+// If Serializers is set, data is first converted for the API version found by APIVersionMiddleware.
+// If Codecs is set, a JSONResponse envelope is then encoded in the envelope version selected for the request.
 // Returns an error if marshaling the data into JSON fails or if writing the response fails.
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
-	out, err := json.Marshal(data)
+	return writeJSONValue(w, status, t.encodeEnvelope(w, status, t.serializeForVersion(w, data)), headers...)
+}
+
+// writeJSONValue marshals data, already serialized and enveloped, and writes it with the given status and headers.
+func writeJSONValue(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	out, err := encodeJSON(buf, data, "", true)
 	if err != nil {
 		return err
 	}
@@ -347,6 +714,12 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 
 // ErrorJSON sends a JSON-formatted error response to the client with an optional HTTP status code.
 // This function constructs a JSONResponse struct with the error flag set to true and the error message from the provided error.
+// If the error carries a machine-readable code, such as a JSONErrorCode, it is included in the response's code field.
+// A *ThrottleError or *RateLimitError sets the Retry-After header and defaults the status to http.StatusTooManyRequests (429).
+// A *DrainingError sets the Retry-After header and defaults the status to http.StatusServiceUnavailable (503).
+// An error matching ErrForbidden defaults the status to http.StatusForbidden (403).
+// An error matching ErrFileTooLarge defaults the status to http.StatusRequestEntityTooLarge (413).
+// Errors answered with a 5xx status are sent to Tools.ErrorReporter, if set, with the request when RecoverMiddleware is in use.
 // If an HTTP status code is provided in the variadic 'status' parameter, it uses that status code for the response; otherwise, it defaults to http.StatusBadRequest (400).
 // Parameters:
 // - w: The http.ResponseWriter to write the error response to.
@@ -356,13 +729,51 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
 	statusCode := http.StatusBadRequest
 
+	var retryAfter string
+	var throttleError *ThrottleError
+	var rateLimitError *RateLimitError
+	var drainingError *DrainingError
+	if errors.As(err, &throttleError) {
+		retryAfter = throttleError.retryAfterSeconds()
+	} else if errors.As(err, &rateLimitError) {
+		retryAfter = rateLimitError.retryAfterSeconds()
+	}
+	if retryAfter != "" {
+		statusCode = http.StatusTooManyRequests
+	}
+	if errors.As(err, &drainingError) {
+		retryAfter = drainingError.retryAfterSeconds()
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	if errors.Is(err, ErrForbidden) {
+		statusCode = http.StatusForbidden
+	}
+	if errors.Is(err, ErrFileTooLarge) {
+		statusCode = http.StatusRequestEntityTooLarge
+	}
+
 	if len(status) > 0 {
 		statusCode = status[0]
 	}
 
+	if statusCode >= http.StatusInternalServerError && t.ErrorReporter != nil && drainingError == nil {
+		r := writerRequest(w)
+		ctx := context.Background()
+		if r != nil {
+			ctx = r.Context()
+		}
+		t.reportError(ctx, newErrorReport(r, err.Error(), errorType(err), statusCode, 1))
+	}
+
 	var payload JSONResponse
 	payload.Error = true
 	payload.Message = err.Error()
+	payload.Code = errorCode(err)
+
+	if retryAfter != "" {
+		return t.WriteJSON(w, statusCode, payload, http.Header{"Retry-After": {retryAfter}})
+	}
 
 	return t.WriteJSON(w, statusCode, payload)
 }
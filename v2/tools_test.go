@@ -12,6 +12,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -123,6 +125,111 @@ func TestTools_UploadFiles(t *testing.T) {
 	}
 }
 
+func TestTools_UploadFilesParallel(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, f := range []struct{ field, name string }{
+		{"b", "b1.txt"}, {"a", "a1.txt"}, {"b", "b2.txt"}, {"a", "a2.txt"}, {"a", "a3.txt"}, {"c", "c1.txt"},
+	} {
+		part, _ := writer.CreateFormFile(f.field, f.name)
+		_, _ = part.Write([]byte("content of " + f.name))
+	}
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	testTools := Tools{UploadParallelism: 3}
+	dir := t.TempDir()
+
+	uploadedFiles, err := testTools.UploadFiles(request, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range uploadedFiles {
+		names = append(names, f.OriginalFileName)
+		if data, err := os.ReadFile(filepath.Join(dir, f.NewFileName)); err != nil || string(data) != "content of "+f.OriginalFileName {
+			t.Errorf("unexpected content for %s: %q, %v", f.OriginalFileName, data, err)
+		}
+	}
+	if got := strings.Join(names, ","); got != "a1.txt,a2.txt,a3.txt,b1.txt,b2.txt,c1.txt" {
+		t.Errorf("expected files ordered by field, got %s", got)
+	}
+
+	var failing bytes.Buffer
+	writer = multipart.NewWriter(&failing)
+	part, _ := writer.CreateFormFile("a", "ok.txt")
+	_, _ = part.Write([]byte("text"))
+	_, _ = writer.CreateFormFile("b", "empty.txt")
+	_ = writer.Close()
+
+	request = httptest.NewRequest("POST", "/", &failing)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	if files, err := testTools.UploadFiles(request, dir, false); err == nil || files != nil {
+		t.Errorf("expected an error and no files, got %v, %v", files, err)
+	}
+}
+
+var uploadedFileExtensionTests = []struct {
+	name        string
+	filename    string
+	contentType string
+	expected    string
+}{
+	{name: "from name", filename: "Photo.JPG", contentType: "image/jpeg", expected: ".jpg"},
+	{name: "from content type", filename: "photo", contentType: "image/jpeg", expected: ".jpg"},
+	{name: "with parameters", filename: "notes", contentType: "text/plain; charset=utf-8", expected: ".txt"},
+	{name: "unknown", filename: "blob", contentType: "application/x-unknown-thing", expected: ""},
+}
+
+func TestTools_UploadedFileExtension(t *testing.T) {
+	for _, e := range uploadedFileExtensionTests {
+		if got := uploadedFileExtension(e.filename, e.contentType); got != e.expected {
+			t.Errorf("%s: expected %q, got %q", e.name, e.expected, got)
+		}
+	}
+}
+
+func TestTools_UploadFilesMetadata(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", "notes")
+	_, _ = part.Write([]byte("plain text notes"))
+	_ = writer.Close()
+
+	request := httptest.NewRequest("POST", "/", &body)
+	request.Header.Add("Content-Type", writer.FormDataContentType())
+
+	var testTools Tools
+	dir := t.TempDir()
+
+	file, err := testTools.UploadOneFile(request, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("expected the detected content type, got %s", file.ContentType)
+	}
+	if file.Extension != ".txt" {
+		t.Errorf("expected .txt, got %s", file.Extension)
+	}
+	if file.StoredPath != filepath.Join(dir, file.NewFileName) {
+		t.Errorf("unexpected stored path %s", file.StoredPath)
+	}
+	if _, err := os.Stat(file.StoredPath); err != nil {
+		t.Error(err)
+	}
+
+	out, _ := json.Marshal(file)
+	if !strings.Contains(string(out), `"content_type":"text/plain; charset=utf-8"`) {
+		t.Errorf("expected snake_case JSON fields, got %s", out)
+	}
+}
+
 func TestTools_UploadOneFile(t *testing.T) {
 	pr, pw := io.Pipe()
 	writer := multipart.NewWriter(pw)
@@ -0,0 +1,442 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// TrafficBody is a recorded request or response body. JSON bodies are kept as JSON, so traffic files can be read
+// and edited with tools such as jq; other text is kept as a string and binary data as base64.
+// Fields:
+// - JSON: The body, if it is a JSON document.
+// - Text: The body, if it is other UTF-8 text.
+// - Base64: The body, base64-encoded, if it is neither.
+// - Truncated: Whether the body was cut at the recording's MaxBody.
+type TrafficBody struct {
+	JSON      json.RawMessage `json:"json,omitempty"`
+	Text      string          `json:"text,omitempty"`
+	Base64    string          `json:"base64,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// newTrafficBody records data, sent with the given Content-Type.
+func newTrafficBody(data []byte, contentType string, truncated bool) *TrafficBody {
+	if len(data) == 0 {
+		return nil
+	}
+
+	b := &TrafficBody{Truncated: truncated}
+	switch mediaType, _, _ := mime.ParseMediaType(contentType); {
+	case (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && json.Valid(data):
+		var buf bytes.Buffer
+		if json.Compact(&buf, data) == nil {
+			b.JSON = buf.Bytes()
+			break
+		}
+		fallthrough
+	case utf8.Valid(data):
+		b.Text = string(data)
+	default:
+		b.Base64 = base64.StdEncoding.EncodeToString(data)
+	}
+
+	return b
+}
+
+// Bytes returns the body.
+func (b *TrafficBody) Bytes() []byte {
+	switch {
+	case b == nil:
+		return nil
+	case b.JSON != nil:
+		return b.JSON
+	case b.Base64 != "":
+		data, _ := base64.StdEncoding.DecodeString(b.Base64)
+		return data
+	}
+
+	return []byte(b.Text)
+}
+
+// TrafficRequest is a recorded request.
+// Fields:
+// - Method: The request method.
+// - URL: The request URI, i.e. the path and query.
+// - Header: The request headers, with sensitive ones redacted.
+// - Body: The request body, if any.
+type TrafficRequest struct {
+	Method string       `json:"method"`
+	URL    string       `json:"url"`
+	Header http.Header  `json:"header,omitempty"`
+	Body   *TrafficBody `json:"body,omitempty"`
+}
+
+// TrafficResponse is a recorded response.
+// Fields:
+// - Status: The status code.
+// - Header: The response headers, with sensitive ones redacted.
+// - Body: The response body, if any.
+type TrafficResponse struct {
+	Status int          `json:"status"`
+	Header http.Header  `json:"header,omitempty"`
+	Body   *TrafficBody `json:"body,omitempty"`
+}
+
+// TrafficRecord is a request and its response, stored as one line of a JSON Lines traffic file.
+// Fields:
+// - Time: When the request was received.
+// - Duration: How long the handler took, in milliseconds.
+// - Request: The request.
+// - Response: The response.
+type TrafficRecord struct {
+	Time     time.Time       `json:"time"`
+	Duration float64         `json:"duration_ms"`
+	Request  TrafficRequest  `json:"request"`
+	Response TrafficResponse `json:"response"`
+}
+
+// TrafficRecordOptions configures RecordTraffic.
+// Fields:
+// - MaxBody: The most bytes of each body recorded. Longer bodies are truncated and marked, and are not compared
+// on replay. Defaults to 1 MB.
+// - Redactor: Redacts the headers and JSON bodies recorded. Defaults to NewRedactor(), so credentials such as
+// Authorization headers and passwords are not written to the file.
+// - Skip: If set, requests it returns true for are not recorded, e.g. health checks.
+// - ErrorLog: If set, receives records that could not be written. They are dropped silently by default.
+type TrafficRecordOptions struct {
+	MaxBody  int64
+	Redactor *Redactor
+	Skip     func(r *http.Request) bool
+	ErrorLog func(err error)
+}
+
+// RecordTraffic returns middleware writing every request and its response to w as JSON Lines, one TrafficRecord
+// per line, for ReplayTraffic to check a new version of a JSON API against. Records are written as responses
+// complete, and writes are serialized, so w can be a file shared by concurrent requests.
+// Parameters:
+// - w: The destination, e.g. a file opened for appending.
+// - opts: Optional TrafficRecordOptions. Only the first value is used if multiple are provided.
+// Returns the middleware.
+func (t *Tools) RecordTraffic(w io.Writer, opts ...TrafficRecordOptions) func(http.Handler) http.Handler {
+	var o TrafficRecordOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.MaxBody <= 0 {
+		o.MaxBody = 1 << 20
+	}
+	if o.Redactor == nil {
+		o.Redactor = NewRedactor()
+	}
+
+	var mu sync.Mutex
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if o.Skip != nil && o.Skip(r) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			start := time.Now()
+			rec := TrafficRecord{
+				Time:    start.UTC(),
+				Request: TrafficRequest{Method: r.Method, URL: r.URL.RequestURI(), Header: o.Redactor.RedactHeader(r.Header)},
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				data, err := io.ReadAll(io.LimitReader(r.Body, o.MaxBody+1))
+				r.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+				if err == nil {
+					truncated := int64(len(data)) > o.MaxBody
+					rec.Request.Body = redactTrafficBody(o.Redactor, newTrafficBody(data[:min(int64(len(data)), o.MaxBody)], r.Header.Get("Content-Type"), truncated))
+				}
+			}
+
+			tw := &trafficWriter{ResponseWriter: rw, max: o.MaxBody}
+			next.ServeHTTP(tw, r)
+
+			rec.Duration = float64(time.Since(start).Microseconds()) / 1000
+			rec.Response = TrafficResponse{
+				Status: tw.Status(),
+				Header: o.Redactor.RedactHeader(tw.Header()),
+				Body:   redactTrafficBody(o.Redactor, newTrafficBody(tw.body.Bytes(), tw.Header().Get("Content-Type"), tw.truncated)),
+			}
+
+			line, err := json.Marshal(rec)
+			if err == nil {
+				mu.Lock()
+				_, err = w.Write(append(line, '\n'))
+				mu.Unlock()
+			}
+			if err != nil && o.ErrorLog != nil {
+				o.ErrorLog(fmt.Errorf("could not record %s %s: %w", r.Method, r.URL.Path, err))
+			}
+		})
+	}
+}
+
+// redactTrafficBody redacts the sensitive fields of a JSON body.
+func redactTrafficBody(rd *Redactor, b *TrafficBody) *TrafficBody {
+	if b != nil && b.JSON != nil {
+		b.JSON = rd.RedactJSON(b.JSON)
+	}
+
+	return b
+}
+
+// trafficWriter keeps a copy of the response for RecordTraffic.
+type trafficWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	max       int64
+	truncated bool
+}
+
+// WriteHeader records the status code before delegating to the wrapped writer.
+func (tw *trafficWriter) WriteHeader(status int) {
+	if tw.status == 0 && status >= 200 {
+		tw.status = status
+	}
+	tw.ResponseWriter.WriteHeader(status)
+}
+
+// Write copies up to max bytes of the body before delegating to the wrapped writer.
+func (tw *trafficWriter) Write(b []byte) (int, error) {
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+
+	if room := tw.max - int64(tw.body.Len()); room < int64(len(b)) {
+		tw.body.Write(b[:max(room, 0)])
+		tw.truncated = true
+	} else {
+		tw.body.Write(b)
+	}
+
+	return tw.ResponseWriter.Write(b)
+}
+
+// Status returns the status code written, or 200 if the handler wrote nothing.
+func (tw *trafficWriter) Status() int {
+	if tw.status == 0 {
+		return http.StatusOK
+	}
+
+	return tw.status
+}
+
+// Flush implements http.Flusher when the wrapped writer supports it.
+func (tw *trafficWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the wrapped writer to http.ResponseController.
+func (tw *trafficWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
+
+// TrafficReader reads a traffic file written by RecordTraffic, one record at a time, so large files can be
+// filtered or inspected without loading them whole.
+type TrafficReader struct {
+	r    *bufio.Reader
+	line int
+}
+
+// NewTrafficReader creates a TrafficReader reading from r.
+func NewTrafficReader(r io.Reader) *TrafficReader {
+	return &TrafficReader{r: bufio.NewReader(r)}
+}
+
+// Line returns the line number of the last record read.
+func (tr *TrafficReader) Line() int {
+	return tr.line
+}
+
+// Next returns the next record, skipping blank lines.
+// Returns the record, io.EOF at the end of the file, or an error naming the line that is not a valid record.
+func (tr *TrafficReader) Next() (TrafficRecord, error) {
+	for {
+		data, err := tr.r.ReadBytes('\n')
+		if len(data) == 0 && err != nil {
+			return TrafficRecord{}, err
+		}
+		tr.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var rec TrafficRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return TrafficRecord{}, fmt.Errorf("traffic line %d: %w", tr.line, err)
+		}
+		if rec.Request.Method == "" || !strings.HasPrefix(rec.Request.URL, "/") {
+			return TrafficRecord{}, fmt.Errorf("traffic line %d: a record needs a method and a URL starting with /", tr.line)
+		}
+
+		return rec, nil
+	}
+}
+
+// TrafficReplayOptions configures ReplayTraffic.
+// Fields:
+// - Ignore: JSON pointers left out when comparing JSON response bodies, e.g. "/id" or "/data/created_at".
+// - Headers: Response headers compared besides the status and body, e.g. "Content-Type". None by default.
+// - Header: Headers set on every replayed request, e.g. an Authorization header replacing the one redacted when
+// recording.
+// - Filter: If set, only the records it returns true for are replayed.
+type TrafficReplayOptions struct {
+	Ignore  []string
+	Headers []string
+	Header  http.Header
+	Filter  func(rec *TrafficRecord) bool
+}
+
+// TrafficMismatch is a replayed request whose response differs from the recording.
+// Fields:
+// - Line: The line of the record in the traffic file.
+// - Method: The request method.
+// - URL: The request URI.
+// - Problems: The differences, e.g. "status: expected 200, got 500" or "replace /total: expected 10, got 12".
+type TrafficMismatch struct {
+	Line     int      `json:"line"`
+	Method   string   `json:"method"`
+	URL      string   `json:"url"`
+	Problems []string `json:"problems"`
+}
+
+// TrafficReport is the outcome of ReplayTraffic.
+// Fields:
+// - Total: The number of requests replayed.
+// - Passed: The number of responses matching their recording.
+// - Mismatches: The responses that did not.
+type TrafficReport struct {
+	Total      int               `json:"total"`
+	Passed     int               `json:"passed"`
+	Mismatches []TrafficMismatch `json:"mismatches,omitempty"`
+}
+
+// OK reports whether every response matched its recording.
+func (r *TrafficReport) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// ReplayTraffic sends the requests of a traffic file to a handler, in order, and compares the responses with the
+// recorded ones: the status, the body, semantically for JSON, and the chosen headers. Values redacted when recording
+// are not compared. It is meant for regression tests of JSON APIs, e.g. with traffic recorded from the current
+// version and replayed against a new one in a test.
+// Parameters:
+// - h: The handler under test, e.g. the application's router.
+// - r: The traffic file, as written by RecordTraffic.
+// - opts: Optional TrafficReplayOptions. Only the first value is used if multiple are provided.
+// Returns the report, or an error if the file cannot be read. Mismatches are reported, not returned as errors.
+func (t *Tools) ReplayTraffic(h http.Handler, r io.Reader, opts ...TrafficReplayOptions) (*TrafficReport, error) {
+	var o TrafficReplayOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	report := &TrafficReport{}
+	tr := NewTrafficReader(r)
+
+	for {
+		rec, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		if o.Filter != nil && !o.Filter(&rec) {
+			continue
+		}
+
+		req, err := http.NewRequest(rec.Request.Method, rec.Request.URL, bytes.NewReader(rec.Request.Body.Bytes()))
+		if err != nil {
+			return report, fmt.Errorf("traffic line %d: %w", tr.Line(), err)
+		}
+		req.RequestURI = rec.Request.URL
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header = rec.Request.Header.Clone()
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		for k, vs := range o.Header {
+			req.Header[k] = append([]string(nil), vs...)
+		}
+		req.Host = req.Header.Get("Host")
+
+		resp := newResponseRecorder(nil)
+		h.ServeHTTP(resp, req)
+		if resp.status == 0 {
+			resp.status = http.StatusOK
+		}
+
+		report.Total++
+		if problems := t.compareTraffic(&rec.Response, resp, o); len(problems) > 0 {
+			report.Mismatches = append(report.Mismatches, TrafficMismatch{Line: tr.Line(), Method: rec.Request.Method, URL: rec.Request.URL, Problems: problems})
+		} else {
+			report.Passed++
+		}
+	}
+}
+
+// compareTraffic lists the differences between a recorded response and a replayed one.
+func (t *Tools) compareTraffic(want *TrafficResponse, got *responseRecorder, o TrafficReplayOptions) []string {
+	var problems []string
+	if want.Status != got.status {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d", want.Status, got.status))
+	}
+
+	for _, h := range o.Headers {
+		if w, g := want.Header.Get(h), got.header.Get(h); w != g {
+			problems = append(problems, fmt.Sprintf("header %s: expected %q, got %q", h, w, g))
+		}
+	}
+
+	switch {
+	case want.Body != nil && want.Body.Truncated:
+	case want.Body != nil && want.Body.JSON != nil:
+		patch, err := t.DiffJSON(want.Body.JSON, got.body.Bytes(), JSONDiffOptions{Ignore: o.Ignore})
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("body: expected JSON, got %.100q", got.body.String()))
+			break
+		}
+		redacted, _ := json.Marshal(NewRedactor().replacement())
+		for _, op := range patch {
+			switch {
+			case op.Op == "replace" && bytes.Equal(op.Old, redacted):
+				// the recording was redacted, so the value cannot be compared
+			case op.Op == "add":
+				problems = append(problems, fmt.Sprintf("add %s: got %s", op.Path, op.Value))
+			case op.Op == "remove":
+				problems = append(problems, fmt.Sprintf("remove %s: expected %s", op.Path, op.Old))
+			default:
+				problems = append(problems, fmt.Sprintf("%s %s: expected %s, got %s", op.Op, op.Path, op.Old, op.Value))
+			}
+		}
+	case !bytes.Equal(want.Body.Bytes(), got.body.Bytes()):
+		problems = append(problems, fmt.Sprintf("body: expected %.100q, got %.100q", want.Body.Bytes(), got.body.Bytes()))
+	}
+
+	return problems
+}
@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_RecordTraffic(t *testing.T) {
+	var testTools Tools
+	var buf bytes.Buffer
+
+	api := func(total int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/orders":
+				var in struct {
+					Items []int `json:"items"`
+				}
+				if err := testTools.ReadJSON(w, r, &in); err != nil {
+					_ = testTools.ErrorJSON(w, err)
+					return
+				}
+				_ = testTools.WriteJSON(w, http.StatusCreated, map[string]interface{}{"id": r.URL.Query().Get("n"), "total": total, "token": "secret"})
+			case "/logo":
+				w.Header().Set("Content-Type", "image/png")
+				_, _ = w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+			default:
+				http.NotFound(w, r)
+			}
+		})
+	}
+
+	recorder := testTools.RecordTraffic(&buf)(api(10))
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/orders?n=1", strings.NewReader(`{"items": [1, 2]}`)),
+		httptest.NewRequest("GET", "/logo", nil),
+		httptest.NewRequest("GET", "/missing", nil),
+	} {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer abc")
+		rr := httptest.NewRecorder()
+		recorder.ServeHTTP(rr, req)
+		if rr.Code >= 500 {
+			t.Fatalf("expected the handler to see the request, got %d", rr.Code)
+		}
+	}
+
+	file := buf.String()
+	if lines := strings.Count(file, "\n"); lines != 3 {
+		t.Fatalf("expected 3 records, got %d", lines)
+	}
+	if strings.Contains(file, "Bearer abc") || strings.Contains(file, "secret") {
+		t.Errorf("expected credentials to be redacted, got %s", file)
+	}
+	if !strings.Contains(file, `"json":{"items":[1,2]}`) || !strings.Contains(file, `"base64":"`) {
+		t.Errorf("expected JSON bodies inline and binary ones in base64, got %s", file)
+	}
+
+	tr := NewTrafficReader(strings.NewReader(file))
+	rec, err := tr.Next()
+	if err != nil || rec.Request.Method != "POST" || rec.Request.URL != "/orders?n=1" || rec.Response.Status != http.StatusCreated {
+		t.Errorf("expected the first record to be read back, got %+v, %v", rec, err)
+	}
+
+	// the same API passes
+	report, err := testTools.ReplayTraffic(api(10), strings.NewReader(file), TrafficReplayOptions{Headers: []string{"Content-Type"}})
+	if err != nil || !report.OK() || report.Total != 3 || report.Passed != 3 {
+		t.Errorf("expected the replay to pass, got %+v, %v", report, err)
+	}
+
+	// a changed response is reported
+	report, err = testTools.ReplayTraffic(api(12), strings.NewReader(file))
+	if err != nil || report.OK() || report.Passed != 2 {
+		t.Fatalf("expected one mismatch, got %+v, %v", report, err)
+	}
+	m := report.Mismatches[0]
+	if m.Line != 1 || m.URL != "/orders?n=1" || len(m.Problems) != 1 || m.Problems[0] != "replace /total: expected 10, got 12" {
+		t.Errorf("expected the total to differ, got %+v", m)
+	}
+
+	// ignored fields and filtered records
+	report, _ = testTools.ReplayTraffic(api(12), strings.NewReader(file), TrafficReplayOptions{Ignore: []string{"/total"}})
+	if !report.OK() {
+		t.Errorf("expected ignored fields not to be compared, got %+v", report)
+	}
+	report, _ = testTools.ReplayTraffic(api(12), strings.NewReader(file), TrafficReplayOptions{
+		Filter: func(rec *TrafficRecord) bool { return rec.Request.Method == "GET" },
+	})
+	if report.Total != 2 {
+		t.Errorf("expected 2 records to be replayed, got %d", report.Total)
+	}
+}
+
+func TestTrafficReader_Next(t *testing.T) {
+	var tests = []struct {
+		name    string
+		file    string
+		records int
+		errText string
+	}{
+		{"empty", "", 0, ""},
+		{"blank lines", "\n" + `{"request":{"method":"GET","url":"/"},"response":{"status":200}}` + "\n\n", 1, ""},
+		{"no final newline", `{"request":{"method":"GET","url":"/a"},"response":{"status":200}}`, 1, ""},
+		{"invalid JSON", `{"request":` + "\n", 0, "traffic line 1"},
+		{"missing URL", "\n" + `{"request":{"method":"GET"}}`, 0, "traffic line 2"},
+	}
+
+	for _, e := range tests {
+		tr := NewTrafficReader(strings.NewReader(e.file))
+		records := 0
+		var err error
+		for {
+			if _, err = tr.Next(); err != nil {
+				break
+			}
+			records++
+		}
+
+		if records != e.records {
+			t.Errorf("%s: expected %d records, got %d", e.name, e.records, records)
+		}
+		if e.errText == "" && !errors.Is(err, io.EOF) {
+			t.Errorf("%s: expected io.EOF, got %v", e.name, err)
+		}
+		if e.errText != "" && (err == nil || !strings.Contains(err.Error(), e.errText)) {
+			t.Errorf("%s: expected an error mentioning %q, got %v", e.name, e.errText, err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package toolkit
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TxOptions configures WithTx and TxMiddleware.
+// Fields:
+// - Isolation: The isolation level of the transaction. The driver's default is used if zero.
+// - ReadOnly: Whether the transaction is read-only.
+// - Timeout: An optional deadline for the whole transaction, applied on top of the caller's context.
+// - MaxRetries: How many times a transaction failing with a retryable error is run again. Defaults to 0.
+// - IsRetryable: Decides whether an error is retryable. Defaults to detecting serialization failures and deadlocks.
+type TxOptions struct {
+	Isolation   sql.IsolationLevel
+	ReadOnly    bool
+	Timeout     time.Duration
+	MaxRetries  int
+	IsRetryable func(error) bool
+}
+
+// WithTx runs fn inside a database transaction, committing if fn returns nil and rolling back otherwise.
+// If fn panics, the transaction is rolled back and the panic is propagated. Transactions failing with a retryable
+// error, such as a serialization failure (SQLSTATE 40001), are run again up to MaxRetries times.
+// Parameters:
+// - ctx: The context controlling the transaction.
+// - db: The database handle to begin the transaction on.
+// - fn: The function doing the work. It must not commit or roll back the transaction itself.
+// - opts: Optional TxOptions. Only the first value is used if multiple are provided.
+// Returns the error returned by fn, or an error beginning or committing the transaction.
+func (t *Tools) WithTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error, opts ...TxOptions) error {
+	var o TxOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.IsRetryable == nil {
+		o.IsRetryable = IsSerializationFailure
+	}
+
+	if o.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	var err error
+	for attempt := 0; attempt <= o.MaxRetries; attempt++ {
+		err = runTx(ctx, db, &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly}, fn)
+		if err == nil || !o.IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runTx runs fn in a single transaction attempt.
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsSerializationFailure reports whether err is a serialization failure or deadlock that is safe to retry.
+// It recognizes driver errors exposing SQLState() (such as pgx's) and falls back to matching the error text.
+// Parameters:
+// - err: The error to inspect.
+// Returns true if the transaction that produced err can be retried.
+func IsSerializationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		state := stateErr.SQLState()
+		return state == "40001" || state == "40P01"
+	}
+
+	msg := strings.ToLower(err.Error())
+
+	return strings.Contains(msg, "40001") || strings.Contains(msg, "serialization failure") ||
+		strings.Contains(msg, "could not serialize") || strings.Contains(msg, "deadlock")
+}
+
+type txContextKey struct{}
+
+// TxFromContext returns the per-request transaction attached by TxMiddleware.
+// Parameters:
+// - ctx: The request context.
+// Returns the transaction and true, or nil and false if no transaction is attached.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*sql.Tx)
+	return tx, ok
+}
+
+// TxMiddleware attaches a transaction to every request's context, retrievable with TxFromContext.
+// The transaction is committed if the handler responds with a status below 400 and rolled back otherwise,
+// including when the handler panics. Since the response has already been written, a failed commit can only
+// be reported through the optional onCommitError callback.
+// Parameters:
+// - db: The database handle to begin transactions on.
+// - onCommitError: An optional callback invoked when a commit fails.
+// Returns the middleware.
+func (t *Tools) TxMiddleware(db *sql.DB, onCommitError ...func(r *http.Request, err error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tx, err := db.BeginTx(r.Context(), nil)
+			if err != nil {
+				_ = t.ErrorJSON(w, errors.New("could not start transaction"), http.StatusServiceUnavailable)
+				return
+			}
+
+			defer func() {
+				if p := recover(); p != nil {
+					_ = tx.Rollback()
+					panic(p)
+				}
+			}()
+
+			sw := newStatusWriter(w)
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), txContextKey{}, tx)))
+
+			if sw.Status() >= http.StatusBadRequest {
+				_ = tx.Rollback()
+				return
+			}
+
+			if err := tx.Commit(); err != nil && !errors.Is(err, sql.ErrTxDone) && len(onCommitError) > 0 {
+				onCommitError[0](r, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package toolkit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// fakeTxDriver is a database/sql driver that only counts transaction outcomes.
+type fakeTxDriver struct {
+	mu        sync.Mutex
+	commits   int
+	rollbacks int
+}
+
+func (d *fakeTxDriver) Open(string) (driver.Conn, error) { return &fakeTxConn{d: d}, nil }
+
+func (d *fakeTxDriver) counts() (int, int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.commits, d.rollbacks
+}
+
+type fakeTxConn struct{ d *fakeTxDriver }
+
+func (c *fakeTxConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeTxConn) Close() error                        { return nil }
+func (c *fakeTxConn) Begin() (driver.Tx, error)           { return &fakeTx{d: c.d}, nil }
+
+type fakeTx struct{ d *fakeTxDriver }
+
+func (tx *fakeTx) Commit() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.commits++
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.d.mu.Lock()
+	defer tx.d.mu.Unlock()
+	tx.d.rollbacks++
+	return nil
+}
+
+var fakeTxDriverSeq int
+
+func newFakeTxDB(t *testing.T) (*sql.DB, *fakeTxDriver) {
+	d := &fakeTxDriver{}
+	fakeTxDriverSeq++
+	name := fmt.Sprintf("faketx%d", fakeTxDriverSeq)
+	sql.Register(name, d)
+
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db, d
+}
+
+func TestTools_WithTx(t *testing.T) {
+	var testTools Tools
+	db, d := newFakeTxDB(t)
+	ctx := context.Background()
+
+	if err := testTools.WithTx(ctx, db, func(tx *sql.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	if err := testTools.WithTx(ctx, db, func(tx *sql.Tx) error { return errFailed }); !errors.Is(err, errFailed) {
+		t.Errorf("expected fn error to be returned, got %v", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected panic to be propagated")
+			}
+		}()
+		_ = testTools.WithTx(ctx, db, func(tx *sql.Tx) error { panic("boom") })
+	}()
+
+	if commits, rollbacks := d.counts(); commits != 1 || rollbacks != 2 {
+		t.Errorf("expected 1 commit and 2 rollbacks, got %d and %d", commits, rollbacks)
+	}
+}
+
+func TestTools_WithTxRetries(t *testing.T) {
+	var testTools Tools
+	db, _ := newFakeTxDB(t)
+
+	attempts := 0
+	err := testTools.WithTx(context.Background(), db, func(tx *sql.Tx) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("pq: could not serialize access due to concurrent update (SQLSTATE 40001)")
+		}
+		return nil
+	}, TxOptions{MaxRetries: 3})
+
+	if err != nil || attempts != 3 {
+		t.Errorf("expected success on third attempt, got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestTools_TxMiddleware(t *testing.T) {
+	var testTools Tools
+	db, d := newFakeTxDB(t)
+
+	handler := testTools.TxMiddleware(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := TxFromContext(r.Context()); !ok {
+			t.Error("expected transaction in context")
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/ok", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/fail", nil))
+
+	if commits, rollbacks := d.counts(); commits != 1 || rollbacks != 1 {
+		t.Errorf("expected 1 commit and 1 rollback, got %d and %d", commits, rollbacks)
+	}
+}
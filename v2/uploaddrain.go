@@ -0,0 +1,216 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrUploadAborted is returned by UploadFiles when an upload is cancelled before it completes, e.g. because the
+// server stopped waiting for it while shutting down. The files it saved are removed.
+var ErrUploadAborted = errors.New("upload aborted")
+
+// ErrClientDisconnected is returned by UploadFiles when the client goes away before its upload is complete. It
+// wraps ErrUploadAborted, and the files the upload saved are removed.
+var ErrClientDisconnected = fmt.Errorf("%w: client disconnected", ErrUploadAborted)
+
+// DrainingError is returned by UploadFiles while an UploadDrainer is draining. ErrorJSON answers it with 503
+// Service Unavailable and a Retry-After header.
+type DrainingError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns a human-readable description of the refusal.
+func (e *DrainingError) Error() string {
+	return fmt.Sprintf("server is shutting down; retry after %s seconds", e.retryAfterSeconds())
+}
+
+// ErrorCode returns "server.draining".
+func (e *DrainingError) ErrorCode() string {
+	return "server.draining"
+}
+
+// retryAfterSeconds returns RetryAfter rounded up to whole seconds, as used by the Retry-After header.
+func (e *DrainingError) retryAfterSeconds() string {
+	return strconv.Itoa(int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// UploadDrainer tracks the uploads in progress, so a server shutting down can let them finish. Set it as
+// Tools.UploadDrainer; Serve drains it before stopping the server.
+// Fields:
+// - RetryAfter: The Retry-After sent to uploads refused while draining. Defaults to 30 seconds.
+type UploadDrainer struct {
+	RetryAfter time.Duration
+
+	mu       sync.Mutex
+	draining bool
+	next     uint64
+	active   map[uint64]context.CancelCauseFunc
+	idle     chan struct{}
+}
+
+// NewUploadDrainer creates an UploadDrainer.
+func NewUploadDrainer() *UploadDrainer {
+	return &UploadDrainer{}
+}
+
+// begin registers an upload, returning its context, cancelled if the drain deadline passes, and the function
+// to call once it is over. It fails with a *DrainingError once draining has started.
+func (d *UploadDrainer) begin(ctx context.Context) (context.Context, func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.draining {
+		retryAfter := d.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = 30 * time.Second
+		}
+		return nil, nil, &DrainingError{RetryAfter: retryAfter}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	id := d.next
+	d.next++
+	if d.active == nil {
+		d.active = make(map[uint64]context.CancelCauseFunc)
+	}
+	d.active[id] = cancel
+
+	done := func() {
+		d.mu.Lock()
+		delete(d.active, id)
+		if len(d.active) == 0 && d.idle != nil {
+			close(d.idle)
+			d.idle = nil
+		}
+		d.mu.Unlock()
+		cancel(nil)
+	}
+
+	return ctx, done, nil
+}
+
+// Active returns the number of uploads in progress.
+func (d *UploadDrainer) Active() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.active)
+}
+
+// Drain refuses new uploads and waits for those in progress to finish. When ctx is done first, the remaining
+// uploads are aborted, and Drain waits a few more seconds for them to remove their files.
+// Returns nil once every upload finished, or an error wrapping ErrUploadAborted if some were aborted.
+func (d *UploadDrainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	if len(d.active) == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	d.mu.Lock()
+	aborted := len(d.active)
+	for _, cancel := range d.active {
+		cancel(ErrUploadAborted)
+	}
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+	}
+
+	return fmt.Errorf("%w: %d still in progress at the drain deadline", ErrUploadAborted, aborted)
+}
+
+// uploadAbortError returns the error of an upload whose context is done. The request's context is cancelled when
+// its client disconnects.
+func uploadAbortError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, ErrUploadAborted):
+		return cause
+	case errors.Is(cause, context.Canceled):
+		return ErrClientDisconnected
+	}
+
+	return fmt.Errorf("%w: %v", ErrUploadAborted, cause)
+}
+
+// contextReader fails reads once its context is done, so copying an upload stops when its client disconnects.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read reads from the wrapped reader unless the context is done.
+func (cr contextReader) Read(p []byte) (int, error) {
+	if cr.ctx.Err() != nil {
+		return 0, context.Cause(cr.ctx)
+	}
+
+	return cr.r.Read(p)
+}
+
+// contextReadCloser fails reads once its context is done, so a request body stops being read when an upload is
+// aborted. Reads run in the background into a buffer of its own, so a read blocked on a slow client does not hold
+// up the abort.
+type contextReadCloser struct {
+	ctx context.Context
+	io.ReadCloser
+
+	buf     []byte
+	results chan contextReadResult
+	pending bool
+}
+
+type contextReadResult struct {
+	n   int
+	err error
+}
+
+// newContextReadCloser wraps rc.
+func newContextReadCloser(ctx context.Context, rc io.ReadCloser) *contextReadCloser {
+	return &contextReadCloser{ctx: ctx, ReadCloser: rc, buf: make([]byte, 32*1024), results: make(chan contextReadResult, 1)}
+}
+
+// Read reads from the wrapped body until the context is done.
+func (cr *contextReadCloser) Read(p []byte) (int, error) {
+	if cr.ctx.Err() != nil {
+		return 0, context.Cause(cr.ctx)
+	}
+
+	if !cr.pending {
+		cr.pending = true
+		buf := cr.buf[:min(len(p), len(cr.buf))]
+		go func() {
+			n, err := cr.ReadCloser.Read(buf)
+			cr.results <- contextReadResult{n, err}
+		}()
+	}
+
+	select {
+	case res := <-cr.results:
+		cr.pending = false
+		return copy(p, cr.buf[:res.n]), res.err
+	case <-cr.ctx.Done():
+		return 0, context.Cause(cr.ctx)
+	}
+}
@@ -0,0 +1,160 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// drainUpload starts an upload that stalls after the first part of a file, returning the function sending the
+// rest and a channel receiving UploadFiles' error.
+func drainUpload(t *testing.T, tools *Tools, dir string) (func(), chan error) {
+	t.Helper()
+
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { _ = pr.Close() })
+	mw := multipart.NewWriter(pw)
+	req := httptest.NewRequest("POST", "/upload", pr)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := tools.UploadFiles(req, dir, false)
+		errc <- err
+	}()
+
+	part, _ := mw.CreateFormFile("file", "report.txt")
+	go func() { _, _ = part.Write(bytes.Repeat([]byte("a"), 1024)) }()
+
+	finish := func() {
+		_, _ = part.Write([]byte("end"))
+		_ = mw.Close()
+		_ = pw.Close()
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for tools.UploadDrainer.Active() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the upload to start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return finish, errc
+}
+
+func TestUploadDrainer(t *testing.T) {
+	dir := t.TempDir()
+	testTools := Tools{UploadDrainer: NewUploadDrainer()}
+
+	// an upload finishing before the deadline is waited for
+	finish, errc := drainUpload(t, &testTools, dir)
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		drained <- testTools.UploadDrainer.Drain(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	finish()
+
+	if err := <-errc; err != nil {
+		t.Errorf("expected the upload to finish, got %v", err)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("expected the drain to succeed, got %v", err)
+	}
+	if _, err := os.Stat(dir + "/report.txt"); err != nil {
+		t.Errorf("expected the file to be saved, got %v", err)
+	}
+
+	// new uploads are refused while draining
+	req := httptest.NewRequest("POST", "/upload", nil)
+	_, err := testTools.UploadFiles(req, dir)
+	var draining *DrainingError
+	if !errors.As(err, &draining) {
+		t.Fatalf("expected a DrainingError, got %v", err)
+	}
+	rr := httptest.NewRecorder()
+	_ = testTools.ErrorJSON(rr, err)
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("expected 503 with Retry-After 30, got %d %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// an upload outlasting the deadline is aborted and its files removed
+	dir = t.TempDir()
+	testTools.UploadDrainer = NewUploadDrainer()
+	_, errc = drainUpload(t, &testTools, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := testTools.UploadDrainer.Drain(ctx); !errors.Is(err, ErrUploadAborted) {
+		t.Errorf("expected the drain to abort the upload, got %v", err)
+	}
+	if err := <-errc; !errors.Is(err, ErrUploadAborted) {
+		t.Errorf("expected ErrUploadAborted, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no files to be left, got %d", len(entries))
+	}
+}
+
+func TestTools_UploadFilesClientDisconnected(t *testing.T) {
+	body := func(complete bool) (*bytes.Buffer, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		part, _ := mw.CreateFormFile("file", "report.txt")
+		_, _ = part.Write(bytes.Repeat([]byte("a"), 4096))
+		if complete {
+			_ = mw.Close()
+		}
+		return &buf, mw.FormDataContentType()
+	}
+
+	var tests = []struct {
+		name     string
+		complete bool
+		cancel   string
+	}{
+		{"body cut short", false, ""},
+		{"cancelled before saving", true, "before"},
+		{"cancelled while copying", true, "hook"},
+	}
+
+	for _, e := range tests {
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var testTools Tools
+		if e.cancel == "hook" {
+			testTools.BeforeSave = func(context.Context, *UploadedFile, *multipart.FileHeader) error {
+				cancel()
+				return nil
+			}
+		}
+		if e.cancel == "before" {
+			cancel()
+		}
+
+		buf, contentType := body(e.complete)
+		req := httptest.NewRequest("POST", "/upload", buf).WithContext(ctx)
+		req.Header.Set("Content-Type", contentType)
+
+		_, err := testTools.UploadFiles(req, dir, false)
+		cancel()
+
+		if !errors.Is(err, ErrClientDisconnected) || !errors.Is(err, ErrUploadAborted) {
+			t.Errorf("%s: expected ErrClientDisconnected, got %v", e.name, err)
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("%s: expected no files to be left, got %d", e.name, len(entries))
+		}
+	}
+}
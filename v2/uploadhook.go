@@ -0,0 +1,15 @@
+package toolkit
+
+import (
+	"context"
+	"mime/multipart"
+)
+
+// UploadHook is called by UploadFiles for each file, e.g. to enforce per-user quotas, choose where a file goes
+// or record it in a database. Returning an error aborts the file's upload, and UploadFiles returns the error as is,
+// so it can carry an error code or status for ErrorJSON.
+// Parameters:
+// - ctx: The context of the upload request, e.g. to read the user or tenant.
+// - file: The file being uploaded. Before it is saved, FileSize is the size the client declared.
+// - hdr: The file's multipart header.
+type UploadHook func(ctx context.Context, file *UploadedFile, hdr *multipart.FileHeader) error
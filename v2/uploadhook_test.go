@@ -0,0 +1,92 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// uploadRequest returns a request uploading one text file.
+func uploadRequest(name, content string) *http.Request {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, _ := writer.CreateFormFile("file", name)
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+func TestTools_UploadHooks(t *testing.T) {
+	dir := t.TempDir()
+	var recorded []string
+
+	testTools := Tools{
+		BeforeSave: func(ctx context.Context, file *UploadedFile, hdr *multipart.FileHeader) error {
+			file.StoredPath = filepath.Join(dir, "user-42", file.NewFileName)
+			return nil
+		},
+		AfterSave: func(ctx context.Context, file *UploadedFile, hdr *multipart.FileHeader) error {
+			recorded = append(recorded, file.StoredPath)
+			return nil
+		},
+	}
+
+	file, err := testTools.UploadOneFile(uploadRequest("a.txt", "hello"), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(dir, "user-42", "a.txt")
+	if file.StoredPath != want {
+		t.Errorf("expected the file to be stored at %s, got %s", want, file.StoredPath)
+	}
+	if data, err := os.ReadFile(want); err != nil || string(data) != "hello" {
+		t.Errorf("expected the file to be written to the rewritten path: %v", err)
+	}
+	if len(recorded) != 1 || recorded[0] != want {
+		t.Errorf("expected AfterSave to see the stored file, got %v", recorded)
+	}
+}
+
+var uploadHookErrorTests = []struct {
+	name   string
+	before bool
+}{
+	{name: "before save", before: true},
+	{name: "after save", before: false},
+}
+
+func TestTools_UploadHooksAbort(t *testing.T) {
+	errQuota := errors.New("quota exceeded")
+	fail := func(ctx context.Context, file *UploadedFile, hdr *multipart.FileHeader) error {
+		return errQuota
+	}
+
+	for _, e := range uploadHookErrorTests {
+		dir := t.TempDir()
+
+		var testTools Tools
+		if e.before {
+			testTools.BeforeSave = fail
+		} else {
+			testTools.AfterSave = fail
+		}
+
+		if _, err := testTools.UploadFiles(uploadRequest("a.txt", "hello"), dir, false); !errors.Is(err, errQuota) {
+			t.Errorf("%s: expected the hook's error, got %v", e.name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "a.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: expected no file to be left behind", e.name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package toolkit
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// UploadWriteOptions controls how UploadFiles writes files to disk, trading throughput for durability.
+// Fields:
+// - BufferSize: If set, writes are batched in a buffer of this size, so the disk sees fewer, larger writes, e.g.
+// 1 << 20. By default each chunk read from the request is written as it arrives.
+// - Atomic: Write each file to a temporary file in the upload directory and rename it into place once complete,
+// so readers never see a partial file and a failed upload leaves nothing behind.
+// - Sync: Flush each file to stable storage before UploadFiles returns, and with Atomic also the directory
+// entry, so saved uploads survive a crash or power loss. This is much slower on most disks.
+// - AllOrNothing: Write the files of an upload to a staging directory inside the upload directory and only move
+// them into place once every file was saved and passed its checks, so a failed multi-file upload leaves no files
+// behind. AfterSave runs once all files are in place; if it fails for one file, all of them are removed.
+type UploadWriteOptions struct {
+	BufferSize   int
+	Atomic       bool
+	Sync         bool
+	AllOrNothing bool
+}
+
+// writeUploadFile writes src to the file at dst according to o.
+// Returns the number of bytes written.
+func writeUploadFile(dst string, src io.Reader, o UploadWriteOptions) (int64, error) {
+	target := dst
+
+	var out *os.File
+	var err error
+	if o.Atomic {
+		out, err = os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	} else {
+		out, err = os.Create(dst)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if o.Atomic {
+		dst = out.Name()
+		defer os.Remove(dst)
+	}
+
+	n, err := writeUploadBody(out, src, o)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if !o.Atomic {
+			// don't leave a truncated file behind
+			_ = os.Remove(dst)
+		}
+		return n, err
+	}
+
+	if o.Atomic {
+		if err := os.Rename(dst, target); err != nil {
+			return n, err
+		}
+		if o.Sync {
+			return n, syncDir(filepath.Dir(target))
+		}
+	}
+
+	return n, nil
+}
+
+// writeUploadBody copies src to out through the optional write buffer, syncing it if requested.
+func writeUploadBody(out *os.File, src io.Reader, o UploadWriteOptions) (int64, error) {
+	var n int64
+	var err error
+
+	if o.BufferSize > 0 {
+		buf := bufio.NewWriterSize(out, o.BufferSize)
+		if n, err = copyBuffered(buf, src); err == nil {
+			err = buf.Flush()
+		}
+	} else {
+		n, err = copyBuffered(out, src)
+	}
+	if err != nil {
+		return n, err
+	}
+
+	if o.Sync {
+		return n, out.Sync()
+	}
+
+	return n, nil
+}
+
+// syncDir flushes a directory's entries to stable storage, making a rename durable. Windows cannot sync
+// directories, so it does nothing there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
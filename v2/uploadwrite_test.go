@@ -0,0 +1,141 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var uploadWriteTests = []struct {
+	name string
+	opts UploadWriteOptions
+}{
+	{name: "default", opts: UploadWriteOptions{}},
+	{name: "buffered", opts: UploadWriteOptions{BufferSize: 4096}},
+	{name: "atomic", opts: UploadWriteOptions{Atomic: true}},
+	{name: "atomic synced", opts: UploadWriteOptions{Atomic: true, Sync: true, BufferSize: 1 << 20}},
+	{name: "synced", opts: UploadWriteOptions{Sync: true}},
+}
+
+func TestWriteUploadFile(t *testing.T) {
+	content := strings.Repeat("upload ", 20000)
+
+	for _, e := range uploadWriteTests {
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "file.txt")
+
+		n, err := writeUploadFile(dst, strings.NewReader(content), e.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+		if n != int64(len(content)) {
+			t.Errorf("%s: expected %d bytes, got %d", e.name, len(content), n)
+		}
+
+		data, _ := os.ReadFile(dst)
+		if string(data) != content {
+			t.Errorf("%s: expected the content to be written", e.name)
+		}
+
+		entries, _ := os.ReadDir(dir)
+		if len(entries) != 1 {
+			t.Errorf("%s: expected only the file in the directory, got %d entries", e.name, len(entries))
+		}
+	}
+}
+
+func TestWriteUploadFileAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	boom := errors.New("connection reset")
+	src := io.MultiReader(strings.NewReader("partial"), &failingReader{err: boom})
+
+	if _, err := writeUploadFile(filepath.Join(dir, "file.txt"), src, UploadWriteOptions{Atomic: true}); !errors.Is(err, boom) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected a failed atomic write to leave nothing behind, got %d entries", len(entries))
+	}
+}
+
+func TestWriteUploadFile_RemovesPartialFile(t *testing.T) {
+	dst := filepath.Join(t.TempDir(), "partial.txt")
+	src := io.MultiReader(strings.NewReader("partial"), &failingReader{err: errors.New("connection reset")})
+
+	if _, err := writeUploadFile(dst, src, UploadWriteOptions{}); err == nil {
+		t.Fatal("expected the write to fail")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the partial file to be removed, got %v", err)
+	}
+}
+
+// failingReader fails every read with err.
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestTools_UploadFilesAllOrNothing(t *testing.T) {
+	upload := func(files map[string]string) *http.Request {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		for name, content := range files {
+			part, _ := writer.CreateFormFile(name, name)
+			_, _ = part.Write([]byte(content))
+		}
+		_ = writer.Close()
+
+		req := httptest.NewRequest("POST", "/", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		return req
+	}
+
+	testTools := Tools{AllowedFileTypes: []string{"text/plain; charset=utf-8"}, UploadWrite: UploadWriteOptions{AllOrNothing: true}}
+
+	dir := t.TempDir()
+	_, err := testTools.UploadFiles(upload(map[string]string{"a.txt": "text", "b.html": "<html><body></body></html>", "c.txt": "text"}), dir, false)
+	if err == nil {
+		t.Fatal("expected the disallowed file to fail the upload")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected no files after a failed upload, got %d entries", len(entries))
+	}
+
+	files, err := testTools.UploadFiles(upload(map[string]string{"a.txt": "text", "c.txt": "more text"}), dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f.StoredPath); err != nil {
+			t.Error(err)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected only the two files, got %d entries", len(entries))
+	}
+
+	testTools.AfterSave = func(ctx context.Context, file *UploadedFile, hdr *multipart.FileHeader) error {
+		if file.OriginalFileName == "e.txt" {
+			return errors.New("database unavailable")
+		}
+		return nil
+	}
+	if _, err := testTools.UploadFiles(upload(map[string]string{"d.txt": "text", "e.txt": "text"}), dir, false); err == nil {
+		t.Fatal("expected AfterSave's error")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("expected the failed batch to be removed, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,215 @@
+package toolkit
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// URLBuilder builds URLs step by step. Its methods return modified copies, so a builder for a base URL can be
+// shared and extended per use.
+type URLBuilder struct {
+	u url.URL
+}
+
+// NewURLBuilder returns a builder starting from a URL, which may be relative, e.g. "/users?sort=name".
+// Parameters:
+// - rawURL: The starting URL.
+// Returns the builder, or an error if rawURL cannot be parsed.
+func NewURLBuilder(rawURL string) (URLBuilder, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return URLBuilder{}, err
+	}
+
+	return URLBuilder{u: *u}, nil
+}
+
+// URLBuilderFrom returns a builder starting from a copy of u, e.g. r.URL.
+func URLBuilderFrom(u *url.URL) URLBuilder {
+	b := URLBuilder{u: *u}
+	if u.User != nil {
+		user := *u.User
+		b.u.User = &user
+	}
+
+	return b
+}
+
+// Path appends segments to the path. Each segment is escaped, so "a/b" stays one segment, and the result has
+// exactly one slash between segments.
+func (b URLBuilder) Path(segments ...string) URLBuilder {
+	p := strings.TrimSuffix(b.u.EscapedPath(), "/")
+	for _, s := range segments {
+		p += "/" + url.PathEscape(s)
+	}
+	if p == "" {
+		p = "/"
+	}
+
+	b.setEscapedPath(p)
+
+	return b
+}
+
+// setEscapedPath sets the path from its escaped form.
+func (b *URLBuilder) setEscapedPath(escaped string) {
+	if unescaped, err := url.PathUnescape(escaped); err == nil {
+		b.u.Path, b.u.RawPath = unescaped, escaped
+	}
+}
+
+// Set sets a query parameter, replacing its values.
+func (b URLBuilder) Set(key, value string) URLBuilder {
+	q := b.u.Query()
+	q.Set(key, value)
+	b.u.RawQuery = q.Encode()
+
+	return b
+}
+
+// Merge sets the query parameters in values, replacing their values and keeping the others. Keys with no values
+// are removed.
+func (b URLBuilder) Merge(values url.Values) URLBuilder {
+	q := b.u.Query()
+	for key, vs := range values {
+		if len(vs) == 0 {
+			q.Del(key)
+			continue
+		}
+		q[key] = append([]string(nil), vs...)
+	}
+	b.u.RawQuery = q.Encode()
+
+	return b
+}
+
+// Without removes query parameters.
+func (b URLBuilder) Without(keys ...string) URLBuilder {
+	q := b.u.Query()
+	for _, key := range keys {
+		q.Del(key)
+	}
+	b.u.RawQuery = q.Encode()
+
+	return b
+}
+
+// Fragment sets the fragment, without the "#".
+func (b URLBuilder) Fragment(fragment string) URLBuilder {
+	b.u.Fragment, b.u.RawFragment = fragment, ""
+
+	return b
+}
+
+// Canonical normalizes the URL so equivalent URLs compare equal: the scheme and host are lower-cased, default
+// ports and the fragment are dropped, dot segments and repeated slashes are removed from the path, the query is
+// sorted, and empty queries are dropped.
+func (b URLBuilder) Canonical() URLBuilder {
+	b.u.Scheme = strings.ToLower(b.u.Scheme)
+	b.u.Host = strings.ToLower(b.u.Host)
+	if host, port, err := net.SplitHostPort(b.u.Host); err == nil &&
+		((b.u.Scheme == "http" && port == "80") || (b.u.Scheme == "https" && port == "443")) {
+		b.u.Host = host
+		if strings.Contains(host, ":") {
+			b.u.Host = "[" + host + "]"
+		}
+	}
+
+	escaped := b.u.EscapedPath()
+	if escaped != "" {
+		trailing := strings.HasSuffix(escaped, "/")
+		if b.u.Host != "" && !strings.HasPrefix(escaped, "/") {
+			escaped = "/" + escaped
+		}
+		escaped = path.Clean(escaped)
+		if trailing && escaped != "/" {
+			escaped += "/"
+		}
+		b.setEscapedPath(escaped)
+	} else if b.u.Host != "" {
+		b.u.Path = "/"
+	}
+
+	b.u.RawQuery = b.u.Query().Encode()
+	b.u.ForceQuery = false
+	b.u.Fragment, b.u.RawFragment = "", ""
+
+	return b
+}
+
+// URL returns a copy of the built URL.
+func (b URLBuilder) URL() *url.URL {
+	u := b.u
+	return &u
+}
+
+// String returns the built URL.
+func (b URLBuilder) String() string {
+	return b.u.String()
+}
+
+// CanonicalURL normalizes a URL as URLBuilder.Canonical does, e.g. for rel="canonical" links and deduplication.
+// Parameters:
+// - rawURL: The URL.
+// Returns the canonical URL, or an error if rawURL cannot be parsed.
+func CanonicalURL(rawURL string) (string, error) {
+	b, err := NewURLBuilder(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	return b.Canonical().String(), nil
+}
+
+// Breadcrumb is a link in a breadcrumb trail.
+// Fields:
+// - Label: The text shown.
+// - URL: The link's path.
+// - Current: Whether this is the current page, usually shown without a link.
+type Breadcrumb struct {
+	Label   string
+	URL     string
+	Current bool
+}
+
+// Breadcrumbs builds the breadcrumb trail of a URL path, with one crumb per segment after a "Home" crumb, e.g.
+// "/docs/getting-started" gives Home, Docs and Getting started.
+// Parameters:
+// - urlPath: The path of the current page, e.g. r.URL.Path.
+// - labels: Optional labels by path, e.g. {"/": "Dashboard", "/users/42": "Ann"}. Other segments are labeled
+// by replacing dashes and underscores with spaces and capitalizing the first letter.
+// Returns the trail, the last crumb being the current page.
+func Breadcrumbs(urlPath string, labels map[string]string) []Breadcrumb {
+	label := func(p, segment string) string {
+		if l, ok := labels[p]; ok {
+			return l
+		}
+
+		s := strings.NewReplacer("-", " ", "_", " ").Replace(segment)
+		r, size := utf8.DecodeRuneInString(s)
+
+		return string(unicode.ToUpper(r)) + s[size:]
+	}
+
+	crumbs := []Breadcrumb{{Label: "Home", URL: "/"}}
+	if l, ok := labels["/"]; ok {
+		crumbs[0].Label = l
+	}
+
+	current := ""
+	for _, segment := range strings.Split(path.Clean("/"+urlPath), "/") {
+		if segment == "" {
+			continue
+		}
+		current += "/" + segment
+		crumbs = append(crumbs, Breadcrumb{Label: label(current, segment), URL: (&url.URL{Path: current}).EscapedPath()})
+	}
+
+	crumbs[len(crumbs)-1].Current = true
+
+	return crumbs
+}
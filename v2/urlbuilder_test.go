@@ -0,0 +1,69 @@
+package toolkit
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestURLBuilder(t *testing.T) {
+	base, err := NewURLBuilder("https://api.example.com/v1/?sort=name&page=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := base.Path("users", "a/b c").String(); got != "https://api.example.com/v1/users/a%2Fb%20c?sort=name&page=3" {
+		t.Errorf("unexpected path join %s", got)
+	}
+	if got := base.Set("page", "4").Without("sort").Fragment("top").String(); got != "https://api.example.com/v1/?page=4#top" {
+		t.Errorf("unexpected query %s", got)
+	}
+	if got := base.Merge(url.Values{"tag": {"a", "b"}, "sort": nil}).String(); got != "https://api.example.com/v1/?page=3&tag=a&tag=b" {
+		t.Errorf("unexpected merge %s", got)
+	}
+	if got := base.String(); got != "https://api.example.com/v1/?sort=name&page=3" {
+		t.Errorf("expected the base builder to be unchanged, got %s", got)
+	}
+
+	u, _ := url.Parse("/search?q=go")
+	if got := URLBuilderFrom(u).Set("page", "2").String(); got != "/search?page=2&q=go" || u.RawQuery != "q=go" {
+		t.Errorf("unexpected builder from URL %s, %s", got, u)
+	}
+}
+
+var canonicalURLTests = []struct {
+	in  string
+	out string
+}{
+	{in: "HTTPS://Example.COM:443/a/./b/../c?b=2&a=1#frag", out: "https://example.com/a/c?a=1&b=2"},
+	{in: "http://example.com:80", out: "http://example.com/"},
+	{in: "http://example.com:8080//docs//guide/", out: "http://example.com:8080/docs/guide/"},
+	{in: "http://[::1]:80/x?", out: "http://[::1]/x"},
+	{in: "/a/%2F/../b", out: "/a/b"},
+}
+
+func TestCanonicalURL(t *testing.T) {
+	for _, e := range canonicalURLTests {
+		got, err := CanonicalURL(e.in)
+		if err != nil || got != e.out {
+			t.Errorf("%s: expected %s, got %s, %v", e.in, e.out, got, err)
+		}
+	}
+}
+
+func TestBreadcrumbs(t *testing.T) {
+	expected := []Breadcrumb{
+		{Label: "Dashboard", URL: "/"},
+		{Label: "Users", URL: "/users"},
+		{Label: "Ann", URL: "/users/42"},
+		{Label: "Edit profile", URL: "/users/42/edit_profile", Current: true},
+	}
+
+	if got := Breadcrumbs("/users/42/edit_profile/", map[string]string{"/": "Dashboard", "/users/42": "Ann"}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if got := Breadcrumbs("/", nil); !reflect.DeepEqual(got, []Breadcrumb{{Label: "Home", URL: "/", Current: true}}) {
+		t.Errorf("unexpected root breadcrumbs %v", got)
+	}
+}
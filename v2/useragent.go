@@ -0,0 +1,241 @@
+package toolkit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Device classes reported by UserAgent.Device.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// UserAgent is the classification of a User-Agent header.
+// Fields:
+// - Raw: The header value.
+// - Browser: The browser name, e.g. "Chrome", "Firefox", "Safari", "Edge".
+// - BrowserVersion: The browser version, e.g. "120.0.6099.109".
+// - OS: The operating system, e.g. "Windows", "macOS", "iOS", "Android", "Linux".
+// - OSVersion: The operating system version when known, e.g. "14.2".
+// - Device: One of DeviceDesktop, DeviceMobile, DeviceTablet, DeviceBot or DeviceUnknown.
+// - IsBot: Whether the client looks automated: crawlers, monitors, HTTP libraries and headless browsers.
+// - BotName: The crawler name when known, e.g. "Googlebot".
+type UserAgent struct {
+	Raw            string `json:"raw"`
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+	Device         string `json:"device"`
+	IsBot          bool   `json:"is_bot"`
+	BotName        string `json:"bot_name,omitempty"`
+}
+
+// knownCrawlers maps crawler names, as they appear in User-Agent headers, to the reverse DNS domains their
+// addresses resolve to. Crawlers without domains can be recognised but not verified.
+var knownCrawlers = []struct {
+	name    string
+	domains []string
+}{
+	{"Googlebot", []string{".googlebot.com", ".google.com"}},
+	{"AdsBot-Google", []string{".google.com"}},
+	{"bingbot", []string{".search.msn.com"}},
+	{"DuckDuckBot", nil},
+	{"YandexBot", []string{".yandex.ru", ".yandex.net", ".yandex.com"}},
+	{"Baiduspider", []string{".baidu.com", ".baidu.jp"}},
+	{"Applebot", []string{".applebot.apple.com"}},
+	{"facebookexternalhit", nil},
+	{"Twitterbot", nil},
+	{"LinkedInBot", nil},
+	{"Slackbot", nil},
+	{"Discordbot", nil},
+}
+
+var (
+	botPattern = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|scrape|monitor|preview|fetch|headless|` +
+		`lighthouse|pingdom|curl/|wget/|python-requests|python-urllib|go-http-client|okhttp|java/|libwww|httpclient|axios/|node-fetch`)
+
+	// browser patterns are checked in order, as most browsers also claim to be Safari or Chrome
+	browserPatterns = []struct {
+		name    string
+		pattern *regexp.Regexp
+	}{
+		{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+		{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+		{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+		{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+		{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+		{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+		{"Internet Explorer", regexp.MustCompile(`(?:MSIE |Trident/.*rv:)([\d.]+)`)},
+	}
+
+	iosPattern     = regexp.MustCompile(`(?:iPhone|CPU) OS ([\d_]+)`)
+	androidPattern = regexp.MustCompile(`Android ([\d.]+)`)
+	macPattern     = regexp.MustCompile(`Mac OS X ([\d_.]+)`)
+	windowsPattern = regexp.MustCompile(`Windows NT ([\d.]+)`)
+)
+
+// ParseUserAgent classifies the User-Agent header of a request.
+// Parameters:
+// - r: The http.Request.
+// Returns the classification. Unrecognised values produce empty names and DeviceUnknown.
+func (t *Tools) ParseUserAgent(r *http.Request) UserAgent {
+	return parseUserAgent(r.UserAgent())
+}
+
+// parseUserAgent classifies a User-Agent header value.
+func parseUserAgent(raw string) UserAgent {
+	ua := UserAgent{Raw: raw, Device: DeviceUnknown}
+
+	if strings.TrimSpace(raw) == "" {
+		ua.IsBot, ua.Device = true, DeviceBot
+		return ua
+	}
+
+	for _, c := range knownCrawlers {
+		if strings.Contains(strings.ToLower(raw), strings.ToLower(c.name)) {
+			ua.BotName = c.name
+			break
+		}
+	}
+
+	ua.IsBot = ua.BotName != "" || botPattern.MatchString(raw)
+
+	for _, b := range browserPatterns {
+		if m := b.pattern.FindStringSubmatch(raw); m != nil {
+			ua.Browser, ua.BrowserVersion = b.name, m[1]
+			break
+		}
+	}
+
+	switch {
+	case strings.Contains(raw, "iPhone") || strings.Contains(raw, "iPad") || strings.Contains(raw, "iPod"):
+		ua.OS = "iOS"
+		if m := iosPattern.FindStringSubmatch(raw); m != nil {
+			ua.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(raw, "Android"):
+		ua.OS = "Android"
+		if m := androidPattern.FindStringSubmatch(raw); m != nil {
+			ua.OSVersion = m[1]
+		}
+	case strings.Contains(raw, "Windows"):
+		ua.OS = "Windows"
+		if m := windowsPattern.FindStringSubmatch(raw); m != nil {
+			ua.OSVersion = windowsVersion(m[1])
+		}
+	case strings.Contains(raw, "Macintosh") || strings.Contains(raw, "Mac OS X"):
+		ua.OS = "macOS"
+		if m := macPattern.FindStringSubmatch(raw); m != nil {
+			ua.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+	case strings.Contains(raw, "CrOS"):
+		ua.OS = "ChromeOS"
+	case strings.Contains(raw, "Linux"):
+		ua.OS = "Linux"
+	}
+
+	switch {
+	case ua.IsBot:
+		ua.Device = DeviceBot
+	case strings.Contains(raw, "iPad") || strings.Contains(raw, "Tablet") ||
+		(ua.OS == "Android" && !strings.Contains(raw, "Mobile")):
+		ua.Device = DeviceTablet
+	case strings.Contains(raw, "Mobi") || strings.Contains(raw, "iPhone") || strings.Contains(raw, "iPod"):
+		ua.Device = DeviceMobile
+	case ua.OS != "" || ua.Browser != "":
+		ua.Device = DeviceDesktop
+	}
+
+	return ua
+}
+
+// windowsVersion maps a Windows NT version to its marketing name. Windows 11 still reports NT 10.0.
+func windowsVersion(nt string) string {
+	switch nt {
+	case "10.0":
+		return "10"
+	case "6.3":
+		return "8.1"
+	case "6.2":
+		return "8"
+	case "6.1":
+		return "7"
+	}
+
+	return nt
+}
+
+// lookupAddr and lookupHost resolve addresses for crawler verification; tests replace them.
+var (
+	lookupAddr = net.DefaultResolver.LookupAddr
+	lookupHost = net.DefaultResolver.LookupHost
+)
+
+// IsVerifiedCrawler reports whether a request comes from a known search engine crawler, confirmed with a
+// reverse DNS lookup of the remote address followed by a forward lookup of the name, as the search engines
+// recommend. Use it to skip CAPTCHAs or rate limits for genuine crawlers without trusting the User-Agent alone.
+// Parameters:
+// - ctx: The context bounding the DNS lookups.
+// - r: The http.Request. The address is taken from r.RemoteAddr.
+// Returns true only if the User-Agent names a crawler with known domains and DNS confirms the address.
+func (t *Tools) IsVerifiedCrawler(ctx context.Context, r *http.Request) bool {
+	ua := parseUserAgent(r.UserAgent())
+	if ua.BotName == "" {
+		return false
+	}
+
+	var domains []string
+	for _, c := range knownCrawlers {
+		if c.name == ua.BotName {
+			domains = c.domains
+		}
+	}
+	if len(domains) == 0 {
+		return false
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	names, err := lookupAddr(ctx, ip)
+	if err != nil {
+		return false
+	}
+
+	for _, name := range names {
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+		matched := false
+		for _, d := range domains {
+			if strings.HasSuffix(name, d) {
+				matched = true
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		addrs, err := lookupHost(ctx, name)
+		if err != nil {
+			continue
+		}
+
+		for _, a := range addrs {
+			if net.ParseIP(a).Equal(net.ParseIP(ip)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var userAgentTests = []struct {
+	name      string
+	header    string
+	browser   string
+	os        string
+	osVersion string
+	device    string
+	isBot     bool
+	botName   string
+}{
+	{name: "chrome windows", header: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", browser: "Chrome", os: "Windows", osVersion: "10", device: DeviceDesktop},
+	{name: "edge", header: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91", browser: "Edge", os: "Windows", osVersion: "10", device: DeviceDesktop},
+	{name: "safari iphone", header: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1", browser: "Safari", os: "iOS", osVersion: "17.2", device: DeviceMobile},
+	{name: "firefox mac", header: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.2; rv:121.0) Gecko/20100101 Firefox/121.0", browser: "Firefox", os: "macOS", osVersion: "14.2", device: DeviceDesktop},
+	{name: "android phone", header: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36", browser: "Chrome", os: "Android", osVersion: "14", device: DeviceMobile},
+	{name: "android tablet", header: "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", browser: "Chrome", os: "Android", osVersion: "13", device: DeviceTablet},
+	{name: "ipad", header: "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1", browser: "Safari", os: "iOS", osVersion: "16.6", device: DeviceTablet},
+	{name: "googlebot", header: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", device: DeviceBot, isBot: true, botName: "Googlebot"},
+	{name: "curl", header: "curl/8.4.0", device: DeviceBot, isBot: true},
+	{name: "headless chrome", header: "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36", browser: "Chrome", os: "Linux", device: DeviceBot, isBot: true},
+	{name: "empty", header: "", device: DeviceBot, isBot: true},
+}
+
+func TestTools_ParseUserAgent(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range userAgentTests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", e.header)
+
+		ua := testTools.ParseUserAgent(req)
+
+		if ua.Browser != e.browser || ua.OS != e.os || ua.Device != e.device || ua.IsBot != e.isBot || ua.BotName != e.botName {
+			t.Errorf("%s: unexpected classification %+v", e.name, ua)
+		}
+
+		if e.osVersion != "" && ua.OSVersion != e.osVersion {
+			t.Errorf("%s: expected OS version %s, got %s", e.name, e.osVersion, ua.OSVersion)
+		}
+	}
+}
+
+func TestTools_IsVerifiedCrawler(t *testing.T) {
+	var testTools Tools
+
+	origAddr, origHost := lookupAddr, lookupHost
+	defer func() { lookupAddr, lookupHost = origAddr, origHost }()
+
+	lookupAddr = func(ctx context.Context, addr string) ([]string, error) {
+		switch addr {
+		case "66.249.66.1":
+			return []string{"crawl-66-249-66-1.googlebot.com."}, nil
+		case "203.0.113.9":
+			return []string{"crawl.googlebot.com.evil.example."}, nil
+		}
+		return nil, errors.New("no PTR record")
+	}
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "crawl-66-249-66-1.googlebot.com" {
+			return []string{"66.249.66.1"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		name     string
+		addr     string
+		agent    string
+		expected bool
+	}{
+		{"genuine googlebot", "66.249.66.1:1234", "Mozilla/5.0 (compatible; Googlebot/2.1)", true},
+		{"spoofed domain", "203.0.113.9:1234", "Mozilla/5.0 (compatible; Googlebot/2.1)", false},
+		{"no reverse dns", "198.51.100.1:1234", "Mozilla/5.0 (compatible; Googlebot/2.1)", false},
+		{"browser", "66.249.66.1:1234", "Mozilla/5.0 (Windows NT 10.0) Chrome/120.0", false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = e.addr
+		req.Header.Set("User-Agent", e.agent)
+
+		if got := testTools.IsVerifiedCrawler(context.Background(), req); got != e.expected {
+			t.Errorf("%s: expected %v, got %v", e.name, e.expected, got)
+		}
+	}
+}
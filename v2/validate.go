@@ -0,0 +1,227 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes a single failed validation rule.
+// Fields:
+// - Field: The name of the field as seen by clients (its json, form, or query tag name).
+// - Rule: The validation rule that failed, such as "required" or "max".
+// - Message: A human-readable description of the failure.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is the error type returned by Validate. It holds every failed rule, not only the first one.
+type ValidationErrors []FieldError
+
+// Error joins all field errors into a single message.
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fe := range v {
+		messages[i] = fe.Message
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Validate checks the fields of a struct against the rules declared in their `validate` struct tags.
+// Supported rules are required, min=N, max=N, len=N, oneof=a b c, email, url and alphanum. For strings, slices and maps
+// min, max and len apply to the length; for numbers they apply to the value.
+// Parameters:
+// - v: A struct or a pointer to a struct to validate.
+// Returns nil if every rule passes, ValidationErrors listing the failures otherwise, or an error if v is not a struct.
+func (t *Tools) Validate(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return fmt.Errorf("validate: nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: expected a struct, got %s", rv.Kind())
+	}
+
+	var errs ValidationErrors
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		name := fieldName(sf)
+		fv := rv.Field(i)
+
+		for _, rule := range strings.Split(tag, ",") {
+			ruleName, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+			msg, err := checkRule(fv, ruleName, param)
+			if err != nil {
+				return fmt.Errorf("validate: field %s: %w", sf.Name, err)
+			}
+
+			if msg != "" {
+				errs = append(errs, FieldError{Field: name, Rule: ruleName, Message: fmt.Sprintf("%s %s", name, msg)})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// fieldName returns the client-facing name of a struct field, preferring its json, then form, then query tag.
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"json", "form", "query"} {
+		if name, _, _ := strings.Cut(sf.Tag.Get(key), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return sf.Name
+}
+
+// checkRule evaluates a single rule against a value. It returns a failure message, or an error if the rule is malformed.
+func checkRule(fv reflect.Value, rule, param string) (string, error) {
+	for fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			if rule == "required" {
+				return "is required", nil
+			}
+			return "", nil
+		}
+		fv = fv.Elem()
+	}
+
+	if (rule == "email" || rule == "url" || rule == "alphanum") && fv.Kind() != reflect.String {
+		return "", fmt.Errorf("rule %q does not apply to %s", rule, fv.Kind())
+	}
+
+	switch rule {
+	case "required":
+		if fv.IsZero() {
+			return "is required", nil
+		}
+
+	case "min", "max", "len":
+		n, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s parameter %q", rule, param)
+		}
+
+		size, isLength, ok := measure(fv)
+		if !ok {
+			return "", fmt.Errorf("rule %q does not apply to %s", rule, fv.Kind())
+		}
+		if isLength && fv.Len() == 0 && rule != "len" {
+			// empty values are the concern of "required"
+			return "", nil
+		}
+
+		unit := ""
+		if isLength {
+			unit = " characters"
+			if fv.Kind() != reflect.String {
+				unit = " items"
+			}
+		}
+
+		switch {
+		case rule == "min" && size < n:
+			if isLength {
+				return fmt.Sprintf("must be at least %s%s long", param, unit), nil
+			}
+			return fmt.Sprintf("must be at least %s", param), nil
+		case rule == "max" && size > n:
+			if isLength {
+				return fmt.Sprintf("must be at most %s%s long", param, unit), nil
+			}
+			return fmt.Sprintf("must be at most %s", param), nil
+		case rule == "len" && size != n:
+			return fmt.Sprintf("must be exactly %s%s long", param, unit), nil
+		}
+
+	case "oneof":
+		s := fmt.Sprint(fv.Interface())
+		if s == "" {
+			return "", nil
+		}
+		for _, option := range strings.Fields(param) {
+			if s == option {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("must be one of [%s]", param), nil
+
+	case "email":
+		s := fv.String()
+		if s == "" {
+			return "", nil
+		}
+		addr, err := mail.ParseAddress(s)
+		if err != nil || addr.Address != s {
+			return "must be a valid email address", nil
+		}
+
+	case "url":
+		s := fv.String()
+		if s == "" {
+			return "", nil
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid URL", nil
+		}
+
+	case "alphanum":
+		for _, r := range fv.String() {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return "must contain only letters and digits", nil
+			}
+		}
+
+	default:
+		return "", fmt.Errorf("unknown rule %q", rule)
+	}
+
+	return "", nil
+}
+
+// measure returns the size of a value used by min, max and len, whether that size is a length, and false if the
+// value has no size.
+func measure(fv reflect.Value) (float64, bool, bool) {
+	switch fv.Kind() {
+	case reflect.String:
+		return float64(len([]rune(fv.String()))), true, true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(fv.Len()), true, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(fv.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return fv.Float(), false, true
+	}
+
+	return 0, false, false
+}
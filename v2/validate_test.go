@@ -0,0 +1,105 @@
+package toolkit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type validateTestPayload struct {
+	Name  string   `json:"name" validate:"required,min=2,max=10"`
+	Email string   `json:"email" validate:"required,email"`
+	Age   int      `json:"age" validate:"min=18,max=130"`
+	Role  string   `json:"role" validate:"oneof=admin user"`
+	Site  string   `json:"site" validate:"url"`
+	Tags  []string `json:"tags" validate:"max=2"`
+}
+
+var validateTests = []struct {
+	name     string
+	payload  validateTestPayload
+	failures []string
+}{
+	{name: "valid", payload: validateTestPayload{Name: "Ann", Email: "ann@example.com", Age: 30, Role: "admin"}},
+	{name: "missing required", payload: validateTestPayload{Age: 30}, failures: []string{"name:required", "email:required"}},
+	{name: "too short", payload: validateTestPayload{Name: "A", Email: "a@example.com", Age: 30}, failures: []string{"name:min"}},
+	{name: "bad email", payload: validateTestPayload{Name: "Ann", Email: "not-an-email", Age: 30}, failures: []string{"email:email"}},
+	{name: "too young", payload: validateTestPayload{Name: "Ann", Email: "a@example.com", Age: 10}, failures: []string{"age:min"}},
+	{name: "bad role", payload: validateTestPayload{Name: "Ann", Email: "a@example.com", Age: 30, Role: "root"}, failures: []string{"role:oneof"}},
+	{name: "bad url", payload: validateTestPayload{Name: "Ann", Email: "a@example.com", Age: 30, Site: "nope"}, failures: []string{"site:url"}},
+	{name: "too many tags", payload: validateTestPayload{Name: "Ann", Email: "a@example.com", Age: 30, Tags: []string{"a", "b", "c"}}, failures: []string{"tags:max"}},
+}
+
+func TestTools_Validate(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range validateTests {
+		err := testTools.Validate(e.payload)
+
+		if len(e.failures) == 0 {
+			if err != nil {
+				t.Errorf("%s: error not expected, but one received: %s", e.name, err.Error())
+			}
+			continue
+		}
+
+		var verrs ValidationErrors
+		if !errors.As(err, &verrs) {
+			t.Errorf("%s: expected ValidationErrors, got %v", e.name, err)
+			continue
+		}
+
+		if len(verrs) != len(e.failures) {
+			t.Errorf("%s: expected %d failures, got %d (%s)", e.name, len(e.failures), len(verrs), verrs.Error())
+			continue
+		}
+
+		for i, f := range e.failures {
+			if got := verrs[i].Field + ":" + verrs[i].Rule; got != f {
+				t.Errorf("%s: expected failure %s, got %s", e.name, f, got)
+			}
+		}
+	}
+}
+
+func TestTools_ValidateRejectsNonStruct(t *testing.T) {
+	var testTools Tools
+
+	if err := testTools.Validate("foo"); err == nil {
+		t.Error("expected error for non-struct value but none received")
+	}
+}
+
+func TestTools_ValidateRuleKindMismatch(t *testing.T) {
+	var testTools Tools
+
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"max on a bool", struct {
+			Active bool `validate:"max=1"`
+		}{}},
+		{"min on a struct", struct {
+			Owner struct{ ID int } `validate:"min=1"`
+		}{}},
+		{"email on an int", struct {
+			Contact int `validate:"email"`
+		}{}},
+		{"url on a slice", struct {
+			Links []string `validate:"url"`
+		}{}},
+		{"alphanum on a pointer to int", struct {
+			Code *int `validate:"alphanum"`
+		}{Code: new(int)}},
+	}
+
+	for _, e := range tests {
+		err := testTools.Validate(e.v)
+
+		var verrs ValidationErrors
+		if err == nil || errors.As(err, &verrs) || !strings.Contains(err.Error(), "does not apply") {
+			t.Errorf("%s: expected a rule/kind mismatch error, got %v", e.name, err)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTokenInvalid is returned for malformed tokens, bad signatures, and tokens issued for another purpose.
+	ErrTokenInvalid = errors.New("token is invalid")
+	// ErrTokenExpired is returned for tokens past their expiry time.
+	ErrTokenExpired = errors.New("token has expired")
+	// ErrTokenUsed is returned for tokens that were already consumed or have been revoked.
+	ErrTokenUsed = errors.New("token has already been used")
+)
+
+// TokenStore records spent tokens, i.e. tokens that were consumed or revoked, so single-use semantics hold
+// across processes. Implementations only need to remember a token until its expiry time.
+type TokenStore interface {
+	// Spend marks the token id as spent until the given time. It returns false if the token was already spent.
+	Spend(ctx context.Context, id string, until time.Time) (bool, error)
+	// IsSpent reports whether the token id has been spent.
+	IsSpent(ctx context.Context, id string) (bool, error)
+}
+
+// MemoryTokenStore is an in-process TokenStore. It is suitable for single-instance deployments and tests.
+type MemoryTokenStore struct {
+	mu    sync.Mutex
+	spent map[string]time.Time
+}
+
+// Spend marks id as spent until the given time, returning false if it was already spent.
+func (s *MemoryTokenStore) Spend(_ context.Context, id string, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.spent == nil {
+		s.spent = make(map[string]time.Time)
+	}
+
+	for k, exp := range s.spent {
+		if now.After(exp) {
+			delete(s.spent, k)
+		}
+	}
+
+	if _, ok := s.spent[id]; ok {
+		return false, nil
+	}
+
+	s.spent[id] = until
+
+	return true, nil
+}
+
+// IsSpent reports whether id has been spent.
+func (s *MemoryTokenStore) IsSpent(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.spent[id]
+
+	return ok, nil
+}
+
+// VerificationToken holds the claims of a verification token, such as a password reset or email verification link.
+type VerificationToken struct {
+	ID        string    `json:"id"`
+	Purpose   string    `json:"p"`
+	Subject   string    `json:"s"`
+	ExpiresAt time.Time `json:"-"`
+	Expiry    int64     `json:"e"`
+}
+
+// VerificationTokens issues and checks single-use, expiring, HMAC-signed tokens bound to a purpose and a subject.
+// Fields:
+// - Secret: The HMAC key. It must be kept private and should be at least 32 bytes long.
+// - Keyring: Signs tokens instead of Secret when set, so keys can be rotated without invalidating tokens already
+// sent. Tokens signed with Secret are still accepted if it is one of the keyring's keys.
+// - Store: Where spent tokens are recorded. Without a store, tokens can be validated but not consumed or revoked.
+type VerificationTokens struct {
+	Secret  []byte
+	Keyring *Keyring
+	Store   TokenStore
+	now     func() time.Time
+}
+
+// NewVerificationTokens creates a VerificationTokens using the given secret and store.
+// Parameters:
+// - secret: The HMAC key used to sign tokens.
+// - store: The TokenStore recording consumed and revoked tokens.
+// Returns a pointer to the new VerificationTokens.
+func NewVerificationTokens(secret []byte, store TokenStore) *VerificationTokens {
+	return &VerificationTokens{Secret: secret, Store: store}
+}
+
+// Generate issues a new token.
+// Parameters:
+// - purpose: What the token may be used for, e.g. "password-reset". Tokens are rejected for any other purpose.
+// - subject: Who the token is for, e.g. a user ID or email address.
+// - ttl: How long the token stays valid.
+// Returns the encoded token, safe to embed in URLs, or an error if no secret is configured.
+func (v *VerificationTokens) Generate(purpose, subject string, ttl time.Duration) (string, error) {
+	if len(v.Secret) == 0 && v.Keyring == nil {
+		return "", errors.New("verification tokens require a secret")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	claims := VerificationToken{
+		ID:      hex.EncodeToString(id),
+		Purpose: purpose,
+		Subject: subject,
+		Expiry:  v.clock().Add(ttl).Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(v.sign(encoded)), nil
+}
+
+// Validate checks a token's signature, purpose, expiry, and whether it has been spent, without consuming it.
+// Parameters:
+// - ctx: The context passed to the store.
+// - token: The encoded token.
+// - purpose: The purpose the token must have been issued for.
+// Returns the token claims, or ErrTokenInvalid, ErrTokenExpired, or ErrTokenUsed.
+func (v *VerificationTokens) Validate(ctx context.Context, token, purpose string) (*VerificationToken, error) {
+	claims, err := v.parse(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.Store != nil {
+		spent, err := v.Store.IsSpent(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if spent {
+			return nil, ErrTokenUsed
+		}
+	}
+
+	return claims, nil
+}
+
+// Consume validates a token and marks it as spent, so any later use fails with ErrTokenUsed.
+// Parameters:
+// - ctx: The context passed to the store.
+// - token: The encoded token.
+// - purpose: The purpose the token must have been issued for.
+// Returns the token claims, or ErrTokenInvalid, ErrTokenExpired, or ErrTokenUsed.
+func (v *VerificationTokens) Consume(ctx context.Context, token, purpose string) (*VerificationToken, error) {
+	if v.Store == nil {
+		return nil, errors.New("consuming verification tokens requires a store")
+	}
+
+	claims, err := v.parse(token, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := v.Store.Spend(ctx, claims.ID, claims.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrTokenUsed
+	}
+
+	return claims, nil
+}
+
+// Revoke invalidates a token before its expiry, e.g. when a newer reset link is issued.
+// Parameters:
+// - ctx: The context passed to the store.
+// - token: The encoded token.
+// Returns ErrTokenInvalid if the token is not authentic, or an error from the store.
+func (v *VerificationTokens) Revoke(ctx context.Context, token string) error {
+	if v.Store == nil {
+		return errors.New("revoking verification tokens requires a store")
+	}
+
+	claims, err := v.parse(token, "")
+	if errors.Is(err, ErrTokenExpired) {
+		// expired tokens are already unusable
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = v.Store.Spend(ctx, claims.ID, claims.ExpiresAt)
+
+	return err
+}
+
+// parse verifies the signature and expiry of a token. An empty purpose skips the purpose check.
+func (v *VerificationTokens) parse(token, purpose string) (*VerificationToken, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok || len(v.Secret) == 0 && v.Keyring == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !v.verify(encoded, gotSig) {
+		return nil, ErrTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	var claims VerificationToken
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if purpose != "" && claims.Purpose != purpose {
+		return nil, ErrTokenInvalid
+	}
+
+	claims.ExpiresAt = time.Unix(claims.Expiry, 0)
+	if !v.clock().Before(claims.ExpiresAt) {
+		return &claims, ErrTokenExpired
+	}
+
+	return &claims, nil
+}
+
+// sign computes the HMAC-SHA256 of the encoded payload.
+func (v *VerificationTokens) sign(encoded string) []byte {
+	if v.Keyring != nil {
+		return v.Keyring.Sign([]byte(encoded))
+	}
+
+	return hmacSHA256(v.Secret, []byte(encoded))
+}
+
+// verify checks the signature of the encoded payload.
+func (v *VerificationTokens) verify(encoded string, sig []byte) bool {
+	if v.Keyring != nil {
+		return v.Keyring.Verify([]byte(encoded), sig)
+	}
+
+	return hmac.Equal(sig, hmacSHA256(v.Secret, []byte(encoded)))
+}
+
+// clock returns the current time, overridable in tests.
+func (v *VerificationTokens) clock() time.Time {
+	if v.now != nil {
+		return v.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,79 @@
+package toolkit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerificationTokens_Consume(t *testing.T) {
+	tokens := NewVerificationTokens([]byte("a-very-secret-key-for-testing-only"), &MemoryTokenStore{})
+	ctx := context.Background()
+
+	token, err := tokens.Generate("password-reset", "user-42", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := tokens.Validate(ctx, token, "password-reset")
+	if err != nil {
+		t.Fatalf("expected token to be valid: %v", err)
+	}
+
+	if claims.Subject != "user-42" {
+		t.Errorf("expected subject user-42, got %s", claims.Subject)
+	}
+
+	if _, err := tokens.Consume(ctx, token, "password-reset"); err != nil {
+		t.Fatalf("expected token to be consumed: %v", err)
+	}
+
+	if _, err := tokens.Consume(ctx, token, "password-reset"); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("expected ErrTokenUsed on second use, got %v", err)
+	}
+
+	if _, err := tokens.Validate(ctx, token, "password-reset"); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("expected ErrTokenUsed on validation after use, got %v", err)
+	}
+}
+
+func TestVerificationTokens_Rejections(t *testing.T) {
+	tokens := NewVerificationTokens([]byte("a-very-secret-key-for-testing-only"), &MemoryTokenStore{})
+	ctx := context.Background()
+
+	token, _ := tokens.Generate("verify-email", "ann@example.com", time.Minute)
+
+	if _, err := tokens.Validate(ctx, token, "password-reset"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid for wrong purpose, got %v", err)
+	}
+
+	if _, err := tokens.Validate(ctx, token+"x", "verify-email"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid for tampered token, got %v", err)
+	}
+
+	other := NewVerificationTokens([]byte("another-secret-key-entirely-here"), nil)
+	if _, err := other.Validate(ctx, token, "verify-email"); !errors.Is(err, ErrTokenInvalid) {
+		t.Errorf("expected ErrTokenInvalid for foreign secret, got %v", err)
+	}
+
+	tokens.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := tokens.Validate(ctx, token, "verify-email"); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestVerificationTokens_Revoke(t *testing.T) {
+	tokens := NewVerificationTokens([]byte("a-very-secret-key-for-testing-only"), &MemoryTokenStore{})
+	ctx := context.Background()
+
+	token, _ := tokens.Generate("password-reset", "user-42", time.Hour)
+
+	if err := tokens.Revoke(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tokens.Consume(ctx, token, "password-reset"); !errors.Is(err, ErrTokenUsed) {
+		t.Errorf("expected ErrTokenUsed for revoked token, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package toolkit
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+)
+
+// ViewHelpers returns the standard template functions for a request, which RenderTemplate makes available to
+// every template:
+//   - csrfField: A hidden input with a CSRF token, from CSRFMiddleware.
+//   - csrfToken: A CSRF token, e.g. for a meta tag read by scripts.
+//   - assetURL: The fingerprinted URL of an asset, from the asset manifest.
+//   - paginate: Takes the total number of items and the page size and returns a *Pagination for the current
+//     URL, reading the page from its "page" query parameter.
+//   - flashes: The queued flash messages, which are cleared once read.
+//   - currentUser: The *Subject stored with WithSubject, or nil for anonymous requests.
+//   - breadcrumbs: The Breadcrumbs of the current path, with optional labels by path.
+//   - urlQuery: The current URL with query parameters set from key and value pairs, e.g. for sort links.
+//   - consent: The visitor's Consent from CookieConsent.Middleware, e.g. {{if not consent.Decided}} to show the
+//     banner, or {{if consent.Granted "analytics"}} around a tracking script.
+//
+// Parameters:
+// - w: The http.ResponseWriter the page will be written to.
+// - r: The request being answered.
+// Returns the functions, for templates executed outside RenderTemplate.
+func (t *Tools) ViewHelpers(w http.ResponseWriter, r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML { return CSRFField(r) },
+		"csrfToken": func() string { return CSRFToken(r) },
+		"assetURL":  t.AssetURL,
+		"paginate": func(total, perPage int) *Pagination {
+			return NewPagination(r.URL, RequestPage(r.URL), perPage, total)
+		},
+		"flashes": func() []Flash { return t.Flashes(w, r) },
+		"currentUser": func() *Subject {
+			if s, ok := SubjectFromContext(r.Context()); ok {
+				return &s
+			}
+			return nil
+		},
+		"breadcrumbs": func(labels ...map[string]string) []Breadcrumb {
+			if len(labels) > 0 {
+				return Breadcrumbs(r.URL.Path, labels[0])
+			}
+			return Breadcrumbs(r.URL.Path, nil)
+		},
+		"urlQuery": func(pairs ...string) (string, error) {
+			if len(pairs)%2 != 0 {
+				return "", fmt.Errorf("urlQuery: odd number of arguments")
+			}
+			b := URLBuilderFrom(r.URL)
+			for i := 0; i < len(pairs); i += 2 {
+				b = b.Set(pairs[i], pairs[i+1])
+			}
+			return b.String(), nil
+		},
+		"consent": func() Consent { return ConsentFromContext(r.Context()) },
+	}
+}
+
+// viewHelperStubs declares the view helpers when templates are parsed; they are bound to the request when a page
+// is rendered.
+var viewHelperStubs = (&Tools{}).ViewHelpers(nil, nil)
@@ -0,0 +1,63 @@
+package toolkit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTools_ViewHelpers(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplateFiles(t, dir, map[string]string{
+		"page.html": `<form>{{csrfField}}</form>` +
+			`<link href="{{assetURL "app.css"}}">` +
+			`{{with currentUser}}<p>{{.ID}}</p>{{else}}<p>guest</p>{{end}}` +
+			`{{range flashes}}<div class="{{.Kind}}">{{.Message}}</div>{{end}}` +
+			`{{with paginate 45 10}}{{range .Pages}}<a href="{{.URL}}">{{.Number}}</a>{{end}}{{end}}` +
+			`{{range breadcrumbs}}<i>{{.Label}}</i>{{end}}<a href="{{urlQuery "sort" "name"}}">`,
+	})
+
+	testTools := Tools{Templates: NewTemplates(dir), AssetManifest: map[string]string{"app.css": "/static/app.1a2b.css"}}
+
+	// queue a flash on a first request
+	rr := httptest.NewRecorder()
+	testTools.AddFlash(rr, httptest.NewRequest(http.MethodPost, "/", nil), "success", "Saved")
+	flashCookie := rr.Result().Cookies()[0]
+
+	var body string
+	h := testTools.CSRFMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(WithSubject(r.Context(), Subject{ID: "ann"}))
+		if err := testTools.RenderTemplate(w, r, http.StatusOK, "page.html", nil); err != nil {
+			t.Fatal(err)
+		}
+	}))
+
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/users?page=2", nil)
+	req.AddCookie(flashCookie)
+	h.ServeHTTP(rr, req)
+	body = rr.Body.String()
+
+	for _, want := range []string{
+		`<input type="hidden" name="csrf_token" value="`,
+		`<link href="/static/app.1a2b.css">`,
+		`<p>ann</p>`,
+		`<div class="success">Saved</div>`,
+		`<i>Home</i><i>Users</i>`,
+		`<a href="/users?page=2&amp;sort=name">`,
+		`<a href="/users?page=1">1</a><a href="/users?page=2">2</a><a href="/users?page=3">3</a><a href="/users?page=4">4</a><a href="/users?page=5">5</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in %s", want, body)
+		}
+	}
+
+	var cleared bool
+	for _, c := range rr.Result().Cookies() {
+		cleared = cleared || (c.Name == flashCookieName && c.MaxAge == -1)
+	}
+	if !cleared {
+		t.Error("expected the rendered flashes to be cleared")
+	}
+}
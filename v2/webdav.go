@@ -0,0 +1,669 @@
+package toolkit
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebDAVOptions configures WebDAVHandler.
+// Fields:
+// - Prefix: The URL path the handler is mounted at, e.g. "/dav", which is stripped from request paths.
+// - ReadOnly: If true, only GET, HEAD, OPTIONS and PROPFIND are allowed, and clients mount the share read-only.
+type WebDAVOptions struct {
+	Prefix   string
+	ReadOnly bool
+}
+
+// webDAVHandler serves a directory over WebDAV (RFC 4918).
+type webDAVHandler struct {
+	root       string
+	prefix     string
+	readOnly   bool
+	maxSize    int64
+	authorizer Tools
+}
+
+// WebDAVHandler exposes a directory, typically the upload area, over WebDAV so desktop clients such as Finder,
+// Windows Explorer or davfs2 can mount it. Each operation is checked with the authorizer: PROPFIND and directory
+// listings need FileList, GET FileDownload, PUT, MKCOL and the destination of COPY and MOVE FileUpload, and DELETE
+// and the source of MOVE FileDelete. Requests whose context carries a tenant are scoped to root/<tenant>, and
+// the .trash directories of a LocalFileStore on the same root are hidden. Locks are granted so clients can write,
+// but are not enforced, and property updates are accepted without being stored.
+// Parameters:
+// - root: The directory to serve.
+// - authorizer: The Authorizer consulted with the subject in the request context. If nil, t.Authorizer is used.
+// - opts: Optional WebDAVOptions. Only the first value is used if multiple are provided.
+// Returns the handler. Uploads are limited to t.MaxFileSize when it is set.
+func (t *Tools) WebDAVHandler(root string, authorizer Authorizer, opts ...WebDAVOptions) http.Handler {
+	var o WebDAVOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if authorizer == nil {
+		authorizer = t.Authorizer
+	}
+
+	return &webDAVHandler{
+		root:       root,
+		prefix:     strings.TrimSuffix(o.Prefix, "/"),
+		readOnly:   o.ReadOnly,
+		maxSize:    int64(t.MaxFileSize),
+		authorizer: Tools{Authorizer: authorizer},
+	}
+}
+
+// ServeHTTP dispatches on the WebDAV method.
+func (h *webDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed := "OPTIONS, GET, HEAD, PROPFIND"
+	if !h.readOnly {
+		allowed += ", PUT, DELETE, MKCOL, COPY, MOVE, LOCK, UNLOCK, PROPPATCH"
+	}
+
+	rel, full, err := h.resolve(r.Context(), r.URL.Path)
+	if err != nil {
+		davError(w, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("DAV", "1, 2")
+		w.Header().Set("Allow", allowed)
+		w.Header().Set("MS-Author-Via", "DAV")
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodGet, http.MethodHead:
+		err = h.get(w, r, rel, full)
+	case "PROPFIND":
+		err = h.propfind(w, r, rel, full)
+	default:
+		if h.readOnly {
+			w.Header().Set("Allow", allowed)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			err = h.put(w, r, full)
+		case http.MethodDelete:
+			err = h.delete(w, r, full)
+		case "MKCOL":
+			err = h.mkcol(w, r, full)
+		case "COPY", "MOVE":
+			err = h.copyMove(w, r, full)
+		case "LOCK":
+			err = h.lock(w, r, rel, full)
+		case "UNLOCK":
+			w.WriteHeader(http.StatusNoContent)
+		case "PROPPATCH":
+			err = h.proppatch(w, r, rel, full)
+		default:
+			w.Header().Set("Allow", allowed)
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+
+	if err != nil {
+		davError(w, err)
+	}
+}
+
+// davStatusError is an error answered with a specific status.
+type davStatusError int
+
+func (e davStatusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+// davError answers a failed request.
+func davError(w http.ResponseWriter, err error) {
+	var status davStatusError
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &status):
+		http.Error(w, status.Error(), int(status))
+	case errors.Is(err, ErrForbidden):
+		writeAccessError(w)
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.As(err, &maxBytes):
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrNoTenant):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// resolve maps a URL path to its slash-separated path below the root and its file path.
+func (h *webDAVHandler) resolve(ctx context.Context, urlPath string) (string, string, error) {
+	if h.prefix != "" {
+		rest, ok := strings.CutPrefix(urlPath, h.prefix)
+		if !ok || (rest != "" && rest[0] != '/') {
+			return "", "", os.ErrNotExist
+		}
+		urlPath = rest
+	}
+
+	rel := path.Clean("/" + urlPath)
+	if strings.Contains(rel+"/", "/"+trashDirName+"/") {
+		return "", "", os.ErrNotExist
+	}
+
+	base := h.root
+	if tenant, ok := TenantFromContext(ctx); ok {
+		if !tenantIDRegex.MatchString(tenant) {
+			return "", "", ErrNoTenant
+		}
+		base = filepath.Join(h.root, tenant)
+	}
+
+	return rel, filepath.Join(base, filepath.FromSlash(rel)), nil
+}
+
+// href returns the escaped URL of a path below the root, with a trailing slash for directories.
+func (h *webDAVHandler) href(rel string, dir bool) string {
+	u := url.URL{Path: h.prefix + rel}
+	href := u.EscapedPath()
+	if dir && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+
+	return href
+}
+
+// get serves a file, or a simple HTML listing for a directory.
+func (h *webDAVHandler) get(w http.ResponseWriter, r *http.Request, rel, full string) error {
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		if err := h.authorizer.authorize(r.Context(), FileDownload, full); err != nil {
+			return err
+		}
+
+		f, err := os.Open(full)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w.Header().Set("ETag", davETag(info))
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+		return nil
+	}
+
+	if err := h.authorizer.authorize(r.Context(), FileList, full); err != nil {
+		return err
+	}
+
+	entries, err := h.readDir(full)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<title>%s</title>\n<ul>\n", html.EscapeString(rel))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(h.href(path.Join(rel, e.Name()), e.IsDir())), html.EscapeString(name))
+	}
+	fmt.Fprint(w, "</ul>\n")
+
+	return nil
+}
+
+// readDir lists a directory sorted by name, without the trash.
+func (h *webDAVHandler) readDir(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.Name() == trashDirName {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	return infos, nil
+}
+
+// davETag returns a validator from the size and modification time.
+func davETag(info os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	NS        string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string        `xml:"D:href"`
+	Propstat []davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string           `xml:"D:displayname,omitempty"`
+	ResourceType  *davResourceType `xml:"D:resourcetype,omitempty"`
+	ContentLength string           `xml:"D:getcontentlength,omitempty"`
+	ContentType   string           `xml:"D:getcontenttype,omitempty"`
+	LastModified  string           `xml:"D:getlastmodified,omitempty"`
+	ETag          string           `xml:"D:getetag,omitempty"`
+	Any           []davAnyProp
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// davAnyProp is an arbitrary property, as named in a PROPPATCH request.
+type davAnyProp struct {
+	XMLName xml.Name
+}
+
+// davStatus formats a propstat status line.
+func davStatus(status int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", status, http.StatusText(status))
+}
+
+// davProps describes a file or directory.
+func (h *webDAVHandler) davProps(rel string, info os.FileInfo) davResponse {
+	prop := davProp{
+		DisplayName:  info.Name(),
+		ResourceType: &davResourceType{},
+		LastModified: info.ModTime().UTC().Format(http.TimeFormat),
+	}
+
+	if info.IsDir() {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		prop.ContentLength = strconv.FormatInt(info.Size(), 10)
+		prop.ContentType = mime.TypeByExtension(filepath.Ext(info.Name()))
+		if prop.ContentType == "" {
+			prop.ContentType = "application/octet-stream"
+		}
+		prop.ETag = davETag(info)
+	}
+
+	return davResponse{
+		Href:     h.href(rel, info.IsDir()),
+		Propstat: []davPropstat{{Prop: prop, Status: davStatus(http.StatusOK)}},
+	}
+}
+
+// writeMultistatus writes a 207 Multi-Status response.
+func writeMultistatus(w http.ResponseWriter, responses []davResponse) error {
+	out, err := xml.Marshal(davMultistatus{NS: "DAV:", Responses: responses})
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, xml.Header)
+	_, err = w.Write(out)
+
+	return err
+}
+
+// propfind describes a resource and, with Depth 1, its children. Every property is returned whatever the request
+// body asks for, which clients accept.
+func (h *webDAVHandler) propfind(w http.ResponseWriter, r *http.Request, rel, full string) error {
+	depth := r.Header.Get("Depth")
+	if depth == "" || strings.EqualFold(depth, "infinity") {
+		// infinite depth is commonly refused (RFC 4918 section 9.1)
+		return davStatusError(http.StatusForbidden)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+
+	if err := h.authorizer.authorize(r.Context(), FileList, full); err != nil {
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20))
+
+	responses := []davResponse{h.davProps(rel, info)}
+	if depth == "1" && info.IsDir() {
+		entries, err := h.readDir(full)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			responses = append(responses, h.davProps(path.Join(rel, e.Name()), e))
+		}
+	}
+
+	return writeMultistatus(w, responses)
+}
+
+// proppatch accepts property updates without storing them, which Windows clients need when writing files.
+func (h *webDAVHandler) proppatch(w http.ResponseWriter, r *http.Request, rel, full string) error {
+	if _, err := os.Stat(full); err != nil {
+		return err
+	}
+	if err := h.authorizer.authorize(r.Context(), FileUpload, full); err != nil {
+		return err
+	}
+
+	var update struct {
+		Set []struct {
+			Props []davAnyProp `xml:",any"`
+		} `xml:"set>prop"`
+		Remove []struct {
+			Props []davAnyProp `xml:",any"`
+		} `xml:"remove>prop"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&update); err != nil {
+		return davStatusError(http.StatusBadRequest)
+	}
+
+	var props []davAnyProp
+	for _, s := range update.Set {
+		props = append(props, s.Props...)
+	}
+	for _, s := range update.Remove {
+		props = append(props, s.Props...)
+	}
+
+	return writeMultistatus(w, []davResponse{{
+		Href:     h.href(rel, false),
+		Propstat: []davPropstat{{Prop: davProp{Any: props}, Status: davStatus(http.StatusOK)}},
+	}})
+}
+
+// put uploads a file, writing to a temporary file first so readers never see partial content.
+func (h *webDAVHandler) put(w http.ResponseWriter, r *http.Request, full string) error {
+	if err := h.authorizer.authorize(r.Context(), FileUpload, full); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(full)
+	if err == nil && info.IsDir() {
+		return davStatusError(http.StatusMethodNotAllowed)
+	}
+	exists := err == nil
+
+	if _, err := os.Stat(filepath.Dir(full)); err != nil {
+		return davStatusError(http.StatusConflict)
+	}
+
+	body := io.Reader(r.Body)
+	if h.maxSize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxSize)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := copyBuffered(tmp, body); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), full); err != nil {
+		return err
+	}
+
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	return nil
+}
+
+// delete removes a file or a directory with its contents.
+func (h *webDAVHandler) delete(w http.ResponseWriter, r *http.Request, full string) error {
+	if filepath.Clean(full) == filepath.Clean(h.rootOf(r.Context())) {
+		return davStatusError(http.StatusForbidden)
+	}
+
+	if _, err := os.Stat(full); err != nil {
+		return err
+	}
+	if err := h.authorizer.authorize(r.Context(), FileDelete, full); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(full); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+// rootOf returns the directory served for the request's tenant.
+func (h *webDAVHandler) rootOf(ctx context.Context) string {
+	_, full, _ := h.resolve(ctx, h.prefix+"/")
+	return full
+}
+
+// mkcol creates a directory.
+func (h *webDAVHandler) mkcol(w http.ResponseWriter, r *http.Request, full string) error {
+	if r.ContentLength > 0 {
+		return davStatusError(http.StatusUnsupportedMediaType)
+	}
+	if err := h.authorizer.authorize(r.Context(), FileUpload, full); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(full); err == nil {
+		return davStatusError(http.StatusMethodNotAllowed)
+	}
+	if _, err := os.Stat(filepath.Dir(full)); err != nil {
+		return davStatusError(http.StatusConflict)
+	}
+
+	if err := os.Mkdir(full, 0755); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusCreated)
+
+	return nil
+}
+
+// copyMove copies or moves a resource to the Destination header, honoring the Overwrite header.
+func (h *webDAVHandler) copyMove(w http.ResponseWriter, r *http.Request, full string) error {
+	dest, err := url.Parse(r.Header.Get("Destination"))
+	if err != nil || dest.Path == "" {
+		return davStatusError(http.StatusBadRequest)
+	}
+	if dest.Host != "" && dest.Host != r.Host {
+		return davStatusError(http.StatusBadGateway)
+	}
+
+	_, destFull, err := h.resolve(r.Context(), dest.Path)
+	if err != nil {
+		return err
+	}
+	if filepath.Clean(full) == filepath.Clean(h.rootOf(r.Context())) || destFull == full || pathWithin(destFull, full) {
+		return davStatusError(http.StatusForbidden)
+	}
+
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+
+	move := r.Method == "MOVE"
+	action := FileDownload
+	if move {
+		action = FileDelete
+	}
+	if err := h.authorizer.authorize(r.Context(), action, full); err != nil {
+		return err
+	}
+	if err := h.authorizer.authorize(r.Context(), FileUpload, destFull); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Dir(destFull)); err != nil {
+		return davStatusError(http.StatusConflict)
+	}
+
+	_, err = os.Stat(destFull)
+	exists := err == nil
+	if exists {
+		if strings.EqualFold(r.Header.Get("Overwrite"), "F") {
+			return davStatusError(http.StatusPreconditionFailed)
+		}
+		if err := os.RemoveAll(destFull); err != nil {
+			return err
+		}
+	}
+
+	if move {
+		err = os.Rename(full, destFull)
+	} else if info.IsDir() {
+		err = copyDir(full, destFull)
+	} else {
+		err = copyFile(full, destFull)
+	}
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	return nil
+}
+
+// copyDir copies a directory tree.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		return copyFile(p, target)
+	})
+}
+
+// copyFile copies a regular file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := copyBuffered(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// lock grants a write lock, creating an empty file for a new name as RFC 4918 requires. Locks are not tracked,
+// so they only serve clients that refuse to write without one.
+func (h *webDAVHandler) lock(w http.ResponseWriter, r *http.Request, rel, full string) error {
+	if err := h.authorizer.authorize(r.Context(), FileUpload, full); err != nil {
+		return err
+	}
+
+	status := http.StatusOK
+	info, err := os.Stat(full)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if _, err := os.Stat(filepath.Dir(full)); err != nil {
+			return davStatusError(http.StatusConflict)
+		}
+		f, err := os.OpenFile(full, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+		status = http.StatusCreated
+	case err != nil:
+		return err
+	}
+
+	token := "opaquelocktoken:" + randomHex(16)
+	href := h.href(rel, info != nil && info.IsDir())
+
+	var escaped strings.Builder
+	_ = xml.EscapeText(&escaped, []byte(href))
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Lock-Token", "<"+token+">")
+	w.WriteHeader(status)
+
+	_, err = fmt.Fprintf(w, `%s<D:prop xmlns:D="DAV:"><D:lockdiscovery><D:activelock>`+
+		`<D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope><D:depth>0</D:depth>`+
+		`<D:timeout>Second-%d</D:timeout><D:locktoken><D:href>%s</D:href></D:locktoken>`+
+		`<D:lockroot><D:href>%s</D:href></D:lockroot></D:activelock></D:lockdiscovery></D:prop>`,
+		xml.Header, int(time.Hour.Seconds()), token, escaped.String())
+
+	return err
+}
@@ -0,0 +1,173 @@
+package toolkit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// davRequest sends a request to a WebDAV handler.
+func davRequest(h http.Handler, ctx context.Context, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(ctx)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	return rr
+}
+
+var webDAVTests = []struct {
+	name    string
+	method  string
+	target  string
+	body    string
+	headers map[string]string
+	status  int
+	file    string
+	content string
+}{
+	{name: "options", method: http.MethodOptions, target: "/dav/", status: http.StatusOK},
+	{name: "put new", method: http.MethodPut, target: "/dav/docs/new.txt", body: "new", status: http.StatusCreated, file: "docs/new.txt", content: "new"},
+	{name: "put existing", method: http.MethodPut, target: "/dav/docs/a.txt", body: "changed", status: http.StatusNoContent, file: "docs/a.txt", content: "changed"},
+	{name: "put missing parent", method: http.MethodPut, target: "/dav/missing/a.txt", body: "x", status: http.StatusConflict},
+	{name: "get", method: http.MethodGet, target: "/dav/docs/a.txt", status: http.StatusOK},
+	{name: "get missing", method: http.MethodGet, target: "/dav/docs/missing.txt", status: http.StatusNotFound},
+	{name: "get trash", method: http.MethodGet, target: "/dav/.trash/x", status: http.StatusNotFound},
+	{name: "outside prefix", method: http.MethodGet, target: "/other/docs/a.txt", status: http.StatusNotFound},
+	{name: "propfind infinity", method: "PROPFIND", target: "/dav/", headers: map[string]string{"Depth": "infinity"}, status: http.StatusForbidden},
+	{name: "mkcol", method: "MKCOL", target: "/dav/photos", status: http.StatusCreated, file: "photos"},
+	{name: "mkcol existing", method: "MKCOL", target: "/dav/docs", status: http.StatusMethodNotAllowed},
+	{name: "copy", method: "COPY", target: "/dav/docs/a.txt", headers: map[string]string{"Destination": "http://example.com/dav/b.txt"}, status: http.StatusCreated, file: "b.txt", content: "hello"},
+	{name: "copy directory", method: "COPY", target: "/dav/docs", headers: map[string]string{"Destination": "/dav/docs2"}, status: http.StatusCreated, file: "docs2/a.txt", content: "hello"},
+	{name: "copy no overwrite", method: "COPY", target: "/dav/docs/a.txt", headers: map[string]string{"Destination": "/dav/readme.txt", "Overwrite": "F"}, status: http.StatusPreconditionFailed, file: "readme.txt", content: "readme"},
+	{name: "copy other host", method: "COPY", target: "/dav/docs/a.txt", headers: map[string]string{"Destination": "http://other.com/dav/b.txt"}, status: http.StatusBadGateway},
+	{name: "move overwrite", method: "MOVE", target: "/dav/docs/a.txt", headers: map[string]string{"Destination": "/dav/readme.txt"}, status: http.StatusNoContent, file: "readme.txt", content: "hello"},
+	{name: "move into itself", method: "MOVE", target: "/dav/docs", headers: map[string]string{"Destination": "/dav/docs/sub"}, status: http.StatusForbidden},
+	{name: "delete", method: http.MethodDelete, target: "/dav/docs", status: http.StatusNoContent},
+	{name: "delete root", method: http.MethodDelete, target: "/dav/", status: http.StatusForbidden},
+	{name: "lock new", method: "LOCK", target: "/dav/locked.txt", status: http.StatusCreated, file: "locked.txt", content: ""},
+	{name: "unlock", method: "UNLOCK", target: "/dav/locked.txt", status: http.StatusNoContent},
+	{name: "proppatch", method: "PROPPATCH", target: "/dav/readme.txt", body: `<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:"><D:set><D:prop><Z:Win32LastModifiedTime>x</Z:Win32LastModifiedTime></D:prop></D:set></D:propertyupdate>`, status: http.StatusMultiStatus},
+}
+
+// newWebDAVRoot creates a directory with docs/a.txt, readme.txt and a trash directory.
+func newWebDAVRoot(t *testing.T) string {
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	_ = os.MkdirAll(filepath.Join(root, trashDirName), 0755)
+	_ = os.WriteFile(filepath.Join(root, "docs", "a.txt"), []byte("hello"), 0644)
+	_ = os.WriteFile(filepath.Join(root, "readme.txt"), []byte("readme"), 0644)
+
+	return root
+}
+
+func TestTools_WebDAVHandler(t *testing.T) {
+	var testTools Tools
+
+	for _, e := range webDAVTests {
+		root := newWebDAVRoot(t)
+		h := testTools.WebDAVHandler(root, nil, WebDAVOptions{Prefix: "/dav/"})
+
+		rr := davRequest(h, context.Background(), e.method, e.target, e.body, e.headers)
+		if rr.Code != e.status {
+			t.Errorf("%s: expected status %d, got %d: %s", e.name, e.status, rr.Code, rr.Body.String())
+		}
+
+		if e.file == "" {
+			continue
+		}
+
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(e.file)))
+		if err != nil {
+			t.Errorf("%s: expected %s to exist: %s", e.name, e.file, err)
+			continue
+		}
+		if !info.IsDir() {
+			b, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(e.file)))
+			if string(b) != e.content {
+				t.Errorf("%s: expected %s to contain %q, got %q", e.name, e.file, e.content, b)
+			}
+		}
+	}
+}
+
+func TestTools_WebDAVHandler_Propfind(t *testing.T) {
+	var testTools Tools
+
+	root := newWebDAVRoot(t)
+	_ = os.WriteFile(filepath.Join(root, "docs", "my report.pdf"), []byte("%PDF"), 0644)
+	h := testTools.WebDAVHandler(root, nil, WebDAVOptions{Prefix: "/dav"})
+
+	rr := davRequest(h, context.Background(), "PROPFIND", "/dav/docs", "", map[string]string{"Depth": "1"})
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got %d", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		`<D:multistatus xmlns:D="DAV:">`,
+		`<D:href>/dav/docs/</D:href>`,
+		`<D:resourcetype><D:collection></D:collection></D:resourcetype>`,
+		`<D:href>/dav/docs/my%20report.pdf</D:href>`,
+		`<D:getcontentlength>4</D:getcontentlength><D:getcontenttype>application/pdf</D:getcontenttype>`,
+		`<D:status>HTTP/1.1 200 OK</D:status>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in %s", want, body)
+		}
+	}
+
+	rr = davRequest(h, context.Background(), "PROPFIND", "/dav/", "", map[string]string{"Depth": "1"})
+	if strings.Contains(rr.Body.String(), trashDirName) {
+		t.Errorf("expected the trash to be hidden, got %s", rr.Body.String())
+	}
+}
+
+func TestTools_WebDAVHandler_Access(t *testing.T) {
+	var testTools Tools
+
+	root := newWebDAVRoot(t)
+
+	readOnly := testTools.WebDAVHandler(root, nil, WebDAVOptions{ReadOnly: true})
+	if rr := davRequest(readOnly, context.Background(), http.MethodPut, "/docs/a.txt", "x", nil); rr.Code != http.StatusMethodNotAllowed || strings.Contains(rr.Header().Get("Allow"), "PUT") {
+		t.Errorf("expected read-only handler to refuse PUT, got %d %s", rr.Code, rr.Header().Get("Allow"))
+	}
+	if rr := davRequest(readOnly, context.Background(), http.MethodGet, "/docs/a.txt", "", nil); rr.Code != http.StatusOK || rr.Body.String() != "hello" {
+		t.Errorf("expected read-only handler to serve files, got %d", rr.Code)
+	}
+
+	authorizer := &RoleAuthorizer{Rules: []ACLRule{
+		{Role: "*", Actions: []FileAction{FileList, FileDownload}},
+		{Role: "editor"},
+	}}
+	h := testTools.WebDAVHandler(root, authorizer)
+
+	viewer := WithSubject(context.Background(), Subject{ID: "ann"})
+	if rr := davRequest(h, viewer, http.MethodGet, "/docs/a.txt", "", nil); rr.Code != http.StatusOK {
+		t.Errorf("expected viewer to download, got %d", rr.Code)
+	}
+	if rr := davRequest(h, viewer, http.MethodDelete, "/docs/a.txt", "", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected viewer delete to be forbidden, got %d", rr.Code)
+	}
+	if rr := davRequest(h, context.Background(), "PROPFIND", "/docs", "", map[string]string{"Depth": "0"}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected anonymous listing to be forbidden, got %d", rr.Code)
+	}
+
+	editor := WithSubject(context.Background(), Subject{ID: "bob", Roles: []string{"editor"}})
+	if rr := davRequest(h, editor, http.MethodDelete, "/docs/a.txt", "", nil); rr.Code != http.StatusNoContent {
+		t.Errorf("expected editor to delete, got %d", rr.Code)
+	}
+
+	tenant := WithTenant(context.Background(), "acme")
+	_ = os.MkdirAll(filepath.Join(root, "acme"), 0755)
+	if rr := davRequest(readOnly, tenant, http.MethodGet, "/readme.txt", "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected tenant to be scoped to its directory, got %d", rr.Code)
+	}
+}
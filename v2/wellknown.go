@@ -0,0 +1,240 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RobotsGroup is a set of robots.txt rules applying to one or more user agents.
+type RobotsGroup struct {
+	UserAgents []string
+	Allow      []string
+	Disallow   []string
+	CrawlDelay time.Duration
+}
+
+// RobotsPolicy describes the content of a robots.txt file.
+// Fields:
+// - Groups: The rule groups, written in order. An empty policy allows every crawler everywhere.
+// - Sitemaps: Absolute URLs of sitemaps advertised to crawlers.
+type RobotsPolicy struct {
+	Groups   []RobotsGroup
+	Sitemaps []string
+}
+
+// String renders the policy in robots.txt format.
+func (p RobotsPolicy) String() string {
+	var b strings.Builder
+
+	groups := p.Groups
+	if len(groups) == 0 {
+		groups = []RobotsGroup{{UserAgents: []string{"*"}}}
+	}
+
+	for i, g := range groups {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+
+		agents := g.UserAgents
+		if len(agents) == 0 {
+			agents = []string{"*"}
+		}
+		for _, ua := range agents {
+			fmt.Fprintf(&b, "User-agent: %s\n", ua)
+		}
+
+		for _, a := range g.Allow {
+			fmt.Fprintf(&b, "Allow: %s\n", a)
+		}
+
+		if len(g.Disallow) == 0 && len(g.Allow) == 0 {
+			b.WriteString("Disallow:\n")
+		}
+		for _, d := range g.Disallow {
+			fmt.Fprintf(&b, "Disallow: %s\n", d)
+		}
+
+		if g.CrawlDelay > 0 {
+			fmt.Fprintf(&b, "Crawl-delay: %s\n", strconv.FormatFloat(g.CrawlDelay.Seconds(), 'f', -1, 64))
+		}
+	}
+
+	if len(p.Sitemaps) > 0 {
+		b.WriteString("\n")
+		for _, s := range p.Sitemaps {
+			fmt.Fprintf(&b, "Sitemap: %s\n", s)
+		}
+	}
+
+	return b.String()
+}
+
+// RobotsHandler returns a handler serving the given policy as /robots.txt.
+// Parameters:
+// - policy: The robots.txt policy to serve.
+// Returns an http.HandlerFunc writing the policy as text/plain.
+func (t *Tools) RobotsHandler(policy RobotsPolicy) http.HandlerFunc {
+	body := []byte(policy.String())
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	}
+}
+
+// SitemapURL is a single entry of a sitemap.
+// Fields:
+// - Loc: The absolute URL of the page.
+// - LastMod: When the page last changed. It's omitted if zero.
+// - ChangeFreq: A hint such as "daily" or "weekly". It's omitted if empty.
+// - Priority: The relative priority between 0 and 1. It's omitted if zero.
+type SitemapURL struct {
+	Loc        string
+	LastMod    time.Time
+	ChangeFreq string
+	Priority   float64
+}
+
+// SitemapProvider returns every URL that should appear in the sitemap.
+type SitemapProvider func(ctx context.Context) ([]SitemapURL, error)
+
+// maxSitemapURLs is the limit of URLs per sitemap file set by the sitemaps.org protocol.
+const maxSitemapURLs = 50000
+
+// SitemapHandler returns a handler generating sitemap.xml from provider on every request.
+// When there are more URLs than fit in one sitemap, the handler serves a sitemap index linking to
+// pages of the same handler selected with the "page" query parameter (?page=1, ?page=2...).
+// Parameters:
+// - provider: The function listing the URLs of the site.
+// - perPage: An optional number of URLs per sitemap page; it defaults to, and is capped at, 50,000.
+// Returns an http.HandlerFunc writing the sitemap as application/xml.
+func (t *Tools) SitemapHandler(provider SitemapProvider, perPage ...int) http.HandlerFunc {
+	pageSize := maxSitemapURLs
+	if len(perPage) > 0 && perPage[0] > 0 && perPage[0] < maxSitemapURLs {
+		pageSize = perPage[0]
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		urls, err := provider(r.Context())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		pages := (len(urls) + pageSize - 1) / pageSize
+
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+
+		page := r.URL.Query().Get("page")
+		switch {
+		case page == "" && pages > 1:
+			writeSitemapIndex(&buf, r, pages)
+
+		case page == "":
+			writeSitemap(&buf, urls)
+
+		default:
+			n, err := strconv.Atoi(page)
+			if err != nil || n < 1 || n > pages {
+				http.NotFound(w, r)
+				return
+			}
+
+			end := n * pageSize
+			if end > len(urls) {
+				end = len(urls)
+			}
+			writeSitemap(&buf, urls[(n-1)*pageSize:end])
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// writeSitemap writes a <urlset> document.
+func writeSitemap(buf *bytes.Buffer, urls []SitemapURL) {
+	buf.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+
+	for _, u := range urls {
+		buf.WriteString("  <url><loc>")
+		_ = xml.EscapeText(buf, []byte(u.Loc))
+		buf.WriteString("</loc>")
+
+		if !u.LastMod.IsZero() {
+			fmt.Fprintf(buf, "<lastmod>%s</lastmod>", u.LastMod.UTC().Format(time.RFC3339))
+		}
+		if u.ChangeFreq != "" {
+			buf.WriteString("<changefreq>")
+			_ = xml.EscapeText(buf, []byte(u.ChangeFreq))
+			buf.WriteString("</changefreq>")
+		}
+		if u.Priority > 0 {
+			fmt.Fprintf(buf, "<priority>%.1f</priority>", u.Priority)
+		}
+
+		buf.WriteString("</url>\n")
+	}
+
+	buf.WriteString("</urlset>\n")
+}
+
+// writeSitemapIndex writes a <sitemapindex> document pointing at each page of the current URL.
+func writeSitemapIndex(buf *bytes.Buffer, r *http.Request, pages int) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	buf.WriteString(`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
+
+	for i := 1; i <= pages; i++ {
+		buf.WriteString("  <sitemap><loc>")
+		_ = xml.EscapeText(buf, []byte(fmt.Sprintf("%s://%s%s?page=%d", scheme, r.Host, r.URL.Path, i)))
+		buf.WriteString("</loc></sitemap>\n")
+	}
+
+	buf.WriteString("</sitemapindex>\n")
+}
+
+// FaviconHandler returns a handler serving an embedded favicon with long-lived caching and ETag revalidation.
+// Parameters:
+// - icon: The icon file contents, typically embedded with //go:embed.
+// Returns an http.HandlerFunc serving the icon with a sniffed Content-Type.
+func (t *Tools) FaviconHandler(icon []byte) http.HandlerFunc {
+	sum := sha256.Sum256(icon)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	contentType := http.DetectContentType(icon)
+	if bytes.HasPrefix(icon, []byte{0, 0, 1, 0}) {
+		contentType = "image/x-icon"
+	} else if bytes.Contains(icon[:min(len(icon), 512)], []byte("<svg")) {
+		contentType = "image/svg+xml"
+	}
+
+	modTime := time.Now()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Header().Set("ETag", etag)
+
+		http.ServeContent(w, r, "favicon", modTime, bytes.NewReader(icon))
+	}
+}
@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_RobotsHandler(t *testing.T) {
+	var testTools Tools
+
+	policy := RobotsPolicy{
+		Groups: []RobotsGroup{
+			{UserAgents: []string{"*"}, Disallow: []string{"/admin"}, CrawlDelay: 2 * time.Second},
+		},
+		Sitemaps: []string{"https://example.com/sitemap.xml"},
+	}
+
+	rr := httptest.NewRecorder()
+	testTools.RobotsHandler(policy)(rr, httptest.NewRequest(http.MethodGet, "/robots.txt", nil))
+
+	expected := "User-agent: *\nDisallow: /admin\nCrawl-delay: 2\n\nSitemap: https://example.com/sitemap.xml\n"
+	if rr.Body.String() != expected {
+		t.Errorf("unexpected robots.txt:\n%s", rr.Body.String())
+	}
+}
+
+func TestTools_RobotsPolicyEmpty(t *testing.T) {
+	if s := (RobotsPolicy{}).String(); s != "User-agent: *\nDisallow:\n" {
+		t.Errorf("unexpected empty policy: %q", s)
+	}
+}
+
+func TestTools_SitemapHandler(t *testing.T) {
+	var testTools Tools
+
+	provider := func(ctx context.Context) ([]SitemapURL, error) {
+		var urls []SitemapURL
+		for i := 0; i < 5; i++ {
+			urls = append(urls, SitemapURL{Loc: fmt.Sprintf("https://example.com/p/%d?a=1&b=2", i), LastMod: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)})
+		}
+		return urls, nil
+	}
+
+	handler := testTools.SitemapHandler(provider, 2)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "http://example.com/sitemap.xml", nil))
+
+	if !strings.Contains(rr.Body.String(), "<sitemapindex") || strings.Count(rr.Body.String(), "<sitemap>") != 3 {
+		t.Errorf("expected a sitemap index with 3 pages, got:\n%s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "http://example.com/sitemap.xml?page=3", nil))
+
+	body := rr.Body.String()
+	if strings.Count(body, "<url>") != 1 || !strings.Contains(body, "p/4?a=1&amp;b=2") || !strings.Contains(body, "<lastmod>2024-01-02T00:00:00Z</lastmod>") {
+		t.Errorf("unexpected last page:\n%s", body)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "http://example.com/sitemap.xml?page=4", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for out of range page, got %d", rr.Code)
+	}
+}
+
+func TestTools_FaviconHandler(t *testing.T) {
+	var testTools Tools
+
+	icon, _ := os.ReadFile("./testdata/img.png")
+	handler := testTools.FaviconHandler(icon)
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/favicon.ico", nil))
+
+	if rr.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("expected image/png, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/favicon.ico", nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	handler(rr, req)
+
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 on matching ETag, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,689 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSXRowFunc produces the rows of a sheet one at a time, e.g. from a database cursor, so large sheets are never
+// held in memory. It calls write for each row and returns the first error write returns.
+type XLSXRowFunc func(write func(row ...interface{}) error) error
+
+// XLSXSheet is a worksheet written by WriteXLSX.
+// Fields:
+// - Name: The sheet's name. Defaults to "Sheet1", "Sheet2" and so on. Characters Excel forbids are replaced, and
+// names are cut to 31 characters.
+// - Headers: The header row, written in bold. For a slice of structs, it defaults to the fields' `xlsx` tags, or
+// their names; use `xlsx:"-"` to leave a field out.
+// - Rows: The rows, as a slice of structs or pointers to structs, a [][]interface{}, or an XLSXRowFunc.
+// - Widths: Column widths in characters, by column. Columns without a width are sized to fit the header.
+// - Formats: Excel number formats, by column, e.g. "#,##0.00", "0%" or "yyyy-mm-dd". Times default to
+// "yyyy-mm-dd hh:mm:ss".
+// - FreezeHeader: Keeps the header row visible while scrolling.
+type XLSXSheet struct {
+	Name         string
+	Headers      []string
+	Rows         interface{}
+	Widths       []float64
+	Formats      []string
+	FreezeHeader bool
+}
+
+// XLSXOptions configures WriteXLSX.
+// Fields:
+// - Filename: If set and w is an http.ResponseWriter, the workbook is sent as an attachment with this name.
+type XLSXOptions struct {
+	Filename string
+}
+
+// xlsxDateFormat is the format of time values in columns without one.
+const xlsxDateFormat = "yyyy-mm-dd hh:mm:ss"
+
+// WriteXLSX writes an Excel workbook, streaming rows to w as they are produced. Strings are written inline rather
+// than in a shared string table, so memory use does not grow with the number of rows. Numbers, booleans and times
+// are written as such, so they can be summed and sorted; nil values leave the cell empty.
+// Parameters:
+// - w: The writer, e.g. an http.ResponseWriter.
+// - sheets: The worksheets.
+// - opts: Optional XLSXOptions. Only the first value is used if multiple are provided.
+// Returns an error if a sheet's Rows has an unsupported type, or if producing rows or writing fails.
+func (t *Tools) WriteXLSX(w io.Writer, sheets []XLSXSheet, opts ...XLSXOptions) error {
+	var o XLSXOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if len(sheets) == 0 {
+		sheets = []XLSXSheet{{}}
+	}
+
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		if o.Filename != "" {
+			rw.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": o.Filename}))
+		}
+	}
+
+	styles := newXLSXStyles()
+	names := make([]string, len(sheets))
+	used := make(map[string]bool)
+	for i, s := range sheets {
+		names[i] = xlsxSheetName(s.Name, i, used)
+		for _, f := range s.Formats {
+			styles.id(f)
+		}
+	}
+	styles.id(xlsxDateFormat)
+
+	zw := zip.NewWriter(w)
+
+	for i, s := range sheets {
+		f, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeXLSXSheet(f, s, styles); err != nil {
+			return fmt.Errorf("xlsx: sheet %q: %w", names[i], err)
+		}
+	}
+
+	var workbook, rels, types strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(names)+1)
+
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			types.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbook.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			rels.String() + `</Relationships>`},
+		{"xl/styles.xml", styles.xml()},
+	}
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+p.body); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// xlsxStyles collects the number formats used, each becoming a cell style. Style 0 is the default and style 1 the
+// bold header.
+type xlsxStyles struct {
+	formats []string
+	ids     map[string]int
+}
+
+func newXLSXStyles() *xlsxStyles {
+	return &xlsxStyles{ids: make(map[string]int)}
+}
+
+// id returns the style of cells with a number format, or 0 for none.
+func (s *xlsxStyles) id(format string) int {
+	if format == "" {
+		return 0
+	}
+	if id, ok := s.ids[format]; ok {
+		return id
+	}
+
+	s.formats = append(s.formats, format)
+	s.ids[format] = len(s.formats) + 1
+
+	return s.ids[format]
+}
+
+func (s *xlsxStyles) xml() string {
+	var b strings.Builder
+	b.WriteString(`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(s.formats) > 0 {
+		fmt.Fprintf(&b, `<numFmts count="%d">`, len(s.formats))
+		for i, f := range s.formats {
+			fmt.Fprintf(&b, `<numFmt numFmtId="%d" formatCode="%s"/>`, 164+i, xmlEscape(f))
+		}
+		b.WriteString(`</numFmts>`)
+	}
+	b.WriteString(`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>`)
+	b.WriteString(`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>`)
+	b.WriteString(`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>`)
+	b.WriteString(`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>`)
+	fmt.Fprintf(&b, `<cellXfs count="%d">`, len(s.formats)+2)
+	b.WriteString(`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>`)
+	b.WriteString(`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>`)
+	for i := range s.formats {
+		fmt.Fprintf(&b, `<xf numFmtId="%d" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>`, 164+i)
+	}
+	b.WriteString(`</cellXfs><cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles></styleSheet>`)
+
+	return b.String()
+}
+
+// xlsxSheetName returns a valid, unique sheet name.
+func xlsxSheetName(name string, i int, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(i+1)
+	}
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+
+	base := name
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		suffix := " (" + strconv.Itoa(n) + ")"
+		r := []rune(base)
+		name = string(r[:min(len(r), 31-len(suffix))]) + suffix
+	}
+	used[strings.ToLower(name)] = true
+
+	return name
+}
+
+// writeXLSXSheet streams a worksheet.
+func writeXLSXSheet(w io.Writer, s XLSXSheet, styles *xlsxStyles) error {
+	rows, headers, err := xlsxRows(s)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+
+	if s.FreezeHeader && len(headers) > 0 {
+		bw.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	}
+
+	columns := max(len(headers), len(s.Widths))
+	if columns > 0 {
+		bw.WriteString(`<cols>`)
+		for i := 0; i < columns; i++ {
+			width := 10.0
+			if i < len(headers) {
+				width = max(width, float64(len([]rune(headers[i])))+2)
+			}
+			if i < len(s.Widths) && s.Widths[i] > 0 {
+				width = s.Widths[i]
+			}
+			fmt.Fprintf(bw, `<col min="%d" max="%d" width="%g" customWidth="1"/>`, i+1, i+1, width)
+		}
+		bw.WriteString(`</cols>`)
+	}
+
+	bw.WriteString(`<sheetData>`)
+
+	rowNum := 0
+	writeRow := func(values []interface{}, header bool) error {
+		rowNum++
+		fmt.Fprintf(bw, `<row r="%d">`, rowNum)
+		for col, v := range values {
+			format := ""
+			if col < len(s.Formats) {
+				format = s.Formats[col]
+			}
+			writeXLSXCell(bw, xlsxCellRef(col, rowNum), v, format, header, styles)
+		}
+		_, err := bw.WriteString(`</row>`)
+		return err
+	}
+
+	if len(headers) > 0 {
+		values := make([]interface{}, len(headers))
+		for i, h := range headers {
+			values[i] = h
+		}
+		if err := writeRow(values, true); err != nil {
+			return err
+		}
+	}
+
+	if err := rows(func(row ...interface{}) error { return writeRow(row, false) }); err != nil {
+		return err
+	}
+
+	bw.WriteString(`</sheetData></worksheet>`)
+
+	return bw.Flush()
+}
+
+// xlsxRows returns a function producing the rows of a sheet, and its headers.
+func xlsxRows(s XLSXSheet) (XLSXRowFunc, []string, error) {
+	switch rows := s.Rows.(type) {
+	case nil:
+		return func(func(...interface{}) error) error { return nil }, s.Headers, nil
+	case XLSXRowFunc:
+		return rows, s.Headers, nil
+	case func(write func(row ...interface{}) error) error:
+		return rows, s.Headers, nil
+	case [][]interface{}:
+		return func(write func(...interface{}) error) error {
+			for _, row := range rows {
+				if err := write(row...); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, s.Headers, nil
+	}
+
+	v := reflect.ValueOf(s.Rows)
+	if v.Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("rows must be a slice or an XLSXRowFunc, got %T", s.Rows)
+	}
+
+	elem := v.Type().Elem()
+	for elem.Kind() == reflect.Pointer {
+		elem = elem.Elem()
+	}
+	if elem.Kind() != reflect.Struct || elem == reflect.TypeOf(time.Time{}) {
+		return nil, nil, fmt.Errorf("rows must be a slice of structs, got %T", s.Rows)
+	}
+
+	var fields []int
+	var names []string
+	for i := 0; i < elem.NumField(); i++ {
+		f := elem.Field(i)
+		tag := f.Tag.Get("xlsx")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		fields = append(fields, i)
+		names = append(names, tag)
+	}
+
+	headers := s.Headers
+	if headers == nil {
+		headers = names
+	}
+
+	return func(write func(...interface{}) error) error {
+		values := make([]interface{}, len(fields))
+		for i := 0; i < v.Len(); i++ {
+			item := v.Index(i)
+			for item.Kind() == reflect.Pointer && !item.IsNil() {
+				item = item.Elem()
+			}
+			if item.Kind() == reflect.Pointer {
+				continue
+			}
+			for j, f := range fields {
+				values[j] = item.Field(f).Interface()
+			}
+			if err := write(values...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, headers, nil
+}
+
+// xlsxCellRef returns the reference of a cell, e.g. "B3", from a zero-based column and one-based row.
+func xlsxCellRef(col, row int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+
+	return name + strconv.Itoa(row)
+}
+
+// xlsxEpoch is day zero of Excel's date serial numbers.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// writeXLSXCell writes one cell, choosing its type from the value.
+func writeXLSXCell(w *bufio.Writer, ref string, v interface{}, format string, header bool, styles *xlsxStyles) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return
+	}
+
+	style := styles.id(format)
+	if header {
+		style = 1
+	}
+	attrs := `r="` + ref + `"`
+	if style != 0 {
+		attrs += ` s="` + strconv.Itoa(style) + `"`
+	}
+
+	if tm, ok := rv.Interface().(time.Time); ok {
+		if tm.IsZero() {
+			return
+		}
+		if format == "" && !header {
+			attrs = `r="` + ref + `" s="` + strconv.Itoa(styles.id(xlsxDateFormat)) + `"`
+		}
+		// Excel has no time zones, so times are written as their wall clock in their own location
+		wall := time.Date(tm.Year(), tm.Month(), tm.Day(), tm.Hour(), tm.Minute(), tm.Second(), tm.Nanosecond(), time.UTC)
+		serial := float64(wall.Sub(xlsxEpoch)) / float64(24*time.Hour)
+		fmt.Fprintf(w, `<c %s><v>%s</v></c>`, attrs, strconv.FormatFloat(serial, 'f', -1, 64))
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		b := "0"
+		if rv.Bool() {
+			b = "1"
+		}
+		fmt.Fprintf(w, `<c %s t="b"><v>%s</v></c>`, attrs, b)
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, `<c %s><v>%d</v></c>`, attrs, rv.Int())
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(w, `<c %s><v>%d</v></c>`, attrs, rv.Uint())
+		return
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			fmt.Fprintf(w, `<c %s><v>%s</v></c>`, attrs, strconv.FormatFloat(f, 'f', -1, 64))
+			return
+		}
+	}
+
+	var s string
+	switch x := rv.Interface().(type) {
+	case string:
+		s = x
+	case []byte:
+		s = string(x)
+	case fmt.Stringer:
+		s = x.String()
+	case error:
+		s = x.Error()
+	default:
+		s = fmt.Sprint(x)
+	}
+
+	space := ""
+	if strings.TrimSpace(s) != s {
+		space = ` xml:space="preserve"`
+	}
+	fmt.Fprintf(w, `<c %s t="inlineStr"><is><t%s>%s</t></is></c>`, attrs, space, xmlEscape(s))
+}
+
+// xmlEscape escapes text for XML, replacing characters XML cannot hold.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+
+	return b.String()
+}
+
+// readXLSXRows reads the rows of a worksheet as text, keyed by their one-based row numbers. Cells formatted as dates
+// are returned as "2006-01-02" or "2006-01-02 15:04:05". The first sheet is read if sheet is empty.
+func readXLSXRows(data []byte, sheet string) ([][]string, []int, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+	decode := func(name string, v interface{}) error {
+		f, ok := files[name]
+		if !ok {
+			return fmt.Errorf("xlsx: missing %s", name)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		return xml.NewDecoder(rc).Decode(v)
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decode("xl/workbook.xml", &workbook); err != nil {
+		return nil, nil, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decode("xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, nil, err
+	}
+
+	target := ""
+	for _, s := range workbook.Sheets {
+		if sheet == "" || strings.EqualFold(s.Name, sheet) {
+			for _, r := range rels.Relationships {
+				if r.ID == s.RID {
+					target = r.Target
+				}
+			}
+			break
+		}
+	}
+	if target == "" {
+		return nil, nil, fmt.Errorf("xlsx: sheet %q not found", sheet)
+	}
+	if strings.HasPrefix(target, "/") {
+		target = strings.TrimPrefix(target, "/")
+	} else {
+		target = "xl/" + target
+	}
+
+	// shared strings, possibly rich text made of several runs
+	var shared []string
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+		if err := decode("xl/sharedStrings.xml", &sst); err != nil {
+			return nil, nil, err
+		}
+		for _, si := range sst.Items {
+			shared = append(shared, si.String())
+		}
+	}
+
+	dateStyles := make(map[int]bool)
+	if _, ok := files["xl/styles.xml"]; ok {
+		var styles struct {
+			NumFmts []struct {
+				ID   int    `xml:"numFmtId,attr"`
+				Code string `xml:"formatCode,attr"`
+			} `xml:"numFmts>numFmt"`
+			Xfs []struct {
+				NumFmtID int `xml:"numFmtId,attr"`
+			} `xml:"cellXfs>xf"`
+		}
+		if err := decode("xl/styles.xml", &styles); err != nil {
+			return nil, nil, err
+		}
+		custom := make(map[int]string)
+		for _, f := range styles.NumFmts {
+			custom[f.ID] = f.Code
+		}
+		for i, xf := range styles.Xfs {
+			dateStyles[i] = xlsxIsDateFormat(xf.NumFmtID, custom[xf.NumFmtID])
+		}
+	}
+
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R      string   `xml:"r,attr"`
+				T      string   `xml:"t,attr"`
+				S      int      `xml:"s,attr"`
+				V      string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := decode(target, &ws); err != nil {
+		return nil, nil, err
+	}
+
+	rows := make([][]string, 0, len(ws.Rows))
+	numbers := make([]int, 0, len(ws.Rows))
+	for i, row := range ws.Rows {
+		num := row.R
+		if num == 0 {
+			num = i + 1
+		}
+
+		var values []string
+		for j, c := range row.Cells {
+			col := j
+			if c.R != "" {
+				col = xlsxColumnIndex(c.R)
+			}
+			for len(values) <= col {
+				values = append(values, "")
+			}
+
+			switch c.T {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, nil, fmt.Errorf("xlsx: invalid shared string in %s", c.R)
+				}
+				values[col] = shared[n]
+			case "inlineStr":
+				values[col] = c.Inline.String()
+			case "b":
+				values[col] = map[string]string{"1": "true", "0": "false"}[c.V]
+			case "", "n":
+				values[col] = c.V
+				if f, err := strconv.ParseFloat(c.V, 64); err == nil && dateStyles[c.S] {
+					values[col] = xlsxSerialTime(f)
+				}
+			default:
+				values[col] = c.V
+			}
+		}
+
+		rows = append(rows, values)
+		numbers = append(numbers, num)
+	}
+
+	return rows, numbers, nil
+}
+
+// xlsxText is a string of a shared string table or an inline string.
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (x xlsxText) String() string {
+	if len(x.Runs) == 0 {
+		return x.T
+	}
+
+	var b strings.Builder
+	for _, r := range x.Runs {
+		b.WriteString(r.T)
+	}
+
+	return b.String()
+}
+
+// xlsxColumnIndex returns the zero-based column of a cell reference such as "AB12".
+func xlsxColumnIndex(ref string) int {
+	col := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A') + 1
+	}
+
+	return col - 1
+}
+
+// xlsxIsDateFormat reports whether a number format shows dates: a built-in date format, or a custom one with date
+// or time parts outside quoted text.
+func xlsxIsDateFormat(id int, code string) bool {
+	if (id >= 14 && id <= 22) || (id >= 45 && id <= 47) {
+		return true
+	}
+	if code == "" {
+		return false
+	}
+
+	quoted := false
+	for i := 0; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\':
+			i++
+		case c == '[':
+			// colors and conditions such as [Red] or [>100]
+			if end := strings.IndexByte(code[i:], ']'); end > 0 {
+				i += end
+			}
+		case !quoted && strings.ContainsRune("yYdDhHsS", rune(c)):
+			return true
+		}
+	}
+
+	return false
+}
+
+// xlsxSerialTime formats an Excel date serial number.
+func xlsxSerialTime(serial float64) string {
+	t := xlsxEpoch.Add(time.Duration(math.Round(serial*86400)) * time.Second)
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format("2006-01-02")
+	}
+
+	return t.Format("2006-01-02 15:04:05")
+}
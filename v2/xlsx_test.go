@@ -0,0 +1,154 @@
+package toolkit
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readXLSXPart returns a part of a workbook, checking that it is well-formed XML.
+func readXLSXPart(t *testing.T, data []byte, name string) string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatalf("missing %s: %v", name, err)
+	}
+	defer f.Close()
+
+	body, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		if _, err := dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("%s is not well-formed: %v", name, err)
+		}
+	}
+
+	return string(body)
+}
+
+func TestTools_WriteXLSX(t *testing.T) {
+	var testTools Tools
+
+	type order struct {
+		ID       int       `xlsx:"Order"`
+		Customer *string   `xlsx:"Customer"`
+		Total    float64   `xlsx:"Total (€)"`
+		Paid     bool      `xlsx:"Paid"`
+		PlacedAt time.Time `xlsx:"Placed at"`
+		internal string
+		Notes    string `xlsx:"-"`
+	}
+	ann := "Ann & <Co>"
+	orders := []*order{
+		{ID: 1, Customer: &ann, Total: 1234.5, Paid: true, PlacedAt: time.Date(2026, 1, 2, 12, 0, 0, 0, time.UTC)},
+		{ID: 2, Total: 10, PlacedAt: time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)},
+		nil,
+	}
+
+	rec := httptest.NewRecorder()
+	err := testTools.WriteXLSX(rec, []XLSXSheet{
+		{Name: "Orders: 2026/Q1", Rows: orders, Formats: []string{"", "", "#,##0.00"}, Widths: []float64{0, 30}, FreezeHeader: true},
+		{Rows: [][]interface{}{{"  padded ", nil, int64(-3)}}},
+		{Name: "Report", Headers: []string{"n", "square"}, Rows: XLSXRowFunc(func(write func(row ...interface{}) error) error {
+			for i := 1; i <= 3; i++ {
+				if err := write(i, i*i); err != nil {
+					return err
+				}
+			}
+			return nil
+		})},
+	}, XLSXOptions{Filename: "orders.xlsx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.Contains(ct, "spreadsheetml") {
+		t.Errorf("expected the xlsx content type, got %q", ct)
+	}
+	data := rec.Body.Bytes()
+
+	workbook := readXLSXPart(t, data, "xl/workbook.xml")
+	for _, name := range []string{`name="Orders_ 2026_Q1"`, `name="Sheet2"`, `name="Report"`} {
+		if !strings.Contains(workbook, name) {
+			t.Errorf("expected workbook to contain %s, got %s", name, workbook)
+		}
+	}
+
+	styles := readXLSXPart(t, data, "xl/styles.xml")
+	if !strings.Contains(styles, `formatCode="#,##0.00"`) || !strings.Contains(styles, `formatCode="yyyy-mm-dd hh:mm:ss"`) {
+		t.Errorf("expected the number formats in styles, got %s", styles)
+	}
+	readXLSXPart(t, data, "[Content_Types].xml")
+	readXLSXPart(t, data, "xl/_rels/workbook.xml.rels")
+	readXLSXPart(t, data, "_rels/.rels")
+
+	sheet := readXLSXPart(t, data, "xl/worksheets/sheet1.xml")
+	for _, want := range []string{
+		`state="frozen"`,
+		`<col min="2" max="2" width="30" customWidth="1"/>`,
+		`<c r="A1" s="1" t="inlineStr"><is><t>Order</t></is></c>`,
+		`<c r="C1" s="1" t="inlineStr"><is><t>Total (€)</t></is></c>`,
+		`<c r="B2" t="inlineStr"><is><t>Ann &amp; &lt;Co&gt;</t></is></c>`,
+		`<c r="C2" s="2"><v>1234.5</v></c>`,
+		`<c r="D2" t="b"><v>1</v></c>`,
+		`<c r="E2" s="3"><v>46024.5</v></c>`,
+		`<c r="E3" s="3"><v>61</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("expected sheet1 to contain %s", want)
+		}
+	}
+	if strings.Contains(sheet, "Notes") || strings.Contains(sheet, `<row r="4">`) {
+		t.Error("expected skipped fields and nil rows to be left out")
+	}
+
+	sheet2 := readXLSXPart(t, data, "xl/worksheets/sheet2.xml")
+	if !strings.Contains(sheet2, `<t xml:space="preserve">  padded </t>`) || !strings.Contains(sheet2, `<c r="C1"><v>-3</v></c>`) || strings.Contains(sheet2, `r="B1"`) {
+		t.Errorf("unexpected sheet2: %s", sheet2)
+	}
+
+	sheet3 := readXLSXPart(t, data, "xl/worksheets/sheet3.xml")
+	if !strings.Contains(sheet3, `<c r="B4"><v>9</v></c>`) {
+		t.Errorf("expected streamed rows in sheet3: %s", sheet3)
+	}
+
+	// errors from the row producer stop the workbook
+	failing := XLSXRowFunc(func(write func(row ...interface{}) error) error { return errors.New("cursor closed") })
+	if err := testTools.WriteXLSX(io.Discard, []XLSXSheet{{Rows: failing}}); err == nil || !strings.Contains(err.Error(), "cursor closed") {
+		t.Errorf("expected the row error, got %v", err)
+	}
+	if err := testTools.WriteXLSX(io.Discard, []XLSXSheet{{Rows: []int{1}}}); err == nil {
+		t.Error("expected unsupported rows to fail")
+	}
+}
+
+func TestXLSXCellRef(t *testing.T) {
+	var tests = []struct {
+		col  int
+		want string
+	}{
+		{0, "A1"}, {25, "Z1"}, {26, "AA1"}, {701, "ZZ1"}, {702, "AAA1"},
+	}
+
+	for _, e := range tests {
+		if got := xlsxCellRef(e.col, 1); got != e.want {
+			t.Errorf("%d: expected %s, got %s", e.col, e.want, got)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// XML namespaces and algorithm identifiers used by XML signatures.
+const (
+	nsXML           = "http://www.w3.org/XML/1998/namespace"
+	nsDSig          = "http://www.w3.org/2000/09/xmldsig#"
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+)
+
+// errUnsigned is returned by verifyEnvelopedSignature when an element carries no signature.
+var errUnsigned = errors.New("element is not signed")
+
+// xmlNode is an element of a parsed XML document, keeping the prefixes and namespace declarations needed to
+// canonicalize it.
+type xmlNode struct {
+	prefix   string
+	local    string
+	space    string
+	attrs    []xmlAttr
+	decls    map[string]string
+	children []xmlContent
+	parent   *xmlNode
+}
+
+// xmlAttr is an attribute of an xmlNode. Namespace declarations are kept in xmlNode.decls instead.
+type xmlAttr struct {
+	prefix string
+	local  string
+	space  string
+	value  string
+}
+
+// xmlContent is a child of an xmlNode: an element or text.
+type xmlContent struct {
+	node *xmlNode
+	text string
+}
+
+// parseXMLTree parses a document into its root element. Comments and processing instructions are dropped, and
+// documents with a DOCTYPE are rejected.
+func parseXMLTree(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, cur *xmlNode
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if cur == nil && root != nil {
+				return nil, errors.New("xml: multiple root elements")
+			}
+
+			n := &xmlNode{prefix: tok.Name.Space, local: tok.Name.Local, parent: cur}
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					n.declare(a.Name.Local, a.Value)
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					n.declare("", a.Value)
+				default:
+					n.attrs = append(n.attrs, xmlAttr{prefix: a.Name.Space, local: a.Name.Local, value: a.Value})
+				}
+			}
+
+			space, ok := n.lookupNamespace(n.prefix)
+			if !ok && n.prefix != "" {
+				return nil, fmt.Errorf("xml: unbound prefix %q", n.prefix)
+			}
+			n.space = space
+			for i := range n.attrs {
+				if n.attrs[i].prefix == "" {
+					continue
+				}
+				if n.attrs[i].space, ok = n.lookupNamespace(n.attrs[i].prefix); !ok {
+					return nil, fmt.Errorf("xml: unbound prefix %q", n.attrs[i].prefix)
+				}
+			}
+
+			if cur == nil {
+				root = n
+			} else {
+				cur.children = append(cur.children, xmlContent{node: n})
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil || tok.Name.Space != cur.prefix || tok.Name.Local != cur.local {
+				return nil, errors.New("xml: mismatched end element")
+			}
+			cur = cur.parent
+		case xml.CharData:
+			if cur != nil {
+				cur.children = append(cur.children, xmlContent{text: string(tok)})
+			}
+		case xml.Directive:
+			return nil, errors.New("xml: DOCTYPE is not allowed")
+		}
+	}
+
+	if root == nil || cur != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return root, nil
+}
+
+// declare records a namespace declaration on the element.
+func (n *xmlNode) declare(prefix, uri string) {
+	if n.decls == nil {
+		n.decls = make(map[string]string)
+	}
+	n.decls[prefix] = uri
+}
+
+// lookupNamespace returns the namespace bound to prefix in the element's scope.
+func (n *xmlNode) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+
+	for e := n; e != nil; e = e.parent {
+		if uri, ok := e.decls[prefix]; ok {
+			return uri, true
+		}
+	}
+
+	return "", false
+}
+
+// attr returns the value of the unqualified attribute.
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.attrs {
+		if a.prefix == "" && a.local == local {
+			return a.value
+		}
+	}
+
+	return ""
+}
+
+// child returns the first child element with the name, or nil.
+func (n *xmlNode) child(space, local string) *xmlNode {
+	for _, c := range n.children {
+		if c.node != nil && c.node.space == space && c.node.local == local {
+			return c.node
+		}
+	}
+
+	return nil
+}
+
+// childrenNamed returns the child elements with the name.
+func (n *xmlNode) childrenNamed(space, local string) []*xmlNode {
+	var nodes []*xmlNode
+	for _, c := range n.children {
+		if c.node != nil && c.node.space == space && c.node.local == local {
+			nodes = append(nodes, c.node)
+		}
+	}
+
+	return nodes
+}
+
+// text returns the element's text content, trimmed.
+func (n *xmlNode) text() string {
+	var b strings.Builder
+	for _, c := range n.children {
+		if c.node == nil {
+			b.WriteString(c.text)
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// walk calls fn for the element and its descendants.
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	fn(n)
+	for _, c := range n.children {
+		if c.node != nil {
+			c.node.walk(fn)
+		}
+	}
+}
+
+// canonicalize writes the element in Exclusive XML Canonicalization form, without comments.
+// Parameters:
+// - buf: Where the canonical form is written.
+// - rendered: The namespace declarations already written by output ancestors, by prefix.
+// - inclusive: Prefixes from an InclusiveNamespaces PrefixList, declared wherever they are in scope.
+// - exclude: An element left out of the output, e.g. an enveloped signature.
+func (n *xmlNode) canonicalize(buf *bytes.Buffer, rendered map[string]string, inclusive map[string]bool, exclude *xmlNode) {
+	used := map[string]bool{n.prefix: true}
+	for _, a := range n.attrs {
+		if a.prefix != "" {
+			used[a.prefix] = true
+		}
+	}
+	for p := range inclusive {
+		if _, ok := n.lookupNamespace(p); ok {
+			used[p] = true
+		}
+	}
+	delete(used, "xml")
+
+	prefixes := make([]string, 0, len(used))
+	for p := range used {
+		uri, _ := n.lookupNamespace(p)
+		if prev, ok := rendered[p]; ok && prev == uri || !ok && p == "" && uri == "" {
+			continue
+		}
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	if len(prefixes) > 0 {
+		scope := make(map[string]string, len(rendered)+len(prefixes))
+		for p, uri := range rendered {
+			scope[p] = uri
+		}
+		rendered = scope
+	}
+
+	buf.WriteByte('<')
+	writeQName(buf, n.prefix, n.local)
+
+	for _, p := range prefixes {
+		uri, _ := n.lookupNamespace(p)
+		rendered[p] = uri
+
+		buf.WriteString(" xmlns")
+		if p != "" {
+			buf.WriteByte(':')
+			buf.WriteString(p)
+		}
+		buf.WriteString(`="`)
+		writeCanonicalAttr(buf, uri)
+		buf.WriteByte('"')
+	}
+
+	attrs := append([]xmlAttr(nil), n.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+	for _, a := range attrs {
+		buf.WriteByte(' ')
+		writeQName(buf, a.prefix, a.local)
+		buf.WriteString(`="`)
+		writeCanonicalAttr(buf, a.value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, c := range n.children {
+		switch {
+		case c.node == nil:
+			writeCanonicalText(buf, c.text)
+		case c.node != exclude:
+			c.node.canonicalize(buf, rendered, inclusive, exclude)
+		}
+	}
+
+	buf.WriteString("</")
+	writeQName(buf, n.prefix, n.local)
+	buf.WriteByte('>')
+}
+
+// writeQName writes a qualified name.
+func writeQName(buf *bytes.Buffer, prefix, local string) {
+	if prefix != "" {
+		buf.WriteString(prefix)
+		buf.WriteByte(':')
+	}
+	buf.WriteString(local)
+}
+
+// writeCanonicalAttr writes an attribute value escaped as canonical XML requires.
+func writeCanonicalAttr(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// writeCanonicalText writes text escaped as canonical XML requires.
+func writeCanonicalText(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// inclusivePrefixes returns the PrefixList of an exclusive canonicalization algorithm element.
+func inclusivePrefixes(method *xmlNode) map[string]bool {
+	list := method.child(algExcC14N, "InclusiveNamespaces")
+	if list == nil {
+		return nil
+	}
+
+	prefixes := make(map[string]bool)
+	for _, p := range strings.Fields(list.attr("PrefixList")) {
+		if p == "#default" {
+			p = ""
+		}
+		prefixes[p] = true
+	}
+
+	return prefixes
+}
+
+// verifyEnvelopedSignature verifies the XML signature that el carries as a direct child, as SAML identity
+// providers sign responses and assertions. Only the profile SAML uses is accepted: a single reference to el's ID
+// attribute, the enveloped signature and exclusive canonicalization transforms, SHA-256 digests and RSA-SHA256
+// signatures. The key is never taken from the document, only from certs.
+// Parameters:
+// - el: The signed element.
+// - certs: The certificates of the trusted signers.
+// Returns errUnsigned if el carries no signature, or an error if the signature is invalid.
+func verifyEnvelopedSignature(el *xmlNode, certs []*x509.Certificate) error {
+	sig := el.child(nsDSig, "Signature")
+	if sig == nil {
+		return errUnsigned
+	}
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("xmldsig: missing SignedInfo")
+	}
+
+	c14n := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14n == nil || c14n.attr("Algorithm") != algExcC14N {
+		return errors.New("xmldsig: unsupported canonicalization method")
+	}
+	if method := signedInfo.child(nsDSig, "SignatureMethod"); method == nil || method.attr("Algorithm") != algRSASHA256 {
+		return errors.New("xmldsig: unsupported signature method")
+	}
+
+	refs := signedInfo.childrenNamed(nsDSig, "Reference")
+	id := el.attr("ID")
+	if len(refs) != 1 || id == "" || refs[0].attr("URI") != "#"+id {
+		return errors.New("xmldsig: the signature does not reference the signed element")
+	}
+	ref := refs[0]
+
+	var enveloped bool
+	var refInclusive map[string]bool
+	var hasC14N bool
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, tr := range transforms.childrenNamed(nsDSig, "Transform") {
+			switch tr.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				hasC14N = true
+				refInclusive = inclusivePrefixes(tr)
+			default:
+				return fmt.Errorf("xmldsig: unsupported transform %q", tr.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !hasC14N {
+		return errors.New("xmldsig: the reference must use the enveloped signature and exclusive canonicalization transforms")
+	}
+	if method := ref.child(nsDSig, "DigestMethod"); method == nil || method.attr("Algorithm") != algDigestSHA256 {
+		return errors.New("xmldsig: unsupported digest method")
+	}
+
+	digestNode := ref.child(nsDSig, "DigestValue")
+	if digestNode == nil {
+		return errors.New("xmldsig: missing DigestValue")
+	}
+	want, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(digestNode.text()), ""))
+	if err != nil {
+		return errors.New("xmldsig: invalid DigestValue")
+	}
+
+	var buf bytes.Buffer
+	el.canonicalize(&buf, nil, refInclusive, sig)
+	digest := sha256.Sum256(buf.Bytes())
+	if subtle.ConstantTimeCompare(digest[:], want) != 1 {
+		return errors.New("xmldsig: digest mismatch")
+	}
+
+	valueNode := sig.child(nsDSig, "SignatureValue")
+	if valueNode == nil {
+		return errors.New("xmldsig: missing SignatureValue")
+	}
+	value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(valueNode.text()), ""))
+	if err != nil {
+		return errors.New("xmldsig: invalid SignatureValue")
+	}
+
+	buf.Reset()
+	signedInfo.canonicalize(&buf, nil, inclusivePrefixes(c14n), nil)
+	hashed := sha256.Sum256(buf.Bytes())
+
+	for _, cert := range certs {
+		if key, ok := cert.PublicKey.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], value) == nil {
+			return nil
+		}
+	}
+
+	return errors.New("xmldsig: the signature is not from a trusted certificate")
+}
@@ -0,0 +1,73 @@
+package toolkit
+
+import (
+	"bytes"
+	"testing"
+)
+
+var canonicalizeTests = []struct {
+	name     string
+	input    string
+	path     []string
+	expected string
+}{
+	{
+		name:     "exclusive namespaces",
+		input:    `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`,
+		path:     []string{"elem2"},
+		expected: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`,
+	},
+	{
+		name:     "attribute order and escaping",
+		input:    `<r xmlns:z="urn:a" xmlns:y="urn:b" y:k="1" z:k="2" c="a&quot;&#10;b"><![CDATA[<x> & y]]></r>`,
+		expected: `<r xmlns:y="urn:b" xmlns:z="urn:a" c="a&quot;&#xA;b" z:k="2" y:k="1">&lt;x&gt; &amp; y</r>`,
+	},
+	{
+		name:     "default namespace",
+		input:    `<?xml version="1.0"?><!-- c --><a xmlns="urn:x"><b xmlns=""/><c/></a>`,
+		expected: `<a xmlns="urn:x"><b xmlns=""></b><c></c></a>`,
+	},
+	{
+		name:     "unused declarations",
+		input:    `<p:a xmlns:p="urn:p" xmlns:q="urn:q"><p:b/></p:a>`,
+		expected: `<p:a xmlns:p="urn:p"><p:b></p:b></p:a>`,
+	},
+}
+
+func TestXMLNode_Canonicalize(t *testing.T) {
+	for _, e := range canonicalizeTests {
+		root, err := parseXMLTree([]byte(e.input))
+		if err != nil {
+			t.Fatalf("%s: %v", e.name, err)
+		}
+
+		n := root
+		for _, local := range e.path {
+			for _, c := range n.children {
+				if c.node != nil && c.node.local == local {
+					n = c.node
+				}
+			}
+		}
+
+		var buf bytes.Buffer
+		n.canonicalize(&buf, nil, nil, nil)
+		if buf.String() != e.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", e.name, e.expected, buf.String())
+		}
+	}
+}
+
+func TestParseXMLTree_Rejects(t *testing.T) {
+	for _, input := range []string{
+		`<!DOCTYPE a [<!ENTITY x "y">]><a>&x;</a>`,
+		`<a><b></a></b>`,
+		`<p:a/>`,
+		`<a/><b/>`,
+		`<a>`,
+	} {
+		if _, err := parseXMLTree([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}